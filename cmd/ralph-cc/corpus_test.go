@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// update makes TestE2EAsmYAML rewrite the expect list of each case it runs
+// with the instructions the compiler now emits, instead of checking them
+var update = flag.Bool("update", false, "rewrite the expect lists of testdata/e2e_asm.yaml from the current output")
+
+// caseFilter returns the regular expression of RALPH_TEST_FILTER, which
+// selects the cases of the testdata YAML files to run by name. Unset, it
+// matches every case.
+func caseFilter(t *testing.T) *regexp.Regexp {
+	re, err := regexp.Compile(os.Getenv("RALPH_TEST_FILTER"))
+	if err != nil {
+		t.Fatalf("invalid RALPH_TEST_FILTER: %v", err)
+	}
+	return re
+}
+
+// expectedInstructions returns the instruction lines of an assembly
+// listing, without their indentation, as an expect list records them.
+// Directives and labels are left out.
+func expectedInstructions(asm string) []string {
+	var instrs []string
+	for _, line := range strings.Split(asm, "\n") {
+		if !strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "\t.") {
+			continue
+		}
+		instrs = append(instrs, strings.TrimPrefix(line, "\t"))
+	}
+	return instrs
+}
+
+// updateExpectations sets the expect list of each case of the YAML test
+// file at path named in outputs to the instructions of its output. The
+// file is edited as text, at the lines the parsed document gives, so its
+// comments and layout are kept: an existing expect list is replaced and a
+// missing one added after the last line of the case.
+func updateExpectations(path string, outputs map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	tests := mappingValue(doc.Content[0], "tests")
+	if tests == nil {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	type edit struct {
+		from, to int // the lines replaced, lines[from:to]
+		text     []string
+	}
+	var edits []edit
+	for i, tc := range tests.Content {
+		name := mappingValue(tc, "name")
+		if name == nil {
+			continue
+		}
+		output, ok := outputs[name.Value]
+		if !ok {
+			continue
+		}
+		indent := strings.Repeat(" ", tc.Column-1)
+		text := []string{indent + "expect:"}
+		for _, instr := range expectedInstructions(output) {
+			text = append(text, indent+"  - "+strconv.Quote(instr))
+		}
+
+		if key := mappingKey(tc, "expect"); key != nil {
+			end := key.Line
+			if items := mappingValue(tc, "expect").Content; len(items) > 0 {
+				end = items[len(items)-1].Line
+			}
+			edits = append(edits, edit{key.Line - 1, end, text})
+			continue
+		}
+		// The case ends before the next one, less the blank lines and
+		// the comments above that one
+		end := len(lines)
+		if i+1 < len(tests.Content) {
+			end = tests.Content[i+1].Line - 1
+		}
+		for end > 0 {
+			line := strings.TrimSpace(lines[end-1])
+			comment := strings.HasPrefix(line, "#") && !strings.HasPrefix(lines[end-1], indent)
+			if line != "" && !comment {
+				break
+			}
+			end--
+		}
+		edits = append(edits, edit{end, end, text})
+	}
+
+	// Later edits first, so the lines of the earlier ones stay put
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		lines = append(lines[:e.from], append(e.text, lines[e.to:]...)...)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// mappingKey returns the key node of key in a YAML mapping node, or nil
+func mappingKey(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node of key in a YAML mapping node, or nil
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func TestCaseFilter(t *testing.T) {
+	names := []string{"switch on an int compares 32 bits", "switch on a long compares 64 bits", "hello world - return zero"}
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", names},
+		{"^switch", names[:2]},
+		{"long", names[1:2]},
+		{"no such case", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			t.Setenv("RALPH_TEST_FILTER", tt.filter)
+			filter := caseFilter(t)
+			var got []string
+			for _, name := range names {
+				if filter.MatchString(name) {
+					got = append(got, name)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("expected %q to select %q, got %q", tt.filter, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateExpectations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cases.yaml")
+	original := `tests:
+  - name: "replaced"
+    input: |
+      int f(void) { return 1; }
+    expect:
+      - "stale"
+    expect_not:
+      - "bl\t"
+
+  ## Section comment
+  - name: "added"
+    input: |
+      #define N 2
+      int g(void) { return N; }
+
+  - name: "untouched"
+    input: |
+      int h(void) { return 3; }
+    expect:
+      - "kept"
+`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]string{
+		"replaced": "f:\n\tmov\tw0, #1\n\tret\n",
+		"added":    "\t.text\ng:\n\tmov\tw0, #2\n",
+	}
+	if err := updateExpectations(path, outputs); err != nil {
+		t.Fatalf("updateExpectations: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `tests:
+  - name: "replaced"
+    input: |
+      int f(void) { return 1; }
+    expect:
+      - "mov\tw0, #1"
+      - "ret"
+    expect_not:
+      - "bl\t"
+
+  ## Section comment
+  - name: "added"
+    input: |
+      #define N 2
+      int g(void) { return N; }
+    expect:
+      - "mov\tw0, #2"
+
+  - name: "untouched"
+    input: |
+      int h(void) { return 3; }
+    expect:
+      - "kept"
+`
+	if string(data) != want {
+		t.Errorf("unexpected update\n--- got ---\n%s\n--- want ---\n%s", data, want)
+	}
+
+	// The rewritten file still loads, with the new expectations
+	var file E2EAsmTestFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatalf("rewritten file does not parse: %v", err)
+	}
+	if got := file.Tests[1].Expect; len(got) != 1 || got[0] != "mov\tw0, #2" {
+		t.Errorf("expected the added case to expect mov, got %q", got)
+	}
+}
+
+// TestE2EAsmDeterministic compiles each e2e_asm case several times and
+// checks the assembly is the same every time, as the expect lists -update
+// records rely on
+func TestE2EAsmDeterministic(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/e2e_asm.yaml")
+	if err != nil {
+		t.Fatalf("e2e_asm.yaml not found: %v", err)
+	}
+	var testFile E2EAsmTestFile
+	if err := yaml.Unmarshal(data, &testFile); err != nil {
+		t.Fatalf("failed to parse e2e_asm.yaml: %v", err)
+	}
+
+	filter := caseFilter(t)
+	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) || tc.Skip != "" {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			testCFile := filepath.Join(t.TempDir(), "test.c")
+			if err := os.WriteFile(testCFile, []byte(tc.Input), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+			var first string
+			for i := 0; i < 5; i++ {
+				resetDebugFlags()
+				var out, errOut bytes.Buffer
+				cmd := newRootCmd(&out, &errOut)
+				cmd.SetArgs(append(append([]string{"--dasm"}, tc.Flags...), testCFile))
+				if err := cmd.Execute(); err != nil {
+					t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, errOut.String())
+				}
+				if i == 0 {
+					first = out.String()
+				} else if out.String() != first {
+					t.Fatalf("compilation %d differs from the first\n--- first ---\n%s\n--- now ---\n%s", i+1, first, out.String())
+				}
+			}
+		})
+	}
+}
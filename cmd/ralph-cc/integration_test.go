@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -41,9 +42,10 @@ func transformExpectedForDarwin(exp string) string {
 
 // IntegrationTestSpec represents a single integration test case
 type IntegrationTestSpec struct {
-	Name  string `yaml:"name"`
-	Input string `yaml:"input"`
-	Skip  string `yaml:"skip,omitempty"` // Reason to skip this test
+	Name   string   `yaml:"name"`
+	Input  string   `yaml:"input"`
+	Stages []string `yaml:"stages,omitempty"` // IRs compared after -dparse, e.g. clight, cminor
+	Skip   string   `yaml:"skip,omitempty"`   // Reason to skip this test
 }
 
 // IntegrationTestFile represents the integration.yaml file structure
@@ -59,6 +61,7 @@ type E2EAsmTestSpec struct {
 	ExpectOrder  []string `yaml:"expect_order"`  // Strings that must appear in this order
 	ExpectUnique []string `yaml:"expect_unique"` // Strings that must appear exactly once
 	ExpectNot    []string `yaml:"expect_not"`    // Strings that must NOT appear in output
+	Flags        []string `yaml:"flags"`         // Extra command-line flags, e.g. --O2
 	Skip         string   `yaml:"skip,omitempty"`
 }
 
@@ -117,7 +120,11 @@ func TestIntegrationCompCertEquivalence(t *testing.T) {
 		t.Fatalf("failed to parse integration.yaml: %v", err)
 	}
 
+	filter := caseFilter(t)
 	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
 		t.Run(tc.Name, func(t *testing.T) {
 			if tc.Skip != "" {
 				t.Skip(tc.Skip)
@@ -157,6 +164,94 @@ func TestIntegrationCompCertEquivalence(t *testing.T) {
 	}
 }
 
+// compCertStage describes how to dump and compare one IR
+type compCertStage struct {
+	flag      string              // dump flag understood by both compilers
+	ext       string              // extension of the dump ccomp writes next to the input
+	normalize func(string) string // canonicalizes a dump for comparison
+}
+
+// compCertStages lists the IRs that integration tests may compare
+var compCertStages = map[string]compCertStage{
+	"clight": {"-dclight", ".light.c", normalizeClight},
+	"cminor": {"-dcminor", ".cm", normalizeCminor},
+}
+
+// TestIntegrationCompCertStages compares the IR dumps listed in each test
+// case's stages with the ones CompCert writes
+func TestIntegrationCompCertStages(t *testing.T) {
+	ccompPath, found := findCompCert()
+	if !found {
+		t.Skip("CompCert ccomp not found; set COMPCERT env var or build compcert submodule")
+	}
+
+	data, err := os.ReadFile("../../testdata/integration.yaml")
+	if err != nil {
+		t.Skipf("integration.yaml not found: %v", err)
+	}
+
+	var testFile IntegrationTestFile
+	if err := yaml.Unmarshal(data, &testFile); err != nil {
+		t.Fatalf("failed to parse integration.yaml: %v", err)
+	}
+
+	filter := caseFilter(t)
+	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
+		for _, name := range tc.Stages {
+			stage, ok := compCertStages[name]
+			if !ok {
+				t.Fatalf("%s: unknown stage %q", tc.Name, name)
+			}
+			t.Run(tc.Name+"/"+name, func(t *testing.T) {
+				if tc.Skip != "" {
+					t.Skip(tc.Skip)
+				}
+
+				tmpDir := t.TempDir()
+				testFile := filepath.Join(tmpDir, "test.c")
+				if err := os.WriteFile(testFile, []byte(tc.Input), 0644); err != nil {
+					t.Fatalf("failed to write test file: %v", err)
+				}
+
+				ccompOut, err := runCompCertStage(ccompPath, stage, testFile)
+				if err != nil {
+					t.Fatalf("CompCert failed: %v\nOutput: %s", err, ccompOut)
+				}
+
+				resetDebugFlags()
+				var ralphOut, ralphErrOut bytes.Buffer
+				cmd := newRootCmd(&ralphOut, &ralphErrOut)
+				cmd.SetArgs(normalizeFlags([]string{stage.flag, testFile}))
+				if err := cmd.Execute(); err != nil {
+					t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, ralphErrOut.String())
+				}
+
+				ccompNorm := stage.normalize(ccompOut)
+				ralphNorm := stage.normalize(ralphOut.String())
+				if ccompNorm != ralphNorm {
+					t.Errorf("Output mismatch\n--- CompCert (normalized) ---\n%s\n--- ralph-cc (normalized) ---\n%s",
+						ccompNorm, ralphNorm)
+				}
+			})
+		}
+	}
+}
+
+// runCompCertStage compiles inputFile with ccomp, dumping one IR, and
+// returns the dump
+func runCompCertStage(ccompPath string, stage compCertStage, inputFile string) (string, error) {
+	obj := strings.TrimSuffix(inputFile, ".c") + ".o"
+	cmd := exec.Command(ccompPath, "-c", stage.flag, "-o", obj, inputFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return string(output), err
+	}
+	dump, err := os.ReadFile(strings.TrimSuffix(inputFile, ".c") + stage.ext)
+	return string(dump), err
+}
+
 // runCompCert executes ccomp with -dparse flag
 func runCompCert(ccompPath, inputFile string) (string, error) {
 	cmd := exec.Command(ccompPath, "-dparse", inputFile)
@@ -183,6 +278,130 @@ func normalizeOutput(s string) string {
 	return strings.Join(normalized, "\n")
 }
 
+var (
+	// CompCert declares its builtins in every dump; ralph-cc does not
+	builtinDeclRE = regexp.MustCompile(`^\s*extern\b.*\b__(builtin|compcert)_`)
+	clightTempRE  = regexp.MustCompile(`\$\d+`)
+	cminorTempRE  = regexp.MustCompile(`"?(\$\d+|_t\d+)"?`)
+)
+
+// dropBuiltinDecls removes CompCert's builtin declarations from a dump
+func dropBuiltinDecls(s string) string {
+	var kept []string
+	for _, line := range strings.Split(s, "\n") {
+		if !builtinDeclRE.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// renumber replaces each distinct match of re with prefix followed by its
+// rank in order of first appearance, so dumps that number temporaries
+// differently compare equal. Matches are told apart by their first
+// submatch if re has one.
+func renumber(s string, re *regexp.Regexp, prefix string) string {
+	ids := make(map[string]int)
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		key := m
+		if sub := re.FindStringSubmatch(m); len(sub) > 1 {
+			key = sub[1]
+		}
+		id, ok := ids[key]
+		if !ok {
+			id = len(ids) + 1
+			ids[key] = id
+		}
+		return prefix + strconv.Itoa(id)
+	})
+}
+
+// normalizeClight canonicalizes a -dclight dump: builtin declarations
+// are dropped, temporaries ($128, ...) renumbered from $1 and the register
+// storage class CompCert gives temporaries removed
+func normalizeClight(s string) string {
+	s = dropBuiltinDecls(s)
+	s = strings.ReplaceAll(s, "register ", "")
+	return normalizeOutput(renumber(s, clightTempRE, "$"))
+}
+
+// normalizeCminor canonicalizes a -dcminor dump: builtin declarations are
+// dropped and temporaries, whether CompCert's $128 or ralph-cc's "_t0",
+// renumbered from $1
+func normalizeCminor(s string) string {
+	s = dropBuiltinDecls(s)
+	return normalizeOutput(renumber(s, cminorTempRE, "$"))
+}
+
+// TestStageNormalizers checks that dumps differing only in ways the
+// normalizers remove compare equal
+func TestStageNormalizers(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize func(string) string
+		ccomp     string
+		ralph     string
+	}{
+		{
+			name:      "clight temporaries",
+			normalize: normalizeClight,
+			ccomp: `extern unsigned int __builtin_bswap(unsigned int);
+
+int f(int x)
+{
+  register int $128;
+  register int $129;
+  $128 = x + 1;
+  $129 = $128 * 2;
+  return $129;
+}
+`,
+			ralph: `int f(int x)
+{
+  int $1;
+  int $2;
+
+  $1 = x + 1;
+  $2 = $1 * 2;
+  return $2;
+}
+`,
+		},
+		{
+			name:      "cminor temporaries",
+			normalize: normalizeCminor,
+			ccomp: `extern "__builtin_bswap" = builtin "__builtin_bswap" : int -> int
+"f"(x) : int -> int
+{
+  var $128;
+  $128 = "x" + 1;
+  return $128;
+}
+`,
+			ralph: `"f"(x) : int -> int
+{
+  var _t0;
+  _t0 = "x" + 1;
+  return "_t0";
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := tt.normalize(tt.ralph), tt.normalize(tt.ccomp); got != want {
+				t.Errorf("normalized dumps differ\n--- ccomp ---\n%s\n--- ralph-cc ---\n%s", want, got)
+			}
+		})
+	}
+
+	// Renumbering keeps distinct temporaries distinct
+	if normalizeClight("$5 = $6;") == normalizeClight("$5 = $5;") {
+		t.Errorf("expected distinct temporaries to stay distinct")
+	}
+}
+
 // TestIntegrationDParseBasic tests that -dparse works for basic inputs without CompCert
 func TestIntegrationDParseBasic(t *testing.T) {
 	tests := []struct {
@@ -268,10 +487,75 @@ func TestIntegrationDParseBasic(t *testing.T) {
 	}
 }
 
-// TestE2EAsmYAML tests end-to-end C to ARM64 assembly generation using yaml test cases
+// TestIntegrationDLinear checks that -dlinear dumps linearized code with
+// explicit labels and branches, and writes it next to the input file
+func TestIntegrationDLinear(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect []string // Strings that must appear in output
+	}{
+		{
+			name:   "straight-line function",
+			input:  "int add(int a, int b) { return a + b; }",
+			expect: []string{"add() {", "add(", "return"},
+		},
+		{
+			name:   "conditional",
+			input:  "int f(int x) { if (x > 10) return 1; return 0; }",
+			expect: []string{"f() {", "if ", "goto L", "return"},
+		},
+		{
+			name:   "loop",
+			input:  "int f(int n) { int s = 0; while (n > 0) { s = s + n; n--; } return s; }",
+			expect: []string{"f() {", "L", "goto L", "sub("},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "test.c")
+			if err := os.WriteFile(testFile, []byte(tc.input), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			resetDebugFlags()
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs(normalizeFlags([]string{"-dlinear", testFile}))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, errOut.String())
+			}
+
+			output := out.String()
+			for _, exp := range tc.expect {
+				if !strings.Contains(output, exp) {
+					t.Errorf("expected output to contain %q\nGot:\n%s", exp, output)
+				}
+			}
+
+			written, err := os.ReadFile(filepath.Join(tmpDir, "test.linear"))
+			if err != nil {
+				t.Fatalf("expected test.linear to be written: %v", err)
+			}
+			if string(written) != output {
+				t.Errorf("test.linear differs from stdout\nFile:\n%s\nStdout:\n%s", written, output)
+			}
+		})
+	}
+}
+
+// TestE2EAsmYAML tests end-to-end C to ARM64 assembly generation using yaml test cases.
+// With -update it records the output of each case as its expect list instead.
 func TestE2EAsmYAML(t *testing.T) {
+	const path = "../../testdata/e2e_asm.yaml"
+	if *update && runtime.GOOS == "darwin" {
+		t.Fatal("-update records Linux symbol names; run it on Linux")
+	}
+
 	// Load test cases from YAML
-	data, err := os.ReadFile("../../testdata/e2e_asm.yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
 		t.Fatalf("e2e_asm.yaml not found: %v", err)
 	}
@@ -281,7 +565,12 @@ func TestE2EAsmYAML(t *testing.T) {
 		t.Fatalf("failed to parse e2e_asm.yaml: %v", err)
 	}
 
+	outputs := make(map[string]string)
+	filter := caseFilter(t)
 	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
 		t.Run(tc.Name, func(t *testing.T) {
 			if tc.Skip != "" {
 				t.Skip(tc.Skip)
@@ -298,12 +587,17 @@ func TestE2EAsmYAML(t *testing.T) {
 			resetDebugFlags()
 			var out, errOut bytes.Buffer
 			cmd := newRootCmd(&out, &errOut)
-			cmd.SetArgs([]string{"--dasm", testCFile})
+			cmd.SetArgs(append(append([]string{"--dasm"}, tc.Flags...), testCFile))
 			if err := cmd.Execute(); err != nil {
 				t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, errOut.String())
 			}
 
 			output := out.String()
+			if *update {
+				outputs[tc.Name] = output
+				return
+			}
+
 			// Check that all expected strings appear in output
 			for _, exp := range tc.Expect {
 				exp = transformExpectedForDarwin(exp)
@@ -345,6 +639,86 @@ func TestE2EAsmYAML(t *testing.T) {
 			}
 		})
 	}
+
+	if *update {
+		if err := updateExpectations(path, outputs); err != nil {
+			t.Fatalf("failed to update e2e_asm.yaml: %v", err)
+		}
+	}
+}
+
+// findAArch64Assembler returns the command that assembles the compiler's
+// output into an object: the system as on an ARM64 host, otherwise, on
+// Linux, a cross assembler or llvm-mc when one is installed.
+func findAArch64Assembler() ([]string, bool) {
+	if runtime.GOARCH == "arm64" {
+		if path, err := exec.LookPath("as"); err == nil {
+			return []string{path}, true
+		}
+		return nil, false
+	}
+	if runtime.GOOS != "linux" {
+		return nil, false
+	}
+	if path, err := exec.LookPath("aarch64-linux-gnu-as"); err == nil {
+		return []string{path}, true
+	}
+	if path, err := exec.LookPath("llvm-mc"); err == nil {
+		return []string{path, "-triple=aarch64-linux-gnu", "-filetype=obj"}, true
+	}
+	return nil, false
+}
+
+// TestE2EAsmAssembles feeds the assembly of every e2e_asm case to an
+// assembler. The string matching of TestE2EAsmYAML accepts instructions
+// that do not encode, like an out of range immediate or a wrong operand
+// count; the assembler rejects them.
+func TestE2EAsmAssembles(t *testing.T) {
+	assembler, ok := findAArch64Assembler()
+	if !ok {
+		t.Skip("no ARM64 assembler found in PATH")
+	}
+
+	data, err := os.ReadFile("../../testdata/e2e_asm.yaml")
+	if err != nil {
+		t.Fatalf("e2e_asm.yaml not found: %v", err)
+	}
+	var testFile E2EAsmTestFile
+	if err := yaml.Unmarshal(data, &testFile); err != nil {
+		t.Fatalf("failed to parse e2e_asm.yaml: %v", err)
+	}
+
+	filter := caseFilter(t)
+	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			if tc.Skip != "" {
+				t.Skip(tc.Skip)
+			}
+
+			tmpDir := t.TempDir()
+			testCFile := filepath.Join(tmpDir, "test.c")
+			if err := os.WriteFile(testCFile, []byte(tc.Input), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			resetDebugFlags()
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs(append(append([]string{"--dasm"}, tc.Flags...), testCFile))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, errOut.String())
+			}
+
+			// --dasm writes test.s next to the source
+			args := append(append([]string{}, assembler[1:]...), "-o", filepath.Join(tmpDir, "test.o"), filepath.Join(tmpDir, "test.s"))
+			if output, err := exec.Command(assembler[0], args...).CombinedOutput(); err != nil {
+				t.Errorf("assembler failed: %v\nOutput: %s\nAssembly:\n%s", err, output, out.String())
+			}
+		})
+	}
 }
 
 // TestIncludeDirective tests that #include directives work
@@ -402,10 +776,11 @@ int main() {
 
 // E2ERuntimeTestSpec represents a single end-to-end runtime test case
 type E2ERuntimeTestSpec struct {
-	Name         string `yaml:"name"`
-	Input        string `yaml:"input"`
-	ExpectedExit int    `yaml:"expected_exit"`
-	Skip         string `yaml:"skip,omitempty"`
+	Name         string   `yaml:"name"`
+	Input        string   `yaml:"input"`
+	ExpectedExit int      `yaml:"expected_exit"`
+	Flags        []string `yaml:"flags"` // Extra command-line flags, e.g. --O2
+	Skip         string   `yaml:"skip,omitempty"`
 }
 
 // E2ERuntimeTestFile represents the e2e_runtime.yaml file structure
@@ -434,7 +809,11 @@ func TestE2ERuntimeYAML(t *testing.T) {
 		t.Fatalf("failed to parse e2e_runtime.yaml: %v", err)
 	}
 
+	filter := caseFilter(t)
 	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
 		t.Run(tc.Name, func(t *testing.T) {
 			if tc.Skip != "" {
 				t.Skip(tc.Skip)
@@ -452,20 +831,25 @@ func TestE2ERuntimeYAML(t *testing.T) {
 				t.Fatalf("failed to write test file: %v", err)
 			}
 
-			// Step 1: Compile C to assembly with ralph-cc
+			// Step 1: Compile C to assembly with ralph-cc. Linking with a
+			// bare ld leaves out the crt startup files on Linux, so the
+			// program gets its own entry point there.
+			sdkPath, _ := exec.Command("xcrun", "--show-sdk-path").Output()
+			sdkPathStr := strings.TrimSpace(string(sdkPath))
+			args := []string{"--dasm"}
+			if sdkPathStr == "" {
+				args = append(args, "--freestanding-main")
+			}
 			resetDebugFlags()
 			var asmOut, errOut bytes.Buffer
 			cmd := newRootCmd(&asmOut, &errOut)
-			cmd.SetArgs([]string{"--dasm", testCFile})
+			cmd.SetArgs(append(append(args, tc.Flags...), testCFile))
 			if err := cmd.Execute(); err != nil {
 				t.Fatalf("ralph-cc failed: %v\nStderr: %s", err, errOut.String())
 			}
 
-			// Step 2: Convert to macOS format if needed
+			// Step 2: Write assembly (the printer emits host-format directives)
 			asmContent := asmOut.String()
-			asmContent = convertToMacOS(asmContent)
-
-			// Write assembly
 			if err := os.WriteFile(testSFile, []byte(asmContent), 0644); err != nil {
 				t.Fatalf("failed to write assembly: %v", err)
 			}
@@ -479,8 +863,6 @@ func TestE2ERuntimeYAML(t *testing.T) {
 			// Step 4: Link
 			// On macOS, need to link with -lSystem
 			var ldCmd *exec.Cmd
-			sdkPath, _ := exec.Command("xcrun", "--show-sdk-path").Output()
-			sdkPathStr := strings.TrimSpace(string(sdkPath))
 			if sdkPathStr != "" {
 				ldCmd = exec.Command("ld", "-o", testExe, testOFile, "-lSystem", "-L"+sdkPathStr+"/usr/lib")
 			} else {
@@ -502,73 +884,6 @@ func TestE2ERuntimeYAML(t *testing.T) {
 	}
 }
 
-// convertToMacOS converts ELF-style assembly to macOS format
-func convertToMacOS(asm string) string {
-	lines := strings.Split(asm, "\n")
-	var result []string
-
-	for _, line := range lines {
-		// Skip .type and .size directives (not supported on macOS)
-		if strings.HasPrefix(strings.TrimSpace(line), ".type") ||
-			strings.HasPrefix(strings.TrimSpace(line), ".size") {
-			continue
-		}
-
-		// Add underscore prefix to global symbols
-		if strings.Contains(line, ".global\t") {
-			// Extract symbol name and add underscore
-			parts := strings.Split(line, "\t")
-			if len(parts) >= 2 {
-				sym := parts[len(parts)-1]
-				if !strings.HasPrefix(sym, ".") && !strings.HasPrefix(sym, "_") { // Don't prefix local labels or already prefixed
-					// Replace only the symbol part, not the directive
-					line = "\t.global\t_" + sym
-				}
-			}
-		}
-
-		// Add underscore prefix to function labels (lines like "main:")
-		trimmed := strings.TrimSpace(line)
-		if strings.HasSuffix(trimmed, ":") && !strings.HasPrefix(trimmed, ".") {
-			// This is a label - add underscore if it's a function
-			label := strings.TrimSuffix(trimmed, ":")
-			if !strings.HasPrefix(label, ".L") && !strings.HasPrefix(label, "_") { // Not a local label or already prefixed
-				line = "_" + trimmed
-			}
-		}
-
-		// Convert bl calls to external functions
-		if strings.Contains(line, "\tbl\t") {
-			parts := strings.Split(line, "\tbl\t")
-			if len(parts) == 2 {
-				sym := strings.TrimSpace(parts[1])
-				if !strings.HasPrefix(sym, "_") && !strings.HasPrefix(sym, ".") {
-					line = parts[0] + "\tbl\t_" + sym
-				}
-			}
-		}
-
-		// Handle adrp/add @PAGE/@PAGEOFF for macOS (skip if already present)
-		if strings.Contains(line, "adrp") && strings.Contains(line, ".Lstr") && !strings.Contains(line, "@PAGE") {
-			// adrp x0, .Lstr0 -> adrp x0, .Lstr0@PAGE
-			parts := strings.Fields(line)
-			if len(parts) >= 3 && strings.HasPrefix(parts[2], ".Lstr") {
-				// parts[1] already has comma like "x0," so don't add another
-				reg := strings.TrimSuffix(parts[1], ",")
-				line = parts[0] + "\t" + reg + ", " + parts[2] + "@PAGE"
-			}
-		}
-		if strings.Contains(line, "add") && strings.Contains(line, "#0") && strings.Contains(line, ".Lstr") && !strings.Contains(line, "@PAGEOFF") {
-			// add x0, x0, #0 after adrp for .Lstr should use @PAGEOFF
-			// This is a simplified detection - look for pattern
-		}
-
-		result = append(result, line)
-	}
-
-	return strings.Join(result, "\n")
-}
-
 // TestPreprocessedFileExtension tests that .i files are not preprocessed
 func TestPreprocessedFileExtension(t *testing.T) {
 	tmpDir := t.TempDir()
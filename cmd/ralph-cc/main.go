@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/raymyers/ralph-cc/pkg/asm"
@@ -14,17 +15,26 @@ import (
 	"github.com/raymyers/ralph-cc/pkg/clightgen"
 	"github.com/raymyers/ralph-cc/pkg/cminor"
 	"github.com/raymyers/ralph-cc/pkg/cminorgen"
+	"github.com/raymyers/ralph-cc/pkg/cminorsel"
 	"github.com/raymyers/ralph-cc/pkg/csharpminor"
 	"github.com/raymyers/ralph-cc/pkg/cshmgen"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/ctyping"
+	"github.com/raymyers/ralph-cc/pkg/deadfunc"
+	"github.com/raymyers/ralph-cc/pkg/diag"
 	"github.com/raymyers/ralph-cc/pkg/lexer"
+	"github.com/raymyers/ralph-cc/pkg/licm"
+	"github.com/raymyers/ralph-cc/pkg/linear"
 	"github.com/raymyers/ralph-cc/pkg/linearize"
 	"github.com/raymyers/ralph-cc/pkg/ltl"
 	"github.com/raymyers/ralph-cc/pkg/mach"
+	"github.com/raymyers/ralph-cc/pkg/optreport"
 	"github.com/raymyers/ralph-cc/pkg/parser"
 	"github.com/raymyers/ralph-cc/pkg/preproc"
 	"github.com/raymyers/ralph-cc/pkg/regalloc"
 	"github.com/raymyers/ralph-cc/pkg/rtl"
 	"github.com/raymyers/ralph-cc/pkg/rtlgen"
+	"github.com/raymyers/ralph-cc/pkg/scheduling"
 	"github.com/raymyers/ralph-cc/pkg/selection"
 	"github.com/raymyers/ralph-cc/pkg/stacking"
 	"github.com/spf13/cobra"
@@ -32,30 +42,85 @@ import (
 
 var version = "0.1.0"
 
+// stdinFilename is the filename that selects standard input as the source.
+// Outputs are then named after stdinBasename (stdin.parsed.c, stdin.s, ...).
+const (
+	stdinFilename = "-"
+	stdinBasename = "stdin.c"
+)
+
+// stdin is the source read when the filename is "-"
+var stdin io.Reader = os.Stdin
+
 // Debug flags for dumping intermediate representations
 var (
 	dParse       bool
 	dC           bool
 	dAsm         bool
 	dClight      bool
+	dTypes       bool // --dtypes: dump the resolved types and layouts
 	dCsharpminor bool
 	dCminor      bool
 	dRTL         bool
 	dLTL         bool
+	dLinear      bool
 	dMach        bool
 	dPP          bool // Debug preprocessor
 )
 
+// Passes to stop the compile at and dump the program, by name
+var (
+	dumpAfter  string // --dump-after: dump the output of this pass
+	dumpBefore string // --dump-before: dump the input of this pass
+)
+
 // Preprocessor options
 var (
 	includePaths   []string
 	systemPaths    []string
+	forceIncludes  []string // -include files
 	defineFlags    []string
 	undefineFlags  []string
 	preprocessOnly bool // -E flag
 	useExternalPP  bool // Use external preprocessor
 )
 
+// Optimization options
+var (
+	optO1     bool // -O1: enable whole-program cleanups
+	optO2     bool // -O2: enable optimizations
+	optReport bool // --opt-report: summarize what the optimizations did
+)
+
+// report counts what the optimizations do to the file being compiled, for
+// --opt-report. It is nil without the flag, and the passes then count nothing.
+var report *optreport.Report
+
+// Code generation options
+var (
+	fSignedChar   bool   // -fsigned-char: plain char is signed
+	fUnsignedChar bool   // -funsigned-char: plain char is unsigned (default)
+	annotate      bool   // --annotate: comment the assembly with source lines
+	freestanding  bool   // --freestanding-main: emit a _start that exits with main's result
+	saveTemps     bool   // --save-temps: keep the output of every pass of a compile
+	relocModel    string // --relocation-model: how symbol addresses are computed, pic or static
+	noPIE         bool   // --no-pie: the same as --relocation-model=static
+)
+
+// Visualization options
+var (
+	dumpCFG  bool // --dump-cfg: write the CFG of each RTL function as Graphviz
+	tempBase int  // --temp-base: renumber Clight temporaries in order of use, from this
+)
+
+// Diagnostic options
+var (
+	werror     bool // --werror: treat warnings as errors
+	noWarnings bool // --no-warnings: suppress warnings
+	maxErrors  int  // --max-errors: stop after this many errors
+	pedantic   bool // --pedantic: warn about GNU extensions
+)
+
 // debugFlagInfo holds metadata for a debug flag
 type debugFlagInfo struct {
 	flag *bool
@@ -63,7 +128,7 @@ type debugFlagInfo struct {
 }
 
 // debugFlags maps flag names to descriptions for unimplemented warnings
-// Note: dparse, dclight, dcsharpminor, dcminor, drtl, dltl, dmach, and dasm are handled separately as they're implemented
+// Note: dparse, dclight, dcsharpminor, dcminor, drtl, dltl, dlinear, dmach, and dasm are handled separately as they're implemented
 var debugFlags = map[string]debugFlagInfo{
 	"dc": {&dC, "dump CompCert C"},
 }
@@ -97,12 +162,26 @@ func run() int {
 }
 
 // debugFlagNames lists all debug flags that should accept single-dash style (CompCert compatibility)
-var debugFlagNames = []string{"dparse", "dc", "dasm", "dclight", "dcsharpminor", "dcminor", "drtl", "dltl", "dmach", "dpp"}
+var debugFlagNames = []string{"dparse", "dc", "dasm", "dclight", "dtypes", "dcsharpminor", "dcminor", "drtl", "dltl", "dlinear", "dmach", "dpp", "O1", "O2", "fsigned-char", "funsigned-char", "pedantic", "save-temps", "no-pie"}
+
+// singleDashAliases maps gcc-style single-dash flags to long flags with a
+// different name, e.g. -include (force include) vs --include (-I)
+var singleDashAliases = map[string]string{
+	"include": "include-file",
+	"Werror":  "werror",
+	"w":       "no-warnings",
+}
 
 // normalizeFlags converts CompCert-style single-dash flags like -dparse to --dparse
 func normalizeFlags(args []string) []string {
 	result := make([]string, len(args))
 	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") {
+			if alias, ok := singleDashAliases[arg[1:]]; ok {
+				result[i] = "--" + alias
+				continue
+			}
+		}
 		// Check if it's a single-dash debug flag (e.g., -dparse)
 		for _, flagName := range debugFlagNames {
 			if arg == "-"+flagName {
@@ -119,13 +198,15 @@ func normalizeFlags(args []string) []string {
 
 func newRootCmd(out, errOut io.Writer) *cobra.Command {
 	rootCmd := &cobra.Command{
-		Use:   "ralph-cc [file]",
+		Use:   "ralph-cc [file...]",
 		Short: "ralph-cc is a C compiler frontend for testing compilation passes",
 		Long: `ralph-cc is a C compiler frontend CLI optimized for testing
 compilation passes rather than practical use. It follows the
-CompCert design with the goal of equivalent output on each IR.`,
+CompCert design with the goal of equivalent output on each IR.
+Each file given is compiled independently, to outputs of its own.
+Pass - as the file to read the source from standard input.`,
 		Version:       version,
-		Args:          cobra.MaximumNArgs(1),
+		Args:          cobra.ArbitraryArgs,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -133,65 +214,27 @@ CompCert design with the goal of equivalent output on each IR.`,
 			if err := checkDebugFlags(errOut); err != nil {
 				return err
 			}
+			if err := checkDumpPasses(errOut); err != nil {
+				return err
+			}
+			if err := checkRelocationModel(errOut); err != nil {
+				return err
+			}
 
 			if len(args) == 0 {
 				cmd.Help()
 				return nil
 			}
-			filename := args[0]
-
-			// Handle -E: preprocess only
-			if preprocessOnly {
-				return doPreprocessOnly(filename, out, errOut)
-			}
-
-			// Handle -dpp: debug preprocessor output
-			if dPP {
-				return doPreprocessDebug(filename, out, errOut)
-			}
-
-			// Handle -dparse: parse and dump the AST
-			if dParse {
-				return doParse(filename, out, errOut)
-			}
-
-			// Handle -dclight: transform to Clight and dump
-			if dClight {
-				return doClight(filename, out, errOut)
-			}
-
-			// Handle -dcsharpminor: transform to Csharpminor and dump
-			if dCsharpminor {
-				return doCsharpminor(filename, out, errOut)
-			}
-
-			// Handle -dcminor: transform to Cminor and dump
-			if dCminor {
-				return doCminor(filename, out, errOut)
-			}
-
-			// Handle -drtl: transform to RTL and dump
-			if dRTL {
-				return doRTL(filename, out, errOut)
-			}
-
-			// Handle -dltl: transform to LTL and dump
-			if dLTL {
-				return doLTL(filename, out, errOut)
-			}
-
-			// Handle -dmach: transform to Mach and dump
-			if dMach {
-				return doMach(filename, out, errOut)
-			}
-
-			// Handle -dasm: transform to Assembly and dump
-			if dAsm {
-				return doAsm(filename, out, errOut)
+			stdin = cmd.InOrStdin()
+
+			// Each file is compiled on its own, to its own outputs
+			var failed error
+			for _, filename := range args {
+				if err := compileFile(filename, out, errOut); err != nil && failed == nil {
+					failed = err
+				}
 			}
-
-			fmt.Fprintf(errOut, "ralph-cc: compiling %s\n", filename)
-			return nil
+			return failed
 		},
 	}
 	rootCmd.SetOut(out)
@@ -202,32 +245,152 @@ CompCert design with the goal of equivalent output on each IR.`,
 	rootCmd.Flags().BoolVarP(&dC, "dc", "", false, "Dump CompCert C")
 	rootCmd.Flags().BoolVarP(&dAsm, "dasm", "", false, "Dump assembly")
 	rootCmd.Flags().BoolVarP(&dClight, "dclight", "", false, "Dump Clight")
+	rootCmd.Flags().BoolVarP(&dTypes, "dtypes", "", false, "Dump the resolved type of each variable and the struct layouts")
 	rootCmd.Flags().BoolVarP(&dCsharpminor, "dcsharpminor", "", false, "Dump Csharpminor")
 	rootCmd.Flags().BoolVarP(&dCminor, "dcminor", "", false, "Dump Cminor")
 	rootCmd.Flags().BoolVarP(&dRTL, "drtl", "", false, "Dump RTL")
 	rootCmd.Flags().BoolVarP(&dLTL, "dltl", "", false, "Dump LTL")
+	rootCmd.Flags().BoolVarP(&dLinear, "dlinear", "", false, "Dump Linear")
 	rootCmd.Flags().BoolVarP(&dMach, "dmach", "", false, "Dump Mach")
 	rootCmd.Flags().BoolVarP(&dPP, "dpp", "", false, "Debug preprocessor operation")
+	rootCmd.Flags().StringVar(&dumpAfter, "dump-after", "", "Stop after the named pass and dump its output ("+strings.Join(dumpPasses, ", ")+")")
+	rootCmd.Flags().StringVar(&dumpBefore, "dump-before", "", "Stop before the named pass and dump its input")
 
 	// Add preprocessor flags
 	rootCmd.Flags().StringArrayVarP(&includePaths, "include", "I", nil, "Add directory to include search path")
 	rootCmd.Flags().StringArrayVar(&systemPaths, "isystem", nil, "Add directory to system include search path")
+	rootCmd.Flags().StringArrayVar(&forceIncludes, "include-file", nil, "Process file as if #included at the start of the input (-include)")
 	rootCmd.Flags().StringArrayVarP(&defineFlags, "define", "D", nil, "Define macro (NAME or NAME=VALUE)")
 	rootCmd.Flags().StringArrayVarP(&undefineFlags, "undefine", "U", nil, "Undefine macro")
 	rootCmd.Flags().BoolVarP(&preprocessOnly, "preprocess", "E", false, "Preprocess only, output to stdout")
 	rootCmd.Flags().BoolVar(&useExternalPP, "external-cpp", false, "Use external C preprocessor instead of internal")
 
+	// Add optimization flags
+	rootCmd.Flags().BoolVar(&optO1, "O1", false, "Enable whole-program cleanups (removal of unused static functions)")
+	rootCmd.Flags().BoolVar(&optO2, "O2", false, "Enable optimizations (constant folding, division by constants, loop-invariant code motion, instruction scheduling)")
+	rootCmd.Flags().BoolVar(&optReport, "opt-report", false, "Compile to assembly and print what the optimizations did to each function")
+
+	// Add code generation flags
+	rootCmd.Flags().BoolVar(&fSignedChar, "fsigned-char", false, "Make plain char signed")
+	rootCmd.Flags().BoolVar(&fUnsignedChar, "funsigned-char", false, "Make plain char unsigned (default)")
+	rootCmd.Flags().BoolVar(&annotate, "annotate", false, "Annotate the assembly with the source line of each statement")
+	rootCmd.Flags().BoolVar(&freestanding, "freestanding-main", false, "Emit a _start entry point that calls main and exits with its result, for linking without crt startup files")
+	rootCmd.Flags().StringVar(&relocModel, "relocation-model", "pic", "Address symbols PC-relative (pic), or by their absolute address for executables linked with -no-pie (static)")
+	rootCmd.Flags().BoolVar(&noPIE, "no-pie", false, "Address symbols by their absolute address, as --relocation-model=static")
+	rootCmd.Flags().BoolVar(&saveTemps, "save-temps", false, "Compile to assembly, also keeping the output of every pass (.i, .parsed.c, .light.c, ... .mach)")
+
+	// Add visualization flags
+	rootCmd.Flags().BoolVar(&dumpCFG, "dump-cfg", false, "Write the control-flow graph of each RTL function to a Graphviz .dot file")
+	rootCmd.Flags().IntVar(&tempBase, "temp-base", 0, "Number the temporaries of each function in Clight dumps from N, in order of first use, for comparison with CompCert's (e.g. 128)")
+
+	// Add diagnostic flags
+	rootCmd.Flags().BoolVar(&werror, "werror", false, "Treat warnings as errors")
+	rootCmd.Flags().BoolVar(&noWarnings, "no-warnings", false, "Suppress warnings")
+	rootCmd.Flags().IntVar(&maxErrors, "max-errors", 20, "Stop after this many errors (0 for no limit)")
+	rootCmd.Flags().BoolVar(&pedantic, "pedantic", false, "Warn about GNU extensions (statement expressions, typeof, __attribute__, __asm labels)")
+
 	return rootCmd
 }
 
-// buildPreprocessorOptions creates preproc.Options from CLI flags
-func buildPreprocessorOptions() *preproc.Options {
+// compileFile runs the passes the flags select on a single source file.
+// With --opt-report, the report of a successful compile follows.
+func compileFile(filename string, out, errOut io.Writer) (err error) {
+	if optReport {
+		report = optreport.New()
+		defer func() {
+			if err == nil {
+				report.Print(errOut, filename)
+			}
+			report = nil
+		}()
+	}
+
+	// Handle -E: preprocess only
+	if preprocessOnly {
+		return doPreprocessOnly(filename, out, errOut)
+	}
+
+	// Handle -dpp: debug preprocessor output
+	if dPP {
+		return doPreprocessDebug(filename, out, errOut)
+	}
+
+	// Handle --dump-after and --dump-before: run the passes up to the one
+	// named and dump the program there
+	if dumpAfter != "" || dumpBefore != "" {
+		return doAsm(filename, out, errOut)
+	}
+
+	// Handle -dparse: parse and dump the AST
+	if dParse {
+		return doParse(filename, out, errOut)
+	}
+
+	// Handle -dclight: transform to Clight and dump
+	if dClight {
+		return doClight(filename, out, errOut)
+	}
+
+	// Handle -dtypes: transform to Clight and dump the type table
+	if dTypes {
+		return doTypes(filename, out, errOut)
+	}
+
+	// Handle -dcsharpminor: transform to Csharpminor and dump
+	if dCsharpminor {
+		return doCsharpminor(filename, out, errOut)
+	}
+
+	// Handle -dcminor: transform to Cminor and dump
+	if dCminor {
+		return doCminor(filename, out, errOut)
+	}
+
+	// Handle -drtl: transform to RTL and dump
+	if dRTL {
+		return doRTL(filename, out, errOut)
+	}
+
+	// Handle --dump-cfg: write the RTL control-flow graphs
+	if dumpCFG {
+		return doDumpCFG(filename, out, errOut)
+	}
+
+	// Handle -dltl: transform to LTL and dump
+	if dLTL {
+		return doLTL(filename, out, errOut)
+	}
+
+	// Handle -dlinear: transform to Linear and dump
+	if dLinear {
+		return doLinear(filename, out, errOut)
+	}
+
+	// Handle -dmach: transform to Mach and dump
+	if dMach {
+		return doMach(filename, out, errOut)
+	}
+
+	// Otherwise, as with -dasm, compile to assembly in a .s file, with
+	// --save-temps keeping the output of each pass on the way and
+	// --opt-report counting what the optimizations do
+	return doAsm(filename, out, errOut)
+}
+
+// buildPreprocessorOptions creates preproc.Options from CLI flags.
+// #warning diagnostics go to diags.
+func buildPreprocessorOptions(diags *diag.Emitter) *preproc.Options {
 	opts := &preproc.Options{
-		IncludePaths: includePaths,
-		SystemPaths:  systemPaths,
-		Defines:      make(map[string]string),
-		Undefines:    undefineFlags,
-		UseExternal:  useExternalPP,
+		IncludePaths:  includePaths,
+		SystemPaths:   systemPaths,
+		ForceIncludes: forceIncludes,
+		Defines:       make(map[string]string),
+		Undefines:     undefineFlags,
+		UseExternal:   useExternalPP,
+		// Line markers keep the positions of diagnostics in the original
+		// files across includes
+		LineMarkers: true,
+		Diags:       diags,
 	}
 
 	// Parse -D flags (NAME or NAME=VALUE)
@@ -247,13 +410,7 @@ func buildPreprocessorOptions() *preproc.Options {
 // Files with .i or .p extensions are assumed already preprocessed.
 func readAndPreprocess(filename string, errOut io.Writer) (string, error) {
 	if preproc.NeedsPreprocessing(filename) {
-		opts := buildPreprocessorOptions()
-		content, err := preproc.Preprocess(filename, opts)
-		if err != nil {
-			fmt.Fprintf(errOut, "ralph-cc: preprocessing error: %v\n", err)
-			return "", err
-		}
-		return content, nil
+		return preprocess(filename, errOut)
 	}
 
 	// File doesn't need preprocessing, read directly
@@ -265,14 +422,51 @@ func readAndPreprocess(filename string, errOut io.Writer) (string, error) {
 	return string(content), nil
 }
 
+// preprocess runs the preprocessor on a file, reporting its errors and
+// #warning diagnostics to errOut. A #warning made an error by --werror
+// fails the preprocessing.
+func preprocess(filename string, errOut io.Writer) (string, error) {
+	diags := newEmitter()
+	content, err := runPreprocessor(filename, buildPreprocessorOptions(diags))
+	failed := reportDiagnostics(diags, filename, errOut)
+	if err != nil {
+		fmt.Fprintf(errOut, "ralph-cc: preprocessing error: %v\n", err)
+		return "", err
+	}
+	if failed {
+		return "", fmt.Errorf("preprocessing failed with %d errors", len(diags.Errors()))
+	}
+	return content, nil
+}
+
+// runPreprocessor runs the preprocessor on a file, or on standard input
+// when filename is "-". Quoted includes in standard input are searched for
+// in the current directory, as cpp does.
+func runPreprocessor(filename string, opts *preproc.Options) (string, error) {
+	if filename != stdinFilename {
+		return preproc.Preprocess(filename, opts)
+	}
+	source, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("error reading standard input: %v", err)
+	}
+	opts.IncludePaths = append([]string{"."}, opts.IncludePaths...)
+	return preproc.PreprocessString(string(source), stdinBasename, opts)
+}
+
+// outputBasename returns the name that output filenames are derived from
+func outputBasename(filename string) string {
+	if filename == stdinFilename {
+		return stdinBasename
+	}
+	return filename
+}
+
 // doPreprocessOnly preprocesses and outputs to stdout (-E flag)
 func doPreprocessOnly(filename string, out, errOut io.Writer) error {
-	opts := buildPreprocessorOptions()
-	opts.LineMarkers = true // Include line markers like traditional cpp
-
-	content, err := preproc.Preprocess(filename, opts)
+	// Line markers are included like traditional cpp
+	content, err := preprocess(filename, errOut)
 	if err != nil {
-		fmt.Fprintf(errOut, "ralph-cc: preprocessing error: %v\n", err)
 		return err
 	}
 
@@ -282,12 +476,8 @@ func doPreprocessOnly(filename string, out, errOut io.Writer) error {
 
 // doPreprocessDebug preprocesses with debug info and outputs to .i file (-dpp flag)
 func doPreprocessDebug(filename string, out, errOut io.Writer) error {
-	opts := buildPreprocessorOptions()
-	opts.LineMarkers = true
-
-	content, err := preproc.Preprocess(filename, opts)
+	content, err := preprocess(filename, errOut)
 	if err != nil {
-		fmt.Fprintf(errOut, "ralph-cc: preprocessing error: %v\n", err)
 		return err
 	}
 
@@ -313,6 +503,7 @@ func doPreprocessDebug(filename string, out, errOut io.Writer) error {
 
 // preprocessedOutputFilename returns the output filename for -dpp
 func preprocessedOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".i"
@@ -326,20 +517,51 @@ func parseFile(filename string, errOut io.Writer) (*cabs.Program, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseSource(content, filename, errOut)
+}
 
+// parseSource parses the preprocessed source of a C file
+func parseSource(content, filename string, errOut io.Writer) (*cabs.Program, error) {
+	diags := newEmitter()
 	l := lexer.New(content)
 	p := parser.New(l)
+	p.SetEmitter(diags)
+	p.SetAnnotate(annotate)
+	p.SetPedantic(pedantic)
 	program := p.ParseProgram()
 
-	if len(p.Errors()) > 0 {
-		for _, e := range p.Errors() {
-			fmt.Fprintf(errOut, "%s: %s\n", filename, e)
-		}
-		return nil, fmt.Errorf("parsing failed with %d errors", len(p.Errors()))
+	if reportDiagnostics(diags, filename, errOut) {
+		return nil, fmt.Errorf("parsing failed with %d errors", len(diags.Errors()))
 	}
 	return program, nil
 }
 
+// newEmitter creates a diagnostic emitter configured from the CLI flags
+func newEmitter() *diag.Emitter {
+	return diag.NewEmitter(diag.Options{WarningsAsErrors: werror, NoWarnings: noWarnings, MaxErrors: maxErrors})
+}
+
+// reportDiagnostics writes the diagnostics collected so far to errOut and
+// reports whether any of them is an error.
+func reportDiagnostics(diags *diag.Emitter, filename string, errOut io.Writer) bool {
+	for _, d := range diags.Diagnostics() {
+		fmt.Fprintln(errOut, d.Format(filename))
+	}
+	return diags.HasErrors()
+}
+
+// translateClight transforms a parsed program to Clight and type-checks
+// it, reporting the type errors and warnings to errOut.
+func translateClight(program *cabs.Program, filename string, errOut io.Writer) (*clight.Program, error) {
+	diags := newEmitter()
+	clightProg := clightgen.TranslateProgramWithOptions(program, clightgen.Options{CharSign: plainCharSign(), Diags: diags})
+	ctyping.Check(clightProg, diags)
+	if reportDiagnostics(diags, filename, errOut) {
+		return nil, fmt.Errorf("type checking failed with %d errors", len(diags.Errors()))
+	}
+	return clightProg, nil
+}
+
 // doParse parses the file and writes the AST to a .parsed.c file (matching CompCert behavior)
 func doParse(filename string, out, errOut io.Writer) error {
 	program, err := parseFile(filename, errOut)
@@ -372,6 +594,7 @@ func doParse(filename string, out, errOut io.Writer) error {
 // parsedOutputFilename returns the output filename for -dparse
 // input.c -> input.parsed.c (matching CompCert convention)
 func parsedOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".parsed.c"
@@ -387,7 +610,10 @@ func doClight(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Compute output filename: input.c -> input.light.c
 	outputFilename := clightOutputFilename(filename)
@@ -401,18 +627,73 @@ func doClight(filename string, out, errOut io.Writer) error {
 	defer outFile.Close()
 
 	// Print the Clight AST to the file
-	printer := clight.NewPrinter(outFile)
-	printer.PrintProgram(clightProg)
+	printClight(outFile, clightProg)
+
+	// Also print to stdout for convenience
+	printClight(out, clightProg)
+
+	return nil
+}
+
+// printClight writes the Clight dump of prog to w. With --temp-base, the
+// temporaries of each function are renumbered in order of first use and
+// printed from that base.
+func printClight(w io.Writer, prog *clight.Program) {
+	printer := clight.NewPrinter(w)
+	if tempBase > 0 {
+		renumbered := *prog
+		renumbered.Functions = make([]clight.Function, len(prog.Functions))
+		for i, fn := range prog.Functions {
+			renumbered.Functions[i] = clight.RenumberTemps(fn)
+		}
+		prog = &renumbered
+		printer.SetTempBase(tempBase)
+	}
+	printer.PrintProgram(prog)
+}
+
+// doTypes transforms the file to Clight and writes its type table to a
+// .types file
+func doTypes(filename string, out, errOut io.Writer) error {
+	program, err := parseFile(filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	outputFilename := typesOutputFilename(filename)
+	outFile, err := os.Create(outputFilename)
+	if err != nil {
+		fmt.Fprintf(errOut, "ralph-cc: error creating %s: %v\n", outputFilename, err)
+		return err
+	}
+	defer outFile.Close()
+
+	cshmgen.PrintTypes(outFile, clightProg)
 
 	// Also print to stdout for convenience
-	printer = clight.NewPrinter(out)
-	printer.PrintProgram(clightProg)
+	cshmgen.PrintTypes(out, clightProg)
 
 	return nil
 }
 
+// typesOutputFilename returns the output filename for -dtypes
+func typesOutputFilename(filename string) string {
+	filename = outputBasename(filename)
+	ext := ".c"
+	if strings.HasSuffix(filename, ext) {
+		return filename[:len(filename)-len(ext)] + ".types"
+	}
+	return filename + ".types"
+}
+
 // clightOutputFilename returns the output filename for -dclight
 func clightOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".light.c"
@@ -428,7 +709,10 @@ func doCsharpminor(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Transform to Csharpminor
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
@@ -457,6 +741,7 @@ func doCsharpminor(filename string, out, errOut io.Writer) error {
 
 // csharpminorOutputFilename returns the output filename for -dcsharpminor
 func csharpminorOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".csharpminor"
@@ -472,7 +757,10 @@ func doCminor(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Transform to Csharpminor
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
@@ -504,6 +792,7 @@ func doCminor(filename string, out, errOut io.Writer) error {
 
 // cminorOutputFilename returns the output filename for -dcminor
 func cminorOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".cminor"
@@ -519,7 +808,10 @@ func doRTL(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Transform to Csharpminor
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
@@ -528,11 +820,12 @@ func doRTL(filename string, out, errOut io.Writer) error {
 	cminorProg := cminorgen.TransformProgram(csharpminorProg)
 
 	// Transform to CminorSel
-	selCtx := selection.NewSelectionContext(nil, nil)
+	selCtx := newSelectionContext()
 	cminorselProg := selCtx.SelectProgram(*cminorProg)
 
 	// Transform to RTL
 	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	rtlProg = optimizeRTL(rtlProg)
 
 	// Compute output filename: input.c -> input.rtl.0
 	outputFilename := rtlOutputFilename(filename)
@@ -558,6 +851,7 @@ func doRTL(filename string, out, errOut io.Writer) error {
 
 // rtlOutputFilename returns the output filename for -drtl
 func rtlOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".rtl.0"
@@ -565,6 +859,113 @@ func rtlOutputFilename(filename string) string {
 	return filename + ".rtl.0"
 }
 
+// newSelectionContext creates the instruction selection context, enabling
+// the selection rewrites under -O2
+func newSelectionContext() *selection.SelectionContext {
+	ctx := selection.NewSelectionContext(nil, nil)
+	ctx.Optimize = optO2
+	ctx.Report = report
+	return ctx
+}
+
+// doDumpCFG transforms the file to RTL and writes the control-flow graph
+// of each function to its own .dot file
+func doDumpCFG(filename string, out, errOut io.Writer) error {
+	program, err := parseFile(filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	// Transform to Clight
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	// Transform to Csharpminor
+	csharpminorProg := cshmgen.TranslateProgram(clightProg)
+
+	// Transform to Cminor
+	cminorProg := cminorgen.TransformProgram(csharpminorProg)
+
+	// Transform to CminorSel
+	selCtx := newSelectionContext()
+	cminorselProg := selCtx.SelectProgram(*cminorProg)
+
+	// Transform to RTL
+	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	rtlProg = optimizeRTL(rtlProg)
+
+	for i := range rtlProg.Functions {
+		fn := &rtlProg.Functions[i]
+		outputFilename := dotOutputFilename(filename, fn.Name)
+		outFile, err := os.Create(outputFilename)
+		if err != nil {
+			fmt.Fprintf(errOut, "ralph-cc: error creating %s: %v\n", outputFilename, err)
+			return err
+		}
+		rtl.PrintDot(outFile, fn)
+		outFile.Close()
+		fmt.Fprintf(out, "%s\n", outputFilename)
+	}
+
+	return nil
+}
+
+// dotOutputFilename returns the output filename of a function's CFG for
+// --dump-cfg: input.c -> input.main.dot
+func dotOutputFilename(filename, function string) string {
+	filename = outputBasename(filename)
+	return strings.TrimSuffix(filename, ".c") + "." + function + ".dot"
+}
+
+// optPass is an optimization pass over programs of type P, named as
+// --dump-after and --dump-before give it. It counts its changes in the
+// report it is given.
+type optPass[P any] struct {
+	name string
+	run  func(P, *optreport.Report) P
+}
+
+// rtlPasses returns the RTL optimization passes enabled on the command
+// line, in order. -O2 includes the passes of -O1.
+func rtlPasses() []optPass[*rtl.Program] {
+	var passes []optPass[*rtl.Program]
+	if optO1 || optO2 {
+		passes = append(passes, optPass[*rtl.Program]{"deadfunc", deadfunc.TransformProgram})
+	}
+	if optO2 {
+		passes = append(passes, optPass[*rtl.Program]{"licm", licm.TransformProgram})
+	}
+	return passes
+}
+
+// linearPasses returns the Linear optimization passes enabled on the
+// command line, in order
+func linearPasses() []optPass[*linear.Program] {
+	var passes []optPass[*linear.Program]
+	if optO2 {
+		passes = append(passes, optPass[*linear.Program]{"scheduling", scheduling.TransformProgram})
+	}
+	return passes
+}
+
+// optimizeRTL runs the RTL optimization passes enabled on the command line
+func optimizeRTL(prog *rtl.Program) *rtl.Program {
+	for _, pass := range rtlPasses() {
+		prog = pass.run(prog, report)
+	}
+	return prog
+}
+
+// optimizeLinear runs the Linear optimization passes enabled on the command line
+func optimizeLinear(prog *linear.Program) *linear.Program {
+	for _, pass := range linearPasses() {
+		prog = pass.run(prog, report)
+	}
+	return prog
+}
+
 // doLTL transforms the file to LTL and writes output to .ltl file
 func doLTL(filename string, out, errOut io.Writer) error {
 	program, err := parseFile(filename, errOut)
@@ -573,7 +974,10 @@ func doLTL(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Transform to Csharpminor
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
@@ -582,11 +986,12 @@ func doLTL(filename string, out, errOut io.Writer) error {
 	cminorProg := cminorgen.TransformProgram(csharpminorProg)
 
 	// Transform to CminorSel
-	selCtx := selection.NewSelectionContext(nil, nil)
+	selCtx := newSelectionContext()
 	cminorselProg := selCtx.SelectProgram(*cminorProg)
 
 	// Transform to RTL
 	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	rtlProg = optimizeRTL(rtlProg)
 
 	// Transform to LTL
 	ltlProg := regalloc.TransformProgram(rtlProg)
@@ -615,6 +1020,7 @@ func doLTL(filename string, out, errOut io.Writer) error {
 
 // ltlOutputFilename returns the output filename for -dltl
 func ltlOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".ltl"
@@ -622,6 +1028,72 @@ func ltlOutputFilename(filename string) string {
 	return filename + ".ltl"
 }
 
+// doLinear transforms the file to Linear and writes output to .linear file
+func doLinear(filename string, out, errOut io.Writer) error {
+	program, err := parseFile(filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	// Transform to Clight
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	// Transform to Csharpminor
+	csharpminorProg := cshmgen.TranslateProgram(clightProg)
+
+	// Transform to Cminor
+	cminorProg := cminorgen.TransformProgram(csharpminorProg)
+
+	// Transform to CminorSel
+	selCtx := newSelectionContext()
+	cminorselProg := selCtx.SelectProgram(*cminorProg)
+
+	// Transform to RTL
+	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	rtlProg = optimizeRTL(rtlProg)
+
+	// Transform to LTL
+	ltlProg := regalloc.TransformProgram(rtlProg)
+
+	// Transform to Linear
+	linearProg := linearize.TransformProgram(ltlProg)
+	linearProg = optimizeLinear(linearProg)
+
+	// Compute output filename: input.c -> input.linear
+	outputFilename := linearOutputFilename(filename)
+
+	// Create output file
+	outFile, err := os.Create(outputFilename)
+	if err != nil {
+		fmt.Fprintf(errOut, "ralph-cc: error creating %s: %v\n", outputFilename, err)
+		return err
+	}
+	defer outFile.Close()
+
+	// Print the Linear code to the file
+	printer := linear.NewPrinter(outFile)
+	printer.PrintProgram(linearProg)
+
+	// Also print to stdout for convenience
+	printer = linear.NewPrinter(out)
+	printer.PrintProgram(linearProg)
+
+	return nil
+}
+
+// linearOutputFilename returns the output filename for -dlinear
+func linearOutputFilename(filename string) string {
+	filename = outputBasename(filename)
+	ext := ".c"
+	if strings.HasSuffix(filename, ext) {
+		return filename[:len(filename)-len(ext)] + ".linear"
+	}
+	return filename + ".linear"
+}
+
 // doMach transforms the file to Mach and writes output to .mach file
 func doMach(filename string, out, errOut io.Writer) error {
 	program, err := parseFile(filename, errOut)
@@ -630,7 +1102,10 @@ func doMach(filename string, out, errOut io.Writer) error {
 	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
 
 	// Transform to Csharpminor
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
@@ -639,17 +1114,19 @@ func doMach(filename string, out, errOut io.Writer) error {
 	cminorProg := cminorgen.TransformProgram(csharpminorProg)
 
 	// Transform to CminorSel
-	selCtx := selection.NewSelectionContext(nil, nil)
+	selCtx := newSelectionContext()
 	cminorselProg := selCtx.SelectProgram(*cminorProg)
 
 	// Transform to RTL
 	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	rtlProg = optimizeRTL(rtlProg)
 
 	// Transform to LTL
 	ltlProg := regalloc.TransformProgram(rtlProg)
 
 	// Transform to Linear
 	linearProg := linearize.TransformProgram(ltlProg)
+	linearProg = optimizeLinear(linearProg)
 
 	// Transform to Mach
 	machProg := stacking.TransformProgram(linearProg)
@@ -678,6 +1155,7 @@ func doMach(filename string, out, errOut io.Writer) error {
 
 // machOutputFilename returns the output filename for -dmach
 func machOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".mach"
@@ -685,40 +1163,173 @@ func machOutputFilename(filename string) string {
 	return filename + ".mach"
 }
 
-// doAsm transforms the file to Assembly and writes output to .s file
+// doAsm transforms the file to Assembly and writes output to .s file. With
+// --dump-after or --dump-before it stops at the pass named instead, and
+// dumps the program there.
 func doAsm(filename string, out, errOut io.Writer) error {
-	program, err := parseFile(filename, errOut)
+	content, err := readAndPreprocess(filename, errOut)
+	if err != nil {
+		return err
+	}
+	d := &dumper{out: out, last: func(w io.Writer) { fmt.Fprint(w, content) }}
+	if preproc.NeedsPreprocessing(filename) {
+		if err := saveTemp(preprocessedOutputFilename(filename), errOut, func(w io.Writer) {
+			fmt.Fprint(w, content)
+		}); err != nil {
+			return err
+		}
+	}
+	if d.before("parse") {
+		return nil
+	}
+	program, err := parseSource(content, filename, errOut)
 	if err != nil {
 		return err
 	}
+	printParsed := func(w io.Writer) { cabs.NewPrinter(w).PrintProgram(program) }
+	if err := saveTemp(parsedOutputFilename(filename), errOut, printParsed); err != nil {
+		return err
+	}
+	if d.after("parse", printParsed) {
+		return nil
+	}
 
 	// Transform to Clight
-	clightProg := clightgen.TranslateProgram(program)
+	if d.before("clight") {
+		return nil
+	}
+	clightProg, err := translateClight(program, filename, errOut)
+	if err != nil {
+		return err
+	}
+	printClightProg := func(w io.Writer) { printClight(w, clightProg) }
+	if err := saveTemp(clightOutputFilename(filename), errOut, printClightProg); err != nil {
+		return err
+	}
+	if d.after("clight", printClightProg) {
+		return nil
+	}
 
 	// Transform to Csharpminor
+	if d.before("csharpminor") {
+		return nil
+	}
 	csharpminorProg := cshmgen.TranslateProgram(clightProg)
+	printCsharpminor := func(w io.Writer) { csharpminor.NewPrinter(w).PrintProgram(csharpminorProg) }
+	if err := saveTemp(csharpminorOutputFilename(filename), errOut, printCsharpminor); err != nil {
+		return err
+	}
+	if d.after("csharpminor", printCsharpminor) {
+		return nil
+	}
 
 	// Transform to Cminor
+	if d.before("cminor") {
+		return nil
+	}
 	cminorProg := cminorgen.TransformProgram(csharpminorProg)
+	printCminor := func(w io.Writer) { cminor.NewPrinter(w).PrintProgram(cminorProg) }
+	if err := saveTemp(cminorOutputFilename(filename), errOut, printCminor); err != nil {
+		return err
+	}
+	if d.after("cminor", printCminor) {
+		return nil
+	}
 
 	// Transform to CminorSel
-	selCtx := selection.NewSelectionContext(nil, nil)
+	if d.before("cminorsel") {
+		return nil
+	}
+	selCtx := newSelectionContext()
 	cminorselProg := selCtx.SelectProgram(*cminorProg)
+	if d.after("cminorsel", func(w io.Writer) { cminorsel.NewPrinter(w).Print(cminorselProg) }) {
+		return nil
+	}
 
-	// Transform to RTL
+	// Transform to RTL, then optimize it
+	if d.before("rtl") {
+		return nil
+	}
 	rtlProg := rtlgen.TranslateProgram(cminorselProg)
+	printRTL := func(w io.Writer) { rtl.NewPrinter(w).PrintProgram(rtlProg) }
+	if d.after("rtl", printRTL) {
+		return nil
+	}
+	for _, pass := range rtlPasses() {
+		if d.before(pass.name) {
+			return nil
+		}
+		rtlProg = pass.run(rtlProg, report)
+		if d.after(pass.name, printRTL) {
+			return nil
+		}
+	}
+	if err := saveTemp(rtlOutputFilename(filename), errOut, printRTL); err != nil {
+		return err
+	}
 
 	// Transform to LTL
+	if d.before("ltl") {
+		return nil
+	}
 	ltlProg := regalloc.TransformProgram(rtlProg)
+	printLTL := func(w io.Writer) { ltl.NewPrinter(w).PrintProgram(ltlProg) }
+	if err := saveTemp(ltlOutputFilename(filename), errOut, printLTL); err != nil {
+		return err
+	}
+	if d.after("ltl", printLTL) {
+		return nil
+	}
 
-	// Transform to Linear
+	// Transform to Linear, then optimize it
+	if d.before("linear") {
+		return nil
+	}
 	linearProg := linearize.TransformProgram(ltlProg)
+	printLinear := func(w io.Writer) { linear.NewPrinter(w).PrintProgram(linearProg) }
+	if d.after("linear", printLinear) {
+		return nil
+	}
+	for _, pass := range linearPasses() {
+		if d.before(pass.name) {
+			return nil
+		}
+		linearProg = pass.run(linearProg, report)
+		if d.after(pass.name, printLinear) {
+			return nil
+		}
+	}
+	if err := saveTemp(linearOutputFilename(filename), errOut, printLinear); err != nil {
+		return err
+	}
 
 	// Transform to Mach
+	if d.before("mach") {
+		return nil
+	}
 	machProg := stacking.TransformProgram(linearProg)
+	printMach := func(w io.Writer) { mach.NewPrinter(w).PrintProgram(machProg) }
+	if err := saveTemp(machOutputFilename(filename), errOut, printMach); err != nil {
+		return err
+	}
+	if d.after("mach", printMach) {
+		return nil
+	}
 
 	// Transform to Assembly
-	asmProg := asmgen.TransformProgram(machProg)
+	if d.before("asm") {
+		return nil
+	}
+	asmProg := asmgen.TransformProgramWithRelocation(machProg, relocation())
+	if freestanding {
+		addStartStub(asmProg)
+	}
+	if d.after("asm", func(w io.Writer) { asm.NewPrinter(w).PrintProgram(asmProg) }) {
+		return nil
+	}
+	if err := d.missed(errOut); err != nil {
+		return err
+	}
 
 	// Compute output filename: input.c -> input.s
 	outputFilename := asmOutputFilename(filename)
@@ -742,8 +1353,128 @@ func doAsm(filename string, out, errOut io.Writer) error {
 	return nil
 }
 
+// dumpPasses lists the passes --dump-after and --dump-before can name, in
+// the order they run. A translation is named after the IR it produces, an
+// optimization after the pass.
+var dumpPasses = []string{"parse", "clight", "csharpminor", "cminor", "cminorsel", "rtl", "deadfunc", "licm", "ltl", "linear", "scheduling", "mach", "asm"}
+
+// checkDumpPasses checks that --dump-after and --dump-before name passes
+func checkDumpPasses(w io.Writer) error {
+	for _, flag := range []struct{ name, pass string }{{"dump-after", dumpAfter}, {"dump-before", dumpBefore}} {
+		if flag.pass != "" && !slices.Contains(dumpPasses, flag.pass) {
+			fmt.Fprintf(w, "ralph-cc: error: --%s: unknown pass %q (expected one of %s)\n", flag.name, flag.pass, strings.Join(dumpPasses, ", "))
+			return fmt.Errorf("unknown pass %q", flag.pass)
+		}
+	}
+	return nil
+}
+
+// checkRelocationModel checks the value of --relocation-model. Mach-O
+// executables are always position-independent, so static is ELF only.
+func checkRelocationModel(w io.Writer) error {
+	switch relocModel {
+	case "pic":
+	case "static":
+		noPIE = true
+	default:
+		fmt.Fprintf(w, "ralph-cc: error: --relocation-model: unknown model %q (expected pic or static)\n", relocModel)
+		return fmt.Errorf("unknown relocation model %q", relocModel)
+	}
+	if noPIE && asm.HostFormat() == asm.MachO {
+		fmt.Fprintln(w, "ralph-cc: error: the static relocation model is not supported for Mach-O")
+		return errors.New("static relocation model on Mach-O")
+	}
+	return nil
+}
+
+// plainCharSign returns the signedness of plain char the flags select:
+// unsigned on ARM64 unless -fsigned-char is given
+func plainCharSign() ctypes.Signedness {
+	if fSignedChar && !fUnsignedChar {
+		return ctypes.Signed
+	}
+	return ctypes.Unsigned
+}
+
+// relocation returns the relocation model the flags select
+func relocation() asmgen.RelocationModel {
+	if noPIE {
+		return asmgen.Static
+	}
+	return asmgen.PIC
+}
+
+// dumper stops a compile at the pass --dump-after or --dump-before names,
+// dumping the program there to out
+type dumper struct {
+	out  io.Writer
+	last func(w io.Writer) // prints the program the last pass left
+}
+
+// before is called as the pass name starts. It returns true when the
+// compile stops there, having dumped the input of the pass.
+func (d *dumper) before(name string) bool {
+	if name != dumpBefore {
+		return false
+	}
+	d.last(d.out)
+	return true
+}
+
+// after is called as the pass name ends, leaving the program print writes.
+// It returns true when the compile stops there, having dumped it.
+func (d *dumper) after(name string, print func(w io.Writer)) bool {
+	if name == dumpAfter {
+		print(d.out)
+		return true
+	}
+	d.last = print
+	return false
+}
+
+// missed reports a pass named by --dump-after or --dump-before that the
+// compile did not run, an optimization the flags leave off
+func (d *dumper) missed(w io.Writer) error {
+	for _, pass := range []string{dumpAfter, dumpBefore} {
+		if pass != "" {
+			fmt.Fprintf(w, "ralph-cc: error: pass %s is not enabled (see -O1 and -O2)\n", pass)
+			return fmt.Errorf("pass %s is not enabled", pass)
+		}
+	}
+	return nil
+}
+
+// saveTemp writes an intermediate form of the program for --save-temps,
+// print writing it to the file. Without the flag it does nothing.
+func saveTemp(outputFilename string, errOut io.Writer, print func(w io.Writer)) error {
+	if !saveTemps {
+		return nil
+	}
+	outFile, err := os.Create(outputFilename)
+	if err != nil {
+		fmt.Fprintf(errOut, "ralph-cc: error creating %s: %v\n", outputFilename, err)
+		return err
+	}
+	defer outFile.Close()
+	print(outFile)
+	return nil
+}
+
+// addStartStub adds the --freestanding-main entry point to a program that
+// defines main, so that it can be linked with a bare ld and still exit with
+// main's return value.
+func addStartStub(prog *asm.Program) {
+	for _, f := range prog.Functions {
+		if f.Name == "main" {
+			prog.Functions = append(prog.Functions, asm.StartStub(asm.HostFormat()))
+			return
+		}
+	}
+}
+
 // asmOutputFilename returns the output filename for -dasm
 func asmOutputFilename(filename string) string {
+	filename = outputBasename(filename)
 	ext := ".c"
 	if strings.HasSuffix(filename, ext) {
 		return filename[:len(filename)-len(ext)] + ".s"
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -81,16 +82,28 @@ func TestDebugFlagsWarnAndExit(t *testing.T) {
 	}
 }
 
-func TestNoDebugFlagsNoError(t *testing.T) {
+func TestNoDebugFlagsWritesAssembly(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	if err := os.WriteFile(testFile, []byte("int main() { return 0; }"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
 	resetDebugFlags()
 
 	var out, errOut bytes.Buffer
 	cmd := newRootCmd(&out, &errOut)
-	cmd.SetArgs([]string{"test.c"})
-	err := cmd.Execute()
+	cmd.SetArgs([]string{testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error without debug flags, got %v: %s", err, errOut.String())
+	}
 
+	content, err := os.ReadFile(filepath.Join(tmpDir, "test.s"))
 	if err != nil {
-		t.Errorf("expected no error without debug flags, got %v", err)
+		t.Fatalf("expected test.s to be created: %v", err)
+	}
+	if !strings.Contains(string(content), "main:") {
+		t.Errorf("expected main: in %q", content)
 	}
 }
 
@@ -190,6 +203,468 @@ func TestDClightFlag(t *testing.T) {
 	}
 }
 
+func TestTempBaseFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	// The temporary of y is created before those of the calls, but first
+	// used after them
+	content := "int g(int);\nint f(int a) { int x = 5; int y = g(a) + g(x); return x + y; }\n"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	clight := func(args ...string) string {
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(append([]string{"--dclight"}, args...), testFile))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v\nStderr: %s", err, errOut.String())
+		}
+		return out.String()
+	}
+
+	if got := clight(); !strings.Contains(got, "$2 = $3 + $4;") {
+		t.Errorf("expected temporaries in order of creation by default, got %q", got)
+	}
+
+	tests := []struct {
+		base string
+		want []string
+	}{
+		{"1", []string{"$1 = 5;", "$2 = g(a);", "$3 = g($1);", "$4 = $2 + $3;", "return $1 + $4;"}},
+		{"128", []string{"int $128;", "$128 = 5;", "$129 = g(a);", "$130 = g($128);", "$131 = $129 + $130;", "return $128 + $131;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			got := clight("--temp-base", tt.base)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q, got %q", want, got)
+				}
+			}
+			if again := clight("--temp-base", tt.base); again != got {
+				t.Errorf("expected the same numbering every time, got %q then %q", got, again)
+			}
+		})
+	}
+}
+
+func TestDumpAfterFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := "int f(int *a, int n) { int s = 0; for (int i = 0; i < n; i++) s += a[i] * n; return s; }\n"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	compile := func(t *testing.T, args ...string) string {
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(args, testFile))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v\nStderr: %s", err, errOut.String())
+		}
+		return out.String()
+	}
+
+	// Each dump is the one of another way to stop at the same point
+	tests := []struct {
+		name string
+		dump []string
+		same []string
+	}{
+		{"after clight", []string{"--dump-after=clight"}, []string{"--dclight"}},
+		{"before csharpminor", []string{"--dump-before=csharpminor"}, []string{"--dclight"}},
+		{"after cminor", []string{"--dump-after=cminor"}, []string{"--dcminor"}},
+		{"after rtl", []string{"--dump-after=rtl"}, []string{"--drtl"}},
+		{"after licm", []string{"--O2", "--dump-after=licm"}, []string{"--O2", "--drtl"}},
+		{"before licm", []string{"--O2", "--dump-before=licm"}, []string{"--O2", "--dump-after=deadfunc"}},
+		{"before ltl", []string{"--O2", "--dump-before=ltl"}, []string{"--O2", "--drtl"}},
+		{"after scheduling", []string{"--O2", "--dump-after=scheduling"}, []string{"--O2", "--dlinear"}},
+		{"after mach", []string{"--dump-after=mach"}, []string{"--dmach"}},
+		{"after asm", []string{"--dump-after=asm"}, []string{"--dasm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := compile(t, tt.dump...), compile(t, tt.same...)
+			if got == "" || got != want {
+				t.Errorf("expected %v to dump as %v\n--- got ---\n%s\n--- want ---\n%s", tt.dump, tt.same, got, want)
+			}
+		})
+	}
+
+	// Without -O2, RTL goes to LTL as rtlgen leaves it
+	if got, want := compile(t, "--dump-before=ltl"), compile(t, "--dump-after=rtl"); got != want {
+		t.Errorf("expected the input of ltl to be the output of rtl without -O2\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+	if got := compile(t, "--O2", "--dump-before=licm"); got == compile(t, "--O2", "--dump-after=licm") {
+		t.Errorf("expected licm to change the loop, got the same RTL before and after")
+	}
+}
+
+func TestDumpAfterFlagErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	if err := os.WriteFile(testFile, []byte("int f(void) { return 0; }\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--dump-after=constfold"}, `unknown pass "constfold"`},
+		{[]string{"--dump-before=RTL"}, `unknown pass "RTL"`},
+		{[]string{"--dump-after=licm"}, "pass licm is not enabled"},
+		{[]string{"--O1", "--dump-before=scheduling"}, "pass scheduling is not enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			resetDebugFlags()
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs(append(tt.args, testFile))
+			if err := cmd.Execute(); err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(errOut.String(), tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, errOut.String())
+			}
+			if out.Len() != 0 {
+				t.Errorf("expected no dump, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestRelocationModelFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	if err := os.WriteFile(testFile, []byte("int g;\nint f(void) { return g; }\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--relocation-model=large", testFile})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if want := `unknown model "large"`; !strings.Contains(errOut.String(), want) {
+		t.Errorf("expected %q, got %q", want, errOut.String())
+	}
+
+	if runtime.GOOS == "darwin" {
+		t.Skip("the static relocation model is ELF only")
+	}
+	// --no-pie is the same as --relocation-model=static
+	var dumps []string
+	for _, flag := range []string{"--relocation-model=static", "--no-pie"} {
+		resetDebugFlags()
+		out.Reset()
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs([]string{flag, "--dump-after=asm", testFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", flag, err)
+		}
+		dumps = append(dumps, out.String())
+	}
+	if !strings.Contains(dumps[0], ":abs_g3:g") || strings.Contains(dumps[0], "adrp") {
+		t.Errorf("expected an absolute address of g, got\n%s", dumps[0])
+	}
+	if dumps[0] != dumps[1] {
+		t.Errorf("expected --no-pie to compile as --relocation-model=static\n--- got ---\n%s\n--- want ---\n%s", dumps[1], dumps[0])
+	}
+}
+
+func TestOptReportFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := "static int unused(int x) { return x; }\nint f(int x) { return x + (3 + 4 * 2); }\n"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	report := func(t *testing.T, args ...string) string {
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(args, "--opt-report", testFile))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v\nStderr: %s", err, errOut.String())
+		}
+		return errOut.String()
+	}
+
+	got := report(t, "--O2")
+	for _, want := range []string{"opt-report for " + testFile, "f: 2 constants folded", "unused functions removed: unused"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the report to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	// Without optimizations there is nothing to report
+	if got := report(t); !strings.Contains(got, "nothing changed") {
+		t.Errorf("expected an empty report without -O2, got:\n%s", got)
+	}
+}
+
+func TestDTypesFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `struct pair { char c; double d; };
+double f(struct pair *p) {
+	double x = p->d;
+	struct pair q;
+	q = *p;
+	return x + q.d;
+}`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dtypes", testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error for -dtypes, got %v\nStderr: %s", err, errOut.String())
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"struct pair: size 16, align 8",
+		"  d: double, offset 8",
+		"  param p: struct pair *, size 8, align 8",
+		"  local q: struct pair, size 16, align 8",
+		": double, size 8, align 8", // x
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.types")); err != nil {
+		t.Errorf("expected test.types to be written: %v", err)
+	}
+}
+
+func TestDClightNestedInitializers(t *testing.T) {
+	tests := []struct {
+		name   string
+		decl   string
+		braced string
+		flat   string
+		store  string
+	}{
+		{
+			name:   "multi-dimensional array",
+			decl:   "int m[2][3]",
+			braced: "{{1, 2, 3}, {4, 5, 6}}",
+			flat:   "{1, 2, 3, 4, 5, 6}",
+			store:  "*(&*(&m + 1) + 2) = 6;",
+		},
+		{
+			name:   "struct of array",
+			decl:   "struct S { int a[2]; int b; } m",
+			braced: "{{1, 2}, 3}",
+			flat:   "{1, 2, 3}",
+			store:  "m.b = 3;",
+		},
+	}
+
+	dclight := func(t *testing.T, source string) string {
+		testFile := filepath.Join(t.TempDir(), "test.c")
+		if err := os.WriteFile(testFile, []byte(source), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs([]string{"--dclight", testFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v: %s", err, errOut.String())
+		}
+		return out.String()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			braced := dclight(t, "int f(void) { "+tt.decl+" = "+tt.braced+"; return 0; }")
+			flat := dclight(t, "int f(void) { "+tt.decl+" = "+tt.flat+"; return 0; }")
+			if !strings.Contains(braced, tt.store) {
+				t.Errorf("expected output to contain %q, got %q", tt.store, braced)
+			}
+			if braced != flat {
+				t.Errorf("expected braced and flat initializers to match:\n%s\nvs\n%s", braced, flat)
+			}
+		})
+	}
+}
+
+func TestDClightAssignmentValue(t *testing.T) {
+	// An assignment used as a value is stored once, in a temporary that
+	// both its target and the enclosing expression read
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			// b is assigned before a, both from the 5
+			name:   "chained assignment",
+			source: "int f(void) { int a; int b; a = b = 5; return a + b; }",
+			want:   "$3 = 5;\n  $2 = $3;\n  $4 = $3;\n  $1 = $4;\n  return $1 + $2;",
+		},
+		{
+			// c is assigned from the call, then the assigned value compared,
+			// on every iteration
+			name:   "assignment in a loop condition",
+			source: "int next(void);\nint f(void) { int c; int n = 0; while ((c = next()) != 0) n = n + c; return n; }",
+			want:   "loop {\n    $3 = next();\n    $4 = $3;\n    $1 = $4;\n    if ($4 != 0) {",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "test.c")
+			if err := os.WriteFile(testFile, []byte(tt.source), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+			resetDebugFlags()
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs([]string{"--dclight", testFile})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("expected no error, got %v: %s", err, errOut.String())
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("expected output to contain %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestDClightIncrementOrder(t *testing.T) {
+	// The operand of ++ and -- is read once into a temporary: x++ yields
+	// it, and the store of the new value comes before anything sequenced
+	// after the increment reads x
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "comma reads the incremented value",
+			source: "int f(int i) { return (i++, i); }",
+			want:   "$1 = i;\n  i = $1 + 1;\n  return i;",
+		},
+		{
+			name:   "logical and tests the old value, then reads the new",
+			source: "int f(int i) { return i++ && i; }",
+			want:   "$1 = i;\n  i = $1 + 1;\n  if ($1) {\n    if (i) {",
+		},
+		{
+			name:   "conditional branches on the old value",
+			source: "int f(int i) { return i++ ? i : 0; }",
+			want:   "$1 = i;\n  i = $1 + 1;\n  if ($1) {\n    $2 = i;",
+		},
+		{
+			name:   "copy through two post-incremented pointers",
+			source: "void f(char *p, char *q) { *p++ = *q++; }",
+			want:   "$1 = p;\n  p = $1 + 1;\n  $2 = q;\n  q = $2 + 1;\n  $3 = *$2;\n  *$1 = $3;",
+		},
+		{
+			name:   "subscript uses the saved index",
+			source: "int a[4];\nint f(int i) { a[i++] = i; return i; }",
+			want:   "$1 = i;\n  i = $1 + 1;\n  $2 = i;\n  *(&a + $1) = $2;",
+		},
+		{
+			name:   "each increment of a sum has its own temporary",
+			source: "int f(int i) { int x = i++ + i++; return x; }",
+			want:   "$2 = i;\n  i = $2 + 1;\n  $3 = i;\n  i = $3 + 1;\n  $1 = $2 + $3;",
+		},
+		{
+			name:   "pre-increment stores and yields the converted sum",
+			source: "unsigned char f(unsigned char c) { return ++c; }",
+			want:   "$1 = (unsigned char)((int)c + 1);\n  c = $1;\n  return $1;",
+		},
+		{
+			name:   "post-increment of a small integer wraps in its type",
+			source: "int f(void) { signed char c = 127; c++; return c; }",
+			want:   "$2 = $1;\n  $1 = (signed char)((int)$2 + 1);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "test.c")
+			if err := os.WriteFile(testFile, []byte(tt.source), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+			resetDebugFlags()
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs([]string{"--dclight", testFile})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("expected no error, got %v: %s", err, errOut.String())
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("expected output to contain %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestSaveTemps(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `#define N 2
+int main() { return N; }`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	outputs := []string{"test.i", "test.parsed.c", "test.light.c", "test.csharpminor", "test.cminor",
+		"test.rtl.0", "test.ltl", "test.linear", "test.mach", "test.s"}
+
+	for _, tc := range []struct {
+		args  []string
+		temps bool
+	}{
+		{[]string{"--dasm", testFile}, false},
+		{[]string{"--dasm", "--save-temps", testFile}, true},
+		{[]string{"--save-temps", testFile}, true},
+	} {
+		for _, name := range outputs {
+			os.Remove(filepath.Join(tmpDir, name))
+		}
+		resetDebugFlags()
+
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(tc.args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: expected no error, got %v", tc.args, err)
+		}
+
+		for _, name := range outputs {
+			_, err := os.Stat(filepath.Join(tmpDir, name))
+			if written := err == nil; written != (tc.temps || name == "test.s") {
+				t.Errorf("%v: %s written = %v", tc.args, name, written)
+			}
+		}
+	}
+
+	// The saved files are the ones the single-pass dumps write
+	data, err := os.ReadFile(filepath.Join(tmpDir, "test.light.c"))
+	if err != nil {
+		t.Fatalf("failed to read test.light.c: %v", err)
+	}
+	if !strings.Contains(string(data), "return 2;") {
+		t.Errorf("expected the Clight of main in test.light.c, got %q", data)
+	}
+}
+
 func TestDClightCreatesOutputFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.c")
@@ -459,45 +934,102 @@ func TestRTLOutputFilename(t *testing.T) {
 	}
 }
 
-func TestDLTLFlag(t *testing.T) {
-	// Create a temporary test file
+func TestO2HoistsLoopInvariant(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.c")
-	content := `int add(int a, int b) { return a + b; }`
+	content := `int f(int a, int b, int n) {
+  int s = 0;
+  int i;
+  for (i = 0; i < n; i++) {
+    s = s + a * b;
+  }
+  return s;
+}`
 	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 		t.Fatalf("failed to write test file: %v", err)
 	}
 
-	resetDebugFlags()
-
-	var out, errOut bytes.Buffer
-	cmd := newRootCmd(&out, &errOut)
-	cmd.SetArgs([]string{"--dltl", testFile})
-	err := cmd.Execute()
+	for _, tc := range []struct {
+		args     []string
+		wantLoop bool
+	}{
+		{[]string{"--drtl", testFile}, true},
+		{[]string{"--drtl", "--O2", testFile}, false},
+	} {
+		resetDebugFlags()
+
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(tc.args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: expected no error, got %v", tc.args, err)
+		}
 
-	if err != nil {
-		t.Errorf("expected no error for -dltl, got %v", err)
+		succs, mulNode := parseRTLGraph(t, out.String())
+		if mulNode == 0 {
+			t.Fatalf("%v: expected a mul instruction, got %q", tc.args, out.String())
+		}
+		if got := rtlNodeInCycle(succs, mulNode); got != tc.wantLoop {
+			t.Errorf("%v: mul at node %d in loop = %v, want %v\n%s", tc.args, mulNode, got, tc.wantLoop, out.String())
+		}
 	}
+}
 
-	output := out.String()
-	// Check that it contains LTL function output
-	if !strings.Contains(output, "add(") {
-		t.Errorf("expected output to contain 'add(', got %q", output)
-	}
-	// Check for LTL-specific output (entry point)
-	if !strings.Contains(output, "entry:") {
-		t.Errorf("expected output to contain 'entry:', got %q", output)
+// parseRTLGraph extracts the successor edges from --drtl output and
+// returns the node holding the first mul instruction.
+func parseRTLGraph(t *testing.T, output string) (map[int][]int, int) {
+	t.Helper()
+	succs := make(map[int][]int)
+	mulNode := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		colon := strings.Index(line, ": ")
+		if colon < 0 {
+			continue
+		}
+		node, err := strconv.Atoi(line[:colon])
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(line[colon+2:])
+		for i, f := range fields {
+			if f == "goto" && i+1 < len(fields) {
+				if target, err := strconv.Atoi(fields[i+1]); err == nil {
+					succs[node] = append(succs[node], target)
+				}
+			}
+		}
+		if mulNode == 0 && strings.Contains(line, "= mul(") {
+			mulNode = node
+		}
 	}
-	// Check for LTL-specific instructions (Lop, Lbranch, Lreturn)
-	if !strings.Contains(output, "Lop(") && !strings.Contains(output, "Lreturn") {
-		t.Errorf("expected output to contain LTL instructions, got %q", output)
+	return succs, mulNode
+}
+
+// rtlNodeInCycle reports whether node can reach itself in the CFG.
+func rtlNodeInCycle(succs map[int][]int, node int) bool {
+	visited := make(map[int]bool)
+	work := append([]int(nil), succs[node]...)
+	for len(work) > 0 {
+		n := work[len(work)-1]
+		work = work[:len(work)-1]
+		if n == node {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		work = append(work, succs[n]...)
 	}
+	return false
 }
 
-func TestDLTLCreatesOutputFile(t *testing.T) {
+func TestDumpCFG(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.c")
-	content := "int main() { return 0; }"
+	content := `int f(int x) { if (x > 0) return 1; return 2; }
+int main() { return f(3); }`
 	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 		t.Fatalf("failed to write test file: %v", err)
 	}
@@ -506,17 +1038,154 @@ func TestDLTLCreatesOutputFile(t *testing.T) {
 
 	var out, errOut bytes.Buffer
 	cmd := newRootCmd(&out, &errOut)
-	cmd.SetArgs([]string{"--dltl", testFile})
-	err := cmd.Execute()
-
-	if err != nil {
+	cmd.SetArgs([]string{"--dump-cfg", testFile})
+	if err := cmd.Execute(); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Check that the .ltl file was created
-	outputFile := filepath.Join(tmpDir, "test.ltl")
-	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
-		t.Errorf("expected output file %s to be created", outputFile)
+	for _, fn := range []string{"f", "main"} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, "test."+fn+".dot"))
+		if err != nil {
+			t.Fatalf("expected a dot file for %s: %v", fn, err)
+		}
+		if !strings.HasPrefix(string(data), "digraph \""+fn+"\" {") {
+			t.Errorf("expected a digraph for %s, got\n%s", fn, data)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(tmpDir, "test.f.dot"))
+	if !strings.Contains(string(data), `[label="true"]`) || !strings.Contains(string(data), `[label="false"]`) {
+		t.Errorf("expected the branch of f to have true and false edges\n%s", data)
+	}
+}
+
+func TestO2KeepsVolatileReads(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `int f(volatile int *p) {
+  int a = *p;
+  int b = *p;
+  *p;
+  return a + b;
+}`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dasm", "--O2", testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	loads := 0
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "ldr") && strings.Contains(line, "[x") {
+			loads++
+		}
+	}
+	if loads < 3 {
+		t.Errorf("expected three loads through p, got %d\n%s", loads, out.String())
+	}
+}
+
+func TestO1DropsUnusedStaticFunctions(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `static int unused(int x) { return x * 2; }
+static int used(int x) { return x + 1; }
+int main() { return used(41); }`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args       []string
+		wantUnused bool
+	}{
+		{[]string{"--dasm", testFile}, true},
+		{[]string{"--dasm", "--O1", testFile}, false},
+		{[]string{"--dasm", "--O2", testFile}, false},
+	} {
+		resetDebugFlags()
+
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(tc.args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: expected no error, got %v", tc.args, err)
+		}
+
+		asm := out.String()
+		if !strings.Contains(asm, "\nused:") || !strings.Contains(asm, "\nmain:") {
+			t.Errorf("%v: expected used and main in output\n%s", tc.args, asm)
+		}
+		if got := strings.Contains(asm, "\nunused:"); got != tc.wantUnused {
+			t.Errorf("%v: unused in output = %v, want %v\n%s", tc.args, got, tc.wantUnused, asm)
+		}
+	}
+}
+
+func TestDLTLFlag(t *testing.T) {
+	// Create a temporary test file
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `int add(int a, int b) { return a + b; }`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dltl", testFile})
+	err := cmd.Execute()
+
+	if err != nil {
+		t.Errorf("expected no error for -dltl, got %v", err)
+	}
+
+	output := out.String()
+	// Check that it contains LTL function output
+	if !strings.Contains(output, "add(") {
+		t.Errorf("expected output to contain 'add(', got %q", output)
+	}
+	// Check for LTL-specific output (entry point)
+	if !strings.Contains(output, "entry:") {
+		t.Errorf("expected output to contain 'entry:', got %q", output)
+	}
+	// Check for LTL-specific instructions (Lop, Lbranch, Lreturn)
+	if !strings.Contains(output, "Lop(") && !strings.Contains(output, "Lreturn") {
+		t.Errorf("expected output to contain LTL instructions, got %q", output)
+	}
+}
+
+func TestDLTLCreatesOutputFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := "int main() { return 0; }"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dltl", testFile})
+	err := cmd.Execute()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Check that the .ltl file was created
+	outputFile := filepath.Join(tmpDir, "test.ltl")
+	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
+		t.Errorf("expected output file %s to be created", outputFile)
 	}
 }
 
@@ -538,6 +1207,24 @@ func TestLTLOutputFilename(t *testing.T) {
 	}
 }
 
+func TestLinearOutputFilename(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"test.c", "test.linear"},
+		{"path/to/file.c", "path/to/file.linear"},
+		{"noext", "noext.linear"},
+	}
+
+	for _, tt := range tests {
+		got := linearOutputFilename(tt.input)
+		if got != tt.want {
+			t.Errorf("linearOutputFilename(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
 func TestDMachFlag(t *testing.T) {
 	// Create a temporary test file
 	tmpDir := t.TempDir()
@@ -682,6 +1369,144 @@ func TestDAsmCreatesOutputFile(t *testing.T) {
 	}
 }
 
+func TestMultipleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sources := map[string]string{
+		"main.c": "int add(int a, int b);\nint main() { return add(40, 2); }\n",
+		"add.c":  "int add(int a, int b) { return a + b; }\n",
+	}
+	var files []string
+	for name, content := range sources {
+		file := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	// No dump flag: the default compile writes the assembly
+	cmd.SetArgs(files)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v: %s", err, errOut.String())
+	}
+
+	// Each file gets its own assembly, defining only its own functions
+	for asmFile, want := range map[string]string{"main.s": "main:", "add.s": "add:"} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, asmFile))
+		if err != nil {
+			t.Fatalf("expected %s to be created: %v", asmFile, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s: expected %q in %q", asmFile, want, content)
+		}
+	}
+	mainAsm, _ := os.ReadFile(filepath.Join(tmpDir, "main.s"))
+	if strings.Contains(string(mainAsm), "add:") {
+		t.Errorf("main.s should not define add, got %q", mainAsm)
+	}
+}
+
+func TestMultipleFilesReportsEachFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	bad := filepath.Join(tmpDir, "bad.c")
+	good := filepath.Join(tmpDir, "good.c")
+	if err := os.WriteFile(bad, []byte("int f( {"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(good, []byte("int g() { return 1; }"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dasm", bad, good})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for bad.c")
+	}
+	// The failure of one file does not stop the others being compiled
+	if _, err := os.Stat(filepath.Join(tmpDir, "good.s")); err != nil {
+		t.Errorf("expected good.s to be created: %v", err)
+	}
+}
+
+func TestAnnotateFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := "int f(int a) {\n  int b = a + 1;\n  if (b > 2)\n    b = b * 3;\n  return b;\n}\n"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	run := func(args ...string) string {
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(args, testFile))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return out.String()
+	}
+
+	output := run("--annotate", "--dasm")
+	for _, want := range []string{
+		"// line 2: int b = a + 1;",
+		"// line 3: if (b > 2)",
+		"// line 4: b = b * 3;",
+		"// line 5: return b;",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got %q", want, output)
+		}
+	}
+	// Each annotation precedes the code of its statement
+	if strings.Index(output, "// line 2:") > strings.Index(output, "// line 5:") {
+		t.Errorf("expected annotations in source order, got %q", output)
+	}
+
+	if output := run("--dasm"); strings.Contains(output, "// line") {
+		t.Errorf("expected no annotations without --annotate, got %q", output)
+	}
+}
+
+func TestFreestandingMainFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	run := func(content string, args ...string) string {
+		testFile := filepath.Join(tmpDir, "test.c")
+		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(args, testFile))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return out.String()
+	}
+	start := "_start:"
+	if runtime.GOOS == "darwin" {
+		start = "__start:"
+	}
+
+	if output := run("int main() { return 42; }", "--freestanding-main", "--dasm"); !strings.Contains(output, start) {
+		t.Errorf("expected an entry point with --freestanding-main, got %q", output)
+	}
+	if output := run("int main() { return 42; }", "--dasm"); strings.Contains(output, start) {
+		t.Errorf("expected no entry point without --freestanding-main, got %q", output)
+	}
+	if output := run("int f() { return 42; }", "--freestanding-main", "--dasm"); strings.Contains(output, start) {
+		t.Errorf("expected no entry point without a main, got %q", output)
+	}
+}
+
 func TestAsmOutputFilename(t *testing.T) {
 	tests := []struct {
 		input string
@@ -700,6 +1525,346 @@ func TestAsmOutputFilename(t *testing.T) {
 	}
 }
 
+func TestDAsmCharLoadSignedness(t *testing.T) {
+	tests := []struct {
+		name     string
+		elemType string
+		args     []string
+		wantLoad string
+	}{
+		{"plain char defaults to unsigned", "char", nil, "ldrb"},
+		{"unsigned char", "unsigned char", nil, "ldrb"},
+		{"signed char", "signed char", nil, "ldrsb"},
+		{"plain char with -fsigned-char", "char", []string{"--fsigned-char"}, "ldrsb"},
+		{"unsigned char with -fsigned-char", "unsigned char", []string{"--fsigned-char"}, "ldrb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "test.c")
+			content := "int f(" + tt.elemType + " *p) { return *p; }"
+			if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			resetDebugFlags()
+
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs(append(append([]string{"--dasm"}, tt.args...), testFile))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			output := out.String()
+			if !strings.Contains(output, tt.wantLoad+"\t") {
+				t.Errorf("expected %s load, got %q", tt.wantLoad, output)
+			}
+		})
+	}
+}
+
+func TestDAsmFloatCompare(t *testing.T) {
+	// A comparison with a NaN operand is false, but for !=, so the
+	// condition codes must fail when the fcmp is unordered and a negated
+	// one hold: a < b tests MI, not LT, which holds for unordered operands.
+	// The operands arrive in X0 and X1 and are compared in float registers.
+	tests := []struct {
+		name    string
+		content string
+		fcmp    string
+		want    string
+		wantNot string
+	}{
+		{"less than branches on mi", "int f(double a, double b) { if (a < b) return 1; return 0; }", "fcmp\td2, d3\n", "b.mi\t", "b.lt\t"},
+		{"less or equal sets on ls", "int f(double a, double b) { return a <= b; }", "fcmp\td2, d3\n", ", ls\n", ", le\n"},
+		{"float less than sets on mi", "int f(float a, float b) { return a < b; }", "fcmp\ts2, s3\n", ", mi\n", ", lt\n"},
+		{"not greater or equal branches on lt", "int f(double a, double b) { if (!(a >= b)) return 1; return 0; }", "fcmp\td2, d3\n", "b.lt\t", "b.ge\t"},
+		{"not less than branches on pl", "int f(double a, double b) { if (!(a < b)) return 1; return 0; }", "fcmp\td2, d3\n", "b.pl\t", "b.ge\t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "test.c")
+			if err := os.WriteFile(testFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			resetDebugFlags()
+
+			var out, errOut bytes.Buffer
+			cmd := newRootCmd(&out, &errOut)
+			cmd.SetArgs([]string{"--dasm", testFile})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			output := out.String()
+			if !strings.Contains(output, "fmov\td0, x0\n\tfmov\td1, x1\n") {
+				t.Errorf("expected the operands moved to float registers, got %q", output)
+			}
+			if !strings.Contains(output, tt.fcmp) {
+				t.Errorf("expected %q, got %q", tt.fcmp, output)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, output)
+			}
+			if strings.Contains(output, tt.wantNot) {
+				t.Errorf("expected no %q, got %q", tt.wantNot, output)
+			}
+		})
+	}
+}
+
+func TestDAsmBuiltinExpect(t *testing.T) {
+	// __builtin_expect only hints at the likely value, so the code is the
+	// same as without it
+	tests := []struct {
+		name, hinted, plain string
+	}{
+		{
+			"if unlikely",
+			"int f(int x) { if (__builtin_expect(x, 0)) return 1; return 2; }",
+			"int f(int x) { if (x) return 1; return 2; }",
+		},
+		{
+			"likely macro",
+			"#define likely(e) __builtin_expect(!!(e), 1)\nint f(int *p) { while (likely(p != 0)) p++; return 0; }",
+			"int f(int *p) { while (!!(p != 0)) p++; return 0; }",
+		},
+		{
+			"value",
+			"long f(long y) { return __builtin_expect(y + 1, 1); }",
+			"long f(long y) { return y + 1; }",
+		},
+	}
+
+	dasm := func(t *testing.T, content string) string {
+		testFile := filepath.Join(t.TempDir(), "test.c")
+		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs([]string{"--dasm", testFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v\nStderr: %s", err, errOut.String())
+		}
+		return out.String()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hinted, plain := dasm(t, tt.hinted), dasm(t, tt.plain)
+			if strings.Contains(hinted, "__builtin_expect") {
+				t.Errorf("expected no call to __builtin_expect, got %q", hinted)
+			}
+			if hinted != plain {
+				t.Errorf("expected the same code as without the hint\n--- hinted ---\n%s\n--- plain ---\n%s", hinted, plain)
+			}
+		})
+	}
+}
+
+func TestDAsmStructReturnByValue(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `struct Point { int x; int y; };
+struct Point mk(int a, int b) { struct Point p; p.x = a; p.y = b; return p; }
+int sum(struct Point p) { return p.x + p.y; }
+int main(void) { struct Point q = mk(3, 4); return sum(q); }
+`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dasm", testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	output := out.String()
+
+	body := func(name string) string {
+		start := strings.Index(output, "\n"+name+":\n")
+		if start < 0 {
+			t.Fatalf("function %s not found in %q", name, output)
+		}
+		end := strings.Index(output[start:], ".size\t"+name)
+		if end < 0 {
+			t.Fatalf("end of function %s not found", name)
+		}
+		return output[start : start+end]
+	}
+
+	// The 8-byte struct comes back in X0 as one 64-bit word
+	if mk := body("mk"); !strings.Contains(mk, "ldr\tx") {
+		t.Errorf("expected mk to load the struct as a 64-bit word, got %q", mk)
+	}
+	// The caller spills X0 into the struct's storage after the call
+	main := body("main")
+	call := strings.Index(main, "bl\tmk")
+	if call < 0 {
+		t.Fatalf("expected call to mk, got %q", main)
+	}
+	if !strings.Contains(main[call:], "str\tx") {
+		t.Errorf("expected 64-bit store of the returned struct, got %q", main[call:])
+	}
+	// The struct argument arrives in X0 and is stored to the callee's frame
+	if sum := body("sum"); !strings.Contains(sum, "str\tx") {
+		t.Errorf("expected sum to store its struct argument word, got %q", sum)
+	}
+}
+
+func TestEmptyTranslationUnit(t *testing.T) {
+	// A file that preprocesses to nothing is a valid, empty program
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty file", ""},
+		{"whitespace only", "\n\t  \n\n"},
+		{"comments only", "/* a block\n   comment */\n// a line comment\n"},
+		{"directives only", "#ifndef H\n#define H 1\n#endif\n"},
+		{"excluded by a conditional", "#if 0\nint f(void) { return 1; }\n#endif\n"},
+	}
+
+	for _, tt := range tests {
+		for _, flag := range []string{"--dparse", "--dclight", "--dasm"} {
+			t.Run(tt.name+" "+flag, func(t *testing.T) {
+				tmpDir := t.TempDir()
+				testFile := filepath.Join(tmpDir, "test.c")
+				if err := os.WriteFile(testFile, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("failed to write test file: %v", err)
+				}
+
+				resetDebugFlags()
+
+				var out, errOut bytes.Buffer
+				cmd := newRootCmd(&out, &errOut)
+				cmd.SetArgs([]string{flag, testFile})
+				if err := cmd.Execute(); err != nil {
+					t.Fatalf("expected no error, got %v\nStderr: %s", err, errOut.String())
+				}
+				if errOut.Len() != 0 {
+					t.Errorf("expected no diagnostics, got %q", errOut.String())
+				}
+				// Only the section directive of the assembly is left
+				if got := strings.TrimSpace(out.String()); got != "" && got != ".text" {
+					t.Errorf("expected empty output, got %q", out.String())
+				}
+			})
+		}
+	}
+}
+
+func TestDeclarationsOnlyFile(t *testing.T) {
+	// Header-style content: declarations, but no function definitions
+	content := `#ifndef POINT_H
+#define POINT_H
+struct Point { int x; int y; };
+typedef struct Point Point;
+enum Color { RED, GREEN };
+extern int count;
+int area(Point *p);
+#endif
+`
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "point.c")
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	run := func(flag string) string {
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs([]string{flag, testFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: expected no error, got %v\nStderr: %s", flag, err, errOut.String())
+		}
+		if errOut.Len() != 0 {
+			t.Errorf("%s: expected no diagnostics, got %q", flag, errOut.String())
+		}
+		return out.String()
+	}
+
+	parsed := run("--dparse")
+	for _, want := range []string{"struct Point {", "typedef struct Point Point;", "enum Color {", "extern int count;", "int area("} {
+		if !strings.Contains(parsed, want) {
+			t.Errorf("expected %q in parsed output, got %q", want, parsed)
+		}
+	}
+
+	// Nothing is defined, so the assembly has no symbols
+	asm := run("--dasm")
+	if strings.Contains(asm, ".global") || strings.Contains(asm, ":") {
+		t.Errorf("expected no symbols in the assembly, got %q", asm)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "point.s")); err != nil {
+		t.Errorf("expected point.s to be written: %v", err)
+	}
+}
+
+func TestDAsmStructReturnRegisters(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.c")
+	content := `struct M { int a; int b; int c; };
+struct L { long a; long b; long c; };
+struct M mk(int x) { struct M m; m.a = x; m.b = x; m.c = x; return m; }
+struct L mkl(long x) { struct L l; l.a = x; l.b = x; l.c = x; return l; }
+int main(void) { struct M m = mk(1); struct L l = mkl(2); return m.c + (int)l.c; }
+`
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dasm", testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	output := out.String()
+
+	body := func(name string) string {
+		start := strings.Index(output, "\n"+name+":\n")
+		if start < 0 {
+			t.Fatalf("function %s not found in %q", name, output)
+		}
+		end := strings.Index(output[start:], ".size\t"+name)
+		if end < 0 {
+			t.Fatalf("end of function %s not found", name)
+		}
+		return output[start : start+end]
+	}
+
+	// The 12-byte struct comes back in X0 and X1
+	if mk := body("mk"); !strings.Contains(mk, "mov\tx1, ") {
+		t.Errorf("expected mk to return its second word in x1, got %q", mk)
+	}
+	// The 24-byte struct is stored through the result pointer in X8
+	if mkl := body("mkl"); !strings.Contains(mkl, ", x8\n") {
+		t.Errorf("expected mkl to use the result pointer in x8, got %q", mkl)
+	}
+	main := body("main")
+	call := strings.Index(main, "bl\tmkl")
+	if call < 0 {
+		t.Fatalf("expected call to mkl, got %q", main)
+	}
+	if !strings.Contains(main[:call], "mov\tx8, ") {
+		t.Errorf("expected the result pointer passed in x8, got %q", main[:call])
+	}
+}
+
 func TestDParseFlagFileNotFound(t *testing.T) {
 	resetDebugFlags()
 
@@ -759,6 +1924,34 @@ func TestDParseCreatesOutputFile(t *testing.T) {
 	}
 }
 
+func TestDParseFromStdin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("answer.h", []byte("#define ANSWER 42\n"), 0644); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetIn(bytes.NewBufferString("#include \"answer.h\"\nint main() { return ANSWER; }\n"))
+	cmd.SetArgs([]string{"--dparse", "-"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v (%s)", err, errOut.String())
+	}
+
+	if !strings.Contains(out.String(), "return 42") {
+		t.Errorf("expected parsed stdin source on stdout, got %q", out.String())
+	}
+	fileContent, err := os.ReadFile("stdin.parsed.c")
+	if err != nil {
+		t.Fatalf("expected stdin.parsed.c to be created: %v", err)
+	}
+	if out.String() != string(fileContent) {
+		t.Errorf("output file content doesn't match stdout\nStdout:\n%s\nFile:\n%s", out.String(), string(fileContent))
+	}
+}
+
 func TestParsedOutputFilename(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -769,6 +1962,7 @@ func TestParsedOutputFilename(t *testing.T) {
 		{"/absolute/path.c", "/absolute/path.parsed.c"},
 		{"no_extension", "no_extension.parsed.c"},
 		{"multiple.dots.c", "multiple.dots.parsed.c"},
+		{"-", "stdin.parsed.c"},
 	}
 
 	for _, tc := range tests {
@@ -784,20 +1978,208 @@ func resetDebugFlags() {
 	dC = false
 	dAsm = false
 	dClight = false
+	dTypes = false
 	dCsharpminor = false
 	dCminor = false
 	dRTL = false
 	dLTL = false
+	dLinear = false
 	dMach = false
 	dPP = false
+	dumpAfter = ""
+	dumpBefore = ""
+	optO1 = false
+	optO2 = false
+	fSignedChar = false
+	fUnsignedChar = false
+	annotate = false
+	freestanding = false
+	saveTemps = false
+	relocModel = "pic"
+	noPIE = false
+	dumpCFG = false
+	tempBase = 0
+	werror = false
+	noWarnings = false
+	maxErrors = 0
+	pedantic = false
+	optReport = false
 	preprocessOnly = false
 	useExternalPP = false
 	includePaths = nil
 	systemPaths = nil
+	forceIncludes = nil
 	defineFlags = nil
 	undefineFlags = nil
 }
 
+func TestParseErrorDiagnostic(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "bad.c")
+	if err := os.WriteFile(testFile, []byte("int main() {\n  return 1\n}\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dparse", testFile})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected a parse error")
+	}
+
+	want := testFile + ":3:1: error: expected ;, got }"
+	if !strings.Contains(errOut.String(), want) || !strings.Contains(errOut.String(), "[syntax]") {
+		t.Errorf("expected diagnostic %q, got %q", want, errOut.String())
+	}
+}
+
+func TestParseErrorDiagnosticInHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	header := filepath.Join(tmpDir, "bad.h")
+	testFile := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(header, []byte("int ok;\nint bad = ;\n"), 0644); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	if err := os.WriteFile(testFile, []byte("#include \"bad.h\"\n\nint main() {\n  return 1 +;\n}\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dparse", testFile})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected a parse error")
+	}
+
+	// The errors point at the header and at the main file, each at its own
+	// line rather than the line of the preprocessed output
+	for _, want := range []string{
+		header + ":2:11: error: expected expression",
+		testFile + ":4:13: error: expected expression",
+	} {
+		if !strings.Contains(errOut.String(), want) {
+			t.Errorf("expected diagnostic %q, got %q", want, errOut.String())
+		}
+	}
+}
+
+func TestIntPointerConversionWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "conv.c")
+	source := "int g(int *p) { return *p; }\nint main() {\n  int i = 5;\n  int *p = i;\n  long a = p;\n  return g(i) + (a != 0);\n}\n"
+	if err := os.WriteFile(testFile, []byte(source), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dclight", testFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected the conversions to be accepted, got %v: %s", err, errOut.String())
+	}
+
+	// The implicit conversions reach ctyping uncast, so each one warns at
+	// the statement it is made in
+	for _, want := range []string{
+		testFile + ":4:8: warning: in function 'main': incompatible integer to pointer conversion assigning to 'int *' from 'int' [int-conversion]",
+		testFile + ":5:8: warning: in function 'main': incompatible pointer to integer conversion assigning to 'long' from 'int *' [int-conversion]",
+		testFile + ":6:3: warning: in function 'main': incompatible integer to pointer conversion passing 'int' to parameter of type 'int *' [int-conversion]",
+	} {
+		if !strings.Contains(errOut.String(), want) {
+			t.Errorf("expected diagnostic %q, got %q", want, errOut.String())
+		}
+	}
+}
+
+func TestJumpErrorPositions(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "jump.c")
+	source := "int main() {\n  int i = 0;\n  if (i)\n    break;\n  switch (i) {\n  case 0:\n    continue;\n  }\n  return 0;\n}\n"
+	if err := os.WriteFile(testFile, []byte(source), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs([]string{"--dclight", testFile})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected the misplaced jumps to be rejected")
+	}
+
+	// Each error points at its break or continue keyword
+	for _, want := range []string{
+		testFile + ":4:5: error: in function 'main': break statement not within loop or switch [jump]",
+		testFile + ":7:5: error: in function 'main': continue statement not within a loop [jump]",
+	} {
+		if !strings.Contains(errOut.String(), want) {
+			t.Errorf("expected diagnostic %q, got %q", want, errOut.String())
+		}
+	}
+}
+
+func TestErrorAndWarningDirectives(t *testing.T) {
+	tmpDir := t.TempDir()
+	run := func(name, source string, args ...string) (string, error) {
+		testFile := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(testFile, []byte(source), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		resetDebugFlags()
+		var out, errOut bytes.Buffer
+		cmd := newRootCmd(&out, &errOut)
+		cmd.SetArgs(append(args, "--dparse", testFile))
+		err := cmd.Execute()
+		return errOut.String(), err
+	}
+
+	// #error stops the compilation with its message
+	errOut, err := run("error.c", "#ifndef CONFIG\n#error foo\n#endif\nint x;\n")
+	if err == nil {
+		t.Fatal("expected #error to fail the compilation")
+	}
+	if !strings.Contains(errOut, "error.c:2: #error foo") {
+		t.Errorf("expected the #error message, got %q", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "error.parsed.c")); err == nil {
+		t.Error("expected no output after #error")
+	}
+
+	// #warning is reported and the compilation goes on
+	errOut, err = run("warning.c", "#warning bar\nint x;\n")
+	if err != nil {
+		t.Fatalf("expected #warning not to fail the compilation, got %v: %s", err, errOut)
+	}
+	if !strings.Contains(errOut, "warning.c:1:2: warning: #warning bar [cpp]") {
+		t.Errorf("expected the #warning message, got %q", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "warning.parsed.c")); err != nil {
+		t.Errorf("expected the file to be compiled after #warning: %v", err)
+	}
+
+	// -w silences it
+	errOut, err = run("warning.c", "#warning bar\nint x;\n", "--no-warnings")
+	if err != nil || strings.Contains(errOut, "bar") {
+		t.Errorf("expected -w to suppress #warning, got %v: %q", err, errOut)
+	}
+
+	// --werror makes it an error that fails the compilation, and
+	// --max-errors limits how many are reported
+	errOut, err = run("werror.c", "#warning one\n#warning two\nint x;\n", "--werror", "--max-errors", "1")
+	if err == nil {
+		t.Fatal("expected --werror to fail the compilation on #warning")
+	}
+	if !strings.Contains(errOut, "werror.c:1:2: error: #warning one [cpp]") || strings.Contains(errOut, "two") {
+		t.Errorf("expected only the first #warning as an error, got %q", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "werror.parsed.c")); err == nil {
+		t.Error("expected no output after a #warning made an error")
+	}
+}
+
 func TestPreprocessOnlyFlag(t *testing.T) {
 	// Create a temporary test file with macro
 	tmpDir := t.TempDir()
@@ -830,6 +2212,32 @@ int main() { return X; }`
 	}
 }
 
+func TestForceIncludeFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	headerFile := filepath.Join(tmpDir, "config.h")
+	if err := os.WriteFile(headerFile, []byte("#define X 42\n"), 0644); err != nil {
+		t.Fatalf("failed to write header file: %v", err)
+	}
+	testFile := filepath.Join(tmpDir, "test.c")
+	if err := os.WriteFile(testFile, []byte("int main() { return X; }"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	resetDebugFlags()
+
+	var out, errOut bytes.Buffer
+	cmd := newRootCmd(&out, &errOut)
+	cmd.SetArgs(normalizeFlags([]string{"-E", "-include", headerFile, testFile}))
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error for -include, got %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "return 42;") {
+		t.Errorf("expected macro from -include header to expand, got %q", output)
+	}
+}
+
 func TestDefineFlagWithPreprocess(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.c")
@@ -982,6 +2390,36 @@ func TestNormalizeFlags(t *testing.T) {
 			input:    []string{"-o", "output.o", "test.c"},
 			expected: []string{"-o", "output.o", "test.c"},
 		},
+		{
+			name:     "single-dash include is force include",
+			input:    []string{"-include", "config.h", "-I", "inc", "test.c"},
+			expected: []string{"--include-file", "config.h", "-I", "inc", "test.c"},
+		},
+		{
+			name:     "single-dash fsigned-char",
+			input:    []string{"-fsigned-char", "test.c"},
+			expected: []string{"--fsigned-char", "test.c"},
+		},
+		{
+			name:     "single-dash save-temps",
+			input:    []string{"-save-temps", "test.c"},
+			expected: []string{"--save-temps", "test.c"},
+		},
+		{
+			name:     "single-dash O1",
+			input:    []string{"-O1", "test.c"},
+			expected: []string{"--O1", "test.c"},
+		},
+		{
+			name:     "single-dash O2",
+			input:    []string{"-O2", "test.c"},
+			expected: []string{"--O2", "test.c"},
+		},
+		{
+			name:     "gcc-style warning flags",
+			input:    []string{"-Werror", "-w", "-pedantic", "test.c"},
+			expected: []string{"--werror", "--no-warnings", "--pedantic", "test.c"},
+		},
 		{
 			name:     "all debug flags",
 			input:    []string{"-dparse", "-dc", "-dasm", "-dclight", "-dcsharpminor", "-dcminor", "-drtl", "-dltl", "-dmach", "-dpp"},
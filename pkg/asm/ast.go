@@ -82,6 +82,12 @@ type ADD struct {
 	Is64       bool // true for X registers, false for W
 }
 
+// ADDshift - Add shifted register (Rd = Rn + (Rm << Shift)), 64-bit
+type ADDshift struct {
+	Rd, Rn, Rm MReg
+	Shift      int
+}
+
 // ADDi - Add immediate
 type ADDi struct {
 	Rd, Rn MReg
@@ -251,9 +257,10 @@ type LDR struct {
 	Is64 bool
 }
 
-// LDRr - Load register (register offset)
+// LDRr - Load register (register offset): [Rn, Rm, lsl #Shift]
 type LDRr struct {
 	Rt, Rn, Rm MReg
+	Shift      int // 0 or log2 of the access size
 	Is64       bool
 }
 
@@ -302,9 +309,10 @@ type STR struct {
 	Is64 bool
 }
 
-// STRr - Store register (register offset)
+// STRr - Store register (register offset): [Rn, Rm, lsl #Shift]
 type STRr struct {
 	Rt, Rn, Rm MReg
+	Shift      int // 0 or log2 of the access size
 	Is64       bool
 }
 
@@ -411,6 +419,11 @@ type BLR struct {
 // RET - Return (branch to LR)
 type RET struct{}
 
+// SVC - Supervisor call (system call)
+type SVC struct {
+	Imm uint16
+}
+
 // --- Conditional Branch ---
 
 // Bcond represents a conditional branch (B.cond)
@@ -580,6 +593,17 @@ type ADDpageoff struct {
 	Offset int64
 }
 
+// MOVsym - Move 16 bits of the absolute address of a symbol plus Offset,
+// bits 16*Group to 16*Group+15: as movz, clearing the rest of Rd, then as
+// movk for the other groups (ELF only)
+type MOVsym struct {
+	Rd     MReg
+	Symbol Label
+	Offset int64
+	Group  int  // 0 to 3
+	Keep   bool // movk rather than movz
+}
+
 // --- Floating Point Operations ---
 
 // FADD - Floating-point add
@@ -728,9 +752,15 @@ type LabelDef struct {
 	Name Label
 }
 
+// Comment is an assembly comment line, such as a source annotation
+type Comment struct {
+	Text string
+}
+
 // --- Marker methods for Instruction interface ---
 
 func (ADD) implInstruction()      {}
+func (ADDshift) implInstruction() {}
 func (ADDi) implInstruction()     {}
 func (SUB) implInstruction()      {}
 func (SUBi) implInstruction()     {}
@@ -780,6 +810,7 @@ func (BL) implInstruction()       {}
 func (BR) implInstruction()       {}
 func (BLR) implInstruction()      {}
 func (RET) implInstruction()      {}
+func (SVC) implInstruction()      {}
 func (Bcond) implInstruction()    {}
 func (CMP) implInstruction()      {}
 func (CMPi) implInstruction()     {}
@@ -798,6 +829,7 @@ func (MOVN) implInstruction()     {}
 func (ADR) implInstruction()        {}
 func (ADRP) implInstruction()       {}
 func (ADDpageoff) implInstruction() {}
+func (MOVsym) implInstruction()     {}
 func (FADD) implInstruction()       {}
 func (FSUB) implInstruction()     {}
 func (FMUL) implInstruction()     {}
@@ -820,14 +852,16 @@ func (SXTW) implInstruction()     {}
 func (UXTB) implInstruction()     {}
 func (UXTH) implInstruction()     {}
 func (LabelDef) implInstruction() {}
+func (Comment) implInstruction()  {}
 
 // --- Function and Program ---
 
 // Function represents an assembly function
 type Function struct {
-	Name string
-	Code []Instruction
-	Size int64 // function size in bytes (computed after assembly)
+	Name   string
+	Code   []Instruction
+	Size   int64 // function size in bytes (computed after assembly)
+	Static bool  // not visible outside the translation unit
 }
 
 // GlobVar represents a global variable
@@ -837,6 +871,7 @@ type GlobVar struct {
 	Init     []byte
 	Align    int
 	ReadOnly bool // true for .rodata section (e.g., string literals)
+	Static   bool // not visible outside the translation unit
 }
 
 // Program represents a complete assembly program
@@ -845,6 +880,29 @@ type Program struct {
 	Functions []Function
 }
 
+// StartName is the name of the entry point StartStub defines.
+const StartName = "_start"
+
+// StartStub returns an entry point for programs linked without the C
+// runtime startup files: it calls main(argc, argv) with the arguments the
+// kernel leaves on the stack and passes main's return value to the exit
+// system call of the given object format's operating system.
+func StartStub(format ObjectFormat) Function {
+	// exit is syscall 93 on Linux, taking its number in X8; Darwin takes
+	// SYS_exit (1) in X16 and traps with svc #0x80
+	sysReg, sysExit, trap := X8, int64(93), uint16(0)
+	if format == MachO {
+		sysReg, sysExit, trap = X16, 1, 0x80
+	}
+	return Function{Name: StartName, Code: []Instruction{
+		LDR{Rt: X0, Rn: SP, Is64: true},
+		ADDi{Rd: X1, Rn: SP, Imm: 8, Is64: true},
+		BL{Target: "main", IsSymbol: true},
+		MOVi{Rd: sysReg, Imm: sysExit, Is64: true},
+		SVC{Imm: trap},
+	}}
+}
+
 // NewFunction creates a new assembly function
 func NewFunction(name string) *Function {
 	return &Function{
@@ -35,6 +35,7 @@ func TestInstructionInterface(t *testing.T) {
 	// Verify all instruction types implement the Instruction interface
 	var _ Instruction = ADD{}
 	var _ Instruction = ADDi{}
+	var _ Instruction = ADDshift{}
 	var _ Instruction = SUB{}
 	var _ Instruction = SUBi{}
 	var _ Instruction = MUL{}
@@ -7,26 +7,52 @@ import (
 	"strings"
 )
 
+// ObjectFormat selects the object file conventions used for section
+// directives, symbol types and symbol names.
+type ObjectFormat int
+
+const (
+	ELF   ObjectFormat = iota // Linux and other ELF targets
+	MachO                     // macOS
+)
+
+// HostFormat returns the object format native to the host operating system
+func HostFormat() ObjectFormat {
+	if runtime.GOOS == "darwin" {
+		return MachO
+	}
+	return ELF
+}
+
 // Printer outputs ARM64 assembly in GNU as syntax
 type Printer struct {
 	w        io.Writer
 	isDarwin bool
 }
 
-// NewPrinter creates a new assembly printer
+// NewPrinter creates a new assembly printer for the host object format
 func NewPrinter(w io.Writer) *Printer {
-	return &Printer{w: w, isDarwin: runtime.GOOS == "darwin"}
+	return NewPrinterForFormat(w, HostFormat())
+}
+
+// NewPrinterForFormat creates a new assembly printer for the given object format
+func NewPrinterForFormat(w io.Writer, format ObjectFormat) *Printer {
+	return &Printer{w: w, isDarwin: format == MachO}
 }
 
 // PrintProgram outputs an entire program
 func (p *Printer) PrintProgram(prog *Program) {
-	// Separate globals into read-only (rodata) and read-write (data)
-	var rodataGlobals, dataGlobals []GlobVar
+	// Separate globals into read-only (rodata), initialized (data)
+	// and zero-initialized (bss)
+	var rodataGlobals, dataGlobals, bssGlobals []GlobVar
 	for _, g := range prog.Globals {
-		if g.ReadOnly {
+		switch {
+		case g.ReadOnly:
 			rodataGlobals = append(rodataGlobals, g)
-		} else {
+		case len(g.Init) > 0:
 			dataGlobals = append(dataGlobals, g)
+		default:
+			bssGlobals = append(bssGlobals, g)
 		}
 	}
 
@@ -43,7 +69,7 @@ func (p *Printer) PrintProgram(prog *Program) {
 		fmt.Fprintf(p.w, "\n")
 	}
 
-	// Output read-write data section (mutable globals)
+	// Output read-write data section (initialized mutable globals)
 	if len(dataGlobals) > 0 {
 		fmt.Fprintf(p.w, "\t.data\n")
 		for _, g := range dataGlobals {
@@ -52,6 +78,17 @@ func (p *Printer) PrintProgram(prog *Program) {
 		fmt.Fprintf(p.w, "\n")
 	}
 
+	// Output zero-initialized globals
+	if len(bssGlobals) > 0 {
+		if !p.isDarwin {
+			fmt.Fprintf(p.w, "\t.bss\n")
+		}
+		for _, g := range bssGlobals {
+			p.printBssGlobal(g)
+		}
+		fmt.Fprintf(p.w, "\n")
+	}
+
 	// Output functions
 	fmt.Fprintf(p.w, "\t.text\n")
 	for _, f := range prog.Functions {
@@ -77,13 +114,32 @@ func (p *Printer) symbolName(name string) string {
 	return name
 }
 
-func (p *Printer) printGlobal(g GlobVar) {
-	name := p.symbolName(g.Name)
-	fmt.Fprintf(p.w, "\t.global\t%s\n", name)
-	if g.Align > 1 {
-		fmt.Fprintf(p.w, "\t.p2align\t%d\n", log2(g.Align))
+// printSymbolHeader outputs the visibility, type and alignment directives
+// followed by the label of a global data object. A static object keeps
+// local binding, so it is not declared .global.
+func (p *Printer) printSymbolHeader(name string, align int, static bool) {
+	if !static {
+		fmt.Fprintf(p.w, "\t.global\t%s\n", name)
+	}
+	if !p.isDarwin {
+		fmt.Fprintf(p.w, "\t.type\t%s, %%object\n", name)
+	}
+	if align > 1 {
+		fmt.Fprintf(p.w, "\t.p2align\t%d\n", log2(align))
 	}
 	fmt.Fprintf(p.w, "%s:\n", name)
+}
+
+// printSymbolSize outputs the .size directive of a global data object (ELF only)
+func (p *Printer) printSymbolSize(name string, size int64) {
+	if !p.isDarwin {
+		fmt.Fprintf(p.w, "\t.size\t%s, %d\n", name, size)
+	}
+}
+
+func (p *Printer) printGlobal(g GlobVar) {
+	name := p.symbolName(g.Name)
+	p.printSymbolHeader(name, g.Align, g.Static)
 	if len(g.Init) > 0 {
 		for _, b := range g.Init {
 			fmt.Fprintf(p.w, "\t.byte\t%d\n", b)
@@ -91,6 +147,29 @@ func (p *Printer) printGlobal(g GlobVar) {
 	} else if g.Size > 0 {
 		fmt.Fprintf(p.w, "\t.zero\t%d\n", g.Size)
 	}
+	p.printSymbolSize(name, g.Size)
+}
+
+// printBssGlobal outputs a zero-initialized global.
+// Mach-O has no .bss directive; zerofill reserves the space directly.
+func (p *Printer) printBssGlobal(g GlobVar) {
+	name := p.symbolName(g.Name)
+	if p.isDarwin {
+		align := g.Align
+		if align < 1 {
+			align = 1
+		}
+		if !g.Static {
+			fmt.Fprintf(p.w, "\t.global\t%s\n", name)
+		}
+		fmt.Fprintf(p.w, "\t.zerofill\t__DATA,__bss,%s,%d,%d\n", name, g.Size, log2(align))
+		return
+	}
+	p.printSymbolHeader(name, g.Align, g.Static)
+	if g.Size > 0 {
+		fmt.Fprintf(p.w, "\t.zero\t%d\n", g.Size)
+	}
+	p.printSymbolSize(name, g.Size)
 }
 
 // printRodataGlobal outputs a read-only global (e.g., string literal)
@@ -98,23 +177,23 @@ func (p *Printer) printGlobal(g GlobVar) {
 func (p *Printer) printRodataGlobal(g GlobVar) {
 	// Local labels start with .L - don't make them global or prefix
 	isLocal := len(g.Name) >= 2 && g.Name[0] == '.' && g.Name[1] == 'L'
-	var name string
 	if isLocal {
-		name = g.Name
+		if g.Align > 1 {
+			fmt.Fprintf(p.w, "\t.p2align\t%d\n", log2(g.Align))
+		}
+		fmt.Fprintf(p.w, "%s:\n", g.Name)
 	} else {
-		name = p.symbolName(g.Name)
-		fmt.Fprintf(p.w, "\t.global\t%s\n", name)
+		p.printSymbolHeader(p.symbolName(g.Name), g.Align, g.Static)
 	}
-	if g.Align > 1 {
-		fmt.Fprintf(p.w, "\t.p2align\t%d\n", log2(g.Align))
-	}
-	fmt.Fprintf(p.w, "%s:\n", name)
 	if len(g.Init) > 0 {
 		// For string data, use .ascii directive (more compact)
 		p.printStringData(g.Init)
 	} else if g.Size > 0 {
 		fmt.Fprintf(p.w, "\t.zero\t%d\n", g.Size)
 	}
+	if !isLocal {
+		p.printSymbolSize(p.symbolName(g.Name), g.Size)
+	}
 }
 
 // printStringData outputs byte data, using .ascii for printable strings
@@ -127,7 +206,9 @@ func (p *Printer) printStringData(data []byte) {
 func (p *Printer) printFunction(f Function) {
 	name := p.symbolName(f.Name)
 	fmt.Fprintf(p.w, "\t.align\t2\n")
-	fmt.Fprintf(p.w, "\t.global\t%s\n", name)
+	if !f.Static {
+		fmt.Fprintf(p.w, "\t.global\t%s\n", name)
+	}
 	if !p.isDarwin {
 		fmt.Fprintf(p.w, "\t.type\t%s, %%function\n", name)
 	}
@@ -182,6 +263,14 @@ func regName(r MReg, is64 bool) string {
 	return regName32(r)
 }
 
+// lslSuffix returns the shift of a register operand, empty for no shift
+func lslSuffix(shift int) string {
+	if shift == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", lsl #%d", shift)
+}
+
 // floatRegName returns the float register name
 func floatRegName(r MReg, isDouble bool) string {
 	idx := r - D0
@@ -191,16 +280,30 @@ func floatRegName(r MReg, isDouble bool) string {
 	return fmt.Sprintf("s%d", idx)
 }
 
+// fmovRegName returns the name of an fmov operand, which may be an
+// integer register when the value moves between the register files
+func fmovRegName(r MReg, isDouble bool) string {
+	if r.IsFloat() {
+		return floatRegName(r, isDouble)
+	}
+	return regName(r, isDouble)
+}
+
 func (p *Printer) printInstruction(inst Instruction) {
 	switch i := inst.(type) {
 	// Labels
 	case LabelDef:
 		fmt.Fprintf(p.w, "%s:\n", i.Name)
 		return
+	case Comment:
+		fmt.Fprintf(p.w, "\t// %s\n", i.Text)
+		return
 
 	// Data processing
 	case ADD:
 		fmt.Fprintf(p.w, "\tadd\t%s, %s, %s\n", regName(i.Rd, i.Is64), regName(i.Rn, i.Is64), regName(i.Rm, i.Is64))
+	case ADDshift:
+		fmt.Fprintf(p.w, "\tadd\t%s, %s, %s%s\n", regName64(i.Rd), regName64(i.Rn), regName64(i.Rm), lslSuffix(i.Shift))
 	case ADDi:
 		fmt.Fprintf(p.w, "\tadd\t%s, %s, #%d\n", regName(i.Rd, i.Is64), regName(i.Rn, i.Is64), i.Imm)
 	case SUB:
@@ -262,7 +365,7 @@ func (p *Printer) printInstruction(inst Instruction) {
 			fmt.Fprintf(p.w, "\tldr\t%s, [%s, #%d]\n", regName(i.Rt, i.Is64), regName64(i.Rn), i.Ofs)
 		}
 	case LDRr:
-		fmt.Fprintf(p.w, "\tldr\t%s, [%s, %s]\n", regName(i.Rt, i.Is64), regName64(i.Rn), regName64(i.Rm))
+		fmt.Fprintf(p.w, "\tldr\t%s, [%s, %s%s]\n", regName(i.Rt, i.Is64), regName64(i.Rn), regName64(i.Rm), lslSuffix(i.Shift))
 	case LDRB:
 		if i.Ofs == 0 {
 			fmt.Fprintf(p.w, "\tldrb\t%s, [%s]\n", regName32(i.Rt), regName64(i.Rn))
@@ -300,7 +403,7 @@ func (p *Printer) printInstruction(inst Instruction) {
 			fmt.Fprintf(p.w, "\tstr\t%s, [%s, #%d]\n", regName(i.Rt, i.Is64), regName64(i.Rn), i.Ofs)
 		}
 	case STRr:
-		fmt.Fprintf(p.w, "\tstr\t%s, [%s, %s]\n", regName(i.Rt, i.Is64), regName64(i.Rn), regName64(i.Rm))
+		fmt.Fprintf(p.w, "\tstr\t%s, [%s, %s%s]\n", regName(i.Rt, i.Is64), regName64(i.Rn), regName64(i.Rm), lslSuffix(i.Shift))
 	case STRB:
 		if i.Ofs == 0 {
 			fmt.Fprintf(p.w, "\tstrb\t%s, [%s]\n", regName32(i.Rt), regName64(i.Rn))
@@ -377,6 +480,8 @@ func (p *Printer) printInstruction(inst Instruction) {
 		fmt.Fprintf(p.w, "\tblr\t%s\n", regName64(i.Rn))
 	case RET:
 		fmt.Fprintf(p.w, "\tret\n")
+	case SVC:
+		fmt.Fprintf(p.w, "\tsvc\t#%d\n", i.Imm)
 	case Bcond:
 		fmt.Fprintf(p.w, "\tb.%s\t%s\n", i.Cond.String(), i.Target)
 
@@ -453,8 +558,25 @@ func (p *Printer) printInstruction(inst Instruction) {
 				// Symbol + offset: need to add both
 				fmt.Fprintf(p.w, "\tadd\t%s, %s, %s%s@PAGEOFF+%d\n", regName64(i.Rd), regName64(i.Rn), prefix, i.Symbol, i.Offset)
 			}
+		} else if i.Offset == 0 {
+			fmt.Fprintf(p.w, "\tadd\t%s, %s, :lo12:%s\n", regName64(i.Rd), regName64(i.Rn), i.Symbol)
+		} else {
+			fmt.Fprintf(p.w, "\tadd\t%s, %s, :lo12:%s+%d\n", regName64(i.Rd), regName64(i.Rn), i.Symbol, i.Offset)
+		}
+	case MOVsym:
+		op := "movz"
+		if i.Keep {
+			op = "movk"
+		}
+		// Only the top group checks that the address fits
+		reloc := fmt.Sprintf(":abs_g%d_nc:", i.Group)
+		if i.Group == 3 {
+			reloc = ":abs_g3:"
+		}
+		if i.Offset == 0 {
+			fmt.Fprintf(p.w, "\t%s\t%s, #%s%s\n", op, regName64(i.Rd), reloc, i.Symbol)
 		} else {
-			fmt.Fprintf(p.w, "\tadd\t%s, %s, #%d\n", regName64(i.Rd), regName64(i.Rn), i.Offset)
+			fmt.Fprintf(p.w, "\t%s\t%s, #%s%s+%d\n", op, regName64(i.Rd), reloc, i.Symbol, i.Offset)
 		}
 
 	// Floating point operations
@@ -473,7 +595,7 @@ func (p *Printer) printInstruction(inst Instruction) {
 	case FSQRT:
 		fmt.Fprintf(p.w, "\tfsqrt\t%s, %s\n", floatRegName(i.Fd, i.IsDouble), floatRegName(i.Fn, i.IsDouble))
 	case FMOV:
-		fmt.Fprintf(p.w, "\tfmov\t%s, %s\n", floatRegName(i.Fd, i.IsDouble), floatRegName(i.Fn, i.IsDouble))
+		fmt.Fprintf(p.w, "\tfmov\t%s, %s\n", fmovRegName(i.Fd, i.IsDouble), fmovRegName(i.Fn, i.IsDouble))
 	case FMOVi:
 		fmt.Fprintf(p.w, "\tfmov\t%s, #%g\n", floatRegName(i.Fd, i.IsDouble), i.Imm)
 
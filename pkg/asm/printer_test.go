@@ -2,6 +2,7 @@ package asm
 
 import (
 	"bytes"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -15,6 +16,7 @@ func TestPrintArithmeticInstructions(t *testing.T) {
 		{"ADD 64-bit", ADD{Rd: X0, Rn: X1, Rm: X2, Is64: true}, "\tadd\tx0, x1, x2\n"},
 		{"ADD 32-bit", ADD{Rd: X0, Rn: X1, Rm: X2, Is64: false}, "\tadd\tw0, w1, w2\n"},
 		{"ADDi 64-bit", ADDi{Rd: X0, Rn: X1, Imm: 16, Is64: true}, "\tadd\tx0, x1, #16\n"},
+		{"ADDshift", ADDshift{Rd: X0, Rn: X1, Rm: X2, Shift: 3}, "\tadd\tx0, x1, x2, lsl #3\n"},
 		{"SUB", SUB{Rd: X3, Rn: X4, Rm: X5, Is64: true}, "\tsub\tx3, x4, x5\n"},
 		{"SUBi", SUBi{Rd: X3, Rn: X4, Imm: 32, Is64: true}, "\tsub\tx3, x4, #32\n"},
 		{"MUL", MUL{Rd: X0, Rn: X1, Rm: X2, Is64: true}, "\tmul\tx0, x1, x2\n"},
@@ -75,12 +77,15 @@ func TestPrintLoadStoreInstructions(t *testing.T) {
 		{"LDR no offset", LDR{Rt: X0, Rn: X1, Ofs: 0, Is64: true}, "\tldr\tx0, [x1]\n"},
 		{"LDR with offset", LDR{Rt: X0, Rn: X1, Ofs: 16, Is64: true}, "\tldr\tx0, [x1, #16]\n"},
 		{"LDR 32-bit", LDR{Rt: X0, Rn: X1, Ofs: 8, Is64: false}, "\tldr\tw0, [x1, #8]\n"},
+		{"LDRr", LDRr{Rt: X0, Rn: X1, Rm: X2, Is64: true}, "\tldr\tx0, [x1, x2]\n"},
+		{"LDRr scaled", LDRr{Rt: X0, Rn: X1, Rm: X2, Shift: 2}, "\tldr\tw0, [x1, x2, lsl #2]\n"},
 		{"LDRB", LDRB{Rt: X0, Rn: X1, Ofs: 4}, "\tldrb\tw0, [x1, #4]\n"},
 		{"LDRH", LDRH{Rt: X0, Rn: X1, Ofs: 2}, "\tldrh\tw0, [x1, #2]\n"},
 		{"LDRSB", LDRSB{Rt: X0, Rn: X1, Ofs: 0, Is64: true}, "\tldrsb\tx0, [x1]\n"},
 		{"LDRSW", LDRSW{Rt: X0, Rn: X1, Ofs: 4}, "\tldrsw\tx0, [x1, #4]\n"},
 		{"STR no offset", STR{Rt: X0, Rn: X1, Ofs: 0, Is64: true}, "\tstr\tx0, [x1]\n"},
 		{"STR with offset", STR{Rt: X0, Rn: X1, Ofs: 24, Is64: true}, "\tstr\tx0, [x1, #24]\n"},
+		{"STRr scaled", STRr{Rt: X0, Rn: X1, Rm: X2, Shift: 3, Is64: true}, "\tstr\tx0, [x1, x2, lsl #3]\n"},
 		{"STRB", STRB{Rt: X0, Rn: X1, Ofs: 1}, "\tstrb\tw0, [x1, #1]\n"},
 		{"STRH", STRH{Rt: X0, Rn: X1, Ofs: 2}, "\tstrh\tw0, [x1, #2]\n"},
 		{"LDP", LDP{Rt1: X29, Rt2: X30, Rn: X0, Ofs: 16, Is64: true}, "\tldp\tx29, x30, [x0, #16]\n"},
@@ -110,6 +115,7 @@ func TestPrintBranchInstructions(t *testing.T) {
 		{"BR", BR{Rn: X0}, "\tbr\tx0\n"},
 		{"BLR", BLR{Rn: X1}, "\tblr\tx1\n"},
 		{"RET", RET{}, "\tret\n"},
+		{"SVC", SVC{Imm: 0}, "\tsvc\t#0\n"},
 		{"B.EQ", Bcond{Cond: CondEQ, Target: ".L2"}, "\tb.eq\t.L2\n"},
 		{"B.NE", Bcond{Cond: CondNE, Target: ".L3"}, "\tb.ne\t.L3\n"},
 		{"B.LT", Bcond{Cond: CondLT, Target: ".L4"}, "\tb.lt\t.L4\n"},
@@ -191,6 +197,9 @@ func TestPrintFloatInstructions(t *testing.T) {
 		{"FNEG", FNEG{Fd: D0, Fn: D1, IsDouble: true}, "\tfneg\td0, d1\n"},
 		{"FABS", FABS{Fd: D0, Fn: D1, IsDouble: true}, "\tfabs\td0, d1\n"},
 		{"FCMP", FCMP{Fn: D0, Fm: D1, IsDouble: true}, "\tfcmp\td0, d1\n"},
+		{"FMOV", FMOV{Fd: D0, Fn: D1, IsDouble: true}, "\tfmov\td0, d1\n"},
+		{"FMOV from integer register", FMOV{Fd: D2, Fn: X0, IsDouble: true}, "\tfmov\td2, x0\n"},
+		{"FMOV to integer register", FMOV{Fd: X1, Fn: D3, IsDouble: true}, "\tfmov\tx1, d3\n"},
 		{"SCVTF", SCVTF{Fd: D0, Rn: X0, IsDouble: true, Is64Src: true}, "\tscvtf\td0, x0\n"},
 		{"FCVTZS", FCVTZS{Rd: X0, Fn: D0, IsDouble: true, Is64Dst: true}, "\tfcvtzs\tx0, d0\n"},
 	}
@@ -261,7 +270,7 @@ func TestPrintFunction(t *testing.T) {
 func TestPrintProgram(t *testing.T) {
 	prog := &Program{
 		Globals: []GlobVar{
-			{Name: "global_var", Size: 8, Align: 8},
+			{Name: "global_var", Size: 8, Init: []byte{1, 0, 0, 0, 0, 0, 0, 0}, Align: 8},
 		},
 		Functions: []Function{
 			{
@@ -304,6 +313,195 @@ func TestPrintProgram(t *testing.T) {
 	}
 }
 
+func TestPrintFunctionELFDirectives(t *testing.T) {
+	f := Function{Name: "f", Code: []Instruction{RET{}}}
+
+	var buf bytes.Buffer
+	p := NewPrinterForFormat(&buf, ELF)
+	p.PrintProgram(&Program{Functions: []Function{f}})
+	output := buf.String()
+
+	for _, want := range []string{
+		"\t.text\n",
+		"\t.align\t2\n",
+		"\t.global\tf\n",
+		"\t.type\tf, %function\n",
+		"f:\n",
+		"\t.size\tf, .-f\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+func TestPrintStaticSymbolsNotGlobal(t *testing.T) {
+	prog := &Program{
+		Globals: []GlobVar{
+			{Name: "counter.n", Size: 4, Align: 4, Static: true},
+			{Name: "table", Size: 4, Init: []byte{1, 0, 0, 0}, Align: 4, Static: true},
+			{Name: "shared", Size: 4, Align: 4},
+		},
+		Functions: []Function{
+			{Name: "helper", Code: []Instruction{RET{}}, Static: true},
+			{Name: "main", Code: []Instruction{RET{}}},
+		},
+	}
+
+	for _, format := range []ObjectFormat{ELF, MachO} {
+		var buf bytes.Buffer
+		p := NewPrinterForFormat(&buf, format)
+		p.PrintProgram(prog)
+		output := buf.String()
+
+		for _, name := range []string{"counter.n", "table", "helper"} {
+			if strings.Contains(output, ".global\t"+p.symbolName(name)+"\n") {
+				t.Errorf("static %s should not be global:\n%s", name, output)
+			}
+			if !strings.Contains(output, p.symbolName(name)) {
+				t.Errorf("expected %s to be defined:\n%s", name, output)
+			}
+		}
+		for _, name := range []string{"shared", "main"} {
+			if !strings.Contains(output, ".global\t"+p.symbolName(name)+"\n") {
+				t.Errorf("expected %s to be global:\n%s", name, output)
+			}
+		}
+	}
+}
+
+func TestPrintFunctionMachODirectives(t *testing.T) {
+	f := Function{Name: "f", Code: []Instruction{BL{Target: "g", IsSymbol: true}, RET{}}}
+
+	var buf bytes.Buffer
+	p := NewPrinterForFormat(&buf, MachO)
+	p.PrintProgram(&Program{Functions: []Function{f}})
+	output := buf.String()
+
+	for _, want := range []string{"\t.text\n", "\t.global\t_f\n", "_f:\n", "\tbl\t_g\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{".type", ".size"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("Mach-O output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestPrintStartStub(t *testing.T) {
+	tests := []struct {
+		format ObjectFormat
+		want   []string
+	}{
+		{ELF, []string{"_start:\n", "\tldr\tx0, [sp]\n", "\tadd\tx1, sp, #8\n", "\tbl\tmain\n", "\tmov\tx8, #93\n", "\tsvc\t#0\n"}},
+		{MachO, []string{"__start:\n", "\tbl\t_main\n", "\tmov\tx16, #1\n", "\tsvc\t#128\n"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		p := NewPrinterForFormat(&buf, tt.format)
+		p.PrintProgram(&Program{Functions: []Function{StartStub(tt.format)}})
+		output := buf.String()
+
+		for _, want := range tt.want {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected %q in output:\n%s", want, output)
+			}
+		}
+		if strings.Contains(output, "ret") {
+			t.Errorf("the entry point must exit rather than return:\n%s", output)
+		}
+	}
+}
+
+func TestPrintGlobalSectionsELF(t *testing.T) {
+	prog := &Program{
+		Globals: []GlobVar{
+			{Name: ".Lstr0", Size: 3, Init: []byte{'h', 'i', 0}, Align: 1, ReadOnly: true},
+			{Name: "counter", Size: 4, Init: []byte{7, 0, 0, 0}, Align: 4},
+			{Name: "buffer", Size: 16, Align: 8},
+		},
+	}
+
+	var buf bytes.Buffer
+	p := NewPrinterForFormat(&buf, ELF)
+	p.PrintProgram(prog)
+	output := buf.String()
+
+	rodata := strings.Index(output, "\t.section\t.rodata\n")
+	data := strings.Index(output, "\t.data\n")
+	bss := strings.Index(output, "\t.bss\n")
+	text := strings.Index(output, "\t.text\n")
+	if rodata < 0 || data < 0 || bss < 0 || text < 0 {
+		t.Fatalf("expected .rodata, .data, .bss and .text sections:\n%s", output)
+	}
+	if !(rodata < data && data < bss && bss < text) {
+		t.Errorf("unexpected section order:\n%s", output)
+	}
+
+	for _, want := range []string{
+		"\t.type\tcounter, %object\n",
+		"\t.size\tcounter, 4\n",
+		"\t.type\tbuffer, %object\n",
+		"\t.p2align\t3\nbuffer:\n\t.zero\t16\n",
+		"\t.size\tbuffer, 16\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, ".global\t.Lstr0") {
+		t.Error("local string label should not be global")
+	}
+	// The buffer belongs to .bss, not .data
+	if strings.Index(output, "buffer:") < bss {
+		t.Errorf("zero-initialized global should be in .bss:\n%s", output)
+	}
+}
+
+func TestPrintGlobalSectionsMachO(t *testing.T) {
+	prog := &Program{
+		Globals: []GlobVar{
+			{Name: ".Lstr0", Size: 1, Init: []byte{0}, Align: 1, ReadOnly: true},
+			{Name: "counter", Size: 4, Init: []byte{7, 0, 0, 0}, Align: 4},
+			{Name: "buffer", Size: 16, Align: 8},
+		},
+	}
+
+	var buf bytes.Buffer
+	p := NewPrinterForFormat(&buf, MachO)
+	p.PrintProgram(prog)
+	output := buf.String()
+
+	for _, want := range []string{
+		"\t.section\t__DATA,__const\n",
+		"\t.data\n",
+		"\t.global\t_counter\n",
+		"\t.global\t_buffer\n",
+		"\t.zerofill\t__DATA,__bss,_buffer,16,3\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{".bss\n", ".type", ".size"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("Mach-O output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestHostFormat(t *testing.T) {
+	want := ELF
+	if runtime.GOOS == "darwin" {
+		want = MachO
+	}
+	if got := HostFormat(); got != want {
+		t.Errorf("HostFormat() = %v, want %v", got, want)
+	}
+}
+
 func TestPrintExtensionInstructions(t *testing.T) {
 	tests := []struct {
 		name string
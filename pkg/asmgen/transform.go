@@ -5,14 +5,36 @@ package asmgen
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/raymyers/ralph-cc/pkg/asm"
 	"github.com/raymyers/ralph-cc/pkg/mach"
 	"github.com/raymyers/ralph-cc/pkg/rtl"
 )
 
-// TransformProgram transforms a Mach program to assembly
+// RelocationModel selects how the code computes the address of a symbol
+type RelocationModel int
+
+const (
+	// PIC addresses symbols relative to the program counter, with adrp and
+	// the low 12 bits of the address, so the code runs at any load address
+	// (position-independent executables, the default of most toolchains).
+	PIC RelocationModel = iota
+	// Static builds the absolute address of a symbol 16 bits at a time
+	// with movz and movk, which the linker resolves for an executable
+	// loaded at a fixed address (linked with -no-pie). ELF only.
+	Static
+)
+
+// TransformProgram transforms a Mach program to assembly, addressing
+// symbols PC-relative.
 func TransformProgram(prog *mach.Program) *asm.Program {
+	return TransformProgramWithRelocation(prog, PIC)
+}
+
+// TransformProgramWithRelocation transforms a Mach program to assembly,
+// addressing symbols under the relocation model.
+func TransformProgramWithRelocation(prog *mach.Program, reloc RelocationModel) *asm.Program {
 	result := &asm.Program{
 		Globals:   make([]asm.GlobVar, len(prog.Globals)),
 		Functions: make([]asm.Function, len(prog.Functions)),
@@ -26,28 +48,31 @@ func TransformProgram(prog *mach.Program) *asm.Program {
 			Init:     g.Init,
 			Align:    8, // Default alignment for 64-bit
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		}
 	}
 
 	// Transform functions
 	for i, f := range prog.Functions {
-		result.Functions[i] = transformFunction(&f)
+		result.Functions[i] = transformFunction(&f, reloc)
 	}
 
 	return result
 }
 
 // transformFunction transforms a single Mach function to assembly
-func transformFunction(f *mach.Function) asm.Function {
+func transformFunction(f *mach.Function, reloc RelocationModel) asm.Function {
 	ctx := &genContext{
 		fn:              f,
 		labelCount:      0,
 		prologueEmitted: false,
+		reloc:           reloc,
 	}
 
 	result := asm.Function{
-		Name: f.Name,
-		Code: make([]asm.Instruction, 0),
+		Name:   f.Name,
+		Code:   make([]asm.Instruction, 0),
+		Static: f.Static,
 	}
 
 	// Emit proper ARM64 prologue
@@ -82,6 +107,7 @@ type genContext struct {
 	fn              *mach.Function
 	labelCount      int
 	prologueEmitted bool
+	reloc           RelocationModel
 }
 
 // countPrologueInstructions returns the number of Mach instructions that form the prologue
@@ -318,6 +344,9 @@ func (ctx *genContext) translateGetparam(i mach.Mgetparam) []asm.Instruction {
 
 // translateOp translates an operation
 func (ctx *genContext) translateOp(i mach.Mop) []asm.Instruction {
+	if o, ok := i.Op.(rtl.Oaddrsymbol); ok {
+		return symbolAddress(ctx.reloc, i.Dest, asm.Label(o.Symbol), o.Offset)
+	}
 	return translateOperation(i.Op, i.Args, i.Dest)
 }
 
@@ -326,7 +355,9 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 	switch o := op.(type) {
 	// Move operations
 	case rtl.Omove:
-		if dest.IsFloat() {
+		// A float value passed or returned in an X register is moved
+		// between the register files with an fmov too
+		if dest.IsFloat() || args[0].IsFloat() {
 			return []asm.Instruction{asm.FMOV{Fd: dest, Fn: args[0], IsDouble: true}}
 		}
 		return []asm.Instruction{asm.MOV{Rd: dest, Rm: args[0], Is64: true}}
@@ -345,13 +376,15 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 
 	// Address operations
 	case rtl.Oaddrsymbol:
-		// Load address of symbol
-		return []asm.Instruction{
-			asm.ADRP{Rd: dest, Target: asm.Label(o.Symbol), IsSymbol: true},
-			asm.ADDpageoff{Rd: dest, Rn: dest, Symbol: asm.Label(o.Symbol), Offset: o.Offset},
-		}
+		// Under the default model, see translateOp
+		return symbolAddress(PIC, dest, asm.Label(o.Symbol), o.Offset)
 	case rtl.Oaddrstack:
-		// Compute stack address
+		// Compute stack address; stack variables lie below FP
+		if o.Offset < 0 {
+			return []asm.Instruction{
+				asm.SUBi{Rd: dest, Rn: asm.X29, Imm: -o.Offset, Is64: true},
+			}
+		}
 		return []asm.Instruction{
 			asm.ADDi{Rd: dest, Rn: asm.X29, Imm: o.Offset, Is64: true},
 		}
@@ -369,9 +402,21 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 		return []asm.Instruction{asm.MUL{Rd: dest, Rn: args[0], Rm: args[1], Is64: false}}
 	case rtl.Omulimm:
 		// MUL doesn't have immediate form, load constant first
+		scratch := mach.ScratchReg(args)
+		return []asm.Instruction{
+			asm.MOVi{Rd: scratch, Imm: int64(o.N), Is64: false},
+			asm.MUL{Rd: dest, Rn: args[0], Rm: scratch, Is64: false},
+		}
+	case rtl.Omulhs:
+		// Take the high word of the 64-bit product
+		return []asm.Instruction{
+			asm.SMULL{Rd: dest, Rn: args[0], Rm: args[1]},
+			asm.LSRi{Rd: dest, Rn: dest, Shift: 32, Is64: true},
+		}
+	case rtl.Omulhu:
 		return []asm.Instruction{
-			asm.MOVi{Rd: asm.X8, Imm: int64(o.N), Is64: false},
-			asm.MUL{Rd: dest, Rn: args[0], Rm: asm.X8, Is64: false},
+			asm.UMULL{Rd: dest, Rn: args[0], Rm: args[1]},
+			asm.LSRi{Rd: dest, Rn: dest, Shift: 32, Is64: true},
 		}
 	case rtl.Odiv:
 		return []asm.Instruction{asm.SDIV{Rd: dest, Rn: args[0], Rm: args[1], Is64: false}}
@@ -379,16 +424,18 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 		return []asm.Instruction{asm.UDIV{Rd: dest, Rn: args[0], Rm: args[1], Is64: false}}
 	case rtl.Omod:
 		// rd = rn - (rn/rm)*rm
+		scratch := mach.ScratchReg(args)
 		return []asm.Instruction{
-			asm.SDIV{Rd: asm.X8, Rn: args[0], Rm: args[1], Is64: false},
-			asm.MUL{Rd: asm.X8, Rn: asm.X8, Rm: args[1], Is64: false},
-			asm.SUB{Rd: dest, Rn: args[0], Rm: asm.X8, Is64: false},
+			asm.SDIV{Rd: scratch, Rn: args[0], Rm: args[1], Is64: false},
+			asm.MUL{Rd: scratch, Rn: scratch, Rm: args[1], Is64: false},
+			asm.SUB{Rd: dest, Rn: args[0], Rm: scratch, Is64: false},
 		}
 	case rtl.Omodu:
+		scratch := mach.ScratchReg(args)
 		return []asm.Instruction{
-			asm.UDIV{Rd: asm.X8, Rn: args[0], Rm: args[1], Is64: false},
-			asm.MUL{Rd: asm.X8, Rn: asm.X8, Rm: args[1], Is64: false},
-			asm.SUB{Rd: dest, Rn: args[0], Rm: asm.X8, Is64: false},
+			asm.UDIV{Rd: scratch, Rn: args[0], Rm: args[1], Is64: false},
+			asm.MUL{Rd: scratch, Rn: scratch, Rm: args[1], Is64: false},
+			asm.SUB{Rd: dest, Rn: args[0], Rm: scratch, Is64: false},
 		}
 
 	// Bitwise operations (32-bit)
@@ -442,16 +489,18 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 	case rtl.Odivlu:
 		return []asm.Instruction{asm.UDIV{Rd: dest, Rn: args[0], Rm: args[1], Is64: true}}
 	case rtl.Omodl:
+		scratch := mach.ScratchReg(args)
 		return []asm.Instruction{
-			asm.SDIV{Rd: asm.X8, Rn: args[0], Rm: args[1], Is64: true},
-			asm.MUL{Rd: asm.X8, Rn: asm.X8, Rm: args[1], Is64: true},
-			asm.SUB{Rd: dest, Rn: args[0], Rm: asm.X8, Is64: true},
+			asm.SDIV{Rd: scratch, Rn: args[0], Rm: args[1], Is64: true},
+			asm.MUL{Rd: scratch, Rn: scratch, Rm: args[1], Is64: true},
+			asm.SUB{Rd: dest, Rn: args[0], Rm: scratch, Is64: true},
 		}
 	case rtl.Omodlu:
+		scratch := mach.ScratchReg(args)
 		return []asm.Instruction{
-			asm.UDIV{Rd: asm.X8, Rn: args[0], Rm: args[1], Is64: true},
-			asm.MUL{Rd: asm.X8, Rn: asm.X8, Rm: args[1], Is64: true},
-			asm.SUB{Rd: dest, Rn: args[0], Rm: asm.X8, Is64: true},
+			asm.UDIV{Rd: scratch, Rn: args[0], Rm: args[1], Is64: true},
+			asm.MUL{Rd: scratch, Rn: scratch, Rm: args[1], Is64: true},
+			asm.SUB{Rd: dest, Rn: args[0], Rm: scratch, Is64: true},
 		}
 
 	// 64-bit bitwise operations
@@ -569,6 +618,10 @@ func translateOperation(op mach.Operation, args []mach.MReg, dest mach.MReg) []a
 		return translateCompareImm(args[0], dest, o.N, o.Cond, false, true)
 	case rtl.Ocmpluimm:
 		return translateCompareImm(args[0], dest, o.N, o.Cond, true, true)
+	case rtl.Ocmpf:
+		return translateCompareFloat(args, dest, o.Cond, true)
+	case rtl.Ocmps:
+		return translateCompareFloat(args, dest, o.Cond, false)
 
 	default:
 		// Unknown operation - return empty
@@ -594,6 +647,57 @@ func translateCompareImm(arg mach.MReg, dest mach.MReg, imm int64, cond rtl.Cond
 	}
 }
 
+// translateCompareFloat generates a float compare and conditional set
+func translateCompareFloat(args []mach.MReg, dest mach.MReg, cond rtl.Condition, isDouble bool) []asm.Instruction {
+	return []asm.Instruction{
+		asm.FCMP{Fn: args[0], Fm: args[1], IsDouble: isDouble},
+		asm.CSET{Rd: dest, Cond: floatCondCode(cond, false), Is64: false},
+	}
+}
+
+// floatCondCode converts the RTL condition of a float comparison, negated
+// if negated is set, to the ARM64 condition code that tests it after an
+// FCMP. An FCMP with a NaN operand is unordered and sets C and V, so a
+// comparison other than != is false and a negated one true: a < b tests
+// MI rather than LT, and a <= b LS rather than LE, as LT and LE hold for
+// unordered operands. This is CompCert's aarch64 Asmgen.cond_for_float_cmp.
+func floatCondCode(cond rtl.Condition, negated bool) asm.CondCode {
+	switch cond {
+	case rtl.Ceq:
+		if negated {
+			return asm.CondNE
+		}
+		return asm.CondEQ
+	case rtl.Cne:
+		if negated {
+			return asm.CondEQ
+		}
+		return asm.CondNE
+	case rtl.Clt:
+		if negated {
+			return asm.CondPL // Not less than, or unordered
+		}
+		return asm.CondMI // Less than
+	case rtl.Cle:
+		if negated {
+			return asm.CondHI // Not less or equal, or unordered
+		}
+		return asm.CondLS // Less than or equal
+	case rtl.Cgt:
+		if negated {
+			return asm.CondLE // Not greater than, or unordered
+		}
+		return asm.CondGT // Greater than
+	case rtl.Cge:
+		if negated {
+			return asm.CondLT // Not greater or equal, or unordered
+		}
+		return asm.CondGE // Greater than or equal
+	default:
+		return asm.CondAL
+	}
+}
+
 // conditionToCondCode converts RTL condition to ARM64 condition code
 func conditionToCondCode(cond rtl.Condition, unsigned bool) asm.CondCode {
 	switch cond {
@@ -626,79 +730,118 @@ func conditionToCondCode(cond rtl.Condition, unsigned bool) asm.CondCode {
 	}
 }
 
-// translateLoad generates load instructions
-func (ctx *genContext) translateLoad(i mach.Mload) []asm.Instruction {
-	var base asm.MReg
-	ofs := int64(0)
+// memOperand is the memory operand an addressing mode resolves to: a base
+// register plus an immediate offset or, when indexed, plus an index
+// register shifted left by shift.
+type memOperand struct {
+	base    asm.MReg
+	ofs     int64
+	indexed bool
+	index   asm.MReg
+	shift   int
+}
 
-	// Extract offset and base from addressing mode
-	switch addr := i.Addr.(type) {
+// translateAddressing resolves the addressing mode of an access of chunk.
+// An address the access cannot encode is computed into tmp by the
+// instructions returned first.
+func translateAddressing(addr mach.AddressingMode, args []mach.MReg, chunk mach.Chunk, tmp asm.MReg, reloc RelocationModel) ([]asm.Instruction, memOperand) {
+	switch a := addr.(type) {
 	case rtl.Aindexed:
-		base = i.Args[0]
-		ofs = addr.Offset
+		return nil, memOperand{base: args[0], ofs: a.Offset}
 	case rtl.Ainstack:
-		base = asm.X29 // FP
-		ofs = addr.Offset
-	default:
-		base = i.Args[0]
+		return nil, memOperand{base: asm.X29, ofs: a.Offset} // FP
+	case rtl.Aindexed2, rtl.Aindexed2shift:
+		shift := 0
+		if s, ok := a.(rtl.Aindexed2shift); ok {
+			shift = s.Shift
+		}
+		if !mach.NeedsAddressScratch(addr, chunk) {
+			return nil, memOperand{base: args[0], indexed: true, index: args[1], shift: shift}
+		}
+		return []asm.Instruction{
+			asm.ADDshift{Rd: tmp, Rn: args[0], Rm: args[1], Shift: shift},
+		}, memOperand{base: tmp}
+	case rtl.Aglobal:
+		return symbolAddress(reloc, tmp, asm.Label(a.Symbol), a.Offset), memOperand{base: tmp}
+	}
+	return nil, memOperand{base: args[0]}
+}
+
+// symbolAddress returns the instructions that set rd to the address of
+// symbol plus offset under the relocation model
+func symbolAddress(reloc RelocationModel, rd asm.MReg, symbol asm.Label, offset int64) []asm.Instruction {
+	if reloc == Static {
+		return []asm.Instruction{
+			asm.MOVsym{Rd: rd, Symbol: symbol, Offset: offset, Group: 0},
+			asm.MOVsym{Rd: rd, Symbol: symbol, Offset: offset, Group: 1, Keep: true},
+			asm.MOVsym{Rd: rd, Symbol: symbol, Offset: offset, Group: 2, Keep: true},
+			asm.MOVsym{Rd: rd, Symbol: symbol, Offset: offset, Group: 3, Keep: true},
+		}
+	}
+	return []asm.Instruction{
+		asm.ADRP{Rd: rd, Target: symbol, IsSymbol: true},
+		asm.ADDpageoff{Rd: rd, Rn: rd, Symbol: symbol, Offset: offset},
 	}
+}
+
+// translateLoad generates load instructions. X16 holds an address that
+// the load cannot encode, see mach.NeedsAddressScratch.
+func (ctx *genContext) translateLoad(i mach.Mload) []asm.Instruction {
+	result, m := translateAddressing(i.Addr, i.Args, i.Chunk, mach.AddressScratchReg(i), ctx.reloc)
+	if m.indexed {
+		return append(result, asm.LDRr{Rt: i.Dest, Rn: m.base, Rm: m.index, Shift: m.shift, Is64: i.Chunk == mach.Mint64})
+	}
+	base, ofs := m.base, m.ofs
 
 	// Generate appropriate load based on chunk type
 	switch i.Chunk {
 	case mach.Mint8signed:
-		return []asm.Instruction{asm.LDRSB{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false}}
+		return append(result, asm.LDRSB{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false})
 	case mach.Mint8unsigned:
-		return []asm.Instruction{asm.LDRB{Rt: i.Dest, Rn: base, Ofs: ofs}}
+		return append(result, asm.LDRB{Rt: i.Dest, Rn: base, Ofs: ofs})
 	case mach.Mint16signed:
-		return []asm.Instruction{asm.LDRSH{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false}}
+		return append(result, asm.LDRSH{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false})
 	case mach.Mint16unsigned:
-		return []asm.Instruction{asm.LDRH{Rt: i.Dest, Rn: base, Ofs: ofs}}
+		return append(result, asm.LDRH{Rt: i.Dest, Rn: base, Ofs: ofs})
 	case mach.Mint32:
-		return []asm.Instruction{asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false}}
+		return append(result, asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: false})
 	case mach.Mint64:
-		return []asm.Instruction{asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: true}}
+		return append(result, asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: true})
 	case mach.Mfloat32:
-		return []asm.Instruction{asm.FLDRs{Ft: i.Dest, Rn: base, Ofs: ofs}}
+		return append(result, asm.FLDRs{Ft: i.Dest, Rn: base, Ofs: ofs})
 	case mach.Mfloat64:
-		return []asm.Instruction{asm.FLDRd{Ft: i.Dest, Rn: base, Ofs: ofs}}
+		return append(result, asm.FLDRd{Ft: i.Dest, Rn: base, Ofs: ofs})
 	default:
-		return []asm.Instruction{asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: true}}
+		return append(result, asm.LDR{Rt: i.Dest, Rn: base, Ofs: ofs, Is64: true})
 	}
 }
 
-// translateStore generates store instructions
+// translateStore generates store instructions. X16, or X17 when X16 holds
+// the stored value, holds an address that the store cannot encode, see
+// mach.NeedsAddressScratch.
 func (ctx *genContext) translateStore(i mach.Mstore) []asm.Instruction {
-	var base asm.MReg
-	ofs := int64(0)
-
-	// Extract offset and base from addressing mode
-	switch addr := i.Addr.(type) {
-	case rtl.Aindexed:
-		base = i.Args[0]
-		ofs = addr.Offset
-	case rtl.Ainstack:
-		base = asm.X29 // FP
-		ofs = addr.Offset
-	default:
-		base = i.Args[0]
+	result, m := translateAddressing(i.Addr, i.Args, i.Chunk, mach.AddressScratchReg(i), ctx.reloc)
+	if m.indexed {
+		return append(result, asm.STRr{Rt: i.Src, Rn: m.base, Rm: m.index, Shift: m.shift, Is64: i.Chunk == mach.Mint64})
 	}
+	base, ofs := m.base, m.ofs
 
 	// Generate appropriate store based on chunk type
 	switch i.Chunk {
 	case mach.Mint8signed, mach.Mint8unsigned:
-		return []asm.Instruction{asm.STRB{Rt: i.Src, Rn: base, Ofs: ofs}}
+		return append(result, asm.STRB{Rt: i.Src, Rn: base, Ofs: ofs})
 	case mach.Mint16signed, mach.Mint16unsigned:
-		return []asm.Instruction{asm.STRH{Rt: i.Src, Rn: base, Ofs: ofs}}
+		return append(result, asm.STRH{Rt: i.Src, Rn: base, Ofs: ofs})
 	case mach.Mint32:
-		return []asm.Instruction{asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: false}}
+		return append(result, asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: false})
 	case mach.Mint64:
-		return []asm.Instruction{asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: true}}
+		return append(result, asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: true})
 	case mach.Mfloat32:
-		return []asm.Instruction{asm.FSTRs{Ft: i.Src, Rn: base, Ofs: ofs}}
+		return append(result, asm.FSTRs{Ft: i.Src, Rn: base, Ofs: ofs})
 	case mach.Mfloat64:
-		return []asm.Instruction{asm.FSTRd{Ft: i.Src, Rn: base, Ofs: ofs}}
+		return append(result, asm.FSTRd{Ft: i.Src, Rn: base, Ofs: ofs})
 	default:
-		return []asm.Instruction{asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: true}}
+		return append(result, asm.STR{Rt: i.Src, Rn: base, Ofs: ofs, Is64: true})
 	}
 }
 
@@ -726,12 +869,64 @@ func (ctx *genContext) translateTailcall(i mach.Mtailcall) []asm.Instruction {
 	}
 }
 
-// translateBuiltin generates builtin function calls
+// annotPrefix starts the name of an annotation builtin, which becomes a
+// comment holding the rest of the name (see simplexpr).
+const annotPrefix = "annot:"
+
+// translateBuiltin generates builtin function calls. The front end expands
+// memcpy, memset, va_arg, va_end and va_copy; va_start needs the frame
+// layout and is expanded here, and annotations become comments. Other
+// builtins become calls.
 func (ctx *genContext) translateBuiltin(i mach.Mbuiltin) []asm.Instruction {
-	// For now, just generate a BL to the builtin name
+	if text, ok := strings.CutPrefix(i.Builtin, annotPrefix); ok {
+		return []asm.Instruction{asm.Comment{Text: text}}
+	}
+	if i.Builtin == "va_start" && ctx.fn.VarArgs != nil && len(i.Args) == 1 {
+		return ctx.translateVaStart(i.Args[0])
+	}
 	return []asm.Instruction{asm.BL{Target: asm.Label(i.Builtin), IsSymbol: true}}
 }
 
+// savedArgRegs is the number of argument registers (X0-X7) a function
+// using va_start saves on entry.
+const savedArgRegs = 8
+
+// translateVaStart initializes the AAPCS64 va_list at [ap]:
+//
+//	__stack   [ap, #0]   first variable argument passed on the stack
+//	__gr_top  [ap, #8]   end of the saved X0-X7
+//	__vr_top  [ap, #16]  end of the FP/SIMD save area (empty, so __gr_top)
+//	__gr_offs [ap, #24]  offset from __gr_top of the first variable argument
+//	__vr_offs [ap, #28]  0, no FP/SIMD registers were saved
+//
+// X16 or X17, whichever does not hold ap, is used as scratch.
+func (ctx *genContext) translateVaStart(ap mach.MReg) []asm.Instruction {
+	va := ctx.fn.VarArgs
+	tmp := asm.X16
+	if ap == asm.X16 {
+		tmp = asm.X17
+	}
+
+	grTop := va.SaveOfs + savedArgRegs*8
+	grOffs := -int64(savedArgRegs-va.NamedRegs) * 8
+
+	var result []asm.Instruction
+	result = append(result, asm.ADDi{Rd: tmp, Rn: asm.X29, Imm: 16 + va.NamedStack, Is64: true})
+	result = append(result, asm.STR{Rt: tmp, Rn: ap, Ofs: 0, Is64: true})
+	if grTop < 0 {
+		result = append(result, asm.SUBi{Rd: tmp, Rn: asm.X29, Imm: -grTop, Is64: true})
+	} else {
+		result = append(result, asm.ADDi{Rd: tmp, Rn: asm.X29, Imm: grTop, Is64: true})
+	}
+	result = append(result, asm.STR{Rt: tmp, Rn: ap, Ofs: 8, Is64: true})
+	result = append(result, asm.STR{Rt: tmp, Rn: ap, Ofs: 16, Is64: true})
+	result = append(result, loadIntConstant(tmp, grOffs, false)...)
+	result = append(result, asm.STR{Rt: tmp, Rn: ap, Ofs: 24, Is64: false})
+	result = append(result, loadIntConstant(tmp, 0, false)...)
+	result = append(result, asm.STR{Rt: tmp, Rn: ap, Ofs: 28, Is64: false})
+	return result
+}
+
 // translateCond generates compare instruction followed by conditional branch
 func (ctx *genContext) translateCond(i mach.Mcond) []asm.Instruction {
 	// Generate both compare instruction and conditional branch
@@ -800,14 +995,28 @@ func (ctx *genContext) translateCond(i mach.Mcond) []asm.Instruction {
 		if len(i.Args) >= 2 {
 			result = append(result, asm.FCMP{Fn: i.Args[0], Fm: i.Args[1], IsDouble: true})
 		}
-		result = append(result, asm.Bcond{Cond: conditionToCondCode(c.Cond, false), Target: ctx.machLabelToAsm(i.IfSo)})
+		result = append(result, asm.Bcond{Cond: floatCondCode(c.Cond, false), Target: ctx.machLabelToAsm(i.IfSo)})
+
+	case rtl.Cnotcompf:
+		// Negated float64 comparison: FCMP d1, d2, true when unordered
+		if len(i.Args) >= 2 {
+			result = append(result, asm.FCMP{Fn: i.Args[0], Fm: i.Args[1], IsDouble: true})
+		}
+		result = append(result, asm.Bcond{Cond: floatCondCode(c.Cond, true), Target: ctx.machLabelToAsm(i.IfSo)})
 
 	case rtl.Ccomps:
 		// Float32 comparison: FCMP s1, s2
 		if len(i.Args) >= 2 {
 			result = append(result, asm.FCMP{Fn: i.Args[0], Fm: i.Args[1], IsDouble: false})
 		}
-		result = append(result, asm.Bcond{Cond: conditionToCondCode(c.Cond, false), Target: ctx.machLabelToAsm(i.IfSo)})
+		result = append(result, asm.Bcond{Cond: floatCondCode(c.Cond, false), Target: ctx.machLabelToAsm(i.IfSo)})
+
+	case rtl.Cnotcomps:
+		// Negated float32 comparison: FCMP s1, s2, true when unordered
+		if len(i.Args) >= 2 {
+			result = append(result, asm.FCMP{Fn: i.Args[0], Fm: i.Args[1], IsDouble: false})
+		}
+		result = append(result, asm.Bcond{Cond: floatCondCode(c.Cond, true), Target: ctx.machLabelToAsm(i.IfSo)})
 
 	default:
 		// Unknown condition - emit unconditional branch
@@ -823,8 +1032,10 @@ func (ctx *genContext) translateJumptable(i mach.Mjumptable) []asm.Instruction {
 	// A real implementation would use an actual jump table
 	result := make([]asm.Instruction, 0)
 	for idx, target := range i.Targets {
+		// The index is an int, as in CompCert: compare its 32 bits only, the
+		// upper half of the register is not defined
 		result = append(result,
-			asm.CMPi{Rn: i.Arg, Imm: int64(idx), Is64: true},
+			asm.CMPi{Rn: i.Arg, Imm: int64(idx), Is64: false},
 			asm.Bcond{Cond: asm.CondEQ, Target: ctx.machLabelToAsm(target)},
 		)
 	}
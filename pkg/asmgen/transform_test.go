@@ -1,6 +1,8 @@
 package asmgen
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/asm"
@@ -130,6 +132,39 @@ func TestTranslateArithmetic(t *testing.T) {
 	}
 }
 
+func TestTranslateScratchRegister(t *testing.T) {
+	// Expansions needing a scratch register use X16, which is never
+	// allocated, or X17 when X16 holds an argument reloaded by stacking.
+	// The argument registers are left alone.
+	tests := []struct {
+		name    string
+		op      mach.Operation
+		args    []mach.MReg
+		scratch asm.MReg
+	}{
+		{"Omulimm", rtl.Omulimm{N: 10}, []mach.MReg{mach.X8}, asm.X16},
+		{"Omod", rtl.Omod{}, []mach.MReg{mach.X8, mach.X1}, asm.X16},
+		{"Omodu", rtl.Omodu{}, []mach.MReg{mach.X8, mach.X1}, asm.X16},
+		{"Omodl", rtl.Omodl{}, []mach.MReg{mach.X8, mach.X1}, asm.X16},
+		{"Omodlu", rtl.Omodlu{}, []mach.MReg{mach.X8, mach.X1}, asm.X16},
+		{"Omulimm of a reloaded value", rtl.Omulimm{N: 10}, []mach.MReg{mach.X16}, asm.X17},
+		{"Omod of a reloaded divisor", rtl.Omod{}, []mach.MReg{mach.X8, mach.X16}, asm.X17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, instr := range translateOperation(tt.op, tt.args, mach.X2) {
+				rd := reflect.ValueOf(instr).FieldByName("Rd")
+				if !rd.IsValid() {
+					t.Fatalf("expected instructions with a destination, got %#v", instr)
+				}
+				if rd.Interface() != tt.scratch && rd.Interface() != asm.X2 {
+					t.Errorf("%#v writes a register other than the scratch and the destination", instr)
+				}
+			}
+		})
+	}
+}
+
 func isType(a, b interface{}) bool {
 	switch a.(type) {
 	case asm.ADD:
@@ -272,6 +307,26 @@ func TestTranslateBranches(t *testing.T) {
 	}
 }
 
+func TestTranslateJumptable(t *testing.T) {
+	ctx := &genContext{fn: &mach.Function{Name: "f"}}
+	instrs := ctx.translateInstruction(mach.Mjumptable{Arg: mach.X1, Targets: []mach.Label{3, 5}})
+	if len(instrs) != 4 {
+		t.Fatalf("Expected 4 instructions, got %d", len(instrs))
+	}
+	for idx := 0; idx < 2; idx++ {
+		cmp, ok := instrs[2*idx].(asm.CMPi)
+		if !ok {
+			t.Fatalf("Expected CMPi, got %T", instrs[2*idx])
+		}
+		if cmp.Is64 || cmp.Imm != int64(idx) {
+			t.Errorf("Expected 32-bit compare with %d, got %+v", idx, cmp)
+		}
+		if b, ok := instrs[2*idx+1].(asm.Bcond); !ok || b.Cond != asm.CondEQ {
+			t.Errorf("Expected b.eq, got %v", instrs[2*idx+1])
+		}
+	}
+}
+
 func TestTranslateCall(t *testing.T) {
 	ctx := &genContext{fn: &mach.Function{}}
 
@@ -361,6 +416,99 @@ func TestTranslateStore(t *testing.T) {
 	}
 }
 
+func TestTranslateIndexedAccess(t *testing.T) {
+	ctx := &genContext{fn: &mach.Function{}}
+
+	tests := []struct {
+		name   string
+		instrs []asm.Instruction
+		want   []asm.Instruction
+	}{
+		{
+			// a[i] for an int a: [base, index, lsl #2]
+			"scaled word load",
+			ctx.translateLoad(mach.Mload{Chunk: mach.Mint32, Addr: rtl.Aindexed2shift{Shift: 2}, Args: []mach.MReg{mach.X1, mach.X2}, Dest: mach.X0}),
+			[]asm.Instruction{asm.LDRr{Rt: mach.X0, Rn: mach.X1, Rm: mach.X2, Shift: 2}},
+		},
+		{
+			"unscaled doubleword store",
+			ctx.translateStore(mach.Mstore{Chunk: mach.Mint64, Addr: rtl.Aindexed2{}, Args: []mach.MReg{mach.X1, mach.X2}, Src: mach.X0}),
+			[]asm.Instruction{asm.STRr{Rt: mach.X0, Rn: mach.X1, Rm: mach.X2, Is64: true}},
+		},
+		{
+			// A byte access cannot shift its index
+			"byte load",
+			ctx.translateLoad(mach.Mload{Chunk: mach.Mint8unsigned, Addr: rtl.Aindexed2shift{Shift: 1}, Args: []mach.MReg{mach.X1, mach.X2}, Dest: mach.X0}),
+			[]asm.Instruction{
+				asm.ADDshift{Rd: asm.X16, Rn: mach.X1, Rm: mach.X2, Shift: 1},
+				asm.LDRB{Rt: mach.X0, Rn: asm.X16},
+			},
+		},
+		{
+			// The scale of the index does not match the access size
+			"mismatched scale store of X16",
+			ctx.translateStore(mach.Mstore{Chunk: mach.Mint32, Addr: rtl.Aindexed2shift{Shift: 3}, Args: []mach.MReg{mach.X1, mach.X2}, Src: asm.X16}),
+			[]asm.Instruction{
+				asm.ADDshift{Rd: asm.X17, Rn: mach.X1, Rm: mach.X2, Shift: 3},
+				asm.STR{Rt: asm.X16, Rn: asm.X17},
+			},
+		},
+		{
+			"global load",
+			ctx.translateLoad(mach.Mload{Chunk: mach.Mfloat64, Addr: rtl.Aglobal{Symbol: "g", Offset: 8}, Dest: mach.D0}),
+			[]asm.Instruction{
+				asm.ADRP{Rd: asm.X16, Target: "g", IsSymbol: true},
+				asm.ADDpageoff{Rd: asm.X16, Rn: asm.X16, Symbol: "g", Offset: 8},
+				asm.FLDRd{Ft: mach.D0, Rn: asm.X16},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.instrs, tt.want) {
+				t.Errorf("got %#v, want %#v", tt.instrs, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticRelocationModel(t *testing.T) {
+	ctx := &genContext{fn: &mach.Function{}, reloc: Static}
+	absolute := func(rd asm.MReg, offset int64) []asm.Instruction {
+		return []asm.Instruction{
+			asm.MOVsym{Rd: rd, Symbol: "g", Offset: offset, Group: 0},
+			asm.MOVsym{Rd: rd, Symbol: "g", Offset: offset, Group: 1, Keep: true},
+			asm.MOVsym{Rd: rd, Symbol: "g", Offset: offset, Group: 2, Keep: true},
+			asm.MOVsym{Rd: rd, Symbol: "g", Offset: offset, Group: 3, Keep: true},
+		}
+	}
+
+	got := ctx.translateOp(mach.Mop{Op: rtl.Oaddrsymbol{Symbol: "g", Offset: 4}, Dest: mach.X0})
+	if want := absolute(mach.X0, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("address of g = %#v, want %#v", got, want)
+	}
+	got = ctx.translateLoad(mach.Mload{Chunk: mach.Mint32, Addr: rtl.Aglobal{Symbol: "g", Offset: 8}, Dest: mach.X0})
+	if want := append(absolute(asm.X16, 8), asm.LDR{Rt: mach.X0, Rn: asm.X16}); !reflect.DeepEqual(got, want) {
+		t.Errorf("load of g = %#v, want %#v", got, want)
+	}
+
+	// The printed sequence uses the ELF absolute address relocations
+	var b strings.Builder
+	prog := &asm.Program{Functions: []asm.Function{{Name: "f", Code: absolute(mach.X0, 4)}}}
+	asm.NewPrinterForFormat(&b, asm.ELF).PrintProgram(prog)
+	for _, line := range []string{
+		"movz\tx0, #:abs_g0_nc:g+4\n",
+		"movk\tx0, #:abs_g1_nc:g+4\n",
+		"movk\tx0, #:abs_g2_nc:g+4\n",
+		"movk\tx0, #:abs_g3:g+4\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected %q in\n%s", line, b.String())
+		}
+	}
+}
+
 func TestTranslateCompare(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -403,6 +551,83 @@ func TestTranslateCompare(t *testing.T) {
 	}
 }
 
+func TestTranslateCompareFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       mach.Operation
+		isDouble bool
+		wantCond asm.CondCode
+	}{
+		{"eq", rtl.Ocmpf{Cond: rtl.Ceq}, true, asm.CondEQ},
+		{"ne", rtl.Ocmpf{Cond: rtl.Cne}, true, asm.CondNE},
+		{"lt is false when unordered", rtl.Ocmpf{Cond: rtl.Clt}, true, asm.CondMI},
+		{"le is false when unordered", rtl.Ocmpf{Cond: rtl.Cle}, true, asm.CondLS},
+		{"gt", rtl.Ocmpf{Cond: rtl.Cgt}, true, asm.CondGT},
+		{"ge", rtl.Ocmpf{Cond: rtl.Cge}, true, asm.CondGE},
+		{"float32 lt", rtl.Ocmps{Cond: rtl.Clt}, false, asm.CondMI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instrs := translateOperation(tt.op, []mach.MReg{ltl.D0, ltl.D1}, mach.X0)
+			if len(instrs) != 2 {
+				t.Fatalf("Expected 2 instructions, got %d", len(instrs))
+			}
+			fcmp, ok := instrs[0].(asm.FCMP)
+			if !ok {
+				t.Fatalf("Expected FCMP, got %T", instrs[0])
+			}
+			if fcmp.Fn != ltl.D0 || fcmp.Fm != ltl.D1 || fcmp.IsDouble != tt.isDouble {
+				t.Errorf("Expected fcmp of d0, d1 (double %v), got %+v", tt.isDouble, fcmp)
+			}
+			cset, ok := instrs[1].(asm.CSET)
+			if !ok {
+				t.Fatalf("Expected CSET, got %T", instrs[1])
+			}
+			if cset.Rd != mach.X0 || cset.Cond != tt.wantCond {
+				t.Errorf("Expected cset x0, %v, got %+v", tt.wantCond, cset)
+			}
+		})
+	}
+}
+
+func TestTranslateCondFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		cond     mach.ConditionCode
+		wantCond asm.CondCode
+	}{
+		{"lt", rtl.Ccompf{Cond: rtl.Clt}, asm.CondMI},
+		{"le", rtl.Ccompf{Cond: rtl.Cle}, asm.CondLS},
+		{"not lt is true when unordered", rtl.Cnotcompf{Cond: rtl.Clt}, asm.CondPL},
+		{"not le is true when unordered", rtl.Cnotcompf{Cond: rtl.Cle}, asm.CondHI},
+		{"not gt is true when unordered", rtl.Cnotcompf{Cond: rtl.Cgt}, asm.CondLE},
+		{"not ge is true when unordered", rtl.Cnotcompf{Cond: rtl.Cge}, asm.CondLT},
+		{"not eq", rtl.Cnotcompf{Cond: rtl.Ceq}, asm.CondNE},
+		{"float32 not lt", rtl.Cnotcomps{Cond: rtl.Clt}, asm.CondPL},
+	}
+
+	ctx := &genContext{fn: &mach.Function{Name: "f"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instrs := ctx.translateInstruction(mach.Mcond{Cond: tt.cond, Args: []mach.MReg{ltl.D0, ltl.D1}, IfSo: 1})
+			if len(instrs) != 2 {
+				t.Fatalf("Expected 2 instructions, got %d", len(instrs))
+			}
+			if _, ok := instrs[0].(asm.FCMP); !ok {
+				t.Errorf("Expected FCMP, got %T", instrs[0])
+			}
+			b, ok := instrs[1].(asm.Bcond)
+			if !ok {
+				t.Fatalf("Expected Bcond, got %T", instrs[1])
+			}
+			if b.Cond != tt.wantCond {
+				t.Errorf("Expected condition %v, got %v", tt.wantCond, b.Cond)
+			}
+		})
+	}
+}
+
 func TestLoadIntConstant(t *testing.T) {
 	tests := []struct {
 		name string
@@ -470,6 +695,15 @@ func TestTranslateMove(t *testing.T) {
 	if _, ok := instrs[0].(asm.FMOV); !ok {
 		t.Errorf("Expected FMOV, got %T", instrs[0])
 	}
+
+	// Float value moved to an integer register, as for an argument
+	instrs = translateOperation(rtl.Omove{}, []mach.MReg{ltl.D2}, mach.X0)
+	if len(instrs) != 1 {
+		t.Fatalf("Expected 1 instruction, got %d", len(instrs))
+	}
+	if mov, ok := instrs[0].(asm.FMOV); !ok || mov.Fd != mach.X0 || mov.Fn != ltl.D2 {
+		t.Errorf("Expected FMOV x0, d2, got %#v", instrs[0])
+	}
 }
 
 func TestMachLabelToAsm(t *testing.T) {
@@ -519,3 +753,36 @@ func TestTranslateExtensions(t *testing.T) {
 		})
 	}
 }
+
+func TestTranslateVaStart(t *testing.T) {
+	// One named register argument; X0-X7 saved at [FP-96, FP-32)
+	ctx := &genContext{fn: &mach.Function{VarArgs: &mach.VarArgs{SaveOfs: -96, NamedRegs: 1}}}
+	instrs := ctx.translateBuiltin(mach.Mbuiltin{Builtin: "va_start", Args: []mach.MReg{mach.X1}})
+
+	stores := map[int64]asm.STR{}
+	for _, instr := range instrs {
+		if _, ok := instr.(asm.BL); ok {
+			t.Fatalf("expected va_start expanded inline, got a call")
+		}
+		if st, ok := instr.(asm.STR); ok {
+			if st.Rn != mach.X1 {
+				t.Errorf("expected stores through x1, got %v", st.Rn)
+			}
+			stores[st.Ofs] = st
+		}
+	}
+	for _, ofs := range []int64{0, 8, 16, 24, 28} {
+		if _, ok := stores[ofs]; !ok {
+			t.Errorf("expected a store to [ap, #%d]", ofs)
+		}
+	}
+	if stores[24].Is64 || stores[28].Is64 {
+		t.Errorf("expected 32-bit stores of the offsets")
+	}
+	if add, ok := instrs[0].(asm.ADDi); !ok || add.Rn != asm.X29 || add.Imm != 16 {
+		t.Errorf("expected __stack = fp + 16, got %#v", instrs[0])
+	}
+	if sub, ok := instrs[2].(asm.SUBi); !ok || sub.Imm != 32 {
+		t.Errorf("expected __gr_top = fp - 32, got %#v", instrs[2])
+	}
+}
@@ -1,6 +1,8 @@
 // Package cabs defines the abstract syntax tree for C, mirroring CompCert's Cabs.v
 package cabs
 
+import "github.com/raymyers/ralph-cc/pkg/diag"
+
 // Node is the base interface for all AST nodes
 type Node interface {
 	implCabsNode()
@@ -94,17 +96,20 @@ func (op UnaryOp) String() string {
 
 // Constant represents an integer constant
 type Constant struct {
-	Value int64
+	Value int64  // the value, or its bit pattern for an unsigned long above the int64 range
+	Type  string // its type from the suffix and base, as "unsigned int"; empty when it is the one the value gives: int, else long
 }
 
-// StringLiteral represents a string literal ("hello")
+// StringLiteral represents a string literal ("hello", L"wide")
 type StringLiteral struct {
-	Value string
+	Value    string
+	Encoding string // prefix: "", "L", "u", "U" or "u8"
 }
 
-// CharLiteral represents a character literal ('x', '\n')
+// CharLiteral represents a character literal ('x', '\n', L'x')
 type CharLiteral struct {
-	Value string
+	Value    string
+	Encoding string // prefix: "", "L", "u", "U" or "u8"
 }
 
 // Variable represents an identifier expression
@@ -172,33 +177,64 @@ type Cast struct {
 	Expr     Expr
 }
 
+// VaArg represents __builtin_va_arg(ap, type), which va_arg expands to
+type VaArg struct {
+	Expr     Expr // the va_list
+	TypeName string
+}
+
+// StmtExpr represents a GNU statement expression: ({ stmts; expr; })
+type StmtExpr struct {
+	Block  *Block // statements executed before the result is computed
+	Result Expr   // trailing expression statement; nil if the value is void
+}
+
+// InitList represents a brace-enclosed initializer list: {1, {2, 3}}
+type InitList struct {
+	Items []Expr
+}
+
+// Designated represents an item of an initializer list that names the
+// array elements it initializes: [2] = v, or the GNU range [2 ... 5] = v,
+// for which Last is 5. Last equals Index for a single element.
+type Designated struct {
+	Index int64
+	Last  int64
+	Value Expr
+}
+
 // Return represents a return statement
 type Return struct {
-	Expr Expr // nil for bare return
+	Expr Expr     // nil for bare return
+	Pos  diag.Pos // position of the return keyword
 }
 
 // Computation represents an expression statement (expr;)
 type Computation struct {
 	Expr Expr
+	Pos  diag.Pos // position of the first token of the expression
 }
 
 // If represents an if statement (with optional else)
 type If struct {
 	Cond Expr
 	Then Stmt
-	Else Stmt // nil if no else branch
+	Else Stmt     // nil if no else branch
+	Pos  diag.Pos // position of the if keyword
 }
 
 // While represents a while loop
 type While struct {
 	Cond Expr
 	Body Stmt
+	Pos  diag.Pos // position of the while keyword
 }
 
 // DoWhile represents a do-while loop
 type DoWhile struct {
 	Body Stmt
 	Cond Expr
+	Pos  diag.Pos // position of the do keyword
 }
 
 // For represents a for loop
@@ -208,21 +244,27 @@ type For struct {
 	Cond     Expr   // may be nil (infinite loop)
 	Step     Expr   // may be nil
 	Body     Stmt
+	Pos      diag.Pos // position of the for keyword
 }
 
 // Skip represents an empty statement (just a semicolon)
 type Skip struct{}
 
 // Break represents a break statement
-type Break struct{}
+type Break struct {
+	Pos diag.Pos
+}
 
 // Continue represents a continue statement
-type Continue struct{}
+type Continue struct {
+	Pos diag.Pos
+}
 
 // Switch represents a switch statement
 type Switch struct {
 	Expr  Expr
 	Cases []SwitchCase
+	Pos   diag.Pos // position of the switch keyword
 }
 
 // SwitchCase represents a case or default in a switch
@@ -234,12 +276,14 @@ type SwitchCase struct {
 // Goto represents a goto statement
 type Goto struct {
 	Label string
+	Pos   diag.Pos
 }
 
 // Label represents a label statement
 type Label struct {
 	Name string
 	Stmt Stmt
+	Pos  diag.Pos // position of the label name
 }
 
 // Block represents a compound statement (block)
@@ -247,32 +291,73 @@ type Block struct {
 	Items []Stmt
 }
 
+// StmtPos returns the position of a statement, the zero position for the
+// statements that carry none: blocks, empty statements and declarations.
+func StmtPos(s Stmt) diag.Pos {
+	switch s := s.(type) {
+	case Return:
+		return s.Pos
+	case Computation:
+		return s.Pos
+	case If:
+		return s.Pos
+	case While:
+		return s.Pos
+	case DoWhile:
+		return s.Pos
+	case For:
+		return s.Pos
+	case Break:
+		return s.Pos
+	case Continue:
+		return s.Pos
+	case Switch:
+		return s.Pos
+	case Goto:
+		return s.Pos
+	case Label:
+		return s.Pos
+	}
+	return diag.Pos{}
+}
+
 // FunDef represents a function definition
 type FunDef struct {
-	ReturnType string
-	Name       string
-	Params     []Param
-	Variadic   bool // true if function has ... parameter (variadic)
-	Body       *Block
+	StorageClass string // "extern", "static", or "" for none
+	Inline       bool   // declared with the inline function specifier
+	ReturnType   string
+	Name         string
+	Params       []Param
+	Variadic     bool // true if function has ... parameter (variadic)
+	Body         *Block
+	Attrs        Attributes
 }
 
 // Param represents a function parameter
 type Param struct {
-	TypeSpec string
-	Name     string
+	TypeSpec    string
+	Quals       Qualifiers
+	Name        string
+	ArraySize   Expr // size of an array parameter (int a[10]), nil if none
+	ArrayStatic bool // int a[static 10]: the argument has at least ArraySize elements
 }
 
 // Decl represents a variable declaration (with optional initializer)
 type Decl struct {
-	TypeSpec    string
-	Name        string
-	ArrayDims   []Expr // array dimensions: nil for non-array, [nil] for int arr[], [expr] for int arr[n]
-	Initializer Expr   // nil if no initializer
+	StorageClass string // "static", "extern", "auto", "register", or "" for none
+	TypeSpec     string
+	Quals        Qualifiers
+	Name         string
+	ArrayDims    []Expr   // array dimensions: nil for non-array, [nil] for int arr[], [expr] for int arr[n]
+	Initializer  Expr     // nil if no initializer
+	Typeof       Expr     // operand of a typeof(expr) base type, spelled "typeof(...)" in TypeSpec; nil if none
+	Pos          diag.Pos // position of the name
 }
 
 // DeclStmt represents a declaration statement (can have multiple declarators)
 type DeclStmt struct {
-	Decls []Decl
+	Decls    []Decl
+	TypeSpec string // set when there are no declarators, e.g. struct Foo;
 }
 
 // StorageClass represents storage class specifiers
@@ -296,35 +381,82 @@ const (
 	QualRestrict
 )
 
+func (q TypeQualifier) String() string {
+	switch q {
+	case QualConst:
+		return "const"
+	case QualVolatile:
+		return "volatile"
+	case QualRestrict:
+		return "restrict"
+	}
+	return ""
+}
+
+// Qualifiers records where the type qualifiers of a declaration apply.
+// Base qualifies the base type and Pointers[i] the (i+1)-th '*' counted
+// from the base type, so `const char *p` has Base [const] while
+// `char *const p` has Pointers [[const]].
+type Qualifiers struct {
+	Base     []TypeQualifier
+	Pointers [][]TypeQualifier
+}
+
+// PointerHas reports whether the (level+1)-th pointer carries qual.
+func (q Qualifiers) PointerHas(level int, qual TypeQualifier) bool {
+	return level < len(q.Pointers) && hasQualifier(q.Pointers[level], qual)
+}
+
+// BaseHas reports whether the base type carries qual.
+func (q Qualifiers) BaseHas(qual TypeQualifier) bool {
+	return hasQualifier(q.Base, qual)
+}
+
+func hasQualifier(quals []TypeQualifier, q TypeQualifier) bool {
+	for _, x := range quals {
+		if x == q {
+			return true
+		}
+	}
+	return false
+}
+
 // TypedefDef represents a typedef declaration
 type TypedefDef struct {
 	TypeSpec    string
+	Quals       Qualifiers
 	Name        string
 	InlineType  Definition // optional inline struct/union/enum definition
 }
 
 // StructField represents a field in a struct definition
 type StructField struct {
-	TypeSpec string
-	Name     string
+	TypeSpec  string
+	Name      string // empty for an anonymous struct or union member
+	Flexible  bool   // flexible array member: trailing `type name[];`
+	ArrayDims []Expr // sizes of an array field, one "[]" of TypeSpec each; nil for an empty dimension
+	Attrs     Attributes
 }
 
 // StructDef represents a struct type definition
 type StructDef struct {
-	Name   string // empty for anonymous structs
-	Fields []StructField
+	Name   string        // empty for anonymous structs
+	Fields []StructField // nil for a forward declaration: struct Name;
+	Attrs  Attributes
 }
 
 // UnionDef represents a union type definition
 type UnionDef struct {
 	Name   string
-	Fields []StructField
+	Fields []StructField // nil for a forward declaration: union Name;
+	Attrs  Attributes
 }
 
 // EnumVal represents a single enumerator
 type EnumVal struct {
 	Name  string
-	Value Expr // nil for auto-assigned values
+	Value Expr  // nil for auto-assigned values
+	Num   int64 // the value: Value, or one more than the previous enumerator
 }
 
 // EnumDef represents an enum type definition
@@ -336,11 +468,23 @@ type EnumDef struct {
 // VarDef represents a global/extern variable declaration
 // e.g., extern const int sys_nerr; or static int global_count = 0;
 type VarDef struct {
-	StorageClass string   // "extern", "static", or "" for none
-	TypeSpec     string   // the type specifier
-	Name         string   // variable name
-	ArrayDims    []Expr   // array dimensions: nil for non-array, [nil] for int arr[], [expr] for int arr[n]
-	Initializer  Expr     // nil if no initializer
+	StorageClass string     // "extern", "static", or "" for none
+	TypeSpec     string     // the type specifier
+	Quals        Qualifiers // qualifiers of the base type and each pointer
+	Name         string     // variable name
+	ArrayDims    []Expr     // array dimensions: nil for non-array, [nil] for int arr[], [expr] for int arr[n]
+	Initializer  Expr       // nil if no initializer
+	Typeof       Expr       // operand of a typeof(expr) base type, as in Decl
+	Attrs        Attributes
+	Pos          diag.Pos // position of the name
+}
+
+// Attributes holds the GCC __attribute__ specifiers that affect code
+// generation. Other attributes are parsed and dropped.
+type Attributes struct {
+	Packed  bool   // packed: fields are laid out without padding
+	Aligned int64  // aligned(N): alignment of at least N bytes; 0 if absent
+	Section string // section("name"): output section; empty if absent
 }
 
 // Marker methods for interface implementation
@@ -386,6 +530,18 @@ func (SizeofType) implCabsExpr() {}
 func (Cast) implCabsNode() {}
 func (Cast) implCabsExpr() {}
 
+func (VaArg) implCabsNode() {}
+func (VaArg) implCabsExpr() {}
+
+func (StmtExpr) implCabsNode() {}
+func (StmtExpr) implCabsExpr() {}
+
+func (InitList) implCabsNode() {}
+func (InitList) implCabsExpr() {}
+
+func (Designated) implCabsNode() {}
+func (Designated) implCabsExpr() {}
+
 func (Return) implCabsNode() {}
 func (Return) implCabsStmt() {}
 
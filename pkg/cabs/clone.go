@@ -0,0 +1,153 @@
+package cabs
+
+import "fmt"
+
+// CloneExpr returns a deep copy of an expression. The copy shares no
+// slices or blocks with the original, so either can be modified without
+// affecting the other. A nil expression is returned as nil.
+func CloneExpr(e Expr) Expr {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case Constant, StringLiteral, CharLiteral, Variable, SizeofType:
+		return e
+	case Unary:
+		return Unary{Op: e.Op, Expr: CloneExpr(e.Expr)}
+	case Binary:
+		return Binary{Op: e.Op, Left: CloneExpr(e.Left), Right: CloneExpr(e.Right)}
+	case Paren:
+		return Paren{Expr: CloneExpr(e.Expr)}
+	case Conditional:
+		return Conditional{Cond: CloneExpr(e.Cond), Then: CloneExpr(e.Then), Else: CloneExpr(e.Else)}
+	case Call:
+		return Call{Func: CloneExpr(e.Func), Args: cloneExprs(e.Args)}
+	case Index:
+		return Index{Array: CloneExpr(e.Array), Index: CloneExpr(e.Index)}
+	case Member:
+		return Member{Expr: CloneExpr(e.Expr), Name: e.Name, IsArrow: e.IsArrow}
+	case SizeofExpr:
+		return SizeofExpr{Expr: CloneExpr(e.Expr)}
+	case Cast:
+		return Cast{TypeName: e.TypeName, Expr: CloneExpr(e.Expr)}
+	case VaArg:
+		return VaArg{Expr: CloneExpr(e.Expr), TypeName: e.TypeName}
+	case StmtExpr:
+		return StmtExpr{Block: cloneBlock(e.Block), Result: CloneExpr(e.Result)}
+	case InitList:
+		return InitList{Items: cloneExprs(e.Items)}
+	case Designated:
+		return Designated{Index: e.Index, Last: e.Last, Value: CloneExpr(e.Value)}
+	}
+	panic(fmt.Sprintf("unhandled expression type: %T", e))
+}
+
+// CloneStmt returns a deep copy of a statement, with the same guarantees
+// as CloneExpr. A nil statement is returned as nil.
+func CloneStmt(s Stmt) Stmt {
+	switch s := s.(type) {
+	case nil:
+		return nil
+	case Skip, Break, Continue, Goto:
+		return s
+	case Return:
+		return Return{Expr: CloneExpr(s.Expr)}
+	case Computation:
+		return Computation{Expr: CloneExpr(s.Expr)}
+	case If:
+		return If{Cond: CloneExpr(s.Cond), Then: CloneStmt(s.Then), Else: CloneStmt(s.Else)}
+	case While:
+		return While{Cond: CloneExpr(s.Cond), Body: CloneStmt(s.Body)}
+	case DoWhile:
+		return DoWhile{Body: CloneStmt(s.Body), Cond: CloneExpr(s.Cond)}
+	case For:
+		return For{
+			Init:     CloneExpr(s.Init),
+			InitDecl: cloneDecls(s.InitDecl),
+			Cond:     CloneExpr(s.Cond),
+			Step:     CloneExpr(s.Step),
+			Body:     CloneStmt(s.Body),
+		}
+	case Switch:
+		var cases []SwitchCase
+		if s.Cases != nil {
+			cases = make([]SwitchCase, len(s.Cases))
+			for i, c := range s.Cases {
+				cases[i] = SwitchCase{Expr: CloneExpr(c.Expr), Stmts: cloneStmts(c.Stmts)}
+			}
+		}
+		return Switch{Expr: CloneExpr(s.Expr), Cases: cases}
+	case Label:
+		return Label{Name: s.Name, Stmt: CloneStmt(s.Stmt)}
+	case Block:
+		return *cloneBlock(&s)
+	case *Block:
+		return cloneBlock(s)
+	case DeclStmt:
+		return DeclStmt{Decls: cloneDecls(s.Decls), TypeSpec: s.TypeSpec}
+	}
+	panic(fmt.Sprintf("unhandled statement type: %T", s))
+}
+
+func cloneBlock(b *Block) *Block {
+	if b == nil {
+		return nil
+	}
+	return &Block{Items: cloneStmts(b.Items)}
+}
+
+func cloneExprs(exprs []Expr) []Expr {
+	if exprs == nil {
+		return nil
+	}
+	result := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		result[i] = CloneExpr(e)
+	}
+	return result
+}
+
+func cloneStmts(stmts []Stmt) []Stmt {
+	if stmts == nil {
+		return nil
+	}
+	result := make([]Stmt, len(stmts))
+	for i, s := range stmts {
+		result[i] = CloneStmt(s)
+	}
+	return result
+}
+
+func cloneDecls(decls []Decl) []Decl {
+	if decls == nil {
+		return nil
+	}
+	result := make([]Decl, len(decls))
+	for i, d := range decls {
+		result[i] = Decl{
+			StorageClass: d.StorageClass,
+			TypeSpec:     d.TypeSpec,
+			Quals:        cloneQualifiers(d.Quals),
+			Name:         d.Name,
+			ArrayDims:    cloneExprs(d.ArrayDims),
+			Initializer:  CloneExpr(d.Initializer),
+			Typeof:       CloneExpr(d.Typeof),
+		}
+	}
+	return result
+}
+
+func cloneQualifiers(q Qualifiers) Qualifiers {
+	result := Qualifiers{}
+	if q.Base != nil {
+		result.Base = append([]TypeQualifier{}, q.Base...)
+	}
+	if q.Pointers != nil {
+		result.Pointers = make([][]TypeQualifier, len(q.Pointers))
+		for i, level := range q.Pointers {
+			if level != nil {
+				result.Pointers[i] = append([]TypeQualifier{}, level...)
+			}
+		}
+	}
+	return result
+}
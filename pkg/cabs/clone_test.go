@@ -0,0 +1,106 @@
+package cabs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloneExprIndependent(t *testing.T) {
+	// f(a[1], {2, 3}) ? ({ int t = 4; t; }) : (char)x
+	build := func() Conditional {
+		return Conditional{
+			Cond: Call{
+				Func: Variable{Name: "f"},
+				Args: []Expr{
+					Index{Array: Variable{Name: "a"}, Index: Constant{Value: 1}},
+					InitList{Items: []Expr{Constant{Value: 2}, Constant{Value: 3}}},
+				},
+			},
+			Then: StmtExpr{
+				Block: &Block{Items: []Stmt{
+					DeclStmt{Decls: []Decl{{TypeSpec: "int", Name: "t", Initializer: Constant{Value: 4}}}},
+				}},
+				Result: Variable{Name: "t"},
+			},
+			Else: Cast{TypeName: "char", Expr: Variable{Name: "x"}},
+		}
+	}
+	orig, want := build(), build()
+
+	clone := CloneExpr(orig).(Conditional)
+	if !reflect.DeepEqual(clone, orig) {
+		t.Fatalf("expected an equal copy, got %#v", clone)
+	}
+
+	call := clone.Cond.(Call)
+	call.Args[0] = Variable{Name: "b"}
+	call.Args[1].(InitList).Items[0] = Constant{Value: 9}
+	se := clone.Then.(StmtExpr)
+	se.Block.Items[0].(DeclStmt).Decls[0].Name = "u"
+	se.Block.Items = append(se.Block.Items, Break{})
+
+	if !reflect.DeepEqual(orig, want) {
+		t.Errorf("mutating the clone changed the original: %#v", orig)
+	}
+}
+
+func TestCloneStmtIndependent(t *testing.T) {
+	build := func() *Block {
+		return &Block{Items: []Stmt{
+			DeclStmt{Decls: []Decl{{
+				TypeSpec:  "int*",
+				Name:      "p",
+				Quals:     Qualifiers{Pointers: [][]TypeQualifier{{QualConst}}},
+				ArrayDims: []Expr{Constant{Value: 2}},
+			}}},
+			For{
+				InitDecl: []Decl{{StorageClass: "register", TypeSpec: "int", Name: "i", Initializer: Constant{Value: 0}}},
+				Cond:     Binary{Op: OpLt, Left: Variable{Name: "i"}, Right: Constant{Value: 3}},
+				Step:     Unary{Op: OpPostInc, Expr: Variable{Name: "i"}},
+				Body: Switch{
+					Expr: Variable{Name: "i"},
+					Cases: []SwitchCase{
+						{Expr: Constant{Value: 1}, Stmts: []Stmt{Break{}}},
+						{Stmts: []Stmt{Label{Name: "l", Stmt: Return{Expr: Variable{Name: "i"}}}}},
+					},
+				},
+			},
+			If{Cond: Variable{Name: "p"}, Then: Block{Items: []Stmt{Continue{}}}},
+		}}
+	}
+	orig, want := build(), build()
+
+	clone := CloneStmt(orig).(*Block)
+	if clone == orig {
+		t.Fatal("expected a new block")
+	}
+	if !reflect.DeepEqual(clone, orig) {
+		t.Fatalf("expected an equal copy, got %#v", clone)
+	}
+
+	decl := clone.Items[0].(DeclStmt).Decls[0]
+	decl.Quals.Pointers[0][0] = QualVolatile
+	decl.ArrayDims[0] = Constant{Value: 5}
+	loop := clone.Items[1].(For)
+	loop.InitDecl[0].Name = "j"
+	sw := loop.Body.(Switch)
+	sw.Cases[0].Stmts[0] = Skip{}
+	sw.Cases[1].Expr = Constant{Value: 2}
+	clone.Items[2].(If).Then.(Block).Items[0] = Break{}
+
+	if !reflect.DeepEqual(orig, want) {
+		t.Errorf("mutating the clone changed the original: %#v", orig)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	if CloneExpr(nil) != nil {
+		t.Error("expected nil expression")
+	}
+	if CloneStmt(nil) != nil {
+		t.Error("expected nil statement")
+	}
+	if r := CloneStmt(Return{}).(Return); r.Expr != nil {
+		t.Errorf("expected bare return, got %#v", r)
+	}
+}
@@ -0,0 +1,233 @@
+package cabs
+
+import "unicode/utf8"
+
+// EvalConst evaluates an integer constant expression, such as an
+// enumerator value or an array size. Identifiers are looked up in consts,
+// the enumerators in scope. It reports false when the expression is not a
+// constant or its value is undefined, e.g. on division by zero.
+func EvalConst(e Expr, consts map[string]int64) (int64, bool) {
+	switch e := e.(type) {
+	case Constant:
+		return e.Value, true
+	case CharLiteral:
+		return e.IntValue(), true
+	case Variable:
+		v, ok := consts[e.Name]
+		return v, ok
+	case Paren:
+		return EvalConst(e.Expr, consts)
+	case Unary:
+		v, ok := EvalConst(e.Expr, consts)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case OpNeg:
+			return -v, true
+		case OpPlus:
+			return v, true
+		case OpBitNot:
+			return ^v, true
+		case OpNot:
+			return boolValue(v == 0), true
+		}
+	case Binary:
+		return evalBinary(e, consts)
+	case Conditional:
+		c, ok := EvalConst(e.Cond, consts)
+		if !ok {
+			return 0, false
+		}
+		if c != 0 {
+			return EvalConst(e.Then, consts)
+		}
+		return EvalConst(e.Else, consts)
+	case Cast:
+		v, ok := EvalConst(e.Expr, consts)
+		if !ok {
+			return 0, false
+		}
+		return castConst(e.TypeName, v)
+	}
+	return 0, false
+}
+
+// FoldConst replaces the constant subexpressions of e by their values, as
+// EvalConst computes them, leaving what must be computed at run time, e.g.
+// an array size that is not constant. The evaluator does not know the size
+// of types: sizeof, when not nil, gives the value of a SizeofType or
+// SizeofExpr, which is otherwise kept.
+func FoldConst(e Expr, consts map[string]int64, sizeof func(Expr) (int64, bool)) Expr {
+	if v, ok := EvalConst(e, consts); ok {
+		return Constant{Value: v}
+	}
+	var folded Expr
+	switch e := e.(type) {
+	case SizeofType, SizeofExpr:
+		if sizeof != nil {
+			if v, ok := sizeof(e); ok {
+				return Constant{Value: v}
+			}
+		}
+		return e
+	case Paren:
+		folded = Paren{Expr: FoldConst(e.Expr, consts, sizeof)}
+	case Unary:
+		switch e.Op {
+		case OpNeg, OpPlus, OpBitNot, OpNot:
+			folded = Unary{Op: e.Op, Expr: FoldConst(e.Expr, consts, sizeof)}
+		default:
+			return e // ++, --, & and * do not give constants
+		}
+	case Binary:
+		folded = Binary{Op: e.Op, Left: FoldConst(e.Left, consts, sizeof), Right: FoldConst(e.Right, consts, sizeof)}
+	case Conditional:
+		folded = Conditional{Cond: FoldConst(e.Cond, consts, sizeof), Then: FoldConst(e.Then, consts, sizeof), Else: FoldConst(e.Else, consts, sizeof)}
+	case Cast:
+		folded = Cast{TypeName: e.TypeName, Expr: FoldConst(e.Expr, consts, sizeof)}
+	default:
+		return e
+	}
+	if v, ok := EvalConst(folded, consts); ok {
+		return Constant{Value: v}
+	}
+	return folded
+}
+
+func evalBinary(e Binary, consts map[string]int64) (int64, bool) {
+	l, ok := EvalConst(e.Left, consts)
+	if !ok {
+		return 0, false
+	}
+	// && and || do not evaluate their right operand when the left decides
+	switch e.Op {
+	case OpAnd:
+		if l == 0 {
+			return 0, true
+		}
+	case OpOr:
+		if l != 0 {
+			return 1, true
+		}
+	}
+	r, ok := EvalConst(e.Right, consts)
+	if !ok {
+		return 0, false
+	}
+	switch e.Op {
+	case OpAdd:
+		return l + r, true
+	case OpSub:
+		return l - r, true
+	case OpMul:
+		return l * r, true
+	case OpDiv:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	case OpMod:
+		if r == 0 {
+			return 0, false
+		}
+		return l % r, true
+	case OpShl:
+		if r < 0 || r >= 64 {
+			return 0, false
+		}
+		return l << r, true
+	case OpShr:
+		if r < 0 || r >= 64 {
+			return 0, false
+		}
+		return l >> r, true
+	case OpBitAnd:
+		return l & r, true
+	case OpBitOr:
+		return l | r, true
+	case OpBitXor:
+		return l ^ r, true
+	case OpLt:
+		return boolValue(l < r), true
+	case OpLe:
+		return boolValue(l <= r), true
+	case OpGt:
+		return boolValue(l > r), true
+	case OpGe:
+		return boolValue(l >= r), true
+	case OpEq:
+		return boolValue(l == r), true
+	case OpNe:
+		return boolValue(l != r), true
+	case OpAnd, OpOr:
+		return boolValue(r != 0), true
+	case OpComma:
+		return r, true
+	}
+	return 0, false
+}
+
+// castConst converts a constant to an integer type, truncating it to the
+// width of the type
+func castConst(typeName string, v int64) (int64, bool) {
+	switch typeName {
+	case "char", "signed char":
+		return int64(int8(v)), true
+	case "unsigned char":
+		return int64(uint8(v)), true
+	case "_Bool":
+		return boolValue(v != 0), true
+	case "short", "signed short", "short int":
+		return int64(int16(v)), true
+	case "unsigned short", "unsigned short int":
+		return int64(uint16(v)), true
+	case "int", "signed", "signed int":
+		return int64(int32(v)), true
+	case "unsigned", "unsigned int":
+		return int64(uint32(v)), true
+	case "long", "long int", "unsigned long", "long long", "unsigned long long":
+		return v, true
+	}
+	return 0, false
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// IntValue returns the value of a character constant: the code of the
+// character, or of the escape sequence it spells
+func (c CharLiteral) IntValue() int64 {
+	if len(c.Value) == 0 {
+		return 0
+	}
+	if c.Value[0] == '\\' && len(c.Value) > 1 {
+		switch c.Value[1] {
+		case 'n':
+			return 10 // newline
+		case 't':
+			return 9 // tab
+		case 'r':
+			return 13 // carriage return
+		case '0':
+			return 0 // null
+		case '\\':
+			return 92 // backslash
+		case '\'':
+			return 39 // single quote
+		case '"':
+			return 34 // double quote
+		default:
+			return int64(c.Value[1])
+		}
+	}
+	if c.Encoding != "" && c.Encoding != "u8" {
+		r, _ := utf8.DecodeRuneInString(c.Value)
+		return int64(r)
+	}
+	return int64(c.Value[0])
+}
@@ -0,0 +1,73 @@
+package cabs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvalConst(t *testing.T) {
+	c := func(v int64) Expr { return Constant{Value: v} }
+	consts := map[string]int64{"N": 5}
+	tests := []struct {
+		name string
+		expr Expr
+		want int64
+	}{
+		{"negation", Unary{Op: OpNeg, Expr: c(1)}, -1},
+		{"enumerator", Binary{Op: OpAdd, Left: Variable{Name: "N"}, Right: c(2)}, 7},
+		{"character", CharLiteral{Value: "x"}, 120},
+		{"escape", CharLiteral{Value: `\n`}, 10},
+		{"shift and or", Binary{Op: OpBitOr, Left: Binary{Op: OpShl, Left: c(1), Right: c(4)}, Right: c(3)}, 19},
+		{"comparison", Binary{Op: OpLt, Left: c(2), Right: c(3)}, 1},
+		{"conditional", Conditional{Cond: c(0), Then: c(1), Else: c(2)}, 2},
+		{"short-circuit", Binary{Op: OpOr, Left: c(1), Right: Binary{Op: OpDiv, Left: c(1), Right: c(0)}}, 1},
+		{"cast truncates", Cast{TypeName: "unsigned char", Expr: c(300)}, 44},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := EvalConst(tt.expr, consts)
+			if !ok || got != tt.want {
+				t.Errorf("EvalConst = %d, %v; want %d", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalConstNotConstant(t *testing.T) {
+	for _, e := range []Expr{
+		Variable{Name: "x"},
+		Binary{Op: OpDiv, Left: Constant{Value: 1}, Right: Constant{Value: 0}},
+		Call{Func: Variable{Name: "f"}},
+		SizeofType{TypeName: "int"},
+	} {
+		if v, ok := EvalConst(e, nil); ok {
+			t.Errorf("EvalConst(%#v) = %d, expected not constant", e, v)
+		}
+	}
+}
+
+func TestFoldConst(t *testing.T) {
+	c := func(v int64) Expr { return Constant{Value: v} }
+	consts := map[string]int64{"N": 5}
+	sizeofInt := SizeofType{TypeName: "int"}
+	tests := []struct {
+		name   string
+		expr   Expr
+		sizeof func(Expr) (int64, bool)
+		want   Expr
+	}{
+		{"constant", Binary{Op: OpMul, Left: Variable{Name: "N"}, Right: c(2)}, nil, c(10)},
+		{"sizeof kept", Binary{Op: OpMul, Left: sizeofInt, Right: Paren{Expr: Variable{Name: "N"}}}, nil,
+			Binary{Op: OpMul, Left: sizeofInt, Right: c(5)}},
+		{"sizeof folded", Binary{Op: OpMul, Left: sizeofInt, Right: c(2)}, func(Expr) (int64, bool) { return 4, true }, c(8)},
+		{"runtime size", Binary{Op: OpAdd, Left: Variable{Name: "n"}, Right: Binary{Op: OpSub, Left: Variable{Name: "N"}, Right: c(1)}}, nil,
+			Binary{Op: OpAdd, Left: Variable{Name: "n"}, Right: c(4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FoldConst(tt.expr, consts, tt.sizeof); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FoldConst = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
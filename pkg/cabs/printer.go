@@ -26,6 +26,49 @@ func (p *Printer) PrintProgram(prog *Program) {
 	}
 }
 
+// ExprString spells an expression in C syntax.
+func ExprString(e Expr) string {
+	var sb strings.Builder
+	NewPrinter(&sb).printExpr(e)
+	return sb.String()
+}
+
+// QualifiedType spells typeSpec with its qualifiers, e.g. "const char* const".
+// Pointer qualifiers attach to the trailing '*'s of typeSpec.
+func QualifiedType(typeSpec string, q Qualifiers) string {
+	if len(q.Base) == 0 && len(q.Pointers) == 0 {
+		return typeSpec
+	}
+	base := strings.TrimRight(typeSpec, "*")
+	stars := len(typeSpec) - len(base)
+	// A function pointer, ret(*)(params), carries the qualifiers of its
+	// pointer in the parentheses: ret(* const)(params)
+	if i := strings.Index(typeSpec, "(*)"); i >= 0 && stars == 0 && len(q.Pointers) == 1 {
+		var sb strings.Builder
+		sb.WriteString(typeSpec[:i+2])
+		for _, qual := range q.Pointers[0] {
+			sb.WriteString(" " + qual.String())
+		}
+		sb.WriteString(typeSpec[i+2:])
+		return sb.String()
+	}
+
+	var sb strings.Builder
+	for _, qual := range q.Base {
+		sb.WriteString(qual.String() + " ")
+	}
+	sb.WriteString(base)
+	for i := 0; i < stars; i++ {
+		sb.WriteString("*")
+		if i < len(q.Pointers) {
+			for _, qual := range q.Pointers[i] {
+				sb.WriteString(" " + qual.String())
+			}
+		}
+	}
+	return sb.String()
+}
+
 func (p *Printer) writeIndent() {
 	fmt.Fprint(p.w, strings.Repeat("  ", p.indent))
 }
@@ -50,12 +93,22 @@ func (p *Printer) printDefinition(def Definition) {
 }
 
 func (p *Printer) printFunDef(f FunDef) {
+	if f.Attrs != (Attributes{}) {
+		p.printAttributes(f.Attrs)
+		fmt.Fprint(p.w, " ")
+	}
+	if f.StorageClass != "" {
+		fmt.Fprintf(p.w, "%s ", f.StorageClass)
+	}
+	if f.Inline {
+		fmt.Fprint(p.w, "inline ")
+	}
 	fmt.Fprintf(p.w, "%s %s(", f.ReturnType, f.Name)
 	for i, param := range f.Params {
 		if i > 0 {
 			fmt.Fprint(p.w, ", ")
 		}
-		fmt.Fprintf(p.w, "%s %s", param.TypeSpec, param.Name)
+		fmt.Fprintf(p.w, "%s %s", QualifiedType(param.TypeSpec, param.Quals), param.Name)
 	}
 	if f.Variadic {
 		if len(f.Params) > 0 {
@@ -117,11 +170,15 @@ func (p *Printer) printTypedefDef(t TypedefDef) {
 			fmt.Fprintf(p.w, "typedef %s %s;\n", t.TypeSpec, t.Name)
 		}
 	} else {
-		fmt.Fprintf(p.w, "typedef %s %s;\n", t.TypeSpec, t.Name)
+		fmt.Fprintf(p.w, "typedef %s %s;\n", QualifiedType(t.TypeSpec, t.Quals), t.Name)
 	}
 }
 
 func (p *Printer) printStructDef(s StructDef) {
+	if s.Fields == nil {
+		fmt.Fprintf(p.w, "struct %s;\n", s.Name)
+		return
+	}
 	if s.Name != "" {
 		fmt.Fprintf(p.w, "struct %s {\n", s.Name)
 	} else {
@@ -129,14 +186,22 @@ func (p *Printer) printStructDef(s StructDef) {
 	}
 	p.indent++
 	for _, field := range s.Fields {
-		p.writeIndent()
-		fmt.Fprintf(p.w, "%s %s;\n", field.TypeSpec, field.Name)
+		p.printField(field)
 	}
 	p.indent--
-	fmt.Fprintln(p.w, "};")
+	fmt.Fprint(p.w, "}")
+	if s.Attrs != (Attributes{}) {
+		fmt.Fprint(p.w, " ")
+		p.printAttributes(s.Attrs)
+	}
+	fmt.Fprintln(p.w, ";")
 }
 
 func (p *Printer) printUnionDef(u UnionDef) {
+	if u.Fields == nil {
+		fmt.Fprintf(p.w, "union %s;\n", u.Name)
+		return
+	}
 	if u.Name != "" {
 		fmt.Fprintf(p.w, "union %s {\n", u.Name)
 	} else {
@@ -144,11 +209,25 @@ func (p *Printer) printUnionDef(u UnionDef) {
 	}
 	p.indent++
 	for _, field := range u.Fields {
-		p.writeIndent()
-		fmt.Fprintf(p.w, "%s %s;\n", field.TypeSpec, field.Name)
+		p.printField(field)
 	}
 	p.indent--
-	fmt.Fprintln(p.w, "};")
+	fmt.Fprint(p.w, "}")
+	if u.Attrs != (Attributes{}) {
+		fmt.Fprint(p.w, " ")
+		p.printAttributes(u.Attrs)
+	}
+	fmt.Fprintln(p.w, ";")
+}
+
+func (p *Printer) printField(f StructField) {
+	p.writeIndent()
+	fmt.Fprintf(p.w, "%s %s", f.TypeSpec, f.Name)
+	if f.Attrs != (Attributes{}) {
+		fmt.Fprint(p.w, " ")
+		p.printAttributes(f.Attrs)
+	}
+	fmt.Fprintln(p.w, ";")
 }
 
 func (p *Printer) printEnumDef(e EnumDef) {
@@ -179,7 +258,7 @@ func (p *Printer) printVarDef(v VarDef) {
 	if v.StorageClass != "" {
 		fmt.Fprintf(p.w, "%s ", v.StorageClass)
 	}
-	fmt.Fprintf(p.w, "%s %s", v.TypeSpec, v.Name)
+	fmt.Fprintf(p.w, "%s %s", QualifiedType(v.TypeSpec, v.Quals), v.Name)
 	for _, dim := range v.ArrayDims {
 		fmt.Fprint(p.w, "[")
 		if dim != nil {
@@ -187,6 +266,10 @@ func (p *Printer) printVarDef(v VarDef) {
 		}
 		fmt.Fprint(p.w, "]")
 	}
+	if v.Attrs != (Attributes{}) {
+		fmt.Fprint(p.w, " ")
+		p.printAttributes(v.Attrs)
+	}
 	if v.Initializer != nil {
 		fmt.Fprint(p.w, " = ")
 		p.printExpr(v.Initializer)
@@ -194,6 +277,21 @@ func (p *Printer) printVarDef(v VarDef) {
 	fmt.Fprintln(p.w, ";")
 }
 
+// printAttributes prints the attributes as a single __attribute__ list.
+func (p *Printer) printAttributes(a Attributes) {
+	var list []string
+	if a.Packed {
+		list = append(list, "packed")
+	}
+	if a.Aligned != 0 {
+		list = append(list, fmt.Sprintf("aligned(%d)", a.Aligned))
+	}
+	if a.Section != "" {
+		list = append(list, fmt.Sprintf("section(\"%s\")", a.Section))
+	}
+	fmt.Fprintf(p.w, "__attribute__((%s))", strings.Join(list, ", "))
+}
+
 func (p *Printer) printBlock(b *Block) {
 	p.writeIndent()
 	fmt.Fprintln(p.w, "{")
@@ -295,6 +393,8 @@ func (p *Printer) printStmt(stmt Stmt) {
 		}
 		p.writeIndent()
 		fmt.Fprintln(p.w, "}")
+	case Skip:
+		fmt.Fprintln(p.w, ";")
 	case Goto:
 		fmt.Fprintf(p.w, "goto %s;\n", s.Label)
 	case Label:
@@ -312,8 +412,14 @@ func (p *Printer) printStmt(stmt Stmt) {
 		p.printBlock(s)
 		p.indent++
 	case DeclStmt:
+		if len(s.Decls) == 0 {
+			fmt.Fprintf(p.w, "%s;\n", s.TypeSpec)
+		}
 		for _, decl := range s.Decls {
-			fmt.Fprintf(p.w, "%s %s", decl.TypeSpec, decl.Name)
+			if decl.StorageClass != "" {
+				fmt.Fprintf(p.w, "%s ", decl.StorageClass)
+			}
+			fmt.Fprintf(p.w, "%s %s", QualifiedType(decl.TypeSpec, decl.Quals), decl.Name)
 			// Print array dimensions
 			for _, dim := range decl.ArrayDims {
 				fmt.Fprint(p.w, "[")
@@ -342,7 +448,7 @@ func (p *Printer) printDeclList(decls []Decl) {
 		if i > 0 {
 			fmt.Fprint(p.w, ", ")
 		}
-		fmt.Fprintf(p.w, "%s %s", decl.TypeSpec, decl.Name)
+		fmt.Fprintf(p.w, "%s %s", QualifiedType(decl.TypeSpec, decl.Quals), decl.Name)
 		for _, dim := range decl.ArrayDims {
 			fmt.Fprint(p.w, "[")
 			if dim != nil {
@@ -360,11 +466,20 @@ func (p *Printer) printDeclList(decls []Decl) {
 func (p *Printer) printExpr(expr Expr) {
 	switch e := expr.(type) {
 	case Constant:
-		fmt.Fprintf(p.w, "%d", e.Value)
+		switch e.Type {
+		case "unsigned int":
+			fmt.Fprintf(p.w, "%du", uint32(e.Value))
+		case "long":
+			fmt.Fprintf(p.w, "%dL", e.Value)
+		case "unsigned long":
+			fmt.Fprintf(p.w, "%dUL", uint64(e.Value))
+		default:
+			fmt.Fprintf(p.w, "%d", e.Value)
+		}
 	case StringLiteral:
-		fmt.Fprintf(p.w, "\"%s\"", e.Value)
+		fmt.Fprintf(p.w, "%s\"%s\"", e.Encoding, e.Value)
 	case CharLiteral:
-		fmt.Fprintf(p.w, "'%s'", e.Value)
+		fmt.Fprintf(p.w, "%s'%s'", e.Encoding, e.Value)
 	case Variable:
 		fmt.Fprint(p.w, e.Name)
 	case Unary:
@@ -412,6 +527,40 @@ func (p *Printer) printExpr(expr Expr) {
 	case Cast:
 		fmt.Fprintf(p.w, "(%s)", e.TypeName)
 		p.printExpr(e.Expr)
+	case VaArg:
+		fmt.Fprint(p.w, "__builtin_va_arg(")
+		p.printExpr(e.Expr)
+		fmt.Fprintf(p.w, ", %s)", e.TypeName)
+	case StmtExpr:
+		fmt.Fprintln(p.w, "({")
+		p.indent++
+		for _, stmt := range e.Block.Items {
+			p.printStmt(stmt)
+		}
+		if e.Result != nil {
+			p.writeIndent()
+			p.printExpr(e.Result)
+			fmt.Fprintln(p.w, ";")
+		}
+		p.indent--
+		p.writeIndent()
+		fmt.Fprint(p.w, "})")
+	case InitList:
+		fmt.Fprint(p.w, "{")
+		for i, item := range e.Items {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			p.printExpr(item)
+		}
+		fmt.Fprint(p.w, "}")
+	case Designated:
+		if e.Last != e.Index {
+			fmt.Fprintf(p.w, "[%d ... %d] = ", e.Index, e.Last)
+		} else {
+			fmt.Fprintf(p.w, "[%d] = ", e.Index)
+		}
+		p.printExpr(e.Value)
 	default:
 		fmt.Fprintf(p.w, "/* unknown expr %T */", expr)
 	}
@@ -3,7 +3,10 @@
 // This mirrors CompCert's Clight.v
 package clight
 
-import "github.com/raymyers/ralph-cc/pkg/ctypes"
+import (
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+)
 
 // Node is the base interface for all Clight AST nodes
 type Node interface {
@@ -123,8 +126,9 @@ type Etempvar struct {
 
 // Ederef represents pointer dereference (*p)
 type Ederef struct {
-	Ptr Expr
-	Typ ctypes.Type
+	Ptr      Expr
+	Typ      ctypes.Type
+	Volatile bool // the pointed-to object is volatile-qualified
 }
 
 // Eaddrof represents address-of operator (&x)
@@ -159,6 +163,7 @@ type Efield struct {
 	Arg       Expr
 	FieldName string
 	Typ       ctypes.Type
+	Volatile  bool // the accessed struct is volatile-qualified
 }
 
 // Esizeof represents sizeof(type)
@@ -174,6 +179,10 @@ type Ealignof struct {
 }
 
 // --- Statements ---
+//
+// The statements that may be the subject of a diagnostic carry the
+// position of the source statement they come from, the zero position for
+// statements made up by the compiler.
 
 // Sskip represents an empty statement
 type Sskip struct{}
@@ -182,12 +191,14 @@ type Sskip struct{}
 type Sassign struct {
 	LHS Expr // must be an l-value (Evar, Ederef, or Efield)
 	RHS Expr
+	Pos diag.Pos
 }
 
 // Sset represents an assignment to a temporary: temp = expr
 type Sset struct {
 	TempID int
 	RHS    Expr
+	Pos    diag.Pos
 }
 
 // Scall represents a function call as a statement
@@ -196,6 +207,7 @@ type Scall struct {
 	Result *int // temporary ID for result, nil for void calls
 	Func   Expr // function to call
 	Args   []Expr
+	Pos    diag.Pos
 }
 
 // Sbuiltin represents a call to a builtin function
@@ -203,6 +215,7 @@ type Sbuiltin struct {
 	Result  *int // temporary ID for result, nil for void
 	Builtin string
 	Args    []Expr
+	Pos     diag.Pos
 }
 
 // Ssequence represents a sequence of two statements
@@ -216,6 +229,7 @@ type Sifthenelse struct {
 	Cond Expr
 	Then Stmt
 	Else Stmt // Sskip for no else
+	Pos  diag.Pos
 }
 
 // Sloop represents infinite loop: loop { body; continue; }
@@ -226,14 +240,19 @@ type Sloop struct {
 }
 
 // Sbreak represents breaking out of a loop
-type Sbreak struct{}
+type Sbreak struct {
+	Pos diag.Pos
+}
 
 // Scontinue represents continuing to next iteration
-type Scontinue struct{}
+type Scontinue struct {
+	Pos diag.Pos
+}
 
 // Sreturn represents returning from a function
 type Sreturn struct {
 	Value Expr // nil for void return
+	Pos   diag.Pos
 }
 
 // Sswitch represents a switch statement
@@ -242,6 +261,7 @@ type Sswitch struct {
 	Cases    []SwitchCase
 	Default  Stmt // default case body
 	HasBreak bool // if false, fall-through semantics
+	Pos      diag.Pos
 }
 
 // SwitchCase represents a case in a switch statement
@@ -254,20 +274,25 @@ type SwitchCase struct {
 type Slabel struct {
 	Label string
 	Stmt  Stmt
+	Pos   diag.Pos
 }
 
 // Sgoto represents a goto statement
 type Sgoto struct {
 	Label string
+	Pos   diag.Pos
 }
 
 // --- Functions and Programs ---
 
 // VarDecl represents a variable declaration
 type VarDecl struct {
-	Name string
-	Type ctypes.Type
-	Init []byte // Optional initial value
+	Name   string
+	Type   ctypes.Type
+	Quals  ctypes.Qualifiers // const/volatile per pointer level, nil if none
+	Init   []byte            // Optional initial value
+	Extern bool              // a global defined in another unit: referenced, not emitted
+	Static bool              // a global declared static: not visible outside the translation unit
 }
 
 // Function represents a function definition in Clight
@@ -278,6 +303,7 @@ type Function struct {
 	Locals   []VarDecl // local variables (in memory)
 	Temps    []ctypes.Type // temporary variables (in registers)
 	Body     Stmt
+	Static   bool // declared static: not visible outside the translation unit
 }
 
 // Program represents a complete Clight program
@@ -384,3 +410,87 @@ func Seq(stmts ...Stmt) Stmt {
 	}
 	return result
 }
+
+// WithPos sets the position of s, and of the statements within it, to pos
+// where they have none yet. A source statement lowered to several Clight
+// statements is stamped once with its position as a whole, after the
+// statements nested in it got their own.
+func WithPos(s Stmt, pos diag.Pos) Stmt {
+	switch s := s.(type) {
+	case Sassign:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Sset:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Scall:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Sbuiltin:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Ssequence:
+		s.First = WithPos(s.First, pos)
+		s.Second = WithPos(s.Second, pos)
+		return s
+	case Sifthenelse:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		s.Then = WithPos(s.Then, pos)
+		s.Else = WithPos(s.Else, pos)
+		return s
+	case Sloop:
+		s.Body = WithPos(s.Body, pos)
+		s.Continue = WithPos(s.Continue, pos)
+		return s
+	case Sbreak:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Scontinue:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Sreturn:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	case Sswitch:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		cases := make([]SwitchCase, len(s.Cases))
+		for i, c := range s.Cases {
+			cases[i] = SwitchCase{Value: c.Value, Body: WithPos(c.Body, pos)}
+		}
+		s.Cases = cases
+		if s.Default != nil {
+			s.Default = WithPos(s.Default, pos)
+		}
+		return s
+	case Slabel:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		s.Stmt = WithPos(s.Stmt, pos)
+		return s
+	case Sgoto:
+		if s.Pos == (diag.Pos{}) {
+			s.Pos = pos
+		}
+		return s
+	}
+	return s // nil and skip
+}
@@ -12,13 +12,27 @@ import (
 // Printer outputs the Clight AST in a human-readable format
 // matching CompCert's .light.c output style
 type Printer struct {
-	w      io.Writer
-	indent int
+	w        io.Writer
+	indent   int
+	tempBase int // the number printed for temporary 1
 }
 
 // NewPrinter creates a new Clight AST printer
 func NewPrinter(w io.Writer) *Printer {
-	return &Printer{w: w, indent: 0}
+	return &Printer{w: w, indent: 0, tempBase: 1}
+}
+
+// SetTempBase makes the printer number the temporaries of each function
+// from base instead of 1. CompCert's temporaries are identifiers,
+// numbered after those of the program, so its dumps start them at a base
+// such as $128.
+func (p *Printer) SetTempBase(base int) {
+	p.tempBase = base
+}
+
+// temp returns the number printed for temporary id
+func (p *Printer) temp(id int) int {
+	return id - 1 + p.tempBase
 }
 
 // PrintProgram prints a complete Clight program
@@ -37,6 +51,9 @@ func (p *Printer) PrintProgram(prog *Program) {
 
 	// Print global variables
 	for _, g := range prog.Globals {
+		if g.Extern {
+			fmt.Fprint(p.w, "extern ")
+		}
 		fmt.Fprintf(p.w, "%s %s;\n", g.Type.String(), g.Name)
 	}
 	if len(prog.Globals) > 0 {
@@ -89,7 +106,7 @@ func (p *Printer) printFunction(fn *Function) {
 	// Print temporary variables
 	for i, typ := range fn.Temps {
 		p.writeIndent()
-		fmt.Fprintf(p.w, "%s $%d;\n", typ.String(), i+1)
+		fmt.Fprintf(p.w, "%s $%d;\n", typ.String(), p.temp(i+1))
 	}
 
 	if len(fn.Locals) > 0 || len(fn.Temps) > 0 {
@@ -122,14 +139,14 @@ func (p *Printer) printStmt(stmt Stmt) {
 
 	case Sset:
 		p.writeIndent()
-		fmt.Fprintf(p.w, "$%d = ", s.TempID)
+		fmt.Fprintf(p.w, "$%d = ", p.temp(s.TempID))
 		p.printExpr(s.RHS)
 		fmt.Fprintln(p.w, ";")
 
 	case Scall:
 		p.writeIndent()
 		if s.Result != nil {
-			fmt.Fprintf(p.w, "$%d = ", *s.Result)
+			fmt.Fprintf(p.w, "$%d = ", p.temp(*s.Result))
 		}
 		p.printExpr(s.Func)
 		fmt.Fprint(p.w, "(")
@@ -144,7 +161,7 @@ func (p *Printer) printStmt(stmt Stmt) {
 	case Sbuiltin:
 		p.writeIndent()
 		if s.Result != nil {
-			fmt.Fprintf(p.w, "$%d = ", *s.Result)
+			fmt.Fprintf(p.w, "$%d = ", p.temp(*s.Result))
 		}
 		fmt.Fprintf(p.w, "__builtin_%s(", s.Builtin)
 		for i, arg := range s.Args {
@@ -259,7 +276,7 @@ func (p *Printer) printExpr(expr Expr) {
 		fmt.Fprint(p.w, e.Name)
 
 	case Etempvar:
-		fmt.Fprintf(p.w, "$%d", e.ID)
+		fmt.Fprintf(p.w, "$%d", p.temp(e.ID))
 
 	case Ederef:
 		fmt.Fprint(p.w, "*")
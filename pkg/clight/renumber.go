@@ -0,0 +1,137 @@
+package clight
+
+import "github.com/raymyers/ralph-cc/pkg/ctypes"
+
+// RenumberTemps returns a copy of fn whose temporaries are numbered from 1
+// in the order they first appear in its body, as its dump reads. Two dumps
+// that create the same temporaries in a different order, as ralph-cc and
+// CompCert do, then number them alike. The temporaries the body does not
+// use come last, in their original order.
+func RenumberTemps(fn Function) Function {
+	r := &renumbering{ids: make(map[int]int)}
+	fn.Body = r.stmt(fn.Body)
+	for id := 1; id <= len(fn.Temps); id++ {
+		r.id(id)
+	}
+	temps := make([]ctypes.Type, len(fn.Temps))
+	for old, id := range r.ids {
+		if old >= 1 && old <= len(fn.Temps) && id <= len(temps) {
+			temps[id-1] = fn.Temps[old-1]
+		}
+	}
+	fn.Temps = temps
+	return fn
+}
+
+// renumbering maps the temporaries of a function to their new numbers,
+// given in order of first use
+type renumbering struct {
+	ids map[int]int
+}
+
+func (r *renumbering) id(old int) int {
+	id, ok := r.ids[old]
+	if !ok {
+		id = len(r.ids) + 1
+		r.ids[old] = id
+	}
+	return id
+}
+
+func (r *renumbering) result(old *int) *int {
+	if old == nil {
+		return nil
+	}
+	id := r.id(*old)
+	return &id
+}
+
+func (r *renumbering) stmt(s Stmt) Stmt {
+	switch s := s.(type) {
+	case Sassign:
+		s.LHS = r.expr(s.LHS)
+		s.RHS = r.expr(s.RHS)
+		return s
+	case Sset:
+		s.TempID = r.id(s.TempID)
+		s.RHS = r.expr(s.RHS)
+		return s
+	case Scall:
+		s.Result = r.result(s.Result)
+		s.Func = r.expr(s.Func)
+		s.Args = r.exprs(s.Args)
+		return s
+	case Sbuiltin:
+		s.Result = r.result(s.Result)
+		s.Args = r.exprs(s.Args)
+		return s
+	case Ssequence:
+		s.First = r.stmt(s.First)
+		s.Second = r.stmt(s.Second)
+		return s
+	case Sifthenelse:
+		s.Cond = r.expr(s.Cond)
+		s.Then = r.stmt(s.Then)
+		s.Else = r.stmt(s.Else)
+		return s
+	case Sloop:
+		s.Body = r.stmt(s.Body)
+		s.Continue = r.stmt(s.Continue)
+		return s
+	case Sreturn:
+		s.Value = r.expr(s.Value)
+		return s
+	case Sswitch:
+		s.Expr = r.expr(s.Expr)
+		cases := make([]SwitchCase, len(s.Cases))
+		for i, c := range s.Cases {
+			cases[i] = SwitchCase{Value: c.Value, Body: r.stmt(c.Body)}
+		}
+		s.Cases = cases
+		s.Default = r.stmt(s.Default)
+		return s
+	case Slabel:
+		s.Stmt = r.stmt(s.Stmt)
+		return s
+	}
+	return s // nil, skip, break, continue and goto
+}
+
+func (r *renumbering) exprs(exprs []Expr) []Expr {
+	if exprs == nil {
+		return nil
+	}
+	result := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		result[i] = r.expr(e)
+	}
+	return result
+}
+
+func (r *renumbering) expr(e Expr) Expr {
+	switch e := e.(type) {
+	case Etempvar:
+		e.ID = r.id(e.ID)
+		return e
+	case Ederef:
+		e.Ptr = r.expr(e.Ptr)
+		return e
+	case Eaddrof:
+		e.Arg = r.expr(e.Arg)
+		return e
+	case Eunop:
+		e.Arg = r.expr(e.Arg)
+		return e
+	case Ebinop:
+		e.Left = r.expr(e.Left)
+		e.Right = r.expr(e.Right)
+		return e
+	case Ecast:
+		e.Arg = r.expr(e.Arg)
+		return e
+	case Efield:
+		e.Arg = r.expr(e.Arg)
+		return e
+	}
+	return e // nil, constants, strings, variables, sizeof and alignof
+}
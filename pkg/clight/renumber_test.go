@@ -0,0 +1,86 @@
+package clight
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+// tempsFunction uses its temporaries out of their numbering order: $3,
+// then $1, then $2 in a call result; $4 is never used
+func tempsFunction() Function {
+	three := 2
+	return Function{
+		Name:   "f",
+		Return: ctypes.Int(),
+		Temps:  []ctypes.Type{ctypes.Long(), ctypes.Int(), ctypes.Double(), ctypes.Float()},
+		Body: Seq(
+			Sset{TempID: 3, RHS: Econst_float{Value: 1.5, Typ: ctypes.Double()}},
+			Sset{TempID: 1, RHS: Ecast{Arg: Etempvar{ID: 3, Typ: ctypes.Double()}, Typ: ctypes.Long()}},
+			Scall{Result: &three, Func: Evar{Name: "g", Typ: ctypes.Int()}, Args: []Expr{Etempvar{ID: 1, Typ: ctypes.Long()}}},
+			Sreturn{Value: Etempvar{ID: 2, Typ: ctypes.Int()}},
+		),
+	}
+}
+
+func TestRenumberTemps(t *testing.T) {
+	fn := RenumberTemps(tempsFunction())
+
+	var buf bytes.Buffer
+	NewPrinter(&buf).printFunction(&fn)
+	want := `int f()
+{
+  double $1;
+  long $2;
+  int $3;
+  float $4;
+
+  $1 = 1.5;
+  $2 = (long)$1;
+  $3 = g($2);
+  return $3;
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected renumbering\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestRenumberTemps_Stable(t *testing.T) {
+	print := func(fn Function) string {
+		var buf bytes.Buffer
+		NewPrinter(&buf).printFunction(&fn)
+		return buf.String()
+	}
+
+	// Renumbering leaves the original alone and is its own fixed point
+	original := tempsFunction()
+	before := print(original)
+	once := RenumberTemps(original)
+	if print(original) != before {
+		t.Errorf("expected the original function to be unchanged")
+	}
+	if twice := RenumberTemps(once); print(twice) != print(once) {
+		t.Errorf("expected renumbering twice to be the same as once\n%s\n%s", print(once), print(twice))
+	}
+}
+
+func TestPrinter_SetTempBase(t *testing.T) {
+	fn := RenumberTemps(tempsFunction())
+
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.SetTempBase(128)
+	p.printFunction(&fn)
+	got := buf.String()
+	for _, want := range []string{"double $128;", "float $131;", "$129 = (long)$128;", "$130 = g($129);", "return $130;"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "$1;") {
+		t.Errorf("expected no temporary numbered from 1, got\n%s", got)
+	}
+}
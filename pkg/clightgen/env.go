@@ -0,0 +1,236 @@
+package clightgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raymyers/ralph-cc/pkg/cabs"
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+	"github.com/raymyers/ralph-cc/pkg/simplexpr"
+)
+
+// typeEnv is the file-scope environment of a translation unit: the struct
+// and union definitions, typedefs and global declarations. It is collected
+// before any function is translated, so that every declaration resolves to
+// its underlying type rather than the int default of an unknown name.
+type typeEnv struct {
+	structs      []ctypes.Tstruct
+	unions       []ctypes.Tunion
+	typedefs     map[string]ctypes.Type
+	typedefQuals map[string]cabs.Qualifiers // qualifiers of each typedef, typedefs they name included
+	enums        map[string]int64           // values of the enumerators
+	globals      map[string]ctypes.Type
+	types        *simplexpr.Transformer // resolves type names against the definitions so far
+	blockGlobals []clight.VarDecl       // globals declared in function bodies, see localDecls
+	charSign     ctypes.Signedness      // signedness of plain char
+	diags        *diag.Emitter          // receives the errors in static initializers
+}
+
+func newTypeEnv(opts Options) *typeEnv {
+	env := &typeEnv{
+		typedefs:     make(map[string]ctypes.Type),
+		typedefQuals: make(map[string]cabs.Qualifiers),
+		enums:        make(map[string]int64),
+		globals:      make(map[string]ctypes.Type),
+		types:        simplexpr.New(),
+		charSign:     opts.CharSign,
+		diags:        opts.Diags,
+	}
+	env.types.SetPlainCharSign(opts.CharSign)
+	return env
+}
+
+// typeOf resolves a type specifier in the environment.
+func (env *typeEnv) typeOf(typeSpec string) ctypes.Type {
+	return env.types.TypeOf(typeSpec)
+}
+
+func (env *typeEnv) defineStruct(s ctypes.Tstruct) {
+	env.structs = append(env.structs, s)
+	env.types.SetStructDef(s)
+}
+
+func (env *typeEnv) defineUnion(u ctypes.Tunion) {
+	env.unions = append(env.unions, u)
+	env.types.SetUnionDef(u)
+}
+
+// defineEnum records the values of the enumerators of an enum definition,
+// which the parser computed.
+func (env *typeEnv) defineEnum(d cabs.EnumDef) {
+	for _, v := range d.Values {
+		env.enums[v.Name] = v.Num
+	}
+}
+
+func (env *typeEnv) defineTypedef(name string, typ ctypes.Type) {
+	env.typedefs[name] = typ
+	env.types.SetTypedef(name, typ)
+}
+
+// qualifiers returns the per-level qualifiers of a declaration of type
+// typeSpec qualified by quals, those of a typedef it names included.
+func (env *typeEnv) qualifiers(typeSpec string, quals cabs.Qualifiers) ctypes.Qualifiers {
+	return qualifiersFromCabs(env.expandQualifiers(typeSpec, quals))
+}
+
+// expandQualifiers returns quals with the qualifiers of the typedef that
+// typeSpec names, if any, below them: the base qualifiers of quals apply
+// to the outermost level of the typedef, so with
+// typedef void (*const handler_t)(int); the declaration handler_t *p
+// points to a const pointer.
+func (env *typeEnv) expandQualifiers(typeSpec string, quals cabs.Qualifiers) cabs.Qualifiers {
+	typedef, ok := env.typedefQuals[strings.TrimSpace(strings.TrimRight(typeSpec, "*"))]
+	if !ok || len(typedef.Base) == 0 && len(typedef.Pointers) == 0 {
+		return quals
+	}
+	result := cabs.Qualifiers{
+		Base:     append([]cabs.TypeQualifier(nil), typedef.Base...),
+		Pointers: append([][]cabs.TypeQualifier(nil), typedef.Pointers...),
+	}
+	if n := len(result.Pointers); n > 0 {
+		result.Pointers[n-1] = append(append([]cabs.TypeQualifier(nil), result.Pointers[n-1]...), quals.Base...)
+	} else {
+		result.Base = append(result.Base, quals.Base...)
+	}
+	result.Pointers = append(result.Pointers, quals.Pointers...)
+	return result
+}
+
+// declare registers the environment in the transformer of a function.
+func (env *typeEnv) declare(simplExpr *simplexpr.Transformer) {
+	simplExpr.SetPlainCharSign(env.charSign)
+	for _, s := range env.structs {
+		simplExpr.SetStructDef(s)
+	}
+	for _, u := range env.unions {
+		simplExpr.SetUnionDef(u)
+	}
+	for name, typ := range env.typedefs {
+		simplExpr.SetTypedef(name, typ)
+	}
+	for name, typ := range env.globals {
+		simplExpr.SetType(name, typ)
+	}
+}
+
+// collectTypes is the pre-pass over the file-scope definitions that fills
+// the environment: struct and union definitions, typedefs and the types
+// of global variables and functions. Definitions are visited in order, so
+// a typedef resolves against the structs and typedefs before it.
+func collectTypes(prog *cabs.Program, opts Options, result *clight.Program) *typeEnv {
+	env := newTypeEnv(opts)
+	for _, def := range prog.Definitions {
+		switch d := def.(type) {
+		case cabs.StructDef:
+			env.defineRecord(d, "", result)
+		case cabs.UnionDef:
+			env.defineRecord(d, "", result)
+		case cabs.EnumDef:
+			env.defineEnum(d)
+		case cabs.TypedefDef:
+			env.defineTypedef(d.Name, env.typedefType(d, result))
+			env.typedefQuals[d.Name] = env.expandQualifiers(d.TypeSpec, d.Quals)
+		case cabs.VarDef:
+			typ := env.typeOf(d.TypeSpec)
+			if d.Typeof != nil {
+				typ = env.types.TypeofType(d.Typeof, d.TypeSpec)
+			}
+			env.globals[d.Name] = completeArrayType(arrayType(typ, d.ArrayDims, env.types), d.Initializer, env.types)
+			env.types.SetType(d.Name, env.globals[d.Name])
+		case cabs.FunDef:
+			// Function types give calls their argument conversions
+			var paramTypes []ctypes.Type
+			for _, p := range d.Params {
+				paramTypes = append(paramTypes, env.typeOf(p.TypeSpec))
+			}
+			env.globals[d.Name] = ctypes.Tfunction{
+				Params: paramTypes,
+				Return: env.typeOf(d.ReturnType),
+				VarArg: d.Variadic,
+			}
+		}
+	}
+	return env
+}
+
+// defineRecord adds a struct or union definition to the environment and
+// the program, skipping forward declarations so they cannot replace the
+// definition. An anonymous definition is named after the typedef that
+// introduces it. It returns the type the definition names.
+func (env *typeEnv) defineRecord(def cabs.Definition, typedefName string, result *clight.Program) ctypes.Type {
+	switch d := def.(type) {
+	case cabs.StructDef:
+		name := d.Name
+		if name == "" {
+			name = typedefName
+		}
+		if d.Fields == nil {
+			return ctypes.Tstruct{Name: name}
+		}
+		s := ctypes.Tstruct{
+			Name:   name,
+			Fields: env.fields(d.Fields),
+			Packed: d.Attrs.Packed,
+			Align:  d.Attrs.Aligned,
+		}
+		result.Structs = append(result.Structs, s)
+		env.defineStruct(s)
+		return s
+	case cabs.UnionDef:
+		name := d.Name
+		if name == "" {
+			name = typedefName
+		}
+		if d.Fields == nil {
+			return ctypes.Tunion{Name: name}
+		}
+		u := ctypes.Tunion{
+			Name:   name,
+			Fields: env.fields(d.Fields),
+			Packed: d.Attrs.Packed,
+			Align:  d.Attrs.Aligned,
+		}
+		result.Unions = append(result.Unions, u)
+		env.defineUnion(u)
+		return u
+	case cabs.EnumDef:
+		env.defineEnum(d)
+	}
+	return ctypes.Int() // enumerations
+}
+
+// fields returns the fields of a struct or union definition. An anonymous
+// member is given the name "$anon" and its index, which no C identifier
+// can clash with, for the member accesses it carries to refer to.
+func (env *typeEnv) fields(fields []cabs.StructField) []ctypes.Field {
+	result := make([]ctypes.Field, len(fields))
+	for i, f := range fields {
+		result[i] = ctypes.Field{
+			Name:  f.Name,
+			Type:  env.structFieldType(f),
+			Align: f.Attrs.Aligned,
+		}
+		if f.Name == "" {
+			result[i].Name = fmt.Sprintf("$anon%d", i)
+			result[i].Anonymous = true
+		}
+	}
+	return result
+}
+
+// typedefType returns the underlying type of a typedef. With an inline
+// definition, typedef struct { ... } *name; the type specifier only holds
+// the pointers applied to the defined type.
+func (env *typeEnv) typedefType(d cabs.TypedefDef, result *clight.Program) ctypes.Type {
+	if d.InlineType == nil {
+		return env.typeOf(d.TypeSpec)
+	}
+	typ := env.defineRecord(d.InlineType, d.Name, result)
+	for i := 0; i < strings.Count(d.TypeSpec, "*"); i++ {
+		typ = ctypes.Pointer(typ)
+	}
+	return typ
+}
@@ -0,0 +1,362 @@
+package clightgen
+
+import (
+	"math"
+
+	"github.com/raymyers/ralph-cc/pkg/cabs"
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/cshmgen"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+	"github.com/raymyers/ralph-cc/pkg/simplexpr"
+)
+
+// transformDeclInit returns the statements that initialize a local
+// declaration, or nil if it has no initializer. A static local is
+// initialized once, in the data of its hidden global, and an extern one
+// cannot be initialized.
+func transformDeclInit(decl cabs.Decl, simplExpr *simplexpr.Transformer) []clight.Stmt {
+	if decl.Initializer == nil || decl.StorageClass == "static" || decl.StorageClass == "extern" {
+		return nil
+	}
+	typ := simplExpr.GetType(decl.Name)
+	if list, ok := arrayInit(typ, decl.Initializer, simplExpr).(cabs.InitList); ok {
+		var stmts []clight.Stmt
+		for _, a := range initializeAggregate(cabs.Variable{Name: decl.Name}, typ, list, simplExpr) {
+			lhs := simplExpr.TransformExpr(a.Left)
+			rhs := simplExpr.TransformExpr(a.Right)
+			stmts = append(stmts, lhs.Stmts...)
+			stmts = append(stmts, rhs.Stmts...)
+			stmts = append(stmts, clight.Sassign{
+				LHS: lhs.Expr,
+				RHS: coerceToType(rhs.Expr, lhs.Expr.ExprType()),
+			})
+		}
+		return stmts
+	}
+	result := simplExpr.TransformExpr(decl.Initializer)
+	return append(result.Stmts, clight.Sassign{
+		LHS: clight.Evar{Name: decl.Name, Typ: typ},
+		RHS: coerceToType(result.Expr, typ),
+	})
+}
+
+// initializeAggregate returns the assignments that initialize the object
+// lv of type typ from an initializer list, one per scalar subobject in
+// memory order unless designators name elements out of order. Subobjects
+// without an initializer are set to zero.
+func initializeAggregate(lv cabs.Expr, typ ctypes.Type, list cabs.InitList, simplExpr *simplexpr.Transformer) []cabs.Binary {
+	if !isAggregateType(typ) {
+		// A scalar may be initialized by a braced value: int x = {1};
+		var value cabs.Expr = cabs.Constant{Value: 0}
+		if len(list.Items) > 0 {
+			value = scalarInit(list.Items[0])
+		}
+		return []cabs.Binary{assign(lv, value)}
+	}
+	init := &initializer{items: list.Items, simplExpr: simplExpr}
+	init.fill(lv, typ)
+	return init.assigns
+}
+
+// staticInit returns the data of a global or static local of type typ
+// initialized by init. An initializer list gives every scalar of the
+// object its value at its offset, zero for those it leaves out. Each value
+// must be an integer constant expression: an item that is not, as an
+// address, which the data cannot hold, is reported at pos.
+func (env *typeEnv) staticInit(name string, pos diag.Pos, typ ctypes.Type, init cabs.Expr) []byte {
+	list, ok := arrayInit(typ, init, env.types).(cabs.InitList)
+	if !ok {
+		return evaluateConstantInitializer(init, typ)
+	}
+	typ = env.resolve(typ)
+	data := make([]byte, cshmgen.Sizeof(typ))
+	for _, a := range initializeAggregate(cabs.Variable{}, typ, list, env.types) {
+		value, ok := cabs.FoldConst(a.Right, env.enums, sizeofFolder(env.types)).(cabs.Constant)
+		if !ok {
+			env.diags.Errorf(pos, "initializer", "initializer element of '%s' is not an integer constant", name)
+			return nil
+		}
+		offset, scalar := env.subobject(a.Left, typ)
+		storeScalar(data[offset:], scalar, value.Value)
+	}
+	return data
+}
+
+// subobject returns the offset and type of the subobject lv of an object
+// of type typ, lv being a path of constant subscripts and members from
+// the object, as initializeAggregate builds.
+func (env *typeEnv) subobject(lv cabs.Expr, typ ctypes.Type) (int64, ctypes.Type) {
+	switch e := lv.(type) {
+	case cabs.Index:
+		offset, t := env.subobject(e.Array, typ)
+		elem := env.resolve(t.(ctypes.Tarray).Elem)
+		return offset + e.Index.(cabs.Constant).Value*cshmgen.Sizeof(elem), elem
+	case cabs.Member:
+		offset, t := env.subobject(e.Expr, typ)
+		var fields []ctypes.Field
+		switch r := t.(type) {
+		case ctypes.Tstruct:
+			fields = r.Fields
+		case ctypes.Tunion:
+			fields = r.Fields
+		}
+		for _, f := range fields {
+			if f.Name == e.Name {
+				return offset + cshmgen.FieldOffset(t, f.Name), env.resolve(f.Type)
+			}
+		}
+	}
+	return 0, typ
+}
+
+// resolve returns a struct or union type with the fields of its
+// definition, and other types as they are.
+func (env *typeEnv) resolve(t ctypes.Type) ctypes.Type {
+	switch r := t.(type) {
+	case ctypes.Tstruct:
+		return env.types.ResolveStruct(r)
+	case ctypes.Tunion:
+		return env.types.ResolveUnion(r)
+	}
+	return t
+}
+
+// storeScalar stores value, converted to the scalar type typ, in the
+// first bytes of data, little-endian.
+func storeScalar(data []byte, typ ctypes.Type, value int64) {
+	bits := uint64(value)
+	switch t := typ.(type) {
+	case ctypes.Tfloat:
+		if t.Size == ctypes.F32 {
+			bits = uint64(math.Float32bits(float32(value)))
+		} else {
+			bits = math.Float64bits(float64(value))
+		}
+	case ctypes.Tint:
+		if t.Size == ctypes.IBool && value != 0 {
+			bits = 1
+		}
+	}
+	for i := int64(0); i < cshmgen.Sizeof(typ); i++ {
+		data[i] = byte(bits >> (8 * i))
+	}
+}
+
+// completeArrayType returns typ with the size of an array of unknown size,
+// as int a[], taken from its initializer: the number of elements the
+// initializer list fills (C11 6.7.9p22). Other types are returned as is.
+func completeArrayType(typ ctypes.Type, init cabs.Expr, simplExpr *simplexpr.Transformer) ctypes.Type {
+	arr, ok := typ.(ctypes.Tarray)
+	if !ok || arr.Size >= 0 {
+		return typ
+	}
+	list, ok := arrayInit(typ, init, simplExpr).(cabs.InitList)
+	if !ok {
+		return typ
+	}
+	in := &initializer{items: list.Items, simplExpr: simplExpr}
+	arr.Size = in.fillArray(cabs.Variable{}, arr.Elem, -1)
+	return arr
+}
+
+// arrayInit returns the initializer of an object of type typ, with a
+// string literal that initializes a character array, braced or not,
+// replaced by the list of its characters and the null ending them
+// (C11 6.7.9p14). Any other initializer is returned as is.
+func arrayInit(typ ctypes.Type, init cabs.Expr, simplExpr *simplexpr.Transformer) cabs.Expr {
+	arr, ok := typ.(ctypes.Tarray)
+	if !ok {
+		return init
+	}
+	str, ok := init.(cabs.StringLiteral)
+	if list, braced := init.(cabs.InitList); braced && len(list.Items) == 1 {
+		str, ok = list.Items[0].(cabs.StringLiteral)
+	}
+	if !ok {
+		return init
+	}
+	lit := simplExpr.TransformExpr(str).Expr.(clight.Estring)
+	charTyp := lit.Typ.(ctypes.Tarray).Elem
+	if _, isInt := arr.Elem.(ctypes.Tint); !isInt || SizeofType(arr.Elem) != SizeofType(charTyp) {
+		return init
+	}
+	size := int(SizeofType(charTyp))
+	var items []cabs.Expr
+	for i := 0; i+size <= len(lit.Value); i += size {
+		var c int64
+		for j := size - 1; j >= 0; j-- {
+			c = c<<8 | int64(lit.Value[i+j])
+		}
+		items = append(items, cabs.Constant{Value: c})
+	}
+	return cabs.InitList{Items: append(items, cabs.Constant{Value: 0})}
+}
+
+// initializer walks the items of a brace level while filling the
+// subobjects of its type. When an aggregate subobject's item is not itself
+// braced, the subobject takes as many items of the enclosing level as it
+// has scalars (C11 6.7.9p20), so {1, 2, 3, 4} and {{1, 2}, {3, 4}}
+// initialize an int[2][2] alike. A designator moves to another element of
+// the array the brace level initializes, so it ends such a subobject.
+type initializer struct {
+	items     []cabs.Expr
+	pos       int
+	assigns   []cabs.Binary
+	simplExpr *simplexpr.Transformer
+	elided    int // depth of the subobjects being filled without braces
+}
+
+// fill initializes the aggregate lv of type typ from the current items.
+func (in *initializer) fill(lv cabs.Expr, typ ctypes.Type) {
+	switch t := typ.(type) {
+	case ctypes.Tarray:
+		in.fillArray(lv, t.Elem, t.Size)
+	case ctypes.Tstruct:
+		for _, f := range in.simplExpr.ResolveStruct(t).Fields {
+			in.fillSub(cabs.Member{Expr: lv, Name: f.Name}, f.Type)
+		}
+	case ctypes.Tunion:
+		// Only the first member of a union is initialized
+		if len(t.Fields) > 0 {
+			in.fillSub(cabs.Member{Expr: lv, Name: t.Fields[0].Name}, t.Fields[0].Type)
+		}
+	}
+}
+
+// fillArray initializes the n elements of type elem of the array lv from
+// the current items, and returns how many elements they cover: the number
+// of elements of an array of unknown size, given as n < 0. Items follow
+// each other from element 0 or from the element after the last one a
+// designator named, and the elements left over are set to zero.
+func (in *initializer) fillArray(lv cabs.Expr, elem ctypes.Type, n int64) int64 {
+	element := func(i int64) cabs.Expr {
+		return cabs.Index{Array: lv, Index: cabs.Constant{Value: i}}
+	}
+	filled := make(map[int64]bool)
+	size := int64(0)
+	for i := int64(0); in.pos < len(in.items) && (n < 0 || i < n || in.designated()); {
+		if d, ok := in.items[in.pos].(cabs.Designated); ok {
+			if in.elided > 0 {
+				break
+			}
+			if n >= 0 && d.Last >= n {
+				// Past the end of the array: there is nothing to initialize
+				in.pos++
+				continue
+			}
+			if d.Last == d.Index {
+				// The value may take further items by brace elision, so it
+				// replaces the designated item in a copy of the items
+				in.items = append(append(in.items[:in.pos:in.pos], d.Value), in.items[in.pos+1:]...)
+			} else {
+				// Each element of a range is initialized by the value alone
+				for k := d.Index; k <= d.Last; k++ {
+					sub := &initializer{items: []cabs.Expr{d.Value}, simplExpr: in.simplExpr}
+					sub.fillSub(element(k), elem)
+					in.assigns = append(in.assigns, sub.assigns...)
+					filled[k] = true
+				}
+				in.pos++
+				i = d.Last + 1
+				size = max(size, i)
+				continue
+			}
+			i = d.Index
+		}
+		pos := in.pos
+		in.fillSub(element(i), elem)
+		filled[i] = true
+		i++
+		size = max(size, i)
+		if in.pos == pos {
+			break // an element without scalars, of an empty struct
+		}
+	}
+	if n < 0 {
+		n = size
+	}
+	for i := int64(0); i < n; i++ {
+		if !filled[i] {
+			in.zero(element(i), elem)
+		}
+	}
+	return size
+}
+
+// designated reports whether the current item has a designator.
+func (in *initializer) designated() bool {
+	_, ok := in.items[in.pos].(cabs.Designated)
+	return ok
+}
+
+// fillSub initializes one subobject from the next item, or with zero once
+// the items run out or a designator ends a subobject filled without braces.
+func (in *initializer) fillSub(lv cabs.Expr, typ ctypes.Type) {
+	// An array designator in the list of a struct or union, which has no
+	// elements, initializes nothing
+	for in.elided == 0 && in.pos < len(in.items) && in.designated() {
+		in.pos++
+	}
+	if in.pos >= len(in.items) || in.designated() {
+		in.zero(lv, typ)
+		return
+	}
+	item := arrayInit(typ, in.items[in.pos], in.simplExpr)
+	if !isAggregateType(typ) {
+		in.assigns = append(in.assigns, assign(lv, scalarInit(item)))
+		in.pos++
+		return
+	}
+	list, ok := item.(cabs.InitList)
+	if !ok {
+		// Brace elision: the subobject consumes items of this level
+		in.elided++
+		in.fill(lv, typ)
+		in.elided--
+		return
+	}
+	in.pos++
+	in.assigns = append(in.assigns, initializeAggregate(lv, typ, list, in.simplExpr)...)
+}
+
+// zero sets every scalar of lv to zero.
+func (in *initializer) zero(lv cabs.Expr, typ ctypes.Type) {
+	if !isAggregateType(typ) {
+		in.assigns = append(in.assigns, assign(lv, cabs.Constant{Value: 0}))
+		return
+	}
+	// Walked without items, which leaves only zeros
+	empty := &initializer{simplExpr: in.simplExpr}
+	empty.fill(lv, typ)
+	in.assigns = append(in.assigns, empty.assigns...)
+}
+
+// scalarInit returns the value of a scalar's initializer, unwrapping
+// braces: {5} initializes an int to 5.
+func scalarInit(item cabs.Expr) cabs.Expr {
+	for {
+		list, ok := item.(cabs.InitList)
+		if !ok {
+			return item
+		}
+		if len(list.Items) == 0 {
+			return cabs.Constant{Value: 0}
+		}
+		item = list.Items[0]
+	}
+}
+
+// isAggregateType reports whether t is an array, struct or union type.
+func isAggregateType(t ctypes.Type) bool {
+	switch t.(type) {
+	case ctypes.Tarray, ctypes.Tstruct, ctypes.Tunion:
+		return true
+	}
+	return false
+}
+
+// assign returns the expression lv = value.
+func assign(lv, value cabs.Expr) cabs.Binary {
+	return cabs.Binary{Op: cabs.OpAssign, Left: lv, Right: value}
+}
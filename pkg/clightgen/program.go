@@ -3,81 +3,77 @@
 package clightgen
 
 import (
+	"strings"
+
 	"github.com/raymyers/ralph-cc/pkg/cabs"
 	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/cshmgen"
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
 	"github.com/raymyers/ralph-cc/pkg/simplexpr"
 	"github.com/raymyers/ralph-cc/pkg/simpllocals"
 )
 
-// TranslateProgram transforms a Cabs program to a Clight program.
+// Options control the translation of a program
+type Options struct {
+	CharSign ctypes.Signedness // signedness of plain char
+	Diags    *diag.Emitter     // receives the errors found in the program; nil drops them
+}
+
+// TranslateProgram transforms a Cabs program to a Clight program, with
+// plain char unsigned as under AAPCS64.
 func TranslateProgram(prog *cabs.Program) *clight.Program {
-	result := &clight.Program{}
+	return TranslateProgramWithOptions(prog, Options{CharSign: ctypes.Unsigned})
+}
 
-	// First pass: collect struct and union definitions
-	structDefs := make(map[string]ctypes.Tstruct)
-	for _, def := range prog.Definitions {
-		switch d := def.(type) {
-		case cabs.StructDef:
-			s := ctypes.Tstruct{
-				Name:   d.Name,
-				Fields: make([]ctypes.Field, len(d.Fields)),
-			}
-			for i, f := range d.Fields {
-				s.Fields[i] = ctypes.Field{
-					Name: f.Name,
-					Type: TypeFromString(f.TypeSpec),
-				}
-			}
-			result.Structs = append(result.Structs, s)
-			structDefs[s.Name] = s
-		case cabs.UnionDef:
-			u := ctypes.Tunion{
-				Name:   d.Name,
-				Fields: make([]ctypes.Field, len(d.Fields)),
-			}
-			for i, f := range d.Fields {
-				u.Fields[i] = ctypes.Field{
-					Name: f.Name,
-					Type: TypeFromString(f.TypeSpec),
-				}
-			}
-			result.Unions = append(result.Unions, u)
-		}
+// TranslateProgramWithOptions transforms a Cabs program to a Clight
+// program as opts direct.
+func TranslateProgramWithOptions(prog *cabs.Program, opts Options) *clight.Program {
+	if opts.Diags == nil {
+		opts.Diags = diag.NewEmitter(diag.Options{})
 	}
+	result := &clight.Program{}
 
-	// Second pass: collect global variable types and function types first
-	globalTypes := make(map[string]ctypes.Type)
+	// First pass: collect the struct, union and typedef definitions and
+	// the types of globals and functions
+	env := collectTypes(prog, opts, result)
+
+	// Second pass: collect the global variables. An extern declaration
+	// without initializer only refers to a global, added as extern below
+	// unless the unit defines it. Repeated tentative definitions, as
+	// int h; int h; int h = 3;, define a single global, which takes the
+	// initializer of the one that has it.
+	var externs []clight.VarDecl
+	globalIndex := make(map[string]int) // position of each global in result.Globals
 	for _, def := range prog.Definitions {
 		if d, ok := def.(cabs.VarDef); ok {
-			// Skip extern declarations without initializer (they're just declarations)
+			typ := env.globals[d.Name]
 			if d.StorageClass == "extern" && d.Initializer == nil {
+				externs = append(externs, clight.VarDecl{Name: d.Name, Type: typ, Quals: env.qualifiers(d.TypeSpec, d.Quals), Extern: true})
 				continue
 			}
-			typ := TypeFromString(d.TypeSpec)
-			globalTypes[d.Name] = typ
 			var init []byte
 			if d.Initializer != nil {
-				init = evaluateConstantInitializer(d.Initializer, typ)
+				init = env.staticInit(d.Name, d.Pos, typ, d.Initializer)
 			}
+			if i, ok := globalIndex[d.Name]; ok {
+				g := &result.Globals[i]
+				g.Type = typ
+				if init != nil {
+					g.Init = init
+				}
+				g.Static = g.Static || d.StorageClass == "static"
+				continue
+			}
+			globalIndex[d.Name] = len(result.Globals)
 			result.Globals = append(result.Globals, clight.VarDecl{
-				Name: d.Name,
-				Type: typ,
-				Init: init,
+				Name:   d.Name,
+				Type:   typ,
+				Quals:  env.qualifiers(d.TypeSpec, d.Quals),
+				Init:   init,
+				Static: d.StorageClass == "static",
 			})
 		}
-		// Also collect function types for proper call argument conversion
-		if d, ok := def.(cabs.FunDef); ok {
-			var paramTypes []ctypes.Type
-			for _, p := range d.Params {
-				paramTypes = append(paramTypes, TypeFromString(p.TypeSpec))
-			}
-			retType := TypeFromString(d.ReturnType)
-			globalTypes[d.Name] = ctypes.Tfunction{
-				Params: paramTypes,
-				Return: retType,
-			}
-		}
 	}
 
 	// Third pass: translate functions with global type information
@@ -87,48 +83,69 @@ func TranslateProgram(prog *cabs.Program) *clight.Program {
 			if d.Body == nil {
 				continue
 			}
-			fn := translateFunctionWithStructsAndGlobals(&d, structDefs, globalTypes)
+			fn := translateFunctionInEnv(&d, env)
 			result.Functions = append(result.Functions, fn)
 		}
 	}
+	// The globals declared in function bodies, then the extern ones
+	// that remain undefined
+	defined := make(map[string]bool)
+	for _, g := range result.Globals {
+		defined[g.Name] = true
+	}
+	for _, g := range append(externs, env.blockGlobals...) {
+		if !defined[g.Name] {
+			defined[g.Name] = true
+			result.Globals = append(result.Globals, g)
+		}
+	}
 
 	return result
 }
 
-// translateFunction transforms a Cabs function to a Clight function.
-// Deprecated: use translateFunctionWithStructsAndGlobals instead.
-func translateFunction(fn *cabs.FunDef) clight.Function {
-	return translateFunctionWithStructsAndGlobals(fn, nil, nil)
+// structFieldType returns the type of a struct or union field.
+// An array field gets an array type of its declared sizes; a flexible
+// array member becomes an incomplete array of its element type.
+func (env *typeEnv) structFieldType(f cabs.StructField) ctypes.Type {
+	dims := f.ArrayDims
+	if f.Flexible && len(dims) == 0 {
+		dims = []cabs.Expr{nil}
+	}
+	if len(dims) == 0 {
+		return env.typeOf(f.TypeSpec)
+	}
+	typ := env.typeOf(strings.TrimSuffix(f.TypeSpec, strings.Repeat("[]", len(dims))))
+	for i := len(dims) - 1; i >= 0; i-- {
+		typ = ctypes.Array(typ, arraySize(dims[i], env.types))
+	}
+	return typ
 }
 
-// translateFunctionWithStructs transforms a Cabs function to a Clight function,
-// using the provided struct definitions for field resolution.
-// Deprecated: use translateFunctionWithStructsAndGlobals instead.
-func translateFunctionWithStructs(fn *cabs.FunDef, structDefs map[string]ctypes.Tstruct) clight.Function {
-	return translateFunctionWithStructsAndGlobals(fn, structDefs, nil)
-}
+// translateFunctionInEnv transforms a Cabs function to a Clight function,
+// resolving its declarations against the file-scope environment.
+func translateFunctionInEnv(fn *cabs.FunDef, env *typeEnv) clight.Function {
+	fn = renameLocals(fn, env.enums)
 
-// translateFunctionWithStructsAndGlobals transforms a Cabs function to a Clight function,
-// using the provided struct definitions for field resolution and global variable types.
-func translateFunctionWithStructsAndGlobals(fn *cabs.FunDef, structDefs map[string]ctypes.Tstruct, globalTypes map[string]ctypes.Type) clight.Function {
 	// Create transformers
 	simplExpr := simplexpr.New()
+	simplExpr.SetFunction(fn.Name)
 	simplLoc := simpllocals.New()
+	simplExpr.SetStmtLowering(func(s cabs.Stmt) clight.Stmt {
+		return transformStmt(s, simplExpr)
+	})
 
-	// Register struct definitions for field resolution
-	for _, s := range structDefs {
-		simplExpr.SetStructDef(s)
-	}
-
-	// Register global variable types
-	for name, typ := range globalTypes {
-		simplExpr.SetType(name, typ)
-	}
-
-	// Set up type environment for parameters
-	for _, param := range fn.Params {
-		typ := TypeFromString(param.TypeSpec)
-		simplExpr.SetType(param.Name, typ)
+	// Populate the environments before any expression is transformed:
+	// the structs, typedefs and globals, then the parameters and locals
+	env.declare(simplExpr)
+	params := make([]clight.VarDecl, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = clight.VarDecl{
+			Name:  p.Name,
+			Type:  simplExpr.TypeOf(p.TypeSpec),
+			Quals: env.qualifiers(p.TypeSpec, p.Quals),
+		}
+		simplExpr.SetType(p.Name, params[i].Type)
+		simplExpr.SetQualifiers(p.Name, params[i].Quals)
 	}
 
 	// Analyze the function for address-taken variables
@@ -137,28 +154,18 @@ func translateFunctionWithStructsAndGlobals(fn *cabs.FunDef, structDefs map[stri
 	}
 
 	// Collect local variables from the body
-	var locals []clight.VarDecl
+	locals := &localDecls{fn: fn.Name, env: env}
 	if fn.Body != nil {
-		collectLocals(fn.Body, &locals, simplExpr)
+		collectLocals(fn.Body, locals, simplExpr)
 	}
+	env.blockGlobals = append(env.blockGlobals, locals.globals...)
 
 	// Analyze which locals can be promoted to temps
-	localInfos := simplLoc.AnalyzeLocals(locals)
+	localInfos := simplLoc.AnalyzeLocals(locals.vars)
 	remainingLocals := simpllocals.FilterUnpromotedLocals(localInfos)
 
-	// Continue temp IDs from simpllocals
+	// Continue temp IDs from simpllocals. The environments are kept.
 	simplExpr.Reset()
-	// Re-register struct definitions after reset
-	for _, s := range structDefs {
-		simplExpr.SetStructDef(s)
-	}
-	// Re-register global types after reset
-	for name, typ := range globalTypes {
-		simplExpr.SetType(name, typ)
-	}
-	for _, param := range fn.Params {
-		simplExpr.SetType(param.Name, TypeFromString(param.TypeSpec))
-	}
 
 	// Set starting temp ID after simpllocals temps to avoid collision
 	nextTemp := 1
@@ -183,59 +190,121 @@ func translateFunctionWithStructsAndGlobals(fn *cabs.FunDef, structDefs map[stri
 	temps = append(temps, simplLoc.TempTypes()...)
 	temps = append(temps, simplExpr.TempTypes()...)
 
-	// Build params
-	params := make([]clight.VarDecl, len(fn.Params))
-	for i, p := range fn.Params {
-		params[i] = clight.VarDecl{
-			Name: p.Name,
-			Type: TypeFromString(p.TypeSpec),
-		}
-	}
-
 	return clight.Function{
 		Name:   fn.Name,
-		Return: TypeFromString(fn.ReturnType),
+		Return: simplExpr.TypeOf(fn.ReturnType),
 		Params: params,
 		Locals: remainingLocals,
 		Temps:  temps,
 		Body:   body,
+		Static: fn.StorageClass == "static",
+	}
+}
+
+// localDecls collects the block-scope variables of a function. Those with
+// static storage keep their value across calls, so they are not locals but
+// hidden globals: each is named after the function, as "f.count", which no
+// C identifier can clash with. An extern declaration refers to the global
+// of that name.
+type localDecls struct {
+	fn      string
+	env     *typeEnv
+	vars    []clight.VarDecl // automatic variables
+	globals []clight.VarDecl // hidden globals of the static ones, and the extern ones
+}
+
+// declare adds the variable of a block-scope declaration of type typ
+func (locals *localDecls) declare(decl cabs.Decl, typ ctypes.Type, simplExpr *simplexpr.Transformer) {
+	quals := locals.env.qualifiers(decl.TypeSpec, decl.Quals)
+	switch decl.StorageClass {
+	case "extern":
+		simplExpr.SetType(decl.Name, typ)
+		simplExpr.SetQualifiers(decl.Name, quals)
+		if _, ok := typ.(ctypes.Tfunction); ok {
+			// A function prototype only types the calls in its scope
+			return
+		}
+		locals.globals = append(locals.globals, clight.VarDecl{Name: decl.Name, Type: typ, Quals: quals, Extern: true})
+	case "static":
+		symbol := locals.fn + "." + decl.Name
+		simplExpr.SetSymbol(decl.Name, symbol)
+		simplExpr.SetType(symbol, typ)
+		simplExpr.SetQualifiers(symbol, quals)
+		var init []byte
+		if decl.Initializer != nil {
+			init = locals.env.staticInit(decl.Name, decl.Pos, typ, decl.Initializer)
+		}
+		locals.globals = append(locals.globals, clight.VarDecl{Name: symbol, Type: typ, Quals: quals, Init: init, Static: true})
+	default:
+		simplExpr.SetType(decl.Name, typ)
+		simplExpr.SetQualifiers(decl.Name, quals)
+		locals.vars = append(locals.vars, clight.VarDecl{Name: decl.Name, Type: typ, Quals: quals})
 	}
 }
 
 // collectLocals extracts local variable declarations from a block.
-func collectLocals(block *cabs.Block, locals *[]clight.VarDecl, simplExpr *simplexpr.Transformer) {
+func collectLocals(block *cabs.Block, locals *localDecls, simplExpr *simplexpr.Transformer) {
 	for _, item := range block.Items {
 		collectLocalsFromStmt(item, locals, simplExpr)
 	}
 }
 
+// arrayType applies the array dimensions of a declaration to its element
+// type, from the innermost to the outermost dimension. A dimension that is
+// missing or not a constant gives an incomplete array.
+func arrayType(typ ctypes.Type, dims []cabs.Expr, types *simplexpr.Transformer) ctypes.Type {
+	for i := len(dims) - 1; i >= 0; i-- {
+		typ = ctypes.Tarray{Elem: typ, Size: arraySize(dims[i], types)}
+	}
+	return typ
+}
+
+// arraySize returns the size of an array dimension, or -1 when it is
+// missing or not a constant. The parser folds the constant parts of a
+// dimension but sizeof, which needs the layout of a type: it is folded
+// here, to the size the sizeof would evaluate to, with the types resolved
+// by types.
+func arraySize(dim cabs.Expr, types *simplexpr.Transformer) int64 {
+	if c, ok := cabs.FoldConst(dim, nil, sizeofFolder(types)).(cabs.Constant); ok {
+		return c.Value
+	}
+	return -1
+}
+
+// sizeofFolder returns the function that folds a sizeof to the size of
+// its operand's type, resolved by types, for cabs.FoldConst.
+func sizeofFolder(types *simplexpr.Transformer) func(cabs.Expr) (int64, bool) {
+	return func(e cabs.Expr) (int64, bool) {
+		// The operand of sizeof is not evaluated, only its type is needed
+		s, ok := types.TransformExpr(e).Expr.(clight.Esizeof)
+		if !ok {
+			return 0, false
+		}
+		return cshmgen.Sizeof(s.ArgType), true
+	}
+}
+
+// declType resolves the type specifier of a local declaration, whose base
+// type may be typeof(expr).
+func declType(decl cabs.Decl, simplExpr *simplexpr.Transformer) ctypes.Type {
+	if decl.Typeof != nil {
+		return simplExpr.TypeofType(decl.Typeof, decl.TypeSpec)
+	}
+	return simplExpr.TypeOf(decl.TypeSpec)
+}
+
 // collectLocalsFromStmt extracts local variable declarations from a statement.
-func collectLocalsFromStmt(item cabs.Stmt, locals *[]clight.VarDecl, simplExpr *simplexpr.Transformer) {
+func collectLocalsFromStmt(item cabs.Stmt, locals *localDecls, simplExpr *simplexpr.Transformer) {
 	switch s := item.(type) {
+	case cabs.Return:
+		collectLocalsFromExpr(s.Expr, locals, simplExpr)
+	case cabs.Computation:
+		collectLocalsFromExpr(s.Expr, locals, simplExpr)
 	case cabs.DeclStmt:
 		for _, decl := range s.Decls {
-			typ := TypeFromString(decl.TypeSpec)
-			// Resolve struct types to include field information
-			if st, ok := typ.(ctypes.Tstruct); ok {
-				typ = simplExpr.ResolveStruct(st)
-			}
-			// Handle array declarations
-			if len(decl.ArrayDims) > 0 {
-				// Build array type from innermost to outermost dimension
-				for i := len(decl.ArrayDims) - 1; i >= 0; i-- {
-					dim := decl.ArrayDims[i]
-					size := int64(-1) // default: incomplete array
-					if c, ok := dim.(cabs.Constant); ok {
-						size = c.Value
-					}
-					typ = ctypes.Tarray{Elem: typ, Size: size}
-				}
-			}
-			simplExpr.SetType(decl.Name, typ)
-			*locals = append(*locals, clight.VarDecl{
-				Name: decl.Name,
-				Type: typ,
-			})
+			typ := completeArrayType(arrayType(declType(decl, simplExpr), decl.ArrayDims, simplExpr), decl.Initializer, simplExpr)
+			locals.declare(decl, typ, simplExpr)
+			collectLocalsFromExpr(decl.Initializer, locals, simplExpr)
 		}
 	case cabs.Block:
 		collectLocals(&s, locals, simplExpr)
@@ -244,29 +313,27 @@ func collectLocalsFromStmt(item cabs.Stmt, locals *[]clight.VarDecl, simplExpr *
 	case cabs.For:
 		// C99 for-loop declarations
 		for _, decl := range s.InitDecl {
-			typ := TypeFromString(decl.TypeSpec)
-			// Resolve struct types to include field information
-			if st, ok := typ.(ctypes.Tstruct); ok {
-				typ = simplExpr.ResolveStruct(st)
-			}
-			simplExpr.SetType(decl.Name, typ)
-			*locals = append(*locals, clight.VarDecl{
-				Name: decl.Name,
-				Type: typ,
-			})
+			locals.declare(decl, declType(decl, simplExpr), simplExpr)
 		}
+		collectLocalsFromExpr(s.Init, locals, simplExpr)
+		collectLocalsFromExpr(s.Cond, locals, simplExpr)
+		collectLocalsFromExpr(s.Step, locals, simplExpr)
 		// Recurse into body
 		collectLocalsFromStmt(s.Body, locals, simplExpr)
 	case cabs.While:
+		collectLocalsFromExpr(s.Cond, locals, simplExpr)
 		collectLocalsFromStmt(s.Body, locals, simplExpr)
 	case cabs.DoWhile:
 		collectLocalsFromStmt(s.Body, locals, simplExpr)
+		collectLocalsFromExpr(s.Cond, locals, simplExpr)
 	case cabs.If:
+		collectLocalsFromExpr(s.Cond, locals, simplExpr)
 		collectLocalsFromStmt(s.Then, locals, simplExpr)
 		if s.Else != nil {
 			collectLocalsFromStmt(s.Else, locals, simplExpr)
 		}
 	case cabs.Switch:
+		collectLocalsFromExpr(s.Expr, locals, simplExpr)
 		for _, c := range s.Cases {
 			for _, stmt := range c.Stmts {
 				collectLocalsFromStmt(stmt, locals, simplExpr)
@@ -275,6 +342,47 @@ func collectLocalsFromStmt(item cabs.Stmt, locals *[]clight.VarDecl, simplExpr *
 	}
 }
 
+// collectLocalsFromExpr extracts local variable declarations from the
+// statement expressions nested in an expression.
+func collectLocalsFromExpr(e cabs.Expr, locals *localDecls, simplExpr *simplexpr.Transformer) {
+	switch expr := e.(type) {
+	case cabs.StmtExpr:
+		if expr.Block != nil {
+			collectLocals(expr.Block, locals, simplExpr)
+		}
+		collectLocalsFromExpr(expr.Result, locals, simplExpr)
+	case cabs.Paren:
+		collectLocalsFromExpr(expr.Expr, locals, simplExpr)
+	case cabs.Unary:
+		collectLocalsFromExpr(expr.Expr, locals, simplExpr)
+	case cabs.Binary:
+		collectLocalsFromExpr(expr.Left, locals, simplExpr)
+		collectLocalsFromExpr(expr.Right, locals, simplExpr)
+	case cabs.Conditional:
+		collectLocalsFromExpr(expr.Cond, locals, simplExpr)
+		collectLocalsFromExpr(expr.Then, locals, simplExpr)
+		collectLocalsFromExpr(expr.Else, locals, simplExpr)
+	case cabs.Call:
+		collectLocalsFromExpr(expr.Func, locals, simplExpr)
+		for _, arg := range expr.Args {
+			collectLocalsFromExpr(arg, locals, simplExpr)
+		}
+	case cabs.Index:
+		collectLocalsFromExpr(expr.Array, locals, simplExpr)
+		collectLocalsFromExpr(expr.Index, locals, simplExpr)
+	case cabs.Member:
+		collectLocalsFromExpr(expr.Expr, locals, simplExpr)
+	case cabs.Cast:
+		collectLocalsFromExpr(expr.Expr, locals, simplExpr)
+	case cabs.InitList:
+		for _, item := range expr.Items {
+			collectLocalsFromExpr(item, locals, simplExpr)
+		}
+	case cabs.Designated:
+		collectLocalsFromExpr(expr.Value, locals, simplExpr)
+	}
+}
+
 // transformBlock transforms a Cabs block to a Clight statement.
 func transformBlock(block *cabs.Block, simplExpr *simplexpr.Transformer) clight.Stmt {
 	var stmts []clight.Stmt
@@ -1,11 +1,15 @@
 package clightgen
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/cabs"
 	"github.com/raymyers/ralph-cc/pkg/clight"
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+	"github.com/raymyers/ralph-cc/pkg/simplexpr"
 )
 
 func TestTranslateProgram_Empty(t *testing.T) {
@@ -181,6 +185,59 @@ func TestTranslateProgram_StructDef(t *testing.T) {
 	}
 }
 
+func TestTranslateProgram_ForwardStructDecl(t *testing.T) {
+	point := cabs.StructDef{
+		Name:   "Point",
+		Fields: []cabs.StructField{{Name: "x", TypeSpec: "int"}},
+	}
+	// A forward declaration before or after the definition is not a
+	// definition of its own
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.StructDef{Name: "Point"},
+			point,
+			cabs.StructDef{Name: "Point"},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if len(result.Structs) != 1 {
+		t.Fatalf("expected 1 struct, got %d", len(result.Structs))
+	}
+	if len(result.Structs[0].Fields) != 1 {
+		t.Errorf("expected the defined fields, got %+v", result.Structs[0])
+	}
+}
+
+func TestTranslateProgram_FlexibleArrayMember(t *testing.T) {
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.StructDef{
+				Name: "S",
+				Fields: []cabs.StructField{
+					{Name: "n", TypeSpec: "int"},
+					{Name: "data", TypeSpec: "int[]", Flexible: true},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if len(result.Structs) != 1 || len(result.Structs[0].Fields) != 2 {
+		t.Fatalf("expected 1 struct with 2 fields, got %+v", result.Structs)
+	}
+	arr, ok := result.Structs[0].Fields[1].Type.(ctypes.Tarray)
+	if !ok {
+		t.Fatalf("expected flexible member to be Tarray, got %T", result.Structs[0].Fields[1].Type)
+	}
+	if arr.Size != -1 || !ctypes.Equal(arr.Elem, ctypes.Int()) {
+		t.Errorf("expected incomplete int array, got %v (size %d)", arr.Elem, arr.Size)
+	}
+	if got := SizeofType(result.Structs[0]); got != 4 {
+		t.Errorf("expected flexible member to add no size, got sizeof %d", got)
+	}
+}
+
 func TestTranslateProgram_UnionDef(t *testing.T) {
 	prog := &cabs.Program{
 		Definitions: []cabs.Definition{
@@ -203,6 +260,712 @@ func TestTranslateProgram_UnionDef(t *testing.T) {
 	}
 }
 
+func TestTranslateProgram_AnonymousMember(t *testing.T) {
+	// union __anon_0 { char c; long l; };
+	// struct S { int k; union __anon_0; };
+	// long f(struct S *p) { return p->l; }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.UnionDef{
+				Name: "__anon_0",
+				Fields: []cabs.StructField{
+					{Name: "c", TypeSpec: "char"},
+					{Name: "l", TypeSpec: "long"},
+				},
+			},
+			cabs.StructDef{
+				Name: "S",
+				Fields: []cabs.StructField{
+					{Name: "k", TypeSpec: "int"},
+					{TypeSpec: "union __anon_0"},
+				},
+			},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "long",
+				Params:     []cabs.Param{{Name: "p", TypeSpec: "struct S*"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.Return{Expr: cabs.Member{Expr: cabs.Variable{Name: "p"}, Name: "l", IsArrow: true}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	anon := result.Structs[0].Fields[1]
+	if anon.Name != "$anon1" || !anon.Anonymous {
+		t.Errorf("expected anonymous member $anon1, got %+v", anon)
+	}
+	if size := SizeofType(anon.Type); size != 8 {
+		t.Errorf("expected the member to be the union of size 8, got %d", size)
+	}
+
+	ret, ok := result.Functions[0].Body.(clight.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", result.Functions[0].Body)
+	}
+	l, ok := ret.Value.(clight.Efield)
+	if !ok || l.FieldName != "l" || !ctypes.Equal(l.Typ, ctypes.Long()) {
+		t.Fatalf("expected field l of type long, got %v", ret.Value)
+	}
+	if inner, ok := l.Arg.(clight.Efield); !ok || inner.FieldName != "$anon1" {
+		t.Errorf("expected l accessed through $anon1, got %v", l.Arg)
+	}
+}
+
+func TestTranslateProgram_DeclaredDoubleType(t *testing.T) {
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "double",
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.DeclStmt{Decls: []cabs.Decl{{Name: "d", TypeSpec: "double"}}},
+						cabs.Return{Expr: cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "d"}, Right: cabs.Constant{Value: 1}}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	stmts := flattenSeq(result.Functions[0].Body)
+	ret, ok := stmts[len(stmts)-1].(clight.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", stmts[len(stmts)-1])
+	}
+	if !ctypes.Equal(ret.Value.ExprType(), ctypes.Double()) {
+		t.Errorf("expected d + 1 to be a double, got %v", ret.Value.ExprType())
+	}
+}
+
+func TestTranslateProgram_PrototypesTypeCalls(t *testing.T) {
+	// double g(void);
+	// double f(int x) { double h(double); return g() + 1 + h(x); }
+	sum := cabs.Binary{
+		Op:    cabs.OpAdd,
+		Left:  cabs.Binary{Op: cabs.OpAdd, Left: cabs.Call{Func: cabs.Variable{Name: "g"}}, Right: cabs.Constant{Value: 1}},
+		Right: cabs.Call{Func: cabs.Variable{Name: "h"}, Args: []cabs.Expr{cabs.Variable{Name: "x"}}},
+	}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{Name: "g", ReturnType: "double", Params: []cabs.Param{{TypeSpec: "void"}}},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "double",
+				Params:     []cabs.Param{{Name: "x", TypeSpec: "int"}},
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					cabs.DeclStmt{Decls: []cabs.Decl{{StorageClass: "extern", Name: "h", TypeSpec: "double(double)"}}},
+					cabs.Return{Expr: sum},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if len(result.Globals) != 0 {
+		t.Errorf("a prototype declares no variable, got globals %+v", result.Globals)
+	}
+	fn := result.Functions[0]
+	if len(fn.Locals) != 0 {
+		t.Errorf("a prototype declares no variable, got locals %+v", fn.Locals)
+	}
+	var calls []clight.Scall
+	for _, s := range flattenSeq(fn.Body) {
+		if c, ok := s.(clight.Scall); ok {
+			calls = append(calls, c)
+		}
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	for _, c := range calls {
+		if fnType, ok := c.Func.ExprType().(ctypes.Tfunction); !ok || !ctypes.Equal(fnType.Return, ctypes.Double()) {
+			t.Errorf("expected a function returning double, got %v", c.Func.ExprType())
+		}
+		if !ctypes.Equal(fn.Temps[*c.Result-1], ctypes.Double()) {
+			t.Errorf("expected a double result temp, got %v", fn.Temps[*c.Result-1])
+		}
+	}
+	if arg, ok := calls[1].Args[0].(clight.Ecast); !ok || !ctypes.Equal(arg.Typ, ctypes.Double()) {
+		t.Errorf("expected x converted to double, got %#v", calls[1].Args[0])
+	}
+	stmts := flattenSeq(fn.Body)
+	ret, ok := stmts[len(stmts)-1].(clight.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", stmts[len(stmts)-1])
+	}
+	if !ctypes.Equal(ret.Value.ExprType(), ctypes.Double()) {
+		t.Errorf("expected g() + 1 + h(x) to be a double, got %v", ret.Value.ExprType())
+	}
+}
+
+func TestTranslateProgram_GlobalArrayType(t *testing.T) {
+	// int g[2][3];
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "g", TypeSpec: "int", ArrayDims: []cabs.Expr{cabs.Constant{Value: 2}, cabs.Constant{Value: 3}}},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	want := ctypes.Array(ctypes.Array(ctypes.Int(), 3), 2)
+	if !ctypes.Equal(result.Globals[0].Type, want) {
+		t.Errorf("expected g to be %v, got %v", want, result.Globals[0].Type)
+	}
+}
+
+func TestTranslateProgram_SizeofArraySize(t *testing.T) {
+	// struct P { int a; long b; }; int t[sizeof(int)*2]; char p[sizeof(struct P)];
+	twoInts := cabs.Binary{Op: cabs.OpMul, Left: cabs.SizeofType{TypeName: "int"}, Right: cabs.Constant{Value: 2}}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.StructDef{Name: "P", Fields: []cabs.StructField{{TypeSpec: "int", Name: "a"}, {TypeSpec: "long", Name: "b"}}},
+			cabs.VarDef{Name: "t", TypeSpec: "int", ArrayDims: []cabs.Expr{twoInts}},
+			cabs.VarDef{Name: "p", TypeSpec: "char", ArrayDims: []cabs.Expr{cabs.SizeofType{TypeName: "struct P"}}},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if want := ctypes.Array(ctypes.Int(), 8); !ctypes.Equal(result.Globals[0].Type, want) {
+		t.Errorf("expected t to be %v, got %v", want, result.Globals[0].Type)
+	}
+	if size := SizeofType(result.Globals[0].Type); size != 32 {
+		t.Errorf("expected t to be 32 bytes, got %d", size)
+	}
+	// The size of the struct includes the padding before b
+	if arr, ok := result.Globals[1].Type.(ctypes.Tarray); !ok || arr.Size != 16 {
+		t.Errorf("expected p to be an array of 16, got %v", result.Globals[1].Type)
+	}
+}
+
+func TestTranslateProgram_ArraySizeFromInitializer(t *testing.T) {
+	// int a[] = {1, 2, 3, 4}; static const int t[] = {5, 6}; char s[] = "hi";
+	list := func(values ...int64) cabs.InitList {
+		var items []cabs.Expr
+		for _, v := range values {
+			items = append(items, cabs.Constant{Value: v})
+		}
+		return cabs.InitList{Items: items}
+	}
+	open := []cabs.Expr{nil}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "a", TypeSpec: "int", ArrayDims: open, Initializer: list(1, 2, 3, 4)},
+			cabs.VarDef{Name: "t", TypeSpec: "int", StorageClass: "static", Quals: cabs.Qualifiers{Base: []cabs.TypeQualifier{cabs.QualConst}}, ArrayDims: open, Initializer: list(5, 6)},
+			cabs.VarDef{Name: "s", TypeSpec: "char", ArrayDims: open, Initializer: cabs.StringLiteral{Value: "hi"}},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	sizes := map[string]int64{"a": 16, "t": 8, "s": 3}
+	data := map[string][]byte{
+		"a": {1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0},
+		"t": {5, 0, 0, 0, 6, 0, 0, 0},
+		"s": {'h', 'i', 0},
+	}
+	for _, g := range result.Globals {
+		if size := SizeofType(g.Type); size != sizes[g.Name] {
+			t.Errorf("expected %s to be %d bytes, got %d (%v)", g.Name, sizes[g.Name], size, g.Type)
+		}
+		if !reflect.DeepEqual(g.Init, data[g.Name]) {
+			t.Errorf("expected %s to hold %v, got %v", g.Name, data[g.Name], g.Init)
+		}
+	}
+}
+
+func TestTranslateProgram_StaticInitializerData(t *testing.T) {
+	// struct P { char c; int x; long l; };
+	// struct P gp = {3, 4, -5};
+	// struct P arr[2] = {{1}, [1] = {0, 2}};
+	// union U { short s; char c; } gu = {0x0102};
+	// int f(void) { static short z[3] = {1, -1}; return z[0]; }
+	c := func(v int64) cabs.Expr { return cabs.Constant{Value: v} }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.StructDef{Name: "P", Fields: []cabs.StructField{
+				{Name: "c", TypeSpec: "char"},
+				{Name: "x", TypeSpec: "int"},
+				{Name: "l", TypeSpec: "long"},
+			}},
+			cabs.UnionDef{Name: "U", Fields: []cabs.StructField{
+				{Name: "s", TypeSpec: "short"},
+				{Name: "c", TypeSpec: "char"},
+			}},
+			cabs.VarDef{Name: "gp", TypeSpec: "struct P", Initializer: cabs.InitList{Items: []cabs.Expr{
+				c(3), c(4), cabs.Unary{Op: cabs.OpNeg, Expr: c(5)},
+			}}},
+			cabs.VarDef{Name: "arr", TypeSpec: "struct P", ArrayDims: []cabs.Expr{c(2)}, Initializer: cabs.InitList{Items: []cabs.Expr{
+				cabs.InitList{Items: []cabs.Expr{c(1)}},
+				cabs.Designated{Index: 1, Last: 1, Value: cabs.InitList{Items: []cabs.Expr{c(0), c(2)}}},
+			}}},
+			cabs.VarDef{Name: "gu", TypeSpec: "union U", Initializer: cabs.InitList{Items: []cabs.Expr{c(0x0102)}}},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					cabs.DeclStmt{Decls: []cabs.Decl{{
+						StorageClass: "static",
+						TypeSpec:     "short",
+						Name:         "z",
+						ArrayDims:    []cabs.Expr{c(3)},
+						Initializer:  cabs.InitList{Items: []cabs.Expr{c(1), cabs.Unary{Op: cabs.OpNeg, Expr: c(1)}}},
+					}}},
+					cabs.Return{Expr: cabs.Index{Array: cabs.Variable{Name: "z"}, Index: c(0)}},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	// Every scalar is stored at its offset, padding and the members left
+	// out being zero
+	want := map[string][]byte{
+		"gp":  {3, 0, 0, 0, 4, 0, 0, 0, 0xfb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"arr": {1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		"gu":  {2, 1},
+		"f.z": {1, 0, 0xff, 0xff, 0, 0},
+	}
+	if len(result.Globals) != len(want) {
+		t.Fatalf("expected %d globals, got %+v", len(want), result.Globals)
+	}
+	for _, g := range result.Globals {
+		if !reflect.DeepEqual(g.Init, want[g.Name]) {
+			t.Errorf("expected %s to hold %v, got %v", g.Name, want[g.Name], g.Init)
+		}
+	}
+}
+
+func TestTranslateProgram_NonConstantStaticInitializer(t *testing.T) {
+	// int y;
+	// int *x[] = {&y};
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "y", TypeSpec: "int"},
+			cabs.VarDef{
+				Name:        "x",
+				TypeSpec:    "int*",
+				ArrayDims:   []cabs.Expr{nil},
+				Initializer: cabs.InitList{Items: []cabs.Expr{cabs.Unary{Op: cabs.OpAddrOf, Expr: cabs.Variable{Name: "y"}}}},
+				Pos:         diag.Pos{Line: 2, Col: 6},
+			},
+		},
+	}
+	diags := diag.NewEmitter(diag.Options{})
+	TranslateProgramWithOptions(prog, Options{CharSign: ctypes.Unsigned, Diags: diags})
+
+	want := []diag.Diagnostic{{
+		Severity: diag.Error,
+		Pos:      diag.Pos{Line: 2, Col: 6},
+		Code:     "initializer",
+		Message:  "initializer element of 'x' is not an integer constant",
+	}}
+	if got := diags.Diagnostics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCompleteArrayType(t *testing.T) {
+	c := func(v int64) cabs.Expr { return cabs.Constant{Value: v} }
+	tests := []struct {
+		name string
+		typ  ctypes.Type
+		init cabs.Expr
+		want ctypes.Type
+	}{
+		{"list", ctypes.Array(ctypes.Int(), -1), cabs.InitList{Items: []cabs.Expr{c(1), c(2), c(3)}}, ctypes.Array(ctypes.Int(), 3)},
+		{"sized array kept", ctypes.Array(ctypes.Int(), 8), cabs.InitList{Items: []cabs.Expr{c(1)}}, ctypes.Array(ctypes.Int(), 8)},
+		{"brace elision in rows", ctypes.Array(ctypes.Array(ctypes.Int(), 2), -1), cabs.InitList{Items: []cabs.Expr{c(1), c(2), c(3)}}, ctypes.Array(ctypes.Array(ctypes.Int(), 2), 2)},
+		{"string", ctypes.Array(ctypes.Char(), -1), cabs.StringLiteral{Value: "abc"}, ctypes.Array(ctypes.Char(), 4)},
+		{"braced string", ctypes.Array(ctypes.Char(), -1), cabs.InitList{Items: []cabs.Expr{cabs.StringLiteral{Value: "a"}}}, ctypes.Array(ctypes.Char(), 2)},
+		{"strings in rows", ctypes.Array(ctypes.Array(ctypes.Char(), 4), -1), cabs.InitList{Items: []cabs.Expr{cabs.StringLiteral{Value: "ab"}, cabs.StringLiteral{Value: "cd"}}}, ctypes.Array(ctypes.Array(ctypes.Char(), 4), 2)},
+		{"wide string", ctypes.Array(ctypes.Int(), -1), cabs.StringLiteral{Value: "ab", Encoding: "L"}, ctypes.Array(ctypes.Int(), 3)},
+		{"no initializer", ctypes.Array(ctypes.Int(), -1), nil, ctypes.Array(ctypes.Int(), -1)},
+		{"designators", ctypes.Array(ctypes.Int(), -1), cabs.InitList{Items: []cabs.Expr{cabs.Designated{Index: 2, Last: 4, Value: c(1)}, c(2), cabs.Designated{Index: 1, Last: 1, Value: c(3)}}}, ctypes.Array(ctypes.Int(), 6)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completeArrayType(tt.typ, tt.init, simplexpr.New()); !ctypes.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTranslateProgram_ArrayOfFunctionPointers(t *testing.T) {
+	// int (*arr[3])(void);
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "arr", TypeSpec: "int(*)(void)", ArrayDims: []cabs.Expr{cabs.Constant{Value: 3}}},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	arr, ok := result.Globals[0].Type.(ctypes.Tarray)
+	if !ok || arr.Size != 3 {
+		t.Fatalf("expected arr to be an array of 3, got %v", result.Globals[0].Type)
+	}
+	ptr, ok := arr.Elem.(ctypes.Tpointer)
+	if !ok {
+		t.Fatalf("expected pointer elements, got %v", arr.Elem)
+	}
+	if fn, ok := ptr.Elem.(ctypes.Tfunction); !ok || !ctypes.Equal(fn.Return, ctypes.Int()) {
+		t.Errorf("expected pointers to functions returning int, got %v", ptr.Elem)
+	}
+	if size := SizeofType(arr); size != 24 {
+		t.Errorf("expected size 24, got %d", size)
+	}
+}
+
+func TestTranslateProgram_TypeofTypes(t *testing.T) {
+	// long g; typeof(g) *h; void f(char c) { typeof(c) a[2]; }
+	g := cabs.Variable{Name: "g"}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "g", TypeSpec: "long"},
+			cabs.VarDef{Name: "h", TypeSpec: "typeof(g)*", Typeof: g},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "void",
+				Params:     []cabs.Param{{Name: "c", TypeSpec: "char"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.DeclStmt{Decls: []cabs.Decl{{
+							Name:      "a",
+							TypeSpec:  "typeof(c)",
+							Typeof:    cabs.Variable{Name: "c"},
+							ArrayDims: []cabs.Expr{cabs.Constant{Value: 2}},
+						}}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if want := ctypes.Pointer(ctypes.Long()); !ctypes.Equal(result.Globals[1].Type, want) {
+		t.Errorf("expected h to be %v, got %v", want, result.Globals[1].Type)
+	}
+	fn := result.Functions[0]
+	if len(fn.Locals) != 1 {
+		t.Fatalf("expected local a, got %v", fn.Locals)
+	}
+	if want := ctypes.Array(ctypes.Char(), 2); !ctypes.Equal(fn.Locals[0].Type, want) {
+		t.Errorf("expected a to be %v, got %v", want, fn.Locals[0].Type)
+	}
+	if len(fn.Temps) != 0 {
+		t.Errorf("typeof operand left temporaries %v", fn.Temps)
+	}
+}
+
+func TestTranslateProgram_StaticAndExternLocals(t *testing.T) {
+	// int f(void) { static int count; static int n = 5; extern int e; int x = 1; count = n + e + x; return count; }
+	decl := func(storage, name string, init cabs.Expr) cabs.Stmt {
+		return cabs.DeclStmt{Decls: []cabs.Decl{{StorageClass: storage, Name: name, TypeSpec: "int", Initializer: init}}}
+	}
+	sum := cabs.Binary{
+		Op:    cabs.OpAdd,
+		Left:  cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "n"}, Right: cabs.Variable{Name: "e"}},
+		Right: cabs.Variable{Name: "x"},
+	}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					decl("static", "count", nil),
+					decl("static", "n", cabs.Constant{Value: 5}),
+					decl("extern", "e", nil),
+					decl("", "x", cabs.Constant{Value: 1}),
+					cabs.Computation{Expr: cabs.Binary{Op: cabs.OpAssign, Left: cabs.Variable{Name: "count"}, Right: sum}},
+					cabs.Return{Expr: cabs.Variable{Name: "count"}},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	want := []clight.VarDecl{
+		{Name: "f.count", Type: ctypes.Int(), Static: true},
+		{Name: "f.n", Type: ctypes.Int(), Init: []byte{5, 0, 0, 0}, Static: true},
+		{Name: "e", Type: ctypes.Int(), Extern: true},
+	}
+	if !reflect.DeepEqual(result.Globals, want) {
+		t.Errorf("globals = %+v, want %+v", result.Globals, want)
+	}
+	fn := result.Functions[0]
+	for _, l := range fn.Locals {
+		if l.Name != "x" {
+			t.Errorf("unexpected local %s", l.Name)
+		}
+	}
+	var b strings.Builder
+	clight.NewPrinter(&b).PrintProgram(result)
+	for _, ref := range []string{"f.count = ", "return f.count;", "f.n + e"} {
+		if !strings.Contains(b.String(), ref) {
+			t.Errorf("expected %q in\n%s", ref, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "f.n = 5") {
+		t.Errorf("a static local is initialized once, not on each call:\n%s", b.String())
+	}
+}
+
+func TestTranslateProgram_ShadowedLocals(t *testing.T) {
+	// int f(void) { int x = 1; g(&x); { double x = 2; g(&x); x = x + 1; } return x; }
+	decl := func(typ string, init int64) cabs.Stmt {
+		return cabs.DeclStmt{Decls: []cabs.Decl{{Name: "x", TypeSpec: typ, Initializer: cabs.Constant{Value: init}}}}
+	}
+	x := cabs.Variable{Name: "x"}
+	escape := cabs.Computation{Expr: cabs.Call{Func: cabs.Variable{Name: "g"}, Args: []cabs.Expr{cabs.Unary{Op: cabs.OpAddrOf, Expr: x}}}}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					decl("int", 1),
+					escape,
+					&cabs.Block{Items: []cabs.Stmt{
+						decl("double", 2),
+						escape,
+						cabs.Computation{Expr: cabs.Binary{Op: cabs.OpAssign, Left: x, Right: cabs.Binary{Op: cabs.OpAdd, Left: x, Right: cabs.Constant{Value: 1}}}},
+					}},
+					cabs.Return{Expr: x},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	fn := result.Functions[0]
+
+	wantLocals := []clight.VarDecl{
+		{Name: "x", Type: ctypes.Int()},
+		{Name: "x.1", Type: ctypes.Double()},
+	}
+	if !reflect.DeepEqual(fn.Locals, wantLocals) {
+		t.Fatalf("locals = %+v, want %+v", fn.Locals, wantLocals)
+	}
+	var b strings.Builder
+	clight.NewPrinter(&b).PrintProgram(result)
+	for _, use := range []string{"g(&x)", "g(&x.1)", "x.1 + (double)1", "return x;"} {
+		if !strings.Contains(b.String(), use) {
+			t.Errorf("expected %q in\n%s", use, b.String())
+		}
+	}
+}
+
+func TestTranslateProgram_EnumeratorConstants(t *testing.T) {
+	// enum E { A = -1, B = A + 2, C = 5 };
+	// int f(void) { return A + B + C; }
+	// int g(void) { { int A = 3; A++; } return A; }
+	enum := cabs.EnumDef{Name: "E", Values: []cabs.EnumVal{
+		{Name: "A", Value: cabs.Unary{Op: cabs.OpNeg, Expr: cabs.Constant{Value: 1}}, Num: -1},
+		{Name: "B", Value: cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "A"}, Right: cabs.Constant{Value: 2}}, Num: 1},
+		{Name: "C", Value: cabs.Constant{Value: 5}, Num: 5},
+	}}
+	a := cabs.Variable{Name: "A"}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			enum,
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					cabs.Return{Expr: cabs.Binary{Op: cabs.OpAdd,
+						Left:  cabs.Binary{Op: cabs.OpAdd, Left: a, Right: cabs.Variable{Name: "B"}},
+						Right: cabs.Variable{Name: "C"}}},
+				}},
+			},
+			cabs.FunDef{
+				Name:       "g",
+				ReturnType: "int",
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					&cabs.Block{Items: []cabs.Stmt{
+						cabs.DeclStmt{Decls: []cabs.Decl{{Name: "A", TypeSpec: "int", Initializer: cabs.Constant{Value: 3}}}},
+						cabs.Computation{Expr: cabs.Unary{Op: cabs.OpPostInc, Expr: a}},
+					}},
+					cabs.Return{Expr: a},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	// The enumerators are int constants, except where a local shadows one
+	var b strings.Builder
+	clight.NewPrinter(&b).PrintProgram(result)
+	for _, want := range []string{"return (-1 + 1) + 5;", "$2 = $1;\n  $1 = $2 + 1;\n  return -1;"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %q in\n%s", want, b.String())
+		}
+	}
+}
+
+func TestTranslateProgram_ExternGlobal(t *testing.T) {
+	// extern long e; extern int d; int d = 1;
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{StorageClass: "extern", Name: "e", TypeSpec: "long"},
+			cabs.VarDef{StorageClass: "extern", Name: "d", TypeSpec: "int"},
+			cabs.VarDef{Name: "d", TypeSpec: "int", Initializer: cabs.Constant{Value: 1}},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	want := []clight.VarDecl{
+		{Name: "d", Type: ctypes.Int(), Init: []byte{1, 0, 0, 0}},
+		{Name: "e", Type: ctypes.Long(), Extern: true},
+	}
+	if !reflect.DeepEqual(result.Globals, want) {
+		t.Errorf("globals = %+v, want %+v", result.Globals, want)
+	}
+}
+
+func TestTranslateProgram_TentativeDefinitions(t *testing.T) {
+	// int h; int h; int h = 3; static int s; int s;
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "h", TypeSpec: "int"},
+			cabs.VarDef{Name: "h", TypeSpec: "int"},
+			cabs.VarDef{Name: "h", TypeSpec: "int", Initializer: cabs.Constant{Value: 3}},
+			cabs.VarDef{StorageClass: "static", Name: "s", TypeSpec: "int"},
+			cabs.VarDef{Name: "s", TypeSpec: "int"},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	want := []clight.VarDecl{
+		{Name: "h", Type: ctypes.Int(), Init: []byte{3, 0, 0, 0}},
+		{Name: "s", Type: ctypes.Int(), Static: true},
+	}
+	if !reflect.DeepEqual(result.Globals, want) {
+		t.Errorf("globals = %+v, want %+v", result.Globals, want)
+	}
+}
+
+func TestTranslateProgram_PlainCharSign(t *testing.T) {
+	// char c; char f(char p) { return p; }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.VarDef{Name: "c", TypeSpec: "char"},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "char",
+				Params:     []cabs.Param{{Name: "p", TypeSpec: "char"}},
+				Body:       &cabs.Block{Items: []cabs.Stmt{cabs.Return{Expr: cabs.Variable{Name: "p"}}}},
+			},
+		},
+	}
+	for _, sign := range []ctypes.Signedness{ctypes.Signed, ctypes.Unsigned} {
+		result := TranslateProgramWithOptions(prog, Options{CharSign: sign})
+		want := ctypes.PlainChar(sign)
+		if got := result.Globals[0].Type; !ctypes.Equal(got, want) {
+			t.Errorf("%v: global c has type %v, want %v", sign, got, want)
+		}
+		fn := result.Functions[0]
+		if !ctypes.Equal(fn.Return, want) || !ctypes.Equal(fn.Params[0].Type, want) {
+			t.Errorf("%v: f has return %v and parameter %v, want %v", sign, fn.Return, fn.Params[0].Type, want)
+		}
+	}
+}
+
+func TestTranslateProgram_ArrayParameter(t *testing.T) {
+	// int f(int a[2][3]) { return a[1][2]; }, whose a the parser adjusts to int (*a)[3]
+	a := cabs.Variable{Name: "a"}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Params:     []cabs.Param{{Name: "a", TypeSpec: "int (*)[3]"}},
+				Body: &cabs.Block{Items: []cabs.Stmt{
+					cabs.Return{Expr: cabs.Index{
+						Array: cabs.Index{Array: a, Index: cabs.Constant{Value: 1}},
+						Index: cabs.Constant{Value: 2},
+					}},
+				}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	fn := result.Functions[0]
+	row := ctypes.Pointer(ctypes.Array(ctypes.Int(), 3))
+	if !reflect.DeepEqual(fn.Params[0].Type, row) {
+		t.Errorf("param a: type %v, want %v", fn.Params[0].Type, row)
+	}
+	// a[1] steps over a whole row of 3 ints
+	ret := fn.Body.(clight.Sreturn)
+	inner := ret.Value.(clight.Ederef).Ptr.(clight.Ebinop).Left.(clight.Eaddrof).Arg.(clight.Ederef)
+	if typ := inner.Ptr.ExprType(); !reflect.DeepEqual(typ, row) {
+		t.Errorf("a + 1: type %v, want %v", typ, row)
+	}
+	if size := SizeofType(inner.Typ); size != 12 {
+		t.Errorf("row size = %d, want 12", size)
+	}
+}
+
+func TestTranslateProgram_TypedefTypes(t *testing.T) {
+	// typedef double real; typedef struct { int a; long b; } pair;
+	// typedef pair *pairp; real g; real f(real x, pairp p) { pair q; ... }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.TypedefDef{Name: "real", TypeSpec: "double"},
+			cabs.TypedefDef{Name: "pair", InlineType: cabs.StructDef{
+				Fields: []cabs.StructField{{Name: "a", TypeSpec: "int"}, {Name: "b", TypeSpec: "long"}},
+			}},
+			cabs.TypedefDef{Name: "pairp", TypeSpec: "pair*"},
+			cabs.VarDef{Name: "g", TypeSpec: "real"},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "real",
+				Params:     []cabs.Param{{Name: "x", TypeSpec: "real"}, {Name: "p", TypeSpec: "pairp"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.DeclStmt{Decls: []cabs.Decl{{Name: "q", TypeSpec: "pair"}}},
+						cabs.Return{Expr: cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "x"}, Right: cabs.Variable{Name: "g"}}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	if len(result.Structs) != 1 || result.Structs[0].Name != "pair" {
+		t.Fatalf("expected the anonymous struct to be named pair, got %+v", result.Structs)
+	}
+	if !ctypes.Equal(result.Globals[0].Type, ctypes.Double()) {
+		t.Errorf("expected global g to be a double, got %v", result.Globals[0].Type)
+	}
+	fn := result.Functions[0]
+	if !ctypes.Equal(fn.Return, ctypes.Double()) || !ctypes.Equal(fn.Params[0].Type, ctypes.Double()) {
+		t.Errorf("expected real to resolve to double, got %v and %v", fn.Return, fn.Params[0].Type)
+	}
+	ptr, ok := fn.Params[1].Type.(ctypes.Tpointer)
+	if !ok {
+		t.Fatalf("expected pairp to be a pointer, got %v", fn.Params[1].Type)
+	}
+	if st, ok := ptr.Elem.(ctypes.Tstruct); !ok || st.Name != "pair" {
+		t.Errorf("expected a pointer to struct pair, got %v", ptr)
+	}
+	if len(fn.Locals) != 1 {
+		t.Fatalf("expected local q, got %v", fn.Locals)
+	}
+	if st, ok := fn.Locals[0].Type.(ctypes.Tstruct); !ok || len(st.Fields) != 2 {
+		t.Errorf("expected q to be the defined struct, got %v", fn.Locals[0].Type)
+	}
+	ret := flattenSeq(fn.Body)[0].(clight.Sreturn)
+	if !ctypes.Equal(ret.Value.ExprType(), ctypes.Double()) {
+		t.Errorf("expected x + g to be a double, got %v", ret.Value.ExprType())
+	}
+}
+
 func TestTypeFromString(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -518,6 +1281,54 @@ func TestTransformStmt_Switch(t *testing.T) {
 	}
 }
 
+func TestTransformStmt_SwitchDefaultBeforeCase(t *testing.T) {
+	// switch (x) { case 1: y = 1; default: y = 2; case 3: y = 3; }
+	assign := func(v int64) []cabs.Stmt {
+		return []cabs.Stmt{cabs.Computation{Expr: cabs.Binary{Op: cabs.OpAssign, Left: cabs.Variable{Name: "y"}, Right: cabs.Constant{Value: v}}}}
+	}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "void",
+				Params:     []cabs.Param{{Name: "x", TypeSpec: "int"}, {Name: "y", TypeSpec: "int"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.Switch{
+							Expr: cabs.Variable{Name: "x"},
+							Cases: []cabs.SwitchCase{
+								{Expr: cabs.Constant{Value: 1}, Stmts: assign(1)},
+								{Expr: nil, Stmts: assign(2)},
+								{Expr: cabs.Constant{Value: 3}, Stmts: assign(3)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	sw, ok := result.Functions[0].Body.(clight.Sswitch)
+	if !ok {
+		t.Fatalf("expected Sswitch, got %T", result.Functions[0].Body)
+	}
+
+	// The default body is placed at the end of case 1, so that case 1 falls
+	// into it and it falls into case 3, and default jumps to it
+	gt, ok := sw.Default.(clight.Sgoto)
+	if !ok {
+		t.Fatalf("expected default to be a goto, got %T", sw.Default)
+	}
+	stmts := flattenSeq(sw.Cases[0].Body)
+	label, ok := stmts[len(stmts)-1].(clight.Slabel)
+	if !ok || label.Label != gt.Label {
+		t.Fatalf("expected case 1 to end in label %q, got %#v", gt.Label, stmts[len(stmts)-1])
+	}
+	if _, ok := sw.Cases[1].Body.(clight.Slabel); ok {
+		t.Error("expected case 3 to stay unlabeled")
+	}
+}
+
 func TestTransformStmt_GotoLabel(t *testing.T) {
 	prog := &cabs.Program{
 		Definitions: []cabs.Definition{
@@ -585,6 +1396,183 @@ func TestTransformStmt_Computation(t *testing.T) {
 	}
 }
 
+func TestTransformStmt_StatementExpression(t *testing.T) {
+	// int sq(int a) { return ({ int t = a; t * t; }); }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "sq",
+				ReturnType: "int",
+				Params:     []cabs.Param{{Name: "a", TypeSpec: "int"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.Return{Expr: cabs.StmtExpr{
+							Block: &cabs.Block{Items: []cabs.Stmt{
+								cabs.DeclStmt{Decls: []cabs.Decl{{
+									TypeSpec:    "int",
+									Name:        "t",
+									Initializer: cabs.Variable{Name: "a"},
+								}}},
+							}},
+							Result: cabs.Binary{
+								Op:    cabs.OpMul,
+								Left:  cabs.Variable{Name: "t"},
+								Right: cabs.Variable{Name: "t"},
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	if len(result.Functions) != 1 {
+		t.Fatalf("expected 1 function")
+	}
+	fn := result.Functions[0]
+
+	stmts := flattenSeq(fn.Body)
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements (t = a; tmp = t * t; return tmp), got %d: %v", len(stmts), stmts)
+	}
+	// The block-local t is promoted to a temporary and initialised from a
+	init, ok := stmts[0].(clight.Sset)
+	if !ok {
+		t.Fatalf("expected Sset for t = a, got %T", stmts[0])
+	}
+	if v, ok := init.RHS.(clight.Evar); !ok || v.Name != "a" {
+		t.Errorf("expected t initialised from a, got %v", init.RHS)
+	}
+	// The trailing expression is captured before the return uses it
+	value, ok := stmts[1].(clight.Sset)
+	if !ok {
+		t.Fatalf("expected Sset for the result, got %T", stmts[1])
+	}
+	if mul, ok := value.RHS.(clight.Ebinop); !ok || mul.Op != clight.Omul {
+		t.Errorf("expected t * t, got %v", value.RHS)
+	}
+	ret, ok := stmts[2].(clight.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", stmts[2])
+	}
+	if tv, ok := ret.Value.(clight.Etempvar); !ok || tv.ID != value.TempID {
+		t.Errorf("expected return of $%d, got %v", value.TempID, ret.Value)
+	}
+}
+
+func TestTransformStmt_LogicalInitializer(t *testing.T) {
+	// int f(int a, int b) { int x = a && b; int *p = &x; return *p; }
+	// x has its address taken, so it stays in memory and is stored to.
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Params:     []cabs.Param{{Name: "a", TypeSpec: "int"}, {Name: "b", TypeSpec: "int"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.DeclStmt{Decls: []cabs.Decl{{
+							TypeSpec:    "int",
+							Name:        "x",
+							Initializer: cabs.Binary{Op: cabs.OpAnd, Left: cabs.Variable{Name: "a"}, Right: cabs.Variable{Name: "b"}},
+						}}},
+						cabs.DeclStmt{Decls: []cabs.Decl{{
+							TypeSpec:    "int*",
+							Name:        "p",
+							Initializer: cabs.Unary{Op: cabs.OpAddrOf, Expr: cabs.Variable{Name: "x"}},
+						}}},
+						cabs.Return{Expr: cabs.Unary{Op: cabs.OpDeref, Expr: cabs.Variable{Name: "p"}}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	if len(result.Functions) != 1 {
+		t.Fatalf("expected 1 function")
+	}
+	stmts := flattenSeq(result.Functions[0].Body)
+	if len(stmts) < 2 {
+		t.Fatalf("expected the && lowering followed by the store, got %v", stmts)
+	}
+
+	// if (a) { if (b) $n = 1; else $n = 0; } else $n = 0;
+	ite, ok := stmts[0].(clight.Sifthenelse)
+	if !ok {
+		t.Fatalf("expected Sifthenelse computing a && b, got %T", stmts[0])
+	}
+	result0, ok := ite.Else.(clight.Sset)
+	if !ok {
+		t.Fatalf("expected $n = 0 when a is false, got %v", ite.Else)
+	}
+	// x = $n
+	store, ok := stmts[1].(clight.Sassign)
+	if !ok {
+		t.Fatalf("expected Sassign to x, got %T", stmts[1])
+	}
+	if v, ok := store.LHS.(clight.Evar); !ok || v.Name != "x" {
+		t.Errorf("expected store to x, got %v", store.LHS)
+	}
+	if tv, ok := store.RHS.(clight.Etempvar); !ok || tv.ID != result0.TempID {
+		t.Errorf("expected x = $%d, got %v", result0.TempID, store.RHS)
+	}
+}
+
+func TestTransformStmt_LogicalReturn(t *testing.T) {
+	// int f(int a, int b) { return a || b; }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Params:     []cabs.Param{{Name: "a", TypeSpec: "int"}, {Name: "b", TypeSpec: "int"}},
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.Return{Expr: cabs.Binary{Op: cabs.OpOr, Left: cabs.Variable{Name: "a"}, Right: cabs.Variable{Name: "b"}}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	if len(result.Functions) != 1 {
+		t.Fatalf("expected 1 function")
+	}
+	stmts := flattenSeq(result.Functions[0].Body)
+	if len(stmts) != 2 {
+		t.Fatalf("expected the || lowering followed by the return, got %d: %v", len(stmts), stmts)
+	}
+
+	// if (a) $n = 1; else { if (b) $n = 1; else $n = 0; }
+	ite, ok := stmts[0].(clight.Sifthenelse)
+	if !ok {
+		t.Fatalf("expected Sifthenelse computing a || b, got %T", stmts[0])
+	}
+	result1, ok := ite.Then.(clight.Sset)
+	if !ok {
+		t.Fatalf("expected $n = 1 when a is true, got %v", ite.Then)
+	}
+	ret, ok := stmts[1].(clight.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", stmts[1])
+	}
+	if tv, ok := ret.Value.(clight.Etempvar); !ok || tv.ID != result1.TempID {
+		t.Errorf("expected return of $%d, got %v", result1.TempID, ret.Value)
+	}
+}
+
+// flattenSeq lists the statements of a sequence in order, dropping skips.
+func flattenSeq(stmt clight.Stmt) []clight.Stmt {
+	switch s := stmt.(type) {
+	case clight.Ssequence:
+		return append(flattenSeq(s.First), flattenSeq(s.Second)...)
+	case clight.Sskip:
+		return nil
+	default:
+		return []clight.Stmt{s}
+	}
+}
+
 func containsLoop(stmt clight.Stmt) bool {
 	switch s := stmt.(type) {
 	case clight.Sloop:
@@ -595,3 +1583,224 @@ func containsLoop(stmt clight.Stmt) bool {
 		return false
 	}
 }
+
+func TestTranslateProgram_PointerQualifiers(t *testing.T) {
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "int",
+				Params: []cabs.Param{
+					// const char *a
+					{Name: "a", TypeSpec: "char*", Quals: cabs.Qualifiers{
+						Base:     []cabs.TypeQualifier{cabs.QualConst},
+						Pointers: [][]cabs.TypeQualifier{nil},
+					}},
+					// char *const b
+					{Name: "b", TypeSpec: "char*", Quals: cabs.Qualifiers{
+						Pointers: [][]cabs.TypeQualifier{{cabs.QualConst}},
+					}},
+					{Name: "c", TypeSpec: "char*"},
+				},
+				Body: &cabs.Block{Items: []cabs.Stmt{}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+	params := result.Functions[0].Params
+
+	if a := params[0].Quals; a.At(0).Const || !a.At(1).Const {
+		t.Errorf("a: expected non-const pointer to const, got %+v", a)
+	}
+	if b := params[1].Quals; !b.At(0).Const || b.At(1).Const {
+		t.Errorf("b: expected const pointer to non-const, got %+v", b)
+	}
+	if params[2].Quals != nil {
+		t.Errorf("c: expected no qualifiers, got %+v", params[2].Quals)
+	}
+}
+
+func TestTranslateProgram_TypedefQualifiers(t *testing.T) {
+	constPtr := cabs.Qualifiers{Pointers: [][]cabs.TypeQualifier{{cabs.QualConst}}}
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			// typedef void (* const handler_t)(int);
+			cabs.TypedefDef{Name: "handler_t", TypeSpec: "void(*)(int)", Quals: constPtr},
+			// typedef handler_t alias_t;
+			cabs.TypedefDef{Name: "alias_t", TypeSpec: "handler_t"},
+			cabs.StructDef{Name: "S", Fields: []cabs.StructField{{Name: "h", TypeSpec: "handler_t"}}},
+			cabs.VarDef{Name: "g", TypeSpec: "alias_t"},
+			// handler_t *table; points to const pointers
+			cabs.VarDef{Name: "table", TypeSpec: "handler_t*", Quals: cabs.Qualifiers{Pointers: [][]cabs.TypeQualifier{nil}}},
+			cabs.FunDef{
+				Name:       "f",
+				ReturnType: "void",
+				Params: []cabs.Param{
+					{Name: "h", TypeSpec: "handler_t"},
+					// volatile handler_t v
+					{Name: "v", TypeSpec: "handler_t", Quals: cabs.Qualifiers{Base: []cabs.TypeQualifier{cabs.QualVolatile}}},
+				},
+				Body: &cabs.Block{Items: []cabs.Stmt{}},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	fnPtr := ctypes.Pointer(ctypes.Tfunction{Params: []ctypes.Type{ctypes.Int()}, Return: ctypes.Void()})
+	if len(result.Structs) != 1 || !ctypes.Equal(result.Structs[0].Fields[0].Type, fnPtr) {
+		t.Errorf("expected field h to be a function pointer, got %+v", result.Structs)
+	}
+
+	globals := make(map[string]clight.VarDecl)
+	for _, g := range result.Globals {
+		globals[g.Name] = g
+	}
+	if g := globals["g"]; !ctypes.Equal(g.Type, fnPtr) || !g.Quals.At(0).Const {
+		t.Errorf("g: expected const function pointer through the typedef chain, got %v %+v", g.Type, g.Quals)
+	}
+	if table := globals["table"]; table.Quals.At(0).Const || !table.Quals.At(1).Const {
+		t.Errorf("table: expected pointer to const function pointer, got %+v", table.Quals)
+	}
+
+	params := result.Functions[0].Params
+	if h := params[0].Quals; !h.At(0).Const {
+		t.Errorf("h: expected const function pointer, got %+v", h)
+	}
+	if v := params[1].Quals; !v.At(0).Const || !v.At(0).Volatile {
+		t.Errorf("v: expected const volatile function pointer, got %+v", v)
+	}
+}
+
+func TestTransformDeclInit_StringToCharArray(t *testing.T) {
+	// char m[3] = "ab"; stores the characters, not the address of the literal
+	simplExpr := simplexpr.New()
+	simplExpr.SetType("m", ctypes.Array(ctypes.Char(), 3))
+	decl := cabs.Decl{Name: "m", TypeSpec: "char", ArrayDims: []cabs.Expr{cabs.Constant{Value: 3}}, Initializer: cabs.StringLiteral{Value: "ab"}}
+
+	stmts := transformDeclInit(decl, simplExpr)
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 assignments, got %d: %v", len(stmts), stmts)
+	}
+	for i, want := range []int64{'a', 'b', 0} {
+		rhs := stmts[i].(clight.Sassign).RHS
+		if cast, ok := rhs.(clight.Ecast); ok {
+			rhs = cast.Arg
+		}
+		if c, ok := rhs.(clight.Econst_int); !ok || c.Value != want {
+			t.Errorf("element %d: expected %d, got %v", i, want, rhs)
+		}
+	}
+}
+
+func TestInitializeAggregate_PartialBraces(t *testing.T) {
+	// int m[2][2] = {{1}, 2, 3}: the first row is braced and zero-filled,
+	// the second takes the remaining items of the outer list
+	m := cabs.Variable{Name: "m"}
+	typ := ctypes.Array(ctypes.Array(ctypes.Int(), 2), 2)
+	list := cabs.InitList{Items: []cabs.Expr{
+		cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 1}}},
+		cabs.Constant{Value: 2},
+		cabs.Constant{Value: 3},
+	}}
+	elem := func(i, j int64) cabs.Expr {
+		return cabs.Index{Array: cabs.Index{Array: m, Index: cabs.Constant{Value: i}}, Index: cabs.Constant{Value: j}}
+	}
+	want := []cabs.Binary{
+		assign(elem(0, 0), cabs.Constant{Value: 1}),
+		assign(elem(0, 1), cabs.Constant{Value: 0}),
+		assign(elem(1, 0), cabs.Constant{Value: 2}),
+		assign(elem(1, 1), cabs.Constant{Value: 3}),
+	}
+
+	got := initializeAggregate(m, typ, list, simplexpr.New())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
+func TestInitializeAggregate_Designators(t *testing.T) {
+	// int t[6] = {[2 ... 4] = 1, [0] = 7, 8}: the range stores 1 to each of
+	// its elements, the next item follows the designated one, and the
+	// element left over is zeroed
+	a := cabs.Variable{Name: "t"}
+	typ := ctypes.Array(ctypes.Int(), 6)
+	list := cabs.InitList{Items: []cabs.Expr{
+		cabs.Designated{Index: 2, Last: 4, Value: cabs.Constant{Value: 1}},
+		cabs.Designated{Index: 0, Last: 0, Value: cabs.Constant{Value: 7}},
+		cabs.Constant{Value: 8},
+	}}
+	elem := func(i int64) cabs.Expr {
+		return cabs.Index{Array: a, Index: cabs.Constant{Value: i}}
+	}
+	want := []cabs.Binary{
+		assign(elem(2), cabs.Constant{Value: 1}),
+		assign(elem(3), cabs.Constant{Value: 1}),
+		assign(elem(4), cabs.Constant{Value: 1}),
+		assign(elem(0), cabs.Constant{Value: 7}),
+		assign(elem(1), cabs.Constant{Value: 8}),
+		assign(elem(5), cabs.Constant{Value: 0}),
+	}
+
+	got := initializeAggregate(a, typ, list, simplexpr.New())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
+func TestInitializeAggregate_DesignatorEndsBraceElision(t *testing.T) {
+	// int m[2][2] = {[1] = 1, 2, [0] = 3}: the rows take items without
+	// braces until a designator names another row
+	m := cabs.Variable{Name: "m"}
+	typ := ctypes.Array(ctypes.Array(ctypes.Int(), 2), 2)
+	list := cabs.InitList{Items: []cabs.Expr{
+		cabs.Designated{Index: 1, Last: 1, Value: cabs.Constant{Value: 1}},
+		cabs.Constant{Value: 2},
+		cabs.Designated{Index: 0, Last: 0, Value: cabs.Constant{Value: 3}},
+	}}
+	elem := func(i, j int64) cabs.Expr {
+		return cabs.Index{Array: cabs.Index{Array: m, Index: cabs.Constant{Value: i}}, Index: cabs.Constant{Value: j}}
+	}
+	want := []cabs.Binary{
+		assign(elem(1, 0), cabs.Constant{Value: 1}),
+		assign(elem(1, 1), cabs.Constant{Value: 2}),
+		assign(elem(0, 0), cabs.Constant{Value: 3}),
+		assign(elem(0, 1), cabs.Constant{Value: 0}),
+	}
+
+	got := initializeAggregate(m, typ, list, simplexpr.New())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
+func TestTranslateProgram_Func(t *testing.T) {
+	// int foo(void) { const char *n = __func__; return 0; }
+	prog := &cabs.Program{
+		Definitions: []cabs.Definition{
+			cabs.FunDef{
+				Name:       "foo",
+				ReturnType: "int",
+				Body: &cabs.Block{
+					Items: []cabs.Stmt{
+						cabs.DeclStmt{
+							Decls: []cabs.Decl{
+								{Name: "n", TypeSpec: "char*", Initializer: cabs.Variable{Name: "__func__"}},
+							},
+						},
+						cabs.Return{Expr: cabs.Constant{Value: 0}},
+					},
+				},
+			},
+		},
+	}
+	result := TranslateProgram(prog)
+
+	stmts := flattenSeq(result.Functions[0].Body)
+	set, ok := stmts[0].(clight.Sset)
+	if !ok {
+		t.Fatalf("expected n promoted and set, got %#v", stmts[0])
+	}
+	if str, ok := set.RHS.(clight.Estring); !ok || str.Value != "foo" {
+		t.Errorf("expected __func__ to be \"foo\", got %#v", set.RHS)
+	}
+}
@@ -0,0 +1,234 @@
+package clightgen
+
+import (
+	"fmt"
+
+	"github.com/raymyers/ralph-cc/pkg/cabs"
+)
+
+// scopes renames the block-scope variables of a function apart. The
+// environments of the later passes map each name to a single type, so a
+// declaration of a name already declared in the function, as the inner x
+// of { int x; { double x; } }, is given a name of its own: "x.1", which no
+// C identifier can clash with. Each use is resolved against the blocks
+// enclosing it, innermost first. A use no block declares that names an
+// enumerator is replaced by its value.
+type scopes struct {
+	declared map[string]int      // number of declarations of each name so far
+	blocks   []map[string]string // per enclosing block, the names its declarations were given
+	enums    map[string]int64    // values of the file-scope enumerators
+}
+
+// renameLocals returns a copy of fn whose block-scope declarations and
+// their uses are renamed apart, see scopes.
+func renameLocals(fn *cabs.FunDef, enums map[string]int64) *cabs.FunDef {
+	if fn.Body == nil {
+		return fn
+	}
+	s := &scopes{declared: make(map[string]int), enums: enums}
+	s.push()
+	for _, p := range fn.Params {
+		s.bind(p.Name)
+	}
+	renamed := *fn
+	renamed.Body = s.block(fn.Body)
+	return &renamed
+}
+
+func (s *scopes) push() {
+	s.blocks = append(s.blocks, make(map[string]string))
+}
+
+func (s *scopes) pop() {
+	s.blocks = s.blocks[:len(s.blocks)-1]
+}
+
+// bind declares name in the innermost block and returns its new name
+func (s *scopes) bind(name string) string {
+	renamed := name
+	if n := s.declared[name]; n > 0 {
+		renamed = fmt.Sprintf("%s.%d", name, n)
+	}
+	s.declared[name]++
+	s.blocks[len(s.blocks)-1][name] = renamed
+	return renamed
+}
+
+// lookup returns the name a use of name refers to. Names not declared in
+// the function are globals and keep their name.
+func (s *scopes) lookup(name string) string {
+	if renamed, ok := s.local(name); ok {
+		return renamed
+	}
+	return name
+}
+
+// local returns the name the innermost declaration of name in the
+// enclosing blocks was given, if there is one.
+func (s *scopes) local(name string) (string, bool) {
+	for i := len(s.blocks) - 1; i >= 0; i-- {
+		if renamed, ok := s.blocks[i][name]; ok {
+			return renamed, true
+		}
+	}
+	return "", false
+}
+
+func (s *scopes) block(b *cabs.Block) *cabs.Block {
+	if b == nil {
+		return nil
+	}
+	s.push()
+	defer s.pop()
+	return &cabs.Block{Items: s.stmts(b.Items)}
+}
+
+func (s *scopes) stmts(stmts []cabs.Stmt) []cabs.Stmt {
+	if stmts == nil {
+		return nil
+	}
+	result := make([]cabs.Stmt, len(stmts))
+	for i, stmt := range stmts {
+		result[i] = s.stmt(stmt)
+	}
+	return result
+}
+
+// decls renames the declarators of a declaration. The scope of each begins
+// after its declarator, so its array dimensions and typeof operand see the
+// outer name and its initializer the new one. An extern declaration names
+// the global and is not renamed.
+func (s *scopes) decls(decls []cabs.Decl) []cabs.Decl {
+	if decls == nil {
+		return nil
+	}
+	result := make([]cabs.Decl, len(decls))
+	for i, d := range decls {
+		d.ArrayDims = s.exprs(d.ArrayDims)
+		d.Typeof = s.expr(d.Typeof)
+		if d.StorageClass == "extern" {
+			s.blocks[len(s.blocks)-1][d.Name] = d.Name
+		} else {
+			d.Name = s.bind(d.Name)
+		}
+		d.Initializer = s.expr(d.Initializer)
+		result[i] = d
+	}
+	return result
+}
+
+func (s *scopes) stmt(stmt cabs.Stmt) cabs.Stmt {
+	switch st := stmt.(type) {
+	case cabs.Return:
+		st.Expr = s.expr(st.Expr)
+		return st
+	case cabs.Computation:
+		st.Expr = s.expr(st.Expr)
+		return st
+	case cabs.If:
+		st.Cond = s.expr(st.Cond)
+		st.Then = s.stmt(st.Then)
+		st.Else = s.stmt(st.Else)
+		return st
+	case cabs.While:
+		st.Cond = s.expr(st.Cond)
+		st.Body = s.stmt(st.Body)
+		return st
+	case cabs.DoWhile:
+		st.Body = s.stmt(st.Body)
+		st.Cond = s.expr(st.Cond)
+		return st
+	case cabs.For:
+		// The declarations of the init clause are in scope in the loop only
+		s.push()
+		defer s.pop()
+		st.Init = s.expr(st.Init)
+		st.InitDecl = s.decls(st.InitDecl)
+		st.Cond = s.expr(st.Cond)
+		st.Step = s.expr(st.Step)
+		st.Body = s.stmt(st.Body)
+		return st
+	case cabs.Switch:
+		st.Expr = s.expr(st.Expr)
+		s.push()
+		defer s.pop()
+		if st.Cases != nil {
+			cases := make([]cabs.SwitchCase, len(st.Cases))
+			for i, c := range st.Cases {
+				cases[i] = cabs.SwitchCase{Expr: s.expr(c.Expr), Stmts: s.stmts(c.Stmts)}
+			}
+			st.Cases = cases
+		}
+		return st
+	case cabs.Label:
+		st.Stmt = s.stmt(st.Stmt)
+		return st
+	case cabs.Block:
+		return *s.block(&st)
+	case *cabs.Block:
+		return s.block(st)
+	case cabs.DeclStmt:
+		st.Decls = s.decls(st.Decls)
+		return st
+	}
+	return stmt // nil, skip, break, continue and goto
+}
+
+func (s *scopes) exprs(exprs []cabs.Expr) []cabs.Expr {
+	if exprs == nil {
+		return nil
+	}
+	result := make([]cabs.Expr, len(exprs))
+	for i, e := range exprs {
+		result[i] = s.expr(e)
+	}
+	return result
+}
+
+func (s *scopes) expr(e cabs.Expr) cabs.Expr {
+	switch ex := e.(type) {
+	case cabs.Variable:
+		if renamed, ok := s.local(ex.Name); ok {
+			return cabs.Variable{Name: renamed}
+		}
+		if value, ok := s.enums[ex.Name]; ok {
+			// C99 6.4.4.3: an enumeration constant has type int
+			return cabs.Constant{Value: value, Type: "int"}
+		}
+		return ex
+	case cabs.Unary:
+		return cabs.Unary{Op: ex.Op, Expr: s.expr(ex.Expr)}
+	case cabs.Binary:
+		return cabs.Binary{Op: ex.Op, Left: s.expr(ex.Left), Right: s.expr(ex.Right)}
+	case cabs.Paren:
+		return cabs.Paren{Expr: s.expr(ex.Expr)}
+	case cabs.Conditional:
+		return cabs.Conditional{Cond: s.expr(ex.Cond), Then: s.expr(ex.Then), Else: s.expr(ex.Else)}
+	case cabs.Call:
+		return cabs.Call{Func: s.expr(ex.Func), Args: s.exprs(ex.Args)}
+	case cabs.Index:
+		return cabs.Index{Array: s.expr(ex.Array), Index: s.expr(ex.Index)}
+	case cabs.Member:
+		return cabs.Member{Expr: s.expr(ex.Expr), Name: ex.Name, IsArrow: ex.IsArrow}
+	case cabs.SizeofExpr:
+		return cabs.SizeofExpr{Expr: s.expr(ex.Expr)}
+	case cabs.Cast:
+		return cabs.Cast{TypeName: ex.TypeName, Expr: s.expr(ex.Expr)}
+	case cabs.VaArg:
+		return cabs.VaArg{Expr: s.expr(ex.Expr), TypeName: ex.TypeName}
+	case cabs.StmtExpr:
+		// The result is the last statement of the block, in its scope
+		s.push()
+		defer s.pop()
+		var block *cabs.Block
+		if ex.Block != nil {
+			block = &cabs.Block{Items: s.stmts(ex.Block.Items)}
+		}
+		return cabs.StmtExpr{Block: block, Result: s.expr(ex.Result)}
+	case cabs.InitList:
+		return cabs.InitList{Items: s.exprs(ex.Items)}
+	case cabs.Designated:
+		return cabs.Designated{Index: ex.Index, Last: ex.Last, Value: s.expr(ex.Value)}
+	}
+	return e // nil, constants, literals and sizeof(type)
+}
@@ -38,8 +38,14 @@ func coerceToType(expr clight.Expr, targetType ctypes.Type) clight.Expr {
 	return expr
 }
 
-// transformStmt transforms a Cabs statement to a Clight statement.
+// transformStmt transforms a Cabs statement to a Clight statement. The
+// Clight statements it is lowered to carry its position, unless they come
+// from a nested statement with a position of its own.
 func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt {
+	return clight.WithPos(lowerStmt(stmt, simplExpr), cabs.StmtPos(stmt))
+}
+
+func lowerStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt {
 	switch s := stmt.(type) {
 	case cabs.Return:
 		if s.Expr == nil {
@@ -49,8 +55,7 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 		return clight.Seq(append(result.Stmts, clight.Sreturn{Value: result.Expr})...)
 
 	case cabs.Computation:
-		result := simplExpr.TransformExpr(s.Expr)
-		return clight.Seq(result.Stmts...)
+		return clight.Seq(simplExpr.TransformExprForEffects(s.Expr)...)
 
 	case cabs.If:
 		condResult := simplExpr.TransformExpr(s.Cond)
@@ -97,21 +102,12 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 		// The step is in the Continue field so that 'continue' statements execute it
 		var initStmt clight.Stmt = clight.Sskip{}
 		if s.Init != nil {
-			initResult := simplExpr.TransformExpr(s.Init)
-			initStmt = clight.Seq(initResult.Stmts...)
+			initStmt = clight.Seq(simplExpr.TransformExprForEffects(s.Init)...)
 		} else if len(s.InitDecl) > 0 {
 			// C99 for-loop declaration: for (int i = 0; ...)
 			var stmts []clight.Stmt
 			for _, decl := range s.InitDecl {
-				if decl.Initializer != nil {
-					typ := TypeFromString(decl.TypeSpec)
-					result := simplExpr.TransformExpr(decl.Initializer)
-					stmts = append(stmts, result.Stmts...)
-					stmts = append(stmts, clight.Sassign{
-						LHS: clight.Evar{Name: decl.Name, Typ: typ},
-						RHS: coerceToType(result.Expr, typ),
-					})
-				}
+				stmts = append(stmts, clight.WithPos(clight.Seq(transformDeclInit(decl, simplExpr)...), decl.Pos))
 			}
 			initStmt = clight.Seq(stmts...)
 		}
@@ -128,8 +124,7 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 
 		var stepStmt clight.Stmt = clight.Sskip{}
 		if s.Step != nil {
-			stepResult := simplExpr.TransformExpr(s.Step)
-			stepStmt = clight.Seq(stepResult.Stmts...)
+			stepStmt = clight.Seq(simplExpr.TransformExprForEffects(s.Step)...)
 		}
 
 		loopBody := clight.Sifthenelse{
@@ -150,6 +145,7 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 		exprResult := simplExpr.TransformExpr(s.Expr)
 		var cases []clight.SwitchCase
 		var defaultStmt clight.Stmt = clight.Sskip{}
+		defaultPos := -1
 		for _, c := range s.Cases {
 			if c.Expr == nil {
 				// default case
@@ -158,6 +154,7 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 					stmts = append(stmts, transformStmt(st, simplExpr))
 				}
 				defaultStmt = clight.Seq(stmts...)
+				defaultPos = len(cases)
 			} else {
 				// case with value
 				var stmts []clight.Stmt
@@ -172,6 +169,21 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 				}
 			}
 		}
+		// Case bodies fall through in order and the last one into default.
+		// A default written before other cases keeps its place with a label:
+		// the case before it ends in the default body and default jumps there,
+		// or a leading default jumps on into the first case.
+		if defaultPos >= 0 && defaultPos < len(cases) {
+			label := simplExpr.NewLabel()
+			if defaultPos > 0 {
+				prev := &cases[defaultPos-1]
+				prev.Body = clight.Seq(prev.Body, clight.Slabel{Label: label, Stmt: defaultStmt})
+				defaultStmt = clight.Sgoto{Label: label}
+			} else {
+				cases[0].Body = clight.Slabel{Label: label, Stmt: cases[0].Body}
+				defaultStmt = clight.Seq(defaultStmt, clight.Sgoto{Label: label})
+			}
+		}
 		return clight.Seq(append(exprResult.Stmts, clight.Sswitch{
 			Expr:    exprResult.Expr,
 			Cases:   cases,
@@ -195,15 +207,7 @@ func transformStmt(stmt cabs.Stmt, simplExpr *simplexpr.Transformer) clight.Stmt
 		// Declarations with initializers become assignments
 		var stmts []clight.Stmt
 		for _, decl := range s.Decls {
-			if decl.Initializer != nil {
-				typ := TypeFromString(decl.TypeSpec)
-				result := simplExpr.TransformExpr(decl.Initializer)
-				stmts = append(stmts, result.Stmts...)
-				stmts = append(stmts, clight.Sassign{
-					LHS: clight.Evar{Name: decl.Name, Typ: typ},
-					RHS: coerceToType(result.Expr, typ),
-				})
-			}
+			stmts = append(stmts, clight.WithPos(clight.Seq(transformDeclInit(decl, simplExpr)...), decl.Pos))
 		}
 		return clight.Seq(stmts...)
 
@@ -3,6 +3,7 @@ package clightgen
 import (
 	"strings"
 
+	"github.com/raymyers/ralph-cc/pkg/cabs"
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
 )
 
@@ -34,6 +35,9 @@ func SizeofType(t ctypes.Type) int64 {
 	case ctypes.Tpointer:
 		return 8 // 64-bit pointers
 	case ctypes.Tarray:
+		if t.Size < 0 {
+			return 0 // incomplete array, e.g. a flexible array member
+		}
 		return t.Size * SizeofType(t.Elem)
 	case ctypes.Tstruct:
 		var total int64
@@ -62,8 +66,10 @@ func TypeFromString(typeName string) ctypes.Type {
 	switch typeName {
 	case "void":
 		return ctypes.Void()
-	case "char", "signed char":
+	case "char":
 		return ctypes.Char()
+	case "signed char":
+		return ctypes.SChar()
 	case "unsigned char":
 		return ctypes.UChar()
 	case "short", "signed short", "short int", "signed short int":
@@ -84,7 +90,7 @@ func TypeFromString(typeName string) ctypes.Type {
 		return ctypes.Double()
 	// Standard integer typedefs from <stdint.h>
 	case "int8_t":
-		return ctypes.Char() // signed 8-bit
+		return ctypes.SChar() // signed 8-bit
 	case "uint8_t":
 		return ctypes.UChar() // unsigned 8-bit
 	case "int16_t":
@@ -103,6 +109,8 @@ func TypeFromString(typeName string) ctypes.Type {
 		return ctypes.Tlong{Sign: ctypes.Unsigned} // unsigned long on 64-bit
 	case "ssize_t", "ptrdiff_t":
 		return ctypes.Long() // signed long on 64-bit
+	case "__builtin_va_list":
+		return ctypes.VaList()
 	default:
 		// Check for pointer types
 		if strings.HasSuffix(typeName, "*") {
@@ -122,3 +130,33 @@ func TypeFromString(typeName string) ctypes.Type {
 		return ctypes.Int() // default fallback
 	}
 }
+
+// qualifiersFromCabs converts parsed qualifiers, which are listed from the
+// base type outwards, into per-level qualifiers starting at the declared
+// object. It returns nil for an unqualified declaration.
+func qualifiersFromCabs(q cabs.Qualifiers) ctypes.Qualifiers {
+	levels := len(q.Pointers) + 1
+	result := make(ctypes.Qualifiers, levels)
+	qualified := false
+	for i := 0; i < levels; i++ {
+		quals := q.Base
+		if i < len(q.Pointers) {
+			quals = q.Pointers[len(q.Pointers)-1-i]
+		}
+		for _, qual := range quals {
+			qualified = true
+			switch qual {
+			case cabs.QualConst:
+				result[i].Const = true
+			case cabs.QualVolatile:
+				result[i].Volatile = true
+			case cabs.QualRestrict:
+				result[i].Restrict = true
+			}
+		}
+	}
+	if !qualified {
+		return nil
+	}
+	return result
+}
@@ -206,8 +206,9 @@ type Ecmp struct {
 
 // Eload represents explicit memory load with chunk
 type Eload struct {
-	Chunk Chunk // memory access size/type
-	Addr  Expr  // address to load from
+	Chunk    Chunk // memory access size/type
+	Addr     Expr  // address to load from
+	Volatile bool  // volatile access: never removed, merged or reordered
 }
 
 // --- Statements ---
@@ -224,17 +225,19 @@ type Sassign struct {
 
 // Sstore represents memory store: *addr = value
 type Sstore struct {
-	Chunk Chunk // memory access size/type
-	Addr  Expr  // address to store to
-	Value Expr  // value to store
+	Chunk    Chunk // memory access size/type
+	Addr     Expr  // address to store to
+	Value    Expr  // value to store
+	Volatile bool  // volatile access: never removed, merged or reordered
 }
 
 // Scall represents a function call
 type Scall struct {
-	Result *string // variable name for result, nil for void
-	Sig    *Sig    // function signature (optional)
-	Func   Expr    // function to call
-	Args   []Expr  // arguments
+	Result   *string // variable name for result, nil for void
+	ResultHi *string // variable name for the second result word, see Sreturn.Hi
+	Sig      *Sig    // function signature (optional)
+	Func     Expr    // function to call
+	Args     []Expr  // arguments
 }
 
 // Stailcall represents a tail call
@@ -296,6 +299,7 @@ type SwitchCase struct {
 // Sreturn represents return from function
 type Sreturn struct {
 	Value Expr // nil for void return
+	Hi    Expr // second word of a result returned in two registers, nil otherwise
 }
 
 // Slabel represents a labeled statement
@@ -316,6 +320,7 @@ type Sig struct {
 	Args   []string // argument type descriptors
 	Return string   // return type descriptor
 	VarArg bool
+	Sret   bool // Args[0] is the hidden result pointer, passed in X8
 }
 
 // Function represents a function in Cminor
@@ -326,6 +331,7 @@ type Function struct {
 	Vars       []string // local variable names (stack allocated)
 	Stackspace int64    // stack space required in bytes
 	Body       Stmt
+	Static     bool // not visible outside the translation unit
 }
 
 // GlobVar represents a global variable
@@ -334,6 +340,7 @@ type GlobVar struct {
 	Size     int64  // size in bytes
 	Init     []byte // initial data (nil if uninitialized)
 	ReadOnly bool   // true for .rodata section (e.g., string literals)
+	Static   bool   // not visible outside the translation unit
 }
 
 // Program represents a complete Cminor program
@@ -105,7 +105,11 @@ func (p *Printer) printStmt(stmt Stmt) {
 	case Scall:
 		p.writeIndent()
 		if s.Result != nil {
-			fmt.Fprintf(p.w, "%s = ", *s.Result)
+			fmt.Fprint(p.w, *s.Result)
+			if s.ResultHi != nil {
+				fmt.Fprintf(p.w, ", %s", *s.ResultHi)
+			}
+			fmt.Fprint(p.w, " = ")
 		}
 		p.printExpr(s.Func)
 		fmt.Fprint(p.w, "(")
@@ -217,6 +221,10 @@ func (p *Printer) printStmt(stmt Stmt) {
 			fmt.Fprint(p.w, " ")
 			p.printExpr(s.Value)
 		}
+		if s.Hi != nil {
+			fmt.Fprint(p.w, ", ")
+			p.printExpr(s.Hi)
+		}
 		fmt.Fprintln(p.w, ";")
 
 	case Slabel:
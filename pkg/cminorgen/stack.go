@@ -152,6 +152,9 @@ func findAddressTakenInStmt(stmt csharpminor.Stmt, locals, result map[string]boo
 		if s.Value != nil {
 			findAddressTakenInExpr(s.Value, locals, result)
 		}
+		if s.Hi != nil {
+			findAddressTakenInExpr(s.Hi, locals, result)
+		}
 	case csharpminor.Slabel:
 		findAddressTakenInStmt(s.Body, locals, result)
 	case csharpminor.Sgoto:
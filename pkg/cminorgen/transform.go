@@ -4,6 +4,7 @@ package cminorgen
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/raymyers/ralph-cc/pkg/cminor"
 	"github.com/raymyers/ralph-cc/pkg/csharpminor"
@@ -100,7 +101,7 @@ func (t *Transformer) TransformExpr(e csharpminor.Expr) cminor.Expr {
 
 	case csharpminor.Eload:
 		addr := t.TransformExpr(expr.Addr)
-		return cminor.Eload{Chunk: cminor.Chunk(expr.Chunk), Addr: addr}
+		return cminor.Eload{Chunk: cminor.Chunk(expr.Chunk), Addr: addr, Volatile: expr.Volatile}
 	}
 	panic(fmt.Sprintf("unhandled expression type: %T", e))
 }
@@ -138,9 +139,10 @@ func (t *Transformer) TransformStmt(s csharpminor.Stmt) cminor.Stmt {
 		addr := t.TransformExpr(stmt.Addr)
 		value := t.TransformExpr(stmt.Value)
 		return cminor.Sstore{
-			Chunk: cminor.Chunk(stmt.Chunk),
-			Addr:  addr,
-			Value: value,
+			Chunk:    cminor.Chunk(stmt.Chunk),
+			Addr:     addr,
+			Value:    value,
+			Volatile: stmt.Volatile,
 		}
 
 	case csharpminor.Scall:
@@ -178,11 +180,14 @@ func (t *Transformer) TransformStmt(s csharpminor.Stmt) cminor.Stmt {
 		return t.transformSwitch(stmt)
 
 	case csharpminor.Sreturn:
-		var value cminor.Expr
+		var value, hi cminor.Expr
 		if stmt.Value != nil {
 			value = t.TransformExpr(stmt.Value)
 		}
-		return cminor.Sreturn{Value: value}
+		if stmt.Hi != nil {
+			hi = t.TransformExpr(stmt.Hi)
+		}
+		return cminor.Sreturn{Value: value, Hi: hi}
 
 	case csharpminor.Slabel:
 		body := t.TransformStmt(stmt.Body)
@@ -202,11 +207,15 @@ func (t *Transformer) transformCall(s csharpminor.Scall) cminor.Stmt {
 		args[i] = t.TransformExpr(arg)
 	}
 
-	var result *string
+	var result, resultHi *string
 	if s.Result != nil {
 		name := t.getTempName(*s.Result)
 		result = &name
 	}
+	if s.ResultHi != nil {
+		name := t.getTempName(*s.ResultHi)
+		resultHi = &name
+	}
 
 	var sig *cminor.Sig
 	if s.Sig != nil {
@@ -214,10 +223,11 @@ func (t *Transformer) transformCall(s csharpminor.Scall) cminor.Stmt {
 	}
 
 	return cminor.Scall{
-		Result: result,
-		Sig:    sig,
-		Func:   fn,
-		Args:   args,
+		Result:   result,
+		ResultHi: resultHi,
+		Sig:      sig,
+		Func:     fn,
+		Args:     args,
 	}
 }
 
@@ -294,6 +304,7 @@ func (t *Transformer) transformSwitch(s csharpminor.Sswitch) cminor.Stmt {
 func (t *Transformer) transformSig(s *csharpminor.Sig) *cminor.Sig {
 	sig := &cminor.Sig{
 		VarArg: s.VarArg,
+		Sret:   s.Sret,
 	}
 	// Convert types to string descriptors
 	for _, arg := range s.Args {
@@ -336,6 +347,7 @@ func TransformFunction(fn *csharpminor.Function, globals map[string]GlobalInfo)
 	// Build signature
 	sig := cminor.Sig{
 		VarArg: fn.Sig.VarArg,
+		Sret:   fn.Sig.Sret,
 	}
 	for _, arg := range fn.Sig.Args {
 		sig.Args = append(sig.Args, typeDescriptor(arg))
@@ -345,9 +357,14 @@ func TransformFunction(fn *csharpminor.Function, globals map[string]GlobalInfo)
 	// Collect all variable names (temps + register locals)
 	var vars []string
 
-	// Add temps
-	for _, name := range tr.tempMap {
-		vars = append(vars, name)
+	// Add temps, in the order of their IDs so the output is deterministic
+	ids := make([]int, 0, len(tr.tempMap))
+	for id := range tr.tempMap {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		vars = append(vars, tr.tempMap[id])
 	}
 
 	// Add register-allocated locals
@@ -360,6 +377,7 @@ func TransformFunction(fn *csharpminor.Function, globals map[string]GlobalInfo)
 		Vars:       vars,
 		Stackspace: env.StackSize,
 		Body:       body,
+		Static:     fn.Static,
 	}
 }
 
@@ -373,13 +391,17 @@ func TransformProgram(prog *csharpminor.Program) *cminor.Program {
 		globals[g.Name] = GlobalInfo{Size: g.Size, Signed: g.Signed}
 	}
 
-	// Translate global variables
+	// Translate global variables; extern ones are only referenced
 	for _, g := range prog.Globals {
+		if g.Extern {
+			continue
+		}
 		result.Globals = append(result.Globals, cminor.GlobVar{
 			Name:     g.Name,
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		})
 	}
 
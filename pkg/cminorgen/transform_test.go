@@ -1,6 +1,7 @@
 package cminorgen
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/cminor"
@@ -346,6 +347,59 @@ func TestTransformStmt_Goto(t *testing.T) {
 	}
 }
 
+func TestTransformStmt_GotoAcrossBlocks(t *testing.T) {
+	env := &VarEnv{Vars: make(map[string]*VarInfo)}
+	tr := NewTransformer(env, nil)
+
+	// goto inner; block { loop { inner: goto inner; } }: a forward goto
+	// into a nested loop whose body jumps backward to the same label
+	input := csharpminor.Sseq{
+		First: csharpminor.Sgoto{Label: "inner"},
+		Second: csharpminor.Sblock{Body: csharpminor.Sloop{Body: csharpminor.Slabel{
+			Label: "inner",
+			Body:  csharpminor.Sgoto{Label: "inner"},
+		}}},
+	}
+
+	want := cminor.Sseq{
+		First: cminor.Sgoto{Label: "inner"},
+		Second: cminor.Sblock{Body: cminor.Sloop{Body: cminor.Slabel{
+			Label: "inner",
+			Body:  cminor.Sgoto{Label: "inner"},
+		}}},
+	}
+	if result := tr.TransformStmt(input); !reflect.DeepEqual(result, want) {
+		t.Errorf("got %#v, want %#v", result, want)
+	}
+}
+
+func TestTransformStmt_GotoIntoSwitchCase(t *testing.T) {
+	env := &VarEnv{Vars: make(map[string]*VarInfo)}
+	tr := NewTransformer(env, nil)
+
+	// switch (x) { case 0: goto later; case 2: later: return; }: the
+	// label stays on the body of its case, where the goto can reach it
+	input := csharpminor.Sswitch{
+		Expr: csharpminor.Etempvar{ID: 0},
+		Cases: []csharpminor.SwitchCase{
+			{Value: 0, Body: csharpminor.Sgoto{Label: "later"}},
+			{Value: 2, Body: csharpminor.Slabel{Label: "later", Body: csharpminor.Sreturn{}}},
+		},
+		Default: csharpminor.Sskip{},
+	}
+
+	sw, ok := tr.TransformStmt(input).(cminor.Sswitch)
+	if !ok {
+		t.Fatalf("expected Sswitch, got %T", tr.TransformStmt(input))
+	}
+	if want := (cminor.Sgoto{Label: "later"}); !reflect.DeepEqual(sw.Cases[0].Body, want) {
+		t.Errorf("case 0: got %#v, want %#v", sw.Cases[0].Body, want)
+	}
+	if want := (cminor.Slabel{Label: "later", Body: cminor.Sreturn{}}); !reflect.DeepEqual(sw.Cases[1].Body, want) {
+		t.Errorf("case 2: got %#v, want %#v", sw.Cases[1].Body, want)
+	}
+}
+
 func TestTransformStmt_Switch(t *testing.T) {
 	env := &VarEnv{Vars: make(map[string]*VarInfo)}
 	tr := NewTransformer(env, nil)
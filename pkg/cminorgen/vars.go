@@ -3,6 +3,8 @@
 package cminorgen
 
 import (
+	"sort"
+
 	"github.com/raymyers/ralph-cc/pkg/cminor"
 	"github.com/raymyers/ralph-cc/pkg/csharpminor"
 )
@@ -139,7 +141,8 @@ func (env *VarEnv) GetChunk(name string) cminor.Chunk {
 	return cminor.Many32
 }
 
-// RegisterVars returns a list of variable names that are register candidates.
+// RegisterVars returns the names of the variables that are register
+// candidates, sorted.
 func (env *VarEnv) RegisterVars() []string {
 	var result []string
 	for name, info := range env.Vars {
@@ -147,10 +150,11 @@ func (env *VarEnv) RegisterVars() []string {
 			result = append(result, name)
 		}
 	}
+	sort.Strings(result)
 	return result
 }
 
-// StackVars returns a list of variable names that are stack-allocated.
+// StackVars returns the names of the stack-allocated variables, sorted.
 func (env *VarEnv) StackVars() []string {
 	var result []string
 	for name, info := range env.Vars {
@@ -158,6 +162,7 @@ func (env *VarEnv) StackVars() []string {
 			result = append(result, name)
 		}
 	}
+	sort.Strings(result)
 	return result
 }
 
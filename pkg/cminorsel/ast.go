@@ -352,9 +352,10 @@ type Ebinop struct {
 
 // Eload represents memory load with addressing mode
 type Eload struct {
-	Chunk Chunk          // memory access size/type
-	Mode  AddressingMode // addressing mode
-	Args  []Expr         // arguments for addressing mode
+	Chunk    Chunk          // memory access size/type
+	Mode     AddressingMode // addressing mode
+	Args     []Expr         // arguments for addressing mode
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Econdition represents conditional expression (ternary): cond ? then : else
@@ -386,6 +387,7 @@ type Eaddshift struct {
 	Shift int     // shift amount
 	Left  Expr
 	Right Expr
+	Long  bool // 64-bit operation (addl)
 }
 
 // Esubshift represents sub with shifted operand: a - (b << shift)
@@ -394,6 +396,22 @@ type Esubshift struct {
 	Shift int
 	Left  Expr
 	Right Expr
+	Long  bool // 64-bit operation (subl)
+}
+
+// Emulhi represents the high 32 bits of the 64-bit product of two ints:
+// (a * b) >> 32, signed or unsigned
+type Emulhi struct {
+	Unsigned bool
+	Left     Expr
+	Right    Expr
+}
+
+// Eshiftimm represents an int shifted by a constant amount: a << n, a >> n
+type Eshiftimm struct {
+	Op    ShiftOp
+	Shift int
+	Arg   Expr
 }
 
 // Ecmp represents a comparison expression that produces int 0 or 1
@@ -435,18 +453,20 @@ type Sassign struct {
 
 // Sstore represents memory store with addressing mode
 type Sstore struct {
-	Chunk Chunk
-	Mode  AddressingMode
-	Args  []Expr // address arguments
-	Value Expr   // value to store
+	Chunk    Chunk
+	Mode     AddressingMode
+	Args     []Expr // address arguments
+	Value    Expr   // value to store
+	Volatile bool   // volatile access: never removed, merged or reordered
 }
 
 // Scall represents a function call
 type Scall struct {
-	Result *string // variable name for result, nil for void
-	Sig    *Sig    // function signature
-	Func   Expr    // function to call
-	Args   []Expr  // arguments
+	Result   *string // variable name for result, nil for void
+	ResultHi *string // variable name for the second result word, see Sreturn.Hi
+	Sig      *Sig    // function signature
+	Func     Expr    // function to call
+	Args     []Expr  // arguments
 }
 
 // Stailcall represents a tail call
@@ -508,6 +528,7 @@ type SwitchCase struct {
 // Sreturn represents return from function
 type Sreturn struct {
 	Value Expr // nil for void return
+	Hi    Expr // second word of a result returned in two registers, nil otherwise
 }
 
 // Slabel represents a labeled statement
@@ -528,6 +549,7 @@ type Sig struct {
 	Args   []string // argument type descriptors
 	Return string   // return type descriptor
 	VarArg bool
+	Sret   bool // Args[0] is the hidden result pointer, passed in X8
 }
 
 // Function represents a function in CminorSel
@@ -538,6 +560,7 @@ type Function struct {
 	Vars       []string
 	Stackspace int64
 	Body       Stmt
+	Static     bool // not visible outside the translation unit
 }
 
 // GlobVar represents a global variable
@@ -546,6 +569,7 @@ type GlobVar struct {
 	Size     int64
 	Init     []byte
 	ReadOnly bool // true for .rodata section (e.g., string literals)
+	Static   bool // not visible outside the translation unit
 }
 
 // Program represents a complete CminorSel program
@@ -573,6 +597,8 @@ func (Elet) implCminorSelNode()         {}
 func (Eletvar) implCminorSelNode()      {}
 func (Eaddshift) implCminorSelNode()    {}
 func (Esubshift) implCminorSelNode()    {}
+func (Emulhi) implCminorSelNode()       {}
+func (Eshiftimm) implCminorSelNode()    {}
 func (Ecmp) implCminorSelNode()         {}
 
 func (Sskip) implCminorSelNode()       {}
@@ -610,6 +636,8 @@ func (Elet) implCminorSelExpr()       {}
 func (Eletvar) implCminorSelExpr()    {}
 func (Eaddshift) implCminorSelExpr()  {}
 func (Esubshift) implCminorSelExpr()  {}
+func (Emulhi) implCminorSelExpr()     {}
+func (Eshiftimm) implCminorSelExpr()  {}
 func (Ecmp) implCminorSelExpr()       {}
 
 // Marker methods for Stmt interface
@@ -112,7 +112,11 @@ func (p *Printer) printStmt(s Stmt) {
 	case Scall:
 		p.writeIndent()
 		if stmt.Result != nil {
-			fmt.Fprintf(p.w, "%s = ", *stmt.Result)
+			fmt.Fprint(p.w, *stmt.Result)
+			if stmt.ResultHi != nil {
+				fmt.Fprintf(p.w, ", %s", *stmt.ResultHi)
+			}
+			fmt.Fprint(p.w, " = ")
 		}
 		p.printExpr(stmt.Func)
 		fmt.Fprint(p.w, "(")
@@ -224,6 +228,10 @@ func (p *Printer) printStmt(s Stmt) {
 		} else {
 			fmt.Fprint(p.w, "return ")
 			p.printExpr(stmt.Value)
+			if stmt.Hi != nil {
+				fmt.Fprint(p.w, ", ")
+				p.printExpr(stmt.Hi)
+			}
 			fmt.Fprintln(p.w, ";")
 		}
 
@@ -285,7 +293,12 @@ func (p *Printer) printExpr(e Expr) {
 	case Eaddshift:
 		fmt.Fprint(p.w, "(")
 		p.printExpr(expr.Left)
-		fmt.Fprintf(p.w, " + (%s ", expr.Op)
+		if expr.Long {
+			fmt.Fprint(p.w, " +l")
+		} else {
+			fmt.Fprint(p.w, " +")
+		}
+		fmt.Fprintf(p.w, " (%s ", expr.Op)
 		p.printExpr(expr.Right)
 		fmt.Fprintf(p.w, " %d)", expr.Shift)
 		fmt.Fprint(p.w, ")")
@@ -293,10 +306,31 @@ func (p *Printer) printExpr(e Expr) {
 	case Esubshift:
 		fmt.Fprint(p.w, "(")
 		p.printExpr(expr.Left)
-		fmt.Fprintf(p.w, " - (%s ", expr.Op)
+		if expr.Long {
+			fmt.Fprint(p.w, " -l")
+		} else {
+			fmt.Fprint(p.w, " -")
+		}
+		fmt.Fprintf(p.w, " (%s ", expr.Op)
 		p.printExpr(expr.Right)
 		fmt.Fprintf(p.w, " %d)", expr.Shift)
 		fmt.Fprint(p.w, ")")
+
+	case Emulhi:
+		if expr.Unsigned {
+			fmt.Fprint(p.w, "mulhu(")
+		} else {
+			fmt.Fprint(p.w, "mulhs(")
+		}
+		p.printExpr(expr.Left)
+		fmt.Fprint(p.w, ", ")
+		p.printExpr(expr.Right)
+		fmt.Fprint(p.w, ")")
+
+	case Eshiftimm:
+		fmt.Fprintf(p.w, "(%s ", expr.Op)
+		p.printExpr(expr.Arg)
+		fmt.Fprintf(p.w, " %d)", expr.Shift)
 	}
 }
 
@@ -72,6 +72,7 @@ type Directive struct {
 	// For DIR_INCLUDE
 	HeaderName   string // the header name including < > or " "
 	IsSystemIncl bool   // true for <...>, false for "..."
+	IsNext       bool   // true for #include_next (GCC extension)
 
 	// For DIR_DEFINE
 	MacroName   string   // the macro name
@@ -137,6 +138,12 @@ func (p *DirectiveParser) ParseDirective(loc SourceLoc) (*Directive, error) {
 	switch name {
 	case "include":
 		return p.parseInclude(loc)
+	case "include_next":
+		dir, err := p.parseInclude(loc)
+		if dir != nil {
+			dir.IsNext = true
+		}
+		return dir, err
 	case "define":
 		return p.parseDefine(loc)
 	case "undef":
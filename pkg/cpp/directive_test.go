@@ -84,6 +84,19 @@ func TestParseIncludeQuoted(t *testing.T) {
 	}
 }
 
+func TestParseIncludeNext(t *testing.T) {
+	dir := parseDirective(t, `#include_next <limits.h>`)
+	if dir.Type != DIR_INCLUDE {
+		t.Errorf("got type %v, want DIR_INCLUDE", dir.Type)
+	}
+	if dir.HeaderName != "<limits.h>" {
+		t.Errorf("got header %q, want %q", dir.HeaderName, "<limits.h>")
+	}
+	if !dir.IsNext {
+		t.Errorf("expected IsNext to be true")
+	}
+}
+
 func TestParseDefineObject(t *testing.T) {
 	dir := parseDirective(t, `#define FOO 42`)
 	if dir.Type != DIR_DEFINE {
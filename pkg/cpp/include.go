@@ -21,12 +21,13 @@ const (
 
 // IncludeResolver handles include path resolution.
 type IncludeResolver struct {
-	UserPaths      []string        // -I directories
-	SystemPaths    []string        // -isystem directories
-	CurrentDir     string          // Directory of file currently being processed
-	includeStack   []string        // Stack of included files for cycle detection
-	includedOnce   map[string]bool // Files with #pragma once
-	systemDetected bool            // Have we detected system paths?
+	UserPaths      []string          // -I directories
+	SystemPaths    []string          // -isystem directories
+	CurrentDir     string            // Directory of file currently being processed
+	includeStack   []string          // Stack of included files for cycle detection
+	includedOnce   map[string]bool   // Files with #pragma once
+	foundIn        map[string]string // Resolved file -> search directory it was found in
+	systemDetected bool              // Have we detected system paths?
 }
 
 // NewIncludeResolver creates a new include resolver.
@@ -35,6 +36,7 @@ func NewIncludeResolver() *IncludeResolver {
 		UserPaths:    []string{},
 		SystemPaths:  []string{},
 		includedOnce: make(map[string]bool),
+		foundIn:      make(map[string]string),
 	}
 }
 
@@ -92,7 +94,53 @@ func (r *IncludeResolver) Resolve(filename string, kind IncludeKind) (string, er
 	// Add system paths
 	searchPaths = append(searchPaths, r.SystemPaths...)
 
-	// Search for the file
+	if path, ok := r.search(filename, searchPaths); ok {
+		return path, nil
+	}
+	return "", &IncludeError{Filename: filename, Kind: kind}
+}
+
+// ResolveNext implements #include_next: the search continues in the
+// -I and system directories that follow the one in which currentFile was
+// found. The directory of currentFile itself is never searched, so a
+// wrapper header can reach the header it wraps.
+func (r *IncludeResolver) ResolveNext(filename string, kind IncludeKind, currentFile string) (string, error) {
+	r.DetectSystemPaths()
+
+	absCurrent, err := filepath.Abs(currentFile)
+	if err != nil {
+		absCurrent = currentFile
+	}
+	foundDir, ok := r.foundIn[absCurrent]
+	if !ok {
+		foundDir = filepath.Dir(absCurrent)
+	}
+
+	chain := append(append([]string{}, r.UserPaths...), r.SystemPaths...)
+	start := 0
+	for i, dir := range chain {
+		if absDir(dir) == foundDir {
+			start = i + 1
+			break
+		}
+	}
+
+	var searchPaths []string
+	for _, dir := range chain[start:] {
+		if absDir(dir) != foundDir {
+			searchPaths = append(searchPaths, dir)
+		}
+	}
+
+	if path, ok := r.search(filename, searchPaths); ok {
+		return path, nil
+	}
+	return "", &IncludeError{Filename: filename, Kind: kind}
+}
+
+// search looks for filename in each directory in order, recording the
+// directory where it was found for later #include_next lookups.
+func (r *IncludeResolver) search(filename string, searchPaths []string) (string, bool) {
 	for _, dir := range searchPaths {
 		fullPath := filepath.Join(dir, filename)
 		if _, err := os.Stat(fullPath); err == nil {
@@ -100,11 +148,21 @@ func (r *IncludeResolver) Resolve(filename string, kind IncludeKind) (string, er
 			if err != nil {
 				absPath = fullPath
 			}
-			return absPath, nil
+			if _, seen := r.foundIn[absPath]; !seen {
+				r.foundIn[absPath] = absDir(dir)
+			}
+			return absPath, true
 		}
 	}
+	return "", false
+}
 
-	return "", &IncludeError{Filename: filename, Kind: kind}
+// absDir returns the absolute, cleaned form of a directory path.
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return filepath.Clean(dir)
 }
 
 // PushFile marks a file as being included and pushes it onto the include stack.
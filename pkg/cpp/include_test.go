@@ -67,6 +67,40 @@ func TestIncludeResolver_Resolve_UserPath(t *testing.T) {
 	}
 }
 
+func TestIncludeResolver_ResolveNext(t *testing.T) {
+	firstDir := t.TempDir()
+	secondDir := t.TempDir()
+	for _, dir := range []string{firstDir, secondDir} {
+		if err := os.WriteFile(filepath.Join(dir, "wrap.h"), []byte("// wrap"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewIncludeResolver()
+	r.AddUserPath(firstDir)
+	r.AddUserPath(secondDir)
+
+	first, err := r.Resolve("wrap.h", IncludeAngled)
+	if err != nil {
+		t.Fatalf("expected to find wrap.h, got error: %v", err)
+	}
+	if filepath.Dir(first) != firstDir {
+		t.Fatalf("expected wrap.h from %s, got %s", firstDir, first)
+	}
+
+	next, err := r.ResolveNext("wrap.h", IncludeAngled, first)
+	if err != nil {
+		t.Fatalf("expected #include_next to find wrap.h, got error: %v", err)
+	}
+	if filepath.Dir(next) != secondDir {
+		t.Errorf("expected wrap.h from %s, got %s", secondDir, next)
+	}
+
+	if _, err := r.ResolveNext("wrap.h", IncludeAngled, next); err == nil {
+		t.Errorf("expected no header after the last search directory")
+	}
+}
+
 func TestIncludeResolver_Resolve_SystemPath(t *testing.T) {
 	// Create temp directory for system headers
 	sysIncDir := t.TempDir()
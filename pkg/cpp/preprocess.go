@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/raymyers/ralph-cc/pkg/diag"
 )
 
 // Preprocessor is the main driver for C preprocessing.
@@ -20,12 +22,14 @@ type Preprocessor struct {
 
 // PreprocessorOptions configures the preprocessor.
 type PreprocessorOptions struct {
-	Defines       []string // -D definitions
-	Undefines     []string // -U undefinitions
-	IncludePaths  []string // -I directories
-	SystemPaths   []string // -isystem directories
-	KeepComments  bool     // Preserve comments in output
-	LineMarkers   bool     // Generate #line markers
+	Defines       []string      // -D definitions
+	Undefines     []string      // -U undefinitions
+	IncludePaths  []string      // -I directories
+	SystemPaths   []string      // -isystem directories
+	ForceIncludes []string      // -include files, processed before the main file
+	KeepComments  bool          // Preserve comments in output
+	LineMarkers   bool          // Generate #line markers
+	Diags         *diag.Emitter // Where #warning diagnostics go, written to standard error if nil
 }
 
 // NewPreprocessor creates a new preprocessor instance.
@@ -74,8 +78,46 @@ func (p *Preprocessor) PreprocessFile(filename string) (string, error) {
 	}
 	defer p.resolver.PopFile()
 	
+	// Process -include files as if they were #included at the top of the file
+	var output strings.Builder
+	for _, name := range p.opts.ForceIncludes {
+		result, err := p.processForceInclude(name, absPath)
+		if err != nil {
+			return "", err
+		}
+		output.WriteString(result)
+	}
+	p.resolver.SetCurrentFile(absPath)
+	
 	// Top-level file - check balance after processing
-	return p.preprocessContentTopLevel(string(content), absPath)
+	result, err := p.preprocessContentTopLevel(string(content), absPath)
+	if err != nil {
+		return "", err
+	}
+	output.WriteString(result)
+	return output.String(), nil
+}
+
+// processForceInclude handles a -include file. Like gcc, the file is first
+// looked up relative to the working directory, then along the usual
+// quoted-include search path.
+func (p *Preprocessor) processForceInclude(name, mainFile string) (string, error) {
+	includePath := ""
+	if _, err := os.Stat(name); err == nil {
+		includePath, err = filepath.Abs(name)
+		if err != nil {
+			includePath = name
+		}
+	} else {
+		cwd, _ := os.Getwd()
+		p.resolver.CurrentDir = cwd
+		resolved, err := p.resolver.Resolve(name, IncludeQuoted)
+		if err != nil {
+			return "", fmt.Errorf("-include %s: %w", name, err)
+		}
+		includePath = resolved
+	}
+	return p.includeFile(includePath, mainFile, 1)
 }
 
 // PreprocessString preprocesses a string with a given filename for error messages.
@@ -202,6 +244,7 @@ func (p *Preprocessor) processLine(tokens []Token, filename string) (string, err
 	if err != nil {
 		return "", err
 	}
+	expanded = p.processPragmaOperators(expanded, filename)
 	
 	return TokensToString(expanded), nil
 }
@@ -271,8 +314,18 @@ func (p *Preprocessor) processDirective(tokens []Token, filename string) (string
 	case DIR_ERROR:
 		return "", fmt.Errorf("#error %s", dir.Message)
 	case DIR_WARNING:
-		// Warnings are typically printed to stderr and not fatal
-		fmt.Fprintf(os.Stderr, "%s:%d: warning: %s\n", loc.File, loc.Line, dir.Message)
+		// Warnings are reported and preprocessing goes on. Like GCC, the
+		// position is that of the directive name.
+		pos := diag.Pos{File: loc.File, Line: loc.Line, Col: loc.Column}
+		if len(directiveTokens) > 0 {
+			pos.Col = directiveTokens[0].Loc.Column
+		}
+		if p.opts.Diags == nil {
+			d := diag.Diagnostic{Severity: diag.Warning, Pos: pos, Code: "cpp", Message: "#warning " + dir.Message}
+			fmt.Fprintln(os.Stderr, d.Format(loc.File))
+			return "", nil
+		}
+		p.opts.Diags.Warnf(pos, "cpp", "#warning %s", dir.Message)
 		return "", nil
 	case DIR_PRAGMA:
 		return p.processPragma(dir, filename)
@@ -319,11 +372,26 @@ func (p *Preprocessor) processInclude(dir *Directive, currentFile string) (strin
 	
 	// Resolve the include path
 	p.resolver.SetCurrentFile(currentFile)
-	includePath, err := p.resolver.Resolve(fileName, kind)
-	if err != nil {
-		return "", fmt.Errorf("#include %s: %w", headerName, err)
+	var includePath string
+	var err error
+	if dir.IsNext {
+		includePath, err = p.resolver.ResolveNext(fileName, kind, currentFile)
+		if err != nil {
+			return "", fmt.Errorf("#include_next %s: %w", headerName, err)
+		}
+	} else {
+		includePath, err = p.resolver.Resolve(fileName, kind)
+		if err != nil {
+			return "", fmt.Errorf("#include %s: %w", headerName, err)
+		}
 	}
 	
+	return p.includeFile(includePath, currentFile, dir.Loc.Line+1)
+}
+
+// includeFile preprocesses a resolved include file in place. returnLine is
+// the line of currentFile that follows the inclusion, used for line markers.
+func (p *Preprocessor) includeFile(includePath, currentFile string, returnLine int) (string, error) {
 	// Check for #pragma once
 	if p.resolver.IsAlreadyIncluded(includePath) {
 		return "", nil
@@ -379,7 +447,7 @@ func (p *Preprocessor) processInclude(dir *Directive, currentFile string) (strin
 	
 	// Generate line marker for returning to original file
 	if p.opts.LineMarkers {
-		output.WriteString(fmt.Sprintf("# %d \"%s\" 2\n", dir.Loc.Line+1, currentFile))
+		output.WriteString(fmt.Sprintf("# %d \"%s\" 2\n", returnLine, currentFile))
 	}
 	
 	return output.String(), nil
@@ -447,6 +515,49 @@ func (p *Preprocessor) processPragma(dir *Directive, filename string) (string, e
 	return sb.String(), nil
 }
 
+// processPragmaOperators handles C99 _Pragma("...") operators in expanded text.
+// _Pragma("once") is honored like #pragma once and removed; other pragmas are
+// left in place for the compiler, which ignores them.
+func (p *Preprocessor) processPragmaOperators(tokens []Token, filename string) []Token {
+	var result []Token
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type != PP_IDENTIFIER || tokens[i].Text != "_Pragma" {
+			result = append(result, tokens[i])
+			continue
+		}
+		text, end, ok := pragmaOperand(tokens, i+1)
+		if ok && strings.TrimSpace(text) == "once" {
+			p.resolver.MarkPragmaOnce(filename)
+			i = end
+			continue
+		}
+		result = append(result, tokens[i])
+	}
+	return result
+}
+
+// pragmaOperand matches ( string-literal ) starting at tokens[start], skipping
+// whitespace. It returns the destringized literal and the index of the ')'.
+func pragmaOperand(tokens []Token, start int) (string, int, bool) {
+	var parts []Token
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].Type == PP_WHITESPACE || tokens[i].Type == PP_NEWLINE {
+			continue
+		}
+		parts = append(parts, tokens[i])
+		if len(parts) == 3 {
+			if parts[0].Text != "(" || parts[1].Type != PP_STRING || parts[2].Text != ")" {
+				return "", 0, false
+			}
+			// Destringize: drop the quotes and undo \" and \\ escapes
+			lit := unquoteString(parts[1].Text)
+			lit = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(lit)
+			return lit, i, true
+		}
+	}
+	return "", 0, false
+}
+
 // GetMacros returns the macro table for inspection.
 func (p *Preprocessor) GetMacros() *MacroTable {
 	return p.macros
@@ -3,8 +3,11 @@ package cpp
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/diag"
 )
 
 func TestPreprocessor_SimpleFile(t *testing.T) {
@@ -197,6 +200,175 @@ int after_includes;
 	}
 }
 
+func TestPreprocessor_PragmaOperatorOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// _Pragma("once") produced by macro expansion behaves like #pragma once
+	headerContent := `#define ONCE _Pragma("once")
+ONCE
+int pragma_op_content;
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "ophdr.h"), []byte(headerContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mainContent := `#include "ophdr.h"
+#include "ophdr.h"
+`
+	mainFile := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(mainFile, []byte(mainContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor(PreprocessorOptions{})
+	result, err := pp.PreprocessFile(mainFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if count := strings.Count(result, "pragma_op_content"); count != 1 {
+		t.Errorf("expected 'pragma_op_content' to appear once, got %d times in: %s", count, result)
+	}
+	if strings.Contains(result, "_Pragma") {
+		t.Errorf("expected _Pragma(\"once\") to be consumed, got: %s", result)
+	}
+}
+
+func TestPreprocessor_PragmaOperatorPassthrough(t *testing.T) {
+	pp := NewPreprocessor(PreprocessorOptions{})
+	result, err := pp.PreprocessString(`_Pragma("GCC diagnostic ignored \"-Wformat\"") int x;
+`, "test.c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, `_Pragma("GCC diagnostic ignored \"-Wformat\"")`) {
+		t.Errorf("expected unknown _Pragma to be kept for the compiler, got: %s", result)
+	}
+}
+
+func TestPreprocessor_ForceInclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.h")
+	if err := os.WriteFile(configFile, []byte("#define ANSWER 42\nint forced_decl;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainFile := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(mainFile, []byte("int x = ANSWER;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor(PreprocessorOptions{
+		ForceIncludes: []string{configFile},
+	})
+	result, err := pp.PreprocessFile(mainFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, "int x = 42;") {
+		t.Errorf("expected macro from force-included header to expand, got: %s", result)
+	}
+	if strings.Index(result, "forced_decl") > strings.Index(result, "int x") {
+		t.Errorf("expected force-included content before the main file, got: %s", result)
+	}
+}
+
+func TestPreprocessor_ForceIncludeSearchPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	includeDir := filepath.Join(tmpDir, "include")
+	if err := os.MkdirAll(includeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(includeDir, "ralph_forced_cfg.h"), []byte("#define LIMIT 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainFile := filepath.Join(tmpDir, "main.c")
+	if err := os.WriteFile(mainFile, []byte("int buf[LIMIT];\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor(PreprocessorOptions{
+		IncludePaths:  []string{includeDir},
+		ForceIncludes: []string{"ralph_forced_cfg.h"},
+	})
+	result, err := pp.PreprocessFile(mainFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, "int buf[8];") {
+		t.Errorf("expected force-included header found via -I, got: %s", result)
+	}
+}
+
+func TestPreprocessor_IncludeNext(t *testing.T) {
+	tmpDir := t.TempDir()
+	wrapDir := filepath.Join(tmpDir, "wrap")
+	realDir := filepath.Join(tmpDir, "real")
+	for _, dir := range []string{wrapDir, realDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wrapper := "#define WRAPPED 1\n#include_next <limits_x.h>\n"
+	if err := os.WriteFile(filepath.Join(wrapDir, "limits_x.h"), []byte(wrapper), 0644); err != nil {
+		t.Fatal(err)
+	}
+	real := "#define REAL_VALUE 7\nint real_header;\n"
+	if err := os.WriteFile(filepath.Join(realDir, "limits_x.h"), []byte(real), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor(PreprocessorOptions{
+		IncludePaths: []string{wrapDir, realDir},
+	})
+	source := `#include <limits_x.h>
+int v = REAL_VALUE + WRAPPED;
+`
+	result, err := pp.PreprocessString(source, filepath.Join(tmpDir, "main.c"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, "real_header") {
+		t.Errorf("expected #include_next to reach the real header, got: %s", result)
+	}
+	if !strings.Contains(result, "int v = 7 + 1;") {
+		t.Errorf("expected macros from both headers, got: %s", result)
+	}
+}
+
+func TestPreprocessor_IncludeNextSkipsCurrentDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	otherDir := filepath.Join(tmpDir, "other")
+	if err := os.MkdirAll(otherDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// hdr.h next to main.c wraps the hdr.h in otherDir. tmpDir is also on
+	// the -I path, so #include_next must skip it rather than find itself.
+	wrapper := "int wrapper_header;\n#include_next \"hdr.h\"\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "hdr.h"), []byte(wrapper), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "hdr.h"), []byte("int other_header;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor(PreprocessorOptions{
+		IncludePaths: []string{tmpDir, otherDir},
+	})
+	source := `#include "hdr.h"
+`
+	result, err := pp.PreprocessString(source, filepath.Join(tmpDir, "main.c"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, "wrapper_header") || !strings.Contains(result, "other_header") {
+		t.Errorf("expected both wrapper and wrapped header, got: %s", result)
+	}
+}
+
 func TestPreprocessor_NestedIncludes(t *testing.T) {
 	tmpDir := t.TempDir()
 	
@@ -356,6 +528,41 @@ int after_error;
 	}
 }
 
+func TestPreprocessor_ErrorDirectiveHalts(t *testing.T) {
+	diags := diag.NewEmitter(diag.Options{})
+	pp := NewPreprocessor(PreprocessorOptions{Diags: diags})
+
+	source := "int before;\n#error foo\n#warning after\nint after;\n"
+	result, err := pp.PreprocessString(source, "test.c")
+	if err == nil {
+		t.Fatal("expected error from #error directive")
+	}
+	if !strings.Contains(err.Error(), "test.c:2: #error foo") {
+		t.Errorf("expected the location and message of the #error, got: %v", err)
+	}
+	if result != "" || len(diags.Diagnostics()) != 0 {
+		t.Errorf("expected preprocessing to stop at the #error, got output %q and warnings %v", result, diags.Diagnostics())
+	}
+}
+
+func TestPreprocessor_WarningDirective(t *testing.T) {
+	diags := diag.NewEmitter(diag.Options{})
+	pp := NewPreprocessor(PreprocessorOptions{Diags: diags})
+
+	source := "#warning bar\nint after_warning;\n"
+	result, err := pp.PreprocessString(source, "test.c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []diag.Diagnostic{{Severity: diag.Warning, Pos: diag.Pos{File: "test.c", Line: 1, Col: 2}, Code: "cpp", Message: "#warning bar"}}
+	if got := diags.Diagnostics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %v, want %v", got, want)
+	}
+	if !strings.Contains(result, "int after_warning;") {
+		t.Errorf("expected preprocessing to continue after #warning, got: %s", result)
+	}
+}
+
 func TestPreprocessor_CmdlineDefines(t *testing.T) {
 	pp := NewPreprocessor(PreprocessorOptions{
 		Defines: []string{"FOO=42", "BAR"},
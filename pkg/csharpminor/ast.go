@@ -302,8 +302,9 @@ type Ecmp struct {
 
 // Eload represents explicit memory load with chunk
 type Eload struct {
-	Chunk Chunk // memory access size/type
-	Addr  Expr  // address to load from
+	Chunk    Chunk // memory access size/type
+	Addr     Expr  // address to load from
+	Volatile bool  // volatile access: never removed, merged or reordered
 }
 
 // --- Statements ---
@@ -319,17 +320,19 @@ type Sset struct {
 
 // Sstore represents memory store: *addr = value
 type Sstore struct {
-	Chunk Chunk // memory access size/type
-	Addr  Expr  // address to store to
-	Value Expr  // value to store
+	Chunk    Chunk // memory access size/type
+	Addr     Expr  // address to store to
+	Value    Expr  // value to store
+	Volatile bool  // volatile access: never removed, merged or reordered
 }
 
 // Scall represents a function call
 type Scall struct {
-	Result *int   // temporary ID for result, nil for void
-	Sig    *Sig   // function signature (optional)
-	Func   Expr   // function to call (typically Eaddrof)
-	Args   []Expr // arguments
+	Result   *int   // temporary ID for result, nil for void
+	ResultHi *int   // temporary ID for the second result word, see Sreturn.Hi
+	Sig      *Sig   // function signature (optional)
+	Func     Expr   // function to call (typically Eaddrof)
+	Args     []Expr // arguments
 }
 
 // Stailcall represents a tail call
@@ -391,6 +394,7 @@ type SwitchCase struct {
 // Sreturn represents return from function
 type Sreturn struct {
 	Value Expr // nil for void return
+	Hi    Expr // second word of a result returned in two registers, nil otherwise
 }
 
 // Slabel represents a labeled statement
@@ -413,6 +417,8 @@ type VarDecl struct {
 	Init     []byte // initial data (nil if uninitialized)
 	ReadOnly bool   // true for read-only data (e.g., string literals)
 	Signed   bool   // true for signed types (int8_t), false for unsigned (uint8_t)
+	Extern   bool   // defined in another unit: referenced, not emitted
+	Static   bool   // not visible outside the translation unit
 }
 
 // Sig represents a function signature
@@ -420,6 +426,7 @@ type Sig struct {
 	Args   []ctypes.Type
 	Return ctypes.Type
 	VarArg bool
+	Sret   bool // Args[0] is the hidden result pointer, passed in X8
 }
 
 // Function represents a function in Csharpminor
@@ -430,6 +437,7 @@ type Function struct {
 	Locals []VarDecl     // local variables (stack allocated)
 	Temps  []ctypes.Type // temporary types
 	Body   Stmt
+	Static bool // not visible outside the translation unit
 }
 
 // Program represents a complete Csharpminor program
@@ -22,6 +22,9 @@ func NewPrinter(w io.Writer) *Printer {
 func (p *Printer) PrintProgram(prog *Program) {
 	// Print global variables
 	for _, g := range prog.Globals {
+		if g.Extern {
+			fmt.Fprint(p.w, "extern ")
+		}
 		fmt.Fprintf(p.w, "var %s[%d];\n", g.Name, g.Size)
 	}
 	if len(prog.Globals) > 0 {
@@ -99,7 +102,11 @@ func (p *Printer) printStmt(stmt Stmt) {
 	case Scall:
 		p.writeIndent()
 		if s.Result != nil {
-			fmt.Fprintf(p.w, "$%d = ", *s.Result)
+			fmt.Fprintf(p.w, "$%d", *s.Result)
+			if s.ResultHi != nil {
+				fmt.Fprintf(p.w, ", $%d", *s.ResultHi)
+			}
+			fmt.Fprint(p.w, " = ")
 		}
 		p.printExpr(s.Func)
 		fmt.Fprint(p.w, "(")
@@ -211,6 +218,10 @@ func (p *Printer) printStmt(stmt Stmt) {
 			fmt.Fprint(p.w, " ")
 			p.printExpr(s.Value)
 		}
+		if s.Hi != nil {
+			fmt.Fprint(p.w, ", ")
+			p.printExpr(s.Hi)
+		}
 		fmt.Fprintln(p.w, ";")
 
 	case Slabel:
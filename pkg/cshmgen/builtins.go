@@ -0,0 +1,124 @@
+// Package cshmgen implements the Cshmgen pass: Clight → Csharpminor
+// This file expands builtins that need no help from the back end.
+package cshmgen
+
+import (
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/csharpminor"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+// maxInlineMem is the largest constant size for which memcpy and memset are
+// expanded into loads and stores; larger or unknown sizes call the C library.
+const maxInlineMem = 64
+
+// expandBuiltin returns the Csharpminor expansion of a builtin, if it has one.
+// va_start needs the frame layout and is expanded by asmgen.
+func (t *StmtTranslator) expandBuiltin(s clight.Sbuiltin) (csharpminor.Stmt, bool) {
+	switch s.Builtin {
+	case "memcpy", "memset":
+		return t.translateMemBuiltin(s), true
+	case "va_end":
+		return csharpminor.Sskip{}, true
+	case "va_copy":
+		dst := t.exprTr.TranslateExpr(s.Args[0])
+		src := t.exprTr.TranslateExpr(s.Args[1])
+		return copyBytes(dst, src, sizeofType(ctypes.VaList())), true
+	}
+	return nil, false
+}
+
+// translateMemBuiltin translates memcpy(dst, src, n) and memset(dst, c, n).
+// A small constant n is expanded inline, widest pieces first; otherwise the
+// library function is called. The result, if used, is dst.
+func (t *StmtTranslator) translateMemBuiltin(s clight.Sbuiltin) csharpminor.Stmt {
+	size, ok := t.constValue(s.Args[2])
+	if !ok || size < 0 || size > maxInlineMem {
+		return t.translateCall(libraryCall(s))
+	}
+
+	dst := t.exprTr.TranslateExpr(s.Args[0])
+	var body csharpminor.Stmt
+	if s.Builtin == "memcpy" {
+		body = copyBytes(dst, t.exprTr.TranslateExpr(s.Args[1]), size)
+	} else if c, ok := t.constValue(s.Args[1]); ok {
+		body = fillBytes(dst, fillPattern(c), size)
+	} else {
+		body = fillBytes(dst, replicateByte(t.exprTr.TranslateExpr(s.Args[1])), size)
+	}
+	if s.Result != nil {
+		body = csharpminor.Seq(body, csharpminor.Sset{TempID: *s.Result, RHS: dst})
+	}
+	return body
+}
+
+// libraryCall turns a memcpy or memset builtin into a call to the C library
+// function of the same name, with the size converted to size_t.
+func libraryCall(s clight.Sbuiltin) clight.Scall {
+	voidPtr := ctypes.Pointer(ctypes.Void())
+	sizeT := ctypes.Tlong{Sign: ctypes.Unsigned}
+	params := []ctypes.Type{voidPtr, voidPtr, sizeT}
+	if s.Builtin == "memset" {
+		params[1] = ctypes.Int()
+	}
+	args := append([]clight.Expr(nil), s.Args...)
+	if !ctypes.Equal(args[2].ExprType(), sizeT) {
+		args[2] = clight.Ecast{Arg: args[2], Typ: sizeT}
+	}
+	return clight.Scall{
+		Result: s.Result,
+		Func:   clight.Evar{Name: s.Builtin, Typ: ctypes.Tfunction{Params: params, Return: voidPtr}},
+		Args:   args,
+	}
+}
+
+// constValue returns the value of an integer constant expression made of
+// literals, sizeof and casts.
+func (t *StmtTranslator) constValue(e clight.Expr) (int64, bool) {
+	switch expr := e.(type) {
+	case clight.Econst_int:
+		return expr.Value, true
+	case clight.Econst_long:
+		return expr.Value, true
+	case clight.Esizeof:
+		return sizeofType(t.resolveType(expr.ArgType)), true
+	case clight.Ecast:
+		return t.constValue(expr.Arg)
+	}
+	return 0, false
+}
+
+// fillPattern returns the low byte of c repeated across a 64-bit word.
+func fillPattern(c int64) csharpminor.Expr {
+	word := int64(uint64(uint8(c)) * 0x0101010101010101)
+	return csharpminor.Econst{Const: csharpminor.Olongconst{Value: word}}
+}
+
+// replicateByte computes the low byte of an int repeated across a 64-bit word.
+func replicateByte(c csharpminor.Expr) csharpminor.Expr {
+	return csharpminor.Ebinop{
+		Op:    csharpminor.Omull,
+		Left:  csharpminor.Eunop{Op: csharpminor.Olongofintu, Arg: csharpminor.Eunop{Op: csharpminor.Ocast8unsigned, Arg: c}},
+		Right: csharpminor.Econst{Const: csharpminor.Olongconst{Value: 0x0101010101010101}},
+	}
+}
+
+// fillBytes stores size bytes of a replicated byte pattern at dst, widest
+// pieces first.
+func fillBytes(dst, pattern csharpminor.Expr, size int64) csharpminor.Stmt {
+	var stmts []csharpminor.Stmt
+	for off := int64(0); off < size; {
+		chunk, n := pieceChunk(size - off)
+		piece := pattern
+		if n < 8 {
+			if c, ok := pattern.(csharpminor.Econst); ok {
+				piece = csharpminor.Econst{Const: csharpminor.Ointconst{Value: int32(c.Const.(csharpminor.Olongconst).Value)}}
+			} else {
+				piece = csharpminor.Eunop{Op: csharpminor.Ointoflong, Arg: pattern}
+			}
+		}
+		stmts = append(stmts, csharpminor.Sstore{Chunk: chunk, Addr: offsetAddr(dst, off), Value: piece})
+		off += n
+	}
+	return csharpminor.Seq(stmts...)
+}
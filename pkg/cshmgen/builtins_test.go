@@ -0,0 +1,99 @@
+package cshmgen
+
+import (
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/csharpminor"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+func TestTranslateBuiltin_SmallMemcpyInline(t *testing.T) {
+	ptr := ctypes.Pointer(ctypes.Char())
+	tr := newTestStmtTranslator()
+	// memcpy(d, s, 12)
+	result := tr.TranslateStmt(clight.Sbuiltin{
+		Builtin: "memcpy",
+		Args: []clight.Expr{
+			clight.Etempvar{ID: 1, Typ: ptr},
+			clight.Etempvar{ID: 2, Typ: ptr},
+			clight.Econst_int{Value: 12, Typ: ctypes.Int()},
+		},
+	})
+
+	stmts := flattenSeq(result)
+	want := []csharpminor.Chunk{csharpminor.Mint64, csharpminor.Mint32}
+	if len(stmts) != len(want) {
+		t.Fatalf("expected %d stores, got %d: %#v", len(want), len(stmts), result)
+	}
+	for i, s := range stmts {
+		store, ok := s.(csharpminor.Sstore)
+		if !ok || store.Chunk != want[i] {
+			t.Errorf("stmt %d: expected %v store, got %#v", i, want[i], s)
+		}
+	}
+}
+
+func TestTranslateBuiltin_UnknownSizeCallsLibrary(t *testing.T) {
+	ptr := ctypes.Pointer(ctypes.Char())
+	res := 3
+	tr := newTestStmtTranslator()
+	// $3 = memset(d, 0, n)
+	result := tr.TranslateStmt(clight.Sbuiltin{
+		Result:  &res,
+		Builtin: "memset",
+		Args: []clight.Expr{
+			clight.Etempvar{ID: 1, Typ: ptr},
+			clight.Econst_int{Value: 0, Typ: ctypes.Int()},
+			clight.Etempvar{ID: 2, Typ: ctypes.Int()},
+		},
+	})
+
+	call, ok := result.(csharpminor.Scall)
+	if !ok {
+		t.Fatalf("expected Scall, got %T", result)
+	}
+	if fn, ok := call.Func.(csharpminor.Evar); !ok || fn.Name != "memset" {
+		t.Errorf("expected call to memset, got %#v", call.Func)
+	}
+	if call.Result == nil || *call.Result != res {
+		t.Errorf("expected result in $%d, got %v", res, call.Result)
+	}
+	if len(call.Args) != 3 {
+		t.Fatalf("expected 3 arguments, got %d", len(call.Args))
+	}
+	// The int size is widened to size_t
+	if op, ok := call.Args[2].(csharpminor.Eunop); !ok || op.Op != csharpminor.Olongofint {
+		t.Errorf("expected size converted with Olongofint, got %#v", call.Args[2])
+	}
+}
+
+func TestFillBytesPattern(t *testing.T) {
+	stmts := flattenSeq(fillBytes(csharpminor.Eaddrof{Name: "d"}, fillPattern(0xab), 10))
+
+	if len(stmts) != 2 {
+		t.Fatalf("expected int64 and int16 stores, got %d statements", len(stmts))
+	}
+	first := stmts[0].(csharpminor.Sstore)
+	if c := first.Value.(csharpminor.Econst).Const.(csharpminor.Olongconst); uint64(c.Value) != 0xabababababababab {
+		t.Errorf("expected replicated 0xab word, got %#x", c.Value)
+	}
+	second := stmts[1].(csharpminor.Sstore)
+	if second.Chunk != csharpminor.Mint16unsigned {
+		t.Errorf("expected Mint16unsigned tail, got %v", second.Chunk)
+	}
+	if _, ok := second.Value.(csharpminor.Econst).Const.(csharpminor.Ointconst); !ok {
+		t.Errorf("expected int constant for the tail, got %#v", second.Value)
+	}
+}
+
+func TestTranslateBuiltin_VaEndIsSkip(t *testing.T) {
+	tr := newTestStmtTranslator()
+	result := tr.TranslateStmt(clight.Sbuiltin{
+		Builtin: "va_end",
+		Args:    []clight.Expr{clight.Eaddrof{Arg: clight.Evar{Name: "ap", Typ: ctypes.VaList()}, Typ: ctypes.Pointer(ctypes.VaList())}},
+	})
+	if _, ok := result.(csharpminor.Sskip); !ok {
+		t.Errorf("expected Sskip, got %T", result)
+	}
+}
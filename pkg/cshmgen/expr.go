@@ -12,8 +12,9 @@ import (
 
 // StringLiteral holds info about a string literal for later emission.
 type StringLiteral struct {
-	Label string
-	Value string
+	Label     string
+	Value     string
+	CharWidth int64 // bytes per character, and so of the terminator
 }
 
 // ExprTranslator translates Clight expressions to Csharpminor expressions.
@@ -24,9 +25,18 @@ type ExprTranslator struct {
 	stringCounter int
 	// strings collects all string literals for later emission
 	strings []StringLiteral
+	// stringLabels maps each string literal to its label, so that identical
+	// literals share a single definition
+	stringLabels map[StringLiteral]string
 	// paramTemps maps modified parameter names to their shadow temp IDs
 	// This is set externally when parameters are modified
 	paramTemps map[string]int
+	// structDefs gives the layout of the structs pointer arithmetic steps over
+	structDefs map[string]ctypes.Tstruct
+	// volatileGlobals tracks which globals are declared volatile, and
+	// volatiles the variables in scope, locals shadowing globals
+	volatileGlobals map[string]bool
+	volatiles       map[string]bool
 }
 
 // NewExprTranslator creates a new expression translator.
@@ -34,7 +44,7 @@ func NewExprTranslator(globals map[string]bool) *ExprTranslator {
 	if globals == nil {
 		globals = make(map[string]bool)
 	}
-	return &ExprTranslator{globals: globals, stringCounter: 0, strings: nil, paramTemps: make(map[string]int)}
+	return &ExprTranslator{globals: globals, stringCounter: 0, strings: nil, stringLabels: make(map[StringLiteral]string), paramTemps: make(map[string]int), volatileGlobals: make(map[string]bool)}
 }
 
 // SetParamTemps sets the parameter-to-temp mapping for reading modified parameters.
@@ -49,6 +59,15 @@ func (t *ExprTranslator) GetStrings() []StringLiteral {
 
 // TranslateExpr translates a Clight expression to a Csharpminor expression.
 func (t *ExprTranslator) TranslateExpr(e clight.Expr) csharpminor.Expr {
+	// An array used as a value stands for the address of its first
+	// element, as for CompCert's By_reference access mode: f(s) with
+	// char s[8] passes &s, not the first bytes of s
+	if _, ok := e.ExprType().(ctypes.Tarray); ok {
+		switch e.(type) {
+		case clight.Evar, clight.Ederef, clight.Efield:
+			return t.translateLvalueAddr(e)
+		}
+	}
 	switch expr := e.(type) {
 	case clight.Econst_int:
 		return t.translateConstInt(expr)
@@ -116,13 +135,21 @@ func (t *ExprTranslator) translateConstSingle(e clight.Econst_single) csharpmino
 }
 
 // translateString translates a string literal to a symbol address constant.
-// Generates a unique label and stores the string for later emission.
+// The first occurrence of a literal generates a unique label and stores the
+// string for later emission; string literals are not modifiable, so later
+// occurrences reuse the label, as CompCert's C2C does.
 func (t *ExprTranslator) translateString(e clight.Estring) csharpminor.Expr {
-	// Generate unique label for this string
-	label := fmt.Sprintf(".Lstr%d", t.stringCounter)
-	t.stringCounter++
-	// Store for later emission in rodata section
-	t.strings = append(t.strings, StringLiteral{Label: label, Value: e.Value})
+	width, _ := t.elemSize(e.Typ)
+	key := StringLiteral{Value: e.Value, CharWidth: width}
+	label, ok := t.stringLabels[key]
+	if !ok {
+		// Generate unique label for this string
+		label = fmt.Sprintf(".Lstr%d", t.stringCounter)
+		t.stringCounter++
+		t.stringLabels[key] = label
+		// Store for later emission in rodata section
+		t.strings = append(t.strings, StringLiteral{Label: label, Value: e.Value, CharWidth: width})
+	}
 	return csharpminor.Econst{Const: csharpminor.Oaddrsymbol{Name: label, Offset: 0}}
 }
 
@@ -134,6 +161,10 @@ func (t *ExprTranslator) translateVar(e clight.Evar) csharpminor.Expr {
 	if tempID, ok := t.paramTemps[e.Name]; ok {
 		return csharpminor.Etempvar{ID: tempID}
 	}
+	// A volatile variable is read from memory each time it is named
+	if t.volatiles[e.Name] && !isAggregate(e.Typ) {
+		return csharpminor.Eload{Chunk: csharpminor.ChunkForType(e.Typ), Addr: csharpminor.Eaddrof{Name: e.Name}, Volatile: true}
+	}
 	return csharpminor.Evar{Name: e.Name}
 }
 
@@ -157,6 +188,10 @@ func (t *ExprTranslator) translateBinop(e clight.Ebinop) csharpminor.Expr {
 	leftType := e.Left.ExprType()
 	rightType := e.Right.ExprType()
 
+	if scaled, ok := t.translatePointerArith(e.Op, left, right, leftType, rightType); ok {
+		return scaled
+	}
+
 	op, cmp := TranslateBinaryOp(e.Op, leftType, rightType)
 
 	// For comparison operators, use Ecmp
@@ -177,11 +212,79 @@ func (t *ExprTranslator) translateBinop(e clight.Ebinop) csharpminor.Expr {
 	return csharpminor.Ebinop{Op: op, Left: left, Right: right}
 }
 
+// translatePointerArith translates the additions and subtractions of C
+// pointer arithmetic, as CompCert's make_add and make_sub do: the integer
+// operand counts elements, so it is widened and scaled by the size of the
+// pointed-to type, and the difference of two pointers is divided by it.
+func (t *ExprTranslator) translatePointerArith(op clight.BinaryOp, left, right csharpminor.Expr, leftType, rightType ctypes.Type) (csharpminor.Expr, bool) {
+	leftSize, leftPtr := t.elemSize(leftType)
+	rightSize, rightPtr := t.elemSize(rightType)
+	switch {
+	case op == clight.Oadd && leftPtr && !rightPtr:
+		return csharpminor.Ebinop{Op: csharpminor.Oaddl, Left: left, Right: t.scaleIndex(right, rightType, leftSize)}, true
+	case op == clight.Oadd && rightPtr && !leftPtr:
+		return csharpminor.Ebinop{Op: csharpminor.Oaddl, Left: right, Right: t.scaleIndex(left, leftType, rightSize)}, true
+	case op == clight.Osub && leftPtr && !rightPtr:
+		return csharpminor.Ebinop{Op: csharpminor.Osubl, Left: left, Right: t.scaleIndex(right, rightType, leftSize)}, true
+	case op == clight.Osub && leftPtr && rightPtr:
+		diff := csharpminor.Ebinop{Op: csharpminor.Osubl, Left: left, Right: right}
+		if leftSize == 1 {
+			return diff, true
+		}
+		return csharpminor.Ebinop{Op: csharpminor.Odivl, Left: diff, Right: csharpminor.Econst{Const: csharpminor.Olongconst{Value: leftSize}}}, true
+	}
+	return nil, false
+}
+
+// elemSize returns the size of the type a pointer or array steps over, and
+// whether typ is one. Like CompCert, void and function types have size 1.
+func (t *ExprTranslator) elemSize(typ ctypes.Type) (int64, bool) {
+	var elem ctypes.Type
+	switch pt := typ.(type) {
+	case ctypes.Tpointer:
+		elem = pt.Elem
+	case ctypes.Tarray:
+		elem = pt.Elem
+	default:
+		return 0, false
+	}
+	if _, ok := elem.(ctypes.Tfunction); ok {
+		return 1, true
+	}
+	if size := sizeofType(resolveStructType(elem, t.structDefs)); size > 0 {
+		return size, true
+	}
+	return 1, true
+}
+
+// scaleIndex widens an integer operand of pointer arithmetic to 64 bits and
+// multiplies it by size. A constant index is scaled at compile time.
+func (t *ExprTranslator) scaleIndex(index csharpminor.Expr, typ ctypes.Type, size int64) csharpminor.Expr {
+	if c, ok := index.(csharpminor.Econst); ok {
+		switch v := c.Const.(type) {
+		case csharpminor.Ointconst:
+			return csharpminor.Econst{Const: csharpminor.Olongconst{Value: int64(v.Value) * size}}
+		case csharpminor.Olongconst:
+			return csharpminor.Econst{Const: csharpminor.Olongconst{Value: v.Value * size}}
+		}
+	}
+	signed := true
+	if it, ok := typ.(ctypes.Tint); ok {
+		signed = it.Sign != ctypes.Unsigned
+	}
+	index = t.extendToLong(index, typ, signed)
+	if size == 1 {
+		return index
+	}
+	return csharpminor.Ebinop{Op: csharpminor.Omull, Left: index, Right: csharpminor.Econst{Const: csharpminor.Olongconst{Value: size}}}
+}
+
 // extendToLong inserts a cast to extend a smaller integer type to long if needed.
 // signedExtend indicates whether to use signed or unsigned extension.
 func (t *ExprTranslator) extendToLong(e csharpminor.Expr, typ ctypes.Type, signedExtend bool) csharpminor.Expr {
 	// Already a long type - no extension needed
-	if _, isLong := typ.(ctypes.Tlong); isLong {
+	switch typ.(type) {
+	case ctypes.Tlong, ctypes.Tpointer, ctypes.Tarray:
 		return e
 	}
 	// For int types (32-bit), extend to long
@@ -218,7 +321,7 @@ func (t *ExprTranslator) translateCast(e clight.Ecast) csharpminor.Expr {
 func (t *ExprTranslator) translateDeref(e clight.Ederef) csharpminor.Expr {
 	addr := t.TranslateExpr(e.Ptr)
 	chunk := csharpminor.ChunkForType(e.Typ)
-	return csharpminor.Eload{Chunk: chunk, Addr: addr}
+	return csharpminor.Eload{Chunk: chunk, Addr: addr, Volatile: e.Volatile}
 }
 
 // translateAddrof translates address-of (&x).
@@ -234,6 +337,9 @@ func (t *ExprTranslator) translateAddrof(e clight.Eaddrof) csharpminor.Expr {
 	case clight.Efield:
 		// &(s.f) - address of struct field
 		return t.TranslateFieldAddr(inner)
+	case clight.Estring:
+		// "abc"[i] indexes the array of the literal
+		return t.translateString(inner)
 	}
 	panic("cannot take address of expression")
 }
@@ -243,7 +349,20 @@ func (t *ExprTranslator) translateAddrof(e clight.Eaddrof) csharpminor.Expr {
 func (t *ExprTranslator) translateField(e clight.Efield) csharpminor.Expr {
 	addr := t.TranslateFieldAddr(e)
 	chunk := csharpminor.ChunkForType(e.Typ)
-	return csharpminor.Eload{Chunk: chunk, Addr: addr}
+	return csharpminor.Eload{Chunk: chunk, Addr: addr, Volatile: e.Volatile}
+}
+
+// isVolatileLvalue reports whether an l-value designates a volatile object.
+func (t *ExprTranslator) isVolatileLvalue(e clight.Expr) bool {
+	switch lv := e.(type) {
+	case clight.Evar:
+		return t.volatiles[lv.Name]
+	case clight.Ederef:
+		return lv.Volatile
+	case clight.Efield:
+		return lv.Volatile
+	}
+	return false
 }
 
 // TranslateFieldAddr computes the address of a struct field.
@@ -284,6 +403,9 @@ func (t *ExprTranslator) translateLvalueAddr(e clight.Expr) csharpminor.Expr {
 // translateSizeof translates sizeof(type) to a constant.
 func (t *ExprTranslator) translateSizeof(e clight.Esizeof) csharpminor.Expr {
 	size := sizeofType(e.ArgType)
+	if _, ok := e.Typ.(ctypes.Tlong); ok {
+		return csharpminor.Econst{Const: csharpminor.Olongconst{Value: size}}
+	}
 	return csharpminor.Econst{Const: csharpminor.Ointconst{Value: int32(size)}}
 }
 
@@ -295,6 +417,12 @@ func (t *ExprTranslator) translateAlignof(e clight.Ealignof) csharpminor.Expr {
 
 // --- Helper functions for type layout ---
 
+// Sizeof returns the size of a type in bytes, with the padding of its
+// layout: the value sizeof(t) evaluates to.
+func Sizeof(t ctypes.Type) int64 {
+	return sizeofType(t)
+}
+
 // sizeofType returns the size of a type in bytes.
 func sizeofType(t ctypes.Type) int64 {
 	switch typ := t.(type) {
@@ -368,8 +496,7 @@ func alignofType(t ctypes.Type) int64 {
 func sizeofStruct(s ctypes.Tstruct) int64 {
 	var size int64
 	for _, f := range s.Fields {
-		align := alignofType(f.Type)
-		size = alignUp(size, align)
+		size = alignUp(size, fieldAlign(f, s.Packed))
 		size += sizeofType(f.Type)
 	}
 	// Final alignment
@@ -379,14 +506,7 @@ func sizeofStruct(s ctypes.Tstruct) int64 {
 
 // alignofStruct returns the alignment of a struct.
 func alignofStruct(s ctypes.Tstruct) int64 {
-	var maxAlign int64 = 1
-	for _, f := range s.Fields {
-		a := alignofType(f.Type)
-		if a > maxAlign {
-			maxAlign = a
-		}
-	}
-	return maxAlign
+	return aggregateAlign(s.Fields, s.Packed, s.Align)
 }
 
 // sizeofUnion computes the size of a union.
@@ -404,16 +524,42 @@ func sizeofUnion(u ctypes.Tunion) int64 {
 
 // alignofUnion returns the alignment of a union.
 func alignofUnion(u ctypes.Tunion) int64 {
+	return aggregateAlign(u.Fields, u.Packed, u.Align)
+}
+
+// aggregateAlign returns the alignment of a struct or union: that of its
+// most aligned field, raised to the alignment the definition requests.
+func aggregateAlign(fields []ctypes.Field, packed bool, align int64) int64 {
 	var maxAlign int64 = 1
-	for _, f := range u.Fields {
-		a := alignofType(f.Type)
+	for _, f := range fields {
+		a := fieldAlign(f, packed)
 		if a > maxAlign {
 			maxAlign = a
 		}
 	}
+	if align > maxAlign {
+		maxAlign = align
+	}
 	return maxAlign
 }
 
+// fieldAlign returns the alignment of a field. Fields of a packed struct
+// or union are byte-aligned, unless an aligned attribute of the field
+// asks for more.
+func fieldAlign(f ctypes.Field, packed bool) int64 {
+	align := int64(1)
+	if !packed {
+		align = alignofType(f.Type)
+	}
+	return max(align, f.Align)
+}
+
+// FieldOffset returns the offset of a field within a struct, 0 for the
+// members of a union.
+func FieldOffset(t ctypes.Type, fieldName string) int64 {
+	return fieldOffset(t, fieldName)
+}
+
 // fieldOffset computes the offset of a field within a struct.
 func fieldOffset(t ctypes.Type, fieldName string) int64 {
 	s, ok := t.(ctypes.Tstruct)
@@ -423,8 +569,7 @@ func fieldOffset(t ctypes.Type, fieldName string) int64 {
 
 	var offset int64
 	for _, f := range s.Fields {
-		align := alignofType(f.Type)
-		offset = alignUp(offset, align)
+		offset = alignUp(offset, fieldAlign(f, s.Packed))
 		if f.Name == fieldName {
 			return offset
 		}
@@ -1,6 +1,7 @@
 package cshmgen
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/clight"
@@ -94,6 +95,27 @@ func TestTranslateVar(t *testing.T) {
 	}
 }
 
+func TestTranslateArrayValue(t *testing.T) {
+	// An array used as a value, as in f(s) or (char *)s with char s[8],
+	// is the address of the array rather than a load of its contents
+	s := clight.Evar{Name: "s", Typ: ctypes.Array(ctypes.Char(), 8)}
+	tests := []struct {
+		name string
+		expr clight.Expr
+	}{
+		{"variable", s},
+		{"cast to pointer", clight.Ecast{Arg: s, Typ: ctypes.Pointer(ctypes.Char())}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewExprTranslator(nil).TranslateExpr(tt.expr)
+			if want := (csharpminor.Eaddrof{Name: "s"}); result != want {
+				t.Errorf("expected %#v, got %#v", want, result)
+			}
+		})
+	}
+}
+
 func TestTranslateTempvar(t *testing.T) {
 	tr := NewExprTranslator(nil)
 	expr := clight.Etempvar{ID: 5, Typ: ctypes.Int()}
@@ -183,6 +205,64 @@ func TestTranslateBinop(t *testing.T) {
 	}
 }
 
+func TestTranslatePointerArith(t *testing.T) {
+	row := ctypes.Pointer(ctypes.Array(ctypes.Int(), 3)) // int (*)[3]
+	p := clight.Etempvar{ID: 1, Typ: row}
+	q := clight.Etempvar{ID: 2, Typ: row}
+	i := clight.Etempvar{ID: 3, Typ: ctypes.Int()}
+	long := func(v int64) csharpminor.Expr { return csharpminor.Econst{Const: csharpminor.Olongconst{Value: v}} }
+	scaledI := csharpminor.Ebinop{
+		Op:    csharpminor.Omull,
+		Left:  csharpminor.Eunop{Op: csharpminor.Olongofint, Arg: csharpminor.Etempvar{ID: 3}},
+		Right: long(12),
+	}
+
+	tests := []struct {
+		name string
+		expr clight.Expr
+		want csharpminor.Expr
+	}{
+		{
+			"pointer plus constant",
+			clight.Ebinop{Op: clight.Oadd, Left: p, Right: clight.Econst_int{Value: 2, Typ: ctypes.Int()}, Typ: row},
+			csharpminor.Ebinop{Op: csharpminor.Oaddl, Left: csharpminor.Etempvar{ID: 1}, Right: long(24)},
+		},
+		{
+			"integer plus pointer",
+			clight.Ebinop{Op: clight.Oadd, Left: i, Right: p, Typ: row},
+			csharpminor.Ebinop{Op: csharpminor.Oaddl, Left: csharpminor.Etempvar{ID: 1}, Right: scaledI},
+		},
+		{
+			"pointer minus integer",
+			clight.Ebinop{Op: clight.Osub, Left: p, Right: i, Typ: row},
+			csharpminor.Ebinop{Op: csharpminor.Osubl, Left: csharpminor.Etempvar{ID: 1}, Right: scaledI},
+		},
+		{
+			"pointer difference",
+			clight.Ebinop{Op: clight.Osub, Left: p, Right: q, Typ: ctypes.Long()},
+			csharpminor.Ebinop{
+				Op:    csharpminor.Odivl,
+				Left:  csharpminor.Ebinop{Op: csharpminor.Osubl, Left: csharpminor.Etempvar{ID: 1}, Right: csharpminor.Etempvar{ID: 2}},
+				Right: long(12),
+			},
+		},
+		{
+			"char pointer is not scaled",
+			clight.Ebinop{Op: clight.Oadd, Left: clight.Etempvar{ID: 1, Typ: ctypes.Pointer(ctypes.Char())}, Right: i, Typ: ctypes.Pointer(ctypes.Char())},
+			csharpminor.Ebinop{Op: csharpminor.Oaddl, Left: csharpminor.Etempvar{ID: 1}, Right: csharpminor.Eunop{Op: csharpminor.Olongofint, Arg: csharpminor.Etempvar{ID: 3}}},
+		},
+	}
+
+	tr := NewExprTranslator(nil)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tr.TranslateExpr(tc.expr); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
 func TestTranslateComparison(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -234,7 +314,8 @@ func TestTranslateCast(t *testing.T) {
 		needCast bool
 	}{
 		{"same type", ctypes.Int(), ctypes.Int(), 0, false},
-		{"int to char", ctypes.Int(), ctypes.Char(), csharpminor.Ocast8signed, true},
+		{"int to char", ctypes.Int(), ctypes.Char(), csharpminor.Ocast8unsigned, true},
+		{"int to schar", ctypes.Int(), ctypes.SChar(), csharpminor.Ocast8signed, true},
 		{"int to uchar", ctypes.Int(), ctypes.UChar(), csharpminor.Ocast8unsigned, true},
 		{"int to long", ctypes.Int(), ctypes.Long(), csharpminor.Olongofint, true},
 		{"long to int", ctypes.Long(), ctypes.Int(), csharpminor.Ointoflong, true},
@@ -317,6 +398,15 @@ func TestTranslateSizeof(t *testing.T) {
 		{"double", ctypes.Double(), 8},
 		{"pointer", ctypes.Pointer(ctypes.Int()), 8},
 		{"array", ctypes.Array(ctypes.Int(), 10), 40},
+		{"empty struct", ctypes.Tstruct{Name: "E"}, 0},
+		{"struct with flexible array", ctypes.Tstruct{Name: "S", Fields: []ctypes.Field{
+			{Name: "n", Type: ctypes.Int()},
+			{Name: "data", Type: ctypes.Array(ctypes.Int(), -1)},
+		}}, 4},
+		{"flexible array raises alignment", ctypes.Tstruct{Name: "T", Fields: []ctypes.Field{
+			{Name: "c", Type: ctypes.Char()},
+			{Name: "v", Type: ctypes.Array(ctypes.Long(), -1)},
+		}}, 8},
 	}
 
 	tr := NewExprTranslator(nil)
@@ -374,6 +464,76 @@ func TestTranslateAlignof(t *testing.T) {
 	}
 }
 
+func TestStructLayoutAttributes(t *testing.T) {
+	// struct { char c; int i; }
+	fields := []ctypes.Field{{Name: "c", Type: ctypes.Char()}, {Name: "i", Type: ctypes.Int()}}
+	tests := []struct {
+		name   string
+		typ    ctypes.Tstruct
+		size   int64
+		align  int64
+		offset int64 // of i
+	}{
+		{"natural", ctypes.Tstruct{Name: "s", Fields: fields}, 8, 4, 4},
+		{"packed", ctypes.Tstruct{Name: "s", Fields: fields, Packed: true}, 5, 1, 1},
+		{"aligned", ctypes.Tstruct{Name: "s", Fields: fields, Align: 16}, 16, 16, 4},
+		{"packed and aligned", ctypes.Tstruct{Name: "s", Fields: fields, Packed: true, Align: 8}, 8, 8, 1},
+		{"aligned below natural", ctypes.Tstruct{Name: "s", Fields: fields, Align: 2}, 8, 4, 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sizeofType(tc.typ); got != tc.size {
+				t.Errorf("size = %d, want %d", got, tc.size)
+			}
+			if got := alignofType(tc.typ); got != tc.align {
+				t.Errorf("align = %d, want %d", got, tc.align)
+			}
+			if got := fieldOffset(tc.typ, "i"); got != tc.offset {
+				t.Errorf("offset of i = %d, want %d", got, tc.offset)
+			}
+		})
+	}
+}
+
+func TestAlignedFieldLayout(t *testing.T) {
+	// struct { char c; int i __attribute__((aligned(8))); char d; }
+	s := ctypes.Tstruct{Name: "s", Fields: []ctypes.Field{
+		{Name: "c", Type: ctypes.Char()},
+		{Name: "i", Type: ctypes.Int(), Align: 8},
+		{Name: "d", Type: ctypes.Char()},
+	}}
+	if got := fieldOffset(s, "i"); got != 8 {
+		t.Errorf("offset of i = %d, want 8", got)
+	}
+	if got := sizeofType(s); got != 16 {
+		t.Errorf("size = %d, want 16", got)
+	}
+	// The attribute of the field holds in a packed struct
+	s.Packed = true
+	if got := fieldOffset(s, "d"); got != 12 {
+		t.Errorf("packed: offset of d = %d, want 12", got)
+	}
+	if got := sizeofType(s); got != 16 {
+		t.Errorf("packed: size = %d, want 16", got)
+	}
+}
+
+func TestPackedUnionLayout(t *testing.T) {
+	// union { char c[5]; int i; } is padded to 8 bytes unless packed
+	u := ctypes.Tunion{Name: "u", Fields: []ctypes.Field{
+		{Name: "c", Type: ctypes.Tarray{Elem: ctypes.Char(), Size: 5}},
+		{Name: "i", Type: ctypes.Int()},
+	}}
+	if got := sizeofType(u); got != 8 {
+		t.Errorf("size = %d, want 8", got)
+	}
+	u.Packed = true
+	if got := sizeofType(u); got != 5 {
+		t.Errorf("packed size = %d, want 5", got)
+	}
+}
+
 func TestTranslateFieldAccess(t *testing.T) {
 	// Struct: struct point { int x; int y; }
 	pointType := ctypes.Tstruct{
@@ -414,3 +574,61 @@ func TestTranslateFieldAccess(t *testing.T) {
 		t.Fatalf("expected Ebinop for field y address, got %T", eload2.Addr)
 	}
 }
+
+func TestTranslateNestedFieldAccess(t *testing.T) {
+	// struct in { char c; int x; }; struct out { long l; struct in b; };
+	in := ctypes.Tstruct{
+		Name:   "in",
+		Fields: []ctypes.Field{{Name: "c", Type: ctypes.Char()}, {Name: "x", Type: ctypes.Int()}},
+	}
+	out := ctypes.Tstruct{
+		Name:   "out",
+		Fields: []ctypes.Field{{Name: "l", Type: ctypes.Long()}, {Name: "b", Type: in}},
+	}
+
+	// o.b.x is at offset 8 + 4
+	o := clight.Evar{Name: "o", Typ: out}
+	b := clight.Efield{Arg: o, FieldName: "b", Typ: in}
+	result := NewExprTranslator(nil).TranslateExpr(clight.Efield{Arg: b, FieldName: "x", Typ: ctypes.Int()})
+
+	eload, ok := result.(csharpminor.Eload)
+	if !ok {
+		t.Fatalf("expected Eload, got %T", result)
+	}
+	var offset int64
+	addr := eload.Addr
+	for {
+		add, ok := addr.(csharpminor.Ebinop)
+		if !ok {
+			break
+		}
+		offset += add.Right.(csharpminor.Econst).Const.(csharpminor.Olongconst).Value
+		addr = add.Left
+	}
+	if offset != 12 {
+		t.Errorf("expected offset 12, got %d", offset)
+	}
+}
+
+func TestTranslateStringPooling(t *testing.T) {
+	charPtr := ctypes.Array(ctypes.Char(), 6)
+	tr := NewExprTranslator(nil)
+
+	labelOf := func(value string, typ ctypes.Type) string {
+		result := tr.TranslateExpr(clight.Estring{Value: value, Typ: typ})
+		return result.(csharpminor.Econst).Const.(csharpminor.Oaddrsymbol).Name
+	}
+	hello := labelOf("hello", charPtr)
+	bye := labelOf("bye", ctypes.Array(ctypes.Char(), 4))
+	wide := labelOf("hello", ctypes.Array(ctypes.Int(), 6))
+
+	if again := labelOf("hello", charPtr); again != hello {
+		t.Errorf("identical literals got labels %s and %s", hello, again)
+	}
+	if bye == hello || wide == hello {
+		t.Errorf("distinct literals share a label: %s %s %s", hello, bye, wide)
+	}
+	if n := len(tr.GetStrings()); n != 3 {
+		t.Errorf("expected 3 pooled strings, got %d", n)
+	}
+}
@@ -263,11 +263,14 @@ func translateCmpBoth(left, right ctypes.Type) csharpminor.BinaryOp {
 		return translateCmp(right)
 	}
 
-	// Handle pointer types - always use unsigned long comparison
-	if _, ok := left.(ctypes.Tpointer); ok {
+	// Handle pointer types, arrays decaying to them - always use unsigned
+	// long comparison
+	switch left.(type) {
+	case ctypes.Tpointer, ctypes.Tarray:
 		return csharpminor.Ocmplu
 	}
-	if _, ok := right.(ctypes.Tpointer); ok {
+	switch right.(type) {
+	case ctypes.Tpointer, ctypes.Tarray:
 		return csharpminor.Ocmplu
 	}
 
@@ -453,6 +456,22 @@ func TranslateCast(fromType, toType ctypes.Type) (op csharpminor.UnaryOp, ok boo
 	return 0, false
 }
 
+// AAPCS64 leaves the bits of a char or short argument or result above its
+// size unspecified. A function therefore extends its small integer
+// parameters on entry and a caller extends small integer results after
+// the call; loads of such values are already extended by their chunk.
+
+// extendSmallInt sign- or zero-extends e from the size of its type t.
+// It returns false if t is not a char or short type.
+func extendSmallInt(e csharpminor.Expr, t ctypes.Type) (csharpminor.Expr, bool) {
+	it, ok := t.(ctypes.Tint)
+	if !ok || (it.Size != ctypes.I8 && it.Size != ctypes.I16) {
+		return e, false
+	}
+	op, _ := TranslateCast(ctypes.Int(), it)
+	return csharpminor.Eunop{Op: op, Arg: e}, true
+}
+
 // IsComparisonOp returns true if the Clight binary operator is a comparison
 func IsComparisonOp(op clight.BinaryOp) bool {
 	switch op {
@@ -190,23 +190,29 @@ func TestTranslateBinaryOp_Bitwise(t *testing.T) {
 
 func TestTranslateBinaryOp_Shift(t *testing.T) {
 	tests := []struct {
-		name     string
-		op       clight.BinaryOp
-		leftType ctypes.Type
-		want     csharpminor.BinaryOp
+		name      string
+		op        clight.BinaryOp
+		leftType  ctypes.Type
+		rightType ctypes.Type
+		want      csharpminor.BinaryOp
 	}{
-		{"shl int", clight.Oshl, ctypes.Int(), csharpminor.Oshl},
-		{"shl long", clight.Oshl, ctypes.Long(), csharpminor.Oshll},
-		{"shr signed int", clight.Oshr, ctypes.Int(), csharpminor.Oshr},
-		{"shr unsigned int", clight.Oshr, ctypes.UInt(), csharpminor.Oshru},
-		{"shr signed long", clight.Oshr, ctypes.Long(), csharpminor.Oshrl},
-		{"shr unsigned long", clight.Oshr, ctypes.Tlong{Sign: ctypes.Unsigned}, csharpminor.Oshrlu},
+		{"shl int", clight.Oshl, ctypes.Int(), ctypes.Int(), csharpminor.Oshl},
+		{"shl long", clight.Oshl, ctypes.Long(), ctypes.Int(), csharpminor.Oshll},
+		{"shr signed int", clight.Oshr, ctypes.Int(), ctypes.Int(), csharpminor.Oshr},
+		{"shr unsigned int", clight.Oshr, ctypes.UInt(), ctypes.Int(), csharpminor.Oshru},
+		{"shr signed long", clight.Oshr, ctypes.Long(), ctypes.Int(), csharpminor.Oshrl},
+		{"shr unsigned long", clight.Oshr, ctypes.Tlong{Sign: ctypes.Unsigned}, ctypes.Int(), csharpminor.Oshrlu},
+		// The type of the shift is the left operand's alone
+		{"shr signed int by unsigned long", clight.Oshr, ctypes.Int(), ctypes.Tlong{Sign: ctypes.Unsigned}, csharpminor.Oshr},
+		{"shr unsigned int by long", clight.Oshr, ctypes.UInt(), ctypes.Long(), csharpminor.Oshru},
+		{"shr signed long by unsigned int", clight.Oshr, ctypes.Long(), ctypes.UInt(), csharpminor.Oshrl},
+		{"shl int by long", clight.Oshl, ctypes.Int(), ctypes.Long(), csharpminor.Oshl},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _ := TranslateBinaryOp(tt.op, tt.leftType, ctypes.Int())
+			got, _ := TranslateBinaryOp(tt.op, tt.leftType, tt.rightType)
 			if got != tt.want {
-				t.Errorf("TranslateBinaryOp(%v, %v) = %v, want %v", tt.op, tt.leftType, got, tt.want)
+				t.Errorf("TranslateBinaryOp(%v, %v, %v) = %v, want %v", tt.op, tt.leftType, tt.rightType, got, tt.want)
 			}
 		})
 	}
@@ -247,7 +253,7 @@ func TestTranslateCast_IntTruncation(t *testing.T) {
 		to   ctypes.Type
 		want csharpminor.UnaryOp
 	}{
-		{"to signed char", ctypes.Char(), csharpminor.Ocast8signed},
+		{"to signed char", ctypes.SChar(), csharpminor.Ocast8signed},
 		{"to unsigned char", ctypes.UChar(), csharpminor.Ocast8unsigned},
 		{"to signed short", ctypes.Short(), csharpminor.Ocast16signed},
 		{"to unsigned short", ctypes.Tint{Size: ctypes.I16, Sign: ctypes.Unsigned}, csharpminor.Ocast16unsigned},
@@ -3,6 +3,9 @@
 package cshmgen
 
 import (
+	"maps"
+	"slices"
+
 	"github.com/raymyers/ralph-cc/pkg/clight"
 	"github.com/raymyers/ralph-cc/pkg/csharpminor"
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
@@ -24,21 +27,30 @@ func TranslateProgram(prog *clight.Program) *csharpminor.Program {
 		globals[g.Name] = true
 	}
 
-	// Translate global variables
+	// Translate global variables. A const object the unit defines cannot
+	// be written, so it goes with the read-only data.
 	for _, g := range prog.Globals {
 		typ := resolveStructType(g.Type, structDefs)
 		size := sizeofType(typ)
 		signed := isSignedType(typ)
 		result.Globals = append(result.Globals, csharpminor.VarDecl{
-			Name:   g.Name,
-			Size:   size,
-			Init:   g.Init,
-			Signed: signed,
+			Name:     g.Name,
+			Size:     size,
+			Init:     g.Init,
+			Signed:   signed,
+			Extern:   g.Extern,
+			Static:   g.Static,
+			ReadOnly: g.Quals.At(0).Const && !g.Extern,
 		})
 	}
 
 	// Create a shared expression translator to collect strings across all functions
 	exprTr := NewExprTranslator(globals)
+	for _, g := range prog.Globals {
+		if g.Quals.At(0).Volatile {
+			exprTr.volatileGlobals[g.Name] = true
+		}
+	}
 
 	// Translate functions
 	for _, fn := range prog.Functions {
@@ -48,8 +60,8 @@ func TranslateProgram(prog *clight.Program) *csharpminor.Program {
 
 	// Add collected string literals as read-only globals
 	for _, str := range exprTr.GetStrings() {
-		// String data with null terminator
-		data := append([]byte(str.Value), 0)
+		// String data with a null terminator as wide as a character
+		data := append([]byte(str.Value), make([]byte, max(str.CharWidth, 1))...)
 		result.Globals = append(result.Globals, csharpminor.VarDecl{
 			Name:     str.Label,
 			Size:     int64(len(data)),
@@ -101,18 +113,47 @@ func translateFunctionWithTranslator(fn *clight.Function, exprTr *ExprTranslator
 // translateFunctionWithStructs translates a function with struct definitions for type resolution.
 func translateFunctionWithStructs(fn *clight.Function, exprTr *ExprTranslator, structDefs map[string]ctypes.Tstruct) csharpminor.Function {
 	stmtTr := NewStmtTranslator(exprTr)
+	stmtTr.structDefs = structDefs
+	exprTr.structDefs = structDefs
+	stmtTr.returnType = resolveStructType(fn.Return, structDefs)
 
-	// Build signature
+	// Build signature. Aggregate parameters and results are lowered to
+	// words or pointers (see structs.go); aggregate parameters are rebuilt
+	// in a local of the same name on entry.
 	sig := csharpminor.Sig{
 		Return: fn.Return,
 	}
+	var sigParams []string
+	var entryStmts []csharpminor.Stmt
+	var aggregateLocals []csharpminor.VarDecl
+	if returnsViaPointer(stmtTr.returnType) {
+		sig.Sret = true
+		sig.Return = ctypes.Void()
+		sig.Args = append(sig.Args, ctypes.Pointer(stmtTr.returnType))
+		sigParams = append(sigParams, sretParam)
+	} else if isAggregate(stmtTr.returnType) {
+		sig.Return = ctypes.Long()
+	}
 	for _, p := range fn.Params {
+		typ := resolveStructType(p.Type, structDefs)
+		if isAggregate(typ) {
+			names, types, entry := aggregateParam(p.Name, typ)
+			sigParams = append(sigParams, names...)
+			sig.Args = append(sig.Args, types...)
+			entryStmts = append(entryStmts, entry)
+			aggregateLocals = append(aggregateLocals, csharpminor.VarDecl{Name: p.Name, Size: sizeofType(typ), Signed: true})
+			continue
+		}
+		sigParams = append(sigParams, p.Name)
 		sig.Args = append(sig.Args, p.Type)
 	}
 
-	// Translate locals, resolving struct types
-	var locals []csharpminor.VarDecl
+	// Translate locals, resolving struct types. A local shadows the
+	// global of the same name, volatile or not.
+	exprTr.volatiles = maps.Clone(exprTr.volatileGlobals)
+	locals := aggregateLocals
 	for _, l := range fn.Locals {
+		exprTr.volatiles[l.Name] = l.Quals.At(0).Volatile
 		typ := resolveStructType(l.Type, structDefs)
 		size := sizeofType(typ)
 		signed := isSignedType(typ)
@@ -126,7 +167,9 @@ func translateFunctionWithStructs(fn *clight.Function, exprTr *ExprTranslator, s
 	// Build parameter names and set them on the translator
 	var params []string
 	for _, p := range fn.Params {
-		params = append(params, p.Name)
+		if !isAggregate(resolveStructType(p.Type, structDefs)) {
+			params = append(params, p.Name)
+		}
 	}
 	stmtTr.SetParams(params)
 	
@@ -136,6 +179,17 @@ func translateFunctionWithStructs(fn *clight.Function, exprTr *ExprTranslator, s
 	// First pass: find which parameters are modified
 	// We scan the body to identify assignments to parameter names
 	modifiedParams := findModifiedParams(fn.Body, params)
+
+	// Small integer parameters are extended into a temp on entry too
+	paramTypes := make(map[string]ctypes.Type)
+	for _, p := range fn.Params {
+		paramTypes[p.Name] = p.Type
+	}
+	for _, name := range params {
+		if _, small := extendSmallInt(nil, paramTypes[name]); small && !slices.Contains(modifiedParams, name) {
+			modifiedParams = append(modifiedParams, name)
+		}
+	}
 	
 	// Allocate temp IDs for modified parameters and set up the mapping
 	// for both writing (in stmtTr) and reading (in exprTr)
@@ -161,27 +215,31 @@ func translateFunctionWithStructs(fn *clight.Function, exprTr *ExprTranslator, s
 	if len(paramTemps) > 0 {
 		var initStmts []csharpminor.Stmt
 		for name, tempID := range paramTemps {
-			// Generate: temp = param
+			// Generate: temp = param, extended if it is a small integer
+			rhs, _ := extendSmallInt(csharpminor.Evar{Name: name}, paramTypes[name])
 			initStmts = append(initStmts, csharpminor.Sset{
 				TempID: tempID,
-				RHS:    csharpminor.Evar{Name: name},
+				RHS:    rhs,
 			})
 		}
 		// Prepend initialization to body
 		body = csharpminor.Seq(append(initStmts, body)...)
 	}
+	if len(entryStmts) > 0 {
+		body = csharpminor.Seq(append(entryStmts, body)...)
+	}
+	locals = append(locals, stmtTr.extraLocals...)
 	
 	// Clear param temps from exprTr so it doesn't affect other functions
 	exprTr.SetParamTemps(make(map[string]int))
 
 	// Extend temps list to include param shadow temps
-	temps := make([]ctypes.Type, nextTempID)
+	temps := make([]ctypes.Type, stmtTr.nextTempID)
 	copy(temps, fn.Temps)
-	// Fill in types for param temps (look up from params)
-	paramTypes := make(map[string]ctypes.Type)
-	for _, p := range fn.Params {
-		paramTypes[p.Name] = p.Type
+	for id, typ := range stmtTr.extraTemps {
+		temps[id] = typ
 	}
+	// Fill in types for param temps (look up from params)
 	for name, id := range paramTemps {
 		if typ, ok := paramTypes[name]; ok {
 			temps[id] = typ
@@ -191,10 +249,11 @@ func translateFunctionWithStructs(fn *clight.Function, exprTr *ExprTranslator, s
 	return csharpminor.Function{
 		Name:   fn.Name,
 		Sig:    sig,
-		Params: params,
+		Params: sigParams,
 		Locals: locals,
 		Temps:  temps,
 		Body:   body,
+		Static: fn.Static,
 	}
 }
 
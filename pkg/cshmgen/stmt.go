@@ -8,26 +8,41 @@ import (
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
 )
 
+// blockKind tells what an enclosing Csharpminor block is the exit of.
+type blockKind int
+
+const (
+	breakBlock    blockKind = iota // exiting leaves a loop or switch
+	continueBlock                  // exiting runs a loop's step and next iteration
+)
+
 // StmtTranslator translates Clight statements to Csharpminor statements.
-// It tracks loop nesting to properly translate break/continue as Sexit with depth.
+// It tracks the enclosing loop and switch blocks to translate break/continue
+// as Sexit with the right depth.
 type StmtTranslator struct {
 	exprTr     *ExprTranslator
-	loopDepth  int // current loop nesting depth
-	blockDepth int // current block nesting depth (for break/continue)
+	blocks     []blockKind     // enclosing break/continue blocks, innermost last
 	params     map[string]bool // function parameter names
 	paramTemps map[string]int  // parameter name -> temp ID for modified params
 	nextTempID int             // next available temp ID for param copies
+
+	structDefs     map[string]ctypes.Tstruct // struct name -> full definition
+	returnType     ctypes.Type               // return type of the current function
+	aggregateTemps map[int]string            // aggregate-typed temp ID -> backing local
+	extraLocals    []csharpminor.VarDecl     // locals introduced for aggregate values
+	extraTemps     map[int]ctypes.Type       // temps introduced for second result words
 }
 
 // NewStmtTranslator creates a new statement translator.
 func NewStmtTranslator(exprTr *ExprTranslator) *StmtTranslator {
 	return &StmtTranslator{
 		exprTr:     exprTr,
-		loopDepth:  0,
-		blockDepth: 0,
 		params:     make(map[string]bool),
 		paramTemps: make(map[string]int),
 		nextTempID: 0,
+
+		aggregateTemps: make(map[int]string),
+		extraTemps:     make(map[int]ctypes.Type),
 	}
 }
 
@@ -38,6 +53,14 @@ func (t *StmtTranslator) SetParams(params []string) {
 	}
 }
 
+// newTemp allocates a fresh temp of type typ.
+func (t *StmtTranslator) newTemp(typ ctypes.Type) int {
+	id := t.nextTempID
+	t.nextTempID++
+	t.extraTemps[id] = typ
+	return id
+}
+
 // SetNextTempID sets the next available temp ID (should be after any temps from simplexpr).
 func (t *StmtTranslator) SetNextTempID(id int) {
 	t.nextTempID = id
@@ -116,6 +139,12 @@ func (t *StmtTranslator) TranslateStmt(s clight.Stmt) csharpminor.Stmt {
 // Clight: lhs = rhs (where lhs is Evar, Ederef, or Efield)
 // Csharpminor: Sstore(chunk, addr, value) for locals, Sset for parameters
 func (t *StmtTranslator) translateAssign(s clight.Sassign) csharpminor.Stmt {
+	if isAggregate(t.resolveType(s.LHS.ExprType())) {
+		if stmt, ok := t.translateAggregateCopy(t.exprTr.translateLvalueAddr(s.LHS), s.RHS); ok {
+			return stmt
+		}
+	}
+
 	value := t.exprTr.TranslateExpr(s.RHS)
 	
 	// Check if this is an assignment to a function parameter
@@ -131,9 +160,10 @@ func (t *StmtTranslator) translateAssign(s clight.Sassign) csharpminor.Stmt {
 	
 	addr, chunk := t.translateLvalue(s.LHS)
 	return csharpminor.Sstore{
-		Chunk: chunk,
-		Addr:  addr,
-		Value: value,
+		Chunk:    chunk,
+		Addr:     addr,
+		Value:    value,
+		Volatile: t.exprTr.isVolatileLvalue(s.LHS),
 	}
 }
 
@@ -159,6 +189,13 @@ func (t *StmtTranslator) translateLvalue(e clight.Expr) (addr csharpminor.Expr,
 // Clight: temp = expr
 // Csharpminor: Sset(temp, expr)
 func (t *StmtTranslator) translateSet(s clight.Sset) csharpminor.Stmt {
+	if typ := t.resolveType(s.RHS.ExprType()); isAggregate(typ) {
+		dst := csharpminor.Eaddrof{Name: t.tempLocal(s.TempID, typ)}
+		if stmt, ok := t.translateAggregateCopy(dst, s.RHS); ok {
+			return stmt
+		}
+	}
+
 	rhs := t.exprTr.TranslateExpr(s.RHS)
 	return csharpminor.Sset{
 		TempID: s.TempID,
@@ -167,21 +204,110 @@ func (t *StmtTranslator) translateSet(s clight.Sset) csharpminor.Stmt {
 }
 
 // translateCall translates a function call.
+// Aggregate arguments and results follow the conventions in structs.go.
+// Calls to variadic functions carry a signature listing the types of the
+// named arguments, so the back end knows where the variable ones start.
 func (t *StmtTranslator) translateCall(s clight.Scall) csharpminor.Stmt {
 	funcExpr := t.exprTr.TranslateExpr(s.Func)
-	args := make([]csharpminor.Expr, len(s.Args))
+
+	// A call through a function pointer has the pointed-to function type
+	funcType := s.Func.ExprType()
+	if ptr, ok := funcType.(ctypes.Tpointer); ok {
+		funcType = ptr.Elem
+	}
+	fn, _ := funcType.(ctypes.Tfunction)
+	var retType ctypes.Type = ctypes.Void()
+	if fn.Return != nil {
+		retType = t.resolveType(fn.Return)
+	}
+
+	var pre []csharpminor.Stmt
+	var args []csharpminor.Expr
+	var argTypes []ctypes.Type
+	var resultAddr csharpminor.Expr
+	if returnsViaPointer(retType) {
+		var local string
+		if s.Result != nil {
+			local = t.tempLocal(*s.Result, retType)
+		} else {
+			local = t.newAggregateLocal(retType)
+		}
+		resultAddr = csharpminor.Eaddrof{Name: local}
+		args = append(args, resultAddr)
+		argTypes = append(argTypes, ctypes.Pointer(retType))
+	}
+	named := len(args)
 	for i, arg := range s.Args {
-		args[i] = t.exprTr.TranslateExpr(arg)
+		copies, words, types := t.translateCallArg(arg)
+		pre = append(pre, copies...)
+		args = append(args, words...)
+		argTypes = append(argTypes, types...)
+		if i < len(fn.Params) {
+			named = len(args)
+		}
 	}
-	return csharpminor.Scall{
+
+	call := csharpminor.Scall{
 		Result: s.Result,
 		Func:   funcExpr,
 		Args:   args,
 	}
+	if fn.VarArg || resultAddr != nil {
+		call.Sig = &csharpminor.Sig{Args: argTypes, Return: retType, VarArg: fn.VarArg, Sret: resultAddr != nil}
+		if fn.VarArg {
+			call.Sig.Args = argTypes[:named]
+		}
+		if resultAddr != nil {
+			call.Sig.Return = ctypes.Void()
+		}
+	}
+	if resultAddr != nil {
+		call.Result = nil
+		return csharpminor.Seq(append(pre, call)...)
+	}
+	if isAggregate(retType) && s.Result != nil {
+		// The result words arrive in temps; spill them so the aggregate
+		// can be used through its address like any other.
+		size := sizeofType(retType)
+		dst := csharpminor.Eaddrof{Name: t.tempLocal(*s.Result, retType)}
+		store := storeWord(dst, csharpminor.Etempvar{ID: *s.Result}, wordSize(size, 0))
+		if aggregateWords(size) == 2 {
+			hi := t.newTemp(ctypes.Long())
+			call.ResultHi = &hi
+			store = csharpminor.Seq(store, storeWord(offsetAddr(dst, 8), csharpminor.Etempvar{ID: hi}, wordSize(size, 1)))
+		}
+		return csharpminor.Seq(append(pre, call, store)...)
+	}
+	if s.Result != nil {
+		if ext, small := extendSmallInt(csharpminor.Etempvar{ID: *s.Result}, retType); small {
+			return csharpminor.Seq(append(pre, call, csharpminor.Sset{TempID: *s.Result, RHS: ext})...)
+		}
+	}
+	return csharpminor.Seq(append(pre, call)...)
+}
+
+// translateCallArg returns the arguments that pass arg, with their types,
+// and the statements that must run before the call.
+func (t *StmtTranslator) translateCallArg(arg clight.Expr) ([]csharpminor.Stmt, []csharpminor.Expr, []ctypes.Type) {
+	typ := t.resolveType(arg.ExprType())
+	if isAggregate(typ) {
+		if copies, words, ok := t.translateAggregateArg(arg); ok {
+			types := make([]ctypes.Type, len(words))
+			for i := range types {
+				types[i] = ctypes.Long()
+			}
+			return copies, words, types
+		}
+	}
+	return nil, []csharpminor.Expr{t.exprTr.TranslateExpr(arg)}, []ctypes.Type{typ}
 }
 
-// translateBuiltin translates a builtin call.
+// translateBuiltin translates a builtin call. Builtins with a Csharpminor
+// expansion are handled in builtins.go; the rest are left to the back end.
 func (t *StmtTranslator) translateBuiltin(s clight.Sbuiltin) csharpminor.Stmt {
+	if stmt, ok := t.expandBuiltin(s); ok {
+		return stmt
+	}
 	args := make([]csharpminor.Expr, len(s.Args))
 	for i, arg := range s.Args {
 		args[i] = t.exprTr.TranslateExpr(arg)
@@ -231,23 +357,14 @@ func (t *StmtTranslator) translateIf(s clight.Sifthenelse) csharpminor.Stmt {
 //	  }
 //	}
 //
-// When translating break: Sexit(2) - exit loop + outer block
-// When translating continue: Sexit(1) - exit inner block only
+// In the body, break exits both blocks and continue exits the inner one;
+// see exitTo for the depth of each.
 func (t *StmtTranslator) translateLoop(s clight.Sloop) csharpminor.Stmt {
-	// Enter loop context
-	t.loopDepth++
-	savedBlockDepth := t.blockDepth
-	t.blockDepth = 0 // reset block depth for new loop
-
-	// Translate body inside inner block (for continue)
-	t.blockDepth = 1 // inside the continue block
+	t.blocks = append(t.blocks, breakBlock, continueBlock)
 	body := t.TranslateStmt(s.Body)
+	t.blocks = t.blocks[:len(t.blocks)-1]
 	continueStmt := t.TranslateStmt(s.Continue)
-	t.blockDepth = 0
-
-	// Restore context
-	t.loopDepth--
-	t.blockDepth = savedBlockDepth
+	t.blocks = t.blocks[:len(t.blocks)-1]
 
 	// Inner block for continue target
 	innerBlock := csharpminor.Sblock{Body: body}
@@ -263,8 +380,9 @@ func (t *StmtTranslator) translateLoop(s clight.Sloop) csharpminor.Stmt {
 }
 
 // translateBreak translates a break statement.
-// In Csharpminor, break becomes Sexit(1) to exit both the continue block and break block.
-// The structure is:
+// In Csharpminor, break exits every block up to and including the break
+// block of the innermost loop or switch. Directly in a loop body this is
+// Sexit(1), leaving the continue block and the break block:
 //   block {                    <- outer block (break target, exit index 1)
 //     loop {
 //       block {                <- inner block (continue target, exit index 0)
@@ -274,20 +392,53 @@ func (t *StmtTranslator) translateLoop(s clight.Sloop) csharpminor.Stmt {
 //     }
 //   }
 func (t *StmtTranslator) translateBreak() csharpminor.Stmt {
-	// Sexit(0) exits inner block (back to loop iteration with step)
-	// Sexit(1) exits both inner block + outer block (out of loop entirely)
-	return csharpminor.Sexit{N: 1}
+	return t.exitTo(breakBlock)
 }
 
 // translateContinue translates a continue statement.
-// In Csharpminor, continue becomes Sexit(0) to exit the inner (continue) block.
+// In Csharpminor, continue exits the continue block of the innermost loop,
+// leaving any switch blocks in between; Sexit(0) directly in a loop body.
 // After exiting, the loop executes continue_stmt (step) and restarts.
 func (t *StmtTranslator) translateContinue() csharpminor.Stmt {
+	return t.exitTo(continueBlock)
+}
+
+// exitTo returns the Sexit leaving the innermost enclosing block of the
+// given kind. Sexit(n) leaves n+1 blocks.
+func (t *StmtTranslator) exitTo(kind blockKind) csharpminor.Stmt {
+	for i := len(t.blocks) - 1; i >= 0; i-- {
+		if t.blocks[i] == kind {
+			return csharpminor.Sexit{N: len(t.blocks) - 1 - i}
+		}
+	}
+	// break or continue outside any loop or switch; the front end rejects
+	// these, so keep the old loop-relative depths
+	if kind == breakBlock {
+		return csharpminor.Sexit{N: 1}
+	}
 	return csharpminor.Sexit{N: 0}
 }
 
 // translateReturn translates a return statement.
 func (t *StmtTranslator) translateReturn(s clight.Sreturn) csharpminor.Stmt {
+	if s.Value != nil && isAggregate(t.resolveType(s.Value.ExprType())) {
+		if addr, ok := t.aggregateAddr(s.Value); ok {
+			typ := t.resolveType(s.Value.ExprType())
+			if returnsViaPointer(typ) {
+				return csharpminor.Seq(
+					copyBytes(csharpminor.Evar{Name: sretParam}, addr, sizeofType(typ)),
+					csharpminor.Sreturn{},
+				)
+			}
+			size := sizeofType(typ)
+			ret := csharpminor.Sreturn{Value: loadWord(addr, wordSize(size, 0))}
+			if aggregateWords(size) == 2 {
+				ret.Hi = loadWord(offsetAddr(addr, 8), wordSize(size, 1))
+			}
+			return ret
+		}
+	}
+
 	var value csharpminor.Expr
 	if s.Value != nil {
 		value = t.exprTr.TranslateExpr(s.Value)
@@ -296,7 +447,8 @@ func (t *StmtTranslator) translateReturn(s clight.Sreturn) csharpminor.Stmt {
 }
 
 // translateSwitch translates a switch statement.
-// Note: CompCert's switch semantics differ from C - no fall-through.
+// Case bodies keep their order; RTL generation chains each into the next.
+// A switch whose cases break is wrapped in a block that the breaks exit.
 func (t *StmtTranslator) translateSwitch(s clight.Sswitch) csharpminor.Stmt {
 	expr := t.exprTr.TranslateExpr(s.Expr)
 
@@ -306,6 +458,14 @@ func (t *StmtTranslator) translateSwitch(s clight.Sswitch) csharpminor.Stmt {
 		isLong = true
 	}
 
+	breaks := breaksOut(s.Default)
+	for _, c := range s.Cases {
+		breaks = breaks || breaksOut(c.Body)
+	}
+	if breaks {
+		t.blocks = append(t.blocks, breakBlock)
+	}
+
 	cases := make([]csharpminor.SwitchCase, len(s.Cases))
 	for i, c := range s.Cases {
 		cases[i] = csharpminor.SwitchCase{
@@ -316,12 +476,33 @@ func (t *StmtTranslator) translateSwitch(s clight.Sswitch) csharpminor.Stmt {
 
 	defaultStmt := t.TranslateStmt(s.Default)
 
-	return csharpminor.Sswitch{
+	var sw csharpminor.Stmt = csharpminor.Sswitch{
 		IsLong:  isLong,
 		Expr:    expr,
 		Cases:   cases,
 		Default: defaultStmt,
 	}
+	if breaks {
+		t.blocks = t.blocks[:len(t.blocks)-1]
+		sw = csharpminor.Sblock{Body: sw}
+	}
+	return sw
+}
+
+// breaksOut reports whether s contains a break that is not inside a
+// nested loop or switch.
+func breaksOut(s clight.Stmt) bool {
+	switch stmt := s.(type) {
+	case clight.Sbreak:
+		return true
+	case clight.Ssequence:
+		return breaksOut(stmt.First) || breaksOut(stmt.Second)
+	case clight.Sifthenelse:
+		return breaksOut(stmt.Then) || breaksOut(stmt.Else)
+	case clight.Slabel:
+		return breaksOut(stmt.Stmt)
+	}
+	return false
 }
 
 // translateLabel translates a labeled statement.
@@ -1,6 +1,7 @@
 package cshmgen
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/clight"
@@ -302,6 +303,81 @@ func TestTranslateContinue(t *testing.T) {
 	}
 }
 
+func TestTranslateBreakContinueThroughSwitch(t *testing.T) {
+	x := clight.Etempvar{ID: 1, Typ: ctypes.Int()}
+	tests := []struct {
+		name string
+		body clight.Stmt // loop body
+		want []int       // exit depths, in order
+	}{
+		{
+			// loop { switch (x) { case 1: break; } continue; }
+			name: "break exits the switch",
+			body: clight.Ssequence{
+				First:  clight.Sswitch{Expr: x, Cases: []clight.SwitchCase{{Value: 1, Body: clight.Sbreak{}}}, Default: clight.Sskip{}},
+				Second: clight.Scontinue{},
+			},
+			want: []int{0, 0},
+		},
+		{
+			// loop { switch (x) { case 1: break; default: continue; } }
+			name: "continue passes the switch block",
+			body: clight.Sswitch{Expr: x, Cases: []clight.SwitchCase{{Value: 1, Body: clight.Sbreak{}}}, Default: clight.Scontinue{}},
+			want: []int{0, 1},
+		},
+		{
+			// loop { switch (x) { default: continue; } break; }
+			name: "switch without break adds no block",
+			body: clight.Ssequence{
+				First:  clight.Sswitch{Expr: x, Default: clight.Scontinue{}},
+				Second: clight.Sbreak{},
+			},
+			want: []int{0, 1},
+		},
+		{
+			// loop { loop { break; } break; }
+			name: "nested loops",
+			body: clight.Ssequence{
+				First:  clight.Sloop{Body: clight.Sbreak{}, Continue: clight.Sskip{}},
+				Second: clight.Sbreak{},
+			},
+			want: []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestStmtTranslator()
+			result := tr.TranslateStmt(clight.Sloop{Body: tt.body, Continue: clight.Sskip{}})
+
+			var got []int
+			var walk func(s csharpminor.Stmt)
+			walk = func(s csharpminor.Stmt) {
+				switch s := s.(type) {
+				case csharpminor.Sexit:
+					got = append(got, s.N)
+				case csharpminor.Sblock:
+					walk(s.Body)
+				case csharpminor.Sloop:
+					walk(s.Body)
+				case csharpminor.Sseq:
+					walk(s.First)
+					walk(s.Second)
+				case csharpminor.Sswitch:
+					for _, c := range s.Cases {
+						walk(c.Body)
+					}
+					walk(s.Default)
+				}
+			}
+			walk(result)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected exits %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestTranslateCall(t *testing.T) {
 	tr := newTestStmtTranslator()
 	resultID := 1
@@ -345,6 +421,60 @@ func TestTranslateCallVoid(t *testing.T) {
 	}
 }
 
+func TestTranslateCallSmallIntResult(t *testing.T) {
+	// $1 = get() where get returns signed char: the caller extends $1
+	tr := newTestStmtTranslator()
+	resultID := 1
+	get := clight.Evar{Name: "get", Typ: ctypes.Tfunction{Return: ctypes.SChar()}}
+	seq := flattenSeq(tr.TranslateStmt(clight.Scall{Result: &resultID, Func: get}))
+
+	if len(seq) != 2 {
+		t.Fatalf("expected call and extension, got %v", seq)
+	}
+	ext, ok := seq[1].(csharpminor.Sset)
+	if !ok || ext.TempID != resultID {
+		t.Fatalf("expected $1 = ..., got %#v", seq[1])
+	}
+	unop, ok := ext.RHS.(csharpminor.Eunop)
+	if !ok || unop.Op != csharpminor.Ocast8signed {
+		t.Fatalf("expected cast8signed, got %#v", ext.RHS)
+	}
+	if tv, ok := unop.Arg.(csharpminor.Etempvar); !ok || tv.ID != resultID {
+		t.Errorf("expected the result extended in place, got %#v", unop.Arg)
+	}
+}
+
+func TestTranslateCallVariadic(t *testing.T) {
+	logf := ctypes.Tfunction{Params: []ctypes.Type{ctypes.Pointer(ctypes.Char())}, Return: ctypes.Int(), VarArg: true}
+	one := clight.Econst_int{Value: 1, Typ: ctypes.Int()}
+	tests := []struct {
+		name string
+		args []clight.Expr
+	}{
+		{"no variable arguments", []clight.Expr{clight.Estring{Value: "x", Typ: ctypes.Pointer(ctypes.Char())}}},
+		{"two variable arguments", []clight.Expr{clight.Estring{Value: "x", Typ: ctypes.Pointer(ctypes.Char())}, one, one}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestStmtTranslator()
+			result := tr.TranslateStmt(clight.Scall{Func: clight.Evar{Name: "logf", Typ: logf}, Args: tt.args})
+
+			scall, ok := result.(csharpminor.Scall)
+			if !ok {
+				t.Fatalf("expected Scall, got %T", result)
+			}
+			if len(scall.Args) != len(tt.args) {
+				t.Errorf("expected %d args, got %d", len(tt.args), len(scall.Args))
+			}
+			// Only the named format argument is part of the signature
+			if scall.Sig == nil || !scall.Sig.VarArg || len(scall.Sig.Args) != 1 {
+				t.Errorf("expected variadic signature with 1 named argument, got %+v", scall.Sig)
+			}
+		})
+	}
+}
+
 func TestTranslateSwitch(t *testing.T) {
 	tr := newTestStmtTranslator()
 	stmt := clight.Sswitch{
@@ -446,3 +576,58 @@ func TestTranslateBuiltin(t *testing.T) {
 		t.Errorf("expected 3 args, got %d", len(sbuiltin.Args))
 	}
 }
+
+func TestTranslateVolatileVariables(t *testing.T) {
+	// volatile int g, h; int f() { int h; g = 1; h = g; return h; }
+	volatileInt := ctypes.Qualifiers{{Volatile: true}}
+	g := clight.Evar{Name: "g", Typ: ctypes.Int()}
+	h := clight.Evar{Name: "h", Typ: ctypes.Int()}
+	prog := &clight.Program{
+		Globals: []clight.VarDecl{
+			{Name: "g", Type: ctypes.Int(), Quals: volatileInt},
+			{Name: "h", Type: ctypes.Int(), Quals: volatileInt},
+		},
+		Functions: []clight.Function{{
+			Name:   "f",
+			Return: ctypes.Int(),
+			Locals: []clight.VarDecl{{Name: "h", Type: ctypes.Int()}},
+			Body: clight.Seq(
+				clight.Sassign{LHS: g, RHS: clight.Econst_int{Value: 1, Typ: ctypes.Int()}},
+				clight.Sassign{LHS: h, RHS: g},
+				clight.Sreturn{Value: h},
+			),
+		}},
+	}
+
+	fn := TranslateProgram(prog).Functions[0]
+	want := csharpminor.Seq(
+		csharpminor.Sstore{Chunk: csharpminor.Mint32, Addr: csharpminor.Eaddrof{Name: "g"}, Value: csharpminor.Econst{Const: csharpminor.Ointconst{Value: 1}}, Volatile: true},
+		csharpminor.Sstore{Chunk: csharpminor.Mint32, Addr: csharpminor.Eaddrof{Name: "h"}, Value: csharpminor.Eload{Chunk: csharpminor.Mint32, Addr: csharpminor.Eaddrof{Name: "g"}, Volatile: true}},
+		csharpminor.Sreturn{Value: csharpminor.Evar{Name: "h"}},
+	)
+	if !reflect.DeepEqual(fn.Body, want) {
+		t.Errorf("body = %#v, want %#v", fn.Body, want)
+	}
+}
+
+func TestTranslateConstGlobalsReadOnly(t *testing.T) {
+	// const int k = 5; int g = 6; extern const int e; const char *p; char *const q;
+	constInt := ctypes.Qualifiers{{Const: true}}
+	prog := &clight.Program{
+		Globals: []clight.VarDecl{
+			{Name: "k", Type: ctypes.Int(), Quals: constInt, Init: []byte{5, 0, 0, 0}},
+			{Name: "g", Type: ctypes.Int(), Init: []byte{6, 0, 0, 0}},
+			{Name: "e", Type: ctypes.Int(), Quals: constInt, Extern: true},
+			{Name: "p", Type: ctypes.Pointer(ctypes.Char()), Quals: ctypes.Qualifiers{{}, {Const: true}}},
+			{Name: "q", Type: ctypes.Pointer(ctypes.Char()), Quals: constInt},
+		},
+	}
+
+	// Only the const objects the unit defines are read-only
+	want := map[string]bool{"k": true, "g": false, "e": false, "p": false, "q": true}
+	for _, g := range TranslateProgram(prog).Globals {
+		if g.ReadOnly != want[g.Name] {
+			t.Errorf("%s: ReadOnly = %v, want %v", g.Name, g.ReadOnly, want[g.Name])
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package cshmgen implements the Cshmgen pass: Clight → Csharpminor
+// This file handles struct and union values: copies, argument passing and returns.
+package cshmgen
+
+import (
+	"fmt"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/csharpminor"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+// Csharpminor has no aggregate values, so every struct-typed expression is
+// handled through its address. The calling convention follows AAPCS64 for
+// integer-class aggregates:
+//   - aggregates of up to 16 bytes are passed as one or two 64-bit words
+//     in consecutive integer argument registers;
+//   - larger aggregates are copied by the caller and passed by reference;
+//   - aggregates of up to 16 bytes are returned in X0, or X0/X1 (see
+//     Sreturn.Hi and Scall.ResultHi);
+//   - larger aggregates are returned through a hidden result pointer, which
+//     is the first parameter of a function with Sig.Sret and is passed in X8
+//     rather than an argument register.
+//
+// Homogeneous floating-point aggregates are treated like any other aggregate.
+
+// sretParam is the name of the hidden result pointer parameter.
+const sretParam = "__sret"
+
+// maxRegAggregate is the largest aggregate passed or returned in integer
+// registers.
+const maxRegAggregate = 16
+
+// isAggregate reports whether t is a struct or union type.
+func isAggregate(t ctypes.Type) bool {
+	switch t.(type) {
+	case ctypes.Tstruct, ctypes.Tunion:
+		return true
+	}
+	return false
+}
+
+// aggregateWords returns the number of 64-bit words an aggregate of the
+// given size occupies when passed in registers.
+func aggregateWords(size int64) int {
+	return int((size + 7) / 8)
+}
+
+// returnsViaPointer reports whether a function returning t uses a hidden
+// result pointer.
+func returnsViaPointer(t ctypes.Type) bool {
+	return isAggregate(t) && sizeofType(t) > maxRegAggregate
+}
+
+// offsetAddr returns addr + offset.
+func offsetAddr(addr csharpminor.Expr, offset int64) csharpminor.Expr {
+	if offset == 0 {
+		return addr
+	}
+	return csharpminor.Ebinop{
+		Op:    csharpminor.Oaddl,
+		Left:  addr,
+		Right: csharpminor.Econst{Const: csharpminor.Olongconst{Value: offset}},
+	}
+}
+
+// pieceChunk returns the widest chunk of at most remaining bytes, along
+// with its width. Pieces are unsigned so they can be combined into words.
+func pieceChunk(remaining int64) (csharpminor.Chunk, int64) {
+	switch {
+	case remaining >= 8:
+		return csharpminor.Mint64, 8
+	case remaining >= 4:
+		return csharpminor.Mint32, 4
+	case remaining >= 2:
+		return csharpminor.Mint16unsigned, 2
+	default:
+		return csharpminor.Mint8unsigned, 1
+	}
+}
+
+// copyBytes copies size bytes from src to dst, widest pieces first.
+func copyBytes(dst, src csharpminor.Expr, size int64) csharpminor.Stmt {
+	var stmts []csharpminor.Stmt
+	for off := int64(0); off < size; {
+		chunk, n := pieceChunk(size - off)
+		stmts = append(stmts, csharpminor.Sstore{
+			Chunk: chunk,
+			Addr:  offsetAddr(dst, off),
+			Value: csharpminor.Eload{Chunk: chunk, Addr: offsetAddr(src, off)},
+		})
+		off += n
+	}
+	return csharpminor.Seq(stmts...)
+}
+
+// loadWord reads size (at most 8) bytes at addr as a 64-bit word, without
+// reading past the end of the object.
+func loadWord(addr csharpminor.Expr, size int64) csharpminor.Expr {
+	var word csharpminor.Expr
+	for off := int64(0); off < size; {
+		chunk, n := pieceChunk(size - off)
+		var piece csharpminor.Expr = csharpminor.Eload{Chunk: chunk, Addr: offsetAddr(addr, off)}
+		if n < 8 {
+			piece = csharpminor.Eunop{Op: csharpminor.Olongofintu, Arg: piece}
+		}
+		if off > 0 {
+			piece = csharpminor.Ebinop{
+				Op:    csharpminor.Oshll,
+				Left:  piece,
+				Right: csharpminor.Econst{Const: csharpminor.Ointconst{Value: int32(8 * off)}},
+			}
+		}
+		if word == nil {
+			word = piece
+		} else {
+			word = csharpminor.Ebinop{Op: csharpminor.Oorl, Left: word, Right: piece}
+		}
+		off += n
+	}
+	if word == nil {
+		return csharpminor.Econst{Const: csharpminor.Olongconst{Value: 0}}
+	}
+	return word
+}
+
+// storeWord writes the low size (at most 8) bytes of a 64-bit word to addr.
+func storeWord(addr, word csharpminor.Expr, size int64) csharpminor.Stmt {
+	var stmts []csharpminor.Stmt
+	for off := int64(0); off < size; {
+		chunk, n := pieceChunk(size - off)
+		piece := word
+		if off > 0 {
+			piece = csharpminor.Ebinop{
+				Op:    csharpminor.Oshrlu,
+				Left:  piece,
+				Right: csharpminor.Econst{Const: csharpminor.Ointconst{Value: int32(8 * off)}},
+			}
+		}
+		if n < 8 {
+			piece = csharpminor.Eunop{Op: csharpminor.Ointoflong, Arg: piece}
+		}
+		stmts = append(stmts, csharpminor.Sstore{Chunk: chunk, Addr: offsetAddr(addr, off), Value: piece})
+		off += n
+	}
+	return csharpminor.Seq(stmts...)
+}
+
+// wordSize returns the number of bytes of an aggregate held in word i.
+func wordSize(size int64, i int) int64 {
+	if rest := size - int64(i)*8; rest < 8 {
+		return rest
+	}
+	return 8
+}
+
+// resolveType fills in struct fields from the translator's definitions.
+func (t *StmtTranslator) resolveType(typ ctypes.Type) ctypes.Type {
+	return resolveStructType(typ, t.structDefs)
+}
+
+// newAggregateLocal adds a stack local large enough to hold typ.
+func (t *StmtTranslator) newAggregateLocal(typ ctypes.Type) string {
+	name := fmt.Sprintf("__struct%d", len(t.extraLocals))
+	t.extraLocals = append(t.extraLocals, csharpminor.VarDecl{Name: name, Size: sizeofType(typ), Signed: true})
+	return name
+}
+
+// tempLocal returns the stack local backing an aggregate-typed temporary.
+func (t *StmtTranslator) tempLocal(id int, typ ctypes.Type) string {
+	if name, ok := t.aggregateTemps[id]; ok {
+		return name
+	}
+	name := t.newAggregateLocal(typ)
+	t.aggregateTemps[id] = name
+	return name
+}
+
+// aggregateAddr returns the address of an aggregate-valued expression.
+func (t *StmtTranslator) aggregateAddr(e clight.Expr) (csharpminor.Expr, bool) {
+	switch expr := e.(type) {
+	case clight.Etempvar:
+		return csharpminor.Eaddrof{Name: t.tempLocal(expr.ID, t.resolveType(expr.Typ))}, true
+	case clight.Evar, clight.Ederef, clight.Efield:
+		return t.exprTr.translateLvalueAddr(expr), true
+	case clight.Ecast:
+		return t.aggregateAddr(expr.Arg)
+	}
+	return nil, false
+}
+
+// translateAggregateCopy copies the aggregate value of rhs to dst.
+func (t *StmtTranslator) translateAggregateCopy(dst csharpminor.Expr, rhs clight.Expr) (csharpminor.Stmt, bool) {
+	src, ok := t.aggregateAddr(rhs)
+	if !ok {
+		return nil, false
+	}
+	return copyBytes(dst, src, sizeofType(t.resolveType(rhs.ExprType()))), true
+}
+
+// translateAggregateArg returns the arguments that pass the aggregate arg:
+// its words for small aggregates, otherwise the address of a copy made by
+// the statements in pre.
+func (t *StmtTranslator) translateAggregateArg(arg clight.Expr) (pre []csharpminor.Stmt, args []csharpminor.Expr, ok bool) {
+	addr, ok := t.aggregateAddr(arg)
+	if !ok {
+		return nil, nil, false
+	}
+	typ := t.resolveType(arg.ExprType())
+	size := sizeofType(typ)
+	if size > maxRegAggregate {
+		copyName := t.newAggregateLocal(typ)
+		copyAddr := csharpminor.Eaddrof{Name: copyName}
+		return []csharpminor.Stmt{copyBytes(copyAddr, addr, size)}, []csharpminor.Expr{copyAddr}, true
+	}
+	for i := 0; i < aggregateWords(size); i++ {
+		args = append(args, loadWord(offsetAddr(addr, int64(i)*8), wordSize(size, i)))
+	}
+	return nil, args, true
+}
+
+// aggregateParam describes how an aggregate parameter arrives: the names of
+// the incoming Csharpminor parameters, their types, and the entry code that
+// rebuilds the aggregate in a local of the original name.
+func aggregateParam(name string, typ ctypes.Type) ([]string, []ctypes.Type, csharpminor.Stmt) {
+	size := sizeofType(typ)
+	local := csharpminor.Eaddrof{Name: name}
+	if size > maxRegAggregate {
+		ref := name + "$ref"
+		return []string{ref}, []ctypes.Type{ctypes.Pointer(typ)},
+			copyBytes(local, csharpminor.Evar{Name: ref}, size)
+	}
+	var names []string
+	var types []ctypes.Type
+	var stmts []csharpminor.Stmt
+	for i := 0; i < aggregateWords(size); i++ {
+		word := fmt.Sprintf("%s$%d", name, i)
+		names = append(names, word)
+		types = append(types, ctypes.Long())
+		stmts = append(stmts, storeWord(offsetAddr(local, int64(i)*8), csharpminor.Evar{Name: word}, wordSize(size, i)))
+	}
+	return names, types, csharpminor.Seq(stmts...)
+}
@@ -0,0 +1,347 @@
+package cshmgen
+
+import (
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/csharpminor"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+// structOfInts returns struct name { int f0; int f1; ... } with n fields.
+func structOfInts(name string, n int) ctypes.Tstruct {
+	s := ctypes.Tstruct{Name: name}
+	for i := 0; i < n; i++ {
+		s.Fields = append(s.Fields, ctypes.Field{Name: string(rune('a' + i)), Type: ctypes.Int()})
+	}
+	return s
+}
+
+// flattenSeq lists the statements of a sequence in order.
+func flattenSeq(s csharpminor.Stmt) []csharpminor.Stmt {
+	if seq, ok := s.(csharpminor.Sseq); ok {
+		return append(flattenSeq(seq.First), flattenSeq(seq.Second)...)
+	}
+	return []csharpminor.Stmt{s}
+}
+
+func TestCopyBytesPieces(t *testing.T) {
+	dst := csharpminor.Eaddrof{Name: "d"}
+	src := csharpminor.Eaddrof{Name: "s"}
+	stmts := flattenSeq(copyBytes(dst, src, 15))
+
+	want := []csharpminor.Chunk{csharpminor.Mint64, csharpminor.Mint32, csharpminor.Mint16unsigned, csharpminor.Mint8unsigned}
+	if len(stmts) != len(want) {
+		t.Fatalf("expected %d stores, got %d", len(want), len(stmts))
+	}
+	for i, s := range stmts {
+		store, ok := s.(csharpminor.Sstore)
+		if !ok {
+			t.Fatalf("stmt %d: expected Sstore, got %T", i, s)
+		}
+		if store.Chunk != want[i] {
+			t.Errorf("stmt %d: expected chunk %v, got %v", i, want[i], store.Chunk)
+		}
+	}
+}
+
+func TestLoadWordPartial(t *testing.T) {
+	// A 6-byte tail is read as int32 | (uint16 << 32) so the load does
+	// not run past the object.
+	word := loadWord(csharpminor.Eaddrof{Name: "s"}, 6)
+
+	or, ok := word.(csharpminor.Ebinop)
+	if !ok || or.Op != csharpminor.Oorl {
+		t.Fatalf("expected Oorl of two pieces, got %#v", word)
+	}
+	low, ok := or.Left.(csharpminor.Eunop)
+	if !ok || low.Arg.(csharpminor.Eload).Chunk != csharpminor.Mint32 {
+		t.Errorf("expected zero-extended int32 low piece, got %#v", or.Left)
+	}
+	high, ok := or.Right.(csharpminor.Ebinop)
+	if !ok || high.Op != csharpminor.Oshll {
+		t.Fatalf("expected shifted high piece, got %#v", or.Right)
+	}
+	if c := high.Right.(csharpminor.Econst).Const.(csharpminor.Ointconst); c.Value != 32 {
+		t.Errorf("expected shift by 32, got %d", c.Value)
+	}
+}
+
+func TestTranslateFunction_AggregateParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		typ        ctypes.Tstruct
+		wantParams []string
+	}{
+		{"8 bytes in one word", structOfInts("P", 2), []string{"p$0"}},
+		{"12 bytes in two words", structOfInts("T", 3), []string{"p$0", "p$1"}},
+		{"24 bytes by reference", structOfInts("B", 6), []string{"p$ref"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := clight.Function{
+				Name:   "f",
+				Return: ctypes.Int(),
+				Params: []clight.VarDecl{{Name: "p", Type: tt.typ}},
+				Body: clight.Sreturn{Value: clight.Efield{
+					Arg:       clight.Evar{Name: "p", Typ: tt.typ},
+					FieldName: "a",
+					Typ:       ctypes.Int(),
+				}},
+			}
+			result := translateFunctionWithStructs(&fn, NewExprTranslator(nil), nil)
+
+			if len(result.Params) != len(tt.wantParams) {
+				t.Fatalf("expected params %v, got %v", tt.wantParams, result.Params)
+			}
+			for i, name := range tt.wantParams {
+				if result.Params[i] != name {
+					t.Errorf("param %d: expected %s, got %s", i, name, result.Params[i])
+				}
+			}
+			if len(result.Sig.Args) != len(tt.wantParams) {
+				t.Errorf("expected %d signature args, got %d", len(tt.wantParams), len(result.Sig.Args))
+			}
+			// The aggregate is rebuilt in a local named after the parameter
+			found := false
+			for _, l := range result.Locals {
+				if l.Name == "p" && l.Size == sizeofType(tt.typ) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected local p of size %d, got %+v", sizeofType(tt.typ), result.Locals)
+			}
+			first, ok := flattenSeq(result.Body)[0].(csharpminor.Sstore)
+			if !ok {
+				t.Fatalf("expected entry store into p, got %T", flattenSeq(result.Body)[0])
+			}
+			if addr, ok := first.Addr.(csharpminor.Eaddrof); !ok || addr.Name != "p" {
+				t.Errorf("expected entry store to &p, got %#v", first.Addr)
+			}
+		})
+	}
+}
+
+func TestTranslateFunction_SmallAggregateReturn(t *testing.T) {
+	point := structOfInts("P", 2)
+	fn := clight.Function{
+		Name:   "mk",
+		Return: point,
+		Locals: []clight.VarDecl{{Name: "p", Type: point}},
+		Body:   clight.Sreturn{Value: clight.Evar{Name: "p", Typ: point}},
+	}
+	result := translateFunctionWithStructs(&fn, NewExprTranslator(nil), nil)
+
+	if len(result.Params) != 0 {
+		t.Errorf("expected no hidden parameter, got %v", result.Params)
+	}
+	ret, ok := result.Body.(csharpminor.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", result.Body)
+	}
+	load, ok := ret.Value.(csharpminor.Eload)
+	if !ok || load.Chunk != csharpminor.Mint64 {
+		t.Fatalf("expected the struct returned as one int64 word, got %#v", ret.Value)
+	}
+	if addr, ok := load.Addr.(csharpminor.Eaddrof); !ok || addr.Name != "p" {
+		t.Errorf("expected load from &p, got %#v", load.Addr)
+	}
+}
+
+func TestTranslateFunction_TwoWordAggregateReturn(t *testing.T) {
+	triple := structOfInts("T", 3)
+	fn := clight.Function{
+		Name:   "mk",
+		Return: triple,
+		Locals: []clight.VarDecl{{Name: "t", Type: triple}},
+		Body:   clight.Sreturn{Value: clight.Evar{Name: "t", Typ: triple}},
+	}
+	result := translateFunctionWithStructs(&fn, NewExprTranslator(nil), nil)
+
+	if len(result.Params) != 0 || result.Sig.Sret {
+		t.Errorf("expected no hidden parameter, got %v", result.Params)
+	}
+	ret, ok := result.Body.(csharpminor.Sreturn)
+	if !ok {
+		t.Fatalf("expected Sreturn, got %T", result.Body)
+	}
+	// Bytes 0-7 come back in X0 and bytes 8-11 in X1
+	if load, ok := ret.Value.(csharpminor.Eload); !ok || load.Chunk != csharpminor.Mint64 {
+		t.Errorf("expected the first word as an int64 load, got %#v", ret.Value)
+	}
+	hi, ok := ret.Hi.(csharpminor.Eunop)
+	if !ok {
+		t.Fatalf("expected the second word widened from a 4-byte load, got %#v", ret.Hi)
+	}
+	if load, ok := hi.Arg.(csharpminor.Eload); !ok || load.Chunk != csharpminor.Mint32 {
+		t.Errorf("expected a 4-byte load for the second word, got %#v", hi.Arg)
+	}
+}
+
+func TestTranslateFunction_LargeAggregateReturn(t *testing.T) {
+	big := structOfInts("B", 6)
+	fn := clight.Function{
+		Name:   "mk",
+		Return: big,
+		Params: []clight.VarDecl{{Name: "x", Type: ctypes.Int()}},
+		Locals: []clight.VarDecl{{Name: "b", Type: big}},
+		Body:   clight.Sreturn{Value: clight.Evar{Name: "b", Typ: big}},
+	}
+	result := translateFunctionWithStructs(&fn, NewExprTranslator(nil), nil)
+
+	if len(result.Params) != 2 || result.Params[0] != sretParam || result.Params[1] != "x" {
+		t.Fatalf("expected params [%s x], got %v", sretParam, result.Params)
+	}
+	if _, ok := result.Sig.Return.(ctypes.Tvoid); !ok {
+		t.Errorf("expected void signature return, got %v", result.Sig.Return)
+	}
+	if !result.Sig.Sret {
+		t.Errorf("expected the signature to mark the result pointer")
+	}
+	stmts := flattenSeq(result.Body)
+	// Three int64 copies into *__sret, then a bare return
+	if len(stmts) != 4 {
+		t.Fatalf("expected 4 statements, got %d", len(stmts))
+	}
+	store, ok := stmts[0].(csharpminor.Sstore)
+	if !ok {
+		t.Fatalf("expected Sstore, got %T", stmts[0])
+	}
+	if v, ok := store.Addr.(csharpminor.Evar); !ok || v.Name != sretParam {
+		t.Errorf("expected store through %s, got %#v", sretParam, store.Addr)
+	}
+	if ret, ok := stmts[3].(csharpminor.Sreturn); !ok || ret.Value != nil {
+		t.Errorf("expected bare return, got %#v", stmts[3])
+	}
+}
+
+func TestTranslateCall_AggregateResultAndArg(t *testing.T) {
+	point := structOfInts("P", 2)
+	mk := clight.Evar{Name: "mk", Typ: ctypes.Tfunction{Return: point}}
+	sum := clight.Evar{Name: "sum", Typ: ctypes.Tfunction{Params: []ctypes.Type{point}, Return: ctypes.Int()}}
+	res := 1
+	out := 2
+
+	tr := newTestStmtTranslator()
+	// $1 = mk(); $2 = sum($1);
+	seq := flattenSeq(tr.TranslateStmt(clight.Ssequence{
+		First:  clight.Scall{Result: &res, Func: mk},
+		Second: clight.Scall{Result: &out, Func: sum, Args: []clight.Expr{clight.Etempvar{ID: res, Typ: point}}},
+	}))
+
+	if len(seq) != 3 {
+		t.Fatalf("expected call, spill and call, got %d statements", len(seq))
+	}
+	// The returned word is spilled to the temp's backing local
+	spill, ok := seq[1].(csharpminor.Sstore)
+	if !ok || spill.Chunk != csharpminor.Mint64 {
+		t.Fatalf("expected int64 spill of the result word, got %#v", seq[1])
+	}
+	backing := spill.Addr.(csharpminor.Eaddrof).Name
+	if len(tr.extraLocals) != 1 || tr.extraLocals[0].Name != backing || tr.extraLocals[0].Size != 8 {
+		t.Errorf("expected one 8-byte backing local, got %+v", tr.extraLocals)
+	}
+	// ...and passed on as a single word read from it
+	call, ok := seq[2].(csharpminor.Scall)
+	if !ok {
+		t.Fatalf("expected Scall, got %T", seq[2])
+	}
+	if len(call.Args) != 1 {
+		t.Fatalf("expected 1 word argument, got %d", len(call.Args))
+	}
+	load, ok := call.Args[0].(csharpminor.Eload)
+	if !ok || load.Chunk != csharpminor.Mint64 {
+		t.Fatalf("expected int64 load argument, got %#v", call.Args[0])
+	}
+	if addr, ok := load.Addr.(csharpminor.Eaddrof); !ok || addr.Name != backing {
+		t.Errorf("expected argument loaded from %s, got %#v", backing, load.Addr)
+	}
+}
+
+func TestTranslateCall_LargeAggregateResult(t *testing.T) {
+	big := structOfInts("B", 6)
+	mk := clight.Evar{Name: "mk", Typ: ctypes.Tfunction{Params: []ctypes.Type{ctypes.Int()}, Return: big}}
+	res := 1
+
+	tr := newTestStmtTranslator()
+	result := tr.TranslateStmt(clight.Scall{
+		Result: &res,
+		Func:   mk,
+		Args:   []clight.Expr{clight.Econst_int{Value: 7, Typ: ctypes.Int()}},
+	})
+
+	call, ok := result.(csharpminor.Scall)
+	if !ok {
+		t.Fatalf("expected Scall, got %T", result)
+	}
+	if call.Result != nil {
+		t.Errorf("expected no register result for a large aggregate")
+	}
+	if len(call.Args) != 2 {
+		t.Fatalf("expected result pointer plus 1 argument, got %d", len(call.Args))
+	}
+	addr, ok := call.Args[0].(csharpminor.Eaddrof)
+	if !ok || addr.Name != tr.aggregateTemps[res] {
+		t.Errorf("expected result pointer to the temp's backing local, got %#v", call.Args[0])
+	}
+	if call.Sig == nil || !call.Sig.Sret {
+		t.Errorf("expected a signature marking the result pointer, got %+v", call.Sig)
+	}
+}
+
+func TestTranslateCall_TwoWordAggregateResult(t *testing.T) {
+	triple := structOfInts("T", 3)
+	mk := clight.Evar{Name: "mk", Typ: ctypes.Tfunction{Return: triple}}
+	res := 1
+
+	tr := newTestStmtTranslator()
+	seq := flattenSeq(tr.TranslateStmt(clight.Scall{Result: &res, Func: mk}))
+
+	if len(seq) != 3 {
+		t.Fatalf("expected call and two spills, got %d statements", len(seq))
+	}
+	call, ok := seq[0].(csharpminor.Scall)
+	if !ok {
+		t.Fatalf("expected Scall, got %T", seq[0])
+	}
+	if call.Result == nil || *call.Result != res || call.ResultHi == nil {
+		t.Fatalf("expected results in $%d and a second word temp, got %+v", res, call)
+	}
+	if call.Sig != nil {
+		t.Errorf("expected no result pointer, got %+v", call.Sig)
+	}
+	if typ := tr.extraTemps[*call.ResultHi]; typ == nil {
+		t.Errorf("expected the second word temp to be declared")
+	}
+	// X1 holds bytes 8-11 of the struct
+	hi, ok := seq[2].(csharpminor.Sstore)
+	if !ok || hi.Chunk != csharpminor.Mint32 {
+		t.Fatalf("expected int32 spill of the second word, got %#v", seq[2])
+	}
+	if off, ok := hi.Addr.(csharpminor.Ebinop); !ok || off.Right != (csharpminor.Econst{Const: csharpminor.Olongconst{Value: 8}}) {
+		t.Errorf("expected the second word stored at offset 8, got %#v", hi.Addr)
+	}
+}
+
+func TestTranslateAssign_AggregateCopy(t *testing.T) {
+	tr := newTestStmtTranslator()
+	triple := structOfInts("T", 3)
+	// a = b for a 12-byte struct
+	result := tr.TranslateStmt(clight.Sassign{
+		LHS: clight.Evar{Name: "a", Typ: triple},
+		RHS: clight.Evar{Name: "b", Typ: triple},
+	})
+
+	stmts := flattenSeq(result)
+	if len(stmts) != 2 {
+		t.Fatalf("expected int64 and int32 copies, got %d statements", len(stmts))
+	}
+	if s := stmts[0].(csharpminor.Sstore); s.Chunk != csharpminor.Mint64 {
+		t.Errorf("expected first piece Mint64, got %v", s.Chunk)
+	}
+	if s := stmts[1].(csharpminor.Sstore); s.Chunk != csharpminor.Mint32 {
+		t.Errorf("expected second piece Mint32, got %v", s.Chunk)
+	}
+}
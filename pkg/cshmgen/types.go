@@ -0,0 +1,64 @@
+// Package cshmgen implements the Cshmgen pass: Clight → Csharpminor
+// This file dumps the resolved types of a program for --dtypes.
+package cshmgen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+// PrintTypes writes the type table of a Clight program: the layout of each
+// struct and union, then each global and, per function, each parameter,
+// local and temporary with its resolved type. Sizes, alignments and field
+// offsets are the ones this pass uses for loads, stores and sizeof, so a
+// wrong width in the generated code can be traced to the type it came from.
+func PrintTypes(w io.Writer, prog *clight.Program) {
+	structDefs := make(map[string]ctypes.Tstruct)
+	for _, s := range prog.Structs {
+		structDefs[s.Name] = s
+	}
+	entry := func(kind, name string, typ ctypes.Type) {
+		typ = resolveStructType(typ, structDefs)
+		fmt.Fprintf(w, "  %s %s: %s, size %d, align %d\n", kind, name, typ, sizeofType(typ), alignofType(typ))
+	}
+
+	for _, s := range prog.Structs {
+		fmt.Fprintf(w, "%s: size %d, align %d\n", s, sizeofStruct(s), alignofStruct(s))
+		for _, f := range s.Fields {
+			fmt.Fprintf(w, "  %s: %s, offset %d\n", f.Name, f.Type, fieldOffset(s, f.Name))
+		}
+		fmt.Fprintln(w)
+	}
+	for _, u := range prog.Unions {
+		fmt.Fprintf(w, "%s: size %d, align %d\n", u, sizeofUnion(u), alignofUnion(u))
+		for _, f := range u.Fields {
+			fmt.Fprintf(w, "  %s: %s, offset 0\n", f.Name, f.Type)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(prog.Globals) > 0 {
+		fmt.Fprintln(w, "globals:")
+		for _, g := range prog.Globals {
+			entry("var", g.Name, g.Type)
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, fn := range prog.Functions {
+		fmt.Fprintf(w, "%s: returns %s\n", fn.Name, fn.Return)
+		for _, p := range fn.Params {
+			entry("param", p.Name, p.Type)
+		}
+		for _, l := range fn.Locals {
+			entry("local", l.Name, l.Type)
+		}
+		for i, typ := range fn.Temps {
+			entry("temp", fmt.Sprintf("$%d", i+1), typ)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,47 @@
+package cshmgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+)
+
+func TestPrintTypes(t *testing.T) {
+	pair := ctypes.Tstruct{Name: "pair", Fields: []ctypes.Field{
+		{Name: "c", Type: ctypes.SChar()},
+		{Name: "d", Type: ctypes.Double()},
+	}}
+	prog := &clight.Program{
+		Structs: []ctypes.Tstruct{pair},
+		Globals: []clight.VarDecl{{Name: "g", Type: ctypes.Double()}},
+		Functions: []clight.Function{{
+			Name:   "f",
+			Return: ctypes.Int(),
+			Params: []clight.VarDecl{{Name: "x", Type: ctypes.Double()}},
+			// A local of a struct type known by name only, as clightgen leaves it
+			Locals: []clight.VarDecl{{Name: "q", Type: ctypes.Tstruct{Name: "pair"}}},
+			Temps:  []ctypes.Type{ctypes.Short()},
+		}},
+	}
+
+	var b strings.Builder
+	PrintTypes(&b, prog)
+	want := `struct pair: size 16, align 8
+  c: signed char, offset 0
+  d: double, offset 8
+
+globals:
+  var g: double, size 8, align 8
+
+f: returns int
+  param x: double, size 8, align 8
+  local q: struct pair, size 16, align 8
+  temp $1: short, size 2, align 2
+
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -60,8 +60,9 @@ type Tvoid struct{}
 
 // Tint represents integer types (char, short, int, _Bool)
 type Tint struct {
-	Size IntSize
-	Sign Signedness
+	Size  IntSize
+	Sign  Signedness
+	Plain bool // plain char, a type of its own with the sign of signed or unsigned char
 }
 
 // Tlong represents the long type (64-bit)
@@ -96,18 +97,24 @@ type Tfunction struct {
 type Tstruct struct {
 	Name   string
 	Fields []Field
+	Packed bool  // fields are laid out without padding
+	Align  int64 // alignment requested by the definition; 0 for the natural one
 }
 
 // Tunion represents union types
 type Tunion struct {
 	Name   string
 	Fields []Field
+	Packed bool  // fields are byte-aligned
+	Align  int64 // alignment requested by the definition; 0 for the natural one
 }
 
 // Field represents a struct or union field
 type Field struct {
-	Name string
-	Type Type
+	Name      string
+	Type      Type
+	Anonymous bool  // an anonymous struct or union member, whose members are looked up through it
+	Align     int64 // alignment requested by the field's aligned attribute; 0 for the natural one
 }
 
 // Marker methods for Type interface
@@ -131,7 +138,13 @@ func (t Tint) String() string {
 	}
 	switch t.Size {
 	case I8:
-		return sign + "char"
+		if t.Plain {
+			return "char"
+		}
+		if t.Sign == Signed {
+			return "signed char"
+		}
+		return "unsigned char"
 	case I16:
 		return sign + "short"
 	case I32:
@@ -203,8 +216,20 @@ func UInt() Type {
 	return Tint{Size: I32, Sign: Unsigned}
 }
 
-// Char returns a signed char type
+// Char returns the plain char type of the AAPCS64 default (ARM64 Linux),
+// which is unsigned
 func Char() Type {
+	return PlainChar(Unsigned)
+}
+
+// PlainChar returns the plain char type of the given signedness, which C
+// leaves implementation-defined
+func PlainChar(sign Signedness) Type {
+	return Tint{Size: I8, Sign: sign, Plain: true}
+}
+
+// SChar returns a signed char type
+func SChar() Type {
 	return Tint{Size: I8, Sign: Signed}
 }
 
@@ -218,11 +243,26 @@ func Short() Type {
 	return Tint{Size: I16, Sign: Signed}
 }
 
+// UShort returns an unsigned short type
+func UShort() Type {
+	return Tint{Size: I16, Sign: Unsigned}
+}
+
 // Long returns a signed long type
 func Long() Type {
 	return Tlong{Sign: Signed}
 }
 
+// ULong returns an unsigned long type
+func ULong() Type {
+	return Tlong{Sign: Unsigned}
+}
+
+// SizeT returns size_t, the type of sizeof, which is unsigned long on ARM64
+func SizeT() Type {
+	return ULong()
+}
+
 // Float returns a float (32-bit) type
 func Float() Type {
 	return Tfloat{Size: F32}
@@ -248,6 +288,20 @@ func Array(elem Type, size int64) Type {
 	return Tarray{Elem: elem, Size: size}
 }
 
+// VaList returns the AAPCS64 va_list type. __stack points at the next
+// argument passed on the stack; __gr_top and __vr_top point just past the
+// general and FP/SIMD register save areas, and the negative offsets
+// __gr_offs and __vr_offs locate the next saved register below them.
+func VaList() Type {
+	return Tstruct{Name: "__va_list", Fields: []Field{
+		{Name: "__stack", Type: Pointer(Char())},
+		{Name: "__gr_top", Type: Pointer(Char())},
+		{Name: "__vr_top", Type: Pointer(Char())},
+		{Name: "__gr_offs", Type: Int()},
+		{Name: "__vr_offs", Type: Int()},
+	}}
+}
+
 // Equal checks if two types are equal
 func Equal(a, b Type) bool {
 	if a == nil || b == nil {
@@ -295,3 +349,83 @@ func Equal(a, b Type) bool {
 	}
 	return false
 }
+
+// Compatible checks if a value of type b can stand for one of type a
+// without a conversion warning: arrays and functions decay to pointers,
+// void * is compatible with any object pointer, and an array of unknown
+// size is compatible with one of any size. Qualifiers are tracked apart
+// from types (see Qualifiers), so const int * and int * are compatible.
+func Compatible(a, b Type) bool {
+	a, b = decay(a), decay(b)
+	pa, aok := a.(Tpointer)
+	pb, bok := b.(Tpointer)
+	if aok && bok {
+		if _, ok := pa.Elem.(Tvoid); ok {
+			_, fn := pb.Elem.(Tfunction)
+			return !fn
+		}
+		if _, ok := pb.Elem.(Tvoid); ok {
+			_, fn := pa.Elem.(Tfunction)
+			return !fn
+		}
+	}
+	return compatibleType(a, b)
+}
+
+// decay converts an array to a pointer to its first element and a
+// function to a pointer to it, as in a value context
+func decay(t Type) Type {
+	switch t := t.(type) {
+	case Tarray:
+		return Pointer(t.Elem)
+	case Tfunction:
+		return Pointer(t)
+	}
+	return t
+}
+
+// compatibleType checks if two types are compatible in the sense of C11
+// 6.2.7, ignoring qualifiers
+func compatibleType(a, b Type) bool {
+	switch ta := a.(type) {
+	case Tpointer:
+		tb, ok := b.(Tpointer)
+		return ok && compatibleType(ta.Elem, tb.Elem)
+	case Tarray:
+		tb, ok := b.(Tarray)
+		return ok && (ta.Size < 0 || tb.Size < 0 || ta.Size == tb.Size) && compatibleType(ta.Elem, tb.Elem)
+	case Tfunction:
+		tb, ok := b.(Tfunction)
+		if !ok || ta.VarArg != tb.VarArg || len(ta.Params) != len(tb.Params) || !compatibleType(ta.Return, tb.Return) {
+			return false
+		}
+		for i, p := range ta.Params {
+			if !compatibleType(p, tb.Params[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return Equal(a, b)
+}
+
+// Attr holds the type qualifiers of one level of a declared type.
+type Attr struct {
+	Const    bool
+	Volatile bool
+	Restrict bool
+}
+
+// Qualifiers records the qualifiers of a declared object level by level.
+// Qualifiers[0] applies to the object itself and Qualifiers[i] to what it
+// reaches through i dereferences: `char *const p` is const at level 0,
+// `const char *p` at level 1. Missing levels are unqualified.
+type Qualifiers []Attr
+
+// At returns the qualifiers of the given level.
+func (q Qualifiers) At(level int) Attr {
+	if level < len(q) {
+		return q[level]
+	}
+	return Attr{}
+}
@@ -12,6 +12,7 @@ func TestTypeConstructors(t *testing.T) {
 		{"int", Int(), "int"},
 		{"unsigned int", UInt(), "unsigned int"},
 		{"char", Char(), "char"},
+		{"signed char", SChar(), "signed char"},
 		{"unsigned char", UChar(), "unsigned char"},
 		{"short", Short(), "short"},
 		{"long", Long(), "long"},
@@ -31,6 +32,25 @@ func TestTypeConstructors(t *testing.T) {
 	}
 }
 
+func TestPlainCharSign(t *testing.T) {
+	if got := Char().(Tint).Sign; got != Unsigned {
+		t.Errorf("default plain char sign = %v, want unsigned", got)
+	}
+	if got := SChar().(Tint).Sign; got != Signed {
+		t.Errorf("signed char sign = %v, want signed", got)
+	}
+	if got := UChar().(Tint).Sign; got != Unsigned {
+		t.Errorf("unsigned char sign = %v, want unsigned", got)
+	}
+
+	if !Equal(PlainChar(Signed), SChar()) {
+		t.Errorf("signed plain char should match signed char")
+	}
+	if Equal(PlainChar(Signed), UChar()) {
+		t.Errorf("signed plain char should differ from unsigned char")
+	}
+}
+
 func TestTypeEquality(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -48,6 +68,11 @@ func TestTypeEquality(t *testing.T) {
 		{"array[10] of int != array[20] of int", Array(Int(), 10), Array(Int(), 20), false},
 		{"struct A == struct A", Tstruct{Name: "A"}, Tstruct{Name: "A"}, true},
 		{"struct A != struct B", Tstruct{Name: "A"}, Tstruct{Name: "B"}, false},
+		{"struct A with fields == struct A", Tstruct{Name: "A", Fields: []Field{{Name: "x", Type: Int()}}}, Tstruct{Name: "A"}, true},
+		{"union A != struct A", Tunion{Name: "A"}, Tstruct{Name: "A"}, false},
+		{"int ** == int **", Pointer(Pointer(Int())), Pointer(Pointer(Int())), true},
+		{"int ** != int *", Pointer(Pointer(Int())), Pointer(Int()), false},
+		{"array[10] of int != pointer to int", Array(Int(), 10), Pointer(Int()), false},
 		{"nil == nil", nil, nil, true},
 		{"nil != int", nil, Int(), false},
 	}
@@ -78,6 +103,41 @@ func TestFunctionTypeEquality(t *testing.T) {
 	}
 }
 
+func TestTypeCompatibility(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       Type
+		compatible bool
+	}{
+		{"int and int", Int(), Int(), true},
+		{"int and long", Int(), Long(), false},
+		{"pointer and array of its element", Pointer(Int()), Array(Int(), 4), true},
+		{"pointer and array of another element", Pointer(Int()), Array(Char(), 4), false},
+		{"array of unknown size and sized array", Array(Int(), -1), Array(Int(), 3), true},
+		{"pointers to arrays of different sizes", Pointer(Array(Int(), 2)), Pointer(Array(Int(), 3)), false},
+		{"pointer to pointer and pointer to array", Pointer(Pointer(Int())), Pointer(Array(Int(), 3)), false},
+		{"qualified and unqualified pointee", Pointer(Char()), Pointer(Char()), true},
+		{"void pointer and object pointer", Pointer(Void()), Pointer(Tstruct{Name: "S"}), true},
+		{"object pointer and void pointer", Pointer(Long()), Pointer(Void()), true},
+		{"void pointer and function pointer", Pointer(Void()), Pointer(Tfunction{Return: Int()}), false},
+		{"int * and int **", Pointer(Int()), Pointer(Pointer(Int())), false},
+		{"function and function pointer", Tfunction{Params: []Type{Int()}, Return: Int()}, Pointer(Tfunction{Params: []Type{Int()}, Return: Int()}), true},
+		{"structs by name", Tstruct{Name: "A"}, Tstruct{Name: "A"}, true},
+		{"different structs", Tstruct{Name: "A"}, Tstruct{Name: "B"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compatible(tt.a, tt.b); got != tt.compatible {
+				t.Errorf("Compatible(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.compatible)
+			}
+			if got := Compatible(tt.b, tt.a); got != tt.compatible {
+				t.Errorf("Compatible(%v, %v) = %v, want %v", tt.b, tt.a, got, tt.compatible)
+			}
+		})
+	}
+}
+
 func TestSignednessString(t *testing.T) {
 	if Signed.String() != "signed" {
 		t.Errorf("Signed.String() = %q, want %q", Signed.String(), "signed")
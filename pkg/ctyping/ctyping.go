@@ -0,0 +1,472 @@
+// Package ctyping type-checks Clight programs between clightgen and
+// cshmgen. It verifies the operand types of each operator, makes the
+// implicit conversions of assignments, returns and calls explicit as
+// Ecast nodes, and reports type errors.
+// This mirrors CompCert's Ctyping.v.
+package ctyping
+
+import (
+	"fmt"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+)
+
+// checker holds the state of the check of one function.
+type checker struct {
+	diags *diag.Emitter
+	fn    *clight.Function
+	vars  map[string]ctypes.Type // variables in scope, locals shadowing globals
+	pos   diag.Pos               // position of the statement being checked
+}
+
+// Check type-checks every function of prog, rewriting its body in place
+// with the implicit conversions made explicit. Errors and warnings are
+// reported to diags.
+func Check(prog *clight.Program, diags *diag.Emitter) {
+	globals := make(map[string]ctypes.Type)
+	for _, g := range prog.Globals {
+		globals[g.Name] = g.Type
+	}
+	for i := range prog.Functions {
+		fn := &prog.Functions[i]
+		globals[fn.Name] = functionType(fn)
+	}
+
+	for i := range prog.Functions {
+		fn := &prog.Functions[i]
+		c := &checker{diags: diags, fn: fn, vars: make(map[string]ctypes.Type)}
+		for name, typ := range globals {
+			c.vars[name] = typ
+		}
+		for _, p := range fn.Params {
+			c.vars[p.Name] = p.Type
+		}
+		for _, l := range fn.Locals {
+			c.vars[l.Name] = l.Type
+		}
+		c.labels(fn.Body)
+		c.jumps(fn.Body)
+		fn.Body = c.stmt(fn.Body)
+	}
+}
+
+// errorf reports an error at the statement being checked. The message
+// names the function, as the position is missing for the statements the
+// compiler made up.
+func (c *checker) errorf(code, format string, args ...any) {
+	c.diags.Errorf(c.pos, code, "in function '%s': %s", c.fn.Name, fmt.Sprintf(format, args...))
+}
+
+func (c *checker) warnf(code, format string, args ...any) {
+	c.diags.Warnf(c.pos, code, "in function '%s': %s", c.fn.Name, fmt.Sprintf(format, args...))
+}
+
+func functionType(fn *clight.Function) ctypes.Tfunction {
+	params := make([]ctypes.Type, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = p.Type
+	}
+	return ctypes.Tfunction{Params: params, Return: fn.Return}
+}
+
+// tempType returns the declared type of a temporary, nil if unknown.
+// Temporaries are numbered from 1.
+func (c *checker) tempType(id int) ctypes.Type {
+	if id < 1 || id > len(c.fn.Temps) {
+		return nil
+	}
+	return c.fn.Temps[id-1]
+}
+
+func (c *checker) stmt(s clight.Stmt) clight.Stmt {
+	switch s := s.(type) {
+	case clight.Sassign:
+		c.pos = s.Pos
+		c.expr(s.LHS)
+		c.expr(s.RHS)
+		s.RHS = c.convert(s.RHS, s.LHS.ExprType(), assigning)
+		return s
+	case clight.Sset:
+		c.pos = s.Pos
+		c.expr(s.RHS)
+		s.RHS = c.convert(s.RHS, c.tempType(s.TempID), assigning)
+		return s
+	case clight.Scall:
+		c.pos = s.Pos
+		return c.call(s)
+	case clight.Sbuiltin:
+		c.pos = s.Pos
+		for _, a := range s.Args {
+			c.expr(a)
+		}
+		return s
+	case clight.Ssequence:
+		s.First = c.stmt(s.First)
+		s.Second = c.stmt(s.Second)
+		return s
+	case clight.Sifthenelse:
+		c.pos = s.Pos
+		c.condition(s.Cond)
+		s.Then = c.stmt(s.Then)
+		s.Else = c.stmt(s.Else)
+		return s
+	case clight.Sloop:
+		s.Body = c.stmt(s.Body)
+		s.Continue = c.stmt(s.Continue)
+		return s
+	case clight.Sreturn:
+		c.pos = s.Pos
+		if s.Value == nil {
+			return s
+		}
+		c.expr(s.Value)
+		if _, ok := c.fn.Return.(ctypes.Tvoid); ok {
+			// return g(); with g void is accepted: the call is made
+			// before, and only the placeholder of its value is left
+			if _, ok := s.Value.ExprType().(ctypes.Tvoid); ok {
+				return clight.Sreturn{Pos: s.Pos}
+			}
+			c.warnf("return-type", "void function should not return a value")
+			return s
+		}
+		s.Value = c.convert(s.Value, c.fn.Return, returning)
+		return s
+	case clight.Sswitch:
+		c.pos = s.Pos
+		c.expr(s.Expr)
+		if t := s.Expr.ExprType(); t != nil && !isInteger(t) {
+			c.errorf("switch", "statement requires expression of integer type ('%s' invalid)", t)
+		}
+		cases := make([]clight.SwitchCase, len(s.Cases))
+		for i, cs := range s.Cases {
+			cases[i] = clight.SwitchCase{Value: cs.Value, Body: c.stmt(cs.Body)}
+		}
+		s.Cases = cases
+		if s.Default != nil {
+			s.Default = c.stmt(s.Default)
+		}
+		return s
+	case clight.Slabel:
+		s.Stmt = c.stmt(s.Stmt)
+		return s
+	}
+	return s
+}
+
+// labels checks the labels of a function. A label is visible in the whole
+// function, whatever the block it is defined in, so a goto may jump into
+// or out of blocks; each label must be defined once and each goto must
+// target one of them.
+func (c *checker) labels(body clight.Stmt) {
+	defined := make(map[string]bool)
+	var targets []clight.Sgoto
+	var walk func(s clight.Stmt)
+	walk = func(s clight.Stmt) {
+		switch s := s.(type) {
+		case clight.Slabel:
+			if defined[s.Label] {
+				c.pos = s.Pos
+				c.errorf("label", "redefinition of label '%s'", s.Label)
+			}
+			defined[s.Label] = true
+			walk(s.Stmt)
+		case clight.Sgoto:
+			targets = append(targets, s)
+		case clight.Ssequence:
+			walk(s.First)
+			walk(s.Second)
+		case clight.Sifthenelse:
+			walk(s.Then)
+			walk(s.Else)
+		case clight.Sloop:
+			walk(s.Body)
+			walk(s.Continue)
+		case clight.Sswitch:
+			for _, cs := range s.Cases {
+				walk(cs.Body)
+			}
+			if s.Default != nil {
+				walk(s.Default)
+			}
+		}
+	}
+	walk(body)
+
+	for _, g := range targets {
+		if !defined[g.Label] {
+			c.pos = g.Pos
+			c.errorf("label", "use of undeclared label '%s'", g.Label)
+		}
+	}
+}
+
+// jumps checks that each break is within a loop or a switch and each
+// continue within a loop.
+func (c *checker) jumps(body clight.Stmt) {
+	var walk func(s clight.Stmt, inLoop, inSwitch bool)
+	walk = func(s clight.Stmt, inLoop, inSwitch bool) {
+		switch s := s.(type) {
+		case clight.Sbreak:
+			if !inLoop && !inSwitch {
+				c.pos = s.Pos
+				c.errorf("jump", "break statement not within loop or switch")
+			}
+		case clight.Scontinue:
+			if !inLoop {
+				c.pos = s.Pos
+				c.errorf("jump", "continue statement not within a loop")
+			}
+		case clight.Ssequence:
+			walk(s.First, inLoop, inSwitch)
+			walk(s.Second, inLoop, inSwitch)
+		case clight.Sifthenelse:
+			walk(s.Then, inLoop, inSwitch)
+			walk(s.Else, inLoop, inSwitch)
+		case clight.Sloop:
+			walk(s.Body, true, inSwitch)
+			walk(s.Continue, true, inSwitch)
+		case clight.Sswitch:
+			for _, cs := range s.Cases {
+				walk(cs.Body, inLoop, true)
+			}
+			if s.Default != nil {
+				walk(s.Default, inLoop, true)
+			}
+		case clight.Slabel:
+			walk(s.Stmt, inLoop, inSwitch)
+		}
+	}
+	walk(body, false, false)
+}
+
+// call checks that the callee of a call is a function and converts the
+// arguments to the types of its parameters.
+func (c *checker) call(s clight.Scall) clight.Stmt {
+	c.expr(s.Func)
+	for _, a := range s.Args {
+		c.expr(a)
+	}
+	fn, ok := c.calleeType(s.Func)
+	if !ok {
+		return s
+	}
+	args := make([]clight.Expr, len(s.Args))
+	for i, a := range s.Args {
+		if i < len(fn.Params) {
+			a = c.convert(a, fn.Params[i], passing)
+		}
+		args[i] = a
+	}
+	s.Args = args
+	return s
+}
+
+// calleeType returns the function type of a callee. A callee that is not
+// a function nor a pointer to one is an error, except for a variable that
+// is not declared: calling it declares it implicitly.
+func (c *checker) calleeType(fn clight.Expr) (ctypes.Tfunction, bool) {
+	t := fn.ExprType()
+	if p, ok := t.(ctypes.Tpointer); ok {
+		t = p.Elem
+	}
+	if f, ok := t.(ctypes.Tfunction); ok {
+		return f, true
+	}
+	if v, ok := fn.(clight.Evar); ok {
+		if _, declared := c.vars[v.Name]; !declared {
+			return ctypes.Tfunction{}, false
+		}
+	}
+	if t != nil {
+		c.errorf("call", "called object type '%s' is not a function or function pointer", fn.ExprType())
+	}
+	return ctypes.Tfunction{}, false
+}
+
+// conversion is the context of an implicit conversion, named by the
+// warnings about it.
+type conversion int
+
+const (
+	assigning conversion = iota
+	passing
+	returning
+)
+
+// describe phrases the conversion of a value of type from to type to, as
+// clang does.
+func (k conversion) describe(to, from ctypes.Type) string {
+	switch k {
+	case passing:
+		return fmt.Sprintf("passing '%s' to parameter of type '%s'", from, to)
+	case returning:
+		return fmt.Sprintf("returning '%s' from a function with result type '%s'", from, to)
+	}
+	return fmt.Sprintf("assigning to '%s' from '%s'", to, from)
+}
+
+// convert makes the implicit conversion of e to typ explicit. Arithmetic
+// values are converted silently; converting between integers and
+// pointers, or between incompatible pointers, is allowed with a warning.
+func (c *checker) convert(e clight.Expr, typ ctypes.Type, k conversion) clight.Expr {
+	from := e.ExprType()
+	if from == nil || typ == nil || ctypes.Equal(from, typ) {
+		return e
+	}
+	switch {
+	case isArithmetic(from) && isArithmetic(typ):
+		return clight.Ecast{Arg: e, Typ: typ}
+	case isPointer(typ) && isInteger(from):
+		if isNullConstant(e) {
+			return e
+		}
+		c.warnf("int-conversion", "incompatible integer to pointer conversion %s", k.describe(typ, from))
+		return clight.Ecast{Arg: e, Typ: typ}
+	case isInteger(typ) && isPointer(from):
+		if b, ok := typ.(ctypes.Tint); ok && b.Size == ctypes.IBool {
+			return clight.Ecast{Arg: e, Typ: typ}
+		}
+		c.warnf("int-conversion", "incompatible pointer to integer conversion %s", k.describe(typ, from))
+		return clight.Ecast{Arg: e, Typ: typ}
+	case isPointer(typ) && isPointer(from):
+		if !ctypes.Compatible(typ, from) {
+			c.warnf("incompatible-pointer-types", "incompatible pointer types %s", k.describe(typ, from))
+		}
+	}
+	return e
+}
+
+// condition checks the controlling expression of an if or a loop.
+func (c *checker) condition(e clight.Expr) {
+	c.expr(e)
+	if t := e.ExprType(); t != nil && !isScalar(t) {
+		c.errorf("condition", "statement requires expression of scalar type ('%s' invalid)", t)
+	}
+}
+
+// expr checks the operand types of the operators of an expression.
+func (c *checker) expr(e clight.Expr) {
+	switch e := e.(type) {
+	case clight.Ederef:
+		c.expr(e.Ptr)
+		// An index a[i] arrives as *(a + i), typed as a pointer whatever
+		// the type of a
+		if b, ok := e.Ptr.(clight.Ebinop); ok && b.Op == clight.Oadd {
+			l, r := b.Left.ExprType(), b.Right.ExprType()
+			if l != nil && r != nil && !isPointer(l) && !isPointer(r) {
+				c.errorf("subscript", "subscripted value is not an array or pointer")
+			}
+			return
+		}
+		if t := e.Ptr.ExprType(); t != nil && !isPointer(t) {
+			c.errorf("indirection", "indirection requires pointer operand ('%s' invalid)", t)
+		}
+	case clight.Eaddrof:
+		c.expr(e.Arg)
+	case clight.Ecast:
+		c.expr(e.Arg)
+	case clight.Efield:
+		c.expr(e.Arg)
+		if t := e.Arg.ExprType(); t != nil && isScalar(t) {
+			c.errorf("member", "member reference base type '%s' is not a structure or union", t)
+		}
+	case clight.Eunop:
+		c.expr(e.Arg)
+		c.unop(e)
+	case clight.Ebinop:
+		c.expr(e.Left)
+		c.expr(e.Right)
+		c.binop(e)
+	}
+}
+
+func (c *checker) unop(e clight.Eunop) {
+	t := e.Arg.ExprType()
+	if t == nil {
+		return
+	}
+	var ok bool
+	switch e.Op {
+	case clight.Onotbool:
+		ok = isScalar(t)
+	case clight.Onotint:
+		ok = isInteger(t)
+	case clight.Oneg, clight.Oabsfloat:
+		ok = isArithmetic(t)
+	default:
+		ok = true
+	}
+	if !ok {
+		c.errorf("operands", "invalid argument type '%s' to unary expression", t)
+	}
+}
+
+func (c *checker) binop(e clight.Ebinop) {
+	l, r := e.Left.ExprType(), e.Right.ExprType()
+	if l == nil || r == nil {
+		return
+	}
+	var ok bool
+	switch e.Op {
+	case clight.Oadd:
+		ok = isArithmetic(l) && isArithmetic(r) ||
+			isPointer(l) && isInteger(r) || isInteger(l) && isPointer(r)
+	case clight.Osub:
+		ok = isArithmetic(l) && isArithmetic(r) ||
+			isPointer(l) && isInteger(r) || isPointer(l) && isPointer(r)
+	case clight.Omul, clight.Odiv:
+		ok = isArithmetic(l) && isArithmetic(r)
+	case clight.Omod, clight.Oand, clight.Oor, clight.Oxor, clight.Oshl, clight.Oshr:
+		ok = isInteger(l) && isInteger(r)
+	case clight.Oeq, clight.One, clight.Olt, clight.Ogt, clight.Ole, clight.Oge:
+		ok = isScalar(l) && isScalar(r)
+	default:
+		ok = true
+	}
+	if !ok {
+		c.errorf("operands", "invalid operands to binary expression ('%s' and '%s')", l, r)
+	}
+}
+
+func isInteger(t ctypes.Type) bool {
+	switch t.(type) {
+	case ctypes.Tint, ctypes.Tlong:
+		return true
+	}
+	return false
+}
+
+func isArithmetic(t ctypes.Type) bool {
+	_, float := t.(ctypes.Tfloat)
+	return float || isInteger(t)
+}
+
+// isPointer reports whether a value of type t is a pointer, arrays and
+// functions decaying to pointers.
+func isPointer(t ctypes.Type) bool {
+	switch t.(type) {
+	case ctypes.Tpointer, ctypes.Tarray, ctypes.Tfunction:
+		return true
+	}
+	return false
+}
+
+func isScalar(t ctypes.Type) bool {
+	return isArithmetic(t) || isPointer(t)
+}
+
+// isNullConstant reports whether e is the integer constant 0, a null
+// pointer constant.
+func isNullConstant(e clight.Expr) bool {
+	switch e := e.(type) {
+	case clight.Econst_int:
+		return e.Value == 0
+	case clight.Econst_long:
+		return e.Value == 0
+	case clight.Ecast:
+		return isNullConstant(e.Arg)
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package ctyping
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/clight"
+	"github.com/raymyers/ralph-cc/pkg/ctypes"
+	"github.com/raymyers/ralph-cc/pkg/diag"
+)
+
+func checkFunction(fn clight.Function) (clight.Function, *diag.Emitter) {
+	prog := &clight.Program{Functions: []clight.Function{fn}}
+	diags := diag.NewEmitter(diag.Options{})
+	Check(prog, diags)
+	return prog.Functions[0], diags
+}
+
+func TestCheck_IntToDoubleCast(t *testing.T) {
+	// double d = 1;
+	d := clight.Evar{Name: "d", Typ: ctypes.Double()}
+	one := clight.Econst_int{Value: 1, Typ: ctypes.Int()}
+	fn, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Void(),
+		Locals: []clight.VarDecl{{Name: "d", Type: ctypes.Double()}},
+		Body:   clight.Sassign{LHS: d, RHS: one},
+	})
+
+	if len(diags.Diagnostics()) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags.Diagnostics())
+	}
+	want := clight.Sassign{LHS: d, RHS: clight.Ecast{Arg: one, Typ: ctypes.Double()}}
+	if !reflect.DeepEqual(fn.Body, want) {
+		t.Errorf("body = %#v, want %#v", fn.Body, want)
+	}
+}
+
+func TestCheck_ConvertsTempsReturnsAndArguments(t *testing.T) {
+	// double $1 = 1; g($1); return $1; with int g(int) and int f()
+	one := clight.Econst_int{Value: 1, Typ: ctypes.Int()}
+	tmp := clight.Etempvar{ID: 1, Typ: ctypes.Double()}
+	g := clight.Evar{Name: "g", Typ: ctypes.Tfunction{Params: []ctypes.Type{ctypes.Int()}, Return: ctypes.Int()}}
+	fn, _ := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Int(),
+		Temps:  []ctypes.Type{ctypes.Double()},
+		Body: clight.Seq(
+			clight.Sset{TempID: 1, RHS: one},
+			clight.Scall{Func: g, Args: []clight.Expr{tmp}},
+			clight.Sreturn{Value: tmp},
+		),
+	})
+
+	want := clight.Seq(
+		clight.Sset{TempID: 1, RHS: clight.Ecast{Arg: one, Typ: ctypes.Double()}},
+		clight.Scall{Func: g, Args: []clight.Expr{clight.Ecast{Arg: tmp, Typ: ctypes.Int()}}},
+		clight.Sreturn{Value: clight.Ecast{Arg: tmp, Typ: ctypes.Int()}},
+	)
+	if !reflect.DeepEqual(fn.Body, want) {
+		t.Errorf("body = %#v, want %#v", fn.Body, want)
+	}
+}
+
+func TestCheck_ReturnVoidValue(t *testing.T) {
+	// void f() { return g(); } with void g(): the call is made before
+	// the return, which is left with only its placeholder value
+	g := clight.Evar{Name: "g", Typ: ctypes.Tfunction{Return: ctypes.Void()}}
+	fn, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Void(),
+		Body: clight.Seq(
+			clight.Scall{Func: g},
+			clight.Sreturn{Value: clight.Econst_int{Value: 0, Typ: ctypes.Void()}},
+		),
+	})
+
+	if len(diags.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags.Diagnostics())
+	}
+	if ret := fn.Body.(clight.Ssequence).Second; !reflect.DeepEqual(ret, clight.Sreturn{}) {
+		t.Errorf("expected a return without value, got %#v", ret)
+	}
+
+	// A value of another type is still reported
+	_, diags = checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Void(),
+		Body:   clight.Sreturn{Value: clight.Econst_int{Value: 1, Typ: ctypes.Int()}},
+	})
+	if len(diags.Diagnostics()) != 1 {
+		t.Errorf("expected a return-type warning, got %v", diags.Diagnostics())
+	}
+}
+
+func TestCheck_CallNonFunction(t *testing.T) {
+	// 1();
+	_, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Void(),
+		Body:   clight.Scall{Func: clight.Econst_int{Value: 1, Typ: ctypes.Int()}},
+	})
+
+	errs := diags.Errors()
+	if len(errs) != 1 || errs[0].Code != "call" {
+		t.Fatalf("expected one call error, got %v", diags.Diagnostics())
+	}
+}
+
+func TestCheck_CallUndeclaredFunction(t *testing.T) {
+	// An undeclared callee is implicitly declared, as printf("hi") without
+	// its header
+	_, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Void(),
+		Body:   clight.Scall{Func: clight.Evar{Name: "printf", Typ: ctypes.Int()}},
+	})
+
+	if len(diags.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags.Diagnostics())
+	}
+}
+
+func TestCheck_SubscriptNonPointer(t *testing.T) {
+	// x[1] with int x
+	x := clight.Etempvar{ID: 1, Typ: ctypes.Int()}
+	index := clight.Ederef{
+		Ptr: clight.Ebinop{Op: clight.Oadd, Left: x, Right: clight.Econst_int{Value: 1, Typ: ctypes.Int()}, Typ: ctypes.Pointer(ctypes.Int())},
+		Typ: ctypes.Int(),
+	}
+	_, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Int(),
+		Temps:  []ctypes.Type{ctypes.Int()},
+		Body:   clight.Sreturn{Value: index},
+	})
+
+	errs := diags.Errors()
+	if len(errs) != 1 || errs[0].Code != "subscript" {
+		t.Fatalf("expected one subscript error, got %v", diags.Diagnostics())
+	}
+}
+
+func TestCheck_IntToPointerWarning(t *testing.T) {
+	p := clight.Etempvar{ID: 1, Typ: ctypes.Pointer(ctypes.Int())}
+	tests := []struct {
+		name     string
+		rhs      clight.Expr
+		warnings int
+	}{
+		{"null pointer constant", clight.Econst_int{Value: 0, Typ: ctypes.Int()}, 0},
+		{"integer", clight.Econst_int{Value: 5, Typ: ctypes.Int()}, 1},
+		{"incompatible pointer", clight.Etempvar{ID: 2, Typ: ctypes.Pointer(ctypes.Double())}, 1},
+		{"void pointer", clight.Etempvar{ID: 2, Typ: ctypes.Pointer(ctypes.Void())}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := checkFunction(clight.Function{
+				Name:   "f",
+				Return: ctypes.Void(),
+				Temps:  []ctypes.Type{p.Typ, tt.rhs.ExprType()},
+				Body:   clight.Sset{TempID: p.ID, RHS: tt.rhs},
+			})
+			if got := len(diags.Diagnostics()); got != tt.warnings || diags.HasErrors() {
+				t.Errorf("got diagnostics %v, want %d warnings", diags.Diagnostics(), tt.warnings)
+			}
+		})
+	}
+}
+
+func TestCheck_ConversionWarningMessages(t *testing.T) {
+	// int *f(char *p) with a temporary $1 of type int *
+	p := clight.Evar{Name: "p", Typ: ctypes.Pointer(ctypes.Char())}
+	g := clight.Evar{Name: "g", Typ: ctypes.Tfunction{Params: []ctypes.Type{ctypes.Pointer(ctypes.Int())}, Return: ctypes.Void()}}
+	five := clight.Econst_int{Value: 5, Typ: ctypes.Int()}
+	tests := []struct {
+		name string
+		body clight.Stmt
+		want string
+	}{
+		{
+			"assigning",
+			clight.Sset{TempID: 1, RHS: five, Pos: diag.Pos{Line: 3, Col: 5}},
+			"in function 'f': incompatible integer to pointer conversion assigning to 'int *' from 'int'",
+		},
+		{
+			"passing",
+			clight.Scall{Func: g, Args: []clight.Expr{p}, Pos: diag.Pos{Line: 3, Col: 5}},
+			"in function 'f': incompatible pointer types passing 'char *' to parameter of type 'int *'",
+		},
+		{
+			"returning",
+			clight.Sreturn{Value: p, Pos: diag.Pos{Line: 3, Col: 5}},
+			"in function 'f': incompatible pointer types returning 'char *' from a function with result type 'int *'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := checkFunction(clight.Function{
+				Name:   "f",
+				Return: ctypes.Pointer(ctypes.Int()),
+				Params: []clight.VarDecl{{Name: "p", Type: p.Typ}},
+				Temps:  []ctypes.Type{ctypes.Pointer(ctypes.Int())},
+				Body:   tt.body,
+			})
+			ds := diags.Diagnostics()
+			if len(ds) != 1 {
+				t.Fatalf("expected one warning, got %v", ds)
+			}
+			if ds[0].Message != tt.want {
+				t.Errorf("message = %q, want %q", ds[0].Message, tt.want)
+			}
+			if ds[0].Pos != (diag.Pos{Line: 3, Col: 5}) {
+				t.Errorf("position = %+v, want line 3 column 5", ds[0].Pos)
+			}
+		})
+	}
+}
+
+func TestCheck_InvalidOperands(t *testing.T) {
+	f := clight.Etempvar{ID: 1, Typ: ctypes.Double()}
+	_, diags := checkFunction(clight.Function{
+		Name:   "f",
+		Return: ctypes.Double(),
+		Temps:  []ctypes.Type{ctypes.Double()},
+		Body:   clight.Sreturn{Value: clight.Ebinop{Op: clight.Omod, Left: f, Right: f, Typ: ctypes.Double()}},
+	})
+
+	errs := diags.Errors()
+	if len(errs) != 1 || errs[0].Code != "operands" {
+		t.Fatalf("expected one operands error, got %v", diags.Diagnostics())
+	}
+}
+
+func TestCheck_Labels(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   clight.Stmt
+		errors int
+	}{
+		{
+			// goto inner; { inner: ; } with the label in a nested statement
+			"forward goto into a nested statement",
+			clight.Seq(
+				clight.Sgoto{Label: "inner"},
+				clight.Sifthenelse{Cond: clight.Econst_int{Value: 1, Typ: ctypes.Int()}, Then: clight.Slabel{Label: "inner", Stmt: clight.Sskip{}}, Else: clight.Sskip{}},
+			),
+			0,
+		},
+		{
+			"backward goto",
+			clight.Slabel{Label: "again", Stmt: clight.Sgoto{Label: "again"}},
+			0,
+		},
+		{"undeclared label", clight.Sgoto{Label: "nowhere"}, 1},
+		{
+			"redefined label",
+			clight.Seq(clight.Slabel{Label: "a", Stmt: clight.Sskip{}}, clight.Slabel{Label: "a", Stmt: clight.Sskip{}}),
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := checkFunction(clight.Function{Name: "f", Return: ctypes.Void(), Body: tt.body})
+			errs := diags.Errors()
+			if len(errs) != tt.errors {
+				t.Fatalf("expected %d errors, got %v", tt.errors, diags.Diagnostics())
+			}
+			for _, e := range errs {
+				if e.Code != "label" {
+					t.Errorf("expected a label error, got %v", e)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck_Jumps(t *testing.T) {
+	one := clight.Econst_int{Value: 1, Typ: ctypes.Int()}
+	tests := []struct {
+		name   string
+		body   clight.Stmt
+		errors int
+	}{
+		{"break at function level", clight.Sbreak{}, 1},
+		{"continue at function level", clight.Scontinue{}, 1},
+		{
+			// for (;;) { if (1) break; else continue; }
+			"break and continue in a for",
+			clight.Sloop{Body: clight.Sifthenelse{Cond: one, Then: clight.Sbreak{}, Else: clight.Scontinue{}}, Continue: clight.Sskip{}},
+			0,
+		},
+		{"break in a switch", clight.Sswitch{Expr: one, Cases: []clight.SwitchCase{{Value: 1, Body: clight.Sbreak{}}}}, 0},
+		{"continue in a switch", clight.Sswitch{Expr: one, Cases: []clight.SwitchCase{{Value: 1, Body: clight.Scontinue{}}}}, 1},
+		{
+			"continue in a switch in a loop",
+			clight.Sloop{Body: clight.Sswitch{Expr: one, Default: clight.Scontinue{}}, Continue: clight.Sskip{}},
+			0,
+		},
+		{"break after a loop", clight.Seq(clight.Sloop{Body: clight.Sbreak{}, Continue: clight.Sskip{}}, clight.Sbreak{}), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := checkFunction(clight.Function{Name: "f", Return: ctypes.Void(), Body: tt.body})
+			errs := diags.Errors()
+			if len(errs) != tt.errors {
+				t.Fatalf("expected %d errors, got %v", tt.errors, diags.Diagnostics())
+			}
+			for _, e := range errs {
+				if e.Code != "jump" {
+					t.Errorf("expected a jump error, got %v", e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package deadfunc removes the static functions of an RTL program that can
+// never be called. A static function is invisible outside the translation
+// unit, so once no function that is kept refers to it, by a call or by
+// taking its address, its code is dead. This mirrors CompCert's
+// backend/Unusedglob.v, restricted to functions.
+package deadfunc
+
+import (
+	"github.com/raymyers/ralph-cc/pkg/optreport"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// TransformProgram drops the unreachable static functions of prog, in place,
+// recording each in report. The roots are main and every function visible
+// outside the unit; a function is kept if a kept function refers to it.
+func TransformProgram(prog *rtl.Program, report *optreport.Report) *rtl.Program {
+	reachable := Reachable(prog)
+	kept := prog.Functions[:0]
+	for _, fn := range prog.Functions {
+		if reachable[fn.Name] {
+			kept = append(kept, fn)
+		} else {
+			report.Remove(fn.Name)
+		}
+	}
+	prog.Functions = kept
+	return prog
+}
+
+// Reachable returns the names of the functions of prog reachable from its
+// roots over the references of their code.
+func Reachable(prog *rtl.Program) map[string]bool {
+	byName := make(map[string]*rtl.Function, len(prog.Functions))
+	var work []string
+	for i := range prog.Functions {
+		fn := &prog.Functions[i]
+		byName[fn.Name] = fn
+		if !fn.Static || fn.Name == "main" {
+			work = append(work, fn.Name)
+		}
+	}
+
+	reachable := make(map[string]bool)
+	for len(work) > 0 {
+		name := work[len(work)-1]
+		work = work[:len(work)-1]
+		if reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		for _, ref := range references(byName[name]) {
+			if _, ok := byName[ref]; ok && !reachable[ref] {
+				work = append(work, ref)
+			}
+		}
+	}
+	return reachable
+}
+
+// references returns the global symbols the code of fn refers to.
+func references(fn *rtl.Function) []string {
+	var refs []string
+	for _, instr := range fn.Code {
+		switch i := instr.(type) {
+		case rtl.Icall:
+			if s, ok := i.Fn.(rtl.FunSymbol); ok {
+				refs = append(refs, s.Name)
+			}
+		case rtl.Itailcall:
+			if s, ok := i.Fn.(rtl.FunSymbol); ok {
+				refs = append(refs, s.Name)
+			}
+		case rtl.Iop:
+			if op, ok := i.Op.(rtl.Oaddrsymbol); ok {
+				refs = append(refs, op.Symbol)
+			}
+		case rtl.Iload:
+			if a, ok := i.Addr.(rtl.Aglobal); ok {
+				refs = append(refs, a.Symbol)
+			}
+		case rtl.Istore:
+			if a, ok := i.Addr.(rtl.Aglobal); ok {
+				refs = append(refs, a.Symbol)
+			}
+		}
+	}
+	return refs
+}
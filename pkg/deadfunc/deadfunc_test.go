@@ -0,0 +1,126 @@
+package deadfunc
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/optreport"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// function builds an RTL function whose code is instrs chained in order,
+// ending in a return.
+func function(name string, static bool, instrs ...rtl.Instruction) rtl.Function {
+	fn := rtl.NewFunction(name, rtl.Sig{})
+	fn.Static = static
+	fn.Code[1] = rtl.Ireturn{}
+	next := rtl.Node(1)
+	for i := len(instrs) - 1; i >= 0; i-- {
+		n := next + 1
+		switch instr := instrs[i].(type) {
+		case rtl.Icall:
+			instr.Succ = next
+			fn.Code[n] = instr
+		case rtl.Iop:
+			instr.Succ = next
+			fn.Code[n] = instr
+		}
+		next = n
+	}
+	fn.Entrypoint = next
+	return *fn
+}
+
+func call(name string) rtl.Icall {
+	return rtl.Icall{Fn: rtl.FunSymbol{Name: name}}
+}
+
+func names(prog *rtl.Program) []string {
+	var result []string
+	for _, fn := range prog.Functions {
+		result = append(result, fn.Name)
+	}
+	return result
+}
+
+func TestTransformProgram(t *testing.T) {
+	tests := []struct {
+		name      string
+		functions []rtl.Function
+		want      []string
+	}{
+		{
+			name: "unused static function is dropped",
+			functions: []rtl.Function{
+				function("unused", true),
+				function("used", true),
+				function("main", false, call("used")),
+			},
+			want: []string{"used", "main"},
+		},
+		{
+			name: "non-static functions are roots",
+			functions: []rtl.Function{
+				function("helper", true),
+				function("api", false, call("helper")),
+				function("orphan", false),
+			},
+			want: []string{"helper", "api", "orphan"},
+		},
+		{
+			name: "reachable through a chain of static calls",
+			functions: []rtl.Function{
+				function("c", true),
+				function("b", true, call("c")),
+				function("a", true, call("b")),
+				function("main", false, call("a")),
+			},
+			want: []string{"c", "b", "a", "main"},
+		},
+		{
+			name: "address taken keeps the function",
+			functions: []rtl.Function{
+				function("callback", true),
+				function("main", false, rtl.Iop{Op: rtl.Oaddrsymbol{Symbol: "callback"}, Dest: 1}),
+			},
+			want: []string{"callback", "main"},
+		},
+		{
+			name: "static functions calling only each other are dropped",
+			functions: []rtl.Function{
+				function("even", true, call("odd")),
+				function("odd", true, call("even")),
+				function("main", false),
+			},
+			want: []string{"main"},
+		},
+		{
+			name: "static main is a root",
+			functions: []rtl.Function{
+				function("helper", true),
+				function("main", true, call("helper")),
+			},
+			want: []string{"helper", "main"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var removed []string
+			for _, fn := range tt.functions {
+				if !slices.Contains(tt.want, fn.Name) {
+					removed = append(removed, fn.Name)
+				}
+			}
+			report := optreport.New()
+			prog := TransformProgram(&rtl.Program{Functions: tt.functions}, report)
+			if got := names(prog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+			if got := report.Removed(); !reflect.DeepEqual(got, removed) {
+				t.Errorf("reported %v removed, want %v", got, removed)
+			}
+		})
+	}
+}
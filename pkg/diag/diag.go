@@ -0,0 +1,168 @@
+// Package diag defines the diagnostics reported while compiling a program
+// and the emitter that collects them.
+package diag
+
+import "fmt"
+
+// Severity classifies a diagnostic
+type Severity int
+
+const (
+	Error   Severity = iota // the program is rejected
+	Warning                 // suspicious but valid code
+	Note                    // additional information about the previous diagnostic
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Pos is a position in the source, counting lines and columns from 1
+type Pos struct {
+	File string // file the position is in when it is not the file being compiled, e.g. a header
+	Line int
+	Col  int
+}
+
+// Diagnostic is a single message about the program being compiled
+type Diagnostic struct {
+	Severity Severity
+	Pos      Pos
+	Code     string // kind of diagnostic, e.g. "syntax"
+	Message  string
+}
+
+// String formats the diagnostic as "line L, col C: message", the format
+// parse errors were reported in before diagnostics had a severity.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d, col %d: %s", d.Pos.Line, d.Pos.Col, d.Message)
+}
+
+// Format formats the diagnostic the way GCC does, as
+// "file:line:col: severity: message [code]", leaving out the line and
+// column of a diagnostic with no position.
+func (d Diagnostic) Format(filename string) string {
+	if d.Pos.File != "" {
+		filename = d.Pos.File
+	}
+	if d.Pos.Line != 0 {
+		filename = fmt.Sprintf("%s:%d:%d", filename, d.Pos.Line, d.Pos.Col)
+	}
+	s := fmt.Sprintf("%s: %s: %s", filename, d.Severity, d.Message)
+	if d.Code != "" {
+		s += " [" + d.Code + "]"
+	}
+	return s
+}
+
+// Options control how an emitter treats warnings
+type Options struct {
+	WarningsAsErrors bool // --werror: report warnings as errors
+	NoWarnings       bool // --no-warnings: drop warnings
+	MaxErrors        int  // --max-errors: stop after this many errors, 0 for no limit
+}
+
+// Emitter collects the diagnostics of a compilation, applying the
+// options to each warning as it is emitted.
+type Emitter struct {
+	opts    Options
+	diags   []Diagnostic
+	dropped bool // the last warning was dropped, so are its notes
+	errors  int  // errors recorded so far
+	stopped bool // MaxErrors was reached: nothing more is recorded
+}
+
+// NewEmitter creates an emitter with the given options
+func NewEmitter(opts Options) *Emitter {
+	return &Emitter{opts: opts}
+}
+
+// Emit records a diagnostic. Under WarningsAsErrors a warning becomes an
+// error; under NoWarnings it is dropped along with the notes following it.
+// Once MaxErrors errors are recorded, a last error says so and later
+// diagnostics are dropped.
+func (e *Emitter) Emit(d Diagnostic) {
+	if e.stopped {
+		return
+	}
+	switch d.Severity {
+	case Warning:
+		e.dropped = e.opts.NoWarnings && !e.opts.WarningsAsErrors
+		if e.opts.WarningsAsErrors {
+			d.Severity = Error
+		}
+	case Note:
+		if e.dropped {
+			return
+		}
+	default:
+		e.dropped = false
+	}
+	if e.dropped {
+		return
+	}
+	e.diags = append(e.diags, d)
+	if d.Severity != Error {
+		return
+	}
+	e.errors++
+	if e.opts.MaxErrors > 0 && e.errors >= e.opts.MaxErrors {
+		e.diags = append(e.diags, Diagnostic{Severity: Error, Pos: d.Pos, Message: "too many errors, stopping"})
+		e.stopped = true
+	}
+}
+
+// Stopped reports whether MaxErrors was reached, so that the caller can
+// give up on input too broken to be worth reporting on.
+func (e *Emitter) Stopped() bool {
+	return e.stopped
+}
+
+// Errorf emits an error
+func (e *Emitter) Errorf(pos Pos, code, format string, args ...any) {
+	e.Emit(Diagnostic{Severity: Error, Pos: pos, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warnf emits a warning
+func (e *Emitter) Warnf(pos Pos, code, format string, args ...any) {
+	e.Emit(Diagnostic{Severity: Warning, Pos: pos, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Notef emits a note about the preceding diagnostic
+func (e *Emitter) Notef(pos Pos, code, format string, args ...any) {
+	e.Emit(Diagnostic{Severity: Note, Pos: pos, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Diagnostics returns the recorded diagnostics in the order emitted
+func (e *Emitter) Diagnostics() []Diagnostic {
+	return e.diags
+}
+
+// Errors returns the recorded errors, including promoted warnings
+func (e *Emitter) Errors() []Diagnostic {
+	var errs []Diagnostic
+	for _, d := range e.diags {
+		if d.Severity == Error {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// HasErrors reports whether any error was recorded
+func (e *Emitter) HasErrors() bool {
+	for _, d := range e.diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package diag
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	d := Diagnostic{Severity: Warning, Pos: Pos{Line: 3, Col: 7}, Code: "unused", Message: "unused variable 'x'"}
+	if got, want := d.Format("a.c"), "a.c:3:7: warning: unused variable 'x' [unused]"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	if got, want := d.String(), "line 3, col 7: unused variable 'x'"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	d.Pos.File = "a.h"
+	if got, want := d.Format("a.c"), "a.h:3:7: warning: unused variable 'x' [unused]"; got != want {
+		t.Errorf("Format in a header = %q, want %q", got, want)
+	}
+
+	d = Diagnostic{Severity: Error, Code: "call", Message: "called object is not a function"}
+	if got, want := d.Format("a.c"), "a.c: error: called object is not a function [call]"; got != want {
+		t.Errorf("Format without a position = %q, want %q", got, want)
+	}
+}
+
+func TestEmitterOptions(t *testing.T) {
+	emitAll := func(e *Emitter) {
+		e.Warnf(Pos{Line: 1, Col: 1}, "w", "warning")
+		e.Notef(Pos{Line: 1, Col: 1}, "w", "note on the warning")
+		e.Errorf(Pos{Line: 2, Col: 1}, "syntax", "error")
+		e.Notef(Pos{Line: 2, Col: 1}, "syntax", "note on the error")
+	}
+	tests := []struct {
+		name   string
+		opts   Options
+		want   []Severity
+		errors int
+	}{
+		{"default", Options{}, []Severity{Warning, Note, Error, Note}, 1},
+		{"werror", Options{WarningsAsErrors: true}, []Severity{Error, Note, Error, Note}, 2},
+		{"no warnings", Options{NoWarnings: true}, []Severity{Error, Note}, 1},
+		{"werror wins", Options{WarningsAsErrors: true, NoWarnings: true}, []Severity{Error, Note, Error, Note}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEmitter(tt.opts)
+			emitAll(e)
+
+			diags := e.Diagnostics()
+			if len(diags) != len(tt.want) {
+				t.Fatalf("expected %d diagnostics, got %v", len(tt.want), diags)
+			}
+			for i, d := range diags {
+				if d.Severity != tt.want[i] {
+					t.Errorf("diagnostic %d: expected %v, got %v", i, tt.want[i], d.Severity)
+				}
+			}
+			if n := len(e.Errors()); n != tt.errors {
+				t.Errorf("expected %d errors, got %d", tt.errors, n)
+			}
+			if !e.HasErrors() {
+				t.Error("expected HasErrors")
+			}
+		})
+	}
+}
+
+func TestEmitterWarningsOnly(t *testing.T) {
+	e := NewEmitter(Options{})
+	e.Warnf(Pos{Line: 1, Col: 1}, "w", "warning")
+	if e.HasErrors() {
+		t.Error("a warning is not an error")
+	}
+}
+
+func TestEmitterMaxErrors(t *testing.T) {
+	e := NewEmitter(Options{MaxErrors: 2})
+	for i := 1; i <= 5; i++ {
+		e.Errorf(Pos{Line: i, Col: 1}, "syntax", "error %d", i)
+		e.Warnf(Pos{Line: i, Col: 1}, "w", "warning %d", i)
+	}
+
+	if !e.Stopped() {
+		t.Error("expected the emitter to stop")
+	}
+	diags := e.Diagnostics()
+	if len(diags) != 4 {
+		t.Fatalf("expected 2 errors, a warning and the stop, got %v", diags)
+	}
+	if last := diags[len(diags)-1]; last.Severity != Error || last.Message != "too many errors, stopping" {
+		t.Errorf("expected a last error saying so, got %v", last)
+	}
+
+	e = NewEmitter(Options{})
+	for i := 1; i <= 50; i++ {
+		e.Errorf(Pos{Line: i, Col: 1}, "syntax", "error")
+	}
+	if e.Stopped() || len(e.Errors()) != 50 {
+		t.Errorf("expected no limit by default, got %d errors", len(e.Errors()))
+	}
+}
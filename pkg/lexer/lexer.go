@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -13,6 +14,7 @@ type Lexer struct {
 	line     int
 	column   int
 	filename string // current filename from #line directive
+	mainFile string // filename of the first #line directive, the file being compiled
 }
 
 // New creates a new Lexer for the given input
@@ -25,6 +27,9 @@ func New(input string) *Lexer {
 func (l *Lexer) readChar() {
 	if l.readPos >= len(l.input) {
 		l.ch = 0 // EOF
+		// Reading on stays at the end, so that l.input[:l.pos] is in range
+		// after an unterminated literal
+		l.readPos = len(l.input)
 	} else {
 		l.ch = l.input[l.readPos]
 	}
@@ -59,7 +64,7 @@ func (l *Lexer) NextToken() Token {
 	l.skipComments()
 	l.skipWhitespace()
 
-	tok := Token{Line: l.line, Column: l.column}
+	tok := Token{Line: l.line, Column: l.column, Offset: l.pos, File: l.includedFile()}
 
 	switch l.ch {
 	case 0:
@@ -239,8 +244,27 @@ func (l *Lexer) NextToken() Token {
 		tok.Literal = l.readCharLiteral()
 		return tok
 	default:
+		if n := l.encodingPrefixLen(); n > 0 {
+			// Wide or Unicode literal: L"...", u8"...", u'x', U'x'
+			tok.Encoding = l.input[l.pos : l.pos+n]
+			for i := 0; i < n; i++ {
+				l.readChar()
+			}
+			if l.ch == '"' {
+				tok.Type = TokenString
+				tok.Literal = l.readString()
+			} else {
+				tok.Type = TokenCharLit
+				tok.Literal = l.readCharLiteral()
+			}
+			return tok
+		}
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
+			// _Pragma("...") is a no-op for the compiler proper
+			if tok.Literal == "_Pragma" && l.skipPragmaOperator() {
+				return l.NextToken()
+			}
 			tok.Type = LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
@@ -257,7 +281,7 @@ func (l *Lexer) NextToken() Token {
 }
 
 func (l *Lexer) newToken(tokenType TokenType, ch byte) Token {
-	return Token{Type: tokenType, Literal: string(ch), Line: l.line, Column: l.column}
+	return Token{Type: tokenType, Literal: string(ch), Line: l.line, Column: l.column, Offset: l.pos, File: l.includedFile()}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -265,9 +289,9 @@ func (l *Lexer) skipWhitespace() {
 		for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 			l.readChar()
 		}
-		// Handle #line directives (preprocessor output)
+		// Handle #line and #pragma directives (preprocessor output)
 		if l.ch == '#' {
-			if l.skipLineDirective() {
+			if l.skipLineDirective() || l.skipPragmaDirective() {
 				continue
 			}
 		}
@@ -375,6 +399,9 @@ func (l *Lexer) skipLineDirective() bool {
 			l.readChar()
 		}
 		l.filename = l.input[filenameStart:l.pos]
+		if l.mainFile == "" {
+			l.mainFile = l.filename
+		}
 		if l.ch == '"' {
 			l.readChar() // consume closing quote
 		}
@@ -396,11 +423,99 @@ func (l *Lexer) skipLineDirective() bool {
 	return true
 }
 
+// skipPragmaDirective skips a #pragma line passed through by the preprocessor.
+// Pragmas have no effect on code generation, so the whole line is ignored.
+func (l *Lexer) skipPragmaDirective() bool {
+	i := l.pos + 1
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	if !hasWordAt(l.input, i, "pragma") {
+		return false
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return true
+}
+
+// skipPragmaOperator skips the parenthesized string argument of a C99
+// _Pragma operator, whose identifier has already been read.
+// If no argument list follows, nothing is consumed and false is returned.
+func (l *Lexer) skipPragmaOperator() bool {
+	i := l.pos
+	for i < len(l.input) && isSpace(l.input[i]) {
+		i++
+	}
+	if i >= len(l.input) || l.input[i] != '(' {
+		return false
+	}
+	for l.pos < i {
+		l.readChar()
+	}
+
+	depth := 0
+	for l.ch != 0 {
+		switch l.ch {
+		case '"':
+			l.readString()
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				l.readChar()
+				return true
+			}
+		}
+		l.readChar()
+	}
+	return true
+}
+
+// hasWordAt reports whether word appears in s at index i and is not
+// followed by another identifier character.
+func hasWordAt(s string, i int, word string) bool {
+	if i+len(word) > len(s) || s[i:i+len(word)] != word {
+		return false
+	}
+	end := i + len(word)
+	return end == len(s) || !(isLetter(s[end]) || isDigit(s[end]))
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
 // Filename returns the current filename from #line directives
 func (l *Lexer) Filename() string {
 	return l.filename
 }
 
+// includedFile returns the current filename when line markers have left
+// the file being compiled, as inside an included header, and "" otherwise
+func (l *Lexer) includedFile() string {
+	if l.filename == l.mainFile {
+		return ""
+	}
+	return l.filename
+}
+
+// LineText returns the input line containing the given byte offset,
+// without its newline.
+func (l *Lexer) LineText(offset int) string {
+	if offset < 0 || offset > len(l.input) {
+		return ""
+	}
+	start := strings.LastIndexByte(l.input[:offset], '\n') + 1
+	end := len(l.input)
+	if i := strings.IndexByte(l.input[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	return l.input[start:end]
+}
+
 func (l *Lexer) readIdentifier() string {
 	pos := l.pos
 	for isLetter(l.ch) || isDigit(l.ch) {
@@ -422,8 +537,9 @@ func (l *Lexer) readNumber() string {
 				l.readChar()
 			}
 		} else if isDigit(l.ch) {
-			// Octal literal: 0...
-			for isOctalDigit(l.ch) {
+			// Octal literal: 0... The digits 8 and 9 are taken too, so
+			// that the parser rejects 09 rather than reading 0 9
+			for isDigit(l.ch) {
 				l.readChar()
 			}
 		}
@@ -457,6 +573,25 @@ func (l *Lexer) readString() string {
 	return str
 }
 
+// encodingPrefixLen returns the length of the encoding prefix (L, u, U or
+// u8) at the current position if a string or char literal follows it, and
+// 0 otherwise.
+func (l *Lexer) encodingPrefixLen() int {
+	n := 0
+	switch {
+	case l.ch == 'u' && l.peekChar() == '8':
+		n = 2
+	case l.ch == 'L' || l.ch == 'u' || l.ch == 'U':
+		n = 1
+	default:
+		return 0
+	}
+	if q := l.peekCharN(n); q == '"' || q == '\'' {
+		return n
+	}
+	return 0
+}
+
 func (l *Lexer) readCharLiteral() string {
 	l.readChar() // consume opening quote
 	pos := l.pos
@@ -482,7 +617,3 @@ func isDigit(ch byte) bool {
 func isHexDigit(ch byte) bool {
 	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
 }
-
-func isOctalDigit(ch byte) bool {
-	return '0' <= ch && ch <= '7'
-}
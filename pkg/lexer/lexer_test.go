@@ -180,6 +180,22 @@ func TestLineDirective(t *testing.T) {
 	}
 }
 
+func TestTokenFileFromLineMarkers(t *testing.T) {
+	// Preprocessor output entering and leaving an included header
+	input := "# 1 \"main.c\"\n# 1 \"h.h\" 1\nint\n# 2 \"main.c\" 2\nvoid"
+
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != TokenInt_ || tok.File != "h.h" || tok.Line != 1 {
+		t.Errorf("expected int at h.h:1, got %s at %q:%d", tok.Type, tok.File, tok.Line)
+	}
+	// Tokens of the file being compiled have no file of their own
+	tok = l.NextToken()
+	if tok.Type != TokenVoid || tok.File != "" || tok.Line != 2 {
+		t.Errorf("expected void at line 2 of the main file, got %s at %q:%d", tok.Type, tok.File, tok.Line)
+	}
+}
+
 func TestLineDirectiveDoesNotBreakCode(t *testing.T) {
 	// Ensure normal code with # in comments works
 	input := `int // # not a directive
@@ -289,6 +305,7 @@ func TestAttributeTokens(t *testing.T) {
 		{"__attribute__", TokenAttribute},
 		{"__asm", TokenAsm},
 		{"__asm__", TokenAsm},
+		{"__extension__", TokenExtension},
 	}
 
 	for _, tt := range tests {
@@ -323,6 +340,27 @@ func TestInlineTokens(t *testing.T) {
 	}
 }
 
+func TestTypeofTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TokenType
+	}{
+		{"typeof", TokenTypeof},
+		{"__typeof", TokenTypeof},
+		{"__typeof__", TokenTypeof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			tok := l.NextToken()
+			if tok.Type != tt.expected {
+				t.Errorf("expected %s for %q, got %s", tt.expected, tt.input, tok.Type)
+			}
+		})
+	}
+}
+
 func TestAttributeInContext(t *testing.T) {
 	input := `int foo(void) __attribute__((cold)) __asm("_foo");`
 
@@ -361,6 +399,39 @@ func TestAttributeInContext(t *testing.T) {
 	}
 }
 
+// A string argument is a single token, so the parentheses and commas in
+// it do not unbalance the parentheses of the attribute.
+func TestAttributeStringArgument(t *testing.T) {
+	input := `__attribute__((section("(.text), x")))`
+
+	expected := []struct {
+		Type    TokenType
+		Literal string
+	}{
+		{TokenAttribute, "__attribute__"},
+		{TokenLParen, "("},
+		{TokenLParen, "("},
+		{TokenIdent, "section"},
+		{TokenLParen, "("},
+		{TokenString, "(.text), x"},
+		{TokenRParen, ")"},
+		{TokenRParen, ")"},
+		{TokenRParen, ")"},
+		{TokenEOF, ""},
+	}
+
+	l := New(input)
+	for i, exp := range expected {
+		tok := l.NextToken()
+		if tok.Type != exp.Type {
+			t.Fatalf("token[%d]: expected type %s, got %s (literal: %q)", i, exp.Type, tok.Type, tok.Literal)
+		}
+		if tok.Literal != exp.Literal {
+			t.Fatalf("token[%d]: expected literal %q, got %q", i, exp.Literal, tok.Literal)
+		}
+	}
+}
+
 func TestCharLiteral(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -391,6 +462,43 @@ func TestCharLiteral(t *testing.T) {
 	}
 }
 
+func TestEncodingPrefixes(t *testing.T) {
+	tests := []struct {
+		input    string
+		typ      TokenType
+		literal  string
+		encoding string
+	}{
+		{`L"text"`, TokenString, "text", "L"},
+		{`u8"text"`, TokenString, "text", "u8"},
+		{`u"text"`, TokenString, "text", "u"},
+		{`U"text"`, TokenString, "text", "U"},
+		{`L'x'`, TokenCharLit, "x", "L"},
+		{`u'x'`, TokenCharLit, "x", "u"},
+		{`U'y'`, TokenCharLit, "y", "U"},
+		{`"text"`, TokenString, "text", ""},
+		// Identifiers that merely start with a prefix letter
+		{`L`, TokenIdent, "L", ""},
+		{`u8`, TokenIdent, "u8", ""},
+		{`Ux`, TokenIdent, "Ux", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tok := New(tt.input).NextToken()
+			if tok.Type != tt.typ {
+				t.Errorf("expected %s, got %s", tt.typ, tok.Type)
+			}
+			if tok.Literal != tt.literal {
+				t.Errorf("expected literal %q, got %q", tt.literal, tok.Literal)
+			}
+			if tok.Encoding != tt.encoding {
+				t.Errorf("expected encoding %q, got %q", tt.encoding, tok.Encoding)
+			}
+		})
+	}
+}
+
 func TestCharLiteralInContext(t *testing.T) {
 	input := `if (c == '\n') { x = 'x'; }`
 
@@ -468,3 +576,90 @@ func TestHexAndOctalLiterals(t *testing.T) {
 		})
 	}
 }
+
+func TestPragmaOperatorSkipped(t *testing.T) {
+	input := `_Pragma("GCC diagnostic ignored \"-Wunused\"") int x; _Pragma ( "once" ) x`
+
+	expected := []TokenType{TokenInt_, TokenIdent, TokenSemicolon, TokenIdent, TokenEOF}
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)", i, want, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestPragmaIdentifierWithoutArguments(t *testing.T) {
+	l := New(`_Pragma;`)
+	tok := l.NextToken()
+	if tok.Type != TokenIdent || tok.Literal != "_Pragma" {
+		t.Errorf("expected identifier _Pragma, got %q %q", tok.Type, tok.Literal)
+	}
+	if tok := l.NextToken(); tok.Type != TokenSemicolon {
+		t.Errorf("expected ;, got %q", tok.Type)
+	}
+}
+
+func TestPragmaDirectiveSkipped(t *testing.T) {
+	input := "#pragma GCC diagnostic push\nint x;\n  #  pragma pack(1)\nint y;\n"
+
+	expected := []struct {
+		typ  TokenType
+		line int
+	}{
+		{TokenInt_, 2},
+		{TokenIdent, 2},
+		{TokenSemicolon, 2},
+		{TokenInt_, 4},
+		{TokenIdent, 4},
+		{TokenSemicolon, 4},
+		{TokenEOF, 0},
+	}
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want.typ {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want.typ, tok.Type)
+		}
+		if want.line != 0 && tok.Line != want.line {
+			t.Errorf("tests[%d] - line wrong. expected=%d, got=%d", i, want.line, tok.Line)
+		}
+	}
+}
+
+func TestTokenLineText(t *testing.T) {
+	input := "int x;\n  return x + 1;\n"
+	l := New(input)
+	for i := 0; i < 3; i++ {
+		l.NextToken()
+	}
+	tok := l.NextToken()
+	if tok.Type != TokenReturn {
+		t.Fatalf("expected return, got %q", tok.Type)
+	}
+	if got := l.LineText(tok.Offset); got != "  return x + 1;" {
+		t.Errorf("expected the line of the return, got %q", got)
+	}
+}
+
+func TestUnterminatedLiteralAtEOF(t *testing.T) {
+	// An escape right before the end leaves the literal unterminated;
+	// it is returned as it stands and followed by EOF
+	for _, tt := range []struct {
+		input string
+		typ   TokenType
+	}{
+		{`"\`, TokenString},
+		{`'\`, TokenCharLit},
+		{`"abc`, TokenString},
+	} {
+		l := New(tt.input)
+		if tok := l.NextToken(); tok.Type != tt.typ {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.typ, tok.Type)
+		}
+		if tok := l.NextToken(); tok.Type != TokenEOF {
+			t.Errorf("%q: expected EOF, got %q", tt.input, tok.Type)
+		}
+	}
+}
@@ -51,6 +51,8 @@ const (
 	TokenSigned   // signed
 	TokenUnsigned // unsigned
 	TokenInline   // inline, __inline, __inline__
+	TokenTypeof   // typeof, __typeof, __typeof__
+	TokenExtension // __extension__
 
 	// Operators
 	TokenPlus      // +
@@ -150,6 +152,8 @@ var tokenNames = map[TokenType]string{
 	TokenSigned:        "signed",
 	TokenUnsigned:      "unsigned",
 	TokenInline:        "inline",
+	TokenTypeof:        "typeof",
+	TokenExtension:     "__extension__",
 	TokenPlus:          "+",
 	TokenMinus:         "-",
 	TokenStar:          "*",
@@ -207,10 +211,13 @@ func (t TokenType) String() string {
 
 // Token represents a lexical token
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type     TokenType
+	Literal  string
+	Encoding string // prefix of a string or char literal: "", "L", "u", "U" or "u8"
+	Line     int
+	Column   int
+	Offset   int    // byte offset of the token in the input
+	File     string // file named by a line marker when it is not the file being compiled, e.g. a header
 }
 
 // keywords maps keyword strings to token types
@@ -254,6 +261,10 @@ var keywords = map[string]TokenType{
 	"inline":     TokenInline,
 	"__inline":   TokenInline,
 	"__inline__": TokenInline,
+	"typeof":     TokenTypeof,
+	"__typeof":   TokenTypeof,
+	"__typeof__": TokenTypeof,
+	"__extension__": TokenExtension,
 }
 
 // LookupIdent returns the token type for an identifier (keyword or IDENT)
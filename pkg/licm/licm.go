@@ -0,0 +1,273 @@
+// Package licm implements loop-invariant code motion on RTL.
+// Natural loops are found from back edges in the dominator tree; pure
+// operations whose operands are not redefined inside a loop are moved
+// to a preheader node inserted in front of the loop header.
+package licm
+
+import (
+	"sort"
+
+	"github.com/raymyers/ralph-cc/pkg/optreport"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// Loop is a natural loop: a header and the set of nodes in its body
+// (header included).
+type Loop struct {
+	Header rtl.Node
+	Body   map[rtl.Node]bool
+}
+
+// FindLoops returns the natural loops of a function, one per header,
+// ordered innermost (smallest) first. Back edges sharing a header are merged.
+func FindLoops(fn *rtl.Function, dom *rtl.DomTree) []*Loop {
+	preds := rtl.Predecessors(fn)
+	byHeader := make(map[rtl.Node]*Loop)
+
+	for _, n := range rtl.ReversePostorder(fn) {
+		for _, h := range fn.Code[n].Successors() {
+			if !dom.Dominates(h, n) {
+				continue
+			}
+			loop, ok := byHeader[h]
+			if !ok {
+				loop = &Loop{Header: h, Body: map[rtl.Node]bool{h: true}}
+				byHeader[h] = loop
+			}
+			// Walk backwards from the latch until we reach the header
+			work := []rtl.Node{n}
+			for len(work) > 0 {
+				m := work[len(work)-1]
+				work = work[:len(work)-1]
+				if loop.Body[m] {
+					continue
+				}
+				loop.Body[m] = true
+				work = append(work, preds[m]...)
+			}
+		}
+	}
+
+	loops := make([]*Loop, 0, len(byHeader))
+	for _, l := range byHeader {
+		loops = append(loops, l)
+	}
+	sort.Slice(loops, func(i, j int) bool {
+		if len(loops[i].Body) != len(loops[j].Body) {
+			return len(loops[i].Body) < len(loops[j].Body)
+		}
+		return loops[i].Header < loops[j].Header
+	})
+	return loops
+}
+
+// TransformProgram applies LICM to every function of an RTL program,
+// counting the operations hoisted in report.
+func TransformProgram(prog *rtl.Program, report *optreport.Report) *rtl.Program {
+	for i := range prog.Functions {
+		fn := &prog.Functions[i]
+		report.Add(fn.Name, optreport.Hoisted, TransformFunction(fn))
+	}
+	return prog
+}
+
+// TransformFunction hoists loop-invariant operations in fn, in place, and
+// returns how many moves it made. Loops are re-discovered after every
+// successful hoist so that code moved out of an inner loop can continue
+// outwards through enclosing loops; each step outwards counts again.
+func TransformFunction(fn *rtl.Function) int {
+	total := 0
+	for {
+		hoisted := 0
+		for _, loop := range FindLoops(fn, rtl.ComputeDominators(fn)) {
+			if hoisted = hoistLoop(fn, loop); hoisted > 0 {
+				break
+			}
+		}
+		if hoisted == 0 {
+			return total
+		}
+		total += hoisted
+	}
+}
+
+// hoistLoop moves the invariant operations of one loop into a new
+// preheader. It returns the number of operations moved.
+func hoistLoop(fn *rtl.Function, loop *Loop) int {
+	defCount := countDefs(fn)
+	for _, p := range fn.Params {
+		defCount[p]++
+	}
+
+	// Registers defined somewhere in the loop body
+	definedInLoop := make(map[rtl.Reg]bool)
+	for n := range loop.Body {
+		for _, r := range definedRegs(fn.Code[n]) {
+			definedInLoop[r] = true
+		}
+	}
+
+	nodes := make([]rtl.Node, 0, len(loop.Body))
+	for n := range loop.Body {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] > nodes[j] })
+
+	// Iterate to a fixed point: hoisting one operation may make its
+	// users invariant too. Hoisted operations are kept in dependency order.
+	var hoisted []rtl.Iop
+	for changed := true; changed; {
+		changed = false
+		for _, n := range nodes {
+			op, ok := fn.Code[n].(rtl.Iop)
+			if !ok || !isHoistable(op, defCount, definedInLoop) {
+				continue
+			}
+			hoisted = append(hoisted, op)
+			delete(definedInLoop, op.Dest)
+			fn.Code[n] = rtl.Inop{Succ: op.Succ}
+			changed = true
+		}
+	}
+	if len(hoisted) == 0 {
+		return 0
+	}
+
+	// Build the preheader chain: hoisted ops in order, then the header
+	first := maxNode(fn) + 1
+	next := first
+	target := loop.Header
+	for i := len(hoisted) - 1; i >= 0; i-- {
+		op := hoisted[i]
+		op.Succ = target
+		fn.Code[next] = op
+		target = next
+		next++
+	}
+
+	// Redirect edges entering the loop from outside to the preheader
+	for n, instr := range fn.Code {
+		if loop.Body[n] || n >= first {
+			continue
+		}
+		fn.Code[n] = redirect(instr, loop.Header, target)
+	}
+	if fn.Entrypoint == loop.Header {
+		fn.Entrypoint = target
+	}
+	return len(hoisted)
+}
+
+// isHoistable reports whether op may be moved out of the loop: it must be
+// free of side effects and traps, be the only definition of its destination,
+// and read only registers that the loop never writes.
+func isHoistable(op rtl.Iop, defCount map[rtl.Reg]int, definedInLoop map[rtl.Reg]bool) bool {
+	if !isPure(op.Op) || defCount[op.Dest] != 1 {
+		return false
+	}
+	for _, a := range op.Args {
+		if definedInLoop[a] {
+			return false
+		}
+	}
+	return true
+}
+
+// isPure reports whether an operation can be executed speculatively.
+// Integer division and modulus are excluded since they may trap.
+func isPure(op rtl.Operation) bool {
+	switch op.(type) {
+	case rtl.Odiv, rtl.Odivu, rtl.Omod, rtl.Omodu,
+		rtl.Odivl, rtl.Odivlu, rtl.Omodl, rtl.Omodlu:
+		return false
+	}
+	return true
+}
+
+// countDefs counts how many instructions define each register.
+func countDefs(fn *rtl.Function) map[rtl.Reg]int {
+	counts := make(map[rtl.Reg]int)
+	for _, instr := range fn.Code {
+		for _, r := range definedRegs(instr) {
+			counts[r]++
+		}
+	}
+	return counts
+}
+
+// definedRegs returns the registers written by an instruction.
+func definedRegs(instr rtl.Instruction) []rtl.Reg {
+	switch i := instr.(type) {
+	case rtl.Iop:
+		return []rtl.Reg{i.Dest}
+	case rtl.Iload:
+		return []rtl.Reg{i.Dest}
+	case rtl.Icall:
+		var regs []rtl.Reg
+		if i.Dest != 0 {
+			regs = append(regs, i.Dest)
+		}
+		if i.DestHi != 0 {
+			regs = append(regs, i.DestHi)
+		}
+		return regs
+	case rtl.Ibuiltin:
+		if i.Dest != nil {
+			return []rtl.Reg{*i.Dest}
+		}
+	}
+	return nil
+}
+
+// maxNode returns the largest node identifier used in the function.
+func maxNode(fn *rtl.Function) rtl.Node {
+	var max rtl.Node
+	for n := range fn.Code {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// redirect rewrites every successor equal to from into to.
+func redirect(instr rtl.Instruction, from, to rtl.Node) rtl.Instruction {
+	swap := func(n rtl.Node) rtl.Node {
+		if n == from {
+			return to
+		}
+		return n
+	}
+	switch i := instr.(type) {
+	case rtl.Inop:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Iop:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Iload:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Istore:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Icall:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Ibuiltin:
+		i.Succ = swap(i.Succ)
+		return i
+	case rtl.Icond:
+		i.IfSo = swap(i.IfSo)
+		i.IfNot = swap(i.IfNot)
+		return i
+	case rtl.Ijumptable:
+		targets := make([]rtl.Node, len(i.Targets))
+		for k, t := range i.Targets {
+			targets[k] = swap(t)
+		}
+		i.Targets = targets
+		return i
+	}
+	return instr
+}
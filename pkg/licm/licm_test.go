@@ -0,0 +1,174 @@
+package licm
+
+import (
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// invariantLoop builds the RTL for
+//
+//	s = 0; i = 0; while (i < n) { t = a * b; s = s + t; i = i + 1; } return s;
+//
+// with a = x1, b = x2, n = x3, s = x4, i = x5, t = x6.
+func invariantLoop() *rtl.Function {
+	fn := rtl.NewFunction("f", rtl.Sig{})
+	fn.Params = []rtl.Reg{1, 2, 3}
+	s := rtl.Reg(4)
+	fn.Code[8] = rtl.Iop{Op: rtl.Ointconst{Value: 0}, Dest: 4, Succ: 7}
+	fn.Code[7] = rtl.Iop{Op: rtl.Ointconst{Value: 0}, Dest: 5, Succ: 6}
+	fn.Code[6] = rtl.Icond{Cond: rtl.Ccomp{Cond: rtl.Clt}, Args: []rtl.Reg{5, 3}, IfSo: 5, IfNot: 1}
+	fn.Code[5] = rtl.Iop{Op: rtl.Omul{}, Args: []rtl.Reg{1, 2}, Dest: 6, Succ: 4}
+	fn.Code[4] = rtl.Iop{Op: rtl.Oadd{}, Args: []rtl.Reg{4, 6}, Dest: 4, Succ: 3}
+	fn.Code[3] = rtl.Iop{Op: rtl.Oaddimm{N: 1}, Args: []rtl.Reg{5}, Dest: 5, Succ: 2}
+	fn.Code[2] = rtl.Inop{Succ: 6}
+	fn.Code[1] = rtl.Ireturn{Arg: &s}
+	fn.Entrypoint = 8
+	return fn
+}
+
+func TestFindLoops(t *testing.T) {
+	fn := invariantLoop()
+	loops := FindLoops(fn, rtl.ComputeDominators(fn))
+	if len(loops) != 1 {
+		t.Fatalf("expected 1 loop, got %d", len(loops))
+	}
+	loop := loops[0]
+	if loop.Header != 6 {
+		t.Errorf("expected header 6, got %d", loop.Header)
+	}
+	for _, n := range []rtl.Node{6, 5, 4, 3, 2} {
+		if !loop.Body[n] {
+			t.Errorf("expected node %d in loop body", n)
+		}
+	}
+	for _, n := range []rtl.Node{8, 7, 1} {
+		if loop.Body[n] {
+			t.Errorf("node %d should not be in loop body", n)
+		}
+	}
+}
+
+func TestFindLoopsNested(t *testing.T) {
+	fn := rtl.NewFunction("nested", rtl.Sig{})
+	fn.Code[6] = rtl.Icond{Cond: rtl.Ccompimm{Cond: rtl.Cne, N: 0}, Args: []rtl.Reg{1}, IfSo: 5, IfNot: 1}
+	fn.Code[5] = rtl.Icond{Cond: rtl.Ccompimm{Cond: rtl.Cne, N: 0}, Args: []rtl.Reg{2}, IfSo: 4, IfNot: 3}
+	fn.Code[4] = rtl.Inop{Succ: 5}
+	fn.Code[3] = rtl.Inop{Succ: 6}
+	fn.Code[1] = rtl.Ireturn{}
+	fn.Entrypoint = 6
+
+	loops := FindLoops(fn, rtl.ComputeDominators(fn))
+	if len(loops) != 2 {
+		t.Fatalf("expected 2 loops, got %d", len(loops))
+	}
+	if loops[0].Header != 5 || len(loops[0].Body) != 2 {
+		t.Errorf("expected inner loop first, got header %d with %d nodes", loops[0].Header, len(loops[0].Body))
+	}
+	if loops[1].Header != 6 || len(loops[1].Body) != 4 {
+		t.Errorf("expected outer loop second, got header %d with %d nodes", loops[1].Header, len(loops[1].Body))
+	}
+}
+
+func TestHoistInvariantMul(t *testing.T) {
+	fn := invariantLoop()
+	if n := TransformFunction(fn); n != 1 {
+		t.Errorf("expected 1 operation hoisted, got %d", n)
+	}
+
+	// The multiply is replaced by a nop inside the loop
+	if _, ok := fn.Code[5].(rtl.Inop); !ok {
+		t.Fatalf("expected node 5 to become nop, got %T", fn.Code[5])
+	}
+
+	// The node before the loop now reaches the header through the preheader
+	pre, ok := fn.Code[7].(rtl.Iop)
+	if !ok {
+		t.Fatalf("expected node 7 to remain an op, got %T", fn.Code[7])
+	}
+	if pre.Succ == 6 {
+		t.Fatal("expected entry edge to be redirected to a preheader")
+	}
+	hoisted, ok := fn.Code[pre.Succ].(rtl.Iop)
+	if !ok {
+		t.Fatalf("expected preheader op, got %T", fn.Code[pre.Succ])
+	}
+	if _, ok := hoisted.Op.(rtl.Omul); !ok {
+		t.Errorf("expected hoisted mul, got %T", hoisted.Op)
+	}
+	if hoisted.Succ != 6 {
+		t.Errorf("preheader should branch to header 6, got %d", hoisted.Succ)
+	}
+	if hoisted.Dest != 6 {
+		t.Errorf("hoisted mul should keep destination x6, got x%d", hoisted.Dest)
+	}
+
+	// The back edge still targets the header
+	if latch := fn.Code[2].(rtl.Inop); latch.Succ != 6 {
+		t.Errorf("back edge should target header, got %d", latch.Succ)
+	}
+}
+
+func TestNoHoistOfVariantOps(t *testing.T) {
+	fn := invariantLoop()
+	TransformFunction(fn)
+
+	// s = s + t and i = i + 1 depend on values changing every iteration
+	if _, ok := fn.Code[4].(rtl.Iop); !ok {
+		t.Errorf("accumulator update should stay in the loop, got %T", fn.Code[4])
+	}
+	if _, ok := fn.Code[3].(rtl.Iop); !ok {
+		t.Errorf("induction update should stay in the loop, got %T", fn.Code[3])
+	}
+}
+
+func TestNoHoistOfDivision(t *testing.T) {
+	fn := invariantLoop()
+	fn.Code[5] = rtl.Iop{Op: rtl.Odiv{}, Args: []rtl.Reg{1, 2}, Dest: 6, Succ: 4}
+	TransformFunction(fn)
+
+	if _, ok := fn.Code[5].(rtl.Iop); !ok {
+		t.Errorf("division may trap and should not be hoisted, got %T", fn.Code[5])
+	}
+}
+
+func TestHoistChainOfInvariants(t *testing.T) {
+	fn := invariantLoop()
+	// t = (a * b) + 3, computed in two steps inside the loop
+	fn.Code[5] = rtl.Iop{Op: rtl.Omul{}, Args: []rtl.Reg{1, 2}, Dest: 7, Succ: 9}
+	fn.Code[9] = rtl.Iop{Op: rtl.Oaddimm{N: 3}, Args: []rtl.Reg{7}, Dest: 6, Succ: 4}
+	TransformFunction(fn)
+
+	if _, ok := fn.Code[5].(rtl.Inop); !ok {
+		t.Errorf("expected mul hoisted, got %T", fn.Code[5])
+	}
+	if _, ok := fn.Code[9].(rtl.Inop); !ok {
+		t.Errorf("expected dependent addimm hoisted, got %T", fn.Code[9])
+	}
+
+	// Preheader must compute the mul before the addimm
+	first := fn.Code[fn.Code[7].(rtl.Iop).Succ].(rtl.Iop)
+	if _, ok := first.Op.(rtl.Omul); !ok {
+		t.Fatalf("expected mul first in preheader, got %T", first.Op)
+	}
+	second := fn.Code[first.Succ].(rtl.Iop)
+	if _, ok := second.Op.(rtl.Oaddimm); !ok {
+		t.Errorf("expected addimm second in preheader, got %T", second.Op)
+	}
+}
+
+func TestHoistWhenHeaderIsEntry(t *testing.T) {
+	fn := rtl.NewFunction("spin", rtl.Sig{})
+	fn.Params = []rtl.Reg{1}
+	fn.Code[3] = rtl.Iop{Op: rtl.Oaddimm{N: 5}, Args: []rtl.Reg{1}, Dest: 2, Succ: 2}
+	fn.Code[2] = rtl.Istore{Chunk: rtl.Mint32, Addr: rtl.Aindexed{Offset: 0}, Args: []rtl.Reg{1}, Src: 2, Succ: 3}
+	fn.Entrypoint = 3
+	TransformFunction(fn)
+
+	if fn.Entrypoint == 3 {
+		t.Fatal("expected entry point to move to the preheader")
+	}
+	if op, ok := fn.Code[fn.Entrypoint].(rtl.Iop); !ok || op.Succ != 3 {
+		t.Errorf("expected preheader op branching to 3, got %#v", fn.Code[fn.Entrypoint])
+	}
+}
@@ -94,18 +94,20 @@ type Lop struct {
 
 // Lload loads from memory: dest = Mem[addr(args...)]
 type Lload struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []Loc          // locations for addressing
-	Dest  Loc            // destination location
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []Loc          // locations for addressing
+	Dest     Loc            // destination location
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Lstore stores to memory: Mem[addr(args...)] = src
 type Lstore struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []Loc          // locations for addressing
-	Src   Loc            // source location (value to store)
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []Loc          // locations for addressing
+	Src      Loc            // source location (value to store)
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Lcall performs a function call
@@ -197,7 +199,9 @@ type Function struct {
 	Sig       Sig           // function signature
 	Params    []Loc         // parameter locations (after register allocation)
 	Stacksize int64         // stack frame size
+	StackData int64         // bytes of stack-allocated variables, addressed by Oaddrstack and Ainstack
 	Code      []Instruction // linear instruction sequence
+	Static    bool          // not visible outside the translation unit
 }
 
 // GlobVar represents a global variable
@@ -206,6 +210,7 @@ type GlobVar struct {
 	Size     int64
 	Init     []byte
 	ReadOnly bool // true for .rodata section (e.g., string literals)
+	Static   bool // not visible outside the translation unit
 }
 
 // Program represents a complete Linear program
@@ -192,6 +192,10 @@ func (p *Printer) printOperation(op Operation) {
 		fmt.Fprint(p.w, "mul")
 	case rtl.Omulimm:
 		fmt.Fprintf(p.w, "mulimm %d", o.N)
+	case rtl.Omulhs:
+		fmt.Fprint(p.w, "mulhs")
+	case rtl.Omulhu:
+		fmt.Fprint(p.w, "mulhu")
 	case rtl.Odiv:
 		fmt.Fprint(p.w, "div")
 	case rtl.Odivu:
@@ -11,8 +11,13 @@ import (
 	"github.com/raymyers/ralph-cc/pkg/rtl"
 )
 
-// knownVariadicFuncs lists known variadic C library functions.
-// On macOS ARM64, variadic arguments must be passed on the stack.
+// stackVarArgs reports whether variable arguments are passed on the stack.
+// Apple's ARM64 ABI does so; standard AAPCS64 passes them like named
+// arguments, in registers first.
+var stackVarArgs = runtime.GOOS == "darwin"
+
+// knownVariadicFuncs lists known variadic C library functions, for calls
+// made without a prototype in scope.
 var knownVariadicFuncs = map[string]int{
 	// printf family - first arg is format string in x0, rest on stack
 	"printf":   1, // 1 fixed arg (format)
@@ -51,6 +56,7 @@ func TransformProgram(prog *ltl.Program) *linear.Program {
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		}
 	}
 
@@ -98,7 +104,9 @@ type linearizer struct {
 func (l *linearizer) linearize() *linear.Function {
 	result := linear.NewFunction(l.fn.Name, l.fn.Sig)
 	result.Stacksize = l.fn.Stacksize
+	result.StackData = l.fn.StackData
 	result.Params = l.fn.Params // Propagate parameter locations
+	result.Static = l.fn.Static
 
 	if len(l.fn.Code) == 0 {
 		return result
@@ -231,9 +239,9 @@ func (l *linearizer) convertInstruction(inst ltl.Instruction) []linear.Instructi
 	case ltl.Lop:
 		return []linear.Instruction{linear.Lop{Op: i.Op, Args: i.Args, Dest: i.Dest}}
 	case ltl.Lload:
-		return []linear.Instruction{linear.Lload{Chunk: i.Chunk, Addr: i.Addr, Args: i.Args, Dest: i.Dest}}
+		return []linear.Instruction{linear.Lload{Chunk: i.Chunk, Addr: i.Addr, Args: i.Args, Dest: i.Dest, Volatile: i.Volatile}}
 	case ltl.Lstore:
-		return []linear.Instruction{linear.Lstore{Chunk: i.Chunk, Addr: i.Addr, Args: i.Args, Src: i.Src}}
+		return []linear.Instruction{linear.Lstore{Chunk: i.Chunk, Addr: i.Addr, Args: i.Args, Src: i.Src, Volatile: i.Volatile}}
 	case ltl.Lcall:
 		// Generate moves to place arguments in X0, X1, X2, ... before the call
 		return l.convertCall(i)
@@ -248,14 +256,43 @@ func (l *linearizer) convertInstruction(inst ltl.Instruction) []linear.Instructi
 // IntArgRegs are the argument registers for ARM64 calling convention
 var intArgRegs = []ltl.MReg{ltl.X0, ltl.X1, ltl.X2, ltl.X3, ltl.X4, ltl.X5, ltl.X6, ltl.X7}
 
+// resultPtrReg carries the hidden result pointer of an Sret call (AAPCS64
+// indirect result location register)
+const resultPtrReg = ltl.X8
+
 // tempReg is a scratch register used for parallel moves
-// X8 is caller-saved and not used for arguments
-const tempReg = ltl.X8
+// X17 (IP1) is not allocated and not used for arguments
+const tempReg = ltl.X17
+
+// funcPtrReg holds the function pointer of an indirect call during the
+// argument moves. X16 (IP0) is not allocated and not used for arguments.
+const funcPtrReg = ltl.X16
+
+// isSafeFuncPtrLoc reports whether a function pointer in loc survives the
+// argument moves of a call: it is in a register that is neither an
+// argument register, the result pointer register nor the move scratch
+// register.
+func isSafeFuncPtrLoc(loc ltl.Loc) bool {
+	r, ok := loc.(ltl.R)
+	if !ok || r.Reg == tempReg || r.Reg == resultPtrReg {
+		return false
+	}
+	for _, arg := range intArgRegs {
+		if r.Reg == arg {
+			return false
+		}
+	}
+	return true
+}
 
-// isVariadicCall checks if a function call is to a known variadic function
-// and returns the number of fixed arguments (0 if not variadic)
-func isVariadicCall(fn ltl.FunRef) (bool, int) {
-	switch f := fn.(type) {
+// isVariadicCall checks if a function call is to a variadic function and
+// returns the number of fixed arguments (0 if not variadic). The call's
+// signature is used when it has one, otherwise the known library functions.
+func isVariadicCall(call ltl.Lcall) (bool, int) {
+	if call.Sig.VarArg {
+		return true, len(call.Sig.Args)
+	}
+	switch f := call.Fn.(type) {
 	case ltl.FunSymbol:
 		if fixedArgs, known := knownVariadicFuncs[f.Name]; known {
 			return true, fixedArgs
@@ -270,23 +307,36 @@ func isVariadicCall(fn ltl.FunRef) (bool, int) {
 // Handles the parallel move problem by using a temp register for cycles.
 //
 // On macOS ARM64, variadic arguments must be passed on the stack, not in registers.
-// We detect known variadic functions and generate stack stores for their varargs.
+// We detect variadic calls and generate stack stores for their varargs.
 func (l *linearizer) convertCall(call ltl.Lcall) []linear.Instruction {
 	// Check if this is a variadic call on macOS
-	isVariadic, fixedArgs := isVariadicCall(call.Fn)
-	useDarwinVariadicConvention := isVariadic && runtime.GOOS == "darwin"
+	isVariadic, fixedArgs := isVariadicCall(call)
+	useDarwinVariadicConvention := isVariadic && stackVarArgs
 
 	// Build a mapping from target register to source location
 	// moves[dest] = src means we need to do: dest = src
 	moves := make(map[ltl.MReg]ltl.Loc)
 
+	// The hidden result pointer of an Sret call goes in X8 and the
+	// remaining arguments are numbered without it
+	args := call.Args
+	if call.Sig.Sret && len(args) > 0 {
+		if regLoc, ok := args[0].(ltl.R); !ok || regLoc.Reg != resultPtrReg {
+			moves[resultPtrReg] = args[0]
+		}
+		args = args[1:]
+		if isVariadic {
+			fixedArgs--
+		}
+	}
+
 	// For variadic on macOS: only fixed args go in registers
 	maxRegArgs := len(intArgRegs)
 	if useDarwinVariadicConvention && fixedArgs < maxRegArgs {
 		maxRegArgs = fixedArgs
 	}
 
-	for i, argLoc := range call.Args {
+	for i, argLoc := range args {
 		if i >= maxRegArgs {
 			// Arguments beyond register limit go on the stack
 			break
@@ -304,17 +354,29 @@ func (l *linearizer) convertCall(call ltl.Lcall) []linear.Instruction {
 	// Generate moves using a simple algorithm that handles cycles
 	var result []linear.Instruction
 
+	// The argument moves may overwrite the register holding the function
+	// pointer of an indirect call, so it is first moved to funcPtrReg
+	fn := l.convertFunRef(call.Fn)
+	if fr, ok := call.Fn.(ltl.FunReg); ok && !isSafeFuncPtrLoc(fr.Loc) {
+		result = append(result, linear.Lop{
+			Op:   rtl.Omove{},
+			Args: []ltl.Loc{fr.Loc},
+			Dest: ltl.R{Reg: funcPtrReg},
+		})
+		fn = linear.FunReg{Loc: ltl.R{Reg: funcPtrReg}}
+	}
+
 	// Store overflow arguments on the stack (for both variadic and non-variadic calls)
 	overflowStart := maxRegArgs
 	if useDarwinVariadicConvention {
 		overflowStart = fixedArgs
 	}
-	if len(call.Args) > overflowStart {
+	if len(args) > overflowStart {
 		// Store each overflow argument on the stack at [SP + offset]
 		// Each argument takes 8 bytes (padded)
-		for i := overflowStart; i < len(call.Args); i++ {
+		for i := overflowStart; i < len(args); i++ {
 			stackOfs := int64((i - overflowStart) * 8)
-			argLoc := call.Args[i]
+			argLoc := args[i]
 
 			// Lsetstack requires an MReg source, so ensure arg is in a register
 			var srcReg ltl.MReg
@@ -417,7 +479,7 @@ func (l *linearizer) convertCall(call ltl.Lcall) []linear.Instruction {
 	}
 
 	// Add the call instruction
-	result = append(result, linear.Lcall{Sig: call.Sig, Fn: l.convertFunRef(call.Fn)})
+	result = append(result, linear.Lcall{Sig: call.Sig, Fn: fn})
 
 	return result
 }
@@ -1,6 +1,7 @@
 package linearize
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/linear"
@@ -285,6 +286,148 @@ func TestLinearizeFunctionCall(t *testing.T) {
 	}
 }
 
+func TestLinearizeIndirectCall(t *testing.T) {
+	fn := ltl.NewFunction("caller", ltl.Sig{Return: "int"})
+	fn.Entrypoint = 1
+
+	// The function pointer is in X0, which the argument in X1 moves to
+	fn.Code[1] = &ltl.BBlock{
+		Body: []ltl.Instruction{
+			ltl.Lcall{Sig: ltl.Sig{Return: "int"}, Fn: ltl.FunReg{Loc: ltl.R{Reg: ltl.X0}}, Args: []ltl.Loc{ltl.R{Reg: ltl.X1}}},
+			ltl.Lreturn{},
+		},
+	}
+
+	result := Linearize(fn)
+
+	var code []linear.Instruction
+	for _, inst := range result.Code {
+		if _, ok := inst.(linear.Llabel); !ok {
+			code = append(code, inst)
+		}
+	}
+	want := []linear.Instruction{
+		linear.Lop{Op: rtl.Omove{}, Args: []ltl.Loc{ltl.R{Reg: ltl.X0}}, Dest: ltl.R{Reg: ltl.X16}},
+		linear.Lop{Op: rtl.Omove{}, Args: []ltl.Loc{ltl.R{Reg: ltl.X1}}, Dest: ltl.R{Reg: ltl.X0}},
+		linear.Lcall{Sig: ltl.Sig{Return: "int"}, Fn: linear.FunReg{Loc: ltl.R{Reg: ltl.X16}}},
+	}
+	if len(code) < len(want) || !reflect.DeepEqual(code[:len(want)], want) {
+		t.Errorf("expected the function pointer saved before the argument moves, got %v", code)
+	}
+}
+
+func TestLinearizeSretCall(t *testing.T) {
+	fn := ltl.NewFunction("caller", ltl.Sig{})
+	fn.Entrypoint = 1
+
+	// The result pointer is in X0, which the argument in X1 moves to
+	sig := ltl.Sig{Sret: true}
+	fn.Code[1] = &ltl.BBlock{
+		Body: []ltl.Instruction{
+			ltl.Lcall{Sig: sig, Fn: ltl.FunSymbol{Name: "mk"}, Args: []ltl.Loc{ltl.R{Reg: ltl.X0}, ltl.R{Reg: ltl.X1}}},
+			ltl.Lreturn{},
+		},
+	}
+
+	result := Linearize(fn)
+
+	var code []linear.Instruction
+	for _, inst := range result.Code {
+		if _, ok := inst.(linear.Llabel); !ok {
+			code = append(code, inst)
+		}
+	}
+	want := []linear.Instruction{
+		linear.Lop{Op: rtl.Omove{}, Args: []ltl.Loc{ltl.R{Reg: ltl.X0}}, Dest: ltl.R{Reg: ltl.X8}},
+		linear.Lop{Op: rtl.Omove{}, Args: []ltl.Loc{ltl.R{Reg: ltl.X1}}, Dest: ltl.R{Reg: ltl.X0}},
+		linear.Lcall{Sig: sig, Fn: linear.FunSymbol{Name: "mk"}},
+	}
+	if len(code) < len(want) || !reflect.DeepEqual(code[:len(want)], want) {
+		t.Errorf("expected the result pointer in X8 and the argument in X0, got %v", code)
+	}
+}
+
+func TestLinearizeVariadicCall(t *testing.T) {
+	regs := func(rs ...ltl.MReg) []ltl.Loc {
+		locs := make([]ltl.Loc, len(rs))
+		for i, r := range rs {
+			locs[i] = ltl.R{Reg: r}
+		}
+		return locs
+	}
+	tests := []struct {
+		name       string
+		stack      bool
+		call       ltl.Lcall
+		wantStores int
+	}{
+		{
+			name:       "prototyped, one named, varargs on the stack",
+			stack:      true,
+			call:       ltl.Lcall{Sig: ltl.Sig{Args: []string{"int"}, VarArg: true}, Fn: ltl.FunSymbol{Name: "logf"}, Args: regs(ltl.X20, ltl.X21, ltl.X22)},
+			wantStores: 2,
+		},
+		{
+			name:       "prototyped, two named, no varargs",
+			stack:      true,
+			call:       ltl.Lcall{Sig: ltl.Sig{Args: []string{"int", "int"}, VarArg: true}, Fn: ltl.FunSymbol{Name: "logf"}, Args: regs(ltl.X20, ltl.X21)},
+			wantStores: 0,
+		},
+		{
+			name:       "known library function without a prototype",
+			stack:      true,
+			call:       ltl.Lcall{Fn: ltl.FunSymbol{Name: "printf"}, Args: regs(ltl.X20, ltl.X21)},
+			wantStores: 1,
+		},
+		{
+			name:       "standard AAPCS64 passes varargs in registers",
+			stack:      false,
+			call:       ltl.Lcall{Sig: ltl.Sig{Args: []string{"int"}, VarArg: true}, Fn: ltl.FunSymbol{Name: "logf"}, Args: regs(ltl.X20, ltl.X21, ltl.X22)},
+			wantStores: 0,
+		},
+	}
+
+	saved := stackVarArgs
+	defer func() { stackVarArgs = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackVarArgs = tt.stack
+			fn := ltl.NewFunction("caller", ltl.Sig{})
+			fn.Entrypoint = 1
+			fn.Code[1] = &ltl.BBlock{Body: []ltl.Instruction{tt.call, ltl.Lreturn{}}}
+
+			result := Linearize(fn)
+
+			var stores []linear.Lsetstack
+			moves := map[ltl.MReg]bool{}
+			for _, inst := range result.Code {
+				switch i := inst.(type) {
+				case linear.Lsetstack:
+					stores = append(stores, i)
+				case linear.Lop:
+					if dest, ok := i.Dest.(ltl.R); ok {
+						moves[dest.Reg] = true
+					}
+				}
+			}
+			if len(stores) != tt.wantStores {
+				t.Fatalf("expected %d outgoing stores, got %d", tt.wantStores, len(stores))
+			}
+			for i, st := range stores {
+				if st.Slot != ltl.SlotOutgoing || st.Ofs != int64(i*8) {
+					t.Errorf("store %d: expected outgoing slot at %d, got %v at %d", i, i*8, st.Slot, st.Ofs)
+				}
+			}
+			// The named arguments are always passed in registers
+			for i := 0; i < len(tt.call.Args)-tt.wantStores; i++ {
+				if !moves[intArgRegs[i]] {
+					t.Errorf("expected argument %d moved to %v", i, intArgRegs[i])
+				}
+			}
+		})
+	}
+}
+
 func TestLinearizeTailcall(t *testing.T) {
 	fn := ltl.NewFunction("tailcaller", ltl.Sig{Return: "int"})
 	fn.Entrypoint = 1
@@ -219,6 +219,10 @@ func (p *Printer) printOperation(op Operation) {
 		fmt.Fprint(p.w, "Omul")
 	case rtl.Omulimm:
 		fmt.Fprintf(p.w, "Omulimm(%d)", o.N)
+	case rtl.Omulhs:
+		fmt.Fprint(p.w, "Omulhs")
+	case rtl.Omulhu:
+		fmt.Fprint(p.w, "Omulhu")
 	case rtl.Odiv:
 		fmt.Fprint(p.w, "Odiv")
 	case rtl.Odivu:
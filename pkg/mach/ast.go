@@ -67,11 +67,70 @@ const (
 	X6  = ltl.X6
 	X7  = ltl.X7
 	X8  = ltl.X8
+	X16 = ltl.X16 // IP0, never allocated
+	X17 = ltl.X17 // IP1, never allocated
 	X29 = ltl.X29 // FP
 	X30 = ltl.X30 // LR
 	D0  = ltl.D0
 )
 
+// NeedsScratch reports whether the assembly of op holds an intermediate
+// result in a scratch register: the constant of a multiplication by an
+// immediate, or the quotient of a remainder.
+func NeedsScratch(op Operation) bool {
+	switch op.(type) {
+	case rtl.Omulimm, rtl.Omod, rtl.Omodu, rtl.Omodl, rtl.Omodlu:
+		return true
+	}
+	return false
+}
+
+// ScratchReg returns the scratch register of an operation on args, see
+// NeedsScratch: X16, or X17 when an argument is in X16. Neither is ever
+// allocated, so the scratch holds no live value other than the spilled
+// arguments that stacking reloads into them. An operation whose arguments
+// are in both has no scratch; stacking never emits one.
+func ScratchReg(args []MReg) MReg {
+	for _, a := range args {
+		if a == X16 {
+			return X17
+		}
+	}
+	return X16
+}
+
+// NeedsAddressScratch reports whether the assembly of an access of chunk
+// through addr computes the address in a scratch register: a global, or a
+// register-indexed access that the register offset form cannot encode.
+// Only word and doubleword accesses have that form, with a shift of 0 or
+// the log2 of the access size.
+func NeedsAddressScratch(addr AddressingMode, chunk Chunk) bool {
+	switch a := addr.(type) {
+	case rtl.Aglobal:
+		return true
+	case rtl.Aindexed2:
+		return chunk != Mint32 && chunk != Mint64
+	case rtl.Aindexed2shift:
+		switch chunk {
+		case Mint32:
+			return a.Shift != 0 && a.Shift != 2
+		case Mint64:
+			return a.Shift != 0 && a.Shift != 3
+		}
+		return true
+	}
+	return false
+}
+
+// AddressScratchReg returns the address scratch of an Mload or Mstore, see
+// NeedsAddressScratch: X16, or X17 for a store of X16.
+func AddressScratchReg(access Instruction) MReg {
+	if st, ok := access.(Mstore); ok && st.Src == X16 {
+		return X17
+	}
+	return X16
+}
+
 // Re-export typ constants
 const (
 	Tint    = ltl.Tint
@@ -130,18 +189,20 @@ type Mop struct {
 
 // Mload loads from memory: dest = Mem[addr(args...)]
 type Mload struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []MReg         // registers for addressing
-	Dest  MReg           // destination register
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []MReg         // registers for addressing
+	Dest     MReg           // destination register
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Mstore stores to memory: Mem[addr(args...)] = src
 type Mstore struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []MReg         // registers for addressing
-	Src   MReg           // source register (value to store)
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []MReg         // registers for addressing
+	Src      MReg           // source register (value to store)
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Mcall performs a function call
@@ -182,7 +243,7 @@ type Mcond struct {
 
 // Mjumptable is an indexed jump (switch)
 type Mjumptable struct {
-	Arg     MReg    // register containing index
+	Arg     MReg    // register containing index, an int
 	Targets []Label // jump targets
 }
 
@@ -229,12 +290,22 @@ func (FunSymbol) implFunRef() {}
 
 // Function represents a Mach function with concrete stack layout
 type Function struct {
-	Name            string        // function name
-	Sig             Sig           // function signature
-	Code            []Instruction // mach instruction sequence
-	Stacksize       int64         // total stack frame size
-	CalleeSaveRegs  []MReg        // callee-saved registers used
-	UsesFramePtr    bool          // whether function uses frame pointer
+	Name           string        // function name
+	Sig            Sig           // function signature
+	Code           []Instruction // mach instruction sequence
+	Stacksize      int64         // total stack frame size
+	CalleeSaveRegs []MReg        // callee-saved registers used
+	UsesFramePtr   bool          // whether function uses frame pointer
+	VarArgs        *VarArgs      // argument register save area, nil unless va_start is used
+	Static         bool          // not visible outside the translation unit
+}
+
+// VarArgs describes where a variadic function saves its argument registers
+// on entry, which va_start needs to locate the variable arguments.
+type VarArgs struct {
+	SaveOfs    int64 // FP-relative offset of the saved X0-X7
+	NamedRegs  int   // argument registers holding named parameters
+	NamedStack int64 // bytes of named parameters passed on the stack
 }
 
 // GlobVar represents a global variable
@@ -243,6 +314,7 @@ type GlobVar struct {
 	Size     int64
 	Init     []byte
 	ReadOnly bool // true for .rodata section (e.g., string literals)
+	Static   bool // not visible outside the translation unit
 }
 
 // Program represents a complete Mach program
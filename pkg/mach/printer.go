@@ -154,6 +154,10 @@ func operationName(op Operation) string {
 		return "sub"
 	case rtl.Omul:
 		return "mul"
+	case rtl.Omulhs:
+		return "mulhs"
+	case rtl.Omulhu:
+		return "mulhu"
 	case rtl.Odiv:
 		return "div"
 	case rtl.Odivu:
@@ -329,8 +333,12 @@ func (p *Printer) condString(cond ConditionCode) string {
 		return fmt.Sprintf("cmpluimm%s(%d)", conditionString(c.Cond), c.N)
 	case rtl.Ccompf:
 		return fmt.Sprintf("cmpf%s", conditionString(c.Cond))
+	case rtl.Cnotcompf:
+		return fmt.Sprintf("notcmpf%s", conditionString(c.Cond))
 	case rtl.Ccomps:
 		return fmt.Sprintf("cmps%s", conditionString(c.Cond))
+	case rtl.Cnotcomps:
+		return fmt.Sprintf("notcmps%s", conditionString(c.Cond))
 	default:
 		return fmt.Sprintf("%T", cond)
 	}
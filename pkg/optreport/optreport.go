@@ -0,0 +1,117 @@
+// Package optreport collects what the optimization passes did to each
+// function of a program, for --opt-report. A nil *Report is valid and
+// records nothing, so passes count unconditionally and the report costs
+// nothing when it is not asked for.
+package optreport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Event is a kind of change an optimization pass makes to a function
+type Event int
+
+const (
+	Folded      Event = iota // an operation on constants evaluated at compile time
+	DivByConst               // a division by a constant turned into a multiplication
+	Hoisted                  // a loop-invariant operation moved out of its loop
+	Rescheduled              // an instruction moved by the scheduler
+	numEvents
+)
+
+// eventNames gives the singular and plural descriptions of each event
+var eventNames = [numEvents][2]string{
+	Folded:      {"constant folded", "constants folded"},
+	DivByConst:  {"division by a constant strength-reduced", "divisions by constants strength-reduced"},
+	Hoisted:     {"loop invariant hoisted", "loop invariants hoisted"},
+	Rescheduled: {"instruction rescheduled", "instructions rescheduled"},
+}
+
+// Report accumulates the events of the passes of one compile
+type Report struct {
+	funcs   []string // functions with events, in the order first counted
+	counts  map[string]*[numEvents]int
+	removed []string // functions dropped as unused
+}
+
+// New creates an empty report
+func New() *Report {
+	return &Report{counts: make(map[string]*[numEvents]int)}
+}
+
+// Add records n events of kind e in function fn
+func (r *Report) Add(fn string, e Event, n int) {
+	if r == nil || n == 0 {
+		return
+	}
+	c, ok := r.counts[fn]
+	if !ok {
+		c = new([numEvents]int)
+		r.counts[fn] = c
+		r.funcs = append(r.funcs, fn)
+	}
+	c[e] += n
+}
+
+// Remove records that function fn was dropped as unused
+func (r *Report) Remove(fn string) {
+	if r == nil {
+		return
+	}
+	r.removed = append(r.removed, fn)
+}
+
+// Count returns the number of events of kind e recorded in function fn
+func (r *Report) Count(fn string, e Event) int {
+	if r == nil || r.counts[fn] == nil {
+		return 0
+	}
+	return r.counts[fn][e]
+}
+
+// Removed returns the functions dropped as unused, in the order removed
+func (r *Report) Removed() []string {
+	if r == nil {
+		return nil
+	}
+	return r.removed
+}
+
+// Print writes the report for the compile of filename, one line per
+// function that changed. Functions that were removed are listed on their
+// own line instead, as their code is gone.
+func (r *Report) Print(w io.Writer, filename string) {
+	fmt.Fprintf(w, "opt-report for %s:\n", filename)
+	gone := make(map[string]bool, len(r.removed))
+	for _, fn := range r.removed {
+		gone[fn] = true
+	}
+	lines := 0
+	for _, fn := range r.funcs {
+		if gone[fn] {
+			continue
+		}
+		var parts []string
+		for e, n := range r.counts[fn] {
+			if n == 0 {
+				continue
+			}
+			name := eventNames[e][1]
+			if n == 1 {
+				name = eventNames[e][0]
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, name))
+		}
+		fmt.Fprintf(w, "  %s: %s\n", fn, strings.Join(parts, ", "))
+		lines++
+	}
+	if len(r.removed) > 0 {
+		fmt.Fprintf(w, "  unused functions removed: %s\n", strings.Join(r.removed, ", "))
+		lines++
+	}
+	if lines == 0 {
+		fmt.Fprintln(w, "  nothing changed")
+	}
+}
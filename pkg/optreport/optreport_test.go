@@ -0,0 +1,46 @@
+package optreport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNilReportRecordsNothing(t *testing.T) {
+	var r *Report
+	r.Add("f", Folded, 3)
+	r.Remove("g")
+	if n := r.Count("f", Folded); n != 0 {
+		t.Errorf("expected 0, got %d", n)
+	}
+	if r.Removed() != nil {
+		t.Errorf("expected no removed functions, got %v", r.Removed())
+	}
+}
+
+func TestPrint(t *testing.T) {
+	r := New()
+	r.Add("g", Hoisted, 1)
+	r.Add("f", Folded, 2)
+	r.Add("g", Folded, 1)
+	r.Add("f", Rescheduled, 0)
+	r.Add("dead", Folded, 4)
+	r.Remove("dead")
+
+	var out bytes.Buffer
+	r.Print(&out, "t.c")
+	want := "opt-report for t.c:\n" +
+		"  g: 1 constant folded, 1 loop invariant hoisted\n" +
+		"  f: 2 constants folded\n" +
+		"  unused functions removed: dead\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestPrintEmpty(t *testing.T) {
+	var out bytes.Buffer
+	New().Print(&out, "t.c")
+	if want := "opt-report for t.c:\n  nothing changed\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -2,11 +2,14 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/raymyers/ralph-cc/pkg/cabs"
+	"github.com/raymyers/ralph-cc/pkg/diag"
 	"github.com/raymyers/ralph-cc/pkg/lexer"
 )
 
@@ -36,17 +39,32 @@ type Parser struct {
 	curToken      lexer.Token
 	peekToken     lexer.Token
 	peekPeekToken lexer.Token
-	errors        []string
-	typedefs      map[string]bool   // typedef names in scope
-	inlineDefs    []cabs.Definition // inline struct/union definitions collected during parsing
-	anonCounter   int               // counter for generating anonymous struct/union names
+	diags         *diag.Emitter
+	typedefs      map[string]bool     // typedef names in scope
+	typedefSpecs  map[string]string   // type specifiers of the file-scope typedefs, see sameType
+	prototypes    map[string]funcDecl // earlier declaration of each file-scope function
+	definitions   map[string]diag.Pos // position of each file-scope function or variable defined so far
+	enumConsts    map[string]int64    // values of the enumerators declared so far
+	scopes        []map[string]bool   // per enclosing block, the typedef names its declarations hide
+	inlineDefs    []cabs.Definition   // inline struct/union definitions collected during parsing
+	followingDefs []cabs.Definition   // further definitions of the current declaration: int a, b;
+	typeofOperand cabs.Expr           // operand of the last typeof(expr) type specifier, see takeTypeof
+	anonCounter   int                 // counter for generating anonymous struct/union names
+	annotate      bool                // precede statements with source line annotations
+	pedantic      bool                // warn about GNU extensions, see extension
+	annotLine     int                 // line of the last annotation
 }
 
 // New creates a new Parser for the given lexer
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:        l,
-		typedefs: make(map[string]bool),
+		l:            l,
+		diags:        diag.NewEmitter(diag.Options{}),
+		typedefs:     make(map[string]bool),
+		typedefSpecs: make(map[string]string),
+		prototypes:   make(map[string]funcDecl),
+		definitions:  make(map[string]diag.Pos),
+		enumConsts:   make(map[string]int64),
 	}
 	// Pre-register compiler built-in types that act as typedefs.
 	// __builtin_va_list is used by system headers (e.g., stdarg.h, stdio.h)
@@ -59,24 +77,76 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// SetAnnotate makes the parser precede each statement of a block with a
+// __builtin_annot call quoting its source line, so the line can be traced
+// to the generated assembly.
+func (p *Parser) SetAnnotate(annotate bool) {
+	p.annotate = annotate
+}
+
+// SetPedantic makes the parser warn about each use of a GNU extension, for
+// code meant to be strict ISO C.
+func (p *Parser) SetPedantic(pedantic bool) {
+	p.pedantic = pedantic
+}
+
+// extension reports the use of a GNU extension at tok under --pedantic.
+// Only the file being compiled is checked: the system headers it includes
+// rely on the extensions themselves.
+func (p *Parser) extension(tok lexer.Token, what string) {
+	if p.pedantic && tok.File == "" {
+		p.diags.Warnf(tokenPos(tok), "pedantic", "use of GNU %s extension", what)
+	}
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.peekPeekToken
 	p.peekPeekToken = p.l.NextToken()
+	// __extension__ only silences pedantic warnings about what follows,
+	// a declaration, statement or expression, so it is dropped wherever
+	// it appears
+	for p.peekPeekToken.Type == lexer.TokenExtension {
+		p.peekPeekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) peekPeekTokenIs(t lexer.TokenType) bool {
 	return p.peekPeekToken.Type == t
 }
 
-// Errors returns the list of parsing errors
+// SetEmitter makes the parser report its diagnostics to e, so they are
+// collected along with those of later passes under the same options.
+func (p *Parser) SetEmitter(e *diag.Emitter) {
+	p.diags = e
+}
+
+// Diagnostics returns the diagnostics reported while parsing
+func (p *Parser) Diagnostics() []diag.Diagnostic {
+	return p.diags.Diagnostics()
+}
+
+// Errors returns the parsing errors formatted as "line L, col C: message"
 func (p *Parser) Errors() []string {
-	return p.errors
+	var errs []string
+	for _, d := range p.diags.Errors() {
+		errs = append(errs, d.String())
+	}
+	return errs
 }
 
 func (p *Parser) addError(msg string) {
-	p.errors = append(p.errors, fmt.Sprintf("line %d, col %d: %s",
-		p.curToken.Line, p.curToken.Column, msg))
+	p.diags.Emit(diag.Diagnostic{
+		Severity: diag.Error,
+		Pos:      tokenPos(p.curToken),
+		Code:     "syntax",
+		Message:  msg,
+	})
+}
+
+// tokenPos returns the source position of a token
+func tokenPos(tok lexer.Token) diag.Pos {
+	return diag.Pos{File: tok.File, Line: tok.Line, Col: tok.Column}
 }
 
 func (p *Parser) curTokenIs(t lexer.TokenType) bool {
@@ -170,8 +240,9 @@ func (p *Parser) isStatementStart() bool {
 
 // ParseDefinition parses a top-level definition (function, typedef, struct, union, enum, or variable)
 func (p *Parser) ParseDefinition() cabs.Definition {
-	// Skip leading __attribute__ and __asm (GCC extensions before declarations)
-	p.skipAttributes()
+	// Leading __attribute__ and __asm (GCC extensions before declarations)
+	var attrs cabs.Attributes
+	p.parseAttributes(&attrs)
 
 	// Check for typedef
 	if p.curTokenIs(lexer.TokenTypedef) {
@@ -185,8 +256,9 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 		isUnion := p.curTokenIs(lexer.TokenUnion)
 		// Look ahead: struct { or struct Name { or struct Name ; = definition
 		// struct Name * or struct Name ident = function return type
-		if p.peekTokenIs(lexer.TokenLBrace) {
-			// Anonymous struct/union definition: struct { ... }
+		if p.peekTokenIs(lexer.TokenLBrace) || p.peekTokenIs(lexer.TokenAttribute) {
+			// Anonymous struct/union definition: struct { ... }, or one
+			// with attributes: struct __attribute__((packed)) Name { ... }
 			return p.parseStructOrUnion(isUnion)
 		}
 		if p.peekTokenIs(lexer.TokenIdent) {
@@ -207,45 +279,50 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 		return p.parseEnumDef()
 	}
 
-	// Capture storage class specifier (extern, static, etc.)
+	// Capture storage class (extern, static, etc.) and function (inline)
+	// specifiers, which may appear in any order
 	storageClass := ""
-	for p.isStorageClassSpecifier() {
+	inline := false
+	for p.isStorageClassSpecifier() || p.isFunctionSpecifier() {
 		if p.curTokenIs(lexer.TokenExtern) {
 			storageClass = "extern"
 		} else if p.curTokenIs(lexer.TokenStatic) {
 			storageClass = "static"
+		} else if p.isFunctionSpecifier() {
+			inline = true
 		}
 		p.nextToken()
 	}
 
-	// Skip function specifiers (inline, etc.)
-	for p.isFunctionSpecifier() {
-		p.nextToken()
-	}
+	// Any __attribute__ between specifiers and type
+	p.parseAttributes(&attrs)
 
-	// Skip any __attribute__ between specifiers and type
-	p.skipAttributes()
-
-	// Skip type qualifiers
-	for p.isTypeQualifier() {
-		p.nextToken()
-	}
+	// Type qualifiers before the base type (const char *p)
+	quals := cabs.Qualifiers{Base: p.parseTypeQualifiers()}
 
 	if !p.isTypeSpecifier() {
 		p.addError(fmt.Sprintf("expected type specifier, got %s", p.curToken.Type))
 		return nil
 	}
 
-	typeSpec := p.parseCompoundTypeSpecifier()
+	baseType := p.parseCompoundTypeSpecifier()
+	typeofOperand := p.takeTypeof(baseType)
 
-	// Handle pointer types with optional qualifiers
-	for p.curTokenIs(lexer.TokenStar) {
-		typeSpec = typeSpec + "*"
-		p.nextToken()
-		// Skip type qualifiers after pointer (const, volatile, restrict)
-		for p.isTypeQualifier() {
-			p.nextToken()
+	// Type qualifiers after the base type (char const *p), then pointer
+	// types with their own qualifiers (char *const p)
+	quals.Base = append(quals.Base, p.parseTypeQualifiers()...)
+	baseQuals := quals.Base
+	typeSpec := p.parsePointers(baseType, &quals)
+
+	// Function pointer variable: type (*name)(params), or an array of
+	// them: type (*name[N])(params)
+	if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
+		namePos := tokenPos(p.curToken)
+		typeSpec, name, dims, ok := p.parseFunctionPointerDeclarator(typeSpec)
+		if !ok {
+			return nil
 		}
+		return p.parseVarDef(storageClass, baseType, baseQuals, typeofOperand, typeSpec, quals, name, namePos, dims, attrs)
 	}
 
 	if !p.curTokenIs(lexer.TokenIdent) {
@@ -253,11 +330,13 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 		return nil
 	}
 	name := p.curToken.Literal
+	namePos := tokenPos(p.curToken)
 	p.nextToken()
 
 	// Check if this is a variable declaration (;, =, or [) vs function declaration (()
-	if p.curTokenIs(lexer.TokenSemicolon) || p.curTokenIs(lexer.TokenAssign) || p.curTokenIs(lexer.TokenLBracket) {
-		return p.parseVarDef(storageClass, typeSpec, name)
+	if p.curTokenIs(lexer.TokenSemicolon) || p.curTokenIs(lexer.TokenAssign) || p.curTokenIs(lexer.TokenLBracket) ||
+		p.curTokenIs(lexer.TokenAttribute) || p.curTokenIs(lexer.TokenComma) {
+		return p.parseVarDef(storageClass, baseType, baseQuals, typeofOperand, typeSpec, quals, name, namePos, nil, attrs)
 	}
 
 	// Parameter list for function
@@ -265,6 +344,8 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 		return nil
 	}
 
+	// int f() leaves the parameters unspecified, unlike int f(void)
+	unprototyped := p.curTokenIs(lexer.TokenRParen)
 	params, variadic := p.parseParameterList()
 
 	if !p.curTokenIs(lexer.TokenRParen) {
@@ -273,18 +354,26 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 	}
 	p.nextToken() // consume ')'
 
-	// Skip any __attribute__ or __asm constructs
-	p.skipAttributes()
+	// Any __attribute__ or __asm constructs
+	p.parseAttributes(&attrs)
+
+	p.declareFunction(funcDecl{name, typeSpec, params, variadic, unprototyped, namePos})
+	if p.curTokenIs(lexer.TokenLBrace) {
+		p.define(name, namePos)
+	}
 
 	// Function declaration (prototype) ends with semicolon
 	if p.curTokenIs(lexer.TokenSemicolon) {
 		p.nextToken() // consume ';'
 		return cabs.FunDef{
-			ReturnType: typeSpec,
-			Name:       name,
-			Params:     params,
-			Variadic:   variadic,
-			Body:       nil, // Declaration, no body
+			StorageClass: storageClass,
+			Inline:       inline,
+			ReturnType:   typeSpec,
+			Name:         name,
+			Params:       params,
+			Variadic:     variadic,
+			Body:         nil, // Declaration, no body
+			Attrs:        attrs,
 		}
 	}
 
@@ -293,45 +382,149 @@ func (p *Parser) ParseDefinition() cabs.Definition {
 		p.addError(fmt.Sprintf("expected '{' or ';', got %s", p.curToken.Type))
 		return nil
 	}
+	// Parameters share the scope of the body
+	p.openScope()
+	for _, param := range params {
+		p.declareOrdinary(param.Name)
+	}
 	body := p.parseBlock()
+	p.closeScope()
 
 	return cabs.FunDef{
-		ReturnType: typeSpec,
-		Name:       name,
-		Params:     params,
-		Variadic:   variadic,
-		Body:       body,
+		StorageClass: storageClass,
+		Inline:       inline,
+		ReturnType:   typeSpec,
+		Name:         name,
+		Params:       params,
+		Variadic:     variadic,
+		Body:         body,
+		Attrs:        attrs,
 	}
 }
 
-// parseVarDef parses a global/extern variable declaration
-// Called after type and name have been parsed
-func (p *Parser) parseVarDef(storageClass, typeSpec, name string) cabs.Definition {
-	var arrayDims []cabs.Expr
-	var initializer cabs.Expr
+// funcDecl is a file-scope function declaration or definition, as
+// checked against the later ones of the same function.
+type funcDecl struct {
+	name         string
+	returnType   string
+	params       []cabs.Param
+	variadic     bool
+	unprototyped bool // declared with (), so the parameters are unspecified
+	pos          diag.Pos
+}
 
-	// Handle array dimensions: int arr[], int arr[10]
-	for p.curTokenIs(lexer.TokenLBracket) {
-		p.nextToken() // consume '['
-		if p.curTokenIs(lexer.TokenRBracket) {
-			// Empty dimension: int arr[]
-			arrayDims = append(arrayDims, nil)
-		} else {
-			// Sized dimension: int arr[10]
-			dim := p.parseExpression()
-			arrayDims = append(arrayDims, dim)
+// declareFunction checks a function declaration against the earlier one of
+// the same name: the return types must agree and, unless either leaves its
+// parameters unspecified, so must the parameter types. The parameter names
+// of a prototype play no part, so int f(int, char *); declares the same
+// function as int f(int a, char *b) { ... }.
+func (p *Parser) declareFunction(d funcDecl) {
+	prev, ok := p.prototypes[d.name]
+	if !ok || (!d.unprototyped && prev.unprototyped) {
+		p.prototypes[d.name] = d
+	}
+	if !ok || prev.compatible(d, p.sameType) {
+		return
+	}
+	p.diags.Errorf(d.pos, "redeclaration", "conflicting types for '%s'", d.name)
+	p.diags.Notef(prev.pos, "redeclaration", "previous declaration is here")
+}
+
+// define records the file-scope definition of name at pos, and reports an
+// earlier one: a function has a single body, and a variable a single
+// initializer. Declarations, and tentative definitions as int x;, may
+// repeat.
+func (p *Parser) define(name string, pos diag.Pos) {
+	if prev, ok := p.definitions[name]; ok {
+		p.diags.Errorf(pos, "redeclaration", "redefinition of '%s'", name)
+		p.diags.Notef(prev, "redeclaration", "previous definition is here")
+		return
+	}
+	p.definitions[name] = pos
+}
+
+func (d funcDecl) compatible(other funcDecl, sameType func(a, b string) bool) bool {
+	if !sameType(d.returnType, other.returnType) {
+		return false
+	}
+	if d.unprototyped || other.unprototyped {
+		return true
+	}
+	if len(d.params) != len(other.params) || d.variadic != other.variadic {
+		return false
+	}
+	for i := range d.params {
+		if !sameType(d.params[i].TypeSpec, other.params[i].TypeSpec) {
+			return false
 		}
-		if !p.curTokenIs(lexer.TokenRBracket) {
-			p.addError(fmt.Sprintf("expected ']' in array declaration, got %s", p.curToken.Type))
-			return nil
+	}
+	return true
+}
+
+// sameType reports whether two type specifiers name the same type once
+// file-scope typedef names are replaced by their definitions. Spacing is
+// ignored, so "char *" and "char*" agree.
+func (p *Parser) sameType(a, b string) bool {
+	return p.expandTypedefs(a) == p.expandTypedefs(b)
+}
+
+func (p *Parser) expandTypedefs(typeSpec string) string {
+	typeSpec = strings.ReplaceAll(typeSpec, " ", "")
+	for range p.typedefSpecs { // a typedef can only refer to earlier ones
+		base := strings.TrimRight(typeSpec, "*")
+		spec, ok := p.typedefSpecs[base]
+		if !ok {
+			break
 		}
-		p.nextToken() // consume ']'
+		typeSpec = strings.ReplaceAll(spec, " ", "") + typeSpec[len(base):]
 	}
+	return typeSpec
+}
 
-	// Handle initializer: int x = 5;
-	if p.curTokenIs(lexer.TokenAssign) {
-		p.nextToken() // consume '='
-		initializer = p.parseExpression()
+// parseVarDef parses a global/extern variable declaration, which may
+// declare several variables: int a, *b = &a, c[3];
+// Called after the type and the first declarator's pointers and name have
+// been parsed; baseType, baseQuals and typeofOperand describe the type
+// before any '*', and dims are the array dimensions parsed inside a
+// function pointer declarator, as the [3] of int (*a[3])(void). Each
+// declarator becomes a VarDef: the first is returned and the others are
+// queued on p.followingDefs.
+func (p *Parser) parseVarDef(storageClass, baseType string, baseQuals []cabs.TypeQualifier, typeofOperand cabs.Expr, typeSpec string, quals cabs.Qualifiers, name string, namePos diag.Pos, dims []cabs.Expr, attrs cabs.Attributes) cabs.Definition {
+	var defs []cabs.Definition
+	for {
+		def := p.parseVarDeclarator(storageClass, typeSpec, quals, name, dims, attrs)
+		if def == nil {
+			return nil
+		}
+		def.Typeof = typeofOperand
+		def.Pos = namePos
+		if def.Initializer != nil {
+			p.define(name, namePos)
+		}
+		defs = append(defs, *def)
+
+		// Check for more declarators
+		if !p.curTokenIs(lexer.TokenComma) {
+			break
+		}
+		p.nextToken() // consume ','
+		quals = cabs.Qualifiers{Base: baseQuals}
+		typeSpec = p.parsePointers(baseType, &quals)
+		dims = nil
+		namePos = tokenPos(p.curToken)
+		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
+			var ok bool
+			if typeSpec, name, dims, ok = p.parseFunctionPointerDeclarator(typeSpec); !ok {
+				return nil
+			}
+			continue
+		}
+		if !p.curTokenIs(lexer.TokenIdent) {
+			p.addError(fmt.Sprintf("expected identifier in declaration, got %s", p.curToken.Type))
+			return nil
+		}
+		name = p.curToken.Literal
+		p.nextToken()
 	}
 
 	// Expect semicolon
@@ -341,12 +534,41 @@ func (p *Parser) parseVarDef(storageClass, typeSpec, name string) cabs.Definitio
 	}
 	p.nextToken() // consume ';'
 
-	return cabs.VarDef{
+	p.followingDefs = append(p.followingDefs, defs[1:]...)
+	return defs[0]
+}
+
+// parseVarDeclarator parses the rest of a global variable's declarator
+// after its name: array dimensions, attributes and initializer.
+func (p *Parser) parseVarDeclarator(storageClass, typeSpec string, quals cabs.Qualifiers, name string, dims []cabs.Expr, attrs cabs.Attributes) *cabs.VarDef {
+	var initializer cabs.Expr
+
+	// Handle array dimensions: int arr[], int arr[10]
+	arrayDims, ok := p.parseArrayDims(dims)
+	if !ok {
+		return nil
+	}
+
+	// Attributes after the declarator: int x __attribute__((aligned(16)));
+	p.parseAttributes(&attrs)
+
+	// Handle initializer: int x = 5;
+	if p.curTokenIs(lexer.TokenAssign) {
+		p.nextToken() // consume '='
+		initializer = p.parseInitializer()
+		if initializer == nil {
+			return nil
+		}
+	}
+
+	return &cabs.VarDef{
 		StorageClass: storageClass,
 		TypeSpec:     typeSpec,
+		Quals:        quals,
 		Name:         name,
 		ArrayDims:    arrayDims,
 		Initializer:  initializer,
+		Attrs:        attrs,
 	}
 }
 
@@ -354,6 +576,10 @@ func (p *Parser) parseVarDef(storageClass, typeSpec, name string) cabs.Definitio
 func (p *Parser) parseStructOrUnion(isUnion bool) cabs.Definition {
 	p.nextToken() // consume 'struct' or 'union'
 
+	// Attributes may precede the name: struct __attribute__((packed)) Name
+	var attrs cabs.Attributes
+	p.parseAttributes(&attrs)
+
 	// Check for struct name
 	name := ""
 	if p.curTokenIs(lexer.TokenIdent) {
@@ -375,104 +601,119 @@ func (p *Parser) parseStructOrUnion(isUnion bool) cabs.Definition {
 		return nil
 	}
 
-	return p.parseStructBody(name, isUnion)
-}
-
-// parseStructBody parses the body of a struct or union definition
-func (p *Parser) parseStructBody(name string, isUnion bool) cabs.Definition {
-	p.nextToken() // consume '{'
-
-	var fields []cabs.StructField
-
-	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
-		// Parse field: type name;
-		if !p.isTypeSpecifier() && !p.isTypeQualifier() {
-			p.addError(fmt.Sprintf("expected type specifier in struct field, got %s", p.curToken.Type))
-			p.nextToken()
-			continue
-		}
-
-		// Skip type qualifiers
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-
-		typeSpec := p.parseCompoundTypeSpecifier()
-
-		// Handle pointer types with optional qualifiers
-		for p.curTokenIs(lexer.TokenStar) {
-			typeSpec = typeSpec + "*"
-			p.nextToken()
-			// Skip type qualifiers after pointer (const, volatile, restrict)
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
+	def := p.parseStructBody(name, isUnion, attrs)
+	if def == nil {
+		return nil
+	}
+	// Optional trailing semicolon for struct definition
+	if p.curTokenIs(lexer.TokenSemicolon) {
+		p.nextToken()
+		return def
+	}
+	if !p.curTokenIs(lexer.TokenIdent) && !p.curTokenIs(lexer.TokenStar) && !p.curTokenIs(lexer.TokenLParen) {
+		return def
+	}
 
-		// Check for function pointer field: type (*name)(params)
-		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
-			field := p.parseFunctionPointerField(typeSpec)
-			if field != nil {
-				fields = append(fields, *field)
-			}
-			continue
+	// Declarators after the body declare variables of the new type:
+	// struct Point { int x, y; } p1, *p2; An untagged type is given a name
+	// for them to refer to, as inline definitions are.
+	if name == "" {
+		name = fmt.Sprintf("__anon_%d", p.anonCounter)
+		p.anonCounter++
+		switch d := def.(type) {
+		case cabs.StructDef:
+			d.Name = name
+			def = d
+		case cabs.UnionDef:
+			d.Name = name
+			def = d
 		}
-
-		// Field name
-		if !p.curTokenIs(lexer.TokenIdent) {
-			p.addError(fmt.Sprintf("expected field name, got %s", p.curToken.Type))
-			continue
+	}
+	baseType := "struct " + name
+	if isUnion {
+		baseType = "union " + name
+	}
+	var quals cabs.Qualifiers
+	typeSpec := p.parsePointers(baseType, &quals)
+	varName := ""
+	varPos := tokenPos(p.curToken)
+	var dims []cabs.Expr
+	if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
+		var ok bool
+		if typeSpec, varName, dims, ok = p.parseFunctionPointerDeclarator(typeSpec); !ok {
+			return nil
 		}
-		fieldName := p.curToken.Literal
+	} else if p.curTokenIs(lexer.TokenIdent) {
+		varName = p.curToken.Literal
 		p.nextToken()
+	} else {
+		p.addError(fmt.Sprintf("expected identifier in declaration, got %s", p.curToken.Type))
+		return nil
+	}
+	v := p.parseVarDef("", baseType, nil, nil, typeSpec, quals, varName, varPos, dims, cabs.Attributes{})
+	if v == nil {
+		return nil
+	}
+	p.followingDefs = append([]cabs.Definition{v}, p.followingDefs...)
+	return def
+}
 
-		// Handle array fields
-		for p.curTokenIs(lexer.TokenLBracket) {
-			p.nextToken() // consume '['
-			for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
-				p.nextToken()
-			}
-			if p.curTokenIs(lexer.TokenRBracket) {
-				p.nextToken()
-			}
-			typeSpec = typeSpec + "[]"
-		}
+// parseStructBody parses the body of a struct or union definition.
+// Attributes after the closing brace are added to attrs.
+func (p *Parser) parseStructBody(name string, isUnion bool, attrs cabs.Attributes) cabs.Definition {
+	p.nextToken() // consume '{'
 
-		fields = append(fields, cabs.StructField{TypeSpec: typeSpec, Name: fieldName})
-
-		// Expect semicolon
-		if !p.expect(lexer.TokenSemicolon) {
-			continue
-		}
-	}
+	fields := p.parseStructFields()
 
 	if !p.curTokenIs(lexer.TokenRBrace) {
 		p.addError(fmt.Sprintf("expected '}' at end of struct body, got %s", p.curToken.Type))
 		return nil
 	}
 	p.nextToken() // consume '}'
-
-	// Optional trailing semicolon for struct definition
-	if p.curTokenIs(lexer.TokenSemicolon) {
-		p.nextToken()
-	}
+	p.parseAttributes(&attrs)
 
 	if isUnion {
-		return cabs.UnionDef{Name: name, Fields: fields}
+		return cabs.UnionDef{Name: name, Fields: fields, Attrs: attrs}
 	}
-	return cabs.StructDef{Name: name, Fields: fields}
+	return cabs.StructDef{Name: name, Fields: fields, Attrs: attrs}
 }
 
 // parseInlineStructBody parses the body of an inline struct/union definition
 // within a field declaration. Similar to parseStructBody but doesn't expect
 // a trailing semicolon (the field declaration will have its own semicolon).
-func (p *Parser) parseInlineStructBody(name string, isUnion bool) cabs.Definition {
+func (p *Parser) parseInlineStructBody(name string, isUnion bool, attrs cabs.Attributes) cabs.Definition {
 	p.nextToken() // consume '{'
 
-	var fields []cabs.StructField
+	fields := p.parseStructFields()
+
+	if !p.curTokenIs(lexer.TokenRBrace) {
+		p.addError(fmt.Sprintf("expected '}' at end of struct body, got %s", p.curToken.Type))
+		return nil
+	}
+	p.nextToken() // consume '}'
+	p.parseAttributes(&attrs)
+
+	// NOTE: No trailing semicolon consumption here - the parent field will handle that
+
+	if isUnion {
+		return cabs.UnionDef{Name: name, Fields: fields, Attrs: attrs}
+	}
+	return cabs.StructDef{Name: name, Fields: fields, Attrs: attrs}
+}
+
+// parseStructFields parses the fields of a struct or union body up to the
+// closing brace. An array field with an empty first dimension is a
+// flexible array member, which must be the last field.
+func (p *Parser) parseStructFields() []cabs.StructField {
+	fields := []cabs.StructField{}
+	flexibleAt := -1 // index of the first flexible array member
+	var flexiblePos diag.Pos
 
 	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
-		// Parse field: type name;
+		// Parse field: type name; attributes may come before the type,
+		// after it, or after each declarator
+		var attrs cabs.Attributes
+		p.parseAttributes(&attrs)
 		if !p.isTypeSpecifier() && !p.isTypeQualifier() {
 			p.addError(fmt.Sprintf("expected type specifier in struct field, got %s", p.curToken.Type))
 			p.nextToken()
@@ -482,69 +723,102 @@ func (p *Parser) parseInlineStructBody(name string, isUnion bool) cabs.Definitio
 		// Skip type qualifiers
 		for p.isTypeQualifier() {
 			p.nextToken()
+			p.parseAttributes(&attrs)
 		}
 
+		anon := p.anonCounter
 		typeSpec := p.parseCompoundTypeSpecifier()
 
-		// Handle pointer types with optional qualifiers
-		for p.curTokenIs(lexer.TokenStar) {
-			typeSpec = typeSpec + "*"
+		// An untagged struct or union without a declarator is an
+		// anonymous member, whose members belong to the enclosing type
+		if p.curTokenIs(lexer.TokenSemicolon) && strings.HasSuffix(typeSpec, fmt.Sprintf(" __anon_%d", anon)) {
+			fields = append(fields, cabs.StructField{TypeSpec: typeSpec})
 			p.nextToken()
-			// Skip type qualifiers after pointer (const, volatile, restrict)
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
-
-		// Check for function pointer field: type (*name)(params)
-		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
-			field := p.parseFunctionPointerField(typeSpec)
-			if field != nil {
-				fields = append(fields, *field)
-			}
 			continue
 		}
 
-		// Field name
-		if !p.curTokenIs(lexer.TokenIdent) {
-			p.addError(fmt.Sprintf("expected field name, got %s", p.curToken.Type))
-			continue
-		}
-		fieldName := p.curToken.Literal
-		p.nextToken()
+		// The declarators share the type specifier: int x, *y;
+		p.parseAttributes(&attrs)
+		baseSpec := typeSpec
+		for {
+			typeSpec := baseSpec
 
-		// Handle array fields
-		for p.curTokenIs(lexer.TokenLBracket) {
-			p.nextToken() // consume '['
-			for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
+			// Handle pointer types with optional qualifiers
+			for p.curTokenIs(lexer.TokenStar) {
+				typeSpec = typeSpec + "*"
 				p.nextToken()
+				// Skip type qualifiers after pointer (const, volatile, restrict)
+				for p.isTypeQualifier() {
+					p.nextToken()
+				}
 			}
-			if p.curTokenIs(lexer.TokenRBracket) {
-				p.nextToken()
+
+			// Check for function pointer field: type (*name)(params)
+			if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
+				if field := p.parseFunctionPointerField(typeSpec); field != nil {
+					fields = append(fields, *field)
+				}
+				break
 			}
-			typeSpec = typeSpec + "[]"
-		}
 
-		fields = append(fields, cabs.StructField{TypeSpec: typeSpec, Name: fieldName})
+			// Field name
+			if !p.curTokenIs(lexer.TokenIdent) {
+				p.addError(fmt.Sprintf("expected field name, got %s", p.curToken.Type))
+				break
+			}
+			fieldName := p.curToken.Literal
+			namePos := tokenPos(p.curToken)
+			p.nextToken()
 
-		// Expect semicolon
-		if !p.expect(lexer.TokenSemicolon) {
-			continue
+			// Handle array fields; an empty first dimension is a flexible array member
+			typeSpec, arrayDims := p.parseFieldArrayDims(typeSpec)
+			flexible := len(arrayDims) > 0 && arrayDims[0] == nil
+			if flexible && flexibleAt < 0 {
+				flexibleAt = len(fields)
+				flexiblePos = namePos
+			}
+
+			fieldAttrs := attrs
+			p.parseAttributes(&fieldAttrs)
+
+			fields = append(fields, cabs.StructField{TypeSpec: typeSpec, Name: fieldName, Flexible: flexible, ArrayDims: arrayDims, Attrs: fieldAttrs})
+
+			if !p.curTokenIs(lexer.TokenComma) {
+				// Expect semicolon
+				p.expect(lexer.TokenSemicolon)
+				break
+			}
+			p.nextToken() // consume ','
 		}
 	}
 
-	if !p.curTokenIs(lexer.TokenRBrace) {
-		p.addError(fmt.Sprintf("expected '}' at end of struct body, got %s", p.curToken.Type))
-		return nil
+	if flexibleAt >= 0 && flexibleAt < len(fields)-1 {
+		p.diags.Errorf(flexiblePos, "flexible-array", "flexible array member '%s' not at end of struct", fields[flexibleAt].Name)
 	}
-	p.nextToken() // consume '}'
-
-	// NOTE: No trailing semicolon consumption here - the parent field will handle that
+	return fields
+}
 
-	if isUnion {
-		return cabs.UnionDef{Name: name, Fields: fields}
+// parseFieldArrayDims parses the array dimensions of a struct or union
+// field. Each dimension adds "[]" to the type spec and its size, nil when
+// empty, to the returned dimensions.
+func (p *Parser) parseFieldArrayDims(typeSpec string) (string, []cabs.Expr) {
+	var dims []cabs.Expr
+	for p.curTokenIs(lexer.TokenLBracket) {
+		p.nextToken() // consume '['
+		var size cabs.Expr
+		if !p.curTokenIs(lexer.TokenRBracket) {
+			size = p.arraySize(p.parseExprPrec(precAssign))
+		}
+		for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
+			p.nextToken()
+		}
+		if p.curTokenIs(lexer.TokenRBracket) {
+			p.nextToken()
+		}
+		dims = append(dims, size)
+		typeSpec = typeSpec + "[]"
 	}
-	return cabs.StructDef{Name: name, Fields: fields}
+	return typeSpec, dims
 }
 
 // parseFunctionPointerField parses a function pointer field: returnType (*name)(params)
@@ -579,15 +853,15 @@ func (p *Parser) parseFunctionPointerField(returnType string) *cabs.StructField
 		return nil
 	}
 
-	paramTypes := p.parseFuncPtrParamTypes()
+	params := p.parseFunctionPointerParams()
 
 	// Expect ';'
 	if !p.expect(lexer.TokenSemicolon) {
 		return nil
 	}
 
-	// Build the function pointer type string: returnType(*)(paramTypes)
-	typeSpec := returnType + "(*)(" + joinParamTypes(paramTypes) + ")"
+	// Build the function pointer type string: returnType(*)(params)
+	typeSpec := returnType + "(*)(" + params + ")"
 
 	return &cabs.StructField{TypeSpec: typeSpec, Name: fieldName}
 }
@@ -617,7 +891,7 @@ func (p *Parser) parseNestedFunctionPointerField(outerReturnType string) *cabs.S
 		return nil
 	}
 
-	innerParamTypes := p.parseFuncPtrParamTypes()
+	innerParams := p.parseFunctionPointerParams()
 
 	// Expect ')' closing outer declarator
 	if !p.expect(lexer.TokenRParen) {
@@ -630,111 +904,18 @@ func (p *Parser) parseNestedFunctionPointerField(outerReturnType string) *cabs.S
 		return nil
 	}
 
-	outerParamTypes := p.parseFuncPtrParamTypes()
-
-	// Expect ';'
-	if !p.expect(lexer.TokenSemicolon) {
-		return nil
-	}
-
-	// Build type: outerReturnType(*)(outerParams)(*)(innerParams)
-	// This represents: pointer to function taking innerParams returning pointer to function taking outerParams returning outerReturnType
-	typeSpec := outerReturnType + "(*)(" + joinParamTypes(outerParamTypes) + ")(*)(" + joinParamTypes(innerParamTypes) + ")"
-
-	return &cabs.StructField{TypeSpec: typeSpec, Name: fieldName}
-}
-
-// parseFuncPtrParamTypes parses function pointer parameter types
-// Expects to be positioned at '(' and advances past closing ')'
-func (p *Parser) parseFuncPtrParamTypes() []string {
-	p.nextToken() // consume '('
-
-	var paramTypes []string
-	for !p.curTokenIs(lexer.TokenRParen) && !p.curTokenIs(lexer.TokenEOF) {
-		// Skip type qualifiers
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-
-		if p.curTokenIs(lexer.TokenRParen) {
-			break
-		}
-
-		// Parse type specifier
-		paramType := p.parseCompoundTypeSpecifier()
-
-		// Handle type qualifiers after base type (e.g., "char const *")
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-
-		// Handle pointer types
-		for p.curTokenIs(lexer.TokenStar) {
-			paramType = paramType + "*"
-			p.nextToken()
-			// Skip type qualifiers after pointer
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
-
-		// Handle function pointer parameter: type (**name)(params) or type (*name)(params)
-		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
-			p.nextToken() // consume '('
-			p.nextToken() // consume first '*'
-			// Count pointer levels
-			ptrCount := 1
-			for p.curTokenIs(lexer.TokenStar) {
-				ptrCount++
-				p.nextToken()
-			}
-			// Skip parameter name if present
-			if p.curTokenIs(lexer.TokenIdent) {
-				p.nextToken()
-			}
-			// Expect ')'
-			if p.curTokenIs(lexer.TokenRParen) {
-				p.nextToken()
-			}
-			// Parse inner parameter list
-			if p.curTokenIs(lexer.TokenLParen) {
-				innerParams := p.parseFuncPtrParamTypes()
-				ptrStr := strings.Repeat("*", ptrCount)
-				paramType = paramType + "(" + ptrStr + ")(" + joinParamTypes(innerParams) + ")"
-			}
-		} else {
-			// Skip parameter name if present
-			if p.curTokenIs(lexer.TokenIdent) {
-				p.nextToken()
-			}
-		}
-
-		paramTypes = append(paramTypes, paramType)
-
-		// Check for comma
-		if p.curTokenIs(lexer.TokenComma) {
-			p.nextToken()
-		}
-	}
-
-	// Consume closing ')'
-	if p.curTokenIs(lexer.TokenRParen) {
-		p.nextToken()
+	outerParams := p.parseFunctionPointerParams()
+
+	// Expect ';'
+	if !p.expect(lexer.TokenSemicolon) {
+		return nil
 	}
 
-	return paramTypes
-}
+	// Build type: outerReturnType(*)(outerParams)(*)(innerParams)
+	// This represents: pointer to function taking innerParams returning pointer to function taking outerParams returning outerReturnType
+	typeSpec := outerReturnType + "(*)(" + outerParams + ")(*)(" + innerParams + ")"
 
-// joinParamTypes joins parameter types with ", "
-func joinParamTypes(types []string) string {
-	if len(types) == 0 {
-		return ""
-	}
-	result := types[0]
-	for i := 1; i < len(types); i++ {
-		result += ", " + types[i]
-	}
-	return result
+	return &cabs.StructField{TypeSpec: typeSpec, Name: fieldName}
 }
 
 // parseEnumDef parses an enum definition
@@ -759,6 +940,7 @@ func (p *Parser) parseEnumDef() cabs.Definition {
 	p.nextToken() // consume '{'
 
 	var values []cabs.EnumVal
+	next := int64(0)
 
 	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
 		if !p.curTokenIs(lexer.TokenIdent) {
@@ -775,7 +957,9 @@ func (p *Parser) parseEnumDef() cabs.Definition {
 			value = p.parseExprPrec(precAssign)
 		}
 
-		values = append(values, cabs.EnumVal{Name: enumName, Value: value})
+		enumVal := cabs.EnumVal{Name: enumName, Value: value}
+		next = p.defineEnumerator(&enumVal, next)
+		values = append(values, enumVal)
 
 		if p.curTokenIs(lexer.TokenComma) {
 			p.nextToken()
@@ -798,6 +982,25 @@ func (p *Parser) parseEnumDef() cabs.Definition {
 	return cabs.EnumDef{Name: name, Values: values}
 }
 
+// defineEnumerator gives an enumerator its value, the constant it is set
+// to or else next, records it for the enumerators that follow, and returns
+// the value of the next implicit enumerator.
+func (p *Parser) defineEnumerator(v *cabs.EnumVal, next int64) int64 {
+	v.Num = next
+	if v.Value != nil {
+		// The evaluator does not know the size of types, so a value it
+		// cannot compute is not necessarily wrong
+		if num, ok := cabs.EvalConst(v.Value, p.enumConsts); ok {
+			v.Num = num
+		} else {
+			p.diags.Warnf(tokenPos(p.curToken), "enum-value",
+				"cannot compute the value of enumerator '%s'", v.Name)
+		}
+	}
+	p.enumConsts[v.Name] = v.Num
+	return v.Num + 1
+}
+
 // parseParameterList parses function parameters: (type name, type name, ...)
 // Returns the parameter list and whether the function is variadic
 func (p *Parser) parseParameterList() ([]cabs.Param, bool) {
@@ -840,10 +1043,7 @@ func (p *Parser) parseParameterList() ([]cabs.Param, bool) {
 // parseParameter parses a single function parameter: type name
 // Also handles function pointer parameters like: int (*fn)(int, int) or int (* )(int, int)
 func (p *Parser) parseParameter() *cabs.Param {
-	// Skip type qualifiers
-	for p.isTypeQualifier() {
-		p.nextToken()
-	}
+	quals := cabs.Qualifiers{Base: p.parseTypeQualifiers()}
 
 	if !p.isTypeSpecifier() {
 		p.addError(fmt.Sprintf("expected type specifier in parameter, got %s", p.curToken.Type))
@@ -853,19 +1053,10 @@ func (p *Parser) parseParameter() *cabs.Param {
 	typeSpec := p.parseCompoundTypeSpecifier()
 
 	// Handle type qualifiers after base type (e.g., "char const *" is same as "const char *")
-	for p.isTypeQualifier() {
-		p.nextToken()
-	}
+	quals.Base = append(quals.Base, p.parseTypeQualifiers()...)
 
 	// Handle pointer types with optional qualifiers (e.g., int * const restrict ptr)
-	for p.curTokenIs(lexer.TokenStar) {
-		typeSpec = typeSpec + "*"
-		p.nextToken()
-		// Skip type qualifiers after pointer (const, volatile, restrict)
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-	}
+	typeSpec = p.parsePointers(typeSpec, &quals)
 
 	// Check for function pointer parameter: type (*name)(params) or type (* )(params)
 	if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
@@ -879,20 +1070,55 @@ func (p *Parser) parseParameter() *cabs.Param {
 		p.nextToken()
 	}
 
-	// Handle array parameters like int arr[]
+	// Handle array parameters like int arr[], int arr[static const 10].
+	// The outermost array is adjusted to a pointer, qualified by any
+	// qualifiers inside its brackets; the inner ones keep their sizes, so
+	// int m[2][3] is int (*m)[3].
+	param := &cabs.Param{Name: name}
+	var arrayQuals []cabs.TypeQualifier
+	dims := 0
+	inner := ""
 	for p.curTokenIs(lexer.TokenLBracket) {
 		p.nextToken() // consume '['
-		// Skip array size if present
-		for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
-			p.nextToken()
+		for p.curTokenIs(lexer.TokenStatic) || p.isTypeQualifier() {
+			if p.curTokenIs(lexer.TokenStatic) {
+				param.ArrayStatic = true
+				p.nextToken()
+			} else {
+				arrayQuals = append(arrayQuals, p.parseTypeQualifiers()...)
+			}
 		}
-		if p.curTokenIs(lexer.TokenRBracket) {
-			p.nextToken() // consume ']'
+		if p.curTokenIs(lexer.TokenStar) && p.peekTokenIs(lexer.TokenRBracket) {
+			p.nextToken() // [*]: variable length array of unspecified size
+		} else if !p.curTokenIs(lexer.TokenRBracket) {
+			size := p.parseExpression()
+			if dims == 0 {
+				param.ArraySize = size
+			} else if n, ok := cabs.EvalConst(size, p.enumConsts); ok {
+				inner += "[" + strconv.FormatInt(n, 10) + "]"
+			} else {
+				inner += "[]"
+			}
+		} else if dims > 0 {
+			inner += "[]"
 		}
-		typeSpec = typeSpec + "[]"
+		if !p.expect(lexer.TokenRBracket) {
+			return nil
+		}
+		dims++
+	}
+	switch {
+	case dims == 1:
+		typeSpec = typeSpec + "*"
+		quals.Pointers = append(quals.Pointers, arrayQuals)
+	case dims > 1:
+		typeSpec = typeSpec + " (*)" + inner
+		quals.Pointers = append(quals.Pointers, arrayQuals)
 	}
 
-	return &cabs.Param{TypeSpec: typeSpec, Name: name}
+	param.TypeSpec = typeSpec
+	param.Quals = quals
+	return param
 }
 
 // parseFunctionPointerParameter parses a function pointer parameter like:
@@ -943,11 +1169,7 @@ func (p *Parser) parseTypedef() cabs.Definition {
 
 	// Collect leading type qualifiers (const, volatile, restrict)
 	// e.g., typedef const char *name;
-	var leadingQualifiers []string
-	for p.isTypeQualifier() {
-		leadingQualifiers = append(leadingQualifiers, p.curToken.Literal)
-		p.nextToken()
-	}
+	quals := cabs.Qualifiers{Base: p.parseTypeQualifiers()}
 
 	if !p.isTypeSpecifier() {
 		p.addError(fmt.Sprintf("expected type specifier in typedef, got %s", p.curToken.Type))
@@ -961,6 +1183,8 @@ func (p *Parser) parseTypedef() cabs.Definition {
 	if p.curTokenIs(lexer.TokenStruct) || p.curTokenIs(lexer.TokenUnion) {
 		isUnion := p.curTokenIs(lexer.TokenUnion)
 		p.nextToken() // consume 'struct' or 'union'
+		var attrs cabs.Attributes
+		p.parseAttributes(&attrs)
 
 		// Check for optional tag name (e.g., typedef struct Tag { ... } Name;)
 		tagName := ""
@@ -971,7 +1195,7 @@ func (p *Parser) parseTypedef() cabs.Definition {
 
 		// If there's a '{', parse the inline body
 		if p.curTokenIs(lexer.TokenLBrace) {
-			inlineDef := p.parseStructBodyForTypedef(tagName, isUnion)
+			inlineDef := p.parseStructBodyForTypedef(tagName, isUnion, attrs)
 			if inlineDef == nil {
 				return nil
 			}
@@ -1123,20 +1347,10 @@ func (p *Parser) parseTypedef() cabs.Definition {
 	// Regular typedef (not inline struct/union/enum)
 	typeSpec := p.parseCompoundTypeSpecifier()
 
-	// Prepend any leading qualifiers (e.g., const, volatile)
-	if len(leadingQualifiers) > 0 {
-		typeSpec = strings.Join(leadingQualifiers, " ") + " " + typeSpec
-	}
-
-	// Handle pointer types with optional qualifiers
-	for p.curTokenIs(lexer.TokenStar) {
-		typeSpec = typeSpec + "*"
-		p.nextToken()
-		// Skip type qualifiers after pointer (const, volatile, restrict)
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-	}
+	// Handle trailing base qualifiers, then pointer types with their own
+	// qualifiers (typedef char const *const name;)
+	quals.Base = append(quals.Base, p.parseTypeQualifiers()...)
+	typeSpec = p.parsePointers(typeSpec, &quals)
 
 	// Check for function pointer typedef: typedef int (*name)(params);
 	if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
@@ -1155,12 +1369,10 @@ func (p *Parser) parseTypedef() cabs.Definition {
 	for p.curTokenIs(lexer.TokenLBracket) {
 		p.nextToken() // consume '['
 		typeSpec = typeSpec + "["
-		// Parse array dimension if present
+		// A constant dimension is part of the type, as in a type name
 		if !p.curTokenIs(lexer.TokenRBracket) {
-			// Collect everything until ']' as part of the array dimension
-			for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
-				typeSpec = typeSpec + p.curToken.Literal
-				p.nextToken()
+			if n, ok := cabs.EvalConst(p.parseExpression(), p.enumConsts); ok {
+				typeSpec = typeSpec + strconv.FormatInt(n, 10)
 			}
 		}
 		if !p.curTokenIs(lexer.TokenRBracket) {
@@ -1178,14 +1390,19 @@ func (p *Parser) parseTypedef() cabs.Definition {
 	// Register the typedef name
 	p.typedefs[name] = true
 
-	return cabs.TypedefDef{TypeSpec: typeSpec, Name: name}
+	return cabs.TypedefDef{TypeSpec: typeSpec, Quals: quals, Name: name}
 }
 
 // parseFunctionPointerTypedef parses a function pointer typedef: typedef returnType (*name)(params);
-// It expects to be positioned at '(' with peek at '*'
+// It expects to be positioned at '(' with peek at '*'. The qualifiers of
+// the pointer, as in (* const name), are recorded as its Quals.
 func (p *Parser) parseFunctionPointerTypedef(returnType string) cabs.Definition {
 	p.nextToken() // consume '('
 	p.nextToken() // consume '*'
+	var quals cabs.Qualifiers
+	if ptrQuals := p.parseTypeQualifiers(); len(ptrQuals) > 0 {
+		quals.Pointers = [][]cabs.TypeQualifier{ptrQuals}
+	}
 
 	// Typedef name
 	if !p.curTokenIs(lexer.TokenIdent) {
@@ -1205,145 +1422,41 @@ func (p *Parser) parseFunctionPointerTypedef(returnType string) cabs.Definition
 		p.addError(fmt.Sprintf("expected '(' for function pointer parameters, got %s", p.curToken.Type))
 		return nil
 	}
-	p.nextToken() // consume '('
-
-	// Parse parameter types
-	var paramTypes []string
-	for !p.curTokenIs(lexer.TokenRParen) && !p.curTokenIs(lexer.TokenEOF) {
-		// Skip type qualifiers
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-
-		if p.curTokenIs(lexer.TokenRParen) {
-			break
-		}
-
-		// Parse type specifier
-		paramType := p.parseCompoundTypeSpecifier()
-
-		// Handle pointer types
-		for p.curTokenIs(lexer.TokenStar) {
-			paramType = paramType + "*"
-			p.nextToken()
-			// Skip type qualifiers after pointer
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
-
-		// Skip parameter name if present
-		if p.curTokenIs(lexer.TokenIdent) {
-			p.nextToken()
-		}
-
-		paramTypes = append(paramTypes, paramType)
-
-		// Check for comma
-		if p.curTokenIs(lexer.TokenComma) {
-			p.nextToken()
-		}
-	}
-
-	// Expect ')'
-	if !p.expect(lexer.TokenRParen) {
-		return nil
-	}
+	params := p.parseFunctionPointerParams()
 
 	// Expect ';'
 	if !p.expect(lexer.TokenSemicolon) {
 		return nil
 	}
 
-	// Build the function pointer type string: returnType(*)(paramTypes)
-	typeSpec := returnType + "(*)(" + joinParamTypes(paramTypes) + ")"
+	// Build the function pointer type string: returnType(*)(params)
+	typeSpec := returnType + "(*)(" + params + ")"
 
 	// Register the typedef name
 	p.typedefs[name] = true
 
-	return cabs.TypedefDef{TypeSpec: typeSpec, Name: name}
+	return cabs.TypedefDef{TypeSpec: typeSpec, Quals: quals, Name: name}
 }
 
 // parseStructBodyForTypedef parses the body of a struct/union for typedef (without trailing semicolon)
-func (p *Parser) parseStructBodyForTypedef(name string, isUnion bool) cabs.Definition {
+func (p *Parser) parseStructBodyForTypedef(name string, isUnion bool, attrs cabs.Attributes) cabs.Definition {
 	p.nextToken() // consume '{'
 
-	var fields []cabs.StructField
-
-	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
-		// Parse field: type name;
-		if !p.isTypeSpecifier() && !p.isTypeQualifier() {
-			p.addError(fmt.Sprintf("expected type specifier in struct field, got %s", p.curToken.Type))
-			p.nextToken()
-			continue
-		}
-
-		// Skip type qualifiers
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-
-		typeSpec := p.parseCompoundTypeSpecifier()
-
-		// Handle pointer types with optional qualifiers
-		for p.curTokenIs(lexer.TokenStar) {
-			typeSpec = typeSpec + "*"
-			p.nextToken()
-			// Skip type qualifiers after pointer (const, volatile, restrict)
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
-
-		// Check for function pointer field: type (*name)(params)
-		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
-			field := p.parseFunctionPointerField(typeSpec)
-			if field != nil {
-				fields = append(fields, *field)
-			}
-			continue
-		}
-
-		// Field name
-		if !p.curTokenIs(lexer.TokenIdent) {
-			p.addError(fmt.Sprintf("expected field name, got %s", p.curToken.Type))
-			continue
-		}
-		fieldName := p.curToken.Literal
-		p.nextToken()
-
-		// Handle array fields
-		for p.curTokenIs(lexer.TokenLBracket) {
-			p.nextToken() // consume '['
-			for !p.curTokenIs(lexer.TokenRBracket) && !p.curTokenIs(lexer.TokenEOF) {
-				p.nextToken()
-			}
-			if p.curTokenIs(lexer.TokenRBracket) {
-				p.nextToken()
-			}
-			typeSpec = typeSpec + "[]"
-		}
-
-		fields = append(fields, cabs.StructField{TypeSpec: typeSpec, Name: fieldName})
-
-		// Expect semicolon
-		if !p.expect(lexer.TokenSemicolon) {
-			continue
-		}
-	}
+	fields := p.parseStructFields()
 
 	if !p.curTokenIs(lexer.TokenRBrace) {
 		p.addError(fmt.Sprintf("expected '}' at end of struct body, got %s", p.curToken.Type))
 		return nil
 	}
 	p.nextToken() // consume '}'
+	p.parseAttributes(&attrs)
 
 	// Note: Don't consume trailing semicolon here, the typedef handler will do it
 
 	if isUnion {
-		return cabs.UnionDef{Name: name, Fields: fields}
+		return cabs.UnionDef{Name: name, Fields: fields, Attrs: attrs}
 	}
-	return cabs.StructDef{Name: name, Fields: fields}
+	return cabs.StructDef{Name: name, Fields: fields, Attrs: attrs}
 }
 
 // parseEnumBodyForTypedef parses the body of an enum for typedef (without trailing semicolon)
@@ -1351,6 +1464,7 @@ func (p *Parser) parseEnumBodyForTypedef(name string) cabs.Definition {
 	p.nextToken() // consume '{'
 
 	var values []cabs.EnumVal
+	next := int64(0)
 
 	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
 		// Enumerator name
@@ -1370,6 +1484,7 @@ func (p *Parser) parseEnumBodyForTypedef(name string) cabs.Definition {
 			enumVal.Value = p.parseExprPrec(precAssign)
 		}
 
+		next = p.defineEnumerator(&enumVal, next)
 		values = append(values, enumVal)
 
 		// Comma or closing brace
@@ -1395,15 +1510,53 @@ func (p *Parser) isTypeSpecifier() bool {
 	case lexer.TokenInt_, lexer.TokenVoid, lexer.TokenChar, lexer.TokenShort,
 		lexer.TokenLong, lexer.TokenFloat, lexer.TokenDouble,
 		lexer.TokenSigned, lexer.TokenUnsigned, lexer.TokenStruct,
-		lexer.TokenUnion, lexer.TokenEnum:
+		lexer.TokenUnion, lexer.TokenEnum, lexer.TokenTypeof:
 		return true
 	case lexer.TokenIdent:
 		// Check if it's a typedef name
-		return p.typedefs[p.curToken.Literal]
+		return p.isTypedefName(p.curToken.Literal)
 	}
 	return false
 }
 
+// isTypedefName reports whether name denotes a typedef at this point: it
+// was declared as one and no enclosing block declares an ordinary
+// identifier of the same name.
+func (p *Parser) isTypedefName(name string) bool {
+	if !p.typedefs[name] {
+		return false
+	}
+	for _, scope := range p.scopes {
+		if scope[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// openScope enters a block scope.
+func (p *Parser) openScope() {
+	p.scopes = append(p.scopes, nil)
+}
+
+// closeScope leaves the innermost block scope.
+func (p *Parser) closeScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// declareOrdinary records a variable or parameter declared in the current
+// block scope. It only matters when the name hides a typedef.
+func (p *Parser) declareOrdinary(name string) {
+	if len(p.scopes) == 0 || !p.typedefs[name] {
+		return
+	}
+	top := len(p.scopes) - 1
+	if p.scopes[top] == nil {
+		p.scopes[top] = make(map[string]bool)
+	}
+	p.scopes[top][name] = true
+}
+
 func (p *Parser) isStorageClassSpecifier() bool {
 	switch p.curToken.Type {
 	case lexer.TokenStatic, lexer.TokenExtern, lexer.TokenAuto, lexer.TokenRegister:
@@ -1424,32 +1577,140 @@ func (p *Parser) isTypeQualifier() bool {
 	return false
 }
 
-// skipAttributes skips __attribute__((...)) and __asm(...) constructs
+// parseTypeQualifiers consumes a run of type qualifiers and returns them
+func (p *Parser) parseTypeQualifiers() []cabs.TypeQualifier {
+	var quals []cabs.TypeQualifier
+	for p.isTypeQualifier() {
+		switch p.curToken.Type {
+		case lexer.TokenConst:
+			quals = append(quals, cabs.QualConst)
+		case lexer.TokenVolatile:
+			quals = append(quals, cabs.QualVolatile)
+		case lexer.TokenRestrict:
+			quals = append(quals, cabs.QualRestrict)
+		}
+		p.nextToken()
+	}
+	return quals
+}
+
+// parsePointers consumes pointer declarators (*) and the qualifiers that
+// follow each one, e.g. "* const *". It returns typeSpec with a '*' per
+// pointer and records each pointer's qualifiers in quals.
+func (p *Parser) parsePointers(typeSpec string, quals *cabs.Qualifiers) string {
+	for p.curTokenIs(lexer.TokenStar) {
+		typeSpec = typeSpec + "*"
+		p.nextToken()
+		quals.Pointers = append(quals.Pointers, p.parseTypeQualifiers())
+	}
+	return typeSpec
+}
+
+// parseAttributes parses __attribute__((...)) and __asm(...) constructs,
+// recording the attributes that affect code generation in attrs.
 // These are GCC extensions commonly found in system headers.
 // Can appear multiple times, e.g.: __asm("_foo") __attribute__((cold))
-func (p *Parser) skipAttributes() {
+func (p *Parser) parseAttributes(attrs *cabs.Attributes) {
 	for p.curTokenIs(lexer.TokenAttribute) || p.curTokenIs(lexer.TokenAsm) {
+		isAsm := p.curTokenIs(lexer.TokenAsm)
+		if isAsm {
+			p.extension(p.curToken, "asm label")
+		} else {
+			p.extension(p.curToken, "attribute")
+		}
 		p.nextToken() // consume __attribute__ or __asm
 
 		// Expect opening paren
 		if !p.curTokenIs(lexer.TokenLParen) {
 			return
 		}
+		if isAsm || !p.peekTokenIs(lexer.TokenLParen) {
+			p.skipParens()
+			continue
+		}
+		p.nextToken() // consume outer '('
+		p.nextToken() // consume inner '('
 
-		// Count parentheses to find matching close
-		depth := 0
-		for !p.curTokenIs(lexer.TokenEOF) {
-			if p.curTokenIs(lexer.TokenLParen) {
-				depth++
-			} else if p.curTokenIs(lexer.TokenRParen) {
-				depth--
-				if depth == 0 {
-					p.nextToken() // consume final ')'
-					break
-				}
+		// Comma-separated attribute list, possibly empty
+		for !p.curTokenIs(lexer.TokenRParen) && !p.curTokenIs(lexer.TokenEOF) {
+			if p.curTokenIs(lexer.TokenComma) {
+				p.nextToken()
+				continue
 			}
+			p.parseAttribute(attrs)
+		}
+		p.expect(lexer.TokenRParen)
+		p.expect(lexer.TokenRParen)
+	}
+}
+
+// maxAlignment is the alignment requested by a bare aligned attribute:
+// the largest alignment of any type on AArch64.
+const maxAlignment = 16
+
+// parseAttribute parses a single attribute of an attribute list, such as
+// packed, aligned(16) or section(".data"). Names may be written with
+// surrounding underscores (__packed__). Unknown attributes and their
+// arguments are skipped.
+func (p *Parser) parseAttribute(attrs *cabs.Attributes) {
+	name := strings.Trim(p.curToken.Literal, "_")
+	p.nextToken()
+
+	switch name {
+	case "packed":
+		attrs.Packed = true
+	case "aligned":
+		if !p.curTokenIs(lexer.TokenLParen) {
+			// Without an argument: the largest alignment of any type
+			attrs.Aligned = maxAlignment
+			return
+		}
+		p.nextToken() // consume '('
+		c, ok := p.parseExpression().(cabs.Constant)
+		if !ok || c.Value <= 0 || c.Value&(c.Value-1) != 0 {
+			p.addError("requested alignment is not a positive power of 2")
+		} else {
+			attrs.Aligned = c.Value
+		}
+		p.expect(lexer.TokenRParen)
+		return
+	case "section":
+		if !p.expect(lexer.TokenLParen) {
+			return
+		}
+		if !p.curTokenIs(lexer.TokenString) {
+			p.addError(fmt.Sprintf("expected section name, got %s", p.curToken.Type))
+		} else {
+			attrs.Section = p.curToken.Literal
 			p.nextToken()
 		}
+		p.expect(lexer.TokenRParen)
+		return
+	}
+
+	if p.curTokenIs(lexer.TokenLParen) {
+		p.skipParens()
+	}
+}
+
+// skipParens skips a parenthesized token sequence, including nested
+// parentheses. The current token must be '('. String literals are single
+// tokens, so parentheses inside them, as in section("(.text)"), are not
+// counted.
+func (p *Parser) skipParens() {
+	// Count parentheses to find matching close
+	depth := 0
+	for !p.curTokenIs(lexer.TokenEOF) {
+		if p.curTokenIs(lexer.TokenLParen) {
+			depth++
+		} else if p.curTokenIs(lexer.TokenRParen) {
+			depth--
+			if depth == 0 {
+				p.nextToken() // consume final ')'
+				return
+			}
+		}
+		p.nextToken()
 	}
 }
 
@@ -1482,11 +1743,17 @@ func (p *Parser) isPrimitiveTypeSpecifier() bool {
 func (p *Parser) parseCompoundTypeSpecifier() string {
 	var parts []string
 
+	if p.curTokenIs(lexer.TokenTypeof) {
+		return p.parseTypeof()
+	}
+
 	// Handle struct/union/enum types specially
 	if p.curToken.Type == lexer.TokenStruct || p.curToken.Type == lexer.TokenUnion || p.curToken.Type == lexer.TokenEnum {
 		isUnion := p.curToken.Type == lexer.TokenUnion
 		typeKeyword := p.curToken.Literal // "struct" or "union"
 		p.nextToken()
+		var attrs cabs.Attributes
+		p.parseAttributes(&attrs)
 
 		var tagName string
 		// Handle struct/union/enum name
@@ -1504,7 +1771,7 @@ func (p *Parser) parseCompoundTypeSpecifier() string {
 				p.anonCounter++
 			}
 			// Parse the struct body (this consumes { ... } but NOT trailing ; since we're mid-field)
-			def := p.parseInlineStructBody(tagName, isUnion)
+			def := p.parseInlineStructBody(tagName, isUnion, attrs)
 			if def != nil {
 				p.inlineDefs = append(p.inlineDefs, def)
 			}
@@ -1517,7 +1784,7 @@ func (p *Parser) parseCompoundTypeSpecifier() string {
 	}
 
 	// Handle typedef names (not compound)
-	if p.curToken.Type == lexer.TokenIdent && p.typedefs[p.curToken.Literal] {
+	if p.curToken.Type == lexer.TokenIdent && p.isTypedefName(p.curToken.Literal) {
 		typeSpec := p.curToken.Literal
 		p.nextToken()
 		return typeSpec
@@ -1667,14 +1934,17 @@ func joinTypeSpecifiers(parts []string) string {
 }
 
 func (p *Parser) parseBlock() *cabs.Block {
+	p.openScope()
+	defer p.closeScope()
 	block := &cabs.Block{Items: []cabs.Stmt{}}
 
 	p.nextToken() // consume '{'
 
 	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
-			block.Items = append(block.Items, stmt)
+			block.Items = p.appendAnnotated(block.Items, start, stmt)
 		} else {
 			// Error recovery: sync to end of statement and continue
 			p.syncToStmtEnd()
@@ -1686,6 +1956,62 @@ func (p *Parser) parseBlock() *cabs.Block {
 	return block
 }
 
+// appendAnnotated appends stmt, which starts at token start, to stmts. With
+// annotations on, it is preceded by __builtin_annot("line N: <source>")
+// unless it generates no code of its own or shares the previous
+// annotation's line.
+func (p *Parser) appendAnnotated(stmts []cabs.Stmt, start lexer.Token, stmt cabs.Stmt) []cabs.Stmt {
+	if !p.annotate || start.Line == p.annotLine || !generatesCode(stmt) {
+		return append(stmts, stmt)
+	}
+	p.annotLine = start.Line
+	text := fmt.Sprintf("line %d: %s", start.Line, strings.TrimSpace(p.l.LineText(start.Offset)))
+	annot := cabs.Computation{Expr: cabs.Call{
+		Func: cabs.Variable{Name: "__builtin_annot"},
+		Args: []cabs.Expr{cabs.StringLiteral{Value: escapeString(text)}},
+	}}
+	return append(stmts, annot, stmt)
+}
+
+// parseBody parses the body of an if, while, do or for statement. With
+// annotations on, a body that is not a block is wrapped in one so it can
+// carry its own annotation.
+func (p *Parser) parseBody() cabs.Stmt {
+	start := p.curToken
+	stmt := p.parseStatement()
+	if !p.annotate || stmt == nil {
+		return stmt
+	}
+	if items := p.appendAnnotated(nil, start, stmt); len(items) > 1 {
+		return cabs.Block{Items: items}
+	}
+	return stmt
+}
+
+// generatesCode reports whether a block item has code to annotate: nested
+// blocks are annotated statement by statement, and declarations only when
+// they initialize something.
+func generatesCode(stmt cabs.Stmt) bool {
+	switch s := stmt.(type) {
+	case cabs.Block:
+		return false
+	case cabs.DeclStmt:
+		for _, d := range s.Decls {
+			if d.Initializer != nil {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// escapeString escapes backslashes and double quotes so s can be the value
+// of a string literal.
+func escapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
 func (p *Parser) parseStatement() cabs.Stmt {
 	// Handle empty statement: just a semicolon
 	if p.curTokenIs(lexer.TokenSemicolon) {
@@ -1724,8 +2050,11 @@ func (p *Parser) parseStatement() cabs.Stmt {
 		if p.peekTokenIs(lexer.TokenColon) {
 			return p.parseLabelStatement()
 		}
-		// Check if it's a typedef name (declaration)
-		if p.typedefs[p.curToken.Literal] {
+		// An identifier starts a declaration only if it names a typedef
+		// in scope: T * x; declares x as a pointer to T, while a * b;
+		// multiplies when a is an ordinary identifier, including a local
+		// or parameter that hides a typedef of the same name.
+		if p.isTypedefName(p.curToken.Literal) {
 			return p.parseDeclarationStatement()
 		}
 		// Expression statement
@@ -1742,7 +2071,7 @@ func (p *Parser) isTypeSpecifierKeyword() bool {
 	case lexer.TokenInt_, lexer.TokenVoid, lexer.TokenChar, lexer.TokenShort,
 		lexer.TokenLong, lexer.TokenFloat, lexer.TokenDouble,
 		lexer.TokenSigned, lexer.TokenUnsigned, lexer.TokenStruct,
-		lexer.TokenUnion, lexer.TokenEnum:
+		lexer.TokenUnion, lexer.TokenEnum, lexer.TokenTypeof:
 		return true
 	}
 	return false
@@ -1750,15 +2079,15 @@ func (p *Parser) isTypeSpecifierKeyword() bool {
 
 // parseDeclarationStatement parses a variable declaration: type name [= initializer], ...;
 func (p *Parser) parseDeclarationStatement() cabs.Stmt {
-	// Collect storage class specifiers (skip for now, just consume)
+	// Collect the storage class specifier, which applies to every declarator
+	storageClass := ""
 	for p.isStorageClassSpecifier() {
+		storageClass = p.curToken.Literal
 		p.nextToken()
 	}
 
-	// Collect type qualifiers (skip for now, just consume)
-	for p.isTypeQualifier() {
-		p.nextToken()
-	}
+	// Collect type qualifiers of the base type, before or after it
+	baseQuals := p.parseTypeQualifiers()
 
 	// Parse base type
 	if !p.isTypeSpecifier() {
@@ -1767,50 +2096,34 @@ func (p *Parser) parseDeclarationStatement() cabs.Stmt {
 	}
 
 	baseType := p.parseCompoundTypeSpecifier()
+	typeofOperand := p.takeTypeof(baseType)
+	baseQuals = append(baseQuals, p.parseTypeQualifiers()...)
+
+	// A declaration without declarators only declares a tag: struct Foo;
+	// Any body was already recorded as an inline definition.
+	if p.curTokenIs(lexer.TokenSemicolon) {
+		p.nextToken()
+		return cabs.DeclStmt{TypeSpec: baseType}
+	}
 
 	var decls []cabs.Decl
 
 	// Parse declarators
 	for {
 		typeSpec := baseType
+		quals := cabs.Qualifiers{Base: baseQuals}
 
-		// Check for function pointer: type (*name)(params)
+		// Check for function pointer: type (*name)(params), or an array of
+		// them: type (*name[N])(params)
 		if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
-			p.nextToken() // consume '('
-			p.nextToken() // consume '*'
-
-			// Collect pointer modifiers
-			ptrDepth := 1
-			for p.curTokenIs(lexer.TokenStar) {
-				ptrDepth++
-				p.nextToken()
-			}
-
-			// Get the name
-			if !p.curTokenIs(lexer.TokenIdent) {
-				p.addError(fmt.Sprintf("expected identifier in function pointer, got %s", p.curToken.Type))
-				return nil
-			}
-			name := p.curToken.Literal
-			p.nextToken()
-
-			if !p.expect(lexer.TokenRParen) {
-				return nil
-			}
-
-			// Parse the function parameter list
-			if !p.curTokenIs(lexer.TokenLParen) {
-				p.addError(fmt.Sprintf("expected '(' for function pointer parameters, got %s", p.curToken.Type))
+			var name string
+			var arrayDims []cabs.Expr
+			var ok bool
+			namePos := tokenPos(p.curToken)
+			if typeSpec, name, arrayDims, ok = p.parseFunctionPointerDeclarator(typeSpec); !ok {
 				return nil
 			}
-			paramList := p.parseFunctionPointerParams()
-
-			// Build the type spec: returnType(*)(params)
-			ptrStr := "(*)"
-			for i := 1; i < ptrDepth; i++ {
-				ptrStr = "(*" + ptrStr + ")"
-			}
-			typeSpec = typeSpec + ptrStr + "(" + paramList + ")"
+			p.declareOrdinary(name)
 
 			var init cabs.Expr
 			// Check for initializer
@@ -1818,34 +2131,53 @@ func (p *Parser) parseDeclarationStatement() cabs.Stmt {
 				p.nextToken() // consume '='
 				init = p.parseExprPrec(precAssign)
 				if init == nil {
-					return nil
-				}
-			}
-
-			decls = append(decls, cabs.Decl{
-				TypeSpec:    typeSpec,
-				Name:        name,
-				Initializer: init,
-			})
-		} else {
-			// Regular declarator: pointer and/or identifier
-			// Skip pointer declarators (*) with optional qualifiers
-			for p.curTokenIs(lexer.TokenStar) {
-				typeSpec = typeSpec + "*"
-				p.nextToken()
-				// Skip type qualifiers after pointer (const, volatile, restrict)
-				for p.isTypeQualifier() {
-					p.nextToken()
+					return nil
 				}
 			}
 
+			decls = append(decls, cabs.Decl{
+				StorageClass: storageClass,
+				TypeSpec:     typeSpec,
+				Name:         name,
+				ArrayDims:    arrayDims,
+				Initializer:  init,
+				Typeof:       typeofOperand,
+				Pos:          namePos,
+			})
+		} else {
+			// Regular declarator: pointer and/or identifier
+			typeSpec = p.parsePointers(typeSpec, &quals)
+
 			// Expect identifier
 			if !p.curTokenIs(lexer.TokenIdent) {
 				p.addError(fmt.Sprintf("expected identifier in declaration, got %s", p.curToken.Type))
 				return nil
 			}
 			name := p.curToken.Literal
+			namePos := tokenPos(p.curToken)
 			p.nextToken()
+			p.declareOrdinary(name)
+
+			// A function declarator declares a function defined elsewhere,
+			// with external linkage (C11 6.2.2p5): double g(double);
+			if p.curTokenIs(lexer.TokenLParen) {
+				typeSpec += "(" + p.parseFunctionPointerParams() + ")"
+				if p.curTokenIs(lexer.TokenAssign) {
+					p.addError(fmt.Sprintf("function %s is initialized like a variable", name))
+					return nil
+				}
+				decls = append(decls, cabs.Decl{
+					StorageClass: "extern",
+					TypeSpec:     typeSpec,
+					Quals:        quals,
+					Name:         name,
+				})
+				if !p.curTokenIs(lexer.TokenComma) {
+					break
+				}
+				p.nextToken() // consume ','
+				continue
+			}
 
 			// Check for array declarator
 			var arrayDims []cabs.Expr
@@ -1860,7 +2192,7 @@ func (p *Parser) parseDeclarationStatement() cabs.Stmt {
 					if sizeExpr == nil {
 						return nil
 					}
-					arrayDims = append(arrayDims, sizeExpr)
+					arrayDims = append(arrayDims, p.arraySize(sizeExpr))
 				}
 				if !p.expect(lexer.TokenRBracket) {
 					return nil
@@ -1871,17 +2203,21 @@ func (p *Parser) parseDeclarationStatement() cabs.Stmt {
 			// Check for initializer
 			if p.curTokenIs(lexer.TokenAssign) {
 				p.nextToken() // consume '='
-				init = p.parseExprPrec(precAssign) // Use assignment precedence to stop at comma
+				init = p.parseInitializer()
 				if init == nil {
 					return nil
 				}
 			}
 
 			decls = append(decls, cabs.Decl{
-				TypeSpec:    typeSpec,
-				Name:        name,
-				ArrayDims:   arrayDims,
-				Initializer: init,
+				StorageClass: storageClass,
+				TypeSpec:     typeSpec,
+				Quals:        quals,
+				Name:         name,
+				ArrayDims:    arrayDims,
+				Initializer:  init,
+				Typeof:       typeofOperand,
+				Pos:          namePos,
 			})
 		}
 
@@ -1899,70 +2235,147 @@ func (p *Parser) parseDeclarationStatement() cabs.Stmt {
 	return cabs.DeclStmt{Decls: decls}
 }
 
-// parseFunctionPointerParams parses the parameter list in a function pointer type
-// Returns a string representation like "int,int" or "void"
-func (p *Parser) parseFunctionPointerParams() string {
+// parseTypeof parses the GCC type specifier typeof(type) or typeof(expr).
+// typeof(type) is replaced by the type name. The type of typeof(expr) is
+// only known once the expression is typed: it is spelled "typeof(expr)"
+// and the operand is kept for the declaration, see takeTypeof.
+func (p *Parser) parseTypeof() string {
+	p.extension(p.curToken, "typeof")
+	p.nextToken() // consume 'typeof'
+	if !p.curTokenIs(lexer.TokenLParen) {
+		p.addError(fmt.Sprintf("expected '(' after typeof, got %s", p.curToken.Type))
+		return "int"
+	}
+	if p.isTypeSpecifierPeek() {
+		p.nextToken() // consume '('
+		quals := cabs.Qualifiers{Base: p.parseTypeQualifiers()}
+		if !p.isTypeSpecifier() {
+			p.addError(fmt.Sprintf("expected type specifier in typeof, got %s", p.curToken.Type))
+			return "int"
+		}
+		typeName := p.parseCompoundTypeSpecifier()
+		typeName = p.parsePointers(typeName, &quals)
+		typeName = p.parseAbstractDeclarator(typeName)
+		p.expect(lexer.TokenRParen)
+		return typeName
+	}
 	p.nextToken() // consume '('
+	operand := p.parseExpression()
+	if operand == nil || !p.expect(lexer.TokenRParen) {
+		return "int"
+	}
+	p.typeofOperand = operand
+	return "typeof(" + cabs.ExprString(operand) + ")"
+}
 
-	var params []string
+// takeTypeof returns the operand of the typeof(expr) that baseType was
+// parsed from, nil for any other base type. A declaration takes it right
+// after its base type, before its declarators can parse other types.
+func (p *Parser) takeTypeof(baseType string) cabs.Expr {
+	operand := p.typeofOperand
+	p.typeofOperand = nil
+	if !strings.HasPrefix(baseType, "typeof(") {
+		return nil
+	}
+	return operand
+}
 
-	if p.curTokenIs(lexer.TokenRParen) {
-		p.nextToken() // consume ')'
-		return ""
+// typeNameTypeof reports a typeof(expr) as the base of a type name, in a
+// cast, sizeof or va_arg: only declarations resolve its type.
+func (p *Parser) typeNameTypeof(baseType string) {
+	if p.takeTypeof(baseType) != nil {
+		p.addError("typeof an expression is only supported in declarations")
 	}
+}
 
-	// Parse first parameter type
-	for !p.curTokenIs(lexer.TokenRParen) && !p.curTokenIs(lexer.TokenEOF) {
-		var paramType string
-		// Collect type qualifiers
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-		// Get the type specifier (handles multi-word types like unsigned int)
-		if p.isTypeSpecifier() {
-			paramType = p.parseCompoundTypeSpecifier()
-		}
-		// Handle type qualifiers after base type (e.g., "char const *" is same as "const char *")
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-		// Handle pointers with optional qualifiers
-		for p.curTokenIs(lexer.TokenStar) {
-			paramType = paramType + "*"
-			p.nextToken()
-			// Skip type qualifiers after pointer (const, volatile, restrict)
-			for p.isTypeQualifier() {
-				p.nextToken()
-			}
-		}
-		// Skip parameter name if present
-		if p.curTokenIs(lexer.TokenIdent) {
-			p.nextToken()
-		}
-		params = append(params, paramType)
+// parseFunctionPointerDeclarator parses the declarator (*name)(params) of
+// a function pointer returning retType, with curToken at '('. It returns
+// the type spec, e.g. "int(*)(int)", and the declared name. The name may
+// be followed by array dimensions, (*name[3])(params) declaring an array
+// of function pointers; they are returned for the declaration's ArrayDims.
+func (p *Parser) parseFunctionPointerDeclarator(retType string) (string, string, []cabs.Expr, bool) {
+	p.nextToken() // consume '('
+	p.nextToken() // consume '*'
+	ptrStr := "(*)"
+	for p.curTokenIs(lexer.TokenStar) {
+		ptrStr = "(*" + ptrStr + ")"
+		p.nextToken()
+	}
+	if !p.curTokenIs(lexer.TokenIdent) {
+		p.addError(fmt.Sprintf("expected identifier in function pointer, got %s", p.curToken.Type))
+		return "", "", nil, false
+	}
+	name := p.curToken.Literal
+	p.nextToken()
+	dims, ok := p.parseArrayDims(nil)
+	if !ok || !p.expect(lexer.TokenRParen) {
+		return "", "", nil, false
+	}
+	if !p.curTokenIs(lexer.TokenLParen) {
+		p.addError(fmt.Sprintf("expected '(' for function pointer parameters, got %s", p.curToken.Type))
+		return "", "", nil, false
+	}
+	return retType + ptrStr + "(" + p.parseFunctionPointerParams() + ")", name, dims, true
+}
 
-		if p.curTokenIs(lexer.TokenComma) {
-			p.nextToken() // consume ','
+// parseArrayDims parses the array dimensions of a declarator, appending
+// them to dims: nil for [], the size expression for [10]. It reports
+// false after an error.
+func (p *Parser) parseArrayDims(dims []cabs.Expr) ([]cabs.Expr, bool) {
+	for p.curTokenIs(lexer.TokenLBracket) {
+		p.nextToken() // consume '['
+		if p.curTokenIs(lexer.TokenRBracket) {
+			// Empty dimension: int arr[]
+			dims = append(dims, nil)
 		} else {
-			break
+			// Sized dimension: int arr[10]
+			dims = append(dims, p.arraySize(p.parseExpression()))
 		}
+		if !p.curTokenIs(lexer.TokenRBracket) {
+			p.addError(fmt.Sprintf("expected ']' in array declaration, got %s", p.curToken.Type))
+			return nil, false
+		}
+		p.nextToken() // consume ']'
 	}
+	return dims, true
+}
 
-	if !p.expect(lexer.TokenRParen) {
-		return ""
+// arraySize folds the constant parts of an array size, with the
+// enumerators it names replaced by their values, so that a constant size
+// gives a fixed-size array. sizeof is folded later, once the size of types
+// is known; what remains after that is the size of a variable length array.
+func (p *Parser) arraySize(size cabs.Expr) cabs.Expr {
+	return cabs.FoldConst(size, p.enumConsts, nil)
+}
+
+// parseFunctionPointerParams parses the parameter list in a function pointer
+// type, from its '(' past its ')', as a function's parameters are parsed.
+// It returns the parameter types with their qualifiers, separated by ", ",
+// like "unsigned long, const char*", "void" for (void) and "" for ().
+func (p *Parser) parseFunctionPointerParams() string {
+	p.nextToken() // consume '('
+	if p.curTokenIs(lexer.TokenVoid) && p.peekTokenIs(lexer.TokenRParen) {
+		p.nextToken() // consume 'void'
+		p.nextToken() // consume ')'
+		return "void"
 	}
 
-	result := ""
-	for i, param := range params {
-		if i > 0 {
-			result += ","
-		}
-		result += param
+	params, variadic := p.parseParameterList()
+	var types []string
+	for _, param := range params {
+		types = append(types, cabs.QualifiedType(param.TypeSpec, param.Quals))
 	}
-	return result
+	if variadic {
+		types = append(types, "...")
+	}
+	if !p.expect(lexer.TokenRParen) {
+		return ""
+	}
+	return strings.Join(types, ", ")
 }
 
 func (p *Parser) parseExpressionStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	expr := p.parseExpression()
 	if expr == nil {
 		return nil
@@ -1972,10 +2385,93 @@ func (p *Parser) parseExpressionStatement() cabs.Stmt {
 		return nil
 	}
 
-	return cabs.Computation{Expr: expr}
+	return cabs.Computation{Expr: expr, Pos: pos}
+}
+
+// parseInitializer parses the initializer of a declarator: an assignment
+// expression, or a brace-enclosed list of initializers, which may nest
+// and may end with a trailing comma.
+func (p *Parser) parseInitializer() cabs.Expr {
+	if !p.curTokenIs(lexer.TokenLBrace) {
+		return p.parseExprPrec(precAssign)
+	}
+	p.nextToken() // consume '{'
+
+	list := cabs.InitList{}
+	for !p.curTokenIs(lexer.TokenRBrace) {
+		var item cabs.Expr
+		if p.curTokenIs(lexer.TokenLBracket) {
+			item = p.parseDesignated()
+		} else {
+			item = p.parseInitializer()
+		}
+		if item == nil {
+			return nil
+		}
+		list.Items = append(list.Items, item)
+		if !p.curTokenIs(lexer.TokenComma) {
+			break
+		}
+		p.nextToken() // consume ','
+	}
+	if !p.expect(lexer.TokenRBrace) {
+		return nil
+	}
+	return list
+}
+
+// parseDesignated parses an array designator and the initializer it
+// applies to: [2] = v, or the GNU range [2 ... 5] = v. The bounds must be
+// integer constant expressions and are evaluated here, where the
+// enumerators are known.
+func (p *Parser) parseDesignated() cabs.Expr {
+	p.nextToken() // consume '['
+	index, ok := p.designatorBound()
+	if !ok {
+		return nil
+	}
+	last := index
+	if p.curTokenIs(lexer.TokenEllipsis) {
+		p.extension(p.curToken, "range designator")
+		p.nextToken() // consume '...'
+		if last, ok = p.designatorBound(); !ok {
+			return nil
+		}
+		if last < index {
+			p.addError("empty range in array designator")
+			return nil
+		}
+	}
+	if !p.expect(lexer.TokenRBracket) || !p.expect(lexer.TokenAssign) {
+		return nil
+	}
+	value := p.parseInitializer()
+	if value == nil {
+		return nil
+	}
+	return cabs.Designated{Index: index, Last: last, Value: value}
+}
+
+// designatorBound parses and evaluates a bound of an array designator.
+func (p *Parser) designatorBound() (int64, bool) {
+	bound := p.parseExprPrec(precTernary)
+	if bound == nil {
+		return 0, false
+	}
+	n, ok := cabs.EvalConst(bound, p.enumConsts)
+	if !ok {
+		p.addError("array designator must be an integer constant expression")
+		return 0, false
+	}
+	if n < 0 {
+		p.addError("array designator index is negative")
+		return 0, false
+	}
+	return n, true
 }
 
 func (p *Parser) parseIfStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'if'
 
 	if !p.expect(lexer.TokenLParen) {
@@ -1991,7 +2487,7 @@ func (p *Parser) parseIfStatement() cabs.Stmt {
 		return nil
 	}
 
-	then := p.parseStatement()
+	then := p.parseBody()
 	if then == nil {
 		return nil
 	}
@@ -1999,13 +2495,14 @@ func (p *Parser) parseIfStatement() cabs.Stmt {
 	var els cabs.Stmt
 	if p.curTokenIs(lexer.TokenElse) {
 		p.nextToken() // consume 'else'
-		els = p.parseStatement()
+		els = p.parseBody()
 	}
 
-	return cabs.If{Cond: cond, Then: then, Else: els}
+	return cabs.If{Cond: cond, Then: then, Else: els, Pos: pos}
 }
 
 func (p *Parser) parseWhileStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'while'
 
 	if !p.expect(lexer.TokenLParen) {
@@ -2021,18 +2518,19 @@ func (p *Parser) parseWhileStatement() cabs.Stmt {
 		return nil
 	}
 
-	body := p.parseStatement()
+	body := p.parseBody()
 	if body == nil {
 		return nil
 	}
 
-	return cabs.While{Cond: cond, Body: body}
+	return cabs.While{Cond: cond, Body: body, Pos: pos}
 }
 
 func (p *Parser) parseDoWhileStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'do'
 
-	body := p.parseStatement()
+	body := p.parseBody()
 	if body == nil {
 		return nil
 	}
@@ -2060,12 +2558,17 @@ func (p *Parser) parseDoWhileStatement() cabs.Stmt {
 		return nil
 	}
 
-	return cabs.DoWhile{Body: body, Cond: cond}
+	return cabs.DoWhile{Body: body, Cond: cond, Pos: pos}
 }
 
 func (p *Parser) parseForStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'for'
 
+	// Names declared in the init clause are scoped to the loop
+	p.openScope()
+	defer p.closeScope()
+
 	if !p.expect(lexer.TokenLParen) {
 		return nil
 	}
@@ -2107,12 +2610,12 @@ func (p *Parser) parseForStatement() cabs.Stmt {
 		return nil
 	}
 
-	body := p.parseStatement()
+	body := p.parseBody()
 	if body == nil {
 		return nil
 	}
 
-	return cabs.For{Init: init, InitDecl: initDecl, Cond: cond, Step: step, Body: body}
+	return cabs.For{Init: init, InitDecl: initDecl, Cond: cond, Step: step, Body: body, Pos: pos}
 }
 
 // parseForDeclaration parses a C99 for-loop declaration (without trailing semicolon)
@@ -2134,6 +2637,7 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 	}
 
 	baseType := p.parseCompoundTypeSpecifier()
+	typeofOperand := p.takeTypeof(baseType)
 
 	var decls []cabs.Decl
 
@@ -2156,8 +2660,10 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 			p.addError(fmt.Sprintf("expected identifier in for-loop declaration, got %s", p.curToken.Type))
 			return nil
 		}
+		namePos := tokenPos(p.curToken)
 		name := p.curToken.Literal
 		p.nextToken()
+		p.declareOrdinary(name)
 
 		// Check for array declarator
 		var arrayDims []cabs.Expr
@@ -2170,7 +2676,7 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 				if sizeExpr == nil {
 					return nil
 				}
-				arrayDims = append(arrayDims, sizeExpr)
+				arrayDims = append(arrayDims, p.arraySize(sizeExpr))
 			}
 			if !p.expect(lexer.TokenRBracket) {
 				return nil
@@ -2181,7 +2687,7 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 		// Check for initializer
 		if p.curTokenIs(lexer.TokenAssign) {
 			p.nextToken() // consume '='
-			init = p.parseExprPrec(precAssign)
+			init = p.parseInitializer()
 			if init == nil {
 				return nil
 			}
@@ -2192,6 +2698,8 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 			Name:        name,
 			ArrayDims:   arrayDims,
 			Initializer: init,
+			Typeof:      typeofOperand,
+			Pos:         namePos,
 		})
 
 		// Check for more declarators
@@ -2205,26 +2713,29 @@ func (p *Parser) parseForDeclaration() []cabs.Decl {
 }
 
 func (p *Parser) parseBreakStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'break'
 
 	if !p.expect(lexer.TokenSemicolon) {
 		return nil
 	}
 
-	return cabs.Break{}
+	return cabs.Break{Pos: pos}
 }
 
 func (p *Parser) parseContinueStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'continue'
 
 	if !p.expect(lexer.TokenSemicolon) {
 		return nil
 	}
 
-	return cabs.Continue{}
+	return cabs.Continue{Pos: pos}
 }
 
 func (p *Parser) parseSwitchStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'switch'
 
 	if !p.expect(lexer.TokenLParen) {
@@ -2248,15 +2759,27 @@ func (p *Parser) parseSwitchStatement() cabs.Stmt {
 
 	var cases []cabs.SwitchCase
 	for !p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
+		start := p.curToken
 		c := p.parseSwitchCase()
 		if c != nil {
 			cases = append(cases, *c)
+		} else {
+			// Error recovery: skip to the next case. A case that failed
+			// without consuming anything would fail again at the same
+			// token, so at least that token is skipped.
+			if p.curToken == start {
+				p.nextToken()
+			}
+			for !p.curTokenIs(lexer.TokenCase) && !p.curTokenIs(lexer.TokenDefault) &&
+				!p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
+				p.nextToken()
+			}
 		}
 	}
 
 	p.nextToken() // consume '}'
 
-	return cabs.Switch{Expr: expr, Cases: cases}
+	return cabs.Switch{Expr: expr, Cases: cases, Pos: pos}
 }
 
 func (p *Parser) parseSwitchCase() *cabs.SwitchCase {
@@ -2284,9 +2807,16 @@ func (p *Parser) parseSwitchCase() *cabs.SwitchCase {
 	var stmts []cabs.Stmt
 	for !p.curTokenIs(lexer.TokenCase) && !p.curTokenIs(lexer.TokenDefault) &&
 		!p.curTokenIs(lexer.TokenRBrace) && !p.curTokenIs(lexer.TokenEOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
-			stmts = append(stmts, stmt)
+			stmts = p.appendAnnotated(stmts, start, stmt)
+		} else {
+			// Error recovery as in a block
+			if p.curToken == start {
+				p.nextToken()
+			}
+			p.syncToStmtEnd()
 		}
 	}
 
@@ -2294,6 +2824,7 @@ func (p *Parser) parseSwitchCase() *cabs.SwitchCase {
 }
 
 func (p *Parser) parseGotoStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'goto'
 
 	if !p.curTokenIs(lexer.TokenIdent) {
@@ -2307,10 +2838,11 @@ func (p *Parser) parseGotoStatement() cabs.Stmt {
 		return nil
 	}
 
-	return cabs.Goto{Label: label}
+	return cabs.Goto{Label: label, Pos: pos}
 }
 
 func (p *Parser) parseLabelStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	label := p.curToken.Literal
 	p.nextToken() // consume label name
 	p.nextToken() // consume ':'
@@ -2320,10 +2852,11 @@ func (p *Parser) parseLabelStatement() cabs.Stmt {
 		return nil
 	}
 
-	return cabs.Label{Name: label, Stmt: stmt}
+	return cabs.Label{Name: label, Stmt: stmt, Pos: pos}
 }
 
 func (p *Parser) parseReturnStatement() cabs.Stmt {
+	pos := tokenPos(p.curToken)
 	p.nextToken() // consume 'return'
 
 	var expr cabs.Expr
@@ -2335,7 +2868,7 @@ func (p *Parser) parseReturnStatement() cabs.Stmt {
 		return nil
 	}
 
-	return cabs.Return{Expr: expr}
+	return cabs.Return{Expr: expr, Pos: pos}
 }
 
 // parseExpression is the entry point for expression parsing
@@ -2400,52 +2933,139 @@ func (p *Parser) parsePrefix() cabs.Expr {
 	}
 }
 
+// parseIntegerLiteral parses an integer constant and gives it the first
+// type of C11 6.4.4.1 that can represent it, for its suffix and base:
+// a decimal literal without u suffix stays signed, while a hexadecimal or
+// octal one may take the unsigned type of each rank. long and long long
+// are both 64 bits, so an l or ll suffix only ranks the literal as long.
 func (p *Parser) parseIntegerLiteral() cabs.Expr {
 	lit := p.curToken.Literal
-	// Strip integer suffix (u, U, l, L, ll, LL, ul, UL, etc.)
-	cleanLit := lit
-	for len(cleanLit) > 0 {
-		last := cleanLit[len(cleanLit)-1]
-		if last == 'u' || last == 'U' || last == 'l' || last == 'L' {
-			cleanLit = cleanLit[:len(cleanLit)-1]
-		} else {
-			break
-		}
+	digits := strings.TrimRight(lit, "uUlL")
+	unsigned, long, ok := integerSuffix(lit[len(digits):])
+	if !ok {
+		p.addError(fmt.Sprintf("invalid suffix on integer literal: %s", lit))
+	}
+
+	base := 10
+	switch {
+	case len(digits) > 2 && (digits[:2] == "0x" || digits[:2] == "0X"):
+		base, digits = 16, digits[2:]
+	case len(digits) > 1 && digits[0] == '0':
+		base, digits = 8, digits[1:]
 	}
-	// ParseInt with base 0 auto-detects hex (0x), octal (0), or decimal
-	value, err := strconv.ParseInt(cleanLit, 0, 64)
+	value, err := strconv.ParseUint(digits, base, 64)
 	if err != nil {
-		// Fall back to parsing as unsigned for large values
-		uval, uerr := strconv.ParseUint(cleanLit, 0, 64)
-		if uerr != nil {
-			p.addError(fmt.Sprintf("invalid integer literal: %s", lit))
-			value = 0
+		if errors.Is(err, strconv.ErrRange) {
+			p.addError(fmt.Sprintf("integer literal is too large: %s", lit))
 		} else {
-			value = int64(uval)
+			p.addError(fmt.Sprintf("invalid integer literal: %s", lit))
 		}
+		value = 0
 	}
 	p.nextToken() // move past the literal
-	return cabs.Constant{Value: value}
+
+	typ := "int"
+	switch {
+	case !long && !unsigned && value <= math.MaxInt32:
+	case !long && (unsigned || base != 10) && value <= math.MaxUint32:
+		typ = "unsigned int"
+	case !unsigned && value <= math.MaxInt64:
+		typ = "long"
+	default:
+		// Also a decimal literal too large for long, as GCC has it
+		typ = "unsigned long"
+	}
+	// The type the value alone gives is left implicit
+	if typ == "int" || (typ == "long" && value > math.MaxInt32) {
+		typ = ""
+	}
+	return cabs.Constant{Value: int64(value), Type: typ}
+}
+
+// integerSuffix decodes the suffix of an integer literal: at most one u
+// and one l or ll, in either order, with the letters of ll in one case.
+func integerSuffix(suffix string) (unsigned, long, ok bool) {
+	lower := strings.ToLower(suffix)
+	if strings.HasPrefix(lower, "u") {
+		unsigned, suffix = true, suffix[1:]
+	} else if strings.HasSuffix(lower, "u") {
+		unsigned, suffix = true, suffix[:len(suffix)-1]
+	}
+	switch suffix {
+	case "":
+		return unsigned, false, true
+	case "l", "L", "ll", "LL":
+		return unsigned, true, true
+	}
+	return false, false, false
 }
 
 func (p *Parser) parseStringLiteral() cabs.Expr {
-	value := p.curToken.Literal
+	value, encoding := p.curToken.Literal, p.curToken.Encoding
 	p.nextToken() // move past the literal
-	return cabs.StringLiteral{Value: value}
+	return cabs.StringLiteral{Value: value, Encoding: encoding}
 }
 
 func (p *Parser) parseCharLiteral() cabs.Expr {
-	value := p.curToken.Literal
+	value, encoding := p.curToken.Literal, p.curToken.Encoding
 	p.nextToken() // move past the literal
-	return cabs.CharLiteral{Value: value}
+	return cabs.CharLiteral{Value: value, Encoding: encoding}
 }
 
 func (p *Parser) parseIdentifier() cabs.Expr {
 	name := p.curToken.Literal
+	if name == "__builtin_va_arg" && p.peekTokenIs(lexer.TokenLParen) {
+		return p.parseVaArg()
+	}
 	p.nextToken() // move past the identifier
 	return cabs.Variable{Name: name}
 }
 
+// parseVaArg parses __builtin_va_arg(ap, type). Its second operand is a
+// type name, so it cannot be parsed as an ordinary call.
+func (p *Parser) parseVaArg() cabs.Expr {
+	p.nextToken() // consume '__builtin_va_arg'
+	p.nextToken() // consume '('
+
+	ap := p.parseExprPrec(precAssign)
+	if ap == nil {
+		return nil
+	}
+	if !p.curTokenIs(lexer.TokenComma) {
+		p.addError(fmt.Sprintf("expected ',' in __builtin_va_arg, got %s", p.curToken.Type))
+		return nil
+	}
+	p.nextToken() // consume ','
+
+	for p.isTypeQualifier() {
+		p.nextToken()
+	}
+	if !p.isTypeSpecifier() {
+		p.addError(fmt.Sprintf("expected type specifier in __builtin_va_arg, got %s", p.curToken.Type))
+		return nil
+	}
+	typeName := p.parseCompoundTypeSpecifier()
+	p.typeNameTypeof(typeName)
+	for p.isTypeQualifier() {
+		p.nextToken()
+	}
+	for p.curTokenIs(lexer.TokenStar) {
+		typeName = typeName + " *"
+		p.nextToken()
+		for p.isTypeQualifier() {
+			p.nextToken()
+		}
+	}
+
+	if !p.curTokenIs(lexer.TokenRParen) {
+		p.addError(fmt.Sprintf("expected ')' after type in __builtin_va_arg, got %s", p.curToken.Type))
+		return nil
+	}
+	p.nextToken() // consume ')'
+
+	return cabs.VaArg{Expr: ap, TypeName: typeName}
+}
+
 func (p *Parser) parseGroupedExpression() cabs.Expr {
 	// Disambiguate: (type)expr vs (expr)
 	// If we see '(' followed by a type specifier followed by ')', it's a cast
@@ -2453,6 +3073,11 @@ func (p *Parser) parseGroupedExpression() cabs.Expr {
 		return p.parseCast()
 	}
 
+	// GNU statement expression: ({ ... })
+	if p.peekTokenIs(lexer.TokenLBrace) {
+		return p.parseStmtExpr()
+	}
+
 	p.nextToken() // consume '('
 
 	expr := p.parseExpression()
@@ -2469,6 +3094,31 @@ func (p *Parser) parseGroupedExpression() cabs.Expr {
 	return cabs.Paren{Expr: expr}
 }
 
+// parseStmtExpr parses a GNU statement expression: ({ stmts; expr; })
+// The value of the trailing expression statement becomes the result.
+func (p *Parser) parseStmtExpr() cabs.Expr {
+	p.extension(p.curToken, "statement expression")
+	p.nextToken() // consume '('
+
+	block := p.parseBlock()
+
+	if !p.curTokenIs(lexer.TokenRParen) {
+		p.addError(fmt.Sprintf("expected ')' after statement expression, got %s", p.curToken.Type))
+		return nil
+	}
+	p.nextToken() // consume ')'
+
+	var result cabs.Expr
+	if n := len(block.Items); n > 0 {
+		if c, ok := block.Items[n-1].(cabs.Computation); ok {
+			result = c.Expr
+			block.Items = block.Items[:n-1]
+		}
+	}
+
+	return cabs.StmtExpr{Block: block, Result: result}
+}
+
 // parseCast parses a cast expression: (type)expr
 // Handles pointer types like (char*), (const void*), (unsigned int*)
 func (p *Parser) parseCast() cabs.Expr {
@@ -2485,21 +3135,15 @@ func (p *Parser) parseCast() cabs.Expr {
 		return nil
 	}
 	typeName := p.parseCompoundTypeSpecifier()
+	p.typeNameTypeof(typeName)
 
 	// Skip type qualifiers after base type (e.g., char const *)
 	for p.isTypeQualifier() {
 		p.nextToken()
 	}
 
-	// Handle pointer markers
-	for p.curTokenIs(lexer.TokenStar) {
-		typeName = typeName + " *"
-		p.nextToken()
-		// Skip qualifiers after pointer (const volatile *)
-		for p.isTypeQualifier() {
-			p.nextToken()
-		}
-	}
+	// Pointer and function pointer parts: (char *), (int (*)(int))
+	typeName = p.parseAbstractDeclarator(typeName)
 
 	if !p.curTokenIs(lexer.TokenRParen) {
 		p.addError(fmt.Sprintf("expected ')' after type in cast, got %s", p.curToken.Type))
@@ -2550,21 +3194,15 @@ func (p *Parser) parseSizeof() cabs.Expr {
 				return nil
 			}
 			typeName := p.parseCompoundTypeSpecifier()
+			p.typeNameTypeof(typeName)
 
 			// Skip type qualifiers after base type
 			for p.isTypeQualifier() {
 				p.nextToken()
 			}
 
-			// Handle pointer markers
-			for p.curTokenIs(lexer.TokenStar) {
-				typeName = typeName + " *"
-				p.nextToken()
-				// Skip qualifiers after pointer
-				for p.isTypeQualifier() {
-					p.nextToken()
-				}
-			}
+			// Pointer, array and function parts: int *, char[10], int (*)(int)
+			typeName = p.parseAbstractDeclarator(typeName)
 
 			if !p.curTokenIs(lexer.TokenRParen) {
 				p.addError(fmt.Sprintf("expected ')' after type in sizeof, got %s", p.curToken.Type))
@@ -2584,6 +3222,55 @@ func (p *Parser) parseSizeof() cabs.Expr {
 	return cabs.SizeofExpr{Expr: expr}
 }
 
+// parseAbstractDeclarator parses the declarator without a name that follows
+// the base type of a type name and returns the complete type name: the
+// pointers of "int *", the array of "char[10]" or the function pointer of
+// "int (*)(int)". Array sizes must be constant and are folded, so
+// sizeof(int[2 * 5]) names the type "int[10]".
+func (p *Parser) parseAbstractDeclarator(typeName string) string {
+	for p.curTokenIs(lexer.TokenStar) {
+		typeName = typeName + " *"
+		p.nextToken()
+		// Skip qualifiers after pointer (const volatile *)
+		for p.isTypeQualifier() {
+			p.nextToken()
+		}
+	}
+
+	// A parenthesized declarator binds its pointers first: int (*)[3]
+	if p.curTokenIs(lexer.TokenLParen) && p.peekTokenIs(lexer.TokenStar) {
+		p.nextToken() // consume '('
+		inner := strings.TrimSpace(p.parseAbstractDeclarator(""))
+		if !p.expect(lexer.TokenRParen) {
+			return typeName
+		}
+		typeName = typeName + " (" + inner + ")"
+	}
+
+	for {
+		switch {
+		case p.curTokenIs(lexer.TokenLBracket):
+			p.nextToken() // consume '['
+			dim := ""
+			if !p.curTokenIs(lexer.TokenRBracket) {
+				size, ok := cabs.EvalConst(p.parseExpression(), p.enumConsts)
+				if !ok {
+					p.addError("array size in a type name must be an integer constant")
+				}
+				dim = strconv.FormatInt(size, 10)
+			}
+			if !p.expect(lexer.TokenRBracket) {
+				return typeName
+			}
+			typeName = typeName + "[" + dim + "]"
+		case p.curTokenIs(lexer.TokenLParen):
+			typeName = typeName + "(" + p.parseFunctionPointerParams() + ")"
+		default:
+			return typeName
+		}
+	}
+}
+
 // isTypeSpecifierPeek checks if the peek token starts a type (for cast/sizeof disambiguation)
 // This includes type qualifiers since (const char*) is a valid cast
 func (p *Parser) isTypeSpecifierPeek() bool {
@@ -2591,11 +3278,11 @@ func (p *Parser) isTypeSpecifierPeek() bool {
 	case lexer.TokenInt_, lexer.TokenVoid, lexer.TokenChar, lexer.TokenShort,
 		lexer.TokenLong, lexer.TokenFloat, lexer.TokenDouble,
 		lexer.TokenSigned, lexer.TokenUnsigned, lexer.TokenStruct,
-		lexer.TokenUnion, lexer.TokenEnum,
+		lexer.TokenUnion, lexer.TokenEnum, lexer.TokenTypeof,
 		lexer.TokenConst, lexer.TokenVolatile, lexer.TokenRestrict:
 		return true
 	case lexer.TokenIdent:
-		return p.typedefs[p.peekToken.Literal]
+		return p.isTypedefName(p.peekToken.Literal)
 	}
 	return false
 }
@@ -2641,11 +3328,15 @@ func (p *Parser) parseInfix(left cabs.Expr) cabs.Expr {
 	}
 
 	prec := p.curPrecedence()
+	opPos := tokenPos(p.curToken)
 	p.nextToken() // consume operator
 
 	// Right-associative for all assignment operators
 	if isAssignOp(op) {
 		prec--
+		if !isLvalue(left) {
+			p.diags.Errorf(opPos, "lvalue", "lvalue required as left operand of assignment")
+		}
 	}
 
 	right := p.parseExprPrec(prec)
@@ -2667,6 +3358,20 @@ func isAssignOp(op cabs.BinaryOp) bool {
 	return false
 }
 
+// isLvalue reports whether an expression designates an object, so that it
+// can be assigned: a variable, a dereference, an array element or a member
+func isLvalue(e cabs.Expr) bool {
+	switch e := e.(type) {
+	case cabs.Variable, cabs.Index, cabs.Member:
+		return true
+	case cabs.Unary:
+		return e.Op == cabs.OpDeref
+	case cabs.Paren:
+		return isLvalue(e.Expr)
+	}
+	return false
+}
+
 // parseMember parses member access: s.x or p->y
 func (p *Parser) parseMember(expr cabs.Expr) cabs.Expr {
 	isArrow := p.curTokenIs(lexer.TokenArrow)
@@ -2881,7 +3586,18 @@ func (p *Parser) ParseProgram() *cabs.Program {
 		Definitions: []cabs.Definition{},
 	}
 
-	for !p.curTokenIs(lexer.TokenEOF) {
+	// Stop at the end of the input, or once the emitter has seen too many
+	// errors to be worth going on
+	for !p.curTokenIs(lexer.TokenEOF) && !p.diags.Stopped() {
+		// A stray ';' between definitions is an empty declaration, which
+		// ISO C does not allow but compilers accept
+		if p.curTokenIs(lexer.TokenSemicolon) {
+			p.diags.Warnf(tokenPos(p.curToken), "extra-semi",
+				"extra ';' outside of a function")
+			p.nextToken()
+			continue
+		}
+		start := p.curToken
 		def := p.ParseDefinition()
 		if def != nil {
 			// Insert any inline definitions collected during parsing BEFORE the definition
@@ -2890,9 +3606,19 @@ func (p *Parser) ParseProgram() *cabs.Program {
 				program.Definitions = append(program.Definitions, p.inlineDefs...)
 				p.inlineDefs = nil // reset for next definition
 			}
+			if d, ok := def.(cabs.TypedefDef); ok {
+				p.typedefSpecs[d.Name] = d.TypeSpec
+			}
 			program.Definitions = append(program.Definitions, def)
+			program.Definitions = append(program.Definitions, p.followingDefs...)
+			p.followingDefs = nil
 		} else {
-			// Skip to next definition on error
+			// Skip to next definition on error. A definition that failed
+			// without consuming anything would fail again at the same
+			// token, so at least that token is skipped.
+			if p.curToken == start {
+				p.nextToken()
+			}
 			p.skipToNextDefinition()
 		}
 	}
@@ -1,11 +1,18 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/raymyers/ralph-cc/pkg/cabs"
+	"github.com/raymyers/ralph-cc/pkg/diag"
 	"github.com/raymyers/ralph-cc/pkg/lexer"
 	"gopkg.in/yaml.v3"
 )
@@ -50,7 +57,15 @@ func TestParseYAML(t *testing.T) {
 		t.Fatalf("failed to parse parse.yaml: %v", err)
 	}
 
+	// RALPH_TEST_FILTER selects the cases to run by name
+	filter, err := regexp.Compile(os.Getenv("RALPH_TEST_FILTER"))
+	if err != nil {
+		t.Fatalf("invalid RALPH_TEST_FILTER: %v", err)
+	}
 	for _, tc := range testFile.Tests {
+		if !filter.MatchString(tc.Name) {
+			continue
+		}
 		t.Run(tc.Name, func(t *testing.T) {
 			l := lexer.New(tc.Input)
 			p := New(l)
@@ -248,6 +263,43 @@ func TestEmptyFunction(t *testing.T) {
 	}
 }
 
+func TestEmptyStatements(t *testing.T) {
+	input := `int f(){ ; ; return 0; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	funDef := def.(cabs.FunDef)
+	want := []cabs.Stmt{cabs.Skip{}, cabs.Skip{}, cabs.Return{Expr: cabs.Constant{Value: 0}, Pos: diag.Pos{Line: 1, Col: 14}}}
+	if !reflect.DeepEqual(funDef.Body.Items, want) {
+		t.Errorf("expected %#v, got %#v", want, funDef.Body.Items)
+	}
+}
+
+func TestEmptyDeclarationAtFileScope(t *testing.T) {
+	input := `int x; ; int f(void) { return 0; };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Definitions) != 2 {
+		t.Fatalf("expected 2 definitions, got %d", len(program.Definitions))
+	}
+	diags := p.Diagnostics()
+	if len(diags) != 2 || diags[0].Code != "extra-semi" || diags[0].Pos != (diag.Pos{Line: 1, Col: 8}) {
+		t.Errorf("expected two extra-semi warnings, got %v", diags)
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `int f() { return 42; }`
 
@@ -366,6 +418,61 @@ func TestOperatorPrecedence(t *testing.T) {
 	}
 }
 
+func TestAssignmentAndConditionalPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// The conditional binds tighter than assignment
+		{"int f() { return a = b ? c : d; }", "(a = (b ? c : d))"},
+		{"int f() { return a += b ? c : d; }", "(a += (b ? c : d))"},
+		// Assignments group right to left
+		{"int f() { return a = b = c ? d : e; }", "(a = (b = (c ? d : e)))"},
+		{"int f() { return a = b += c; }", "(a = (b += c))"},
+		// So do conditionals, through the else branch
+		{"int f() { return a ? b : c ? d : e; }", "(a ? b : (c ? d : e))"},
+		{"int f() { return a ? b ? c : d : e; }", "(a ? (b ? c : d) : e)"},
+		// The middle operand is a full expression, the condition a
+		// logical-OR expression
+		{"int f() { return a ? b = c : d; }", "(a ? (b = c) : d)"},
+		{"int f() { return a || b ? c : d; }", "((a || b) ? c : d)"},
+		// The comma operator binds loosest
+		{"int f() { return a = b, c; }", "((a = b) , c)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			def := p.ParseDefinition()
+
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			funDef := def.(cabs.FunDef)
+			ret := funDef.Body.Items[0].(cabs.Return)
+			actual := exprString(ret.Expr)
+
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAssignmentToConditional(t *testing.T) {
+	// In C, unlike C++, a ? b : c = d assigns to the whole conditional,
+	// which is not an lvalue
+	p := New(lexer.New("int f() { a ? b : c = d; }"))
+	p.ParseDefinition()
+
+	errs := p.Errors()
+	if len(errs) != 1 || !strings.HasSuffix(errs[0], "lvalue required as left operand of assignment") {
+		t.Fatalf("expected an lvalue error, got %v", errs)
+	}
+}
+
 func TestUnaryExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -668,6 +775,67 @@ func TestFunctionCall(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteral(t *testing.T) {
+	tests := []struct {
+		input string
+		want  cabs.Constant
+	}{
+		{"42", cabs.Constant{Value: 42}},
+		{"2147483648", cabs.Constant{Value: 2147483648}},
+		{"0x7fffffff", cabs.Constant{Value: 0x7fffffff}},
+		{"0x80000000", cabs.Constant{Value: 0x80000000, Type: "unsigned int"}},
+		{"0777", cabs.Constant{Value: 511}},
+		{"0", cabs.Constant{Value: 0}},
+		{"1u", cabs.Constant{Value: 1, Type: "unsigned int"}},
+		{"4294967296U", cabs.Constant{Value: 4294967296, Type: "unsigned long"}},
+		{"10L", cabs.Constant{Value: 10, Type: "long"}},
+		{"10ll", cabs.Constant{Value: 10, Type: "long"}},
+		{"10lu", cabs.Constant{Value: 10, Type: "unsigned long"}},
+		{"18446744073709551615UL", cabs.Constant{Value: -1, Type: "unsigned long"}},
+		{"0xFFFFFFFFFFFFFFFF", cabs.Constant{Value: -1, Type: "unsigned long"}},
+		{"9223372036854775807", cabs.Constant{Value: 9223372036854775807}},
+		{"9223372036854775808", cabs.Constant{Value: -9223372036854775808, Type: "unsigned long"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New("int f() { return " + tt.input + "; }"))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			got := def.(cabs.FunDef).Body.Items[0].(cabs.Return).Expr
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"18446744073709551616", "integer literal is too large: 18446744073709551616"},
+		{"0x10000000000000000UL", "integer literal is too large: 0x10000000000000000UL"},
+		{"099", "invalid integer literal: 099"},
+		{"1lul", "invalid suffix on integer literal: 1lul"},
+		{"1lL", "invalid suffix on integer literal: 1lL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New("int f() { return " + tt.input + "; }"))
+			p.ParseDefinition()
+			errs := p.Errors()
+			if len(errs) == 0 || !strings.Contains(errs[0], tt.want) {
+				t.Errorf("expected error %q, got %v", tt.want, errs)
+			}
+		})
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -704,6 +872,24 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestWideStringLiteral(t *testing.T) {
+	l := lexer.New(`void f() { g(L"abc", u'x'); }`)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	call := def.(cabs.FunDef).Body.Items[0].(cabs.Computation).Expr.(cabs.Call)
+	if got, want := call.Args[0], (cabs.StringLiteral{Value: "abc", Encoding: "L"}); got != want {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+	if got, want := call.Args[1], (cabs.CharLiteral{Value: "x", Encoding: "u"}); got != want {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
 func TestCharLiteral(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -1073,6 +1259,11 @@ func TestSizeofType(t *testing.T) {
 	}{
 		{"sizeof int", "int f() { return sizeof(int); }", "int"},
 		{"sizeof void", "int f() { return sizeof(void); }", "void"},
+		{"sizeof pointer", "int f() { return sizeof(int*); }", "int *"},
+		{"sizeof array", "int f() { return sizeof(int[10]); }", "int[10]"},
+		{"sizeof constant array size", "int f() { return sizeof(char[2*4]); }", "char[8]"},
+		{"sizeof array of pointers", "int f() { return sizeof(int *[3]); }", "int *[3]"},
+		{"sizeof pointer to array", "int f() { return sizeof(int (*)[3]); }", "int (*)[3]"},
 	}
 
 	for _, tt := range tests {
@@ -1623,6 +1814,70 @@ func TestGotoStatement(t *testing.T) {
 	}
 }
 
+func TestGotoIntoSwitchCase(t *testing.T) {
+	input := `int f(int x) { switch (x) { case 0: goto later; case 1: return 5; case 2: later: return 9; } return 0; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	sw, ok := def.(cabs.FunDef).Body.Items[0].(cabs.Switch)
+	if !ok {
+		t.Fatalf("expected Switch, got %T", def.(cabs.FunDef).Body.Items[0])
+	}
+	if len(sw.Cases) != 3 {
+		t.Fatalf("expected 3 cases, got %d", len(sw.Cases))
+	}
+
+	gotoStmt, ok := sw.Cases[0].Stmts[0].(cabs.Goto)
+	if !ok || gotoStmt.Label != "later" {
+		t.Errorf("expected goto later in case 0, got %#v", sw.Cases[0].Stmts[0])
+	}
+
+	// The label belongs to the body of case 2, wrapping its return
+	labelStmt, ok := sw.Cases[2].Stmts[0].(cabs.Label)
+	if !ok || labelStmt.Name != "later" {
+		t.Fatalf("expected label later in case 2, got %#v", sw.Cases[2].Stmts[0])
+	}
+	if _, ok := labelStmt.Stmt.(cabs.Return); !ok {
+		t.Errorf("expected Return inside label, got %T", labelStmt.Stmt)
+	}
+}
+
+func TestBlockScopePrototype(t *testing.T) {
+	input := `int f(int x) { double g(double), y; int h(void) = 0; return g(x); }`
+
+	p := New(lexer.New(input))
+	p.ParseDefinition()
+	// The function cannot be initialized
+	if errs := p.Errors(); len(errs) != 1 || !strings.Contains(errs[0], "function h is initialized") {
+		t.Fatalf("expected an error for initializing h, got %v", errs)
+	}
+
+	p = New(lexer.New(`int f(int x) { double g(double), y; return g(x); }`))
+	def := p.ParseDefinition()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	decl, ok := def.(cabs.FunDef).Body.Items[0].(cabs.DeclStmt)
+	if !ok || len(decl.Decls) != 2 {
+		t.Fatalf("expected a DeclStmt of 2 declarators, got %#v", def.(cabs.FunDef).Body.Items[0])
+	}
+	want := []cabs.Decl{
+		{StorageClass: "extern", TypeSpec: "double(double)", Name: "g"},
+		{TypeSpec: "double", Name: "y"},
+	}
+	for i, d := range decl.Decls {
+		if d.StorageClass != want[i].StorageClass || d.TypeSpec != want[i].TypeSpec || d.Name != want[i].Name {
+			t.Errorf("declarator %d = %+v, want %+v", i, d, want[i])
+		}
+	}
+}
+
 func TestLabelStatement(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -2195,6 +2450,32 @@ func TestVLADimensionExpressions(t *testing.T) {
 	}
 }
 
+func TestConstantArraySize(t *testing.T) {
+	input := `enum { N = 4 };
+int g[N * 2];
+int f(int n) { int t[sizeof(int) * N]; int v[n + N]; return 0; }`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	// The enumerator folds into a constant size
+	if dims := program.Definitions[1].(cabs.VarDef).ArrayDims; !reflect.DeepEqual(dims, []cabs.Expr{cabs.Constant{Value: 8}}) {
+		t.Errorf("g: expected the size 8, got %#v", dims)
+	}
+	body := program.Definitions[2].(cabs.FunDef).Body.Items
+	// sizeof is left for the size of int to be known
+	want := cabs.Binary{Op: cabs.OpMul, Left: cabs.SizeofType{TypeName: "int"}, Right: cabs.Constant{Value: 4}}
+	if dim := body[0].(cabs.DeclStmt).Decls[0].ArrayDims[0]; !reflect.DeepEqual(dim, want) {
+		t.Errorf("t: expected %#v, got %#v", want, dim)
+	}
+	want = cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "n"}, Right: cabs.Constant{Value: 4}}
+	if dim := body[1].(cabs.DeclStmt).Decls[0].ArrayDims[0]; !reflect.DeepEqual(dim, want) {
+		t.Errorf("v: expected %#v, got %#v", want, dim)
+	}
+}
+
 func TestPointerDeclaration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -2268,6 +2549,12 @@ func TestTypedefDeclaration(t *testing.T) {
 			typeName: "int*",
 			defName:  "intptr",
 		},
+		{
+			name:     "typedef after __extension__",
+			input:    `__extension__ typedef long long llong;`,
+			typeName: "long long",
+			defName:  "llong",
+		},
 	}
 
 	for _, tt := range tests {
@@ -2296,6 +2583,34 @@ func TestTypedefDeclaration(t *testing.T) {
 	}
 }
 
+func TestExtensionKeyword(t *testing.T) {
+	// __extension__ before a declaration, statement or expression leaves
+	// the program as it is without it
+	input := `__extension__ typedef long long llong;
+__extension__ extern int g;
+int f(int x) {
+  __extension__ llong y = __extension__ (x + 1);
+  __extension__ y++;
+  return __extension__ ({ int z = x; z; }) + (int) __extension__ y;
+}`
+	print := func(src string) string {
+		p := New(lexer.New(src))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		var out bytes.Buffer
+		cabs.NewPrinter(&out).PrintProgram(program)
+		return out.String()
+	}
+
+	got := print(input)
+	want := print(strings.ReplaceAll(input, "__extension__ ", ""))
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
 func TestTypedefUse(t *testing.T) {
 	// Test that typedef names are recognized as types in subsequent parsing
 	input := `typedef int myint; myint f() { return 0; }`
@@ -2330,6 +2645,92 @@ func TestTypedefUse(t *testing.T) {
 	}
 }
 
+func TestStructTagAndTypedefForms(t *testing.T) {
+	// Foo x; via a typedef of the tag, and struct Foo used directly,
+	// including after a forward declaration inside a function body
+	tests := []struct {
+		name  string
+		input string
+		want  []string // declared types in f's body, in order
+	}{
+		{
+			"typedef of a tag",
+			`typedef struct Foo Foo; struct Foo { int a; }; int f(void) { Foo x; Foo *p; p = (Foo *)0; return sizeof(Foo); }`,
+			[]string{"Foo", "Foo*"},
+		},
+		{
+			"tag without typedef",
+			`struct Foo { int a; }; int f(void) { struct Foo x; struct Foo *p; p = (struct Foo *)0; return sizeof(struct Foo); }`,
+			[]string{"struct Foo", "struct Foo*"},
+		},
+		{
+			"forward declaration at file scope",
+			`struct Foo; int f(void) { struct Foo *p; p = 0; return p == 0; }`,
+			[]string{"struct Foo*"},
+		},
+		{
+			"forward declaration in the body",
+			`int f(void) { struct Foo; struct Foo *p; p = 0; return p == 0; }`,
+			[]string{"", "struct Foo*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			var f *cabs.FunDef
+			for _, def := range program.Definitions {
+				if fd, ok := def.(cabs.FunDef); ok && fd.Name == "f" {
+					f = &fd
+				}
+			}
+			if f == nil {
+				t.Fatalf("function f not found")
+			}
+			var got []string
+			for _, item := range f.Body.Items {
+				if decl, ok := item.(cabs.DeclStmt); ok {
+					if len(decl.Decls) == 0 {
+						got = append(got, "")
+						continue
+					}
+					got = append(got, decl.Decls[0].TypeSpec)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected declarations %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestForwardStructDeclaration(t *testing.T) {
+	input := `struct Foo; struct Foo { int a; };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Definitions) != 2 {
+		t.Fatalf("expected 2 definitions, got %d", len(program.Definitions))
+	}
+	if fwd := program.Definitions[0].(cabs.StructDef); fwd.Fields != nil {
+		t.Errorf("expected nil fields for the forward declaration, got %v", fwd.Fields)
+	}
+	if def := program.Definitions[1].(cabs.StructDef); len(def.Fields) != 1 {
+		t.Errorf("expected 1 field in the definition, got %d", len(def.Fields))
+	}
+}
+
 func TestTypedefInlineStructUnion(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -2648,6 +3049,97 @@ func TestUnionDefinition(t *testing.T) {
 	}
 }
 
+
+func TestStructDefinitionWithDeclarators(t *testing.T) {
+	tests := []struct {
+		input string
+		tag   string // name of the struct or union defined
+		vars  []cabs.VarDef
+	}{
+		{`struct S {int a;} x;`, "S", []cabs.VarDef{{Name: "x", TypeSpec: "struct S", Pos: diag.Pos{Line: 1, Col: 19}}}},
+		{`struct Point { int x; int y; } p1, *p2;`, "Point", []cabs.VarDef{
+			{Name: "p1", TypeSpec: "struct Point", Pos: diag.Pos{Line: 1, Col: 32}},
+			{Name: "p2", TypeSpec: "struct Point*", Quals: cabs.Qualifiers{Pointers: [][]cabs.TypeQualifier{nil}}, Pos: diag.Pos{Line: 1, Col: 37}},
+		}},
+		{`struct Point { int x, y; } p1, p2;`, "Point", []cabs.VarDef{
+			{Name: "p1", TypeSpec: "struct Point", Pos: diag.Pos{Line: 1, Col: 28}},
+			{Name: "p2", TypeSpec: "struct Point", Pos: diag.Pos{Line: 1, Col: 32}},
+		}},
+		{`struct { int a; } anon[2];`, "__anon_0", []cabs.VarDef{
+			{Name: "anon", TypeSpec: "struct __anon_0", ArrayDims: []cabs.Expr{cabs.Constant{Value: 2}}, Pos: diag.Pos{Line: 1, Col: 19}},
+		}},
+		{`union U { int i; char c; } u = {5};`, "U", []cabs.VarDef{
+			{Name: "u", TypeSpec: "union U", Initializer: cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 5}}}, Pos: diag.Pos{Line: 1, Col: 28}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			prog := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			if len(prog.Definitions) != 1+len(tt.vars) {
+				t.Fatalf("expected %d definitions, got %d: %#v", 1+len(tt.vars), len(prog.Definitions), prog.Definitions)
+			}
+
+			switch def := prog.Definitions[0].(type) {
+			case cabs.StructDef:
+				if def.Name != tt.tag || len(def.Fields) == 0 {
+					t.Errorf("expected struct %s with fields, got %#v", tt.tag, def)
+				}
+			case cabs.UnionDef:
+				if def.Name != tt.tag || len(def.Fields) == 0 {
+					t.Errorf("expected union %s with fields, got %#v", tt.tag, def)
+				}
+			default:
+				t.Fatalf("expected the type definition first, got %T", def)
+			}
+			for i, want := range tt.vars {
+				if got := prog.Definitions[1+i]; !reflect.DeepEqual(got, want) {
+					t.Errorf("definition %d: expected %#v, got %#v", 1+i, want, got)
+				}
+			}
+		})
+	}
+}
+
+// The declarators of a field declaration share its type specifier
+func TestStructFieldDeclaratorList(t *testing.T) {
+	p := New(lexer.New("struct S { int x, *y, z[2]; char c; };"))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	fields := prog.Definitions[0].(cabs.StructDef).Fields
+	want := []struct{ name, typeSpec string }{{"x", "int"}, {"y", "int*"}, {"z", "int[]"}, {"c", "char"}}
+	if len(fields) != len(want) {
+		t.Fatalf("expected %d fields, got %#v", len(want), fields)
+	}
+	for i, w := range want {
+		if fields[i].Name != w.name || fields[i].TypeSpec != w.typeSpec {
+			t.Errorf("field %d: expected %s %s, got %s %s", i, w.typeSpec, w.name, fields[i].TypeSpec, fields[i].Name)
+		}
+	}
+}
+
+// A definition without declarators still ends at its ';', so the next
+// definition may start with a typedef name
+func TestStructDefinitionFollowedByTypedefName(t *testing.T) {
+	p := New(lexer.New("typedef int myint; struct S { int a; }; myint x;"))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(prog.Definitions) != 3 {
+		t.Fatalf("expected 3 definitions, got %d: %#v", len(prog.Definitions), prog.Definitions)
+	}
+	if v, ok := prog.Definitions[2].(cabs.VarDef); !ok || v.Name != "x" || v.TypeSpec != "myint" {
+		t.Errorf("expected myint x, got %#v", prog.Definitions[2])
+	}
+}
+
 func TestEnumDefinition(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -2701,35 +3193,129 @@ func TestEnumDefinition(t *testing.T) {
 	}
 }
 
-func TestParseProgram(t *testing.T) {
+func TestEnumeratorValues(t *testing.T) {
 	tests := []struct {
-		name          string
-		input         string
-		expectedDefs  int
-		expectedTypes []string // types of definitions: "FunDef", "TypedefDef", "StructDef", etc.
+		name  string
+		input string
+		nums  []int64
 	}{
 		{
-			name:          "single function",
-			input:         `int main() { return 0; }`,
-			expectedDefs:  1,
-			expectedTypes: []string{"FunDef"},
+			name:  "implicit values",
+			input: `enum { A, B, C };`,
+			nums:  []int64{0, 1, 2},
 		},
 		{
-			name: "two functions",
-			input: `int add(int a, int b) { return a + b; }
-                    int main() { return 0; }`,
-			expectedDefs:  2,
-			expectedTypes: []string{"FunDef", "FunDef"},
+			name:  "negative value and increment after it",
+			input: `enum { A = -1, B, C = -10, D };`,
+			nums:  []int64{-1, 0, -10, -9},
 		},
 		{
-			name: "typedef and function",
-			input: `typedef int myint;
-                    myint f() { return 0; }`,
-			expectedDefs:  2,
-			expectedTypes: []string{"TypedefDef", "FunDef"},
+			name:  "expression using an earlier enumerator",
+			input: `enum { A = 4, B = A + 2, C = (B << 1) | 1, D };`,
+			nums:  []int64{4, 6, 13, 14},
 		},
 		{
-			name: "struct and function",
+			name:  "character constant and trailing comma",
+			input: `enum { A = 'x', B, C = '\n', };`,
+			nums:  []int64{120, 121, 10},
+		},
+		{
+			name:  "typedef body",
+			input: `typedef enum { A = 1 << 3, B = A - 1, C, } E;`,
+			nums:  []int64{8, 7, 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			enumDef, ok := def.(cabs.EnumDef)
+			if td, isTypedef := def.(cabs.TypedefDef); isTypedef {
+				enumDef, ok = td.InlineType.(cabs.EnumDef)
+			}
+			if !ok {
+				t.Fatalf("expected EnumDef, got %T", def)
+			}
+			if len(enumDef.Values) != len(tt.nums) {
+				t.Fatalf("expected %d values, got %d", len(tt.nums), len(enumDef.Values))
+			}
+			for i, v := range enumDef.Values {
+				if v.Num != tt.nums[i] {
+					t.Errorf("%s: expected %d, got %d", v.Name, tt.nums[i], v.Num)
+				}
+			}
+		})
+	}
+}
+
+func TestEnumeratorValueNotComputed(t *testing.T) {
+	p := New(lexer.New(`enum { A = sizeof(int), B };`))
+	p.ParseDefinition()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	diags := p.Diagnostics()
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || diags[0].Code != "enum-value" {
+		t.Errorf("expected an enum-value warning, got %v", diags)
+	}
+}
+
+func TestAssignmentToRvalue(t *testing.T) {
+	p := New(lexer.New(`void f(int a, int b, int c) { a + b = c; }`))
+	p.ParseDefinition()
+	errs := p.Diagnostics()
+	if len(errs) != 1 || errs[0].Code != "lvalue" || errs[0].Message != "lvalue required as left operand of assignment" {
+		t.Fatalf("expected an lvalue error, got %v", errs)
+	}
+	if errs[0].Pos.Col != 37 {
+		t.Errorf("expected the error at the '=', got column %d", errs[0].Pos.Col)
+	}
+}
+
+func TestAssignmentToLvalue(t *testing.T) {
+	for _, stmt := range []string{"*p = c;", "a[1] = c;", "s.x = c;", "ps->x += c;", "(a) = c;", "*(p + 1) = c;"} {
+		p := New(lexer.New("void f(int *p, int *a, int c) { " + stmt + " }"))
+		p.ParseDefinition()
+		if len(p.Diagnostics()) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", stmt, p.Diagnostics())
+		}
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedDefs  int
+		expectedTypes []string // types of definitions: "FunDef", "TypedefDef", "StructDef", etc.
+	}{
+		{
+			name:          "single function",
+			input:         `int main() { return 0; }`,
+			expectedDefs:  1,
+			expectedTypes: []string{"FunDef"},
+		},
+		{
+			name: "two functions",
+			input: `int add(int a, int b) { return a + b; }
+                    int main() { return 0; }`,
+			expectedDefs:  2,
+			expectedTypes: []string{"FunDef", "FunDef"},
+		},
+		{
+			name: "typedef and function",
+			input: `typedef int myint;
+                    myint f() { return 0; }`,
+			expectedDefs:  2,
+			expectedTypes: []string{"TypedefDef", "FunDef"},
+		},
+		{
+			name: "struct and function",
 			input: `struct Point { int x; int y; };
                     int main() { return 0; }`,
 			expectedDefs:  2,
@@ -2805,7 +3391,7 @@ func TestFunctionPointerDeclaration(t *testing.T) {
 		{
 			name:     "simple function pointer",
 			input:    `int f() { int (*fp)(int, int); return 0; }`,
-			typeName: "int(*)(int,int)",
+			typeName: "int(*)(int, int)",
 			varName:  "fp",
 		},
 		{
@@ -2820,6 +3406,12 @@ func TestFunctionPointerDeclaration(t *testing.T) {
 			typeName: "int(*)()",
 			varName:  "getter",
 		},
+		{
+			name:     "multi-word types",
+			input:    `int f() { unsigned long (*hash)(unsigned long, const char *); return 0; }`,
+			typeName: "unsigned long(*)(unsigned long, const char*)",
+			varName:  "hash",
+		},
 	}
 
 	for _, tt := range tests {
@@ -2849,6 +3441,170 @@ func TestFunctionPointerDeclaration(t *testing.T) {
 	}
 }
 
+func TestFunctionPointerMultiWordTypes(t *testing.T) {
+	input := `typedef unsigned long (*hash_fn)(unsigned long, const char *);
+unsigned long long (*g)(unsigned short n, char const *const s), (**h)(long long);
+`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	want := []struct{ name, typeSpec string }{
+		{"hash_fn", "unsigned long(*)(unsigned long, const char*)"},
+		{"g", "unsigned long long(*)(unsigned short, const char* const)"},
+		{"h", "unsigned long long(*(*))(long long)"},
+	}
+	if len(program.Definitions) != len(want) {
+		t.Fatalf("expected %d definitions, got %d", len(want), len(program.Definitions))
+	}
+	for i, w := range want {
+		var name, typeSpec string
+		switch def := program.Definitions[i].(type) {
+		case cabs.TypedefDef:
+			name, typeSpec = def.Name, def.TypeSpec
+		case cabs.VarDef:
+			name, typeSpec = def.Name, def.TypeSpec
+		default:
+			t.Fatalf("definition %d: unexpected %T", i, def)
+		}
+		if name != w.name || typeSpec != w.typeSpec {
+			t.Errorf("definition %d: got %s %q, want %s %q", i, name, typeSpec, w.name, w.typeSpec)
+		}
+	}
+}
+
+func TestArrayOfFunctionPointers(t *testing.T) {
+	input := `int (*arr[3])(void);
+typedef int (*fp)(int);
+fp table[4];
+int n, (*ops[2][5])(int, int) = {0};
+int f(void) { int (*loc[2])(int); return 0; }
+`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	want := []struct {
+		name, typeSpec string
+		dims           []int64
+	}{
+		{"arr", "int(*)(void)", []int64{3}},
+		{"table", "fp", []int64{4}},
+		{"n", "int", nil},
+		{"ops", "int(*)(int, int)", []int64{2, 5}},
+	}
+	var vars []cabs.VarDef
+	for _, def := range program.Definitions {
+		if v, ok := def.(cabs.VarDef); ok {
+			vars = append(vars, v)
+		}
+	}
+	if len(vars) != len(want) {
+		t.Fatalf("expected %d variables, got %d", len(want), len(vars))
+	}
+	dimsOf := func(exprs []cabs.Expr) []int64 {
+		var dims []int64
+		for _, e := range exprs {
+			n, _ := cabs.EvalConst(e, nil)
+			dims = append(dims, n)
+		}
+		return dims
+	}
+	for i, w := range want {
+		v := vars[i]
+		if v.Name != w.name || v.TypeSpec != w.typeSpec || !reflect.DeepEqual(dimsOf(v.ArrayDims), w.dims) {
+			t.Errorf("variable %d: got %s %q %v, want %s %q %v", i, v.Name, v.TypeSpec, dimsOf(v.ArrayDims), w.name, w.typeSpec, w.dims)
+		}
+	}
+	if vars[3].Initializer == nil {
+		t.Error("expected ops to keep its initializer")
+	}
+
+	fn := program.Definitions[len(program.Definitions)-1].(cabs.FunDef)
+	decl := fn.Body.Items[0].(cabs.DeclStmt).Decls[0]
+	if decl.Name != "loc" || decl.TypeSpec != "int(*)(int)" || !reflect.DeepEqual(dimsOf(decl.ArrayDims), []int64{2}) {
+		t.Errorf("local: got %s %q %v, want loc \"int(*)(int)\" [2]", decl.Name, decl.TypeSpec, dimsOf(decl.ArrayDims))
+	}
+}
+
+func TestLocalStorageClasses(t *testing.T) {
+	input := `int f(void) {
+	static int count, total;
+	register int r;
+	auto int a;
+	extern int e;
+	int plain;
+	return count;
+}`
+	p := New(lexer.New(input))
+	def := p.ParseDefinition()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	items := def.(cabs.FunDef).Body.Items
+
+	want := []struct{ name, storage string }{
+		{"count", "static"}, {"total", "static"}, {"r", "register"}, {"a", "auto"}, {"e", "extern"}, {"plain", ""},
+	}
+	var decls []cabs.Decl
+	for _, item := range items[:5] {
+		decls = append(decls, item.(cabs.DeclStmt).Decls...)
+	}
+	for i, w := range want {
+		if decls[i].Name != w.name || decls[i].StorageClass != w.storage {
+			t.Errorf("declarator %d: got %s with storage %q, want %s with %q", i, decls[i].Name, decls[i].StorageClass, w.name, w.storage)
+		}
+	}
+}
+
+func TestTypeof(t *testing.T) {
+	input := `int f(int i) {
+	typeof(i) j, *p;
+	__typeof__(unsigned long *) q;
+	for (typeof(i) n = 0; n < i; n++) j++;
+	return j;
+}`
+	p := New(lexer.New(input))
+	def := p.ParseDefinition()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	items := def.(cabs.FunDef).Body.Items
+	i := cabs.Variable{Name: "i"}
+
+	decls := items[0].(cabs.DeclStmt).Decls
+	if len(decls) != 2 {
+		t.Fatalf("expected 2 declarators, got %d", len(decls))
+	}
+	for k, want := range []string{"typeof(i)", "typeof(i)*"} {
+		if decls[k].TypeSpec != want || !reflect.DeepEqual(decls[k].Typeof, i) {
+			t.Errorf("declarator %d: got %q with operand %v, want %q with i", k, decls[k].TypeSpec, decls[k].Typeof, want)
+		}
+	}
+
+	// typeof(type) names the type itself
+	q := items[1].(cabs.DeclStmt).Decls[0]
+	if q.TypeSpec != "unsigned long*" || q.Typeof != nil {
+		t.Errorf("expected q of type unsigned long*, got %q with operand %v", q.TypeSpec, q.Typeof)
+	}
+
+	n := items[2].(cabs.For).InitDecl[0]
+	if n.TypeSpec != "typeof(i)" || !reflect.DeepEqual(n.Typeof, i) {
+		t.Errorf("expected n of type typeof(i), got %q with operand %v", n.TypeSpec, n.Typeof)
+	}
+}
+
+func TestTypeofInTypeName(t *testing.T) {
+	p := New(lexer.New(`int f(int i) { return sizeof(typeof(i)); }`))
+	p.ParseDefinition()
+	if len(p.Errors()) != 1 {
+		t.Errorf("expected an error for typeof(expr) in a type name, got %v", p.Errors())
+	}
+}
 
 // Error Recovery Tests
 
@@ -2941,6 +3697,75 @@ func TestErrorRecoveryParseSecondFunction(t *testing.T) {
 	}
 }
 
+func TestErrorRecoveryMalformedDefinitionTerminates(t *testing.T) {
+	for _, broken := range []string{"int (;", "unsigned (;", "int 3;", "typedef;", "struct { int x }", "int f(int (;", "const static"} {
+		t.Run(broken, func(t *testing.T) {
+			done := make(chan *cabs.Program)
+			p := New(lexer.New(broken + "\nint valid() { return 42; }"))
+			go func() { done <- p.ParseProgram() }()
+
+			var program *cabs.Program
+			select {
+			case program = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("parser did not terminate")
+			}
+			if len(p.Errors()) == 0 {
+				t.Error("expected parser errors from the malformed definition")
+			}
+			last := program.Definitions[len(program.Definitions)-1]
+			if funDef, ok := last.(cabs.FunDef); !ok || funDef.Name != "valid" {
+				t.Errorf("expected the valid function to be parsed last, got %#v", last)
+			}
+		})
+	}
+}
+
+// FuzzParse feeds arbitrary input to the parser, which must always finish
+// without panicking however broken the input, reporting errors instead.
+// The seed corpus is parse.yaml, the C examples and the malformed
+// definitions above; go test -fuzz=FuzzParse ./pkg/parser mutates it.
+func FuzzParse(f *testing.F) {
+	data, err := os.ReadFile("../../testdata/parse.yaml")
+	if err != nil {
+		f.Fatalf("failed to read parse.yaml: %v", err)
+	}
+	var testFile TestFile
+	if err := yaml.Unmarshal(data, &testFile); err != nil {
+		f.Fatalf("failed to parse parse.yaml: %v", err)
+	}
+	for _, tc := range testFile.Tests {
+		f.Add(tc.Input)
+	}
+	examples, _ := filepath.Glob("../../testdata/example-c/*.c")
+	for _, path := range examples {
+		if src, err := os.ReadFile(path); err == nil {
+			f.Add(string(src))
+		}
+	}
+	for _, broken := range []string{"int (;", "unsigned (;", "int 3;", "typedef;", "struct { int x }", "int f(int (;", "const static",
+		"int f() { @ x; }", "int f() { if (1) { return 1; }", "int f() { int x = 1 int y; }", "}", "int f() { switch (x) { case",
+		"int f() { switch (x) { cmse", "\"\\"} {
+		f.Add(broken)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		done := make(chan any)
+		go func() {
+			defer func() { done <- recover() }()
+			New(lexer.New(input)).ParseProgram()
+		}()
+		select {
+		case r := <-done:
+			if r != nil {
+				t.Fatalf("parser panicked on %q: %v", input, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("parser did not terminate on %q", input)
+		}
+	})
+}
+
 func TestErrorRecoveryContinuesAfterMissingSemicolon(t *testing.T) {
 	// Missing semicolon should not stop parsing subsequent statements
 	input := `int f() {
@@ -3205,6 +4030,159 @@ func TestStructDefinitionVsReturnType(t *testing.T) {
 	}
 }
 
+func TestEmptyStructAndUnion(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		isUnion bool
+	}{
+		{"empty struct", `struct E {};`, false},
+		{"empty union", `union U {};`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			def := p.ParseDefinition()
+
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			var fields []cabs.StructField
+			if tt.isUnion {
+				u, ok := def.(cabs.UnionDef)
+				if !ok {
+					t.Fatalf("expected UnionDef, got %T", def)
+				}
+				fields = u.Fields
+			} else {
+				s, ok := def.(cabs.StructDef)
+				if !ok {
+					t.Fatalf("expected StructDef, got %T", def)
+				}
+				fields = s.Fields
+			}
+			if len(fields) != 0 {
+				t.Errorf("expected no fields, got %d", len(fields))
+			}
+		})
+	}
+}
+
+func TestFlexibleArrayMember(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"struct definition", `struct S { int n; int data[]; };`},
+		{"typedef struct", `typedef struct { int n; int data[]; } S;`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			def := p.ParseDefinition()
+
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			var structDef cabs.StructDef
+			switch d := def.(type) {
+			case cabs.StructDef:
+				structDef = d
+			case cabs.TypedefDef:
+				inline, ok := d.InlineType.(cabs.StructDef)
+				if !ok {
+					t.Fatalf("expected inline StructDef, got %T", d.InlineType)
+				}
+				structDef = inline
+			default:
+				t.Fatalf("expected StructDef or TypedefDef, got %T", def)
+			}
+
+			if len(structDef.Fields) != 2 {
+				t.Fatalf("expected 2 fields, got %d", len(structDef.Fields))
+			}
+			if structDef.Fields[0].Flexible {
+				t.Errorf("field %q should not be flexible", structDef.Fields[0].Name)
+			}
+			fam := structDef.Fields[1]
+			if fam.Name != "data" || fam.TypeSpec != "int[]" || !fam.Flexible {
+				t.Errorf("expected flexible member data of type int[], got %+v", fam)
+			}
+		})
+	}
+}
+
+func TestFlexibleArrayMemberNotLast(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"struct definition", `struct S { int n; int data[]; int after; };`},
+		{"typedef struct", `typedef struct { int data[]; int after; } S;`},
+		{"inline struct", `struct T { struct { int data[]; char c; } in; int k; };`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errs := p.Errors()
+			if len(errs) != 1 || !strings.Contains(errs[0], "flexible array member 'data' not at end of struct") {
+				t.Errorf("expected an error on the flexible member, got %v", errs)
+			}
+		})
+	}
+}
+
+func TestSizedArrayFieldNotFlexible(t *testing.T) {
+	l := lexer.New(`struct S { char buf[16]; };`)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	structDef, ok := def.(cabs.StructDef)
+	if !ok {
+		t.Fatalf("expected StructDef, got %T", def)
+	}
+	if len(structDef.Fields) != 1 || structDef.Fields[0].Flexible {
+		t.Errorf("expected one non-flexible field, got %+v", structDef.Fields)
+	}
+}
+
+func TestAnonymousMember(t *testing.T) {
+	l := lexer.New(`struct S { int k; union { int u; char c; }; struct T { int t; } named; };`)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	// The definitions of the member types come first
+	structDef, ok := program.Definitions[len(program.Definitions)-1].(cabs.StructDef)
+	if !ok {
+		t.Fatalf("expected StructDef last, got %+v", program.Definitions)
+	}
+	if len(structDef.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %+v", structDef.Fields)
+	}
+	anon := structDef.Fields[1]
+	if anon.Name != "" || !strings.HasPrefix(anon.TypeSpec, "union __anon_") {
+		t.Errorf("expected an anonymous union member, got %+v", anon)
+	}
+	if named := structDef.Fields[2]; named.Name != "named" || named.TypeSpec != "struct T" {
+		t.Errorf("expected member named of type struct T, got %+v", named)
+	}
+}
+
 func TestFunctionPointerInStructField(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -3252,7 +4230,7 @@ func TestFunctionPointerInStructField(t *testing.T) {
 			"function pointer returning function pointer",
 			"struct S { void (*(*xDlSym)(void*, const char*))(void); };",
 			"xDlSym",
-			"void(*)(void)(*)(void*, char*)",
+			"void(*)(void)(*)(void*, const char*)",
 			1,
 		},
 	}
@@ -3509,6 +4487,13 @@ func TestAttributeSkipping(t *testing.T) {
 			false,
 			false,
 		},
+		{
+			"unknown attribute with parentheses in a string argument",
+			`int old(void) __attribute__((deprecated("use g(), not f("), cold));`,
+			"old",
+			false,
+			false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -3544,19 +4529,157 @@ func TestAttributeSkipping(t *testing.T) {
 	}
 }
 
-
-func TestGlobalVariableDeclaration(t *testing.T) {
+func TestAttributeCapture(t *testing.T) {
 	tests := []struct {
-		name         string
-		input        string
-		storageClass string
-		typeSpec     string
-		varName      string
-		hasArray     bool
-		hasInit      bool
+		name  string
+		input string
+		want  cabs.Attributes
 	}{
 		{
-			name:         "extern int variable",
+			"packed after struct body",
+			"struct s { char c; int i; } __attribute__((packed));",
+			cabs.Attributes{Packed: true},
+		},
+		{
+			"packed before struct name",
+			"struct __attribute__((__packed__)) s { char c; int i; };",
+			cabs.Attributes{Packed: true},
+		},
+		{
+			"packed and aligned in one list",
+			"struct s { int i; } __attribute__((packed, aligned(8)));",
+			cabs.Attributes{Packed: true, Aligned: 8},
+		},
+		{
+			"typedef of packed struct",
+			"typedef struct __attribute__((packed)) { char c; int i; } T;",
+			cabs.Attributes{Packed: true},
+		},
+		{
+			"aligned without argument",
+			"struct s { char c; } __attribute__((aligned));",
+			cabs.Attributes{Aligned: 16},
+		},
+		{
+			"section and aligned on a global",
+			`int x __attribute__((section(".mydata"), aligned(16))) = 1;`,
+			cabs.Attributes{Aligned: 16, Section: ".mydata"},
+		},
+		{
+			"section name containing parentheses",
+			`int x __attribute__((section("(.text)"))) = 1;`,
+			cabs.Attributes{Section: "(.text)"},
+		},
+		{
+			"section name with an unbalanced parenthesis",
+			`int x __attribute__((section(".data)"), aligned(8))) = 1;`,
+			cabs.Attributes{Aligned: 8, Section: ".data)"},
+		},
+		{
+			"leading section on a function",
+			`__attribute__((section(".text.hot"), cold)) int f(void) { return 0; }`,
+			cabs.Attributes{Section: ".text.hot"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			if td, ok := def.(cabs.TypedefDef); ok {
+				def = td.InlineType
+			}
+			var got cabs.Attributes
+			switch d := def.(type) {
+			case cabs.StructDef:
+				got = d.Attrs
+			case cabs.VarDef:
+				got = d.Attrs
+			case cabs.FunDef:
+				got = d.Attrs
+			default:
+				t.Fatalf("unexpected definition %T", def)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFieldAttributeCapture(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []cabs.Attributes // of each field
+	}{
+		{
+			"after the declarator",
+			"struct s { char c; int i __attribute__((aligned(8))); };",
+			[]cabs.Attributes{{}, {Aligned: 8}},
+		},
+		{
+			"before the type",
+			"struct s { __attribute__((aligned(8))) int i; char c; };",
+			[]cabs.Attributes{{Aligned: 8}, {}},
+		},
+		{
+			"between the type and the declarator",
+			"struct s { int __attribute__((packed)) i; };",
+			[]cabs.Attributes{{Packed: true}},
+		},
+		{
+			"one declarator of a list",
+			"struct s { int a, b __attribute__((aligned(16))), c; };",
+			[]cabs.Attributes{{}, {Aligned: 16}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			fields := def.(cabs.StructDef).Fields
+			if len(fields) != len(tt.want) {
+				t.Fatalf("expected %d fields, got %#v", len(tt.want), fields)
+			}
+			for i, want := range tt.want {
+				if fields[i].Attrs != want {
+					t.Errorf("field %s: expected %+v, got %+v", fields[i].Name, want, fields[i].Attrs)
+				}
+			}
+		})
+	}
+}
+
+func TestAlignedAttributeNotPowerOfTwo(t *testing.T) {
+	p := New(lexer.New("struct s { int i; } __attribute__((aligned(3)));"))
+	p.ParseDefinition()
+	if len(p.Errors()) == 0 {
+		t.Error("expected an error for aligned(3)")
+	}
+}
+
+
+func TestGlobalVariableDeclaration(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		storageClass string
+		typeSpec     string
+		varName      string
+		hasArray     bool
+		hasInit      bool
+	}{
+		{
+			name:         "extern int variable",
 			input:        "extern int sys_nerr;",
 			storageClass: "extern",
 			typeSpec:     "int",
@@ -3651,6 +4774,168 @@ func TestGlobalVariableDeclaration(t *testing.T) {
 	}
 }
 
+func TestCommaSeparatedGlobals(t *testing.T) {
+	input := "static const int a, *b = &a, c[3] = {1, 2, 3};\nint d;"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	want := []cabs.VarDef{
+		{StorageClass: "static", TypeSpec: "int", Quals: cabs.Qualifiers{Base: []cabs.TypeQualifier{cabs.QualConst}}, Name: "a", Pos: diag.Pos{Line: 1, Col: 18}},
+		{
+			StorageClass: "static",
+			TypeSpec:     "int*",
+			Quals:        cabs.Qualifiers{Base: []cabs.TypeQualifier{cabs.QualConst}, Pointers: [][]cabs.TypeQualifier{nil}},
+			Name:         "b",
+			Initializer:  cabs.Unary{Op: cabs.OpAddrOf, Expr: cabs.Variable{Name: "a"}},
+			Pos:          diag.Pos{Line: 1, Col: 22},
+		},
+		{
+			StorageClass: "static",
+			TypeSpec:     "int",
+			Quals:        cabs.Qualifiers{Base: []cabs.TypeQualifier{cabs.QualConst}},
+			Name:         "c",
+			ArrayDims:    []cabs.Expr{cabs.Constant{Value: 3}},
+			Initializer:  cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 1}, cabs.Constant{Value: 2}, cabs.Constant{Value: 3}}},
+			Pos:          diag.Pos{Line: 1, Col: 30},
+		},
+		{TypeSpec: "int", Name: "d", Pos: diag.Pos{Line: 2, Col: 5}},
+	}
+	if len(program.Definitions) != len(want) {
+		t.Fatalf("expected %d definitions, got %d: %#v", len(want), len(program.Definitions), program.Definitions)
+	}
+	for i, def := range program.Definitions {
+		if !reflect.DeepEqual(def, want[i]) {
+			t.Errorf("definition %d:\nexpected %#v\ngot      %#v", i, want[i], def)
+		}
+	}
+}
+
+func TestPointerQualifiers(t *testing.T) {
+	c := cabs.QualConst
+	tests := []struct {
+		name     string
+		input    string
+		base     []cabs.TypeQualifier
+		pointers [][]cabs.TypeQualifier
+	}{
+		{"const pointer to const", "extern const char *const sys_errlist[];", []cabs.TypeQualifier{c}, [][]cabs.TypeQualifier{{c}}},
+		{"const pointer", "char *const p;", nil, [][]cabs.TypeQualifier{{c}}},
+		{"pointer to const", "const char *p;", []cabs.TypeQualifier{c}, [][]cabs.TypeQualifier{nil}},
+		{"pointer to const, postfix", "char const *p;", []cabs.TypeQualifier{c}, [][]cabs.TypeQualifier{nil}},
+		{"inner const pointer", "char *const *p;", nil, [][]cabs.TypeQualifier{{c}, nil}},
+		{"volatile restrict", "int *volatile restrict p;", nil, [][]cabs.TypeQualifier{{cabs.QualVolatile, cabs.QualRestrict}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			varDef, ok := def.(cabs.VarDef)
+			if !ok {
+				t.Fatalf("expected VarDef, got %T", def)
+			}
+			if !reflect.DeepEqual(varDef.Quals.Base, tt.base) {
+				t.Errorf("Base: expected %v, got %v", tt.base, varDef.Quals.Base)
+			}
+			if !reflect.DeepEqual(varDef.Quals.Pointers, tt.pointers) {
+				t.Errorf("Pointers: expected %v, got %v", tt.pointers, varDef.Quals.Pointers)
+			}
+		})
+	}
+}
+
+func TestPointerQualifiersInParamsAndTypedefs(t *testing.T) {
+	p := New(lexer.New(`
+typedef const char *cstr;
+typedef char *const cptr;
+int f(const char *a, char *const b) { char *const c = 0; return 0; }
+`))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Definitions) != 3 {
+		t.Fatalf("expected 3 definitions, got %d", len(program.Definitions))
+	}
+
+	cstr := program.Definitions[0].(cabs.TypedefDef)
+	if cstr.TypeSpec != "char*" || !cstr.Quals.BaseHas(cabs.QualConst) || cstr.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("cstr: expected pointer to const char, got %q %+v", cstr.TypeSpec, cstr.Quals)
+	}
+	cptr := program.Definitions[1].(cabs.TypedefDef)
+	if cptr.TypeSpec != "char*" || cptr.Quals.BaseHas(cabs.QualConst) || !cptr.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("cptr: expected const pointer to char, got %q %+v", cptr.TypeSpec, cptr.Quals)
+	}
+
+	fn := program.Definitions[2].(cabs.FunDef)
+	a, b := fn.Params[0], fn.Params[1]
+	if !a.Quals.BaseHas(cabs.QualConst) || a.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("a: expected pointer to const, got %+v", a.Quals)
+	}
+	if b.Quals.BaseHas(cabs.QualConst) || !b.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("b: expected const pointer, got %+v", b.Quals)
+	}
+	decl := fn.Body.Items[0].(cabs.DeclStmt).Decls[0]
+	if decl.TypeSpec != "char*" || !decl.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("c: expected const pointer, got %q %+v", decl.TypeSpec, decl.Quals)
+	}
+}
+
+func TestQualifiedFunctionPointerTypedef(t *testing.T) {
+	p := New(lexer.New(`
+typedef void (* const handler_t)(int);
+typedef int (* volatile const vfn)(void);
+typedef const char *const *volatile names;
+struct S { handler_t h; const handler_t k; };
+void install(handler_t h, names list);
+`))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Definitions) != 5 {
+		t.Fatalf("expected 5 definitions, got %d", len(program.Definitions))
+	}
+
+	handler := program.Definitions[0].(cabs.TypedefDef)
+	if handler.TypeSpec != "void(*)(int)" || !handler.Quals.PointerHas(0, cabs.QualConst) || len(handler.Quals.Base) != 0 {
+		t.Errorf("handler_t: expected const pointer to function, got %q %+v", handler.TypeSpec, handler.Quals)
+	}
+	vfn := program.Definitions[1].(cabs.TypedefDef)
+	if vfn.TypeSpec != "int(*)(void)" || !vfn.Quals.PointerHas(0, cabs.QualVolatile) || !vfn.Quals.PointerHas(0, cabs.QualConst) {
+		t.Errorf("vfn: expected const volatile pointer to function, got %q %+v", vfn.TypeSpec, vfn.Quals)
+	}
+	names := program.Definitions[2].(cabs.TypedefDef)
+	if names.TypeSpec != "char**" || !names.Quals.BaseHas(cabs.QualConst) || !names.Quals.PointerHas(0, cabs.QualConst) || !names.Quals.PointerHas(1, cabs.QualVolatile) {
+		t.Errorf("names: expected volatile pointer to const pointer to const char, got %q %+v", names.TypeSpec, names.Quals)
+	}
+
+	// The typedef names are usable as field and parameter types
+	st := program.Definitions[3].(cabs.StructDef)
+	if len(st.Fields) != 2 || st.Fields[0].TypeSpec != "handler_t" || st.Fields[1].TypeSpec != "handler_t" {
+		t.Errorf("expected two handler_t fields, got %+v", st.Fields)
+	}
+	fn := program.Definitions[4].(cabs.FunDef)
+	if len(fn.Params) != 2 || fn.Params[0].TypeSpec != "handler_t" || fn.Params[1].TypeSpec != "names" {
+		t.Errorf("expected handler_t and names parameters, got %+v", fn.Params)
+	}
+
+	// The qualifiers are printed back inside the pointer's parentheses
+	var out bytes.Buffer
+	cabs.NewPrinter(&out).PrintProgram(program)
+	for _, want := range []string{"typedef void(* const)(int) handler_t;", "typedef int(* volatile const)(void) vfn;", "typedef const char* const* volatile names;"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in printed program, got %q", want, out.String())
+		}
+	}
+}
+
 func TestTypedefWithArrayDimension(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -3710,21 +4995,21 @@ func TestFunctionPointerParameter(t *testing.T) {
 			"anonymous function pointer parameter",
 			"int f(int (* )(void *, char *, int));",
 			1,
-			[]string{"int(*)(void*,char*,int)"},
+			[]string{"int(*)(void*, char*, int)"},
 			[]string{""},
 		},
 		{
 			"named function pointer parameter",
 			"int f(int (*fn)(int, int));",
 			1,
-			[]string{"int(*)(int,int)"},
+			[]string{"int(*)(int, int)"},
 			[]string{"fn"},
 		},
 		{
 			"multiple function pointer parameters",
 			"int funopen(const void *cookie, int (* )(void *, char *, int), int (* )(void *));",
 			3,
-			[]string{"void*", "int(*)(void*,char*,int)", "int(*)(void*)"},
+			[]string{"void*", "int(*)(void*, char*, int)", "int(*)(void*)"},
 			[]string{"cookie", "", ""},
 		},
 		{
@@ -3773,3 +5058,472 @@ func TestFunctionPointerParameter(t *testing.T) {
 		})
 	}
 }
+
+func TestPragmaOperatorIgnored(t *testing.T) {
+	input := `_Pragma("GCC diagnostic push")
+int f(int x) {
+	_Pragma("GCC diagnostic ignored \"-Wunused-variable\"")
+	int unused;
+	return x;
+}
+_Pragma("GCC diagnostic pop")`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Definitions) != 1 {
+		t.Fatalf("expected 1 definition, got %d", len(program.Definitions))
+	}
+	funDef, ok := program.Definitions[0].(cabs.FunDef)
+	if !ok {
+		t.Fatalf("expected FunDef, got %T", program.Definitions[0])
+	}
+	if len(funDef.Body.Items) != 2 {
+		t.Errorf("expected 2 body items, got %d", len(funDef.Body.Items))
+	}
+}
+
+func TestStatementExpression(t *testing.T) {
+	input := `int sq(int a) { return ({ int t = a; t * t; }); }`
+
+	l := lexer.New(input)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	funDef, ok := def.(cabs.FunDef)
+	if !ok {
+		t.Fatalf("expected FunDef, got %T", def)
+	}
+	ret, ok := funDef.Body.Items[0].(cabs.Return)
+	if !ok {
+		t.Fatalf("expected Return, got %T", funDef.Body.Items[0])
+	}
+	stmtExpr, ok := ret.Expr.(cabs.StmtExpr)
+	if !ok {
+		t.Fatalf("expected StmtExpr, got %T", ret.Expr)
+	}
+	if len(stmtExpr.Block.Items) != 1 {
+		t.Fatalf("expected 1 block item, got %d", len(stmtExpr.Block.Items))
+	}
+	if _, ok := stmtExpr.Block.Items[0].(cabs.DeclStmt); !ok {
+		t.Errorf("expected DeclStmt, got %T", stmtExpr.Block.Items[0])
+	}
+	result, ok := stmtExpr.Result.(cabs.Binary)
+	if !ok || result.Op != cabs.OpMul {
+		t.Errorf("expected result t * t, got %#v", stmtExpr.Result)
+	}
+}
+
+func TestStatementExpressionVoid(t *testing.T) {
+	input := `void f(int x) { ({ if (x) x = 0; }); }`
+
+	l := lexer.New(input)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	funDef := def.(cabs.FunDef)
+	comp, ok := funDef.Body.Items[0].(cabs.Computation)
+	if !ok {
+		t.Fatalf("expected Computation, got %T", funDef.Body.Items[0])
+	}
+	stmtExpr, ok := comp.Expr.(cabs.StmtExpr)
+	if !ok {
+		t.Fatalf("expected StmtExpr, got %T", comp.Expr)
+	}
+	if stmtExpr.Result != nil {
+		t.Errorf("expected no result for block ending in a statement, got %T", stmtExpr.Result)
+	}
+	if len(stmtExpr.Block.Items) != 1 {
+		t.Errorf("expected 1 block item, got %d", len(stmtExpr.Block.Items))
+	}
+}
+
+func TestFunctionSpecifiers(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		storageClass string
+		inline       bool
+		printed      string
+	}{
+		{"static definition", "static int f() { return 0; }", "static", false, "static int f()"},
+		{"extern prototype", "extern int f(int x);", "extern", false, "extern int f(int x);"},
+		{"static inline", "static inline int f() { return 0; }", "static", true, "static inline int f()"},
+		{"inline before static", "inline static int f() { return 0; }", "static", true, "static inline int f()"},
+		{"no specifiers", "int f() { return 0; }", "", false, "int f()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			funDef, ok := p.ParseDefinition().(cabs.FunDef)
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			if !ok {
+				t.Fatalf("expected FunDef")
+			}
+			if funDef.StorageClass != tt.storageClass {
+				t.Errorf("StorageClass: expected %q, got %q", tt.storageClass, funDef.StorageClass)
+			}
+			if funDef.Inline != tt.inline {
+				t.Errorf("Inline: expected %v, got %v", tt.inline, funDef.Inline)
+			}
+
+			// The printed definition parses back to the same specifiers
+			var buf bytes.Buffer
+			cabs.NewPrinter(&buf).PrintProgram(&cabs.Program{Definitions: []cabs.Definition{funDef}})
+			if !bytes.HasPrefix(buf.Bytes(), []byte(tt.printed)) {
+				t.Errorf("expected output to start with %q, got %q", tt.printed, buf.String())
+			}
+			p = New(lexer.New(buf.String()))
+			reparsed, ok := p.ParseDefinition().(cabs.FunDef)
+			if len(p.Errors()) > 0 || !ok {
+				t.Fatalf("reparse of %q failed: %v", buf.String(), p.Errors())
+			}
+			if reparsed.StorageClass != tt.storageClass || reparsed.Inline != tt.inline {
+				t.Errorf("round trip: expected %q inline=%v, got %q inline=%v",
+					tt.storageClass, tt.inline, reparsed.StorageClass, reparsed.Inline)
+			}
+		})
+	}
+}
+
+func TestArrayParameterDeclarators(t *testing.T) {
+	tests := []struct {
+		input    string
+		typeSpec string
+		static   bool
+		size     cabs.Expr
+		quals    [][]cabs.TypeQualifier
+	}{
+		{"int a[]", "int*", false, nil, [][]cabs.TypeQualifier{nil}},
+		{"int a[10]", "int*", false, cabs.Constant{Value: 10}, [][]cabs.TypeQualifier{nil}},
+		{"int a[static 5]", "int*", true, cabs.Constant{Value: 5}, [][]cabs.TypeQualifier{nil}},
+		{"int a[restrict 10]", "int*", false, cabs.Constant{Value: 10}, [][]cabs.TypeQualifier{{cabs.QualRestrict}}},
+		{"int a[const static 4]", "int*", true, cabs.Constant{Value: 4}, [][]cabs.TypeQualifier{{cabs.QualConst}}},
+		{"char *argv[const]", "char**", false, nil, [][]cabs.TypeQualifier{nil, {cabs.QualConst}}},
+		{"int a[*]", "int*", false, nil, [][]cabs.TypeQualifier{nil}},
+		{"int m[][4]", "int (*)[4]", false, nil, [][]cabs.TypeQualifier{nil}},
+		{"int a[2][3]", "int (*)[3]", false, cabs.Constant{Value: 2}, [][]cabs.TypeQualifier{nil}},
+		{"int a[2][1+2][4]", "int (*)[3][4]", false, cabs.Constant{Value: 2}, [][]cabs.TypeQualifier{nil}},
+		{"char *s[2][8]", "char* (*)[8]", false, cabs.Constant{Value: 2}, [][]cabs.TypeQualifier{nil, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New("void f(" + tt.input + ");"))
+			def := p.ParseDefinition()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			param := def.(cabs.FunDef).Params[0]
+			if param.TypeSpec != tt.typeSpec {
+				t.Errorf("TypeSpec: expected %q, got %q", tt.typeSpec, param.TypeSpec)
+			}
+			if param.ArrayStatic != tt.static {
+				t.Errorf("ArrayStatic: expected %v, got %v", tt.static, param.ArrayStatic)
+			}
+			if param.ArraySize != tt.size {
+				t.Errorf("ArraySize: expected %#v, got %#v", tt.size, param.ArraySize)
+			}
+			if !reflect.DeepEqual(param.Quals.Pointers, tt.quals) {
+				t.Errorf("pointer qualifiers: expected %v, got %v", tt.quals, param.Quals.Pointers)
+			}
+		})
+	}
+}
+
+func TestBuiltinVaArg(t *testing.T) {
+	input := `int f(__builtin_va_list ap) { return *__builtin_va_arg(ap, const char *); }`
+
+	l := lexer.New(input)
+	p := New(l)
+	def := p.ParseDefinition()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	funDef := def.(cabs.FunDef)
+	ret := funDef.Body.Items[0].(cabs.Return)
+	deref, ok := ret.Expr.(cabs.Unary)
+	if !ok {
+		t.Fatalf("expected Unary, got %T", ret.Expr)
+	}
+	va, ok := deref.Expr.(cabs.VaArg)
+	if !ok {
+		t.Fatalf("expected VaArg, got %T", deref.Expr)
+	}
+	if v, ok := va.Expr.(cabs.Variable); !ok || v.Name != "ap" {
+		t.Errorf("expected va_list ap, got %#v", va.Expr)
+	}
+	if va.TypeName != "char *" {
+		t.Errorf("expected type 'char *', got %q", va.TypeName)
+	}
+}
+
+func TestInitializerList(t *testing.T) {
+	input := `struct S { int a[2]; int b; };
+int f() { int m[2][3] = {{1, 2, 3}, {4,},}; return 0; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	prog := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	fields := prog.Definitions[0].(cabs.StructDef).Fields
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(fields))
+	}
+	if !reflect.DeepEqual(fields[0].ArrayDims, []cabs.Expr{cabs.Constant{Value: 2}}) {
+		t.Errorf("expected field a to have dimension 2, got %#v", fields[0].ArrayDims)
+	}
+
+	funDef := prog.Definitions[1].(cabs.FunDef)
+	decl := funDef.Body.Items[0].(cabs.DeclStmt).Decls[0]
+	want := cabs.InitList{Items: []cabs.Expr{
+		cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 1}, cabs.Constant{Value: 2}, cabs.Constant{Value: 3}}},
+		cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 4}}},
+	}}
+	if !reflect.DeepEqual(decl.Initializer, want) {
+		t.Errorf("expected %#v, got %#v", want, decl.Initializer)
+	}
+}
+
+func TestDesignatedInitializer(t *testing.T) {
+	input := `enum { N = 3 };
+int f() { int t[10] = {[2 ... N + 2] = 1, [N * 2] = {2}, 4}; return 0; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	prog := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	decl := prog.Definitions[1].(cabs.FunDef).Body.Items[0].(cabs.DeclStmt).Decls[0]
+	want := cabs.InitList{Items: []cabs.Expr{
+		cabs.Designated{Index: 2, Last: 5, Value: cabs.Constant{Value: 1}},
+		cabs.Designated{Index: 6, Last: 6, Value: cabs.InitList{Items: []cabs.Expr{cabs.Constant{Value: 2}}}},
+		cabs.Constant{Value: 4},
+	}}
+	if !reflect.DeepEqual(decl.Initializer, want) {
+		t.Errorf("expected %#v, got %#v", want, decl.Initializer)
+	}
+
+	var out bytes.Buffer
+	cabs.NewPrinter(&out).PrintProgram(prog)
+	if !strings.Contains(out.String(), "= {[2 ... 5] = 1, [6] = {2}, 4};") {
+		t.Errorf("expected the designators to be printed, got:\n%s", out.String())
+	}
+}
+
+func TestDesignatedInitializerErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`int f(int n) { int t[4] = {[n] = 1}; }`, "integer constant expression"},
+		{`int f() { int t[4] = {[3 ... 1] = 1}; }`, "empty range"},
+		{`int f() { int t[4] = {[-1] = 1}; }`, "negative"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || !strings.Contains(errs[0], tt.want) {
+			t.Errorf("%s: expected an error about %q, got %v", tt.input, tt.want, errs)
+		}
+	}
+}
+
+func TestStarDeclarationOrMultiplication(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		decl  bool // whether the last statement of f is a declaration of b
+	}{
+		{"typedef name declares a pointer", `typedef int a; void f() { a * b; }`, true},
+		{"ordinary identifier multiplies", `int a; int b; void f() { a * b; }`, false},
+		{"local hides the typedef", `typedef int a; void f() { int a = 2; a * b; }`, false},
+		{"parameter hides the typedef", `typedef int a; void f(int a) { a * b; }`, false},
+		{"hiding ends with the block", `typedef int a; void f() { { int a; } a * b; }`, true},
+		{"hiding reaches nested blocks", `typedef int a; void f() { int a; if (1) { a * b; } }`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			prog := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			fn := prog.Definitions[len(prog.Definitions)-1].(cabs.FunDef)
+			stmt := fn.Body.Items[len(fn.Body.Items)-1]
+			for {
+				if i, ok := stmt.(cabs.If); ok {
+					stmt = i.Then
+				} else if b, ok := stmt.(*cabs.Block); ok {
+					stmt = b.Items[len(b.Items)-1]
+				} else {
+					break
+				}
+			}
+
+			if tt.decl {
+				ds, ok := stmt.(cabs.DeclStmt)
+				if !ok || len(ds.Decls) != 1 || ds.Decls[0].Name != "b" || ds.Decls[0].TypeSpec != "a*" {
+					t.Errorf("expected declaration a *b, got %#v", stmt)
+				}
+				return
+			}
+			comp, ok := stmt.(cabs.Computation)
+			if !ok {
+				t.Fatalf("expected expression statement, got %#v", stmt)
+			}
+			if bin, ok := comp.Expr.(cabs.Binary); !ok || bin.Op != cabs.OpMul {
+				t.Errorf("expected a * b, got %#v", comp.Expr)
+			}
+		})
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("int x = ;\n", 10) + "int y;"
+	p := New(lexer.New(input))
+	p.SetEmitter(diag.NewEmitter(diag.Options{MaxErrors: 3}))
+	program := p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) != 4 || !strings.HasSuffix(errs[3], "too many errors, stopping") {
+		t.Fatalf("expected 3 errors and a stop, got %v", errs)
+	}
+	for _, def := range program.Definitions {
+		if v, ok := def.(cabs.VarDef); ok && v.Name == "y" {
+			t.Error("expected parsing to stop before the last definition")
+		}
+	}
+}
+
+func TestPrototypeAndDefinition(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		conflict bool
+	}{
+		{"unnamed parameters", "int foo(int, char *);\nint foo(int a, char *b) { return a; }", false},
+		{"typedef parameter", "typedef char *str;\nint foo(str);\nint foo(char *s) { return 0; }", false},
+		{"unspecified parameters", "int foo();\nint foo(int a) { return a; }", false},
+		{"repeated prototype", "int foo(int);\nint foo(int);", false},
+		{"parameter type", "int foo(int, char *);\nint foo(int a, int b) { return a; }", true},
+		{"parameter count", "int foo(int);\nint foo(int a, int b) { return a; }", true},
+		{"return type", "int foo(int);\nlong foo(int a) { return a; }", true},
+		{"variadic", "int foo(int, ...);\nint foo(int a) { return a; }", true},
+		{"void parameters", "int foo(void);\nint foo(int a) { return a; }", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errs := p.Errors()
+			if !tt.conflict {
+				if len(errs) != 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.HasSuffix(errs[0], "conflicting types for 'foo'") {
+				t.Fatalf("expected a conflicting types error, got %v", errs)
+			}
+			diags := p.Diagnostics()
+			if last := diags[len(diags)-1]; last.Severity != diag.Note || last.Pos.Line != 1 {
+				t.Errorf("expected a note at the prototype, got %v", last)
+			}
+		})
+	}
+}
+
+func TestRedefinition(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		redefine string
+	}{
+		{"prototype and definition", "int foo(void);\nint foo(void) { return 0; }", ""},
+		{"tentative definitions", "int foo;\nint foo = 1;\nint foo;", ""},
+		{"function", "int foo(void) { return 0; }\nint foo(void) { return 1; }", "foo"},
+		{"variable", "int foo = 1;\nint foo = 2;", "foo"},
+		{"second declarator", "int foo = 1, bar,\n  foo = 2;", "foo"},
+		{"extern variable", "int foo = 1;\nextern int foo = 2;", "foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errs := p.Errors()
+			if tt.redefine == "" {
+				if len(errs) != 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.HasSuffix(errs[0], "redefinition of '"+tt.redefine+"'") {
+				t.Fatalf("expected a redefinition error, got %v", errs)
+			}
+			diags := p.Diagnostics()
+			if first := diags[0]; first.Pos.Line != 2 {
+				t.Errorf("expected the error at the second definition, got %v", first)
+			}
+			if last := diags[len(diags)-1]; last.Severity != diag.Note || last.Pos.Line != 1 {
+				t.Errorf("expected a note at the first definition, got %v", last)
+			}
+		})
+	}
+}
+
+func TestPedantic(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"statement expression", "int f(void) { return ({ int x = 1; x; }); }"},
+		{"typeof", "int x; typeof(x) y;"},
+		{"attribute", "int f(void) __attribute__((cold));"},
+		{"range designator", "void f(void) { int t[4] = {[0] = 1, [1 ... 3] = 2}; }"},
+	}
+	for _, tt := range tests {
+		for _, pedantic := range []bool{false, true} {
+			p := New(lexer.New(tt.input))
+			p.SetPedantic(pedantic)
+			p.ParseProgram()
+
+			var warnings []diag.Diagnostic
+			for _, d := range p.Diagnostics() {
+				if d.Severity == diag.Warning && d.Code == "pedantic" {
+					warnings = append(warnings, d)
+				}
+			}
+			want := 0
+			if pedantic {
+				want = 1
+			}
+			if len(warnings) != want || len(p.Errors()) != 0 {
+				t.Errorf("%s with pedantic=%v: got diagnostics %v, want %d pedantic warnings", tt.name, pedantic, p.Diagnostics(), want)
+			}
+		}
+	}
+}
@@ -12,16 +12,19 @@ import (
 	"strings"
 
 	"github.com/raymyers/ralph-cc/pkg/cpp"
+	"github.com/raymyers/ralph-cc/pkg/diag"
 )
 
 // Options configures the preprocessing step
 type Options struct {
-	IncludePaths []string          // -I directories
-	SystemPaths  []string          // -isystem directories
-	Defines      map[string]string // -D macros (name -> value, empty string for simple define)
-	Undefines    []string          // -U macros
-	UseExternal  bool              // Force use of external preprocessor
-	LineMarkers  bool              // Generate #line markers
+	IncludePaths  []string          // -I directories
+	SystemPaths   []string          // -isystem directories
+	ForceIncludes []string          // -include files, processed before the main file
+	Defines       map[string]string // -D macros (name -> value, empty string for simple define)
+	Undefines     []string          // -U macros
+	UseExternal   bool              // Force use of external preprocessor
+	LineMarkers   bool              // Generate #line markers
+	Diags         *diag.Emitter     // Where #warning diagnostics go, written to standard error if nil
 }
 
 // Preprocess runs the C preprocessor on the given source file and returns
@@ -44,7 +47,9 @@ func preprocessInternal(filename string, opts *Options) (string, error) {
 	if opts != nil {
 		ppOpts.IncludePaths = opts.IncludePaths
 		ppOpts.SystemPaths = opts.SystemPaths
+		ppOpts.ForceIncludes = opts.ForceIncludes
 		ppOpts.Undefines = opts.Undefines
+		ppOpts.Diags = opts.Diags
 
 		// Convert defines map to slice format expected by cpp package
 		for name, value := range opts.Defines {
@@ -74,6 +79,10 @@ func preprocessExternal(filename string, opts *Options) (string, error) {
 		for _, path := range opts.SystemPaths {
 			args = append(args, "-isystem", path)
 		}
+		// Add force-included files
+		for _, path := range opts.ForceIncludes {
+			args = append(args, "-include", path)
+		}
 		// Add defines
 		for name, value := range opts.Defines {
 			if value == "" {
@@ -0,0 +1,102 @@
+package regalloc
+
+import "github.com/raymyers/ralph-cc/pkg/rtl"
+
+// FloatRegs returns the pseudo-registers of fn that hold floating-point
+// values, which are allocated to the D registers rather than the X ones.
+// A register is a float one if a float operation, load or call defines
+// it, a float operation or store uses it, or it is a float parameter; a
+// move copies the class from the register on either side to the other.
+func FloatRegs(fn *rtl.Function) RegSet {
+	floats := NewRegSet()
+	for i, param := range fn.Params {
+		if i < len(fn.Sig.Args) && isFloatType(fn.Sig.Args[i]) {
+			floats.Add(param)
+		}
+	}
+
+	var moves [][2]rtl.Reg
+	for _, node := range getSortedNodes(fn) {
+		switch i := fn.Code[node].(type) {
+		case rtl.Iop:
+			if _, ok := i.Op.(rtl.Omove); ok && len(i.Args) == 1 {
+				moves = append(moves, [2]rtl.Reg{i.Dest, i.Args[0]})
+				continue
+			}
+			if isFloatResult(i.Op) {
+				floats.Add(i.Dest)
+			}
+			if isFloatOperands(i.Op) {
+				for _, arg := range i.Args {
+					floats.Add(arg)
+				}
+			}
+		case rtl.Iload:
+			if isFloatChunk(i.Chunk) {
+				floats.Add(i.Dest)
+			}
+		case rtl.Istore:
+			if isFloatChunk(i.Chunk) {
+				floats.Add(i.Src)
+			}
+		case rtl.Icall:
+			if i.Dest != 0 && i.DestHi == 0 && isFloatType(i.Sig.Return) {
+				floats.Add(i.Dest)
+			}
+		case rtl.Icond:
+			switch i.Cond.(type) {
+			case rtl.Ccompf, rtl.Cnotcompf, rtl.Ccomps, rtl.Cnotcomps:
+				for _, arg := range i.Args {
+					floats.Add(arg)
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, m := range moves {
+			if floats.Contains(m[0]) != floats.Contains(m[1]) {
+				floats.Add(m[0])
+				floats.Add(m[1])
+				changed = true
+			}
+		}
+	}
+	return floats
+}
+
+// isFloatType reports whether a signature type descriptor is a float one
+func isFloatType(desc string) bool {
+	return desc == "float" || desc == "double"
+}
+
+func isFloatChunk(chunk rtl.Chunk) bool {
+	return chunk == rtl.Mfloat32 || chunk == rtl.Mfloat64
+}
+
+// isFloatResult reports whether op computes a float value
+func isFloatResult(op rtl.Operation) bool {
+	switch op.(type) {
+	case rtl.Ofloatconst, rtl.Osingleconst,
+		rtl.Onegf, rtl.Oabsf, rtl.Oaddf, rtl.Osubf, rtl.Omulf, rtl.Odivf,
+		rtl.Onegs, rtl.Oabss, rtl.Oadds, rtl.Osubs, rtl.Omuls, rtl.Odivs,
+		rtl.Osingleoffloat, rtl.Ofloatofsingle,
+		rtl.Ofloatofint, rtl.Ofloatofintu, rtl.Ofloatoflong, rtl.Ofloatoflongu:
+		return true
+	}
+	return false
+}
+
+// isFloatOperands reports whether the operands of op are float values
+func isFloatOperands(op rtl.Operation) bool {
+	switch op.(type) {
+	case rtl.Onegf, rtl.Oabsf, rtl.Oaddf, rtl.Osubf, rtl.Omulf, rtl.Odivf,
+		rtl.Onegs, rtl.Oabss, rtl.Oadds, rtl.Osubs, rtl.Omuls, rtl.Odivs,
+		rtl.Osingleoffloat, rtl.Ofloatofsingle,
+		rtl.Ointoffloat, rtl.Ointuoffloat, rtl.Olongoffloat, rtl.Olonguoffloat,
+		rtl.Ocmpf, rtl.Ocmps:
+		return true
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package regalloc
 
 import (
 	"github.com/raymyers/ralph-cc/pkg/ltl"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
 )
 
 // ARM64 calling convention definitions
@@ -41,9 +42,16 @@ var FloatArgRegs = []ltl.MReg{ltl.D0, ltl.D1, ltl.D2, ltl.D3, ltl.D4, ltl.D5, lt
 // IntReturnReg is the register for integer return values
 const IntReturnReg = ltl.X0
 
+// IntReturnRegHi holds the second word of a composite returned in two registers
+const IntReturnRegHi = ltl.X1
+
 // FloatReturnReg is the register for floating-point return values
 const FloatReturnReg = ltl.D0
 
+// ResultPtrReg is the indirect result location register: it carries the
+// address of the caller's buffer for composites returned in memory
+const ResultPtrReg = ltl.X8
+
 // AllocatableIntRegs are integer registers available for allocation
 // Excludes: X29 (FP), X30 (LR), X16/X17 (IP0/IP1 used by linker)
 var AllocatableIntRegs = []ltl.MReg{
@@ -67,11 +75,6 @@ const NumAllocatableIntRegs = 27
 // NumAllocatableFloatRegs is the number of allocatable float registers
 const NumAllocatableFloatRegs = 32
 
-// FirstCalleeSavedColor is the color index of the first callee-saved register
-// in AllocatableIntRegs. Colors 0-16 are caller-saved (X0-X15, X18),
-// colors 17-26 are callee-saved (X19-X28).
-const FirstCalleeSavedColor = 17
-
 // NumCalleeSavedRegs is the number of callee-saved integer registers
 const NumCalleeSavedRegs = 10
 
@@ -91,6 +94,19 @@ func ArgLocation(i int, isFloat bool) ltl.Loc {
 	return ltl.S{Slot: ltl.SlotIncoming, Ofs: int64(i-len(IntArgRegs)) * 8, Ty: ltl.Tlong}
 }
 
+// ParamLocation returns the location where the i-th parameter of a function
+// with the given signature arrives. The hidden result pointer of an Sret
+// function arrives in X8 and does not take an argument register.
+func ParamLocation(sig rtl.Sig, i int) ltl.Loc {
+	if sig.Sret {
+		if i == 0 {
+			return ltl.R{Reg: ResultPtrReg}
+		}
+		i--
+	}
+	return ArgLocation(i, false)
+}
+
 // ReturnLocation returns the location for the return value
 func ReturnLocation(isFloat bool) ltl.Loc {
 	if isFloat {
@@ -13,8 +13,8 @@ type Allocator struct {
 	graph     *InterferenceGraph
 	liveness  *LivenessInfo
 	fn        *rtl.Function
-	K         int // Number of allocatable registers
-	colors    map[rtl.Reg]int // Assigned color (machine register index)
+	floats    RegSet          // Registers allocated to float registers, see FloatRegs
+	colors    map[rtl.Reg]int // Assigned color (index in the registers of its class)
 	spillSlot map[rtl.Reg]int // Spill slot offset for spilled registers
 
 	// IRC worklists
@@ -37,7 +37,7 @@ type Allocator struct {
 	worklistMoves    [][2]rtl.Reg // Active move candidates
 	activeMoves      [][2]rtl.Reg // Moves not yet ready to coalesce
 
-	nextSpillSlot int64 // Next available spill slot offset
+	nextSpillSlot int64 // End of the spill slots in use, see assignSpillSlots
 
 	// Precolored registers for parameters (maps param index to its fixed location)
 	precoloredParams map[rtl.Reg]ltl.Loc
@@ -59,7 +59,7 @@ func NewAllocator(fn *rtl.Function, graph *InterferenceGraph, liveness *Liveness
 		fn:               fn,
 		graph:            graph,
 		liveness:         liveness,
-		K:                NumAllocatableIntRegs,
+		floats:           FloatRegs(fn),
 		colors:           make(map[rtl.Reg]int),
 		spillSlot:        make(map[rtl.Reg]int),
 		coalescedNodes:   NewRegSet(),
@@ -70,22 +70,54 @@ func NewAllocator(fn *rtl.Function, graph *InterferenceGraph, liveness *Liveness
 		precoloredParams: make(map[rtl.Reg]ltl.Loc),
 	}
 
+	// Integer and float registers are allocated from separate register
+	// files, so registers of different classes never compete for one
+	for r := range graph.Nodes {
+		for n := range graph.Edges[r] {
+			if a.floats.Contains(r) != a.floats.Contains(n) {
+				delete(graph.Edges[r], n)
+			}
+		}
+		for n := range graph.Preferences[r] {
+			if a.floats.Contains(r) != a.floats.Contains(n) {
+				delete(graph.Preferences[r], n)
+			}
+		}
+	}
+
 	// Precolor parameters according to calling convention
-	// Parameters 0-7 go to X0-X7, parameters 8+ go on the stack
+	// Parameters 0-7 go to X0-X7, parameters 8+ go on the stack, and the
+	// hidden result pointer of an Sret function arrives in X8
 	// IMPORTANT: Do NOT precolor parameters that are live across calls.
 	// Those parameters need to be moved to callee-saved registers.
+	// Float parameters arrive in an X register too, and are moved to a
+	// float register on entry.
 	for i, param := range fn.Params {
 		// Check if this parameter is live across any call
-		if graph.LiveAcrossCalls.Contains(param) {
+		if graph.LiveAcrossCalls.Contains(param) || a.floats.Contains(param) {
 			// Don't precolor - let it be allocated to a callee-saved register
 			continue
 		}
-		a.precoloredParams[param] = ArgLocation(i, false)
+		a.precoloredParams[param] = ParamLocation(fn.Sig, i)
 	}
 
 	return a
 }
 
+// regs returns the machine registers r may be allocated to, indexed by
+// color: the float registers for a float value, else the integer ones.
+func (a *Allocator) regs(r rtl.Reg) []ltl.MReg {
+	if a.floats.Contains(r) {
+		return AllocatableFloatRegs
+	}
+	return AllocatableIntRegs
+}
+
+// k returns the number of colors available to r
+func (a *Allocator) k(r rtl.Reg) int {
+	return len(a.regs(r))
+}
+
 // Allocate performs register allocation and returns the result
 func (a *Allocator) Allocate() *AllocationResult {
 	a.buildWorklists()
@@ -129,13 +161,14 @@ func (a *Allocator) buildWorklists() {
 		// Stack-slot params don't get colored - they'll be handled in buildResult
 	}
 
-	// Categorize non-precolored nodes into worklists
-	for r := range a.graph.Nodes {
+	// Categorize non-precolored nodes into worklists, in register order
+	// so the allocation does not depend on map iteration
+	for _, r := range SortedRegSlice(a.graph.Nodes) {
 		// Skip precolored params - they're already colored
 		if _, isParam := a.precoloredParams[r]; isParam {
 			continue
 		}
-		if a.degree(r) >= a.K {
+		if a.degree(r) >= a.k(r) {
 			a.spillWorklist = append(a.spillWorklist, r)
 		} else if a.graph.MoveRelated(r) {
 			a.freezeWorklist = append(a.freezeWorklist, r)
@@ -145,8 +178,8 @@ func (a *Allocator) buildWorklists() {
 	}
 
 	// Build initial move worklist from preferences
-	for r, prefs := range a.graph.Preferences {
-		for p := range prefs {
+	for _, r := range SortedRegSlice(a.graph.Nodes) {
+		for _, p := range SortedRegSlice(a.graph.Preferences[r]) {
 			if r < p { // Avoid duplicates
 				a.worklistMoves = append(a.worklistMoves, [2]rtl.Reg{r, p})
 			}
@@ -176,18 +209,19 @@ func (a *Allocator) simplify() {
 	a.onSelectStack.Add(r)
 
 	// Update neighbors' degrees
-	for neighbor := range a.graph.Edges[r] {
+	for _, neighbor := range SortedRegSlice(a.graph.Edges[r]) {
 		a.decrementDegree(neighbor)
 	}
 }
 
 func (a *Allocator) decrementDegree(r rtl.Reg) {
-	if a.coalescedNodes.Contains(r) {
+	// Nodes already simplified must not be queued again
+	if a.coalescedNodes.Contains(r) || a.onSelectStack.Contains(r) {
 		return
 	}
 
 	// If degree drops below K, move to appropriate worklist
-	if a.degree(r) == a.K-1 {
+	if a.degree(r) == a.k(r)-1 {
 		// Remove from spill worklist
 		a.removeFromWorklist(r, &a.spillWorklist)
 
@@ -255,7 +289,8 @@ func (a *Allocator) getAlias(r rtl.Reg) rtl.Reg {
 
 func (a *Allocator) conservativeCoalesce(u, v rtl.Reg) bool {
 	// Conservative coalescing (Briggs criterion):
-	// Safe to coalesce if combined node has < K high-degree neighbors
+	// Safe to coalesce if combined node has < K high-degree neighbors, u
+	// and v being of the same class
 	highDegreeNeighbors := 0
 	neighbors := NewRegSet()
 
@@ -271,12 +306,12 @@ func (a *Allocator) conservativeCoalesce(u, v rtl.Reg) bool {
 	}
 
 	for n := range neighbors {
-		if a.degree(n) >= a.K {
+		if a.degree(n) >= a.k(n) {
 			highDegreeNeighbors++
 		}
 	}
 
-	return highDegreeNeighbors < a.K
+	return highDegreeNeighbors < a.k(u)
 }
 
 func (a *Allocator) combine(u, v rtl.Reg) {
@@ -294,7 +329,7 @@ func (a *Allocator) combine(u, v rtl.Reg) {
 	}
 
 	// Merge edges
-	for n := range a.graph.Edges[v] {
+	for _, n := range SortedRegSlice(a.graph.Edges[v]) {
 		if !a.coalescedNodes.Contains(n) && n != u {
 			a.graph.AddEdge(u, n)
 			a.decrementDegree(n)
@@ -309,7 +344,7 @@ func (a *Allocator) combine(u, v rtl.Reg) {
 	}
 
 	// If u now has high degree, move to spill worklist
-	if a.degree(u) >= a.K {
+	if a.degree(u) >= a.k(u) {
 		a.removeFromWorklist(u, &a.freezeWorklist)
 		a.spillWorklist = append(a.spillWorklist, u)
 	}
@@ -319,7 +354,7 @@ func (a *Allocator) addToWorklist(r rtl.Reg) {
 	if a.coalescedNodes.Contains(r) {
 		return
 	}
-	if a.degree(r) < a.K && !a.graph.MoveRelated(r) {
+	if a.degree(r) < a.k(r) && !a.graph.MoveRelated(r) {
 		a.removeFromWorklist(r, &a.freezeWorklist)
 		a.simplifyWorklist = append(a.simplifyWorklist, r)
 	}
@@ -398,16 +433,15 @@ func (a *Allocator) assignColors() {
 			}
 		}
 
-		// Determine the starting color based on whether this register is live across calls
-		// If live across a call, only use callee-saved registers (colors FirstCalleeSavedColor and above)
-		startColor := 0
-		if a.graph.LiveAcrossCalls.Contains(r) {
-			startColor = FirstCalleeSavedColor
-		}
+		// If live across a call, only use callee-saved registers
+		acrossCalls := a.graph.LiveAcrossCalls.Contains(r)
 
 		// Try to assign a color
 		color := -1
-		for c := startColor; c < a.K; c++ {
+		for c, mreg := range a.regs(r) {
+			if acrossCalls && !IsCalleeSaved(mreg) {
+				continue
+			}
 			if !usedColors[c] {
 				color = c
 				break
@@ -418,12 +452,11 @@ func (a *Allocator) assignColors() {
 			a.coloredNodes.Add(r)
 			a.colors[r] = color
 		} else {
-			// Must spill
+			// Must spill; the slot is chosen once all spills are known
 			a.spilledNodes.Add(r)
-			a.spillSlot[r] = int(a.nextSpillSlot)
-			a.nextSpillSlot += 8 // 8 bytes per spill slot
 		}
 	}
+	a.assignSpillSlots()
 
 	// Copy colors to coalesced nodes
 	for r := range a.coalescedNodes {
@@ -443,6 +476,28 @@ func (a *Allocator) assignColors() {
 	}
 }
 
+// assignSpillSlots gives each spilled node an 8-byte stack slot. Spilled
+// nodes that interfere are live at the same point and get distinct slots,
+// while those whose lifetimes are disjoint share one, so the frame holds
+// as many slots as there are spilled values live at once. In register
+// order, each node takes the lowest slot no interfering node has taken.
+func (a *Allocator) assignSpillSlots() {
+	for _, r := range SortedRegSlice(a.spilledNodes) {
+		usedSlots := make(map[int]bool)
+		for neighbor := range a.graph.Edges[r] {
+			if slot, ok := a.spillSlot[a.getAlias(neighbor)]; ok {
+				usedSlots[slot] = true
+			}
+		}
+		slot := 0
+		for usedSlots[slot] {
+			slot += 8
+		}
+		a.spillSlot[r] = slot
+		a.nextSpillSlot = max(a.nextSpillSlot, int64(slot)+8)
+	}
+}
+
 func (a *Allocator) buildResult() *AllocationResult {
 	result := &AllocationResult{
 		RegToLoc:    make(map[rtl.Reg]ltl.Loc),
@@ -462,8 +517,8 @@ func (a *Allocator) buildResult() *AllocationResult {
 			continue
 		}
 		color := a.colors[r]
-		if color < len(AllocatableIntRegs) {
-			result.RegToLoc[r] = ltl.R{Reg: AllocatableIntRegs[color]}
+		if regs := a.regs(r); color < len(regs) {
+			result.RegToLoc[r] = ltl.R{Reg: regs[color]}
 		}
 	}
 
@@ -474,10 +529,14 @@ func (a *Allocator) buildResult() *AllocationResult {
 			continue
 		}
 		slot := a.spillSlot[r]
+		ty := ltl.Tlong
+		if a.floats.Contains(r) {
+			ty = ltl.Tfloat
+		}
 		result.RegToLoc[r] = ltl.S{
 			Slot: ltl.SlotLocal,
 			Ofs:  int64(slot),
-			Ty:   ltl.Tlong,
+			Ty:   ty,
 		}
 	}
 
@@ -522,6 +581,9 @@ func GetAllRegisters(fn *rtl.Function) RegSet {
 			if i.Dest != 0 {
 				regs.Add(i.Dest)
 			}
+			if i.DestHi != 0 {
+				regs.Add(i.DestHi)
+			}
 			if fr, ok := i.Fn.(rtl.FunReg); ok {
 				regs.Add(fr.Reg)
 			}
@@ -549,6 +611,9 @@ func GetAllRegisters(fn *rtl.Function) RegSet {
 			if i.Arg != nil {
 				regs.Add(*i.Arg)
 			}
+			if i.ArgHi != nil {
+				regs.Add(*i.ArgHi)
+			}
 		}
 	}
 	return regs
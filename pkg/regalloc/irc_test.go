@@ -301,3 +301,118 @@ func TestRegisterLiveAcrossCallUsesCalleeSaved(t *testing.T) {
 		t.Errorf("n is live across call and should be in callee-saved register, got %s (caller-saved)", r.Reg)
 	}
 }
+
+func TestSpillSlotsShared(t *testing.T) {
+	// Three phases in a row, each defining more values than there are
+	// registers and then summing them into the accumulator acc, so each
+	// phase spills values that are dead by the next one.
+	code := make(map[rtl.Node]rtl.Instruction)
+	node, reg := rtl.Node(1), rtl.Reg(1)
+	emit := func(instr func(succ rtl.Node) rtl.Instruction) {
+		code[node] = instr(node + 1)
+		node++
+	}
+	acc := reg
+	reg++
+	emit(func(succ rtl.Node) rtl.Instruction {
+		return rtl.Iop{Op: rtl.Ointconst{Value: 0}, Dest: acc, Succ: succ}
+	})
+	for phase := 0; phase < 3; phase++ {
+		var values []rtl.Reg
+		for i := 0; i < NumAllocatableIntRegs+3; i++ {
+			r := reg
+			reg++
+			values = append(values, r)
+			emit(func(succ rtl.Node) rtl.Instruction {
+				return rtl.Iop{Op: rtl.Ointconst{Value: int32(i)}, Dest: r, Succ: succ}
+			})
+		}
+		for _, r := range values {
+			emit(func(succ rtl.Node) rtl.Instruction {
+				return rtl.Iop{Op: rtl.Oadd{}, Args: []rtl.Reg{acc, r}, Dest: acc, Succ: succ}
+			})
+		}
+	}
+	code[node] = rtl.Ireturn{Arg: ptr(acc)}
+	fn := &rtl.Function{Name: "phases", Code: code, Entrypoint: 1}
+
+	result := AllocateFunction(fn)
+
+	slotOf := make(map[rtl.Reg]int64)
+	slots := make(map[int64]bool)
+	for r := range result.SpilledRegs {
+		s, ok := result.RegToLoc[r].(ltl.S)
+		if !ok {
+			t.Fatalf("spilled register %d has no stack slot: %v", r, result.RegToLoc[r])
+		}
+		slotOf[r] = s.Ofs
+		slots[s.Ofs] = true
+	}
+	if len(slots) == 0 || len(slots) >= len(result.SpilledRegs) {
+		t.Fatalf("expected fewer slots than the %d spilled values, got %d", len(result.SpilledRegs), len(slots))
+	}
+	if result.StackSize != int64(len(slots))*8 {
+		t.Errorf("expected a stack size of %d slots, got %d bytes", len(slots), result.StackSize)
+	}
+
+	// Values live at the same time never share a slot
+	graph := BuildInterferenceGraph(fn, AnalyzeLiveness(fn))
+	for r, ofs := range slotOf {
+		for other, otherOfs := range slotOf {
+			if r != other && ofs == otherOfs && graph.HasEdge(r, other) {
+				t.Errorf("interfering registers %d and %d share the slot at %d", r, other, ofs)
+			}
+		}
+	}
+}
+
+func TestAllocateFloatRegisters(t *testing.T) {
+	// int lt(double a, double b) { return a < b; }, with a call keeping a
+	// float value live across it:
+	// 1: x3 = move(x1)
+	// 2: x4 = call "g"() (x2 and x3 live across it)
+	// 3: x5 = cmpf <(x3, x2)
+	// 4: return x5
+	fn := &rtl.Function{
+		Name:   "lt",
+		Sig:    rtl.Sig{Args: []string{"double", "double"}, Return: "int"},
+		Params: []rtl.Reg{1, 2},
+		Code: map[rtl.Node]rtl.Instruction{
+			1: rtl.Iop{Op: rtl.Omove{}, Args: []rtl.Reg{1}, Dest: 3, Succ: 2},
+			2: rtl.Icall{Sig: rtl.Sig{Return: "int"}, Fn: rtl.FunSymbol{Name: "g"}, Dest: 4, Succ: 3},
+			3: rtl.Iop{Op: rtl.Ocmpf{Cond: rtl.Clt}, Args: []rtl.Reg{3, 2}, Dest: 5, Succ: 4},
+			4: rtl.Ireturn{Arg: ptr(rtl.Reg(5))},
+		},
+		Entrypoint: 1,
+	}
+
+	floats := FloatRegs(fn)
+	for _, r := range []rtl.Reg{1, 2, 3} {
+		if !floats.Contains(r) {
+			t.Errorf("x%d should be a float register", r)
+		}
+	}
+	for _, r := range []rtl.Reg{4, 5} {
+		if floats.Contains(r) {
+			t.Errorf("x%d should be an integer register", r)
+		}
+	}
+
+	result := AllocateFunction(fn)
+	for _, r := range []rtl.Reg{1, 2, 3} {
+		loc, ok := result.RegToLoc[r].(ltl.R)
+		if !ok || !loc.Reg.IsFloat() {
+			t.Errorf("x%d should be in a float register, got %v", r, result.RegToLoc[r])
+			continue
+		}
+		// Live across the call, so in a callee-saved D8-D15
+		if r != 1 && !IsCalleeSaved(loc.Reg) {
+			t.Errorf("x%d is live across a call and should be callee-saved, got %v", r, loc.Reg)
+		}
+	}
+	for _, r := range []rtl.Reg{4, 5} {
+		if loc, ok := result.RegToLoc[r].(ltl.R); !ok || !loc.Reg.IsInteger() {
+			t.Errorf("x%d should be in an integer register, got %v", r, result.RegToLoc[r])
+		}
+	}
+}
@@ -131,6 +131,9 @@ func ComputeDefUse(fn *rtl.Function) (def, use map[rtl.Node]RegSet) {
 			if i.Dest != 0 {
 				def[node].Add(i.Dest)
 			}
+			if i.DestHi != 0 {
+				def[node].Add(i.DestHi)
+			}
 		case rtl.Itailcall:
 			// Uses args and possibly function pointer
 			for _, arg := range i.Args {
@@ -160,6 +163,9 @@ func ComputeDefUse(fn *rtl.Function) (def, use map[rtl.Node]RegSet) {
 			if i.Arg != nil {
 				use[node].Add(*i.Arg)
 			}
+			if i.ArgHi != nil {
+				use[node].Add(*i.ArgHi)
+			}
 		}
 	}
 
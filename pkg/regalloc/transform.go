@@ -14,11 +14,13 @@ func TransformFunction(rtlFn *rtl.Function) *ltl.Function {
 
 	ltlFn := ltl.NewFunction(rtlFn.Name, rtlFn.Sig)
 	ltlFn.Stacksize = rtlFn.Stacksize + allocation.StackSize
+	ltlFn.StackData = rtlFn.Stacksize
+	ltlFn.Static = rtlFn.Static
 
-	// Build parameter entry locations (X0-X7 for first 8 args)
-	// These are the locations where arguments arrive
+	// Build parameter entry locations (X0-X7 for first 8 args, X8 for the
+	// hidden result pointer). These are the locations where arguments arrive
 	for i := range rtlFn.Params {
-		ltlFn.Params = append(ltlFn.Params, ArgLocation(i, false))
+		ltlFn.Params = append(ltlFn.Params, ParamLocation(rtlFn.Sig, i))
 	}
 
 	// Group instructions into basic blocks
@@ -42,7 +44,7 @@ func TransformFunction(rtlFn *rtl.Function) *ltl.Function {
 		argLocs := make([]ltl.Loc, len(rtlFn.Params))
 		allocLocs := make([]ltl.Loc, len(rtlFn.Params))
 		for i, param := range rtlFn.Params {
-			argLocs[i] = ArgLocation(i, false)
+			argLocs[i] = ParamLocation(rtlFn.Sig, i)
 			allocLocs[i] = allocation.RegToLoc[param]
 		}
 		paramMoves = resolveParallelMoves(argLocs, allocLocs)
@@ -95,7 +97,7 @@ func transformInstruction(instr rtl.Instruction, alloc *AllocationResult) *ltl.B
 		dest := alloc.RegToLoc[i.Dest]
 		return &ltl.BBlock{
 			Body: []ltl.Instruction{
-				ltl.Lload{Chunk: i.Chunk, Addr: i.Addr, Args: args, Dest: dest},
+				ltl.Lload{Chunk: i.Chunk, Addr: i.Addr, Args: args, Dest: dest, Volatile: i.Volatile},
 				ltl.Lbranch{Succ: ltl.Node(i.Succ)},
 			},
 		}
@@ -105,7 +107,7 @@ func transformInstruction(instr rtl.Instruction, alloc *AllocationResult) *ltl.B
 		src := alloc.RegToLoc[i.Src]
 		return &ltl.BBlock{
 			Body: []ltl.Instruction{
-				ltl.Lstore{Chunk: i.Chunk, Addr: i.Addr, Args: args, Src: src},
+				ltl.Lstore{Chunk: i.Chunk, Addr: i.Addr, Args: args, Src: src, Volatile: i.Volatile},
 				ltl.Lbranch{Succ: ltl.Node(i.Succ)},
 			},
 		}
@@ -123,7 +125,14 @@ func transformInstruction(instr rtl.Instruction, alloc *AllocationResult) *ltl.B
 			ltl.Lcall{Sig: i.Sig, Fn: fn, Args: args},
 		}
 		// If call has a destination, move the return value (X0) to it
-		if i.Dest != 0 {
+		if i.Dest != 0 && i.DestHi != 0 {
+			// Two-word result in X0/X1: the destinations may overlap the
+			// return registers, so move both in parallel
+			body = append(body, resolveParallelMoves(
+				[]ltl.Loc{ReturnLocation(false), ltl.R{Reg: IntReturnRegHi}},
+				[]ltl.Loc{alloc.RegToLoc[i.Dest], alloc.RegToLoc[i.DestHi]},
+			)...)
+		} else if i.Dest != 0 {
 			destLoc := alloc.RegToLoc[i.Dest]
 			retLoc := ReturnLocation(false) // TODO: handle float returns
 			// Only add move if destination is not already X0
@@ -195,7 +204,12 @@ func transformInstruction(instr rtl.Instruction, alloc *AllocationResult) *ltl.B
 	case rtl.Ireturn:
 		var instrs []ltl.Instruction
 		// If there's a return value, move it to the return register
-		if i.Arg != nil {
+		if i.Arg != nil && i.ArgHi != nil {
+			instrs = append(instrs, resolveParallelMoves(
+				[]ltl.Loc{alloc.RegToLoc[*i.Arg], alloc.RegToLoc[*i.ArgHi]},
+				[]ltl.Loc{ReturnLocation(false), ltl.R{Reg: IntReturnRegHi}},
+			)...)
+		} else if i.Arg != nil {
 			srcLoc := alloc.RegToLoc[*i.Arg]
 			destLoc := ReturnLocation(false) // TODO: handle float returns
 			// Only add move if not already in return register
@@ -234,6 +248,7 @@ func TransformProgram(rtlProg *rtl.Program) *ltl.Program {
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		})
 	}
 
@@ -277,7 +292,19 @@ func resolveParallelMoves(srcLocs, dstLocs []ltl.Loc) []ltl.Instruction {
 	}
 
 	// For each source that is also a destination (potential clobber),
-	// we need to save it first. Use X8-X15 as temporary storage.
+	// we need to save it first. Use whichever of X8-X15 the moves do not
+	// touch as temporary storage.
+	inUse := make(map[ltl.Loc]bool)
+	for _, m := range moves {
+		inUse[m.src] = true
+		inUse[m.dst] = true
+	}
+	var temps []ltl.Loc
+	for r := ltl.X8; r <= ltl.X15; r++ {
+		if loc := (ltl.R{Reg: r}); !inUse[loc] {
+			temps = append(temps, loc)
+		}
+	}
 	tmpIndex := 0
 	savedLocs := make(map[ltl.Loc]ltl.Loc) // original loc -> temp loc
 	var result []ltl.Instruction
@@ -286,14 +313,13 @@ func resolveParallelMoves(srcLocs, dstLocs []ltl.Loc) []ltl.Instruction {
 	for _, m := range moves {
 		if dstSet[m.src] {
 			if _, alreadySaved := savedLocs[m.src]; !alreadySaved {
-				// Allocate a temp register (X8, X9, ... X15)
-				tmp := ltl.R{Reg: ltl.MReg(ltl.X8 + ltl.MReg(tmpIndex))}
-				tmpIndex++
-				if tmpIndex > 8 {
+				if tmpIndex >= len(temps) {
 					// Ran out of temp registers - fall back to simple sequential
 					// This should rarely happen
 					break
 				}
+				tmp := temps[tmpIndex]
+				tmpIndex++
 				// Save the source value
 				result = append(result, ltl.Lop{
 					Op:   rtl.Omove{},
@@ -1,6 +1,7 @@
 package regalloc
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/ltl"
@@ -319,3 +320,56 @@ func TestTransformNop(t *testing.T) {
 		t.Error("nop should become branch to successor")
 	}
 }
+
+func TestTransformFunctionSretParams(t *testing.T) {
+	// f(ret *T, x int): the result pointer arrives in X8, x in X0
+	rtlFn := &rtl.Function{
+		Name:   "f",
+		Sig:    rtl.Sig{Sret: true},
+		Params: []rtl.Reg{1, 2},
+		Code: map[rtl.Node]rtl.Instruction{
+			1: rtl.Istore{Chunk: rtl.Mint64, Addr: rtl.Aindexed{Offset: 0}, Args: []rtl.Reg{1}, Src: 2, Succ: 2},
+			2: rtl.Ireturn{},
+		},
+		Entrypoint: 1,
+	}
+
+	ltlFn := TransformFunction(rtlFn)
+
+	want := []ltl.Loc{ltl.R{Reg: ltl.X8}, ltl.R{Reg: ltl.X0}}
+	if !reflect.DeepEqual(ltlFn.Params, want) {
+		t.Errorf("expected params %v, got %v", want, ltlFn.Params)
+	}
+}
+
+func TestTransformTwoWordResult(t *testing.T) {
+	// r, rhi = callee(); return rhi, r: the words swap between X0 and X1
+	rtlFn := &rtl.Function{
+		Name: "swap",
+		Code: map[rtl.Node]rtl.Instruction{
+			1: rtl.Icall{Fn: rtl.FunSymbol{Name: "callee"}, Dest: 1, DestHi: 2, Succ: 2},
+			2: rtl.Ireturn{Arg: ptr(rtl.Reg(2)), ArgHi: ptr(rtl.Reg(1))},
+		},
+		Entrypoint: 1,
+	}
+
+	ltlFn := TransformFunction(rtlFn)
+
+	// Simulate the moves after the call and before the return
+	regs := map[ltl.Loc]string{
+		ltl.R{Reg: ltl.X0}: "lo",
+		ltl.R{Reg: ltl.X1}: "hi",
+	}
+	run := func(body []ltl.Instruction) {
+		for _, instr := range body {
+			if op, ok := instr.(ltl.Lop); ok {
+				regs[op.Dest] = regs[op.Args[0]]
+			}
+		}
+	}
+	run(ltlFn.Code[1].Body)
+	run(ltlFn.Code[2].Body)
+	if regs[ltl.R{Reg: ltl.X0}] != "hi" || regs[ltl.R{Reg: ltl.X1}] != "lo" {
+		t.Errorf("expected X0=hi X1=lo, got X0=%s X1=%s", regs[ltl.R{Reg: ltl.X0}], regs[ltl.R{Reg: ltl.X1}])
+	}
+}
@@ -352,20 +352,22 @@ type Iop struct {
 
 // Iload loads from memory: dest = Mem[addr(args...)]
 type Iload struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []Reg          // registers for addressing
-	Dest  Reg            // destination register
-	Succ  Node           // successor node
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []Reg          // registers for addressing
+	Dest     Reg            // destination register
+	Succ     Node           // successor node
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Istore stores to memory: Mem[addr(args...)] = src
 type Istore struct {
-	Chunk Chunk          // memory access size/type
-	Addr  AddressingMode // addressing mode
-	Args  []Reg          // registers for addressing
-	Src   Reg            // source register (value to store)
-	Succ  Node           // successor node
+	Chunk    Chunk          // memory access size/type
+	Addr     AddressingMode // addressing mode
+	Args     []Reg          // registers for addressing
+	Src      Reg            // source register (value to store)
+	Succ     Node           // successor node
+	Volatile bool           // volatile access: never removed, merged or reordered
 }
 
 // Icall performs a function call
@@ -374,6 +376,7 @@ type Icall struct {
 	Fn     FunRef      // function to call (reg or symbol)
 	Args   []Reg       // argument registers
 	Dest   Reg         // destination for return value
+	DestHi Reg         // destination for the second result word in X1, 0 if none
 	Succ   Node        // successor node
 }
 
@@ -402,13 +405,14 @@ type Icond struct {
 
 // Ijumptable is an indexed jump (switch)
 type Ijumptable struct {
-	Arg    Reg    // register containing index
+	Arg    Reg    // register containing index, an int
 	Targets []Node // jump targets
 }
 
 // Ireturn returns from the function
 type Ireturn struct {
-	Arg *Reg // return value register (nil for void)
+	Arg   *Reg // return value register (nil for void)
+	ArgHi *Reg // second result word, returned in X1 (nil if none)
 }
 
 // Marker methods for Instruction interface
@@ -545,6 +549,7 @@ type Function struct {
 	Stacksize  int64              // stack frame size
 	Code       map[Node]Instruction // CFG: node -> instruction
 	Entrypoint Node               // entry node
+	Static     bool               // not visible outside the translation unit
 }
 
 // GlobVar represents a global variable
@@ -553,6 +558,7 @@ type GlobVar struct {
 	Size     int64
 	Init     []byte
 	ReadOnly bool // true for .rodata section (e.g., string literals)
+	Static   bool // not visible outside the translation unit
 }
 
 // Program represents a complete RTL program
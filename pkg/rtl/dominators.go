@@ -0,0 +1,117 @@
+// Dominator analysis for RTL control-flow graphs.
+// Uses the iterative algorithm of Cooper, Harvey and Kennedy
+// ("A Simple, Fast Dominance Algorithm") over a reverse postorder.
+package rtl
+
+// Predecessors returns the predecessor list of every node reachable in the CFG.
+// Successors that refer to nodes missing from fn.Code are ignored.
+func Predecessors(fn *Function) map[Node][]Node {
+	preds := make(map[Node][]Node)
+	for _, n := range ReversePostorder(fn) {
+		for _, s := range fn.Code[n].Successors() {
+			if _, ok := fn.Code[s]; ok {
+				preds[s] = append(preds[s], n)
+			}
+		}
+	}
+	return preds
+}
+
+// ReversePostorder returns the nodes reachable from the entry point in
+// reverse postorder of a depth-first traversal.
+func ReversePostorder(fn *Function) []Node {
+	visited := make(map[Node]bool)
+	var post []Node
+	var visit func(n Node)
+	visit = func(n Node) {
+		instr, ok := fn.Code[n]
+		if !ok || visited[n] {
+			return
+		}
+		visited[n] = true
+		for _, s := range instr.Successors() {
+			visit(s)
+		}
+		post = append(post, n)
+	}
+	visit(fn.Entrypoint)
+
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// DomTree records the immediate dominator of each reachable node.
+type DomTree struct {
+	Entry Node
+	Idom  map[Node]Node // entry maps to itself
+}
+
+// ComputeDominators builds the dominator tree of a function.
+func ComputeDominators(fn *Function) *DomTree {
+	order := ReversePostorder(fn)
+	if len(order) == 0 {
+		return &DomTree{Entry: fn.Entrypoint, Idom: make(map[Node]Node)}
+	}
+	index := make(map[Node]int, len(order))
+	for i, n := range order {
+		index[n] = i
+	}
+	preds := Predecessors(fn)
+
+	idom := map[Node]Node{fn.Entrypoint: fn.Entrypoint}
+	intersect := func(a, b Node) Node {
+		for a != b {
+			for index[a] > index[b] {
+				a = idom[a]
+			}
+			for index[b] > index[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, n := range order[1:] {
+			var newIdom Node
+			found := false
+			for _, p := range preds[n] {
+				if _, ok := idom[p]; !ok {
+					continue
+				}
+				if !found {
+					newIdom = p
+					found = true
+				} else {
+					newIdom = intersect(p, newIdom)
+				}
+			}
+			if found && idom[n] != newIdom {
+				idom[n] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	return &DomTree{Entry: fn.Entrypoint, Idom: idom}
+}
+
+// Dominates reports whether a dominates b. Every node dominates itself.
+// Unreachable nodes are dominated by nothing.
+func (d *DomTree) Dominates(a, b Node) bool {
+	if _, ok := d.Idom[b]; !ok {
+		return false
+	}
+	for {
+		if a == b {
+			return true
+		}
+		if b == d.Entry {
+			return false
+		}
+		b = d.Idom[b]
+	}
+}
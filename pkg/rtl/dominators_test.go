@@ -0,0 +1,103 @@
+package rtl
+
+import "testing"
+
+// loopFunction builds a simple counting loop:
+//
+//	5: x1 = int 0 -> 4
+//	4: if x1 < x2 -> 3 else 1
+//	3: x1 = addimm 1 (x1) -> 2
+//	2: nop -> 4
+//	1: return x1
+func loopFunction() *Function {
+	fn := NewFunction("loop", Sig{})
+	r1 := Reg(1)
+	fn.Code[5] = Iop{Op: Ointconst{Value: 0}, Dest: 1, Succ: 4}
+	fn.Code[4] = Icond{Cond: Ccomp{Cond: Clt}, Args: []Reg{1, 2}, IfSo: 3, IfNot: 1}
+	fn.Code[3] = Iop{Op: Oaddimm{N: 1}, Args: []Reg{1}, Dest: 1, Succ: 2}
+	fn.Code[2] = Inop{Succ: 4}
+	fn.Code[1] = Ireturn{Arg: &r1}
+	fn.Entrypoint = 5
+	return fn
+}
+
+func TestReversePostorder(t *testing.T) {
+	fn := loopFunction()
+	order := ReversePostorder(fn)
+	if len(order) != 5 {
+		t.Fatalf("expected 5 reachable nodes, got %v", order)
+	}
+	if order[0] != 5 {
+		t.Errorf("expected entry first, got %v", order)
+	}
+}
+
+func TestReversePostorderSkipsMissingNodes(t *testing.T) {
+	fn := NewFunction("f", Sig{})
+	fn.Code[1] = Inop{Succ: 7}
+	fn.Entrypoint = 1
+	if order := ReversePostorder(fn); len(order) != 1 {
+		t.Errorf("expected only node 1, got %v", order)
+	}
+}
+
+func TestPredecessors(t *testing.T) {
+	fn := loopFunction()
+	preds := Predecessors(fn)
+	if len(preds[4]) != 2 {
+		t.Errorf("header should have 2 predecessors, got %v", preds[4])
+	}
+	if len(preds[5]) != 0 {
+		t.Errorf("entry should have no predecessors, got %v", preds[5])
+	}
+}
+
+func TestComputeDominators(t *testing.T) {
+	fn := loopFunction()
+	dom := ComputeDominators(fn)
+
+	tests := []struct {
+		node, idom Node
+	}{
+		{5, 5},
+		{4, 5},
+		{3, 4},
+		{2, 3},
+		{1, 4},
+	}
+	for _, tt := range tests {
+		if got := dom.Idom[tt.node]; got != tt.idom {
+			t.Errorf("idom(%d) = %d, want %d", tt.node, got, tt.idom)
+		}
+	}
+
+	if !dom.Dominates(4, 2) {
+		t.Error("header should dominate latch")
+	}
+	if dom.Dominates(2, 4) {
+		t.Error("latch should not dominate header")
+	}
+	if !dom.Dominates(3, 3) {
+		t.Error("node should dominate itself")
+	}
+	if dom.Dominates(3, 1) {
+		t.Error("loop body should not dominate exit")
+	}
+}
+
+func TestComputeDominatorsDiamond(t *testing.T) {
+	fn := NewFunction("diamond", Sig{})
+	fn.Code[4] = Icond{Cond: Ccompimm{Cond: Ceq, N: 0}, Args: []Reg{1}, IfSo: 3, IfNot: 2}
+	fn.Code[3] = Inop{Succ: 1}
+	fn.Code[2] = Inop{Succ: 1}
+	fn.Code[1] = Ireturn{}
+	fn.Entrypoint = 4
+
+	dom := ComputeDominators(fn)
+	if dom.Idom[1] != 4 {
+		t.Errorf("join point idom = %d, want 4", dom.Idom[1])
+	}
+	if dom.Dominates(3, 1) || dom.Dominates(2, 1) {
+		t.Error("neither branch should dominate the join point")
+	}
+}
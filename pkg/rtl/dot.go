@@ -0,0 +1,53 @@
+package rtl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// PrintDot prints the control-flow graph of a function in Graphviz dot
+// format: one node per instruction, labeled with the instruction as the
+// printer shows it, and one edge per successor. The edges of a conditional
+// branch are labeled true and false, those of a jump table with the case
+// index.
+func PrintDot(w io.Writer, fn *Function) {
+	nodes := make([]Node, 0, len(fn.Code))
+	for n := range fn.Code {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i] < nodes[j]
+	})
+
+	fmt.Fprintf(w, "digraph %q {\n", fn.Name)
+	fmt.Fprintln(w, "  node [shape=box, fontname=monospace];")
+	fmt.Fprintln(w, "  entry [shape=point];")
+	fmt.Fprintf(w, "  entry -> n%d;\n", fn.Entrypoint)
+
+	var label bytes.Buffer
+	p := NewPrinter(&label)
+	for _, n := range nodes {
+		label.Reset()
+		p.printInstruction(fn.Code[n])
+		fmt.Fprintf(w, "  n%d [label=%q];\n", n, fmt.Sprintf("%d: %s", n, label.String()))
+	}
+
+	for _, n := range nodes {
+		switch i := fn.Code[n].(type) {
+		case Icond:
+			fmt.Fprintf(w, "  n%d -> n%d [label=\"true\"];\n", n, i.IfSo)
+			fmt.Fprintf(w, "  n%d -> n%d [label=\"false\"];\n", n, i.IfNot)
+		case Ijumptable:
+			for k, succ := range i.Targets {
+				fmt.Fprintf(w, "  n%d -> n%d [label=\"%d\"];\n", n, succ, k)
+			}
+		default:
+			for _, succ := range fn.Code[n].Successors() {
+				fmt.Fprintf(w, "  n%d -> n%d;\n", n, succ)
+			}
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,40 @@
+package rtl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintDot(t *testing.T) {
+	var buf bytes.Buffer
+	PrintDot(&buf, loopFunction())
+	out := buf.String()
+
+	nodes := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "n") && strings.Contains(line, "[label=\"") && !strings.Contains(line, "->") {
+			nodes++
+		}
+	}
+	if nodes != 5 {
+		t.Errorf("expected 5 nodes, got %d\n%s", nodes, out)
+	}
+
+	for _, want := range []string{
+		`digraph "loop" {`,
+		"entry -> n5;",
+		`n4 [label="4: if x1 < x2 goto 3 else goto 1"];`,
+		`n4 -> n3 [label="true"];`,
+		`n4 -> n1 [label="false"];`,
+		"n3 -> n2;",
+		"n2 -> n4;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "n1 ->") {
+		t.Errorf("return has no successors\n%s", out)
+	}
+}
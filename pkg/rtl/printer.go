@@ -138,6 +138,10 @@ func (p *Printer) printOperation(op Operation) {
 		fmt.Fprint(p.w, "mul")
 	case Omulimm:
 		fmt.Fprintf(p.w, "mulimm %d", o.N)
+	case Omulhs:
+		fmt.Fprint(p.w, "mulhs")
+	case Omulhu:
+		fmt.Fprint(p.w, "mulhu")
 	case Odiv:
 		fmt.Fprint(p.w, "divs")
 	case Odivu:
@@ -332,7 +336,11 @@ func (p *Printer) printAddressingMode(addr AddressingMode, args []Reg) {
 
 func (p *Printer) printCall(i Icall) {
 	if i.Dest != 0 {
-		fmt.Fprintf(p.w, "x%d = ", i.Dest)
+		fmt.Fprintf(p.w, "x%d", i.Dest)
+		if i.DestHi != 0 {
+			fmt.Fprintf(p.w, ", x%d", i.DestHi)
+		}
+		fmt.Fprint(p.w, " = ")
 	}
 	fmt.Fprint(p.w, "call ")
 	p.printFunRef(i.Fn)
@@ -457,6 +465,9 @@ func (p *Printer) printJumptable(i Ijumptable) {
 func (p *Printer) printReturn(i Ireturn) {
 	if i.Arg != nil {
 		fmt.Fprintf(p.w, "return x%d", *i.Arg)
+		if i.ArgHi != nil {
+			fmt.Fprintf(p.w, ", x%d", *i.ArgHi)
+		}
 	} else {
 		fmt.Fprint(p.w, "return")
 	}
@@ -57,6 +57,10 @@ func (t *ExprTranslator) TranslateExpr(e cminorsel.Expr, dest rtl.Reg, succ rtl.
 		return t.translateAddshift(expr, dest, succ)
 	case cminorsel.Esubshift:
 		return t.translateSubshift(expr, dest, succ)
+	case cminorsel.Emulhi:
+		return t.translateMulhi(expr, dest, succ)
+	case cminorsel.Eshiftimm:
+		return t.translateShiftimm(expr, dest, succ)
 	case cminorsel.Ecmp:
 		return t.translateCmp(expr, dest, succ)
 	default:
@@ -150,10 +154,14 @@ func (t *ExprTranslator) translateLoad(e cminorsel.Eload, dest rtl.Reg, succ rtl
 	// Emit load instruction
 	addr := TranslateAddressingMode(e.Mode)
 	chunk := TranslateChunk(e.Chunk)
+	emitLoad := t.ib.EmitLoad
+	if e.Volatile {
+		emitLoad = t.ib.EmitVolatileLoad
+	}
 	
 	if len(e.Args) == 0 {
 		// No address args - just emit load directly
-		return t.ib.EmitLoad(chunk, addr, nil, dest, succ)
+		return emitLoad(chunk, addr, nil, dest, succ)
 	}
 	
 	// We already translated args chaining to succ, but that's wrong.
@@ -161,7 +169,7 @@ func (t *ExprTranslator) translateLoad(e cminorsel.Eload, dest rtl.Reg, succ rtl
 	// Let's re-do this properly:
 	
 	// First, emit load -> succ
-	loadNode := t.ib.EmitLoad(chunk, addr, argRegs, dest, succ)
+	loadNode := emitLoad(chunk, addr, argRegs, dest, succ)
 	
 	// Now translate args -> loadNode
 	// But we already got argRegs... we need to redo TranslateExprList
@@ -266,11 +274,13 @@ func (t *ExprTranslator) translateLet(e cminorsel.Elet, dest rtl.Reg, succ rtl.N
 	// Push the bound register onto a let stack (we'd need to track this)
 	// For simplicity, we'll use the letvar index to look up
 	t.pushLetBinding(boundReg)
-	defer t.popLetBinding()
 	
 	// Translate body -> succ
 	bodyEntry := t.TranslateExpr(e.Body, dest, succ)
 	
+	// The bound expression sees only the enclosing bindings
+	t.popLetBinding()
+	
 	// Translate bind -> body
 	return t.TranslateExpr(e.Bind, boundReg, bodyEntry)
 }
@@ -320,11 +330,15 @@ func (t *ExprTranslator) translateAddshift(e cminorsel.Eaddshift, dest rtl.Reg,
 	// For now, emit: tmp = right << shift; dest = left + tmp
 	
 	// Shift right operand
-	shiftOp := translateShiftOp(e.Op, e.Shift)
+	shiftOp := translateShiftOp(e.Op, e.Shift, e.Long)
 	shiftedReg := t.regs.Fresh()
 	
 	// dest = left + shifted
-	addNode := t.ib.EmitOp(rtl.Oadd{}, []rtl.Reg{leftReg, shiftedReg}, dest, succ)
+	var addOp rtl.Operation = rtl.Oadd{}
+	if e.Long {
+		addOp = rtl.Oaddl{}
+	}
+	addNode := t.ib.EmitOp(addOp, []rtl.Reg{leftReg, shiftedReg}, dest, succ)
 	
 	// shifted = right << amount
 	shiftNode := t.ib.EmitOp(shiftOp, []rtl.Reg{rightReg}, shiftedReg, addNode)
@@ -341,11 +355,15 @@ func (t *ExprTranslator) translateSubshift(e cminorsel.Esubshift, dest rtl.Reg,
 	leftReg := t.regs.Fresh()
 	rightReg := t.regs.Fresh()
 	
-	shiftOp := translateShiftOp(e.Op, e.Shift)
+	shiftOp := translateShiftOp(e.Op, e.Shift, e.Long)
 	shiftedReg := t.regs.Fresh()
 	
 	// dest = left - shifted
-	subNode := t.ib.EmitOp(rtl.Osub{}, []rtl.Reg{leftReg, shiftedReg}, dest, succ)
+	var subOp rtl.Operation = rtl.Osub{}
+	if e.Long {
+		subOp = rtl.Osubl{}
+	}
+	subNode := t.ib.EmitOp(subOp, []rtl.Reg{leftReg, shiftedReg}, dest, succ)
 	
 	// shifted = right << amount
 	shiftNode := t.ib.EmitOp(shiftOp, []rtl.Reg{rightReg}, shiftedReg, subNode)
@@ -357,7 +375,37 @@ func (t *ExprTranslator) translateSubshift(e cminorsel.Esubshift, dest rtl.Reg,
 	return t.TranslateExpr(e.Left, leftReg, rightEntry)
 }
 
-func translateShiftOp(op cminorsel.ShiftOp, amount int) rtl.Operation {
+func (t *ExprTranslator) translateMulhi(e cminorsel.Emulhi, dest rtl.Reg, succ rtl.Node) rtl.Node {
+	leftReg := t.regs.Fresh()
+	rightReg := t.regs.Fresh()
+
+	var op rtl.Operation = rtl.Omulhs{}
+	if e.Unsigned {
+		op = rtl.Omulhu{}
+	}
+	opNode := t.ib.EmitOp(op, []rtl.Reg{leftReg, rightReg}, dest, succ)
+
+	rightEntry := t.TranslateExpr(e.Right, rightReg, opNode)
+	return t.TranslateExpr(e.Left, leftReg, rightEntry)
+}
+
+func (t *ExprTranslator) translateShiftimm(e cminorsel.Eshiftimm, dest rtl.Reg, succ rtl.Node) rtl.Node {
+	argReg := t.regs.Fresh()
+	opNode := t.ib.EmitOp(translateShiftOp(e.Op, e.Shift, false), []rtl.Reg{argReg}, dest, succ)
+	return t.TranslateExpr(e.Arg, argReg, opNode)
+}
+
+func translateShiftOp(op cminorsel.ShiftOp, amount int, long bool) rtl.Operation {
+	if long {
+		switch op {
+		case cminorsel.Slsr:
+			return rtl.Oshrluimm{N: int32(amount)}
+		case cminorsel.Sasr:
+			return rtl.Oshrlimm{N: int32(amount)}
+		default:
+			return rtl.Oshllimm{N: int32(amount)}
+		}
+	}
 	switch op {
 	case cminorsel.Slsl:
 		return rtl.Oshlimm{N: int32(amount)}
@@ -371,3 +371,55 @@ func TestLetBindingStack(t *testing.T) {
 		t.Errorf("after pop, getLetBinding(0) = %d, want %d", got, r1)
 	}
 }
+
+func TestTranslateExpr_Addshift(t *testing.T) {
+	tests := []struct {
+		name      string
+		long      bool
+		wantAdd   rtl.Operation
+		wantShift rtl.Operation
+	}{
+		{"int", false, rtl.Oadd{}, rtl.Oshlimm{N: 2}},
+		{"long", true, rtl.Oaddl{}, rtl.Oshllimm{N: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewCFGBuilder()
+			regs := NewRegAllocator()
+			tr := NewExprTranslator(cfg, regs)
+
+			dest := regs.Fresh()
+			succ := cfg.AllocNode()
+
+			// a + (i << 2)
+			tr.TranslateExpr(cminorsel.Eaddshift{
+				Op:    cminorsel.Slsl,
+				Shift: 2,
+				Long:  tt.long,
+				Left:  cminorsel.Evar{Name: "a"},
+				Right: cminorsel.Evar{Name: "i"},
+			}, dest, succ)
+
+			var foundAdd, foundShift bool
+			for _, instr := range cfg.GetCode() {
+				iop, ok := instr.(rtl.Iop)
+				if !ok {
+					continue
+				}
+				if iop.Op == tt.wantAdd && iop.Dest == dest {
+					foundAdd = true
+				}
+				if iop.Op == tt.wantShift {
+					foundShift = true
+				}
+			}
+			if !foundAdd {
+				t.Errorf("expected %T into dest", tt.wantAdd)
+			}
+			if !foundShift {
+				t.Errorf("expected %#v", tt.wantShift)
+			}
+		})
+	}
+}
@@ -249,6 +249,19 @@ func (b *InstrBuilder) EmitLoad(chunk rtl.Chunk, addr rtl.AddressingMode, args [
 	})
 }
 
+// EmitVolatileLoad emits a load from a volatile location, which later
+// passes must neither remove nor reorder.
+func (b *InstrBuilder) EmitVolatileLoad(chunk rtl.Chunk, addr rtl.AddressingMode, args []rtl.Reg, dest rtl.Reg, succ rtl.Node) rtl.Node {
+	return b.cfg.EmitInstr(rtl.Iload{
+		Chunk:    chunk,
+		Addr:     addr,
+		Args:     args,
+		Dest:     dest,
+		Succ:     succ,
+		Volatile: true,
+	})
+}
+
 // EmitStore emits a memory store: Mem[addr(args...)] = src, goto succ
 func (b *InstrBuilder) EmitStore(chunk rtl.Chunk, addr rtl.AddressingMode, args []rtl.Reg, src rtl.Reg, succ rtl.Node) rtl.Node {
 	return b.cfg.EmitInstr(rtl.Istore{
@@ -85,11 +85,12 @@ func (t *StmtTranslator) translateStore(s cminorsel.Sstore, succ rtl.Node) rtl.N
 	addr := TranslateAddressingMode(s.Mode)
 	chunk := TranslateChunk(s.Chunk)
 	storeNode := t.cfg.EmitInstr(rtl.Istore{
-		Chunk: chunk,
-		Addr:  addr,
-		Args:  addrRegs,
-		Src:   valueReg,
-		Succ:  succ,
+		Chunk:    chunk,
+		Addr:     addr,
+		Args:     addrRegs,
+		Src:      valueReg,
+		Succ:     succ,
+		Volatile: s.Volatile,
 	})
 	
 	// Translate value expression -> store
@@ -113,10 +114,13 @@ func (t *StmtTranslator) translateCall(s cminorsel.Scall, succ rtl.Node) rtl.Nod
 	}
 	
 	// Destination register (0 for void)
-	var destReg rtl.Reg
+	var destReg, destHi rtl.Reg
 	if s.Result != nil {
 		destReg = t.regs.MapVar(*s.Result)
 	}
+	if s.ResultHi != nil {
+		destHi = t.regs.MapVar(*s.ResultHi)
+	}
 	
 	// Build signature
 	var sig rtl.Sig
@@ -125,6 +129,7 @@ func (t *StmtTranslator) translateCall(s cminorsel.Scall, succ rtl.Node) rtl.Nod
 			Args:   s.Sig.Args,
 			Return: s.Sig.Return,
 			VarArg: s.Sig.VarArg,
+			Sret:   s.Sig.Sret,
 		}
 	}
 	
@@ -133,11 +138,12 @@ func (t *StmtTranslator) translateCall(s cminorsel.Scall, succ rtl.Node) rtl.Nod
 	
 	// Emit call instruction
 	callNode := t.cfg.EmitInstr(rtl.Icall{
-		Sig:  sig,
-		Fn:   rtl.FunReg{Reg: funcReg}, // Will be updated below if symbol
-		Args: argRegs,
-		Dest: destReg,
-		Succ: succ,
+		Sig:    sig,
+		Fn:     rtl.FunReg{Reg: funcReg}, // Will be updated below if symbol
+		Args:   argRegs,
+		Dest:   destReg,
+		DestHi: destHi,
+		Succ:   succ,
 	})
 	
 	// Check if function is a direct call to a symbol
@@ -146,11 +152,12 @@ func (t *StmtTranslator) translateCall(s cminorsel.Scall, succ rtl.Node) rtl.Nod
 			fnRef = rtl.FunSymbol{Name: sym.Symbol}
 			// Re-emit with symbol
 			t.cfg.AddInstr(callNode, rtl.Icall{
-				Sig:  sig,
-				Fn:   fnRef,
-				Args: argRegs,
-				Dest: destReg,
-				Succ: succ,
+				Sig:    sig,
+				Fn:     fnRef,
+				Args:   argRegs,
+				Dest:   destReg,
+				DestHi: destHi,
+				Succ:   succ,
 			})
 			// No need to evaluate function expression
 			return t.translateExprList(s.Args, argRegs, callNode)
@@ -178,6 +185,7 @@ func (t *StmtTranslator) translateTailcall(s cminorsel.Stailcall) rtl.Node {
 			Args:   s.Sig.Args,
 			Return: s.Sig.Return,
 			VarArg: s.Sig.VarArg,
+			Sret:   s.Sig.Sret,
 		}
 	}
 	
@@ -307,13 +315,20 @@ func (t *StmtTranslator) translateSwitch(s cminorsel.Sswitch, succ rtl.Node) rtl
 	// Translate default -> succ
 	defaultEntry := t.TranslateStmt(s.Default, succ)
 	
+	// The case bodies are laid out in order, each falling through into
+	// the next one and the last into default, as in C
+	caseEntries := make([]rtl.Node, len(s.Cases))
+	next := defaultEntry
+	for i := len(s.Cases) - 1; i >= 0; i-- {
+		next = t.TranslateStmt(s.Cases[i].Body, next)
+		caseEntries[i] = next
+	}
+	
 	// Build cascading conditions for cases
 	currentElse := defaultEntry
 	for i := len(s.Cases) - 1; i >= 0; i-- {
 		c := s.Cases[i]
-		
-		// Translate case body -> succ
-		caseEntry := t.TranslateStmt(c.Body, succ)
+		caseEntry := caseEntries[i]
 		
 		// Compare expr == case value
 		// If true, go to case; else continue to next case
@@ -346,6 +361,13 @@ func (t *StmtTranslator) translateReturn(s cminorsel.Sreturn) rtl.Node {
 	
 	// Return with value
 	retReg := t.regs.Fresh()
+	if s.Hi != nil {
+		// A result in two registers: the first word, then the second
+		hiReg := t.regs.Fresh()
+		retNode := t.cfg.EmitInstr(rtl.Ireturn{Arg: &retReg, ArgHi: &hiReg})
+		hiEntry := t.expr.TranslateExpr(s.Hi, hiReg, retNode)
+		return t.expr.TranslateExpr(s.Value, retReg, hiEntry)
+	}
 	retNode := t.cfg.EmitInstr(rtl.Ireturn{Arg: &retReg})
 	return t.expr.TranslateExpr(s.Value, retReg, retNode)
 }
@@ -419,6 +441,7 @@ func TranslateFunction(fn cminorsel.Function) *rtl.Function {
 		Args:   fn.Sig.Args,
 		Return: fn.Sig.Return,
 		VarArg: fn.Sig.VarArg,
+		Sret:   fn.Sig.Sret,
 	}
 	
 	return &rtl.Function{
@@ -428,6 +451,7 @@ func TranslateFunction(fn cminorsel.Function) *rtl.Function {
 		Stacksize:  fn.Stackspace,
 		Code:       cfg.GetCode(),
 		Entrypoint: entryNode,
+		Static:     fn.Static,
 	}
 }
 
@@ -445,6 +469,7 @@ func TranslateProgram(prog cminorsel.Program) *rtl.Program {
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		}
 	}
 	
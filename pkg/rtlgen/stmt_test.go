@@ -363,6 +363,43 @@ func TestTranslateStmt_Switch(t *testing.T) {
 	_ = entry
 }
 
+func TestTranslateStmt_SwitchFallthrough(t *testing.T) {
+	cfg := NewCFGBuilder()
+	regs := NewRegAllocator()
+	trans := NewStmtTranslator(cfg, regs)
+	
+	succ := cfg.AllocNode()
+	
+	// switch(x) { case 1: A: ; case 2: B: ; default: D: ; }
+	trans.TranslateStmt(cminorsel.Sswitch{
+		IsLong: false,
+		Expr:   cminorsel.Evar{Name: "x"},
+		Cases: []cminorsel.SwitchCase{
+			{Value: 1, Body: cminorsel.Slabel{Label: "A", Body: cminorsel.Sskip{}}},
+			{Value: 2, Body: cminorsel.Slabel{Label: "B", Body: cminorsel.Sskip{}}},
+		},
+		Default: cminorsel.Slabel{Label: "D", Body: cminorsel.Sskip{}},
+	}, succ)
+	
+	// Each case falls through into the next, the last into default
+	code := cfg.GetCode()
+	next := func(label string) rtl.Node {
+		node, _ := cfg.GetLabel(label)
+		return code[node].(rtl.Inop).Succ
+	}
+	b, _ := cfg.GetLabel("B")
+	d, _ := cfg.GetLabel("D")
+	if next("A") != b {
+		t.Errorf("case 1 continues at %d, want case 2 at %d", next("A"), b)
+	}
+	if next("B") != d {
+		t.Errorf("case 2 continues at %d, want default at %d", next("B"), d)
+	}
+	if next("D") != succ {
+		t.Errorf("default continues at %d, want %d", next("D"), succ)
+	}
+}
+
 func TestTranslateStmt_Label(t *testing.T) {
 	cfg := NewCFGBuilder()
 	regs := NewRegAllocator()
@@ -0,0 +1,259 @@
+// Package scheduling implements a list scheduler for Linear code.
+// Straight-line runs of operations, loads, stores and stack accesses are
+// reordered to start long-latency instructions (loads, multiplies,
+// divisions) early. Labels, branches, calls and builtins are never crossed.
+// Registers are already allocated, so every register or stack slot that is
+// read or written gives a true, anti or output dependence; memory accesses
+// are kept in order around stores, and volatile accesses are kept in order
+// around every memory access.
+package scheduling
+
+import (
+	"github.com/raymyers/ralph-cc/pkg/linear"
+	"github.com/raymyers/ralph-cc/pkg/ltl"
+	"github.com/raymyers/ralph-cc/pkg/optreport"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// maxPending bounds how many results may be computed ahead of their first
+// use. Beyond it, the scheduler prefers instructions that consume pending
+// results over hoisting more, so live ranges are not stretched without limit.
+const maxPending = 4
+
+// TransformProgram schedules every function of a Linear program, counting
+// the instructions moved in report.
+func TransformProgram(prog *linear.Program, report *optreport.Report) *linear.Program {
+	for i := range prog.Functions {
+		fn := &prog.Functions[i]
+		report.Add(fn.Name, optreport.Rescheduled, TransformFunction(fn))
+	}
+	return prog
+}
+
+// TransformFunction schedules each straight-line run of fn's code, in
+// place. It returns the number of instructions that changed position.
+func TransformFunction(fn *linear.Function) int {
+	start, moved := 0, 0
+	for i, instr := range fn.Code {
+		if schedulable(instr) {
+			continue
+		}
+		moved += scheduleBlock(fn.Code[start:i])
+		start = i + 1
+	}
+	return moved + scheduleBlock(fn.Code[start:])
+}
+
+// schedulable reports whether an instruction may be moved within its block.
+func schedulable(instr linear.Instruction) bool {
+	switch instr.(type) {
+	case linear.Lop, linear.Lload, linear.Lstore, linear.Lgetstack, linear.Lsetstack:
+		return true
+	}
+	return false
+}
+
+// locKey identifies a register or a stack slot independently of its type.
+type locKey struct {
+	stack bool
+	reg   ltl.MReg
+	slot  ltl.SlotKind
+	ofs   int64
+}
+
+func regKey(r ltl.MReg) locKey { return locKey{reg: r} }
+
+func slotKey(slot ltl.SlotKind, ofs int64) locKey {
+	return locKey{stack: true, slot: slot, ofs: ofs}
+}
+
+func keyOf(l linear.Loc) locKey {
+	if s, ok := l.(ltl.S); ok {
+		return slotKey(s.Slot, s.Ofs)
+	}
+	return regKey(l.(ltl.R).Reg)
+}
+
+// effects summarises what an instruction reads and writes.
+type effects struct {
+	uses, defs []locKey
+	memRead    bool
+	memWrite   bool
+	latency    int
+}
+
+func keysOf(locs []linear.Loc) []locKey {
+	keys := make([]locKey, len(locs))
+	for i, l := range locs {
+		keys[i] = keyOf(l)
+	}
+	return keys
+}
+
+// effectsOf returns the effects of a schedulable instruction. Stack slot
+// accesses also count as memory accesses, since slots and stack-allocated
+// data live in the same frame. A volatile access both reads and writes
+// memory, so no other memory access moves across it. The scratch registers
+// of the assembly, X16 and X17, are never allocated and carry no
+// dependences, see mach.ScratchReg.
+func effectsOf(instr linear.Instruction) effects {
+	switch i := instr.(type) {
+	case linear.Lop:
+		return effects{uses: keysOf(i.Args), defs: []locKey{keyOf(i.Dest)}, latency: opLatency(i.Op)}
+	case linear.Lload:
+		return effects{uses: keysOf(i.Args), defs: []locKey{keyOf(i.Dest)}, memRead: true, memWrite: i.Volatile, latency: 4}
+	case linear.Lstore:
+		return effects{uses: append(keysOf(i.Args), keyOf(i.Src)), memRead: i.Volatile, memWrite: true, latency: 1}
+	case linear.Lgetstack:
+		return effects{uses: []locKey{slotKey(i.Slot, i.Ofs)}, defs: []locKey{regKey(i.Dest)}, memRead: true, latency: 4}
+	case linear.Lsetstack:
+		return effects{uses: []locKey{regKey(i.Src)}, defs: []locKey{slotKey(i.Slot, i.Ofs)}, memWrite: true, latency: 1}
+	}
+	return effects{latency: 1}
+}
+
+// opLatency estimates the number of cycles before an operation's result
+// is available.
+func opLatency(op linear.Operation) int {
+	switch op.(type) {
+	case rtl.Omul, rtl.Omulimm, rtl.Omull, rtl.Omulhs, rtl.Omulhu, rtl.Omullhs, rtl.Omullhu:
+		return 3
+	case rtl.Odiv, rtl.Odivu, rtl.Omod, rtl.Omodu,
+		rtl.Odivl, rtl.Odivlu, rtl.Omodl, rtl.Omodlu:
+		return 8
+	}
+	return 1
+}
+
+func intersects(a, b []locKey) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// node is an instruction in the dependence graph of a block.
+type node struct {
+	instr    linear.Instruction
+	eff      effects
+	succs    []int // dependent instructions
+	npreds   int   // unscheduled instructions this one depends on
+	rawPreds []int // instructions whose results this one reads
+	users    int   // unscheduled instructions reading this one's results
+	height   int   // latency-weighted longest path to the end of the block
+}
+
+// scheduleBlock reorders a straight-line block in place and returns the
+// number of instructions that changed position.
+func scheduleBlock(block []linear.Instruction) int {
+	if len(block) < 2 {
+		return 0
+	}
+	nodes := buildGraph(block)
+
+	// Edges always point forwards, so heights are computed backwards
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := &nodes[i]
+		n.height = n.eff.latency
+		for _, s := range n.succs {
+			if h := n.eff.latency + nodes[s].height; h > n.height {
+				n.height = h
+			}
+		}
+	}
+
+	// pending counts scheduled results that still have unscheduled users
+	pending := 0
+	scheduled := make([]bool, len(nodes))
+	order := make([]linear.Instruction, 0, len(block))
+	moved := 0
+	for len(order) < len(nodes) {
+		best := -1
+		for i := range nodes {
+			if scheduled[i] || nodes[i].npreds > 0 {
+				continue
+			}
+			if best < 0 || better(nodes, i, best, pending) {
+				best = i
+			}
+		}
+		scheduled[best] = true
+		if best != len(order) {
+			moved++
+		}
+		order = append(order, nodes[best].instr)
+
+		for _, p := range nodes[best].rawPreds {
+			nodes[p].users--
+			if nodes[p].users == 0 {
+				pending--
+			}
+		}
+		if nodes[best].users > 0 {
+			pending++
+		}
+		for _, s := range nodes[best].succs {
+			nodes[s].npreds--
+		}
+	}
+	copy(block, order)
+	return moved
+}
+
+// buildGraph returns the dependence graph of a block, one node per
+// instruction in the original order.
+func buildGraph(block []linear.Instruction) []node {
+	nodes := make([]node, len(block))
+	for i, instr := range block {
+		nodes[i] = node{instr: instr, eff: effectsOf(instr)}
+	}
+	for j := range nodes {
+		for i := j + 1; i < len(nodes); i++ {
+			a, b := nodes[j].eff, nodes[i].eff
+			raw := intersects(a.defs, b.uses)
+			dep := raw ||
+				intersects(a.uses, b.defs) ||
+				intersects(a.defs, b.defs) ||
+				(a.memWrite && (b.memRead || b.memWrite)) ||
+				(a.memRead && b.memWrite)
+			if !dep {
+				continue
+			}
+			nodes[j].succs = append(nodes[j].succs, i)
+			nodes[i].npreds++
+			if raw {
+				nodes[i].rawPreds = append(nodes[i].rawPreds, j)
+				nodes[j].users++
+			}
+		}
+	}
+	return nodes
+}
+
+// better reports whether ready node a should be scheduled before ready
+// node b. Once maxPending results are waiting for their users, nodes that
+// consume one win; otherwise the longer critical path wins. Ties keep the
+// original order.
+func better(nodes []node, a, b, pending int) bool {
+	if pending >= maxPending {
+		ca, cb := consumesPending(nodes[a]), consumesPending(nodes[b])
+		if ca != cb {
+			return ca
+		}
+	}
+	if nodes[a].height != nodes[b].height {
+		return nodes[a].height > nodes[b].height
+	}
+	return a < b
+}
+
+// consumesPending reports whether a ready node reads a scheduled result.
+// Every predecessor of a ready node is scheduled, so any true dependence
+// counts.
+func consumesPending(n node) bool {
+	return len(n.rawPreds) > 0
+}
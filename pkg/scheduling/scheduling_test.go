@@ -0,0 +1,143 @@
+package scheduling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/linear"
+	"github.com/raymyers/ralph-cc/pkg/ltl"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+func r(m ltl.MReg) linear.Loc { return ltl.R{Reg: m} }
+
+// add returns dest = a + b.
+func add(dest, a, b ltl.MReg) linear.Lop {
+	return linear.Lop{Op: rtl.Oadd{}, Args: []linear.Loc{r(a), r(b)}, Dest: r(dest)}
+}
+
+// load returns dest = int32[base].
+func load(dest, base ltl.MReg) linear.Lload {
+	return linear.Lload{Chunk: linear.Mint32, Addr: rtl.Aindexed{Offset: 0}, Args: []linear.Loc{r(base)}, Dest: r(dest)}
+}
+
+// store returns int32[base] = src.
+func store(base, src ltl.MReg) linear.Lstore {
+	return linear.Lstore{Chunk: linear.Mint32, Addr: rtl.Aindexed{Offset: 0}, Args: []linear.Loc{r(base)}, Src: r(src)}
+}
+
+func schedule(code ...linear.Instruction) []linear.Instruction {
+	fn := linear.Function{Name: "f", Code: code}
+	TransformFunction(&fn)
+	return fn.Code
+}
+
+func TestLoadHoistedAboveIndependentOp(t *testing.T) {
+	// x1 = x2 + x3; x4 = [x5]; x0 = x1 + x4
+	code := schedule(add(ltl.X1, ltl.X2, ltl.X3), load(ltl.X4, ltl.X5), add(ltl.X0, ltl.X1, ltl.X4))
+
+	if _, ok := code[0].(linear.Lload); !ok {
+		t.Fatalf("expected the load first, got %T", code[0])
+	}
+	if op, ok := code[1].(linear.Lop); !ok || op.Dest != r(ltl.X1) {
+		t.Errorf("expected x1 = x2 + x3 second, got %#v", code[1])
+	}
+	if op, ok := code[2].(linear.Lop); !ok || op.Dest != r(ltl.X0) {
+		t.Errorf("expected the use of both results last, got %#v", code[2])
+	}
+}
+
+func TestTransformFunctionCountsMoves(t *testing.T) {
+	// The load and the op before it trade places; the last add stays
+	fn := linear.Function{Name: "f", Code: []linear.Instruction{add(ltl.X1, ltl.X2, ltl.X3), load(ltl.X4, ltl.X5), add(ltl.X0, ltl.X1, ltl.X4)}}
+	if n := TransformFunction(&fn); n != 2 {
+		t.Errorf("expected 2 instructions moved, got %d", n)
+	}
+	if n := TransformFunction(&fn); n != 0 {
+		t.Errorf("expected a scheduled block to stay as it is, got %d moves", n)
+	}
+}
+
+func TestDependencesPreserved(t *testing.T) {
+	tests := []struct {
+		name string
+		code []linear.Instruction
+	}{
+		{
+			// The load reads the address the op computes
+			name: "true dependence",
+			code: []linear.Instruction{add(ltl.X5, ltl.X2, ltl.X3), load(ltl.X4, ltl.X5)},
+		},
+		{
+			// The load overwrites a register the op still reads
+			name: "anti dependence",
+			code: []linear.Instruction{add(ltl.X1, ltl.X4, ltl.X3), load(ltl.X4, ltl.X5)},
+		},
+		{
+			// The load may read what the store wrote
+			name: "memory dependence",
+			code: []linear.Instruction{store(ltl.X6, ltl.X7), load(ltl.X4, ltl.X5)},
+		},
+		{
+			// Volatile loads are never reordered with other loads
+			name: "volatile load",
+			code: []linear.Instruction{
+				load(ltl.X1, ltl.X5),
+				linear.Lload{Chunk: linear.Mint32, Addr: rtl.Aindexed{Offset: 0}, Args: []linear.Loc{r(ltl.X6)}, Dest: r(ltl.X2), Volatile: true},
+				add(ltl.X3, ltl.X2, ltl.X2),
+				add(ltl.X3, ltl.X3, ltl.X3),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := append([]linear.Instruction(nil), tt.code...)
+			got := schedule(tt.code...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected order kept, got %#v", got)
+			}
+		})
+	}
+}
+
+func TestLoadsPassEachOther(t *testing.T) {
+	// Loads may be reordered among themselves; the one feeding the longer
+	// chain goes first.
+	code := schedule(
+		load(ltl.X1, ltl.X5),
+		load(ltl.X2, ltl.X6),
+		add(ltl.X3, ltl.X2, ltl.X2),
+		add(ltl.X3, ltl.X3, ltl.X3),
+	)
+	if l, ok := code[0].(linear.Lload); !ok || l.Dest != r(ltl.X2) {
+		t.Errorf("expected x2 = [x6] first, got %#v", code[0])
+	}
+}
+
+func TestNotMovedAcrossBarriers(t *testing.T) {
+	code := schedule(
+		add(ltl.X1, ltl.X2, ltl.X3),
+		linear.Llabel{Lbl: 1},
+		load(ltl.X4, ltl.X5),
+		add(ltl.X6, ltl.X2, ltl.X3),
+		linear.Lcall{Fn: linear.FunSymbol{Name: "g"}},
+		load(ltl.X7, ltl.X5),
+	)
+
+	if _, ok := code[0].(linear.Lop); !ok {
+		t.Errorf("op before the label should stay first, got %T", code[0])
+	}
+	if _, ok := code[1].(linear.Llabel); !ok {
+		t.Errorf("expected label at 1, got %T", code[1])
+	}
+	if _, ok := code[2].(linear.Lload); !ok {
+		t.Errorf("expected load at 2, got %T", code[2])
+	}
+	if _, ok := code[4].(linear.Lcall); !ok {
+		t.Errorf("expected call at 4, got %T", code[4])
+	}
+	if _, ok := code[5].(linear.Lload); !ok {
+		t.Errorf("load after the call should stay after it, got %T", code[5])
+	}
+}
@@ -202,25 +202,14 @@ func tryAindexed2shift(addr cminor.Expr) (AddressResult, bool) {
 	return AddressResult{}, false
 }
 
-// extractShiftAdd checks if 'shifted' is (index << const) and returns (shift, base, index)
+// extractShiftAdd checks if 'shifted' is (index << const), or index scaled
+// by a power of two, and returns (shift, base, index)
 func extractShiftAdd(base, shifted cminor.Expr) (int, cminor.Expr, cminor.Expr, bool) {
-	shiftOp, ok := shifted.(cminor.Ebinop)
-	if !ok {
-		return 0, nil, nil, false
-	}
-
-	// Check for shift left operations
-	if shiftOp.Op != cminor.Oshl && shiftOp.Op != cminor.Oshll {
+	shiftOp, index, amount, ok := extractShift(shifted)
+	if !ok || (shiftOp != cminor.Oshl && shiftOp != cminor.Oshll) {
 		return 0, nil, nil, false
 	}
-
-	// Get the shift amount (must be constant)
-	shiftAmt := extractConstantInt(shiftOp.Right)
-	if shiftAmt == nil {
-		return 0, nil, nil, false
-	}
-
-	return int(*shiftAmt), base, shiftOp.Left, true
+	return amount, base, index, true
 }
 
 // tryAindexed2 tries to match: base + index
@@ -344,9 +333,10 @@ func translateExpr(e cminor.Expr) cminorsel.Expr {
 	case cminor.Eload:
 		// For nested loads, use simple Aindexed{0} addressing
 		return cminorsel.Eload{
-			Chunk: cminorsel.Chunk(expr.Chunk),
-			Mode:  cminorsel.Aindexed{Offset: 0},
-			Args:  []cminorsel.Expr{translateExpr(expr.Addr)},
+			Chunk:    cminorsel.Chunk(expr.Chunk),
+			Mode:     cminorsel.Aindexed{Offset: 0},
+			Args:     []cminorsel.Expr{translateExpr(expr.Addr)},
+			Volatile: expr.Volatile,
 		}
 	}
 	// Unknown expression type - return as-is wrapped in a var for safety
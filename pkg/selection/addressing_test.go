@@ -307,6 +307,90 @@ func TestSelectAddressing_Aindexed2shift_InvalidShift(t *testing.T) {
 	}
 }
 
+// Helper to create long multiply expression
+func mull(left, right cminor.Expr) cminor.Expr {
+	return cminor.Ebinop{Op: cminor.Omull, Left: left, Right: right}
+}
+
+// Helper to widen an int index the way array subscripts do
+func longofint(e cminor.Expr) cminor.Expr {
+	return cminor.Eunop{Op: cminor.Olongofint, Arg: e}
+}
+
+func TestSelectAddressing_ScaledIndex(t *testing.T) {
+	// a[i] reaches selection as a + i * sizeof(elem); power-of-two
+	// element sizes become a shifted index.
+	tests := []struct {
+		name      string
+		addr      cminor.Expr
+		wantShift int
+	}{
+		{
+			name:      "int a[i]",
+			addr:      addl(evar("a"), mull(longofint(evar("i")), longConst(4))),
+			wantShift: 2,
+		},
+		{
+			name:      "long a[i]",
+			addr:      addl(evar("a"), mull(evar("i"), longConst(8))),
+			wantShift: 3,
+		},
+		{
+			name:      "short a[i]",
+			addr:      addl(evar("a"), mull(evar("i"), longConst(2))),
+			wantShift: 1,
+		},
+		{
+			name:      "constant on the left",
+			addr:      addl(evar("a"), mull(longConst(4), evar("i"))),
+			wantShift: 2,
+		},
+		{
+			name:      "scaled index on the left",
+			addr:      addl(mull(evar("i"), longConst(8)), evar("a")),
+			wantShift: 3,
+		},
+		{
+			name:      "32-bit multiply",
+			addr:      add(evar("a"), cminor.Ebinop{Op: cminor.Omul, Left: evar("i"), Right: intConst(4)}),
+			wantShift: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SelectAddressing(tt.addr, nil, nil)
+
+			mode, ok := result.Mode.(cminorsel.Aindexed2shift)
+			if !ok {
+				t.Fatalf("expected Aindexed2shift, got %T", result.Mode)
+			}
+			if mode.Shift != tt.wantShift {
+				t.Errorf("expected shift %d, got %d", tt.wantShift, mode.Shift)
+			}
+			if len(result.Args) != 2 {
+				t.Fatalf("expected 2 args, got %d", len(result.Args))
+			}
+			if v, ok := result.Args[0].(cminorsel.Evar); !ok || v.Name != "a" {
+				t.Errorf("expected base a, got %v", result.Args[0])
+			}
+		})
+	}
+}
+
+func TestSelectAddressing_ScaledIndex_NotPowerOfTwo(t *testing.T) {
+	// 12-byte elements cannot be expressed as a shift
+	addr := addl(evar("a"), mull(evar("i"), longConst(12)))
+	result := SelectAddressing(addr, nil, nil)
+
+	if _, ok := result.Mode.(cminorsel.Aindexed2shift); ok {
+		t.Fatalf("non power-of-two scale should not use Aindexed2shift")
+	}
+	if _, ok := result.Mode.(cminorsel.Aindexed2); !ok {
+		t.Errorf("expected Aindexed2, got %T", result.Mode)
+	}
+}
+
 func TestSelectAddressing_Priority(t *testing.T) {
 	// Test that more specific modes are preferred
 	globals := map[string]bool{"g": true}
@@ -0,0 +1,166 @@
+// Package selection - Division by a constant.
+// ARM64 division takes many cycles, so under --O2 an int division by a
+// constant becomes a multiplication by a "magic number" keeping the high
+// word of the product, followed by shifts and corrections, following
+// CompCert's SelectDiv and Hacker's Delight chapter 10.
+package selection
+
+import (
+	"github.com/raymyers/ralph-cc/pkg/cminor"
+	"github.com/raymyers/ralph-cc/pkg/cminorsel"
+)
+
+// divsMagic computes the magic number m and shift s such that, for every
+// int n, n / d == mulhs(n, m) (+ n if d > 0 and m < 0, - n if d < 0 and
+// m > 0) >> s, plus one when that is negative. d must not be -1, 0 or 1.
+func divsMagic(d int32) (m int32, s int) {
+	const two31 = uint32(1) << 31
+	ad := uint32(d)
+	if d < 0 {
+		ad = -ad
+	}
+	t := two31 + uint32(d)>>31
+	anc := t - 1 - t%ad // absolute value of nc
+	p := 31
+	q1, r1 := two31/anc, two31-two31/anc*anc
+	q2, r2 := two31/ad, two31-two31/ad*ad
+	for {
+		p++
+		q1, r1 = 2*q1, 2*r1
+		if r1 >= anc {
+			q1, r1 = q1+1, r1-anc
+		}
+		q2, r2 = 2*q2, 2*r2
+		if r2 >= ad {
+			q2, r2 = q2+1, r2-ad
+		}
+		delta := ad - r2
+		if q1 >= delta && (q1 != delta || r1 != 0) {
+			break
+		}
+	}
+	m = int32(q2 + 1)
+	if d < 0 {
+		m = -m
+	}
+	return m, p - 32
+}
+
+// divuMagic computes the magic number m and shift s such that, for every
+// unsigned n, n / d == mulhu(n, m) >> s. When add is set the magic number
+// needs 33 bits and the quotient is instead
+// (((n - t) >> 1) + t) >> (s - 1) with t = mulhu(n, m). d must not be 0.
+func divuMagic(d uint32) (m uint32, add bool, s int) {
+	const two31 = uint32(1) << 31
+	nc := ^uint32(0) - (-d)%d
+	p := 31
+	q1, r1 := two31/nc, two31-two31/nc*nc
+	q2, r2 := (two31-1)/d, (two31-1)-(two31-1)/d*d
+	for {
+		p++
+		if r1 >= nc-r1 {
+			q1, r1 = 2*q1+1, 2*r1-nc
+		} else {
+			q1, r1 = 2*q1, 2*r1
+		}
+		if r2+1 >= d-r2 {
+			if q2 >= two31-1 {
+				add = true
+			}
+			q2, r2 = 2*q2+1, 2*r2+1-d
+		} else {
+			if q2 >= two31 {
+				add = true
+			}
+			q2, r2 = 2*q2, 2*r2+1
+		}
+		delta := d - 1 - r2
+		if p >= 64 || q1 >= delta && (q1 != delta || r1 != 0) {
+			break
+		}
+	}
+	return q2 + 1, add, p - 32
+}
+
+// selectDivByConst rewrites an int division by a constant into a
+// multiplication by its magic number. It reports false when the operation
+// is not such a division or the divisor is trivial.
+func (ctx *SelectionContext) selectDivByConst(b cminor.Ebinop) (cminorsel.Expr, bool) {
+	if b.Op != cminor.Odiv && b.Op != cminor.Odivu {
+		return nil, false
+	}
+	d, ok := intConstValue(b.Right)
+	if !ok {
+		return nil, false
+	}
+
+	// The dividend is used several times, so it is let-bound once
+	n := cminorsel.Eletvar{Index: 0}
+	var body cminorsel.Expr
+	if b.Op == cminor.Odiv {
+		if d == -1 || d == 0 || d == 1 {
+			return nil, false
+		}
+		m, s := divsMagic(d)
+		q := cminorsel.Expr(cminorsel.Emulhi{Left: n, Right: intConstExpr(m)})
+		if d > 0 && m < 0 {
+			q = cminorsel.Ebinop{Op: cminorsel.Oadd, Left: q, Right: n}
+		} else if d < 0 && m > 0 {
+			q = cminorsel.Ebinop{Op: cminorsel.Osub, Left: q, Right: n}
+		}
+		if s > 0 {
+			q = cminorsel.Eshiftimm{Op: cminorsel.Sasr, Shift: s, Arg: q}
+		}
+		// Round towards zero by adding one to negative quotients. q is
+		// let-bound as well so its sign bit can be extracted.
+		body = cminorsel.Elet{
+			Bind: q,
+			Body: cminorsel.Ebinop{
+				Op:    cminorsel.Oadd,
+				Left:  cminorsel.Eletvar{Index: 0},
+				Right: cminorsel.Eshiftimm{Op: cminorsel.Slsr, Shift: 31, Arg: cminorsel.Eletvar{Index: 0}},
+			},
+		}
+	} else {
+		if d == 0 || d == 1 {
+			return nil, false
+		}
+		m, add, s := divuMagic(uint32(d))
+		t := cminorsel.Emulhi{Unsigned: true, Left: n, Right: intConstExpr(int32(m))}
+		if !add {
+			body = cminorsel.Eshiftimm{Op: cminorsel.Slsr, Shift: s, Arg: t}
+		} else {
+			body = cminorsel.Elet{
+				Bind: t,
+				Body: cminorsel.Eshiftimm{Op: cminorsel.Slsr, Shift: s - 1, Arg: cminorsel.Ebinop{
+					Op: cminorsel.Oadd,
+					Left: cminorsel.Eshiftimm{Op: cminorsel.Slsr, Shift: 1, Arg: cminorsel.Ebinop{
+						Op:    cminorsel.Osub,
+						Left:  cminorsel.Eletvar{Index: 1},
+						Right: cminorsel.Eletvar{Index: 0},
+					}},
+					Right: cminorsel.Eletvar{Index: 0},
+				}},
+			}
+		}
+	}
+	return cminorsel.Elet{Bind: ctx.SelectExpr(b.Left), Body: body}, true
+}
+
+// intConstValue returns the value of an int constant, which may be negated
+func intConstValue(e cminor.Expr) (int32, bool) {
+	if u, ok := e.(cminor.Eunop); ok && u.Op == cminor.Onegint {
+		v, ok := intConstValue(u.Arg)
+		return -v, ok
+	}
+	if c, ok := e.(cminor.Econst); ok {
+		if ic, ok := c.Const.(cminor.Ointconst); ok {
+			return ic.Value, true
+		}
+	}
+	return 0, false
+}
+
+func intConstExpr(v int32) cminorsel.Expr {
+	return cminorsel.Econst{Const: cminorsel.Ointconst{Value: v}}
+}
@@ -0,0 +1,130 @@
+package selection
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/cminor"
+	"github.com/raymyers/ralph-cc/pkg/cminorsel"
+)
+
+// evalInt evaluates the int expressions selectDivByConst produces
+func evalInt(t *testing.T, e cminorsel.Expr, vars map[string]int32, lets []int32) int32 {
+	switch e := e.(type) {
+	case cminorsel.Evar:
+		return vars[e.Name]
+	case cminorsel.Econst:
+		return e.Const.(cminorsel.Ointconst).Value
+	case cminorsel.Elet:
+		v := evalInt(t, e.Bind, vars, lets)
+		return evalInt(t, e.Body, vars, append(lets, v))
+	case cminorsel.Eletvar:
+		return lets[len(lets)-1-e.Index]
+	case cminorsel.Emulhi:
+		l, r := evalInt(t, e.Left, vars, lets), evalInt(t, e.Right, vars, lets)
+		if e.Unsigned {
+			return int32((uint64(uint32(l)) * uint64(uint32(r))) >> 32)
+		}
+		return int32((int64(l) * int64(r)) >> 32)
+	case cminorsel.Eshiftimm:
+		a := evalInt(t, e.Arg, vars, lets)
+		switch e.Op {
+		case cminorsel.Sasr:
+			return a >> e.Shift
+		case cminorsel.Slsr:
+			return int32(uint32(a) >> e.Shift)
+		}
+		return a << e.Shift
+	case cminorsel.Ebinop:
+		l, r := evalInt(t, e.Left, vars, lets), evalInt(t, e.Right, vars, lets)
+		switch e.Op {
+		case cminorsel.Oadd:
+			return l + r
+		case cminorsel.Osub:
+			return l - r
+		}
+	}
+	t.Fatalf("unexpected expression %#v", e)
+	return 0
+}
+
+func divDividends() []int32 {
+	ns := []int32{0, 1, -1, 2, -2, 3, -3, 6, -6, 7, -7, 100, -100, math.MaxInt32, math.MinInt32, math.MaxInt32 - 1, math.MinInt32 + 1}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		ns = append(ns, int32(rng.Uint32()))
+	}
+	return ns
+}
+
+func TestSelectDivByConstSigned(t *testing.T) {
+	ctx := NewSelectionContext(nil, nil)
+	ns := divDividends()
+	for _, d := range []int32{2, 3, 5, 6, 7, 10, 16, 25, 100, 641, 1 << 30, math.MaxInt32, math.MinInt32, -2, -3, -5, -7, -16, -100} {
+		div := cminor.Ebinop{Op: cminor.Odiv, Left: cminor.Evar{Name: "n"}, Right: cminor.Econst{Const: cminor.Ointconst{Value: d}}}
+		e, ok := ctx.selectDivByConst(div)
+		if !ok {
+			t.Fatalf("division by %d not rewritten", d)
+		}
+		for _, n := range ns {
+			if n == math.MinInt32 && d == -1 {
+				continue
+			}
+			if got, want := evalInt(t, e, map[string]int32{"n": n}, nil), n/d; got != want {
+				t.Fatalf("%d / %d: got %d, want %d", n, d, got, want)
+			}
+		}
+	}
+}
+
+func TestSelectDivByConstUnsigned(t *testing.T) {
+	ctx := NewSelectionContext(nil, nil)
+	ns := divDividends()
+	for _, d := range []uint32{2, 3, 5, 7, 10, 16, 19, 100, 641, 1 << 31, math.MaxUint32, 0x80000001} {
+		div := cminor.Ebinop{Op: cminor.Odivu, Left: cminor.Evar{Name: "n"}, Right: cminor.Econst{Const: cminor.Ointconst{Value: int32(d)}}}
+		e, ok := ctx.selectDivByConst(div)
+		if !ok {
+			t.Fatalf("division by %d not rewritten", d)
+		}
+		for _, n := range ns {
+			if got, want := uint32(evalInt(t, e, map[string]int32{"n": n}, nil)), uint32(n)/d; got != want {
+				t.Fatalf("%d / %d: got %d, want %d", uint32(n), d, got, want)
+			}
+		}
+	}
+}
+
+func TestSelectDivByConstMagic(t *testing.T) {
+	// Values from Hacker's Delight, table 10-1
+	if m, s := divsMagic(7); uint32(m) != 0x92492493 || s != 2 {
+		t.Errorf("divsMagic(7) = %#x, %d", uint32(m), s)
+	}
+	if m, s := divsMagic(3); m != 0x55555556 || s != 0 {
+		t.Errorf("divsMagic(3) = %#x, %d", m, s)
+	}
+	if m, add, s := divuMagic(7); m != 0x24924925 || !add || s != 3 {
+		t.Errorf("divuMagic(7) = %#x, %v, %d", m, add, s)
+	}
+	if m, add, s := divuMagic(5); m != 0xCCCCCCCD || add || s != 2 {
+		t.Errorf("divuMagic(5) = %#x, %v, %d", m, add, s)
+	}
+}
+
+func TestSelectDivByConstOnlyUnderOptimize(t *testing.T) {
+	div := cminor.Ebinop{Op: cminor.Odiv, Left: cminor.Evar{Name: "n"}, Right: cminor.Econst{Const: cminor.Ointconst{Value: 3}}}
+
+	ctx := NewSelectionContext(nil, nil)
+	if _, ok := ctx.SelectExpr(div).(cminorsel.Ebinop); !ok {
+		t.Error("expected a plain division without Optimize")
+	}
+	ctx.Optimize = true
+	if _, ok := ctx.SelectExpr(div).(cminorsel.Elet); !ok {
+		t.Error("expected the division to be rewritten under Optimize")
+	}
+
+	byVar := cminor.Ebinop{Op: cminor.Odiv, Left: cminor.Evar{Name: "n"}, Right: cminor.Evar{Name: "d"}}
+	if _, ok := ctx.SelectExpr(byVar).(cminorsel.Ebinop); !ok {
+		t.Error("expected a division by a variable to stay a division")
+	}
+}
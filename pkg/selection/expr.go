@@ -6,6 +6,7 @@ package selection
 import (
 	"github.com/raymyers/ralph-cc/pkg/cminor"
 	"github.com/raymyers/ralph-cc/pkg/cminorsel"
+	"github.com/raymyers/ralph-cc/pkg/optreport"
 )
 
 // SelectionContext holds context needed during expression selection.
@@ -14,6 +15,12 @@ type SelectionContext struct {
 	Globals map[string]bool
 	// StackVars maps stack variable names to their stack offsets
 	StackVars map[string]int64
+	// Optimize enables the --O2 rewrites, such as division by a constant
+	Optimize bool
+	// Report counts the rewrites for --opt-report; nil when not asked for
+	Report *optreport.Report
+	// function is the name of the function being selected
+	function string
 }
 
 // NewSelectionContext creates a new selection context.
@@ -94,6 +101,11 @@ func (ctx *SelectionContext) selectConst(c cminor.Econst) cminorsel.Expr {
 
 // selectUnop handles unary operations.
 func (ctx *SelectionContext) selectUnop(u cminor.Eunop) cminorsel.Expr {
+	if ctx.Optimize {
+		if folded, ok := ctx.fold(u); ok {
+			return folded
+		}
+	}
 	arg := ctx.SelectExpr(u.Arg)
 
 	// Handle logical NOT specially: !x becomes (x == 0)
@@ -115,6 +127,19 @@ func (ctx *SelectionContext) selectUnop(u cminor.Eunop) cminorsel.Expr {
 
 // selectBinop handles binary operations, including combined operation recognition.
 func (ctx *SelectionContext) selectBinop(b cminor.Ebinop) cminorsel.Expr {
+	if ctx.Optimize {
+		if folded, ok := ctx.fold(b); ok {
+			return folded
+		}
+		// Constant operands are folded first, so that the patterns below
+		// see x + 8 rather than x + 4 * 2
+		b.Left, b.Right = ctx.foldOperand(b.Left), ctx.foldOperand(b.Right)
+		if div, ok := ctx.selectDivByConst(b); ok {
+			ctx.Report.Add(ctx.function, optreport.DivByConst, 1)
+			return div
+		}
+	}
+
 	// Try to recognize combined shift+arithmetic patterns (ARM64)
 	combined := TrySelectCombinedOp(b.Op, b.Left, b.Right)
 	if combined.IsCombined {
@@ -131,6 +156,28 @@ func (ctx *SelectionContext) selectBinop(b cminor.Ebinop) cminorsel.Expr {
 	}
 }
 
+// fold replaces an int operation on constants by its value, counting the
+// operations evaluated in the report.
+func (ctx *SelectionContext) fold(e cminor.Expr) (cminorsel.Expr, bool) {
+	v, n, ok := foldInt(e)
+	if !ok {
+		return nil, false
+	}
+	ctx.Report.Add(ctx.function, optreport.Folded, n)
+	return intConstExpr(v), true
+}
+
+// foldOperand replaces an operand that folds by the Cminor constant, which
+// is counted in the report like any other fold.
+func (ctx *SelectionContext) foldOperand(e cminor.Expr) cminor.Expr {
+	v, n, ok := foldInt(e)
+	if !ok || n == 0 {
+		return e
+	}
+	ctx.Report.Add(ctx.function, optreport.Folded, n)
+	return cminor.Econst{Const: cminor.Ointconst{Value: v}}
+}
+
 // buildCombinedOp builds a CminorSel expression for a combined operation.
 func (ctx *SelectionContext) buildCombinedOp(c CombinedOpResult) cminorsel.Expr {
 	base := ctx.SelectExpr(c.Base)
@@ -147,6 +194,7 @@ func (ctx *SelectionContext) buildCombinedOp(c CombinedOpResult) cminorsel.Expr
 			Shift: c.Shift,
 			Left:  base,
 			Right: index,
+			Long:  c.Op == cminorsel.MOaddlshift,
 		}
 	case cminorsel.MOsubshift, cminorsel.MOsublshift:
 		return cminorsel.Esubshift{
@@ -154,6 +202,7 @@ func (ctx *SelectionContext) buildCombinedOp(c CombinedOpResult) cminorsel.Expr
 			Shift: c.Shift,
 			Left:  base,
 			Right: index,
+			Long:  c.Op == cminorsel.MOsublshift,
 		}
 	default:
 		// For and/or/xor shifts, fall back to regular binop
@@ -195,9 +244,10 @@ func (ctx *SelectionContext) selectLoad(ld cminor.Eload) cminorsel.Expr {
 	}
 
 	return cminorsel.Eload{
-		Chunk: cminorsel.Chunk(ld.Chunk),
-		Mode:  addrResult.Mode,
-		Args:  selectedArgs,
+		Chunk:    cminorsel.Chunk(ld.Chunk),
+		Mode:     addrResult.Mode,
+		Args:     selectedArgs,
+		Volatile: ld.Volatile,
 	}
 }
 
@@ -237,9 +287,10 @@ func (ctx *SelectionContext) reSelectExpr(e cminorsel.Expr) cminorsel.Expr {
 			args[i] = ctx.reSelectExpr(arg)
 		}
 		return cminorsel.Eload{
-			Chunk: expr.Chunk,
-			Mode:  expr.Mode,
-			Args:  args,
+			Chunk:    expr.Chunk,
+			Mode:     expr.Mode,
+			Args:     args,
+			Volatile: expr.Volatile,
 		}
 
 	default:
@@ -236,6 +236,65 @@ func TestSelectExpr_CombinedSubShift(t *testing.T) {
 	}
 }
 
+func TestSelectExpr_CombinedAddlScaled(t *testing.T) {
+	ctx := NewSelectionContext(nil, nil)
+	// p + i * 8 (pointer arithmetic on long*)
+	expr := cminor.Ebinop{
+		Op:   cminor.Oaddl,
+		Left: cminor.Evar{Name: "p"},
+		Right: cminor.Ebinop{
+			Op:    cminor.Omull,
+			Left:  cminor.Evar{Name: "i"},
+			Right: cminor.Econst{Const: cminor.Olongconst{Value: 8}},
+		},
+	}
+	result := ctx.SelectExpr(expr)
+
+	add, ok := result.(cminorsel.Eaddshift)
+	if !ok {
+		t.Fatalf("expected Eaddshift, got %T", result)
+	}
+	if add.Shift != 3 {
+		t.Errorf("expected shift 3, got %d", add.Shift)
+	}
+	if !add.Long {
+		t.Errorf("expected 64-bit add-shift")
+	}
+}
+
+func TestSelectExpr_LoadScaledIndex(t *testing.T) {
+	ctx := NewSelectionContext(nil, nil)
+	// a[i] for int a[]: load int32 from a + (long)i * 4
+	expr := cminor.Eload{
+		Chunk: cminor.Mint32,
+		Addr: cminor.Ebinop{
+			Op:   cminor.Oaddl,
+			Left: cminor.Evar{Name: "a"},
+			Right: cminor.Ebinop{
+				Op:    cminor.Omull,
+				Left:  cminor.Eunop{Op: cminor.Olongofint, Arg: cminor.Evar{Name: "i"}},
+				Right: cminor.Econst{Const: cminor.Olongconst{Value: 4}},
+			},
+		},
+	}
+	result := ctx.SelectExpr(expr)
+
+	ld, ok := result.(cminorsel.Eload)
+	if !ok {
+		t.Fatalf("expected Eload, got %T", result)
+	}
+	mode, ok := ld.Mode.(cminorsel.Aindexed2shift)
+	if !ok {
+		t.Fatalf("expected Aindexed2shift, got %T", ld.Mode)
+	}
+	if mode.Shift != 2 {
+		t.Errorf("expected shift 2, got %d", mode.Shift)
+	}
+	if len(ld.Args) != 2 {
+		t.Errorf("expected 2 args, got %d", len(ld.Args))
+	}
+}
+
 func TestSelectExpr_Cmp(t *testing.T) {
 	ctx := NewSelectionContext(nil, nil)
 	expr := cminor.Ecmp{
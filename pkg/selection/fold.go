@@ -0,0 +1,105 @@
+// Package selection - Constant folding for instruction selection.
+// Under -O2, int operations whose operands are all constants are evaluated
+// at compile time, as CompCert's selection smart constructors do.
+package selection
+
+import "github.com/raymyers/ralph-cc/pkg/cminor"
+
+// foldInt evaluates an int expression built from constants, returning its
+// value and the number of operations evaluated. It reports false when an
+// operand is not constant or the result would be undefined at run time
+// (division by zero, INT_MIN / -1, a shift count out of range): those are
+// left for the machine to compute.
+func foldInt(e cminor.Expr) (int32, int, bool) {
+	switch e := e.(type) {
+	case cminor.Econst:
+		if c, ok := e.Const.(cminor.Ointconst); ok {
+			return c.Value, 0, true
+		}
+	case cminor.Eunop:
+		v, n, ok := foldInt(e.Arg)
+		if !ok {
+			return 0, 0, false
+		}
+		switch e.Op {
+		case cminor.Onegint:
+			return -v, n + 1, true
+		case cminor.Onotint:
+			return ^v, n + 1, true
+		}
+	case cminor.Ebinop:
+		if !foldable(e.Op) {
+			return 0, 0, false
+		}
+		x, nx, ok := foldInt(e.Left)
+		if !ok {
+			return 0, 0, false
+		}
+		y, ny, ok := foldInt(e.Right)
+		if !ok {
+			return 0, 0, false
+		}
+		if v, ok := evalIntBinop(e.Op, x, y); ok {
+			return v, nx + ny + 1, true
+		}
+	}
+	return 0, 0, false
+}
+
+// foldable reports whether op is an int operation foldInt evaluates
+func foldable(op cminor.BinaryOp) bool {
+	switch op {
+	case cminor.Oadd, cminor.Osub, cminor.Omul,
+		cminor.Odiv, cminor.Odivu, cminor.Omod, cminor.Omodu,
+		cminor.Oand, cminor.Oor, cminor.Oxor,
+		cminor.Oshl, cminor.Oshr, cminor.Oshru:
+		return true
+	}
+	return false
+}
+
+// evalIntBinop computes x op y with 32-bit wraparound
+func evalIntBinop(op cminor.BinaryOp, x, y int32) (int32, bool) {
+	switch op {
+	case cminor.Oadd:
+		return x + y, true
+	case cminor.Osub:
+		return x - y, true
+	case cminor.Omul:
+		return x * y, true
+	case cminor.Odiv, cminor.Omod:
+		if y == 0 || x == -1<<31 && y == -1 {
+			return 0, false
+		}
+		if op == cminor.Odiv {
+			return x / y, true
+		}
+		return x % y, true
+	case cminor.Odivu, cminor.Omodu:
+		if y == 0 {
+			return 0, false
+		}
+		if op == cminor.Odivu {
+			return int32(uint32(x) / uint32(y)), true
+		}
+		return int32(uint32(x) % uint32(y)), true
+	case cminor.Oand:
+		return x & y, true
+	case cminor.Oor:
+		return x | y, true
+	case cminor.Oxor:
+		return x ^ y, true
+	case cminor.Oshl, cminor.Oshr, cminor.Oshru:
+		if uint32(y) >= 32 {
+			return 0, false
+		}
+		switch op {
+		case cminor.Oshl:
+			return x << y, true
+		case cminor.Oshr:
+			return x >> y, true
+		}
+		return int32(uint32(x) >> y), true
+	}
+	return 0, false
+}
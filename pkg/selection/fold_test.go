@@ -0,0 +1,103 @@
+package selection
+
+import (
+	"math"
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/cminor"
+	"github.com/raymyers/ralph-cc/pkg/cminorsel"
+	"github.com/raymyers/ralph-cc/pkg/optreport"
+)
+
+func ic(v int32) cminor.Expr {
+	return cminor.Econst{Const: cminor.Ointconst{Value: v}}
+}
+
+func bin(op cminor.BinaryOp, l, r cminor.Expr) cminor.Expr {
+	return cminor.Ebinop{Op: op, Left: l, Right: r}
+}
+
+func TestFoldInt(t *testing.T) {
+	tests := []struct {
+		name string
+		e    cminor.Expr
+		want int32
+		ops  int
+	}{
+		{"add", bin(cminor.Oadd, ic(3), ic(4)), 7, 1},
+		{"nested", bin(cminor.Oadd, ic(3), bin(cminor.Omul, ic(4), ic(2))), 11, 2},
+		{"add wraps", bin(cminor.Oadd, ic(math.MaxInt32), ic(1)), math.MinInt32, 1},
+		{"signed div truncates", bin(cminor.Odiv, ic(-7), ic(2)), -3, 1},
+		{"unsigned div", bin(cminor.Odivu, ic(-1), ic(2)), math.MaxInt32, 1},
+		{"signed mod", bin(cminor.Omod, ic(-7), ic(2)), -1, 1},
+		{"shr is arithmetic", bin(cminor.Oshr, ic(-8), ic(1)), -4, 1},
+		{"shru is logical", bin(cminor.Oshru, ic(-8), ic(28)), 15, 1},
+		{"shl", bin(cminor.Oshl, ic(1), ic(4)), 16, 1},
+		{"bitwise", bin(cminor.Oxor, bin(cminor.Oand, ic(12), ic(10)), bin(cminor.Oor, ic(1), ic(2))), 11, 3},
+		{"negation", cminor.Eunop{Op: cminor.Onegint, Arg: ic(5)}, -5, 1},
+		{"not", cminor.Eunop{Op: cminor.Onotint, Arg: ic(0)}, -1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, n, ok := foldInt(tt.e)
+			if !ok {
+				t.Fatal("expected the expression to fold")
+			}
+			if v != tt.want || n != tt.ops {
+				t.Errorf("got %d after %d operations, want %d after %d", v, n, tt.want, tt.ops)
+			}
+		})
+	}
+}
+
+func TestFoldIntLeavesRuntimeBehavior(t *testing.T) {
+	tests := []struct {
+		name string
+		e    cminor.Expr
+	}{
+		{"variable operand", bin(cminor.Oadd, ic(1), cminor.Evar{Name: "x"})},
+		{"division by zero", bin(cminor.Odiv, ic(1), ic(0))},
+		{"unsigned modulus by zero", bin(cminor.Omodu, ic(1), ic(0))},
+		{"INT_MIN / -1", bin(cminor.Odiv, ic(math.MinInt32), ic(-1))},
+		{"shift by 32", bin(cminor.Oshl, ic(1), ic(32))},
+		{"negative shift", bin(cminor.Oshr, ic(1), ic(-1))},
+		{"long operation", bin(cminor.Oaddl, cminor.Econst{Const: cminor.Olongconst{Value: 1}}, cminor.Econst{Const: cminor.Olongconst{Value: 2}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := foldInt(tt.e); ok {
+				t.Error("expected the expression not to fold")
+			}
+		})
+	}
+}
+
+func TestSelectFoldsOnlyUnderOptimize(t *testing.T) {
+	e := bin(cminor.Oadd, ic(3), bin(cminor.Omul, ic(4), ic(2)))
+
+	ctx := NewSelectionContext(nil, nil)
+	if _, ok := ctx.SelectExpr(e).(cminorsel.Econst); ok {
+		t.Error("expected the operations to be kept without Optimize")
+	}
+
+	ctx.Optimize = true
+	ctx.Report = optreport.New()
+	ctx.function = "f"
+	sel := ctx.SelectExpr(e)
+	if c, ok := sel.(cminorsel.Econst); !ok || c.Const != (cminorsel.Ointconst{Value: 11}) {
+		t.Fatalf("expected the constant 11, got %#v", sel)
+	}
+	if n := ctx.Report.Count("f", optreport.Folded); n != 2 {
+		t.Errorf("expected 2 folded operations, got %d", n)
+	}
+
+	// Constant operands of an operation that stays are folded on their own
+	partial := bin(cminor.Oadd, cminor.Evar{Name: "x"}, bin(cminor.Omul, ic(4), ic(2)))
+	sel = ctx.SelectExpr(partial)
+	if b, ok := sel.(cminorsel.Ebinop); !ok || b.Right != (cminorsel.Econst{Const: cminorsel.Ointconst{Value: 8}}) {
+		t.Errorf("expected x + 8, got %#v", sel)
+	}
+	if n := ctx.Report.Count("f", optreport.Folded); n != 3 {
+		t.Errorf("expected 3 folded operations, got %d", n)
+	}
+}
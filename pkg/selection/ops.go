@@ -5,6 +5,8 @@
 package selection
 
 import (
+	"math/bits"
+
 	"github.com/raymyers/ralph-cc/pkg/cminor"
 	"github.com/raymyers/ralph-cc/pkg/cminorsel"
 )
@@ -309,7 +311,9 @@ func TrySelectCombinedOp(op cminor.BinaryOp, left, right cminor.Expr) CombinedOp
 	return CombinedOpResult{IsCombined: false}
 }
 
-// extractShift checks if expr is a shift operation and returns (shiftOp, operand, amount, ok)
+// extractShift checks if expr is a shift operation and returns (shiftOp, operand, amount, ok).
+// Multiplication by a power of two, as produced by scaling an array index,
+// is treated as the equivalent left shift.
 func extractShift(e cminor.Expr) (cminor.BinaryOp, cminor.Expr, int, bool) {
 	binop, ok := e.(cminor.Ebinop)
 	if !ok {
@@ -324,11 +328,32 @@ func extractShift(e cminor.Expr) (cminor.BinaryOp, cminor.Expr, int, bool) {
 		if amt := extractConstantInt(binop.Right); amt != nil {
 			return binop.Op, binop.Left, int(*amt), true
 		}
+
+	case cminor.Omul, cminor.Omull:
+		shiftOp := cminor.Oshl
+		if binop.Op == cminor.Omull {
+			shiftOp = cminor.Oshll
+		}
+		if amt, ok := powerOfTwo(binop.Right); ok {
+			return shiftOp, binop.Left, amt, true
+		}
+		if amt, ok := powerOfTwo(binop.Left); ok {
+			return shiftOp, binop.Right, amt, true
+		}
 	}
 
 	return 0, nil, 0, false
 }
 
+// powerOfTwo returns k if e is the constant 2^k.
+func powerOfTwo(e cminor.Expr) (int, bool) {
+	v := extractConstantOffset(e)
+	if v == nil || *v <= 0 || *v&(*v-1) != 0 {
+		return 0, false
+	}
+	return bits.TrailingZeros64(uint64(*v)), true
+}
+
 // isValidShiftAmount checks if shift amount is valid for ARM64 (0-63 for 64-bit, 0-31 for 32-bit)
 func isValidShiftAmount(amount int) bool {
 	return amount >= 0 && amount <= 63
@@ -85,10 +85,11 @@ func (ctx *SelectionContext) selectStore(s cminor.Sstore) cminorsel.Stmt {
 	value := ctx.SelectExpr(s.Value)
 
 	return cminorsel.Sstore{
-		Chunk: cminorsel.Chunk(s.Chunk),
-		Mode:  addrResult.Mode,
-		Args:  selectedArgs,
-		Value: value,
+		Chunk:    cminorsel.Chunk(s.Chunk),
+		Mode:     addrResult.Mode,
+		Args:     selectedArgs,
+		Value:    value,
+		Volatile: s.Volatile,
 	}
 }
 
@@ -110,14 +111,16 @@ func (ctx *SelectionContext) selectCall(s cminor.Scall) cminorsel.Stmt {
 			Args:   s.Sig.Args,
 			Return: s.Sig.Return,
 			VarArg: s.Sig.VarArg,
+			Sret:   s.Sig.Sret,
 		}
 	}
 
 	return cminorsel.Scall{
-		Result: s.Result,
-		Sig:    sig,
-		Func:   fn,
-		Args:   args,
+		Result:   s.Result,
+		ResultHi: s.ResultHi,
+		Sig:      sig,
+		Func:     fn,
+		Args:     args,
 	}
 }
 
@@ -139,6 +142,7 @@ func (ctx *SelectionContext) selectTailcall(s cminor.Stailcall) cminorsel.Stmt {
 			Args:   s.Sig.Args,
 			Return: s.Sig.Return,
 			VarArg: s.Sig.VarArg,
+			Sret:   s.Sig.Sret,
 		}
 	}
 
@@ -232,12 +236,16 @@ func (ctx *SelectionContext) selectSwitch(s cminor.Sswitch) cminorsel.Stmt {
 
 // selectReturn handles return statements.
 func (ctx *SelectionContext) selectReturn(s cminor.Sreturn) cminorsel.Stmt {
-	var value cminorsel.Expr
+	var value, hi cminorsel.Expr
 	if s.Value != nil {
 		value = ctx.SelectExpr(s.Value)
 	}
+	if s.Hi != nil {
+		hi = ctx.SelectExpr(s.Hi)
+	}
 	return cminorsel.Sreturn{
 		Value: value,
+		Hi:    hi,
 	}
 }
 
@@ -252,6 +260,7 @@ func (ctx *SelectionContext) selectLabel(s cminor.Slabel) cminorsel.Stmt {
 
 // SelectFunction transforms a Cminor function to a CminorSel function.
 func (ctx *SelectionContext) SelectFunction(f cminor.Function) cminorsel.Function {
+	ctx.function = f.Name
 	// Select the function body
 	body := ctx.SelectStmt(f.Body)
 
@@ -260,6 +269,7 @@ func (ctx *SelectionContext) SelectFunction(f cminor.Function) cminorsel.Functio
 		Args:   f.Sig.Args,
 		Return: f.Sig.Return,
 		VarArg: f.Sig.VarArg,
+		Sret:   f.Sig.Sret,
 	}
 
 	return cminorsel.Function{
@@ -269,6 +279,7 @@ func (ctx *SelectionContext) SelectFunction(f cminor.Function) cminorsel.Functio
 		Vars:       f.Vars,
 		Stackspace: f.Stackspace,
 		Body:       body,
+		Static:     f.Static,
 	}
 }
 
@@ -302,6 +313,7 @@ func (ctx *SelectionContext) SelectProgram(p cminor.Program) cminorsel.Program {
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		}
 	}
 
@@ -323,7 +335,19 @@ func collectExternalFunctions(p cminor.Program, defined map[string]bool) map[str
 	externals := make(map[string]bool)
 
 	for _, f := range p.Functions {
-		collectExternalFunctionsInStmt(f.Body, defined, externals)
+		// A call through a parameter or local holding a function pointer
+		// is an indirect call, not a call to an external function
+		names := make(map[string]bool, len(defined)+len(f.Params)+len(f.Vars))
+		for name := range defined {
+			names[name] = true
+		}
+		for _, name := range f.Params {
+			names[name] = true
+		}
+		for _, name := range f.Vars {
+			names[name] = true
+		}
+		collectExternalFunctionsInStmt(f.Body, names, externals)
 	}
 
 	return externals
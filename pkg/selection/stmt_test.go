@@ -501,6 +501,33 @@ func TestSelectProgram_ExternalFunctions(t *testing.T) {
 	}
 }
 
+func TestSelectProgram_CallThroughLocal(t *testing.T) {
+	ctx := NewSelectionContext(nil, nil)
+	// fp = f; fp(3): the call goes through the local, not a symbol fp
+	prog := cminor.Program{
+		Functions: []cminor.Function{
+			{
+				Name: "main",
+				Sig:  cminor.Sig{Return: "i"},
+				Vars: []string{"fp"},
+				Body: cminor.Scall{
+					Func: cminor.Evar{Name: "fp"},
+					Args: []cminor.Expr{cminor.Econst{Const: cminor.Ointconst{Value: 3}}},
+				},
+			},
+		},
+	}
+	sel := ctx.SelectProgram(prog)
+
+	call, ok := sel.Functions[0].Body.(cminorsel.Scall)
+	if !ok {
+		t.Fatalf("expected Scall, got %T", sel.Functions[0].Body)
+	}
+	if v, ok := call.Func.(cminorsel.Evar); !ok || v.Name != "fp" {
+		t.Errorf("expected an indirect call through fp, got %#v", call.Func)
+	}
+}
+
 func TestCollectExternalFunctions(t *testing.T) {
 	// Test the collectExternalFunctions helper directly
 	defined := map[string]bool{"main": true, "helper": true}
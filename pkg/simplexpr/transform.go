@@ -3,6 +3,10 @@
 package simplexpr
 
 import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
 	"github.com/raymyers/ralph-cc/pkg/cabs"
 	"github.com/raymyers/ralph-cc/pkg/clight"
 	"github.com/raymyers/ralph-cc/pkg/ctypes"
@@ -10,10 +14,18 @@ import (
 
 // Transformer converts Cabs AST to Clight AST by extracting side-effects from expressions.
 type Transformer struct {
-	nextTempID int                       // counter for generating unique temp IDs
-	tempTypes  []ctypes.Type             // types of generated temporaries
-	typeEnv    map[string]ctypes.Type    // variable name -> type
-	structDefs map[string]ctypes.Tstruct // struct name -> full definition
+	nextTempID int                          // counter for generating unique temp IDs
+	tempTypes  []ctypes.Type                // types of generated temporaries
+	typeEnv    map[string]ctypes.Type       // variable name -> type
+	qualEnv    map[string]ctypes.Qualifiers // variable name -> qualifiers
+	structDefs map[string]ctypes.Tstruct    // struct name -> full definition
+	unionDefs  map[string]ctypes.Tunion     // union name -> full definition
+	typedefs   map[string]ctypes.Type       // typedef name -> underlying type
+	symbols    map[string]string            // variable name -> global it names, for static locals
+	lowerStmt  func(cabs.Stmt) clight.Stmt  // statement lowering, for statement expressions
+	function   string                       // name of the enclosing function, for __func__
+	nextLabel  int                          // counter for generating unique labels
+	charSign   ctypes.Signedness            // signedness of plain char
 }
 
 // New creates a new SimplExpr transformer.
@@ -22,10 +34,26 @@ func New() *Transformer {
 		nextTempID: 1,
 		tempTypes:  nil,
 		typeEnv:    make(map[string]ctypes.Type),
+		qualEnv:    make(map[string]ctypes.Qualifiers),
 		structDefs: make(map[string]ctypes.Tstruct),
+		unionDefs:  make(map[string]ctypes.Tunion),
+		typedefs:   make(map[string]ctypes.Type),
+		symbols:    make(map[string]string),
+		charSign:   ctypes.Unsigned,
 	}
 }
 
+// SetPlainCharSign sets the signedness of plain char, unsigned by default
+// as under AAPCS64.
+func (t *Transformer) SetPlainCharSign(sign ctypes.Signedness) {
+	t.charSign = sign
+}
+
+// plainChar returns the type of plain char.
+func (t *Transformer) plainChar() ctypes.Type {
+	return ctypes.PlainChar(t.charSign)
+}
+
 // Reset resets the transformer state for a new function.
 func (t *Transformer) Reset() {
 	t.nextTempID = 1
@@ -50,16 +78,81 @@ func (t *Transformer) newTemp(typ ctypes.Type) int {
 	return id
 }
 
+// NewLabel returns a label that is unique in the function and cannot
+// clash with one written in the source.
+func (t *Transformer) NewLabel() string {
+	t.nextLabel++
+	return "__label" + strconv.Itoa(t.nextLabel)
+}
+
+// SetStmtLowering installs the function used to lower the statements of a
+// statement expression. Statement translation lives in clightgen, which
+// builds on this package, so it is supplied by the caller.
+func (t *Transformer) SetStmtLowering(lower func(cabs.Stmt) clight.Stmt) {
+	t.lowerStmt = lower
+}
+
 // SetType records the type of a variable in the environment.
 func (t *Transformer) SetType(name string, typ ctypes.Type) {
 	t.typeEnv[name] = typ
 }
 
+// SetFunction records the name of the function being transformed, which
+// __func__ evaluates to.
+func (t *Transformer) SetFunction(name string) {
+	t.function = name
+}
+
+// SetSymbol makes a variable name refer to a global of another name, as a
+// static local does to the hidden global holding it. The type and
+// qualifiers are recorded under the global's name.
+func (t *Transformer) SetSymbol(name, symbol string) {
+	t.symbols[name] = symbol
+}
+
+// SetQualifiers records the qualifiers of a variable in the environment.
+func (t *Transformer) SetQualifiers(name string, quals ctypes.Qualifiers) {
+	t.qualEnv[name] = quals
+}
+
 // SetStructDef registers a struct definition.
 func (t *Transformer) SetStructDef(s ctypes.Tstruct) {
 	t.structDefs[s.Name] = s
 }
 
+// SetUnionDef registers a union definition.
+func (t *Transformer) SetUnionDef(u ctypes.Tunion) {
+	t.unionDefs[u.Name] = u
+}
+
+// SetTypedef records the underlying type of a typedef name.
+func (t *Transformer) SetTypedef(name string, typ ctypes.Type) {
+	t.typedefs[name] = typ
+}
+
+// TypeOf converts a type name, as the parser spells it, to its type.
+// Typedef names resolve to their underlying types and struct and union
+// types to their registered definitions.
+func (t *Transformer) TypeOf(typeName string) ctypes.Type {
+	return t.typeFromString(typeName)
+}
+
+// TypeofType converts the type name of a declaration whose base type is
+// typeof(operand), spelled "typeof(...)" by the parser, to its type. The
+// operand is typed but not evaluated, so it leaves no temporaries.
+func (t *Transformer) TypeofType(operand cabs.Expr, typeName string) ctypes.Type {
+	nextTempID, tempTypes := t.nextTempID, t.tempTypes
+	base := t.TransformExpr(operand).Expr.ExprType()
+	t.nextTempID, t.tempTypes = nextTempID, tempTypes
+
+	start := strings.IndexByte(typeName, '(')
+	end := matchingParen(typeName[start:])
+	if start < 0 || end < 0 {
+		return base
+	}
+	return t.declaratorType(base, typeName[start+end+1:])
+}
+
 // ResolveStruct looks up a struct definition by name and returns it with fields.
 // If not found, returns the input unchanged.
 func (t *Transformer) ResolveStruct(s ctypes.Tstruct) ctypes.Tstruct {
@@ -69,6 +162,15 @@ func (t *Transformer) ResolveStruct(s ctypes.Tstruct) ctypes.Tstruct {
 	return s
 }
 
+// ResolveUnion looks up a union definition by name and returns it with
+// fields. If not found, returns the input unchanged.
+func (t *Transformer) ResolveUnion(u ctypes.Tunion) ctypes.Tunion {
+	if def, ok := t.unionDefs[u.Name]; ok {
+		return def
+	}
+	return u
+}
+
 // GetType looks up the type of a variable.
 func (t *Transformer) GetType(name string) ctypes.Type {
 	if typ, ok := t.typeEnv[name]; ok {
@@ -132,6 +234,10 @@ func HasSideEffects(e cabs.Expr) bool {
 		return false
 	case cabs.Cast:
 		return HasSideEffects(expr.Expr)
+	case cabs.StmtExpr:
+		return true
+	case cabs.VaArg:
+		return true // advances the va_list
 	}
 	return false
 }
@@ -141,6 +247,11 @@ func HasSideEffects(e cabs.Expr) bool {
 func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 	switch expr := e.(type) {
 	case cabs.Constant:
+		if expr.Type != "" {
+			return TransformResult{
+				Expr: clight.Econst_int{Value: expr.Value, Typ: t.typeFromString(expr.Type)},
+			}
+		}
 		// Determine type based on value range following C99/C11 rules for
 		// decimal integer literals without suffix. The sequence is:
 		// 1. int
@@ -165,52 +276,41 @@ func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 		}
 
 	case cabs.StringLiteral:
-		// String literals become pointers to constant char arrays
+		// String literals are constant char arrays, which decay to
+		// pointers where they are used as values
 		// Process escape sequences in the string value
-		return TransformResult{
-			Expr: clight.Estring{Value: processEscapeSequences(expr.Value), Typ: ctypes.Pointer(ctypes.Char())},
+		value := processEscapeSequences(expr.Value)
+		if !isWideEncoding(expr.Encoding) {
+			return TransformResult{Expr: stringLiteral(value, t.plainChar())}
 		}
+		elemTyp := wideCharType(expr.Encoding)
+		return TransformResult{Expr: stringLiteral(encodeWide(value, elemTyp), elemTyp)}
 
 	case cabs.CharLiteral:
 		// Character literals become integer constants (ASCII value)
-		value := int64(0)
-		if len(expr.Value) > 0 {
-			if expr.Value[0] == '\\' && len(expr.Value) > 1 {
-				// Handle escape sequences
-				switch expr.Value[1] {
-				case 'n':
-					value = 10 // newline
-				case 't':
-					value = 9 // tab
-				case 'r':
-					value = 13 // carriage return
-				case '0':
-					value = 0 // null
-				case '\\':
-					value = 92 // backslash
-				case '\'':
-					value = 39 // single quote
-				case '"':
-					value = 34 // double quote
-				default:
-					value = int64(expr.Value[1])
-				}
-			} else {
-				value = int64(expr.Value[0])
-			}
+		value := expr.IntValue()
+		typ := ctypes.Int()
+		if isWideEncoding(expr.Encoding) {
+			typ = wideCharType(expr.Encoding)
 		}
 		return TransformResult{
-			Expr: clight.Econst_int{Value: value, Typ: ctypes.Int()},
+			Expr: clight.Econst_int{Value: value, Typ: typ},
 		}
 
 	case cabs.Variable:
-		typ := t.GetType(expr.Name)
-		// Resolve struct types to include field information
-		if st, ok := typ.(ctypes.Tstruct); ok {
-			typ = t.ResolveStruct(st)
+		name := expr.Name
+		if name == "__func__" && t.function != "" {
+			// C99 6.4.2.2: as if declared static const char __func__[] =
+			// "name"; at the start of the function body
+			return TransformResult{Expr: stringLiteral(t.function, t.plainChar())}
 		}
+		if symbol, ok := t.symbols[name]; ok {
+			name = symbol
+		}
+		typ := t.GetType(name)
+		// Resolve struct and union types to include field information
 		return TransformResult{
-			Expr: clight.Evar{Name: expr.Name, Typ: typ},
+			Expr: clight.Evar{Name: name, Typ: t.resolveRecord(typ)},
 		}
 
 	case cabs.Paren:
@@ -225,6 +325,9 @@ func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 	case cabs.Conditional:
 		return t.transformConditional(expr)
 
+	case cabs.StmtExpr:
+		return t.transformStmtExpr(expr)
+
 	case cabs.Call:
 		return t.transformCall(expr)
 
@@ -238,7 +341,7 @@ func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 		return TransformResult{
 			Expr: clight.Esizeof{
 				ArgType: t.typeFromString(expr.TypeName),
-				Typ:     ctypes.UInt(),
+				Typ:     ctypes.SizeT(),
 			},
 		}
 
@@ -248,7 +351,7 @@ func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 		return TransformResult{
 			Expr: clight.Esizeof{
 				ArgType: inner.Expr.ExprType(),
-				Typ:     ctypes.UInt(),
+				Typ:     ctypes.SizeT(),
 			},
 		}
 
@@ -261,6 +364,9 @@ func (t *Transformer) TransformExpr(e cabs.Expr) TransformResult {
 				Typ: t.typeFromString(expr.TypeName),
 			},
 		}
+
+	case cabs.VaArg:
+		return t.transformVaArg(expr)
 	}
 
 	// Unknown expression type - return a placeholder
@@ -313,7 +419,7 @@ func (t *Transformer) transformUnary(expr cabs.Unary) TransformResult {
 		}
 		return TransformResult{
 			Stmts: inner.Stmts,
-			Expr:  clight.Ederef{Ptr: inner.Expr, Typ: elemTyp},
+			Expr:  clight.Ederef{Ptr: inner.Expr, Typ: elemTyp, Volatile: t.volatileAt(inner.Expr, 1)},
 		}
 
 	case cabs.OpPreInc:
@@ -344,34 +450,45 @@ func (t *Transformer) transformUnary(expr cabs.Unary) TransformResult {
 func (t *Transformer) transformIncDec(operand cabs.Expr, op clight.BinaryOp, isPre bool) TransformResult {
 	inner := t.TransformExpr(operand)
 	typ := inner.Expr.ExprType()
-	one := clight.Econst_int{Value: 1, Typ: typ}
-
-	// Create the computed value: x + 1 or x - 1
-	computed := clight.Ebinop{Op: op, Left: inner.Expr, Right: one, Typ: typ}
+	one, opTyp := incDecOne(typ)
 
 	var stmts []clight.Stmt
 	stmts = append(stmts, inner.Stmts...)
 
+	// The operand is read once: the new value is computed from the temp
+	// holding the old one, so x++ leaves that temp as its result however
+	// the store to x is ordered against the rest of the expression
+	tempID := t.newTemp(typ)
+	temp := clight.Etempvar{ID: tempID, Typ: typ}
 	if isPre {
-		// ++x: compute x+1, assign to x, result is x+1
-		// We need a temp to hold the result
-		tempID := t.newTemp(typ)
-		stmts = append(stmts, clight.Sset{TempID: tempID, RHS: computed})
-		stmts = append(stmts, clight.Sassign{LHS: inner.Expr, RHS: clight.Etempvar{ID: tempID, Typ: typ}})
-		return TransformResult{
-			Stmts: stmts,
-			Expr:  clight.Etempvar{ID: tempID, Typ: typ},
-		}
+		// ++x: tmp = (T)(x + 1); x = tmp; result is tmp
+		computed := clight.Ebinop{Op: op, Left: convertTo(inner.Expr, opTyp), Right: one, Typ: opTyp}
+		stmts = append(stmts, clight.Sset{TempID: tempID, RHS: convertTo(computed, typ)})
+		stmts = append(stmts, clight.Sassign{LHS: inner.Expr, RHS: temp})
 	} else {
-		// x++: save x to temp, compute x+1, assign to x, result is saved temp
-		tempID := t.newTemp(typ)
+		// x++: tmp = x; x = (T)(tmp + 1); result is tmp
+		computed := clight.Ebinop{Op: op, Left: convertTo(temp, opTyp), Right: one, Typ: opTyp}
 		stmts = append(stmts, clight.Sset{TempID: tempID, RHS: inner.Expr})
-		stmts = append(stmts, clight.Sassign{LHS: inner.Expr, RHS: computed})
-		return TransformResult{
-			Stmts: stmts,
-			Expr:  clight.Etempvar{ID: tempID, Typ: typ},
+		stmts = append(stmts, clight.Sassign{LHS: inner.Expr, RHS: convertTo(computed, typ)})
+	}
+	return TransformResult{Stmts: stmts, Expr: temp}
+}
+
+// incDecOne returns the 1 that ++ and -- add to or subtract from an operand
+// of type typ, and the type the operation is done in (C11 6.5.2.4): as for
+// x + 1, a pointer steps by one element and an integer is promoted first.
+func incDecOne(typ ctypes.Type) (clight.Expr, ctypes.Type) {
+	switch ty := typ.(type) {
+	case ctypes.Tpointer:
+		return clight.Econst_int{Value: 1, Typ: ctypes.Int()}, typ
+	case ctypes.Tfloat:
+		if ty.Size == ctypes.F32 {
+			return clight.Econst_single{Value: 1, Typ: typ}, typ
 		}
+		return clight.Econst_float{Value: 1, Typ: typ}, typ
 	}
+	opTyp := usualArithmeticConversion(typ, ctypes.Int())
+	return clight.Econst_int{Value: 1, Typ: opTyp}, opTyp
 }
 
 func (t *Transformer) transformBinary(expr cabs.Binary) TransformResult {
@@ -421,8 +538,14 @@ func (t *Transformer) transformBinary(expr cabs.Binary) TransformResult {
 		stmts = append(stmts, right.Stmts...)
 
 		clightOp := t.cabsToBinaryOp(expr.Op)
-		// Apply C's usual arithmetic conversions for result type
-		typ := usualArithmeticConversion(left.Expr.ExprType(), right.Expr.ExprType())
+		leftExpr, rightExpr, typ := convertOperands(clightOp, left.Expr, right.Expr)
+
+		// The difference of two pointers is a ptrdiff_t
+		_, leftPtr := decayType(leftExpr.ExprType()).(ctypes.Tpointer)
+		_, rightPtr := decayType(rightExpr.ExprType()).(ctypes.Tpointer)
+		if clightOp == clight.Osub && leftPtr && rightPtr {
+			typ = ctypes.Long()
+		}
 
 		// Comparison operators return int
 		if clightOp >= clight.Oeq && clightOp <= clight.Oge {
@@ -431,7 +554,7 @@ func (t *Transformer) transformBinary(expr cabs.Binary) TransformResult {
 
 		return TransformResult{
 			Stmts: stmts,
-			Expr:  clight.Ebinop{Op: clightOp, Left: left.Expr, Right: right.Expr, Typ: typ},
+			Expr:  clight.Ebinop{Op: clightOp, Left: leftExpr, Right: rightExpr, Typ: typ},
 		}
 	}
 }
@@ -451,10 +574,12 @@ func (t *Transformer) transformAssign(lhs, rhs cabs.Expr) TransformResult {
 	typ := left.Expr.ExprType()
 	tempID := t.newTemp(typ)
 
-	// Cast RHS to LHS type to ensure proper truncation (e.g., assigning int to uint8_t)
+	// Cast RHS to LHS type to ensure proper truncation (e.g., assigning int
+	// to uint8_t). Conversions involving pointers are left to ctyping,
+	// which warns about the suspicious ones.
 	rhsExpr := right.Expr
-	if right.Expr.ExprType() != typ {
-		rhsExpr = clight.Ecast{Arg: right.Expr, Typ: typ}
+	if isArithmetic(right.Expr.ExprType()) && isArithmetic(typ) {
+		rhsExpr = convertTo(right.Expr, typ)
 	}
 
 	stmts = append(stmts, clight.Sset{TempID: tempID, RHS: rhsExpr})
@@ -475,8 +600,11 @@ func (t *Transformer) transformCompoundAssign(lhs, rhs cabs.Expr, op clight.Bina
 	stmts = append(stmts, left.Stmts...)
 	stmts = append(stmts, right.Stmts...)
 
+	// The operation is done in the type of x op e, as for the plain
+	// operator, and the result converted back: i *= d multiplies doubles
 	typ := left.Expr.ExprType()
-	computed := clight.Ebinop{Op: op, Left: left.Expr, Right: right.Expr, Typ: typ}
+	leftExpr, rightExpr, opTyp := convertOperands(op, left.Expr, right.Expr)
+	computed := convertTo(clight.Ebinop{Op: op, Left: leftExpr, Right: rightExpr, Typ: opTyp}, typ)
 
 	tempID := t.newTemp(typ)
 	stmts = append(stmts, clight.Sset{TempID: tempID, RHS: computed})
@@ -489,19 +617,10 @@ func (t *Transformer) transformCompoundAssign(lhs, rhs cabs.Expr, op clight.Bina
 }
 
 func (t *Transformer) transformComma(left, right cabs.Expr) TransformResult {
-	// e1, e2: evaluate e1 for side effects, result is e2
-	leftResult := t.TransformExpr(left)
+	// e1, e2: evaluate e1 for side effects, result is e2. The value of e1
+	// is discarded, but a volatile read in it is still performed.
+	stmts := t.TransformExprForEffects(left)
 	rightResult := t.TransformExpr(right)
-
-	var stmts []clight.Stmt
-	stmts = append(stmts, leftResult.Stmts...)
-	// The left expression's value is discarded, but we still need to evaluate it
-	// If it's pure, we can skip it; if it has side effects, they're already in stmts
-	if !HasSideEffects(left) {
-		// Pure expression used in comma - its value is discarded anyway
-		// but we should still compute it in case it has visible side effects
-		// (which it doesn't, since HasSideEffects returned false)
-	}
 	stmts = append(stmts, rightResult.Stmts...)
 
 	return TransformResult{
@@ -527,7 +646,7 @@ func (t *Transformer) transformConditional(expr cabs.Conditional) TransformResul
 		elseResult := t.TransformExpr(expr.Else)
 		// Clight doesn't have a conditional expression, so we must use if-then-else
 		// and a temporary
-		typ := thenResult.Expr.ExprType()
+		typ := conditionalType(thenResult.Expr, elseResult.Expr)
 		tempID := t.newTemp(typ)
 
 		thenStmt := clight.Sset{TempID: tempID, RHS: thenResult.Expr}
@@ -549,7 +668,21 @@ func (t *Transformer) transformConditional(expr cabs.Conditional) TransformResul
 	thenResult := t.TransformExpr(expr.Then)
 	elseResult := t.TransformExpr(expr.Else)
 
-	typ := thenResult.Expr.ExprType()
+	typ := conditionalType(thenResult.Expr, elseResult.Expr)
+
+	// Void arms, as calls to void functions, only have side effects
+	if _, ok := typ.(ctypes.Tvoid); ok {
+		stmts = append(stmts, clight.Sifthenelse{
+			Cond: cond.Expr,
+			Then: clight.Seq(thenResult.Stmts...),
+			Else: clight.Seq(elseResult.Stmts...),
+		})
+		return TransformResult{
+			Stmts: stmts,
+			Expr:  clight.Econst_int{Value: 0, Typ: typ},
+		}
+	}
+
 	tempID := t.newTemp(typ)
 
 	// Build then branch: execute side effects, then set temp
@@ -569,7 +702,110 @@ func (t *Transformer) transformConditional(expr cabs.Conditional) TransformResul
 	}
 }
 
+// conditionalType computes the type of c ? then : els (C99 6.5.15): the
+// usual arithmetic conversions of arithmetic arms, the pointer type when
+// the other arm is a null pointer constant, void * when either pointer is
+// one, and otherwise the type of the then arm. Arrays and functions decay
+// to pointers first. A struct or union result lives in a temporary that
+// Cshmgen backs with a stack local, so the selected arm is copied there.
+func conditionalType(then, els clight.Expr) ctypes.Type {
+	thenTyp := decayType(then.ExprType())
+	elseTyp := decayType(els.ExprType())
+
+	_, thenIsPtr := thenTyp.(ctypes.Tpointer)
+	elsePtr, elseIsPtr := elseTyp.(ctypes.Tpointer)
+	switch {
+	case thenIsPtr && elseIsPtr:
+		if _, ok := elsePtr.Elem.(ctypes.Tvoid); ok {
+			return elseTyp
+		}
+		return thenTyp
+	case thenIsPtr && isNullConstant(els):
+		return thenTyp
+	case elseIsPtr && isNullConstant(then):
+		return elseTyp
+	case isArithmetic(thenTyp) && isArithmetic(elseTyp):
+		return usualArithmeticConversion(thenTyp, elseTyp)
+	}
+	return thenTyp
+}
+
+// decayType converts an array type to a pointer to its element and a
+// function type to a pointer to it, as for a value
+func decayType(t ctypes.Type) ctypes.Type {
+	switch t := t.(type) {
+	case ctypes.Tarray:
+		return ctypes.Pointer(t.Elem)
+	case ctypes.Tfunction:
+		return ctypes.Pointer(t)
+	}
+	return t
+}
+
+func isArithmetic(t ctypes.Type) bool {
+	switch t.(type) {
+	case ctypes.Tint, ctypes.Tlong, ctypes.Tfloat:
+		return true
+	}
+	return false
+}
+
+// isNullConstant reports whether e is a null pointer constant: the integer
+// 0, possibly cast
+func isNullConstant(e clight.Expr) bool {
+	switch e := e.(type) {
+	case clight.Econst_int:
+		return e.Value == 0
+	case clight.Econst_long:
+		return e.Value == 0
+	case clight.Ecast:
+		return isNullConstant(e.Arg)
+	}
+	return false
+}
+
+// builtin describes a builtin function lowered to a Clight Sbuiltin.
+type builtin struct {
+	name      string      // Clight builtin name
+	arity     int         // operands passed on; va_start drops the last named parameter
+	byAddress bool        // operands are va_list objects, passed by address
+	result    ctypes.Type // nil for void
+}
+
+// builtins lists the builtin functions that the back end expands itself.
+var builtins = map[string]builtin{
+	"__builtin_memcpy":   {name: "memcpy", arity: 3, result: ctypes.Pointer(ctypes.Void())},
+	"__builtin_memset":   {name: "memset", arity: 3, result: ctypes.Pointer(ctypes.Void())},
+	"__builtin_va_start": {name: "va_start", arity: 1, byAddress: true},
+	"__builtin_va_end":   {name: "va_end", arity: 1, byAddress: true},
+	"__builtin_va_copy":  {name: "va_copy", arity: 2, byAddress: true},
+}
+
+// annotPrefix starts the name of the builtin __builtin_annot("text") is
+// lowered to; the rest of the name is the text, which asmgen prints as a
+// comment. Keeping the text in the name means no operand is materialized.
+const annotPrefix = "annot:"
+
 func (t *Transformer) transformCall(expr cabs.Call) TransformResult {
+	if v, ok := expr.Func.(cabs.Variable); ok {
+		if v.Name == "__builtin_annot" && len(expr.Args) > 0 {
+			if text, ok := expr.Args[0].(cabs.StringLiteral); ok {
+				return TransformResult{
+					Stmts: []clight.Stmt{clight.Sbuiltin{Builtin: annotPrefix + processEscapeSequences(text.Value)}},
+					Expr:  clight.Econst_int{Value: 0, Typ: ctypes.Void()},
+				}
+			}
+		}
+		// __builtin_expect(exp, c) is exp: the hint that exp is likely the
+		// constant c does not change its value
+		if v.Name == "__builtin_expect" && len(expr.Args) == 2 {
+			return t.TransformExpr(expr.Args[0])
+		}
+		if b, ok := builtins[v.Name]; ok && len(expr.Args) >= b.arity {
+			return t.transformBuiltin(b, expr.Args[:b.arity])
+		}
+	}
+
 	// Transform the function expression
 	funcResult := t.TransformExpr(expr.Func)
 
@@ -578,34 +814,65 @@ func (t *Transformer) transformCall(expr cabs.Call) TransformResult {
 
 	// Get function type to determine parameter types for argument conversion
 	var paramTypes []ctypes.Type
-	if fn, ok := funcResult.Expr.ExprType().(ctypes.Tfunction); ok {
+	varArg := false
+	if fn, ok := calleeType(funcResult.Expr); ok {
 		paramTypes = fn.Params
+		varArg = fn.VarArg
 	}
 
-	// Transform all arguments (left-to-right evaluation)
-	var args []clight.Expr
+	// Transform all arguments first so we know which ones have side effects
+	argResults := make([]TransformResult, len(expr.Args))
+	lastWithStmts := -1
 	for i, arg := range expr.Args {
-		argResult := t.TransformExpr(arg)
+		argResults[i] = t.TransformExpr(arg)
+		if len(argResults[i].Stmts) > 0 {
+			lastWithStmts = i
+		}
+	}
+
+	// Evaluate arguments left-to-right. An argument whose value could be
+	// changed by the side effects of a later argument (e.g. the first a in
+	// f(a, a = 1)) is captured in a temporary before those side effects run.
+	var args []clight.Expr
+	for i, argResult := range argResults {
 		stmts = append(stmts, argResult.Stmts...)
 
 		argExpr := argResult.Expr
-		// Insert cast to parameter type if needed and we have parameter type info
+		if i < lastWithStmts && !isStableExpr(argExpr) {
+			typ := argExpr.ExprType()
+			tempID := t.newTemp(typ)
+			stmts = append(stmts, clight.Sset{TempID: tempID, RHS: argExpr})
+			argExpr = clight.Etempvar{ID: tempID, Typ: typ}
+		}
+		// Insert cast to parameter type if needed and we have parameter
+		// type info. As for assignments, ctyping converts pointers.
 		if i < len(paramTypes) {
-			paramType := paramTypes[i]
-			argType := argExpr.ExprType()
-			if !ctypes.Equal(argType, paramType) {
-				argExpr = clight.Ecast{Arg: argExpr, Typ: paramType}
+			if isArithmetic(argExpr.ExprType()) && isArithmetic(paramTypes[i]) {
+				argExpr = convertTo(argExpr, paramTypes[i])
 			}
+		} else if varArg && ctypes.Equal(argExpr.ExprType(), ctypes.Float()) {
+			// Default argument promotion of a variable argument
+			argExpr = clight.Ecast{Arg: argExpr, Typ: ctypes.Double()}
 		}
 		args = append(args, argExpr)
 	}
 
 	// Determine return type (simplified - assume int if unknown)
 	retType := ctypes.Int()
-	if fn, ok := funcResult.Expr.ExprType().(ctypes.Tfunction); ok {
+	if fn, ok := calleeType(funcResult.Expr); ok {
 		retType = fn.Return
 	}
 
+	// A call to a void function has no result to keep, and its value is
+	// only a placeholder, as for __builtin_annot
+	if _, ok := retType.(ctypes.Tvoid); ok {
+		stmts = append(stmts, clight.Scall{Func: funcResult.Expr, Args: args})
+		return TransformResult{
+			Stmts: stmts,
+			Expr:  clight.Econst_int{Value: 0, Typ: retType},
+		}
+	}
+
 	// Function call becomes a statement; result goes into a temporary
 	tempID := t.newTemp(retType)
 	stmts = append(stmts, clight.Scall{
@@ -620,6 +887,167 @@ func (t *Transformer) transformCall(expr cabs.Call) TransformResult {
 	}
 }
 
+// calleeType returns the type of the function called through fn, a
+// function designator or a pointer to a function
+func calleeType(fn clight.Expr) (ctypes.Tfunction, bool) {
+	typ := fn.ExprType()
+	if ptr, ok := typ.(ctypes.Tpointer); ok {
+		typ = ptr.Elem
+	}
+	f, ok := typ.(ctypes.Tfunction)
+	return f, ok
+}
+
+// transformBuiltin lowers a call to a builtin into an Sbuiltin statement,
+// evaluating the operands left-to-right like the arguments of a call.
+func (t *Transformer) transformBuiltin(b builtin, operands []cabs.Expr) TransformResult {
+	results := make([]TransformResult, len(operands))
+	lastWithStmts := -1
+	for i, operand := range operands {
+		results[i] = t.TransformExpr(operand)
+		if len(results[i].Stmts) > 0 {
+			lastWithStmts = i
+		}
+	}
+
+	var stmts []clight.Stmt
+	args := make([]clight.Expr, len(operands))
+	for i, result := range results {
+		stmts = append(stmts, result.Stmts...)
+		args[i] = result.Expr
+		if b.byAddress {
+			args[i] = clight.Eaddrof{Arg: result.Expr, Typ: ctypes.Pointer(result.Expr.ExprType())}
+		} else if i < lastWithStmts && !isStableExpr(result.Expr) {
+			typ := result.Expr.ExprType()
+			tempID := t.newTemp(typ)
+			stmts = append(stmts, clight.Sset{TempID: tempID, RHS: result.Expr})
+			args[i] = clight.Etempvar{ID: tempID, Typ: typ}
+		}
+	}
+
+	if b.result == nil {
+		stmts = append(stmts, clight.Sbuiltin{Builtin: b.name, Args: args})
+		return TransformResult{
+			Stmts: stmts,
+			Expr:  clight.Econst_int{Value: 0, Typ: ctypes.Void()},
+		}
+	}
+	tempID := t.newTemp(b.result)
+	stmts = append(stmts, clight.Sbuiltin{Result: &tempID, Builtin: b.name, Args: args})
+	return TransformResult{
+		Stmts: stmts,
+		Expr:  clight.Etempvar{ID: tempID, Typ: b.result},
+	}
+}
+
+// transformVaArg lowers va_arg(ap, T) against the AAPCS64 va_list. The back
+// end passes every argument in general registers or on the stack, in 8-byte
+// slots, so only the general register save area is consulted:
+//
+//	if (ap.__gr_offs < 0) { addr = ap.__gr_top + ap.__gr_offs; ap.__gr_offs += 8; }
+//	else { addr = ap.__stack; ap.__stack += 8; }
+//
+// and the result is *(T *)addr.
+func (t *Transformer) transformVaArg(expr cabs.VaArg) TransformResult {
+	ap := t.TransformExpr(expr.Expr)
+	stmts := ap.Stmts
+	bytePtr := ctypes.Pointer(ctypes.Char())
+	field := func(name string, typ ctypes.Type) clight.Expr {
+		return clight.Efield{Arg: ap.Expr, FieldName: name, Typ: typ}
+	}
+	grOffs := field("__gr_offs", ctypes.Int())
+	grTop := field("__gr_top", bytePtr)
+	stack := field("__stack", bytePtr)
+
+	addr := t.newTemp(bytePtr)
+	fromRegs := clight.Seq(
+		clight.Sset{TempID: addr, RHS: clight.Ebinop{
+			Op:    clight.Oadd,
+			Left:  grTop,
+			Right: clight.Ecast{Arg: grOffs, Typ: ctypes.Long()},
+			Typ:   bytePtr,
+		}},
+		clight.Sassign{LHS: grOffs, RHS: clight.Ebinop{
+			Op:    clight.Oadd,
+			Left:  grOffs,
+			Right: clight.Econst_int{Value: 8, Typ: ctypes.Int()},
+			Typ:   ctypes.Int(),
+		}},
+	)
+	fromStack := clight.Seq(
+		clight.Sset{TempID: addr, RHS: stack},
+		clight.Sassign{LHS: stack, RHS: clight.Ebinop{
+			Op:    clight.Oadd,
+			Left:  stack,
+			Right: clight.Econst_long{Value: 8, Typ: ctypes.Long()},
+			Typ:   bytePtr,
+		}},
+	)
+	stmts = append(stmts, clight.Sifthenelse{
+		Cond: clight.Ebinop{
+			Op:    clight.Olt,
+			Left:  grOffs,
+			Right: clight.Econst_int{Value: 0, Typ: ctypes.Int()},
+			Typ:   ctypes.Int(),
+		},
+		Then: fromRegs,
+		Else: fromStack,
+	})
+
+	typ := t.typeFromString(expr.TypeName)
+	ptr := clight.Ecast{Arg: clight.Etempvar{ID: addr, Typ: bytePtr}, Typ: ctypes.Pointer(typ)}
+	return TransformResult{
+		Stmts: stmts,
+		Expr:  clight.Ederef{Ptr: ptr, Typ: typ},
+	}
+}
+
+// transformStmtExpr lowers a statement expression: the block's statements
+// run first, then the trailing expression is evaluated and captured in a
+// temporary so that later side effects in the enclosing expression cannot
+// change it. A statement expression without a trailing expression is void.
+func (t *Transformer) transformStmtExpr(expr cabs.StmtExpr) TransformResult {
+	var stmts []clight.Stmt
+	if t.lowerStmt != nil && expr.Block != nil {
+		stmts = append(stmts, t.lowerStmt(expr.Block))
+	}
+
+	if expr.Result == nil {
+		return TransformResult{
+			Stmts: stmts,
+			Expr:  clight.Econst_int{Value: 0, Typ: ctypes.Void()},
+		}
+	}
+
+	result := t.TransformExpr(expr.Result)
+	stmts = append(stmts, result.Stmts...)
+	resultExpr := result.Expr
+	if !isStableExpr(resultExpr) {
+		typ := resultExpr.ExprType()
+		tempID := t.newTemp(typ)
+		stmts = append(stmts, clight.Sset{TempID: tempID, RHS: resultExpr})
+		resultExpr = clight.Etempvar{ID: tempID, Typ: typ}
+	}
+	return TransformResult{Stmts: stmts, Expr: resultExpr}
+}
+
+// isStableExpr reports whether an expression's value cannot be changed by
+// side effects: constants, temporaries (each assigned once) and addresses
+// of named variables.
+func isStableExpr(e clight.Expr) bool {
+	switch expr := e.(type) {
+	case clight.Econst_int, clight.Econst_long, clight.Econst_float, clight.Econst_single,
+		clight.Estring, clight.Etempvar, clight.Esizeof, clight.Ealignof:
+		return true
+	case clight.Eaddrof:
+		_, ok := expr.Arg.(clight.Evar)
+		return ok
+	case clight.Ecast:
+		return isStableExpr(expr.Arg)
+	}
+	return false
+}
+
 func (t *Transformer) transformIndex(expr cabs.Index) TransformResult {
 	// a[i] is equivalent to *(a + i)
 	array := t.TransformExpr(expr.Array)
@@ -652,7 +1080,7 @@ func (t *Transformer) transformIndex(expr cabs.Index) TransformResult {
 
 	return TransformResult{
 		Stmts: stmts,
-		Expr:  clight.Ederef{Ptr: ptrAdd, Typ: elemTyp},
+		Expr:  clight.Ederef{Ptr: ptrAdd, Typ: elemTyp, Volatile: t.volatileAt(ptrAdd, 1)},
 	}
 }
 
@@ -670,38 +1098,109 @@ func (t *Transformer) transformMember(expr cabs.Member) TransformResult {
 		// Dereference the pointer first
 		elemTyp := ctypes.Int()
 		if ptr, ok := baseTyp.(ctypes.Tpointer); ok {
-			elemTyp = ptr.Elem
-			// Resolve struct type if the pointed-to type is a struct
-			if st, ok := elemTyp.(ctypes.Tstruct); ok {
-				elemTyp = t.ResolveStruct(st)
-			}
+			// Resolve the pointed-to type if it is a struct or union
+			elemTyp = t.resolveRecord(ptr.Elem)
 		}
-		base = clight.Ederef{Ptr: inner.Expr, Typ: elemTyp}
+		base = clight.Ederef{Ptr: inner.Expr, Typ: elemTyp, Volatile: t.volatileAt(inner.Expr, 1)}
 		baseTyp = elemTyp
 	}
 
-	// Resolve struct type to get field information
-	if st, ok := baseTyp.(ctypes.Tstruct); ok {
-		baseTyp = t.ResolveStruct(st)
+	// A member of an anonymous member is accessed through it: s.f
+	// becomes s.$anon1.f, each access at the offset of its own field
+	path := t.fieldPath(baseTyp, expr.Name)
+	if path == nil {
+		path = []ctypes.Field{{Name: expr.Name, Type: ctypes.Int()}}
 	}
-
-	// Look up field type from resolved struct
-	fieldTyp := ctypes.Int()
-	if st, ok := baseTyp.(ctypes.Tstruct); ok {
-		for _, f := range st.Fields {
-			if f.Name == expr.Name {
-				fieldTyp = f.Type
-				break
-			}
-		}
+	for _, f := range path {
+		base = clight.Efield{Arg: base, FieldName: f.Name, Typ: f.Type, Volatile: t.volatileAt(base, 0)}
 	}
 
 	return TransformResult{
 		Stmts: stmts,
-		Expr:  clight.Efield{Arg: base, FieldName: expr.Name, Typ: fieldTyp},
+		Expr:  base,
 	}
 }
 
+// resolveRecord returns typ with the fields of its definition if it is a
+// struct or union type, and typ otherwise.
+func (t *Transformer) resolveRecord(typ ctypes.Type) ctypes.Type {
+	switch rt := typ.(type) {
+	case ctypes.Tstruct:
+		return t.ResolveStruct(rt)
+	case ctypes.Tunion:
+		return t.ResolveUnion(rt)
+	}
+	return typ
+}
+
+// fieldPath returns the fields leading to the member name of a struct or
+// union type: the member itself, or the anonymous members enclosing it
+// followed by the member. It returns nil if typ has no such member.
+func (t *Transformer) fieldPath(typ ctypes.Type, name string) []ctypes.Field {
+	var fields []ctypes.Field
+	switch rt := t.resolveRecord(typ).(type) {
+	case ctypes.Tstruct:
+		fields = rt.Fields
+	case ctypes.Tunion:
+		fields = rt.Fields
+	}
+	for _, f := range fields {
+		if f.Name == name {
+			return []ctypes.Field{f}
+		}
+	}
+	for _, f := range fields {
+		if !f.Anonymous {
+			continue
+		}
+		if path := t.fieldPath(f.Type, name); path != nil {
+			return append([]ctypes.Field{f}, path...)
+		}
+	}
+	return nil
+}
+
+// volatileAt reports whether the object reached by following level pointers
+// from the value of e is volatile-qualified. Qualifiers are only recorded
+// for named variables, so anything else (e.g. a cast) is not volatile.
+func (t *Transformer) volatileAt(e clight.Expr, level int) bool {
+	switch expr := e.(type) {
+	case clight.Evar:
+		return t.qualEnv[expr.Name].At(level).Volatile
+	case clight.Ederef:
+		if level == 0 && expr.Volatile {
+			return true
+		}
+		return t.volatileAt(expr.Ptr, level+1)
+	case clight.Efield:
+		return level == 0 && expr.Volatile
+	case clight.Eaddrof:
+		return level > 0 && t.volatileAt(expr.Arg, level-1)
+	case clight.Ebinop:
+		// Pointer arithmetic keeps the pointee's qualifiers
+		switch expr.Op {
+		case clight.Oadd:
+			return t.volatileAt(expr.Left, level) || t.volatileAt(expr.Right, level)
+		case clight.Osub:
+			return t.volatileAt(expr.Left, level)
+		}
+	}
+	return false
+}
+
+// TransformExprForEffects transforms an expression whose value is discarded,
+// such as an expression statement, and returns only its side effects.
+// Reading a volatile object is itself a side effect, so a volatile access
+// is kept by assigning it to a temporary.
+func (t *Transformer) TransformExprForEffects(e cabs.Expr) []clight.Stmt {
+	result := t.TransformExpr(e)
+	if result.Expr != nil && t.volatileAt(result.Expr, 0) {
+		tempID := t.newTemp(result.Expr.ExprType())
+		return append(result.Stmts, clight.Sset{TempID: tempID, RHS: result.Expr})
+	}
+	return result.Stmts
+}
+
 func (t *Transformer) cabsToBinaryOp(op cabs.BinaryOp) clight.BinaryOp {
 	switch op {
 	case cabs.OpAdd:
@@ -747,11 +1246,28 @@ func (t *Transformer) cabsToBinaryOp(op cabs.BinaryOp) clight.BinaryOp {
 }
 
 func (t *Transformer) typeFromString(typeName string) ctypes.Type {
+	typeName = strings.TrimSpace(typeName)
+	// Pointer, array and function parts follow the base type: int *[3]
+	if i := strings.IndexAny(typeName, "*[("); i > 0 {
+		return t.declaratorType(t.typeFromString(typeName[:i]), typeName[i:])
+	}
+	// Qualifiers, as those of the parameters of a function pointer type,
+	// are not part of the type: const char is char
+	typeName = withoutQualifiers(typeName)
+	if typ, ok := t.typedefs[typeName]; ok {
+		// The struct may have been defined after the typedef naming it
+		if st, ok := typ.(ctypes.Tstruct); ok {
+			return t.ResolveStruct(st)
+		}
+		return typ
+	}
 	switch typeName {
 	case "void":
 		return ctypes.Void()
-	case "char", "signed char":
-		return ctypes.Char()
+	case "char":
+		return t.plainChar()
+	case "signed char":
+		return ctypes.SChar()
 	case "unsigned char":
 		return ctypes.UChar()
 	case "short", "signed short", "short int", "signed short int":
@@ -772,7 +1288,7 @@ func (t *Transformer) typeFromString(typeName string) ctypes.Type {
 		return ctypes.Double()
 	// Standard integer typedefs from <stdint.h>
 	case "int8_t":
-		return ctypes.Char() // signed 8-bit
+		return ctypes.SChar() // signed 8-bit
 	case "uint8_t":
 		return ctypes.UChar() // unsigned 8-bit
 	case "int16_t":
@@ -791,16 +1307,113 @@ func (t *Transformer) typeFromString(typeName string) ctypes.Type {
 		return ctypes.Tlong{Sign: ctypes.Unsigned} // unsigned long on 64-bit
 	case "ssize_t", "ptrdiff_t":
 		return ctypes.Long() // signed long on 64-bit
+	case "__builtin_va_list":
+		return ctypes.VaList()
 	default:
-		// Check for pointer types
-		if len(typeName) > 2 && typeName[len(typeName)-1] == '*' {
-			baseType := t.typeFromString(typeName[:len(typeName)-2])
-			return ctypes.Pointer(baseType)
+		if name, ok := strings.CutPrefix(typeName, "struct "); ok {
+			return t.ResolveStruct(ctypes.Tstruct{Name: strings.TrimSpace(name)})
+		}
+		if name, ok := strings.CutPrefix(typeName, "union "); ok {
+			return t.ResolveUnion(ctypes.Tunion{Name: strings.TrimSpace(name)})
 		}
 		return ctypes.Int() // default fallback
 	}
 }
 
+// declaratorType applies the abstract declarator of a type name to its
+// base type. Within a declarator the array and function suffixes bind
+// tighter than the pointers, and a parenthesized declarator applies last:
+// "*[3]" is an array of pointers, "(*)[3]" a pointer to an array.
+func (t *Transformer) declaratorType(base ctypes.Type, decl string) ctypes.Type {
+	decl = strings.TrimSpace(decl)
+	typ := base
+	for strings.HasPrefix(decl, "*") {
+		typ = ctypes.Pointer(typ)
+		decl = withoutQualifiers(decl[1:])
+	}
+
+	inner := ""
+	if strings.HasPrefix(decl, "(*") {
+		end := matchingParen(decl)
+		inner, decl = decl[1:end], decl[end+1:]
+	}
+
+	// Suffixes apply from the right: [2][3] is an array of 2 arrays of 3
+	var suffixes []string
+	for decl != "" {
+		end := len(decl)
+		switch decl[0] {
+		case '[':
+			end = strings.IndexByte(decl, ']')
+		case '(':
+			end = matchingParen(decl)
+		}
+		if end < 0 || end >= len(decl) {
+			break
+		}
+		suffixes = append(suffixes, decl[:end+1])
+		decl = decl[end+1:]
+	}
+	for i := len(suffixes) - 1; i >= 0; i-- {
+		suffix := suffixes[i]
+		if suffix[0] == '[' {
+			size, err := strconv.ParseInt(suffix[1:len(suffix)-1], 10, 64)
+			if err != nil {
+				size = -1 // incomplete array
+			}
+			typ = ctypes.Array(typ, size)
+			continue
+		}
+		fn := ctypes.Tfunction{Return: typ}
+		for _, param := range strings.Split(suffix[1:len(suffix)-1], ",") {
+			if param = strings.TrimSpace(param); param == "..." {
+				fn.VarArg = true
+			} else if param != "" && param != "void" {
+				fn.Params = append(fn.Params, t.typeFromString(param))
+			}
+		}
+		typ = fn
+	}
+
+	if inner != "" {
+		return t.declaratorType(typ, inner)
+	}
+	return typ
+}
+
+// withoutQualifiers removes the type qualifier words of a type name, and
+// the spaces around them.
+func withoutQualifiers(typeName string) string {
+	words := strings.Fields(typeName)
+	kept := words[:0]
+	for _, w := range words {
+		switch w {
+		case "const", "volatile", "restrict":
+		default:
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// matchingParen returns the index of the parenthesis closing the one that
+// starts s, or -1
+func matchingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 // processEscapeSequences converts escape sequences in a string literal to their actual characters.
 // For example, `\n` becomes a newline character (byte 10).
 func processEscapeSequences(s string) string {
@@ -840,6 +1453,64 @@ func processEscapeSequences(s string) string {
 	return string(result)
 }
 
+// isWideEncoding reports whether a literal prefix selects characters wider
+// than char (L, u or U).
+func isWideEncoding(encoding string) bool {
+	return encoding == "L" || encoding == "u" || encoding == "U"
+}
+
+// wideCharType returns the character type of a wide literal prefix:
+// wchar_t for L, char16_t for u and char32_t for U. On AArch64 Linux
+// wchar_t is a 4-byte signed int.
+func wideCharType(encoding string) ctypes.Type {
+	switch encoding {
+	case "u":
+		return ctypes.UShort()
+	case "L":
+		return ctypes.Int()
+	}
+	return ctypes.UInt()
+}
+
+// stringLiteral types the bytes of a string literal, encoded as code
+// units of elemTyp, as the array of its characters and the terminator:
+// sizeof L"abc" is 16.
+func stringLiteral(value string, elemTyp ctypes.Type) clight.Estring {
+	width := int64(1)
+	switch elemTyp.(ctypes.Tint).Size {
+	case ctypes.I16:
+		width = 2
+	case ctypes.I32:
+		width = 4
+	}
+	return clight.Estring{Value: value, Typ: ctypes.Array(elemTyp, int64(len(value))/width+1)}
+}
+
+// encodeWide re-encodes the UTF-8 bytes of a string literal as
+// little-endian code units of elemTyp (UTF-16 for 2-byte units, UTF-32
+// for 4-byte ones). The result lacks the terminator, like other strings.
+func encodeWide(s string, elemTyp ctypes.Type) string {
+	width := 4
+	var units []uint32
+	if elemTyp.(ctypes.Tint).Size == ctypes.I16 {
+		width = 2
+		for _, u := range utf16.Encode([]rune(s)) {
+			units = append(units, uint32(u))
+		}
+	} else {
+		for _, r := range s {
+			units = append(units, uint32(r))
+		}
+	}
+	var result []byte
+	for _, u := range units {
+		for i := 0; i < width; i++ {
+			result = append(result, byte(u>>(8*i)))
+		}
+	}
+	return string(result)
+}
+
 // transformLogicalAnd implements short-circuit && evaluation.
 // Transforms: a && b => if (a) { if (b) temp=1 else temp=0 } else { temp=0 }
 func (t *Transformer) transformLogicalAnd(left, right cabs.Expr) TransformResult {
@@ -881,6 +1552,43 @@ func (t *Transformer) transformLogicalAnd(left, right cabs.Expr) TransformResult
 	}
 }
 
+// convertTo casts e to typ unless it already has that type
+func convertTo(e clight.Expr, typ ctypes.Type) clight.Expr {
+	if ctypes.Equal(e.ExprType(), typ) {
+		return e
+	}
+	return clight.Ecast{Arg: e, Typ: typ}
+}
+
+// convertOperands applies C's usual arithmetic conversions to the operands
+// of op, returning them converted and the type the operation is done in.
+func convertOperands(op clight.BinaryOp, left, right clight.Expr) (clight.Expr, clight.Expr, ctypes.Type) {
+	typ := usualArithmeticConversion(left.ExprType(), right.ExprType())
+	switch {
+	case op == clight.Oshl || op == clight.Oshr:
+		// The operands of a shift are promoted separately and the
+		// result has the type of the left one
+		left = convertTo(left, integerPromotion(left.ExprType()))
+		right = convertTo(right, integerPromotion(right.ExprType()))
+		typ = left.ExprType()
+	case isArithmetic(left.ExprType()) && isArithmetic(right.ExprType()):
+		// The operation is done in the common type, so the operands
+		// are converted to it: c1 + c2 on chars adds two ints
+		left, right = convertTo(left, typ), convertTo(right, typ)
+	}
+	return left, right, typ
+}
+
+// integerPromotion returns the type an operand of type t is promoted to
+// (C99 6.3.1.1): types smaller than int, all of whose values an int can
+// hold, become int. Other types are unchanged.
+func integerPromotion(t ctypes.Type) ctypes.Type {
+	if typ, ok := t.(ctypes.Tint); ok && typ.Size != ctypes.I32 {
+		return ctypes.Int()
+	}
+	return t
+}
+
 // usualArithmeticConversion computes the result type of a binary arithmetic
 // operation according to C's "usual arithmetic conversions" (C99 6.3.1.8).
 // Key rules:
@@ -891,16 +1599,6 @@ func (t *Transformer) transformLogicalAnd(left, right cabs.Expr) TransformResult
 //   rank), the result is unsigned int
 // - For long types, similar rules apply with long/unsigned long
 func usualArithmeticConversion(left, right ctypes.Type) ctypes.Type {
-	// Helper to check if type needs integer promotion (smaller than int)
-	needsPromotion := func(t ctypes.Type) bool {
-		switch typ := t.(type) {
-		case ctypes.Tint:
-			// int8, int16, uint8, uint16 all promote to int
-			return typ.Size == ctypes.I8 || typ.Size == ctypes.I16
-		}
-		return false
-	}
-
 	// Helper to check if type is unsigned int (32-bit)
 	isUnsignedInt := func(t ctypes.Type) bool {
 		if typ, ok := t.(ctypes.Tint); ok {
@@ -933,6 +1631,16 @@ func usualArithmeticConversion(left, right ctypes.Type) ctypes.Type {
 		return right
 	}
 
+	// Pointer arithmetic has the type of the pointer, an array operand
+	// decaying to one first. It comes before the long rules: p + sizeof x
+	// is a pointer.
+	if ptr, ok := decayType(left).(ctypes.Tpointer); ok {
+		return ptr
+	}
+	if ptr, ok := decayType(right).(ctypes.Tpointer); ok {
+		return ptr
+	}
+
 	// Handle long types
 	_, leftIsLong := left.(ctypes.Tlong)
 	_, rightIsLong := right.(ctypes.Tlong)
@@ -943,18 +1651,9 @@ func usualArithmeticConversion(left, right ctypes.Type) ctypes.Type {
 		return ctypes.Long()
 	}
 
-	// For pointer arithmetic, result is typically pointer or long
-	if _, ok := left.(ctypes.Tpointer); ok {
-		return left
-	}
-	if _, ok := right.(ctypes.Tpointer); ok {
-		return right
-	}
-
-	// If either operand needs promotion (smaller than int), result is int
-	if needsPromotion(left) || needsPromotion(right) {
-		return ctypes.Int()
-	}
+	// Operands smaller than int are promoted to int first, so unsigned
+	// short and unsigned int have the type unsigned int
+	left, right = integerPromotion(left), integerPromotion(right)
 
 	// If either operand is unsigned int, result is unsigned int
 	if isUnsignedInt(left) || isUnsignedInt(right) {
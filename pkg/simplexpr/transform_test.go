@@ -1,6 +1,7 @@
 package simplexpr
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/cabs"
@@ -101,6 +102,50 @@ func TestTransformExpr_BinaryOp(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_OperandConversions(t *testing.T) {
+	tr := New()
+	tr.SetType("c1", ctypes.Char())
+	tr.SetType("c2", ctypes.Char())
+	tr.SetType("us", ctypes.Tint{Size: ctypes.I16, Sign: ctypes.Unsigned})
+	tr.SetType("u", ctypes.UInt())
+	tr.SetType("i", ctypes.Int())
+	tr.SetType("l", ctypes.Long())
+	tr.SetType("d", ctypes.Double())
+	v := func(name string, typ ctypes.Type) clight.Expr { return clight.Evar{Name: name, Typ: typ} }
+	toInt := func(e clight.Expr) clight.Expr { return clight.Ecast{Arg: e, Typ: ctypes.Int()} }
+	char, ushort := ctypes.Char(), ctypes.Tint{Size: ctypes.I16, Sign: ctypes.Unsigned}
+
+	tests := []struct {
+		name  string
+		op    cabs.BinaryOp
+		left  string
+		right string
+		want  clight.Ebinop
+	}{
+		{"char plus char", cabs.OpAdd, "c1", "c2",
+			clight.Ebinop{Op: clight.Oadd, Left: toInt(v("c1", char)), Right: toInt(v("c2", char)), Typ: ctypes.Int()}},
+		{"unsigned short times unsigned", cabs.OpMul, "us", "u",
+			clight.Ebinop{Op: clight.Omul, Left: clight.Ecast{Arg: v("us", ushort), Typ: ctypes.UInt()}, Right: v("u", ctypes.UInt()), Typ: ctypes.UInt()}},
+		{"int plus double", cabs.OpAdd, "i", "d",
+			clight.Ebinop{Op: clight.Oadd, Left: clight.Ecast{Arg: v("i", ctypes.Int()), Typ: ctypes.Double()}, Right: v("d", ctypes.Double()), Typ: ctypes.Double()}},
+		{"int less than long", cabs.OpLt, "i", "l",
+			clight.Ebinop{Op: clight.Olt, Left: clight.Ecast{Arg: v("i", ctypes.Int()), Typ: ctypes.Long()}, Right: v("l", ctypes.Long()), Typ: ctypes.Int()}},
+		{"char shifted by long", cabs.OpShl, "c1", "l",
+			clight.Ebinop{Op: clight.Oshl, Left: toInt(v("c1", char)), Right: v("l", ctypes.Long()), Typ: ctypes.Int()}},
+		{"int plus int", cabs.OpAdd, "i", "i",
+			clight.Ebinop{Op: clight.Oadd, Left: v("i", ctypes.Int()), Right: v("i", ctypes.Int()), Typ: ctypes.Int()}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tr.TransformExpr(cabs.Binary{Op: tc.op, Left: cabs.Variable{Name: tc.left}, Right: cabs.Variable{Name: tc.right}})
+			if !reflect.DeepEqual(result.Expr, tc.want) {
+				t.Errorf("expected %#v, got %#v", tc.want, result.Expr)
+			}
+		})
+	}
+}
+
 func TestTransformExpr_Assignment(t *testing.T) {
 	tr := New()
 	tr.SetType("x", ctypes.Int())
@@ -205,6 +250,42 @@ func TestTransformExpr_CompoundAssign(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_CompoundAssignConversions(t *testing.T) {
+	tr := New()
+	tr.SetType("i", ctypes.Int())
+	tr.SetType("l", ctypes.Long())
+	tr.SetType("d", ctypes.Double())
+	i := clight.Evar{Name: "i", Typ: ctypes.Int()}
+
+	tests := []struct {
+		name  string
+		op    cabs.BinaryOp
+		right string
+		want  clight.Expr
+	}{
+		{"int times-assign double", cabs.OpMulAssign, "d",
+			clight.Ecast{Arg: clight.Ebinop{Op: clight.Omul, Left: clight.Ecast{Arg: i, Typ: ctypes.Double()}, Right: clight.Evar{Name: "d", Typ: ctypes.Double()}, Typ: ctypes.Double()}, Typ: ctypes.Int()}},
+		{"int divide-assign long", cabs.OpDivAssign, "l",
+			clight.Ecast{Arg: clight.Ebinop{Op: clight.Odiv, Left: clight.Ecast{Arg: i, Typ: ctypes.Long()}, Right: clight.Evar{Name: "l", Typ: ctypes.Long()}, Typ: ctypes.Long()}, Typ: ctypes.Int()}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tr.TransformExpr(cabs.Binary{Op: tc.op, Left: cabs.Variable{Name: "i"}, Right: cabs.Variable{Name: tc.right}})
+			if len(result.Stmts) != 2 {
+				t.Fatalf("expected 2 statements, got %d", len(result.Stmts))
+			}
+			set, ok := result.Stmts[0].(clight.Sset)
+			if !ok {
+				t.Fatalf("expected Sset, got %T", result.Stmts[0])
+			}
+			if !reflect.DeepEqual(set.RHS, tc.want) {
+				t.Errorf("expected %#v, got %#v", tc.want, set.RHS)
+			}
+		})
+	}
+}
+
 func TestTransformExpr_FunctionCall(t *testing.T) {
 	tr := New()
 
@@ -236,6 +317,184 @@ func TestTransformExpr_FunctionCall(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_VoidFunctionCall(t *testing.T) {
+	tr := New()
+	tr.SetType("g", ctypes.Tfunction{Params: []ctypes.Type{ctypes.Int()}, Return: ctypes.Void()})
+
+	// g(1); has no result to keep
+	stmts := tr.TransformExprForEffects(cabs.Call{
+		Func: cabs.Variable{Name: "g"},
+		Args: []cabs.Expr{cabs.Constant{Value: 1}},
+	})
+	call, _ := findCall(t, stmts)
+	if call.Result != nil {
+		t.Errorf("expected no result, got $%d", *call.Result)
+	}
+	if len(tr.TempTypes()) != 0 {
+		t.Errorf("expected no temporaries, got %v", tr.TempTypes())
+	}
+
+	// Nor has c ? g(1) : g(2)
+	tr.SetType("c", ctypes.Int())
+	tr.TransformExprForEffects(cabs.Conditional{
+		Cond: cabs.Variable{Name: "c"},
+		Then: cabs.Call{Func: cabs.Variable{Name: "g"}, Args: []cabs.Expr{cabs.Constant{Value: 1}}},
+		Else: cabs.Call{Func: cabs.Variable{Name: "g"}, Args: []cabs.Expr{cabs.Constant{Value: 2}}},
+	})
+	if len(tr.TempTypes()) != 0 {
+		t.Errorf("expected no temporaries, got %v", tr.TempTypes())
+	}
+}
+
+func TestTransformExpr_BuiltinExpect(t *testing.T) {
+	tr := New()
+	tr.SetType("x", ctypes.Int())
+
+	// __builtin_expect(x, 0) is x, with no call
+	result := tr.TransformExpr(cabs.Call{
+		Func: cabs.Variable{Name: "__builtin_expect"},
+		Args: []cabs.Expr{cabs.Variable{Name: "x"}, cabs.Constant{Value: 0}},
+	})
+	if len(result.Stmts) != 0 {
+		t.Errorf("expected no statements, got %v", result.Stmts)
+	}
+	if v, ok := result.Expr.(clight.Evar); !ok || v.Name != "x" {
+		t.Errorf("expected x, got %#v", result.Expr)
+	}
+
+	// The side effects of the expression are kept: __builtin_expect(x++, 1)
+	result = tr.TransformExpr(cabs.Call{
+		Func: cabs.Variable{Name: "__builtin_expect"},
+		Args: []cabs.Expr{cabs.Unary{Op: cabs.OpPostInc, Expr: cabs.Variable{Name: "x"}}, cabs.Constant{Value: 1}},
+	})
+	if len(result.Stmts) == 0 {
+		t.Errorf("expected the increment of x to be kept")
+	}
+	for _, stmt := range result.Stmts {
+		if _, ok := stmt.(clight.Scall); ok {
+			t.Errorf("expected no call, got %v", stmt)
+		}
+	}
+}
+
+// findCall returns the single Scall in stmts and the statements before it.
+func findCall(t *testing.T, stmts []clight.Stmt) (clight.Scall, []clight.Stmt) {
+	t.Helper()
+	for i, stmt := range stmts {
+		if call, ok := stmt.(clight.Scall); ok {
+			return call, stmts[:i]
+		}
+	}
+	t.Fatal("expected Scall statement for function call")
+	return clight.Scall{}, nil
+}
+
+// setIndex returns the position of the Sset defining tempID, or -1.
+func setIndex(stmts []clight.Stmt, tempID int) int {
+	for i, stmt := range stmts {
+		if set, ok := stmt.(clight.Sset); ok && set.TempID == tempID {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestTransformExpr_CallArgSideEffects(t *testing.T) {
+	tests := []struct {
+		name string
+		args []cabs.Expr
+	}{
+		{
+			// f(i++, i++)
+			"two post-increments",
+			[]cabs.Expr{
+				cabs.Unary{Op: cabs.OpPostInc, Expr: cabs.Variable{Name: "i"}},
+				cabs.Unary{Op: cabs.OpPostInc, Expr: cabs.Variable{Name: "i"}},
+			},
+		},
+		{
+			// f(a = 1, a)
+			"assignment then read",
+			[]cabs.Expr{
+				cabs.Binary{Op: cabs.OpAssign, Left: cabs.Variable{Name: "a"}, Right: cabs.Constant{Value: 1}},
+				cabs.Variable{Name: "a"},
+			},
+		},
+		{
+			// f(a, a = 1)
+			"read then assignment",
+			[]cabs.Expr{
+				cabs.Variable{Name: "a"},
+				cabs.Binary{Op: cabs.OpAssign, Left: cabs.Variable{Name: "a"}, Right: cabs.Constant{Value: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := New()
+			result := tr.TransformExpr(cabs.Call{Func: cabs.Variable{Name: "f"}, Args: tt.args})
+			call, before := findCall(t, result.Stmts)
+			if len(call.Args) != len(tt.args) {
+				t.Fatalf("expected %d call args, got %d", len(tt.args), len(call.Args))
+			}
+
+			// Every argument except the last is followed by side effects, so it
+			// must be a temp captured before the next argument's statements.
+			seen := make(map[int]bool)
+			prev := -1
+			for i, arg := range call.Args[:len(call.Args)-1] {
+				tmp, ok := arg.(clight.Etempvar)
+				if !ok {
+					t.Fatalf("arg %d: expected Etempvar, got %T", i, arg)
+				}
+				if seen[tmp.ID] {
+					t.Errorf("arg %d: temp $%d reused", i, tmp.ID)
+				}
+				seen[tmp.ID] = true
+				idx := setIndex(before, tmp.ID)
+				if idx < 0 {
+					t.Fatalf("arg %d: no Sset for temp $%d before call", i, tmp.ID)
+				}
+				if idx <= prev {
+					t.Errorf("arg %d: temp $%d set out of order", i, tmp.ID)
+				}
+				prev = idx
+			}
+
+			// The final argument's side effects run after all earlier captures
+			lastAssign := -1
+			for i, stmt := range before {
+				if _, ok := stmt.(clight.Sassign); ok {
+					lastAssign = i
+				}
+			}
+			if lastAssign < prev {
+				t.Errorf("expected last argument's assignment after earlier captures")
+			}
+		})
+	}
+}
+
+func TestTransformExpr_CallArgsNoCaptureWithoutSideEffects(t *testing.T) {
+	tr := New()
+
+	// f(a, b): no side effects, so arguments are passed directly
+	result := tr.TransformExpr(cabs.Call{
+		Func: cabs.Variable{Name: "f"},
+		Args: []cabs.Expr{cabs.Variable{Name: "a"}, cabs.Variable{Name: "b"}},
+	})
+	call, before := findCall(t, result.Stmts)
+	if len(before) != 0 {
+		t.Errorf("expected no statements before call, got %d", len(before))
+	}
+	for i, arg := range call.Args {
+		if _, ok := arg.(clight.Evar); !ok {
+			t.Errorf("arg %d: expected Evar, got %T", i, arg)
+		}
+	}
+}
+
 func TestTransformExpr_Comma(t *testing.T) {
 	tr := New()
 	tr.SetType("x", ctypes.Int())
@@ -257,6 +516,40 @@ func TestTransformExpr_Comma(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_CommaEffects(t *testing.T) {
+	tr := New()
+	tr.SetType("x", ctypes.Int())
+	tr.SetType("p", ctypes.Pointer(ctypes.Int()))
+	tr.SetQualifiers("p", ctypes.Qualifiers{{}, {Volatile: true}})
+
+	// (f(), x) calls f, then yields x
+	result := tr.TransformExpr(cabs.Binary{
+		Op:    cabs.OpComma,
+		Left:  cabs.Call{Func: cabs.Variable{Name: "f"}},
+		Right: cabs.Variable{Name: "x"},
+	})
+	findCall(t, result.Stmts)
+	if v, ok := result.Expr.(clight.Evar); !ok || v.Name != "x" {
+		t.Errorf("expected x as the result, got %#v", result.Expr)
+	}
+
+	// (*p, x) still reads the volatile *p
+	result = tr.TransformExpr(cabs.Binary{
+		Op:    cabs.OpComma,
+		Left:  cabs.Unary{Op: cabs.OpDeref, Expr: cabs.Variable{Name: "p"}},
+		Right: cabs.Variable{Name: "x"},
+	})
+	if len(result.Stmts) != 1 {
+		t.Fatalf("expected 1 statement, got %#v", result.Stmts)
+	}
+	if set, ok := result.Stmts[0].(clight.Sset); !ok || !set.RHS.(clight.Ederef).Volatile {
+		t.Errorf("expected the volatile read assigned to a temp, got %#v", result.Stmts[0])
+	}
+	if v, ok := result.Expr.(clight.Evar); !ok || v.Name != "x" {
+		t.Errorf("expected x as the result, got %#v", result.Expr)
+	}
+}
+
 func TestTransformExpr_Conditional(t *testing.T) {
 	tr := New()
 	tr.SetType("x", ctypes.Int())
@@ -287,6 +580,54 @@ func TestTransformExpr_Conditional(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_ConditionalResultType(t *testing.T) {
+	intPtr := ctypes.Pointer(ctypes.Int())
+	voidPtr := ctypes.Pointer(ctypes.Void())
+	pair := ctypes.Tstruct{Name: "pair", Fields: []ctypes.Field{{Name: "a", Type: ctypes.Int()}, {Name: "b", Type: ctypes.Int()}}}
+	tests := []struct {
+		name       string
+		then, els  ctypes.Type
+		thenIsZero bool
+		elseIsZero bool
+		want       ctypes.Type
+	}{
+		{"two int pointers", intPtr, intPtr, false, false, intPtr},
+		{"pointer and null", intPtr, ctypes.Int(), false, true, intPtr},
+		{"null and pointer", ctypes.Int(), intPtr, true, false, intPtr},
+		{"pointer and void pointer", intPtr, voidPtr, false, false, voidPtr},
+		{"array and pointer", ctypes.Tarray{Elem: ctypes.Int(), Size: 4}, intPtr, false, false, intPtr},
+		{"int and long", ctypes.Int(), ctypes.Long(), false, false, ctypes.Long()},
+		{"structs", pair, pair, false, false, pair},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := New()
+			tr.SetType("c", ctypes.Int())
+			tr.SetType("p", tt.then)
+			tr.SetType("q", tt.els)
+			var then, els cabs.Expr = cabs.Variable{Name: "p"}, cabs.Variable{Name: "q"}
+			if tt.thenIsZero {
+				then = cabs.Constant{Value: 0}
+			}
+			if tt.elseIsZero {
+				els = cabs.Constant{Value: 0}
+			}
+
+			result := tr.TransformExpr(cabs.Conditional{Cond: cabs.Variable{Name: "c"}, Then: then, Else: els})
+			temp, ok := result.Expr.(clight.Etempvar)
+			if !ok {
+				t.Fatalf("expected Etempvar, got %T", result.Expr)
+			}
+			if !ctypes.Equal(temp.Typ, tt.want) {
+				t.Errorf("result type = %v, want %v", temp.Typ, tt.want)
+			}
+			if temps := tr.TempTypes(); !ctypes.Equal(temps[len(temps)-1], tt.want) {
+				t.Errorf("temp declared as %v, want %v", temps[len(temps)-1], tt.want)
+			}
+		})
+	}
+}
+
 func TestTransformExpr_NestedSideEffects(t *testing.T) {
 	tr := New()
 	tr.SetType("x", ctypes.Int())
@@ -419,6 +760,98 @@ func TestTransformExpr_Deref(t *testing.T) {
 	}
 }
 
+func TestTransformExpr_VolatileDeref(t *testing.T) {
+	tr := New()
+	tr.SetType("p", ctypes.Pointer(ctypes.Int()))
+	tr.SetType("q", ctypes.Pointer(ctypes.Int()))
+	// volatile int *p; int *volatile q;
+	tr.SetQualifiers("p", ctypes.Qualifiers{{}, {Volatile: true}})
+	tr.SetQualifiers("q", ctypes.Qualifiers{{Volatile: true}})
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"p", true},
+		{"q", false},
+	}
+	for _, tt := range tests {
+		result := tr.TransformExpr(cabs.Unary{Op: cabs.OpDeref, Expr: cabs.Variable{Name: tt.name}})
+		deref, ok := result.Expr.(clight.Ederef)
+		if !ok {
+			t.Fatalf("*%s: expected Ederef, got %T", tt.name, result.Expr)
+		}
+		if deref.Volatile != tt.want {
+			t.Errorf("*%s: expected Volatile %v, got %v", tt.name, tt.want, deref.Volatile)
+		}
+	}
+}
+
+func TestTransformExprForEffects_Volatile(t *testing.T) {
+	tr := New()
+	tr.SetType("p", ctypes.Pointer(ctypes.Int()))
+	tr.SetType("q", ctypes.Pointer(ctypes.Int()))
+	tr.SetQualifiers("p", ctypes.Qualifiers{{}, {Volatile: true}})
+
+	// *p; reads a volatile object, so the read is kept
+	stmts := tr.TransformExprForEffects(cabs.Unary{Op: cabs.OpDeref, Expr: cabs.Variable{Name: "p"}})
+	if len(stmts) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(stmts))
+	}
+	if set, ok := stmts[0].(clight.Sset); !ok || !set.RHS.(clight.Ederef).Volatile {
+		t.Errorf("expected the volatile read assigned to a temp, got %#v", stmts[0])
+	}
+
+	// *q; has no effect
+	if stmts := tr.TransformExprForEffects(cabs.Unary{Op: cabs.OpDeref, Expr: cabs.Variable{Name: "q"}}); len(stmts) != 0 {
+		t.Errorf("expected no statements, got %#v", stmts)
+	}
+}
+
+func TestTransformExpr_WideLiterals(t *testing.T) {
+	tr := New()
+
+	// L"ab" is an array of 4-byte wchar_t, a signed int, with the
+	// terminator
+	str := tr.TransformExpr(cabs.StringLiteral{Value: "ab", Encoding: "L"}).Expr.(clight.Estring)
+	if !ctypes.Equal(str.Typ, ctypes.Array(ctypes.Int(), 3)) {
+		t.Errorf("expected wchar_t[3], got %#v", str.Typ)
+	}
+	if want := "a\x00\x00\x00b\x00\x00\x00"; str.Value != want {
+		t.Errorf("expected %q, got %q", want, str.Value)
+	}
+
+	// u"\u00e9" is UTF-16
+	str = tr.TransformExpr(cabs.StringLiteral{Value: "\u00e9", Encoding: "u"}).Expr.(clight.Estring)
+	if want := "\xe9\x00"; str.Value != want {
+		t.Errorf("expected %q, got %q", want, str.Value)
+	}
+
+	// u8"ab" is a plain char string
+	str = tr.TransformExpr(cabs.StringLiteral{Value: "ab", Encoding: "u8"}).Expr.(clight.Estring)
+	if !ctypes.Equal(str.Typ, ctypes.Array(ctypes.Char(), 3)) || str.Value != "ab" {
+		t.Errorf("expected plain string, got %#v", str)
+	}
+
+	// sizeof L"abc" is the size of four wchar_t
+	size := tr.TransformExpr(cabs.SizeofExpr{Expr: cabs.StringLiteral{Value: "abc", Encoding: "L"}}).Expr.(clight.Esizeof)
+	if !ctypes.Equal(size.ArgType, ctypes.Array(ctypes.Int(), 4)) {
+		t.Errorf("expected sizeof of wchar_t[4], got %#v", size.ArgType)
+	}
+
+	// L'x' is a wchar_t
+	c := tr.TransformExpr(cabs.CharLiteral{Value: "x", Encoding: "L"}).Expr.(clight.Econst_int)
+	if !ctypes.Equal(c.Typ, ctypes.Int()) {
+		t.Errorf("expected L'x' of type wchar_t, got %#v", c)
+	}
+
+	// U'\u00e9' is the code point, typed char32_t
+	c = tr.TransformExpr(cabs.CharLiteral{Value: "\u00e9", Encoding: "U"}).Expr.(clight.Econst_int)
+	if c.Value != 0xe9 || !ctypes.Equal(c.Typ, ctypes.UInt()) {
+		t.Errorf("expected 0xe9 of type char32_t, got %#v", c)
+	}
+}
+
 func TestReset(t *testing.T) {
 	tr := New()
 
@@ -514,3 +947,134 @@ func TestTransformExpr_IntegerPromotion(t *testing.T) {
 		t.Errorf("expected result type %v, got %v", expectedType, binExpr.Typ)
 	}
 }
+
+func TestTransformExpr_ConstantTypes(t *testing.T) {
+	tests := []struct {
+		constant cabs.Constant
+		want     ctypes.Type
+	}{
+		{cabs.Constant{Value: 1}, ctypes.Int()},
+		{cabs.Constant{Value: 1 << 40}, ctypes.Long()},
+		{cabs.Constant{Value: 1, Type: "unsigned int"}, ctypes.UInt()},
+		{cabs.Constant{Value: 1, Type: "long"}, ctypes.Long()},
+		{cabs.Constant{Value: -1, Type: "unsigned long"}, ctypes.Tlong{Sign: ctypes.Unsigned}},
+	}
+
+	tr := New()
+	for _, tt := range tests {
+		result := tr.TransformExpr(tt.constant)
+		c, ok := result.Expr.(clight.Econst_int)
+		if !ok {
+			t.Fatalf("%#v: expected Econst_int, got %T", tt.constant, result.Expr)
+		}
+		if c.Value != tt.constant.Value || !ctypes.Equal(c.Typ, tt.want) {
+			t.Errorf("%#v: got %d of type %v, want type %v", tt.constant, c.Value, c.Typ, tt.want)
+		}
+	}
+}
+
+func TestTransformExpr_VaArg(t *testing.T) {
+	tr := New()
+	tr.SetType("ap", ctypes.VaList())
+
+	result := tr.TransformExpr(cabs.VaArg{Expr: cabs.Variable{Name: "ap"}, TypeName: "long"})
+
+	// The argument address is picked from the register save area or the stack
+	if len(result.Stmts) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(result.Stmts))
+	}
+	ite, ok := result.Stmts[0].(clight.Sifthenelse)
+	if !ok {
+		t.Fatalf("expected Sifthenelse, got %T", result.Stmts[0])
+	}
+	if cond, ok := ite.Cond.(clight.Ebinop); !ok || cond.Op != clight.Olt {
+		t.Errorf("expected __gr_offs < 0 test, got %#v", ite.Cond)
+	}
+	deref, ok := result.Expr.(clight.Ederef)
+	if !ok {
+		t.Fatalf("expected Ederef, got %T", result.Expr)
+	}
+	if !ctypes.Equal(deref.Typ, ctypes.Long()) {
+		t.Errorf("expected long result, got %v", deref.Typ)
+	}
+}
+
+func TestTransformExpr_SizeofTypeName(t *testing.T) {
+	tests := []struct {
+		typeName string
+		want     ctypes.Type
+	}{
+		{"int *", ctypes.Pointer(ctypes.Int())},
+		{"int[10]", ctypes.Array(ctypes.Int(), 10)},
+		{"int *[3]", ctypes.Array(ctypes.Pointer(ctypes.Int()), 3)},
+		{"int (*)[3]", ctypes.Pointer(ctypes.Array(ctypes.Int(), 3))},
+		{"int[2][3]", ctypes.Array(ctypes.Array(ctypes.Int(), 3), 2)},
+		{"int (*)(int, long)", ctypes.Pointer(ctypes.Tfunction{Params: []ctypes.Type{ctypes.Int(), ctypes.Long()}, Return: ctypes.Int()})},
+		{"unsigned long(*)(unsigned long, const char* const)", ctypes.Pointer(ctypes.Tfunction{
+			Params: []ctypes.Type{ctypes.Tlong{Sign: ctypes.Unsigned}, ctypes.Pointer(ctypes.Char())},
+			Return: ctypes.Tlong{Sign: ctypes.Unsigned},
+		})},
+		{"const volatile int", ctypes.Int()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typeName, func(t *testing.T) {
+			tr := New()
+			result := tr.TransformExpr(cabs.SizeofType{TypeName: tt.typeName})
+			sizeof, ok := result.Expr.(clight.Esizeof)
+			if !ok {
+				t.Fatalf("expected Esizeof, got %T", result.Expr)
+			}
+			if !ctypes.Equal(sizeof.ArgType, tt.want) {
+				t.Errorf("expected type %v, got %v", tt.want, sizeof.ArgType)
+			}
+		})
+	}
+}
+
+func TestTransformExpr_SizeofIsSizeT(t *testing.T) {
+	tr := New()
+	tr.SetType("x", ctypes.Int())
+
+	// sizeof(int) * 2 is computed in unsigned long, as sizeof yields size_t
+	result := tr.TransformExpr(cabs.Binary{Op: cabs.OpMul, Left: cabs.SizeofType{TypeName: "int"}, Right: cabs.Constant{Value: 2}})
+	mul, ok := result.Expr.(clight.Ebinop)
+	if !ok {
+		t.Fatalf("expected Ebinop, got %T", result.Expr)
+	}
+	if !ctypes.Equal(mul.Left.ExprType(), ctypes.SizeT()) {
+		t.Errorf("expected sizeof to have type size_t, got %v", mul.Left.ExprType())
+	}
+	if !ctypes.Equal(mul.Typ, ctypes.ULong()) {
+		t.Errorf("expected unsigned long product, got %v", mul.Typ)
+	}
+
+	// sizeof x has the same type
+	result = tr.TransformExpr(cabs.SizeofExpr{Expr: cabs.Variable{Name: "x"}})
+	if !ctypes.Equal(result.Expr.ExprType(), ctypes.SizeT()) {
+		t.Errorf("expected sizeof x to have type size_t, got %v", result.Expr.ExprType())
+	}
+
+	// An array plus a size is still a pointer, and the difference of two
+	// pointers a long
+	tr.SetType("a", ctypes.Array(ctypes.Int(), 6))
+	end := cabs.Binary{Op: cabs.OpAdd, Left: cabs.Variable{Name: "a"}, Right: cabs.SizeofType{TypeName: "int"}}
+	result = tr.TransformExpr(end)
+	if want := ctypes.Pointer(ctypes.Int()); !ctypes.Equal(result.Expr.ExprType(), want) {
+		t.Errorf("expected a + sizeof(int) to have type %v, got %v", want, result.Expr.ExprType())
+	}
+	result = tr.TransformExpr(cabs.Binary{Op: cabs.OpSub, Left: end, Right: cabs.Variable{Name: "a"}})
+	if !ctypes.Equal(result.Expr.ExprType(), ctypes.Long()) {
+		t.Errorf("expected a pointer difference to be long, got %v", result.Expr.ExprType())
+	}
+}
+
+func TestTransformExpr_SizeofTypedef(t *testing.T) {
+	tr := New()
+	tr.SetTypedef("real", ctypes.Double())
+
+	result := tr.TransformExpr(cabs.SizeofType{TypeName: "real *[2]"})
+	want := ctypes.Array(ctypes.Pointer(ctypes.Double()), 2)
+	if sizeof, ok := result.Expr.(clight.Esizeof); !ok || !ctypes.Equal(sizeof.ArgType, want) {
+		t.Errorf("expected sizeof(%v), got %#v", want, result.Expr)
+	}
+}
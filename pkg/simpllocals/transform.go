@@ -102,6 +102,14 @@ func (t *Transformer) AnalyzeAddressTaken(e cabs.Expr) {
 	case cabs.SizeofExpr:
 		// sizeof doesn't evaluate, but we still scan for consistency
 		t.AnalyzeAddressTaken(expr.Expr)
+
+	case cabs.StmtExpr:
+		if expr.Block != nil {
+			t.AnalyzeStmt(expr.Block)
+		}
+		if expr.Result != nil {
+			t.AnalyzeAddressTaken(expr.Result)
+		}
 	}
 }
 
@@ -232,8 +240,9 @@ func (t *Transformer) TransformExpr(e clight.Expr) clight.Expr {
 
 	case clight.Ederef:
 		return clight.Ederef{
-			Ptr: t.TransformExpr(expr.Ptr),
-			Typ: expr.Typ,
+			Ptr:      t.TransformExpr(expr.Ptr),
+			Typ:      expr.Typ,
+			Volatile: expr.Volatile,
 		}
 
 	case clight.Eaddrof:
@@ -268,6 +277,7 @@ func (t *Transformer) TransformExpr(e clight.Expr) clight.Expr {
 			Arg:       t.TransformExpr(expr.Arg),
 			FieldName: expr.FieldName,
 			Typ:       expr.Typ,
+			Volatile:  expr.Volatile,
 		}
 
 	default:
@@ -284,14 +294,15 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 
 		// If LHS is now a tempvar, convert to Sset
 		if tv, ok := lhs.(clight.Etempvar); ok {
-			return clight.Sset{TempID: tv.ID, RHS: rhs}
+			return clight.Sset{TempID: tv.ID, RHS: rhs, Pos: stmt.Pos}
 		}
-		return clight.Sassign{LHS: lhs, RHS: rhs}
+		return clight.Sassign{LHS: lhs, RHS: rhs, Pos: stmt.Pos}
 
 	case clight.Sset:
 		return clight.Sset{
 			TempID: stmt.TempID,
 			RHS:    t.TransformExpr(stmt.RHS),
+			Pos:    stmt.Pos,
 		}
 
 	case clight.Scall:
@@ -303,6 +314,7 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 			Result: stmt.Result,
 			Func:   t.TransformExpr(stmt.Func),
 			Args:   newArgs,
+			Pos:    stmt.Pos,
 		}
 
 	case clight.Sbuiltin:
@@ -314,6 +326,7 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 			Result:  stmt.Result,
 			Builtin: stmt.Builtin,
 			Args:    newArgs,
+			Pos:     stmt.Pos,
 		}
 
 	case clight.Ssequence:
@@ -327,6 +340,7 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 			Cond: t.TransformExpr(stmt.Cond),
 			Then: t.TransformStmt(stmt.Then),
 			Else: t.TransformStmt(stmt.Else),
+			Pos:  stmt.Pos,
 		}
 
 	case clight.Sloop:
@@ -337,7 +351,7 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 
 	case clight.Sreturn:
 		if stmt.Value != nil {
-			return clight.Sreturn{Value: t.TransformExpr(stmt.Value)}
+			return clight.Sreturn{Value: t.TransformExpr(stmt.Value), Pos: stmt.Pos}
 		}
 		return stmt
 
@@ -354,12 +368,14 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 			Cases:    newCases,
 			Default:  t.TransformStmt(stmt.Default),
 			HasBreak: stmt.HasBreak,
+			Pos:      stmt.Pos,
 		}
 
 	case clight.Slabel:
 		return clight.Slabel{
 			Label: stmt.Label,
 			Stmt:  t.TransformStmt(stmt.Stmt),
+			Pos:   stmt.Pos,
 		}
 
 	default:
@@ -371,6 +387,7 @@ func (t *Transformer) TransformStmt(s clight.Stmt) clight.Stmt {
 type LocalInfo struct {
 	Name         string
 	Type         ctypes.Type
+	Quals        ctypes.Qualifiers
 	AddressTaken bool
 	Promoted     bool
 	TempID       int
@@ -384,12 +401,14 @@ func (t *Transformer) AnalyzeLocals(decls []clight.VarDecl) []LocalInfo {
 		info := LocalInfo{
 			Name:         decl.Name,
 			Type:         decl.Type,
+			Quals:        decl.Quals,
 			AddressTaken: t.addressTaken[decl.Name],
 			Promoted:     false,
 			TempID:       -1,
 		}
 
-		if t.CanPromoteToTemp(decl.Name, decl.Type) {
+		// Volatile locals stay in memory so every access is a real load or store
+		if t.CanPromoteToTemp(decl.Name, decl.Type) && !decl.Quals.At(0).Volatile {
 			info.Promoted = true
 			info.TempID = t.PromoteLocal(decl.Name, decl.Type)
 		}
@@ -405,8 +424,9 @@ func FilterUnpromotedLocals(infos []LocalInfo) []clight.VarDecl {
 	for _, info := range infos {
 		if !info.Promoted {
 			result = append(result, clight.VarDecl{
-				Name: info.Name,
-				Type: info.Type,
+				Name:  info.Name,
+				Type:  info.Type,
+				Quals: info.Quals,
 			})
 		}
 	}
@@ -18,6 +18,8 @@ const (
 //	+---------------------------+  <- FP points here (after setup)
 //	| Callee-saved registers    |  negative offsets from FP
 //	| Local variables           |
+//	| Stack-allocated variables |  Oaddrstack/Ainstack offsets
+//	| Argument register save    |  only in functions using va_start
 //	| Outgoing arguments        |
 //	+---------------------------+  <- SP (16-byte aligned)
 //
@@ -26,14 +28,18 @@ const (
 // FrameLayout describes the concrete stack frame layout
 type FrameLayout struct {
 	// Sizes for each section (in bytes)
-	CalleeSaveSize int64 // space for callee-saved registers
-	LocalSize      int64 // space for local variables
-	OutgoingSize   int64 // space for outgoing call arguments
+	CalleeSaveSize  int64 // space for callee-saved registers
+	LocalSize       int64 // space for local variables
+	StackDataSize   int64 // space for stack-allocated variables
+	VarArgsSaveSize int64 // space for X0-X7 saved on entry for va_start
+	OutgoingSize    int64 // space for outgoing call arguments
 
 	// Computed offsets (from FP)
-	CalleeSaveOffset int64 // start of callee-save area (negative)
-	LocalOffset      int64 // start of locals area (negative)
-	OutgoingOffset   int64 // start of outgoing area (negative)
+	CalleeSaveOffset  int64 // start of callee-save area (negative)
+	LocalOffset       int64 // start of locals area (negative)
+	StackDataOffset   int64 // start of stack-allocated variables (negative)
+	VarArgsSaveOffset int64 // start of argument register save area (negative)
+	OutgoingOffset    int64 // start of outgoing area (negative)
 
 	// Total frame size (SP decrement from old SP)
 	TotalSize int64
@@ -62,6 +68,14 @@ func ComputeLayout(fn *linear.Function, calleeSaveRegs int) *FrameLayout {
 	// Local variable area
 	layout.LocalSize = alignUp(info.LocalSize, 8)
 
+	// Variables whose address is taken, laid out by Cminorgen
+	layout.StackDataSize = alignUp(fn.StackData, 8)
+
+	// Argument register save area, read through the va_list
+	if usesVaStart(fn) {
+		layout.VarArgsSaveSize = int64(len(intArgRegs)) * pointerSize
+	}
+
 	// Outgoing argument area
 	layout.OutgoingSize = alignUp(info.OutgoingSize, 8)
 
@@ -79,13 +93,19 @@ func ComputeLayout(fn *linear.Function, calleeSaveRegs int) *FrameLayout {
 	// Local variables come below callee-saves (more negative from FP)
 	layout.LocalOffset = -layout.CalleeSaveSize - layout.LocalSize
 
+	// Stack-allocated variables, then the argument register save area,
+	// come below the locals
+	layout.StackDataOffset = layout.LocalOffset - layout.StackDataSize
+	layout.VarArgsSaveOffset = layout.StackDataOffset - layout.VarArgsSaveSize
+
 	// Outgoing arguments at the bottom of frame (lowest addresses, near SP)
 	// These are accessed relative to SP, not FP, so we compute the FP-relative offset
-	layout.OutgoingOffset = -layout.CalleeSaveSize - layout.LocalSize - layout.OutgoingSize
+	layout.OutgoingOffset = layout.VarArgsSaveOffset - layout.OutgoingSize
 
 	// Total frame size: includes FP/LR save area (16 bytes) plus our sections
 	// This is the amount SP is decremented from old SP
-	frameBody := layout.CalleeSaveSize + layout.LocalSize + layout.OutgoingSize
+	frameBody := layout.CalleeSaveSize + layout.LocalSize + layout.StackDataSize +
+		layout.VarArgsSaveSize + layout.OutgoingSize
 	frameBody = alignUp(frameBody, stackAlignment) // ensure 16-byte alignment
 
 	// Total includes the saved FP and LR (16 bytes)
@@ -117,6 +137,17 @@ func (l *FrameLayout) IncomingSlotOffset(slotOffset int64) int64 {
 	return 16 + slotOffset
 }
 
+// usesVaStart reports whether fn calls va_start, and so must save its
+// argument registers on entry.
+func usesVaStart(fn *linear.Function) bool {
+	for _, inst := range fn.Code {
+		if b, ok := inst.(linear.Lbuiltin); ok && b.Builtin == "va_start" {
+			return true
+		}
+	}
+	return false
+}
+
 // stackInfo holds collected info about stack usage
 type stackInfo struct {
 	LocalSize    int64
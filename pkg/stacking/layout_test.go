@@ -149,6 +149,39 @@ func TestComputeLayoutOffsets(t *testing.T) {
 	}
 }
 
+func TestComputeLayoutStackDataAndVarArgs(t *testing.T) {
+	fn := linear.NewFunction("variadic", linear.Sig{})
+	fn.StackData = 20 // e.g. a va_list and an int
+	fn.Append(linear.Lgetstack{
+		Slot: linear.SlotLocal,
+		Ofs:  0,
+		Ty:   linear.Tlong,
+		Dest: ltl.X0,
+	})
+	fn.Append(linear.Lbuiltin{Builtin: "va_start", Args: []linear.Loc{ltl.R{Reg: ltl.X0}}})
+
+	layout := ComputeLayout(fn, 0)
+
+	// Stack data is rounded up to 8 bytes and sits below the locals
+	if layout.StackDataSize != 24 {
+		t.Errorf("StackDataSize = %d, want 24", layout.StackDataSize)
+	}
+	if layout.StackDataOffset != -32 {
+		t.Errorf("StackDataOffset = %d, want -32", layout.StackDataOffset)
+	}
+	// X0-X7 are saved below the stack data
+	if layout.VarArgsSaveSize != 64 {
+		t.Errorf("VarArgsSaveSize = %d, want 64", layout.VarArgsSaveSize)
+	}
+	if layout.VarArgsSaveOffset != -96 {
+		t.Errorf("VarArgsSaveOffset = %d, want -96", layout.VarArgsSaveOffset)
+	}
+	// Body is 8 + 24 + 64 = 96; total = 16 (FP/LR) + 96 = 112
+	if layout.TotalSize != 112 {
+		t.Errorf("TotalSize = %d, want 112", layout.TotalSize)
+	}
+}
+
 func TestLocalSlotOffset(t *testing.T) {
 	fn := linear.NewFunction("test", linear.Sig{})
 	fn.Append(linear.Lgetstack{
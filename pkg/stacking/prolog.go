@@ -18,6 +18,7 @@ const (
 //  2. Set up new FP
 //  3. Allocate stack frame
 //  4. Save callee-saved registers
+//  5. Save the argument registers, if va_start needs them
 func GeneratePrologue(layout *FrameLayout, calleeSave *CalleeSaveInfo) []mach.Instruction {
 	var prologue []mach.Instruction
 
@@ -78,6 +79,17 @@ func GeneratePrologue(layout *FrameLayout, calleeSave *CalleeSaveInfo) []mach.In
 		})
 	}
 
+	// 5. Save X0-X7 so va_start can find the variable arguments
+	if layout.VarArgsSaveSize > 0 {
+		for i, reg := range intArgRegs {
+			prologue = append(prologue, mach.Msetstack{
+				Src: reg,
+				Ofs: layout.VarArgsSaveOffset + int64(i)*pointerSize,
+				Ty:  ltl.Tlong,
+			})
+		}
+	}
+
 	return prologue
 }
 
@@ -160,11 +172,32 @@ func IsLeafFunction(code []mach.Instruction) bool {
 // ARM64 argument registers (X0-X7 for integers)
 var intArgRegs = []ltl.MReg{ltl.X0, ltl.X1, ltl.X2, ltl.X3, ltl.X4, ltl.X5, ltl.X6, ltl.X7}
 
-// X8 is a good temp register - it's caller-saved and not used for argument passing
-const paramCopyTempReg = ltl.X8
+// resultPtrReg is where the hidden result pointer of an Sret function arrives
+const resultPtrReg = ltl.X8
+
+// X17 is a good temp register - it's never allocated and not used for argument passing
+const paramCopyTempReg = ltl.X17
+
+// incomingParamReg returns the register in which the i-th parameter of a
+// function with the given signature arrives, or false if it arrives on the
+// stack. The hidden result pointer of an Sret function is not counted
+// among the argument registers.
+func incomingParamReg(sig mach.Sig, i int) (ltl.MReg, bool) {
+	if sig.Sret {
+		if i == 0 {
+			return resultPtrReg, true
+		}
+		i--
+	}
+	if i >= len(intArgRegs) {
+		return 0, false
+	}
+	return intArgRegs[i], true
+}
 
 // GenerateParamCopies generates move instructions to copy incoming parameters
-// from their ABI-specified locations (X0, X1, etc.) to their allocated locations.
+// from their ABI-specified locations (X0, X1, etc., and X8 for the hidden result
+// pointer) to their allocated locations.
 // This must be emitted after the prologue, before the function body.
 //
 // Handles the parallel move problem: when parameters are allocated to registers
@@ -173,18 +206,17 @@ const paramCopyTempReg = ltl.X8
 //
 // The slotTrans parameter is used to translate abstract stack slot offsets to
 // concrete FP-relative offsets when parameters are spilled to the stack.
-func GenerateParamCopies(params []ltl.Loc, slotTrans *SlotTranslator) []mach.Instruction {
+func GenerateParamCopies(sig mach.Sig, params []ltl.Loc, slotTrans *SlotTranslator) []mach.Instruction {
 	// Build a map of moves needed: dest -> src (incoming reg)
 	moves := make(map[ltl.MReg]ltl.MReg)
 	var stackMoves []mach.Instruction
 
 	for i, paramLoc := range params {
-		if i >= len(intArgRegs) {
+		incomingReg, ok := incomingParamReg(sig, i)
+		if !ok {
 			break
 		}
 
-		incomingReg := intArgRegs[i]
-
 		switch loc := paramLoc.(type) {
 		case ltl.R:
 			if loc.Reg != incomingReg {
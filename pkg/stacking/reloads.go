@@ -0,0 +1,107 @@
+package stacking
+
+import (
+	"github.com/raymyers/ralph-cc/pkg/mach"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// Spilled values live in stack slots and are reloaded into the stacking
+// temporaries before every use, so consecutive uses of a spilled value
+// load the same slot again and again. RemoveRedundantReloads walks each
+// straight-line run of code remembering which slot each temporary holds,
+// whether loaded from the slot or just stored to it, and drops a reload
+// the temporary already satisfies. A reload into the other temporary
+// becomes a register move. Only the temporaries are tracked: the register
+// allocator never assigns them, so nothing else writes them behind our
+// back but the scratch of an operation or of an address, see
+// mach.ScratchReg and mach.AddressScratchReg. Labels, calls and builtins
+// end the run.
+
+// heldSlot identifies the value of a stack slot or incoming parameter.
+type heldSlot struct {
+	param bool
+	ofs   int64
+	ty    mach.Typ
+}
+
+// RemoveRedundantReloads removes reloads of stack slots whose value is
+// still in a temporary register.
+func RemoveRedundantReloads(fn *mach.Function) {
+	held := make(map[mach.MReg]heldSlot)
+	code := fn.Code[:0]
+	for _, inst := range fn.Code {
+		switch i := inst.(type) {
+		case mach.Mgetstack:
+			inst = reuseHeld(held, heldSlot{ofs: i.Ofs, ty: i.Ty}, i.Dest, inst)
+		case mach.Mgetparam:
+			inst = reuseHeld(held, heldSlot{param: true, ofs: i.Ofs, ty: i.Ty}, i.Dest, inst)
+		case mach.Msetstack:
+			end := i.Ofs + slotSize(i.Ty)
+			for r, s := range held {
+				if !s.param && s.ofs < end && i.Ofs < s.ofs+slotSize(s.ty) {
+					delete(held, r)
+				}
+			}
+			if isStackingTemp(i.Src) {
+				held[i.Src] = heldSlot{ofs: i.Ofs, ty: i.Ty}
+			}
+		case mach.Mop:
+			// A move passes on the slot its source holds
+			slot, ok := heldSlot{}, false
+			if _, isMove := i.Op.(rtl.Omove); isMove && len(i.Args) == 1 {
+				slot, ok = held[i.Args[0]]
+			}
+			delete(held, i.Dest)
+			if mach.NeedsScratch(i.Op) {
+				delete(held, mach.ScratchReg(i.Args))
+			}
+			if ok && isStackingTemp(i.Dest) {
+				held[i.Dest] = slot
+			}
+		case mach.Mload:
+			delete(held, i.Dest)
+			if mach.NeedsAddressScratch(i.Addr, i.Chunk) {
+				delete(held, mach.AddressScratchReg(i))
+			}
+		case mach.Mstore:
+			if mach.NeedsAddressScratch(i.Addr, i.Chunk) {
+				delete(held, mach.AddressScratchReg(i))
+			}
+		case mach.Mlabel, mach.Mcall, mach.Mtailcall, mach.Mbuiltin:
+			clear(held)
+		}
+		if inst != nil {
+			code = append(code, inst)
+		}
+	}
+	fn.Code = code
+}
+
+// reuseHeld returns the instruction that loads slot into dest: nothing if
+// dest already holds it, a move if the other temporary does, otherwise the
+// load itself. It updates held accordingly.
+func reuseHeld(held map[mach.MReg]heldSlot, slot heldSlot, dest mach.MReg, load mach.Instruction) mach.Instruction {
+	if s, ok := held[dest]; ok && s == slot {
+		return nil
+	}
+	delete(held, dest)
+	if !isStackingTemp(dest) {
+		return load
+	}
+	held[dest] = slot
+	for r, s := range held {
+		if r != dest && s == slot {
+			return mach.Mop{Op: rtl.Omove{}, Args: []mach.MReg{r}, Dest: dest}
+		}
+	}
+	return load
+}
+
+func isStackingTemp(r mach.MReg) bool {
+	for _, t := range stackingTempRegs {
+		if r == t {
+			return true
+		}
+	}
+	return false
+}
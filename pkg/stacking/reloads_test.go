@@ -0,0 +1,136 @@
+package stacking
+
+import (
+	"testing"
+
+	"github.com/raymyers/ralph-cc/pkg/linear"
+	"github.com/raymyers/ralph-cc/pkg/ltl"
+	"github.com/raymyers/ralph-cc/pkg/mach"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
+)
+
+// countReloads counts the loads of stack slots in the body of a function,
+// skipping the prologue and epilogue, which load nothing into X16/X17.
+func countReloads(fn *mach.Function) int {
+	n := 0
+	for _, inst := range fn.Code {
+		if g, ok := inst.(mach.Mgetstack); ok && isStackingTemp(g.Dest) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSpilledValueReloadedOnce(t *testing.T) {
+	spilled := linear.S{Slot: linear.SlotLocal, Ofs: 0, Ty: linear.Tint}
+	fn := linear.NewFunction("f", linear.Sig{})
+	// x2 = spilled + x1; x4 = spilled + x3
+	fn.Append(linear.Lop{Op: rtl.Oadd{}, Args: []linear.Loc{spilled, linear.R{Reg: ltl.X1}}, Dest: linear.R{Reg: ltl.X2}})
+	fn.Append(linear.Lop{Op: rtl.Oadd{}, Args: []linear.Loc{spilled, linear.R{Reg: ltl.X3}}, Dest: linear.R{Reg: ltl.X4}})
+	fn.Append(linear.Lreturn{})
+
+	if n := countReloads(Transform(fn)); n != 1 {
+		t.Errorf("expected 1 reload, got %d", n)
+	}
+}
+
+func TestRemoveRedundantReloads(t *testing.T) {
+	load := func(dest mach.MReg, ofs int64) mach.Mgetstack {
+		return mach.Mgetstack{Ofs: ofs, Ty: ltl.Tint, Dest: dest}
+	}
+	use := func(r mach.MReg) mach.Mop {
+		return mach.Mop{Op: rtl.Oadd{}, Args: []mach.MReg{r, ltl.X1}, Dest: ltl.X2}
+	}
+	tests := []struct {
+		name    string
+		code    []mach.Instruction
+		reloads int
+	}{
+		{
+			name:    "stored value is reused",
+			code:    []mach.Instruction{mach.Msetstack{Src: ltl.X16, Ofs: -8, Ty: ltl.Tint}, load(ltl.X16, -8), use(ltl.X16)},
+			reloads: 0,
+		},
+		{
+			name:    "temporary overwritten",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mop{Op: rtl.Oadd{}, Args: []mach.MReg{ltl.X16, ltl.X1}, Dest: ltl.X16}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			name:    "slot rewritten",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Msetstack{Src: ltl.X1, Ofs: -8, Ty: ltl.Tint}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			name:    "overlapping slot rewritten",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Msetstack{Src: ltl.X1, Ofs: -12, Ty: ltl.Tlong}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			name:    "call clobbers temporaries",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mcall{Fn: mach.FunSymbol{Name: "g"}}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			// x2 = x8 % x1 holds the quotient in X16
+			name:    "scratch of a remainder clobbers the temporary",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mop{Op: rtl.Omod{}, Args: []mach.MReg{ltl.X8, ltl.X1}, Dest: ltl.X2}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			// with the dividend in X16, the quotient goes to X17
+			name:    "scratch avoids the arguments",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mop{Op: rtl.Omod{}, Args: []mach.MReg{ltl.X16, ltl.X1}, Dest: ltl.X2}, load(ltl.X16, -8)},
+			reloads: 1,
+		},
+		{
+			// a byte load from x3[x4] computes the address in X16
+			name:    "address scratch of a load clobbers the temporary",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mload{Chunk: ltl.Mint8signed, Addr: rtl.Aindexed2{}, Args: []mach.MReg{ltl.X3, ltl.X4}, Dest: ltl.X2}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+		{
+			// a word load from x3[x4] encodes the index directly
+			name:    "register offset load keeps the temporary",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mload{Chunk: ltl.Mint32, Addr: rtl.Aindexed2{}, Args: []mach.MReg{ltl.X3, ltl.X4}, Dest: ltl.X2}, load(ltl.X16, -8)},
+			reloads: 1,
+		},
+		{
+			// storing X16 to a global computes the address in X17
+			name:    "address scratch of a store avoids the stored value",
+			code:    []mach.Instruction{load(ltl.X16, -8), load(ltl.X17, -16), mach.Mstore{Chunk: ltl.Mint32, Addr: rtl.Aglobal{Symbol: "g"}, Src: ltl.X16}, load(ltl.X16, -8), load(ltl.X17, -16)},
+			reloads: 3,
+		},
+		{
+			name:    "label starts a new run",
+			code:    []mach.Instruction{load(ltl.X16, -8), mach.Mlabel{Lbl: 1}, load(ltl.X16, -8)},
+			reloads: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := &mach.Function{Code: tt.code}
+			RemoveRedundantReloads(fn)
+			if n := countReloads(fn); n != tt.reloads {
+				t.Errorf("expected %d reloads, got %d: %v", tt.reloads, n, fn.Code)
+			}
+		})
+	}
+}
+
+func TestReloadIntoOtherTemporaryBecomesMove(t *testing.T) {
+	fn := &mach.Function{Code: []mach.Instruction{
+		mach.Mgetstack{Ofs: -8, Ty: ltl.Tint, Dest: ltl.X16},
+		mach.Mgetstack{Ofs: -8, Ty: ltl.Tint, Dest: ltl.X17},
+	}}
+	RemoveRedundantReloads(fn)
+
+	if len(fn.Code) != 2 {
+		t.Fatalf("expected 2 instructions, got %v", fn.Code)
+	}
+	mov, ok := fn.Code[1].(mach.Mop)
+	if !ok || len(mov.Args) != 1 || mov.Args[0] != ltl.X16 || mov.Dest != ltl.X17 {
+		t.Errorf("expected X17 = move X16, got %#v", fn.Code[1])
+	}
+}
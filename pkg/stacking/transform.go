@@ -4,6 +4,7 @@ import (
 	"github.com/raymyers/ralph-cc/pkg/linear"
 	"github.com/raymyers/ralph-cc/pkg/ltl"
 	"github.com/raymyers/ralph-cc/pkg/mach"
+	"github.com/raymyers/ralph-cc/pkg/rtl"
 )
 
 // Transform converts a Linear function to Mach code
@@ -28,6 +29,7 @@ func TransformProgram(prog *linear.Program) *mach.Program {
 			Size:     g.Size,
 			Init:     g.Init,
 			ReadOnly: g.ReadOnly,
+			Static:   g.Static,
 		}
 	}
 
@@ -67,6 +69,15 @@ func (t *transformer) transform() *mach.Function {
 	machFn.Stacksize = t.layout.TotalSize
 	machFn.CalleeSaveRegs = usedCalleeSave
 	machFn.UsesFramePtr = t.layout.UseFramePointer
+	machFn.Static = t.linearFn.Static
+	if t.layout.VarArgsSaveSize > 0 {
+		named := len(t.linearFn.Params)
+		if t.linearFn.Sig.Sret {
+			// The result pointer arrives in X8, not an argument register
+			named--
+		}
+		machFn.VarArgs = varArgs(t.layout, named)
+	}
 
 	// 6. Generate prologue
 	prologue := GeneratePrologue(t.layout, t.calleeSave)
@@ -75,7 +86,7 @@ func (t *transformer) transform() *mach.Function {
 	}
 
 	// 6b. Generate parameter copies (move from incoming regs to allocated locations)
-	paramCopies := GenerateParamCopies(t.linearFn.Params, t.slotTrans)
+	paramCopies := GenerateParamCopies(t.linearFn.Sig, t.linearFn.Params, t.slotTrans)
 	for _, inst := range paramCopies {
 		machFn.Append(inst)
 	}
@@ -88,9 +99,23 @@ func (t *transformer) transform() *mach.Function {
 		}
 	}
 
+	// 8. Drop reloads of spilled values still held in a temporary
+	RemoveRedundantReloads(machFn)
+
 	return machFn
 }
 
+// varArgs describes the argument register save area of a function with
+// the given number of named parameters.
+func varArgs(layout *FrameLayout, params int) *mach.VarArgs {
+	va := &mach.VarArgs{SaveOfs: layout.VarArgsSaveOffset, NamedRegs: params}
+	if params > len(intArgRegs) {
+		va.NamedRegs = len(intArgRegs)
+		va.NamedStack = int64(params-len(intArgRegs)) * pointerSize
+	}
+	return va
+}
+
 // tempRegs are scratch registers for spilling operations during stacking
 // Using X16/X17 (IP0/IP1) which are reserved for linker veneers but safe to use here
 var stackingTempRegs = []ltl.MReg{ltl.X16, ltl.X17}
@@ -156,6 +181,34 @@ func (t *transformer) transformInst(inst linear.Instruction) []mach.Instruction
 	}
 }
 
+// remainder computes the remainder of two spilled arguments, reloaded into
+// both stacking temporaries, into dest. The assembly of a remainder needs
+// a scratch register for the quotient, and with no temporary left the
+// quotient replaces the dividend, which is reloaded for the subtraction.
+func (t *transformer) remainder(i linear.Lop, dest ltl.MReg) []mach.Instruction {
+	var div, mul, sub mach.Operation
+	switch i.Op.(type) {
+	case rtl.Omod:
+		div, mul, sub = rtl.Odiv{}, rtl.Omul{}, rtl.Osub{}
+	case rtl.Omodu:
+		div, mul, sub = rtl.Odivu{}, rtl.Omul{}, rtl.Osub{}
+	case rtl.Omodl:
+		div, mul, sub = rtl.Odivl{}, rtl.Omull{}, rtl.Osubl{}
+	case rtl.Omodlu:
+		div, mul, sub = rtl.Odivlu{}, rtl.Omull{}, rtl.Osubl{}
+	default:
+		panic("no scratch register for operation with two stack slot arguments")
+	}
+	dividend := i.Args[0].(linear.S)
+	x, y := stackingTempRegs[0], stackingTempRegs[1]
+	return []mach.Instruction{
+		mach.Mop{Op: div, Args: []ltl.MReg{x, y}, Dest: x},
+		mach.Mop{Op: mul, Args: []ltl.MReg{x, y}, Dest: x},
+		t.slotTrans.TranslateGetstack(linear.Lgetstack{Slot: dividend.Slot, Ofs: dividend.Ofs, Ty: dividend.Ty, Dest: y}),
+		mach.Mop{Op: sub, Args: []ltl.MReg{y, x}, Dest: dest},
+	}
+}
+
 // transformLop handles Lop instructions, generating loads for stack slot args
 // and stores for stack slot destinations
 func (t *transformer) transformLop(i linear.Lop) []mach.Instruction {
@@ -212,11 +265,15 @@ func (t *transformer) transformLop(i linear.Lop) []mach.Instruction {
 	}
 
 	// Emit the operation
-	result = append(result, mach.Mop{
-		Op:   i.Op,
-		Args: args,
-		Dest: destReg,
-	})
+	if mach.NeedsScratch(i.Op) && tempIdx == len(stackingTempRegs) {
+		result = append(result, t.remainder(i, destReg)...)
+	} else {
+		result = append(result, mach.Mop{
+			Op:   t.relocateOp(i.Op),
+			Args: args,
+			Dest: destReg,
+		})
+	}
 
 	// If dest was a stack slot, store the result
 	if destSlot != nil {
@@ -231,6 +288,23 @@ func (t *transformer) transformLop(i linear.Lop) []mach.Instruction {
 	return result
 }
 
+// relocateOp turns the offset of a stack variable's address, which is
+// relative to the start of the stack data, into an FP-relative one.
+func (t *transformer) relocateOp(op linear.Operation) linear.Operation {
+	if o, ok := op.(rtl.Oaddrstack); ok {
+		return rtl.Oaddrstack{Offset: t.layout.StackDataOffset + o.Offset}
+	}
+	return op
+}
+
+// relocateAddr makes an Ainstack addressing mode FP-relative, like relocateOp.
+func (t *transformer) relocateAddr(addr linear.AddressingMode) linear.AddressingMode {
+	if a, ok := addr.(rtl.Ainstack); ok {
+		return rtl.Ainstack{Offset: t.layout.StackDataOffset + a.Offset}
+	}
+	return addr
+}
+
 // transformLload handles Lload instructions with possible stack slot operands
 func (t *transformer) transformLload(i linear.Lload) []mach.Instruction {
 	var result []mach.Instruction
@@ -252,10 +326,11 @@ func (t *transformer) transformLload(i linear.Lload) []mach.Instruction {
 	}
 
 	result = append(result, mach.Mload{
-		Chunk: i.Chunk,
-		Addr:  i.Addr,
-		Args:  args,
-		Dest:  destReg,
+		Chunk:    i.Chunk,
+		Addr:     t.relocateAddr(i.Addr),
+		Args:     args,
+		Dest:     destReg,
+		Volatile: i.Volatile,
 	})
 
 	if destSlot != nil {
@@ -281,10 +356,11 @@ func (t *transformer) transformLstore(i linear.Lstore) []mach.Instruction {
 	src := t.ensureInReg(i.Src, &result, len(i.Args))
 
 	result = append(result, mach.Mstore{
-		Chunk: i.Chunk,
-		Addr:  i.Addr,
-		Args:  args,
-		Src:   src,
+		Chunk:    i.Chunk,
+		Addr:     t.relocateAddr(i.Addr),
+		Args:     args,
+		Src:      src,
+		Volatile: i.Volatile,
 	})
 
 	return result
@@ -1,6 +1,7 @@
 package stacking
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/raymyers/ralph-cc/pkg/linear"
@@ -403,3 +404,33 @@ func TestTransformCalleeSaveRegs(t *testing.T) {
 		t.Errorf("expected X19 in CalleeSaveRegs, got %v", machFn.CalleeSaveRegs)
 	}
 }
+
+func TestTransformRemainderOfSpilledArguments(t *testing.T) {
+	// x2 = a % b with both a and b spilled: the quotient cannot go to a
+	// scratch register, both temporaries holding the arguments
+	a := linear.S{Slot: linear.SlotLocal, Ofs: 0, Ty: linear.Tint}
+	b := linear.S{Slot: linear.SlotLocal, Ofs: 8, Ty: linear.Tint}
+	fn := linear.NewFunction("f", linear.Sig{})
+	fn.Append(linear.Lop{Op: rtl.Omod{}, Args: []linear.Loc{a, b}, Dest: linear.R{Reg: ltl.X2}})
+	fn.Append(linear.Lreturn{})
+
+	var ops []mach.Mop
+	for _, inst := range Transform(fn).Code {
+		if op, ok := inst.(mach.Mop); ok {
+			if mach.NeedsScratch(op.Op) {
+				t.Errorf("unexpected %#v with no scratch register", op)
+			}
+			if len(op.Args) == 2 { // skip the frame setup
+				ops = append(ops, op)
+			}
+		}
+	}
+	want := []mach.Mop{
+		{Op: rtl.Odiv{}, Args: []mach.MReg{ltl.X16, ltl.X17}, Dest: ltl.X16},
+		{Op: rtl.Omul{}, Args: []mach.MReg{ltl.X16, ltl.X17}, Dest: ltl.X16},
+		{Op: rtl.Osub{}, Args: []mach.MReg{ltl.X17, ltl.X16}, Dest: ltl.X2},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+}